@@ -35,16 +35,10 @@ func needsPush(prev config.Config, curr config.Config) bool {
 	if !strings.HasSuffix(prev.GroupVersionKind.Group, "istio.io") {
 		return true
 	}
-	// If current metadata has "*istio.io" label/annotation, just push
-	for label := range curr.Meta.Labels {
-		if strings.Contains(label, "istio.io") {
-			return true
-		}
-	}
-	for annotation := range curr.Meta.Annotations {
-		if strings.Contains(annotation, "istio.io") {
-			return true
-		}
+	// If current or previous metadata has "*istio.io" label/annotation, just push. Checking the previous metadata
+	// ensures that removing such a label/annotation takes effect.
+	if hasIstioMetadata(curr.Meta) || hasIstioMetadata(prev.Meta) {
+		return true
 	}
 	prevspecProto, okProtoP := prev.Spec.(proto.Message)
 	currspecProto, okProtoC := curr.Spec.(proto.Message)
@@ -58,3 +52,18 @@ func needsPush(prev config.Config, curr config.Config) bool {
 	}
 	return true
 }
+
+// hasIstioMetadata checks if the metadata has any "*istio.io" label or annotation.
+func hasIstioMetadata(meta config.Meta) bool {
+	for label := range meta.Labels {
+		if strings.Contains(label, "istio.io") {
+			return true
+		}
+	}
+	for annotation := range meta.Annotations {
+		if strings.Contains(annotation, "istio.io") {
+			return true
+		}
+	}
+	return false
+}
@@ -134,6 +134,27 @@ func TestNeedsPush(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "config with istio.io annotation removed",
+			prev: config.Config{
+				Meta: config.Meta{
+					GroupVersionKind: gvk.Telemetry,
+					Name:             "acme2-v1",
+					Namespace:        "not-default",
+					Annotations:      map[string]string{constants.TelemetryUpstreamTracingTags: "true"},
+				},
+				Spec: &networking.VirtualService{},
+			},
+			curr: config.Config{
+				Meta: config.Meta{
+					GroupVersionKind: gvk.Telemetry,
+					Name:             "acme2-v1",
+					Namespace:        "not-default",
+				},
+				Spec: &networking.VirtualService{},
+			},
+			expected: true,
+		},
 		{
 			name: "non istio resources",
 			prev: config.Config{
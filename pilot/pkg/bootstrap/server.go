@@ -220,6 +220,8 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	e.TrustBundle = s.workloadTrustBundle
 	s.XDSServer = xds.NewDiscoveryServer(e, args.Plugins, args.PodName, args.Namespace, args.RegistryOptions.KubeOptions.ClusterAliases)
 
+	args.RegistryOptions.KubeOptions.Revision = args.Revision
+
 	// used for both initKubeRegistry and initClusterRegistries
 	if features.EnableEndpointSliceController {
 		args.RegistryOptions.KubeOptions.EndpointMode = kubecontroller.EndpointSliceOnly
@@ -538,6 +540,9 @@ func (s *Server) initSDSServer(args *PilotArgs) {
 					})
 				})
 				s.XDSServer.Generators[v3.SecretType] = xds.NewSecretGen(sc, s.XDSServer.Cache, s.clusterID)
+				if ecdsGen, ok := s.XDSServer.Generators[v3.ExtensionConfigurationType].(*xds.EcdsGenerator); ok {
+					ecdsGen.SetCredController(sc)
+				}
 				s.secretsController = sc
 				return nil
 			})
@@ -939,6 +944,18 @@ func (s *Server) initRegistryEventHandlers() {
 					Reason: []model.TriggerReason{model.NamespaceUpdate},
 				})
 			})
+			s.environment.GatewayAPIController.RegisterEventHandler(gvk.ConfigMap, func(config.Config, config.Config, model.Event) {
+				s.XDSServer.ConfigUpdate(&model.PushRequest{
+					Full:   true,
+					Reason: []model.TriggerReason{model.ConfigUpdate},
+				})
+			})
+			s.environment.GatewayAPIController.RegisterEventHandler(gvk.MutatingWebhookConfiguration, func(config.Config, config.Config, model.Event) {
+				s.XDSServer.ConfigUpdate(&model.PushRequest{
+					Full:   true,
+					Reason: []model.TriggerReason{model.ConfigUpdate},
+				})
+			})
 		}
 	}
 }
@@ -17,24 +17,41 @@ package gateway
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"unicode/utf8"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	"istio.io/istio/pilot/pkg/model/kstatus"
+	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
 
-func createRouteStatus(gateways []routeParentReference, obj config.Config, current []k8s.RouteParentStatus, routeErr *ConfigError) []k8s.RouteParentStatus {
+// createRouteStatus reports the status of a route for each of its parents. refErr reports a reference of the route
+// that was not resolved; unlike routeErr, it does not prevent the route from being accepted. warnings are reported
+// in the Accepted condition of a valid route.
+func createRouteStatus(gateways []routeParentReference, obj config.Config, current []k8s.RouteParentStatus, routeErr *ConfigError,
+	refErr *ConfigError, warnings []string) []k8s.RouteParentStatus {
 	gws := make([]k8s.RouteParentStatus, 0, len(gateways))
 	// Fill in all the gateways that are already present but not owned by us. This is non-trivial as there may be multiple
 	// gateway controllers that are exposing their status on the same route. We need to attempt to manage ours properly (including
 	// removing gateway references when they are removed), without mangling other Controller's status.
+	// The status of parents handled by other revisions is written by these, so it is kept as well
+	otherRevision := map[string]bool{}
+	for _, gw := range gateways {
+		if gw.DeniedReason == errOtherRevision {
+			otherRevision[parentRefString(gw.OriginalReference)] = true
+		}
+	}
+	owned := map[string][]metav1.Condition{}
 	for _, r := range current {
-		if r.ControllerName != ControllerName {
+		if r.ControllerName != ControllerName || otherRevision[parentRefString(r.ParentRef)] {
 			// We don't own this status, so keep it around
 			gws = append(gws, r)
+		} else {
+			owned[parentRefString(r.ParentRef)] = r.Conditions
 		}
 	}
 	// Collect all of our unique parent references. There may be multiple when we have a route without section name,
@@ -42,6 +59,9 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 	seen := map[k8s.ParentRef]routeParentReference{}
 	failedCount := map[k8s.ParentRef]int{}
 	for _, gw := range gateways {
+		if gw.DeniedReason == errOtherRevision {
+			continue
+		}
 		// We will append it if it is our first occurrence, or the existing one has an error. This means
 		// if *any* section has no errors, we will declare Admitted
 		if gw.DeniedReason != nil {
@@ -52,8 +72,21 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 		}
 	}
 	// Now we fill in all the ones we do own
-	// TODO look into also reporting ResolvedRefs; we should be gracefully dropping invalid backends instead
-	// of rejecting the whole thing.
+	// TODO invalid backends of HTTP routes are gracefully dropped; we should do the same for TCP and TLS routes
+	// instead of rejecting the whole thing.
+	resolvedRefs := metav1.Condition{
+		Type:               RouteConditionResolvedRefs,
+		Status:             kstatus.StatusTrue,
+		ObservedGeneration: obj.Generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             RouteConditionResolvedRefs,
+		Message:            "All references resolved",
+	}
+	if refErr != nil {
+		resolvedRefs.Status = kstatus.StatusFalse
+		resolvedRefs.Reason = refErr.Reason
+		resolvedRefs.Message = truncateMessage(refErr.Message)
+	}
 	for k, gw := range seen {
 		var condition metav1.Condition
 		if routeErr != nil {
@@ -63,7 +96,7 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 				ObservedGeneration: obj.Generation,
 				LastTransitionTime: metav1.Now(),
 				Reason:             routeErr.Reason,
-				Message:            routeErr.Message,
+				Message:            truncateMessage(routeErr.Message),
 			}
 		} else if gw.DeniedReason != nil {
 			err := gw.DeniedReason.Error()
@@ -76,7 +109,7 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 				ObservedGeneration: obj.Generation,
 				LastTransitionTime: metav1.Now(),
 				Reason:             InvalidParentRef,
-				Message:            err,
+				Message:            truncateMessage(err),
 			}
 		} else {
 			condition = metav1.Condition{
@@ -87,11 +120,14 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 				Reason:             "RouteAdmitted",
 				Message:            "Route was valid",
 			}
+			if len(warnings) > 0 {
+				condition.Message = truncateMessage("Route was valid, with warnings: " + strings.Join(warnings, "; "))
+			}
 		}
 		gws = append(gws, k8s.RouteParentStatus{
 			ParentRef:      gw.OriginalReference,
 			ControllerName: ControllerName,
-			Conditions:     []metav1.Condition{condition},
+			Conditions:     keepTransitionTimes([]metav1.Condition{condition, resolvedRefs}, owned[parentRefString(k)]),
 		})
 	}
 	// Ensure output is deterministic.
@@ -102,6 +138,19 @@ func createRouteStatus(gateways []routeParentReference, obj config.Config, curre
 	return gws
 }
 
+// keepTransitionTimes keeps the LastTransitionTime of the conditions that are unchanged from the current ones, so
+// recomputing an unchanged status does not modify it.
+func keepTransitionTimes(conditions []metav1.Condition, current []metav1.Condition) []metav1.Condition {
+	for i, c := range conditions {
+		old := kstatus.GetCondition(current, c.Type)
+		if old.Status == c.Status && old.Reason == c.Reason && old.Message == c.Message &&
+			old.ObservedGeneration == c.ObservedGeneration {
+			conditions[i].LastTransitionTime = old.LastTransitionTime
+		}
+	}
+	return conditions
+}
+
 type ConfigErrorReason = string
 
 const (
@@ -115,8 +164,16 @@ const (
 	InvalidTLS ConfigErrorReason = "InvalidTLS"
 	// InvalidConfiguration indicates a generic error for all other invalid configurations
 	InvalidConfiguration ConfigErrorReason = "InvalidConfiguration"
+	// RefNotPermitted indicates a reference to another namespace is not allowed by any ReferencePolicy
+	RefNotPermitted ConfigErrorReason = "RefNotPermitted"
+	// UnsupportedValue indicates a value that cannot be programmed, such as an invalid regular expression
+	UnsupportedValue ConfigErrorReason = "UnsupportedValue"
 )
 
+// RouteConditionResolvedRefs reports whether all references of a route could be resolved. Unlike for listeners,
+// the Gateway API does not define it for routes yet.
+const RouteConditionResolvedRefs = "ResolvedRefs"
+
 // ConfigError represents an invalid configuration that will be reported back to the user.
 type ConfigError struct {
 	Reason  ConfigErrorReason
@@ -166,7 +223,7 @@ func setConditions(generation int64, existingConditions []metav1.Condition, cond
 				ObservedGeneration: generation,
 				LastTransitionTime: metav1.Now(),
 				Reason:             cond.error.Reason,
-				Message:            cond.error.Message,
+				Message:            truncateMessage(cond.error.Message),
 			})
 		} else {
 			status := cond.status
@@ -179,7 +236,7 @@ func setConditions(generation int64, existingConditions []metav1.Condition, cond
 				ObservedGeneration: generation,
 				LastTransitionTime: metav1.Now(),
 				Reason:             cond.reason,
-				Message:            cond.message,
+				Message:            truncateMessage(cond.message),
 			})
 		}
 	}
@@ -195,7 +252,12 @@ func reportGatewayCondition(obj config.Config, conditions map[string]*condition)
 }
 
 func reportListenerAttachedRoutes(index int, obj config.Config, i int32) {
-	obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
+	ws := obj.Status.(*kstatus.WrappedStatus)
+	// Routes are counted on every conversion; skip the mutation if the count did not change.
+	if gs, ok := ws.Unwrap().(*k8s.GatewayStatus); ok && index < len(gs.Listeners) && gs.Listeners[index].AttachedRoutes == i {
+		return
+	}
+	ws.Mutate(func(s config.Status) config.Status {
 		gs := s.(*k8s.GatewayStatus)
 		for index >= len(gs.Listeners) {
 			gs.Listeners = append(gs.Listeners, k8s.ListenerStatus{})
@@ -215,8 +277,9 @@ func reportListenerCondition(index int, l k8s.Listener, obj config.Config, condi
 		}
 		cond := gs.Listeners[index].Conditions
 		gs.Listeners[index] = k8s.ListenerStatus{
-			Name:           l.Name,
-			AttachedRoutes: 0, // this will be reported later
+			Name: l.Name,
+			// This will be reported later. Keep the current count, so an unchanged count is not a change.
+			AttachedRoutes: gs.Listeners[index].AttachedRoutes,
 			SupportedKinds: generateSupportedKinds(l),
 			Conditions:     setConditions(obj.Generation, cond, conditions),
 		}
@@ -238,14 +301,14 @@ func generateSupportedKinds(l k8s.Listener) []k8s.RouteGroupKind {
 		} else {
 			supported = []k8s.RouteGroupKind{{Group: (*k8s.Group)(StrPointer(gvk.TCPRoute.Group)), Kind: k8s.Kind(gvk.TCPRoute.Kind)}}
 		}
-		// UDP route note support
+		// UDPRoute is not supported, UDP listeners are rejected by validateListenerProtocol
 	}
 	if l.AllowedRoutes != nil && len(l.AllowedRoutes.Kinds) > 0 {
 		// We need to filter down to only ones we actually support
 		intersection := []k8s.RouteGroupKind{}
 		for _, s := range supported {
 			for _, kind := range l.AllowedRoutes.Kinds {
-				if s == kind {
+				if routeGroupKindEqual(s, kind) {
 					intersection = append(intersection, s)
 					break
 				}
@@ -255,3 +318,64 @@ func generateSupportedKinds(l k8s.Listener) []k8s.RouteGroupKind {
 	}
 	return supported
 }
+
+// invalidRouteKinds returns the kinds allowed by the listener that it cannot support, either because the
+// group is unknown or because the kind cannot be used with the listener protocol. Each kind is returned once, in
+// the order it is first allowed.
+func invalidRouteKinds(l k8s.Listener) []string {
+	if l.AllowedRoutes == nil {
+		return nil
+	}
+	supported := generateSupportedKinds(k8s.Listener{Protocol: l.Protocol, TLS: l.TLS})
+	invalid := []string{}
+	seen := sets.NewSet()
+	for _, kind := range l.AllowedRoutes.Kinds {
+		found := false
+		for _, s := range supported {
+			if routeGroupKindEqual(s, kind) {
+				found = true
+				break
+			}
+		}
+		name := routeGroup(kind.Group) + "/" + string(kind.Kind)
+		if !found && !seen.Contains(name) {
+			seen.Insert(name)
+			invalid = append(invalid, name)
+		}
+	}
+	return invalid
+}
+
+// routeGroup returns the group of a route kind reference. An unset or empty group refers to the gateway-api group.
+func routeGroup(g *k8s.Group) string {
+	if g == nil || *g == "" {
+		return gvk.HTTPRoute.Group
+	}
+	return string(*g)
+}
+
+func routeGroupKindEqual(a, b k8s.RouteGroupKind) bool {
+	return a.Kind == b.Kind && routeGroup(a.Group) == routeGroup(b.Group)
+}
+
+// maxStatusMessageLength bounds the length of condition messages we write. The API server accepts much larger
+// messages, but these are not usefully rendered by kubectl and tools built on it.
+const maxStatusMessageLength = 1024
+
+const truncatedMessageSuffix = "... (truncated)"
+
+// truncateMessage bounds the message to maxStatusMessageLength. Messages built from lists are already
+// summarized (see humanReadableJoin and boundedJoin); this is a last resort for long individual items.
+// The full message is logged at debug level.
+func truncateMessage(msg string) string {
+	if len(msg) <= maxStatusMessageLength {
+		return msg
+	}
+	log.Debugf("truncating status message: %s", msg)
+	cut := maxStatusMessageLength - len(truncatedMessageSuffix)
+	// Do not split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	return msg[:cut] + truncatedMessageSuffix
+}
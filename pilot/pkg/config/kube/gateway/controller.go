@@ -15,22 +15,30 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
 	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	listerv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/model/credentials"
 	"istio.io/istio/pilot/pkg/model/kstatus"
+	"istio.io/istio/pilot/pkg/secrets"
+	kubesecrets "istio.io/istio/pilot/pkg/secrets/kube"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pilot/pkg/status"
 	"istio.io/istio/pilot/pkg/util/sets"
@@ -39,6 +47,8 @@ import (
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/kube/controllers"
+	"istio.io/istio/pkg/revisions"
 	istiolog "istio.io/pkg/log"
 )
 
@@ -46,14 +56,14 @@ var log = istiolog.RegisterScope("gateway", "gateway-api controller", 0)
 
 var (
 	errUnsupportedOp   = fmt.Errorf("unsupported operation: the gateway config store is a read-only view")
-	errUnsupportedType = fmt.Errorf("unsupported type: this operation only supports gateway and virtual service resource type")
+	errUnsupportedType = fmt.Errorf("unsupported type: this operation only supports gateway, virtual service and envoy filter resource type")
 )
 
 // Controller defines the controller for the gateway-api. The controller acts a bit different from most.
 // Rather than watching the CRs directly, we depend on the existing model.ConfigStoreCache which
 // already watches all CRs. When there are updates, a new PushContext will be computed, which will eventually
 // call Controller.Recompute(). Once this happens, we will inspect the current state of the world, and transform
-// gateway-api types into Istio types (Gateway/VirtualService). Future calls to Get/List will return these
+// gateway-api types into Istio types (Gateway/VirtualService/EnvoyFilter). Future calls to Get/List will return these
 // Istio types. These are not stored in the cluster at all, and are purely internal; they can be seen on /debug/configz.
 // During Recompute(), the status on all gateway-api types is also tracked. Once completed, if the status
 // has changed at all, it is queued to asynchronously update the status of the object in Kubernetes.
@@ -63,14 +73,38 @@ type Controller struct {
 	// cache provides access to the underlying gateway-configs
 	cache model.ConfigStoreCache
 
+	// credentials reads the certificates referenced by listeners. It is only set if certificate validation is enabled.
+	credentials secrets.Controller
+
 	// Gateway-api types reference namespace labels directly, so we need access to these
 	namespaceLister   listerv1.NamespaceLister
 	namespaceInformer cache.SharedIndexInformer
 	namespaceHandler  model.EventHandler
-
-	// domain stores the cluster domain, typically cluster.local
+	// namespacesPending is set when a Recompute was deferred until the namespaces are synced. Access is guarded by
+	// stateMu.
+	namespacesPending bool
+	// deletedNamespaces stores the namespaces being deleted. The gateway-api objects in these namespaces are ignored,
+	// rather than waiting for their own delete events. Access is guarded by stateMu.
+	deletedNamespaces sets.Set
+
+	// GatewayClasses reference ConfigMaps holding their parameters, so we need access to these
+	configMapLister   listerv1.ConfigMapLister
+	configMapInformer cache.SharedIndexInformer
+	configMapHandler  model.EventHandler
+	// defaultRevisionHandler is triggered when the default revision changes. See defaultRevisionChanged.
+	defaultRevisionHandler model.EventHandler
+	// referencedConfigMaps stores the ConfigMaps referenced by GatewayClasses. Access is guarded by stateMu.
+	referencedConfigMaps map[types.NamespacedName]struct{}
+
+	// domain stores the default cluster domain, typically cluster.local. The domain of the push context, if set,
+	// takes precedence; see domainSuffix.
 	domain string
 
+	// revision is the control plane revision. Only gateway-api objects for this revision are handled; see revisionFilter.
+	revision string
+	// defaultWatcher tracks the default revision, which handles objects without a revision label.
+	defaultWatcher revisions.DefaultWatcher
+
 	// state is our computed Istio resources. Access is guarded by stateMu. This is updated from Recompute().
 	state   OutputResources
 	stateMu sync.RWMutex
@@ -79,6 +113,9 @@ type Controller struct {
 	// is only the case when we are the leader.
 	status        status.WorkerQueue
 	statusEnabled *atomic.Bool
+	// events emits Kubernetes events for the errors reported in status. Like status, events are only emitted when
+	// statusEnabled is true.
+	events *conversionEvents
 }
 
 var _ model.GatewayController = &Controller{}
@@ -86,7 +123,10 @@ var _ model.GatewayController = &Controller{}
 func NewController(client kube.Client, c model.ConfigStoreCache, options controller.Options) *Controller {
 	var statusQueue status.WorkerQueue
 	if features.EnableGatewayAPIStatus {
+		// A single Gateway change can update the status of all its routes; bound the rate of the resulting writes.
+		limiter := rate.NewLimiter(rate.Limit(features.StatusQPS), features.StatusBurst)
 		statusQueue = status.NewWorkerPool(func(resource status.Resource, resourceStatus status.ResourceStatus) {
+			_ = limiter.Wait(context.Background())
 			log.Debugf("updating status for %v", resource.String())
 			_, err := c.UpdateStatus(config.Config{
 				// TODO stop round tripping this status.Resource<->config.Meta
@@ -100,15 +140,25 @@ func NewController(client kube.Client, c model.ConfigStoreCache, options control
 		}, uint(features.StatusMaxWorkers))
 	}
 	nsInformer := client.KubeInformer().Core().V1().Namespaces().Informer()
+	cmInformer := client.KubeInformer().Core().V1().ConfigMaps().Informer()
 	gatewayController := &Controller{
 		client:            client,
 		cache:             c,
 		namespaceLister:   client.KubeInformer().Core().V1().Namespaces().Lister(),
 		namespaceInformer: nsInformer,
+		configMapLister:   client.KubeInformer().Core().V1().ConfigMaps().Lister(),
+		configMapInformer: cmInformer,
 		domain:            options.DomainSuffix,
+		revision:          options.Revision,
+		defaultWatcher:    revisions.NewDefaultWatcher(client, options.Revision),
 		status:            statusQueue,
 		// Disabled by default, we will enable only if we win the leader election
-		statusEnabled: atomic.NewBool(false),
+		statusEnabled:     atomic.NewBool(false),
+		events:            newConversionEvents(),
+		deletedNamespaces: sets.NewSet(),
+	}
+	if features.EnableGatewayAPICertificateValidation {
+		gatewayController.credentials = kubesecrets.NewSecretsController(client, options.ClusterID)
 	}
 
 	nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -118,7 +168,18 @@ func NewController(client kube.Client, c model.ConfigStoreCache, options control
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			gatewayController.namespaceEvent(oldObj, newObj)
 		},
+		DeleteFunc: func(obj interface{}) {
+			if ns := toNamespace(obj); ns != nil {
+				gatewayController.namespaceDeleted(ns.Name)
+			}
+		},
+	})
+	cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    gatewayController.configMapEvent,
+		UpdateFunc: func(_, newObj interface{}) { gatewayController.configMapEvent(newObj) },
+		DeleteFunc: gatewayController.configMapEvent,
 	})
+	gatewayController.defaultWatcher.AddHandler(gatewayController.defaultRevisionChanged)
 
 	return gatewayController
 }
@@ -127,6 +188,7 @@ func (c *Controller) Schemas() collection.Schemas {
 	return collection.SchemasFor(
 		collections.IstioNetworkingV1Alpha3Virtualservices,
 		collections.IstioNetworkingV1Alpha3Gateways,
+		collections.IstioNetworkingV1Alpha3Envoyfilters,
 	)
 }
 
@@ -135,7 +197,7 @@ func (c *Controller) Get(typ config.GroupVersionKind, name, namespace string) *c
 }
 
 func (c *Controller) List(typ config.GroupVersionKind, namespace string) ([]config.Config, error) {
-	if typ != gvk.Gateway && typ != gvk.VirtualService {
+	if typ != gvk.Gateway && typ != gvk.VirtualService && typ != gvk.EnvoyFilter {
 		return nil, errUnsupportedType
 	}
 
@@ -146,6 +208,8 @@ func (c *Controller) List(typ config.GroupVersionKind, namespace string) ([]conf
 		return filterNamespace(c.state.Gateway, namespace), nil
 	case gvk.VirtualService:
 		return filterNamespace(c.state.VirtualService, namespace), nil
+	case gvk.EnvoyFilter:
+		return filterNamespace(c.state.EnvoyFilter, namespace), nil
 	default:
 		return nil, errUnsupportedType
 	}
@@ -186,16 +250,44 @@ func (c *Controller) Recompute(context model.GatewayContext) error {
 	if err != nil {
 		return fmt.Errorf("failed to list type BackendPolicy: %v", err)
 	}
+	istioGateway, err := c.cache.List(gvk.Gateway, metav1.NamespaceAll)
+	if err != nil {
+		return fmt.Errorf("failed to list type Istio Gateway: %v", err)
+	}
+
+	// Only handle the objects for our revision, so multiple revisions do not fight over config and status.
+	rf := c.revisionFilter()
+	gateway, otherGateways, gatewayRevisions := rf.filterGateways(gateway)
+	httpRoute = rf.filterRoutes(httpRoute, gatewayRevisions)
+	tcpRoute = rf.filterRoutes(tcpRoute, gatewayRevisions)
+	tlsRoute = rf.filterRoutes(tlsRoute, gatewayRevisions)
+
+	// Objects in namespaces being deleted are ignored, even if their own delete events were not received yet.
+	c.stateMu.Lock()
+	deleted := c.deletedNamespaces.Union(sets.NewSet())
+	c.pruneDeletedNamespaces(gateway, httpRoute, tcpRoute, tlsRoute, referencePolicy)
+	c.stateMu.Unlock()
+	gateway, deletedGateways := splitDeletedNamespaces(gateway, deleted)
+	httpRoute, _ = splitDeletedNamespaces(httpRoute, deleted)
+	tcpRoute, _ = splitDeletedNamespaces(tcpRoute, deleted)
+	tlsRoute, _ = splitDeletedNamespaces(tlsRoute, deleted)
+	referencePolicy, _ = splitDeletedNamespaces(referencePolicy, deleted)
+	istioGateway, _ = splitDeletedNamespaces(istioGateway, deleted)
+	otherGateways, _ = splitDeletedNamespaces(otherGateways, deleted)
 
 	input := &KubernetesResources{
-		GatewayClass:    deepCopyStatus(gatewayClass),
-		Gateway:         deepCopyStatus(gateway),
-		HTTPRoute:       deepCopyStatus(httpRoute),
-		TCPRoute:        deepCopyStatus(tcpRoute),
-		TLSRoute:        deepCopyStatus(tlsRoute),
-		ReferencePolicy: referencePolicy,
-		Domain:          c.domain,
-		Context:         context,
+		GatewayClass:          deepCopyStatus(gatewayClass),
+		Gateway:               deepCopyStatus(gateway),
+		HTTPRoute:             deepCopyStatus(httpRoute),
+		TCPRoute:              deepCopyStatus(tcpRoute),
+		TLSRoute:              deepCopyStatus(tlsRoute),
+		ReferencePolicy:       referencePolicy,
+		IstioGateway:          istioGateway,
+		DeletedGateways:       deletedGateways,
+		OtherRevisionGateways: otherGateways,
+		Domain:                c.domainSuffix(context),
+		Context:               context,
+		Credentials:           c.credentials,
 	}
 
 	if !anyApisUsed(input) {
@@ -207,6 +299,12 @@ func (c *Controller) Recompute(context model.GatewayContext) error {
 		return nil
 	}
 
+	var deferred []config.Config
+	input.Gateway, deferred = c.deferUntilNamespacesSynced(input.Gateway)
+	if len(deferred) > 0 {
+		log.Infof("namespaces are not synced, deferring %d gateways selecting route namespaces", len(deferred))
+	}
+
 	nsl, err := c.namespaceLister.List(klabels.Everything())
 	if err != nil {
 		return fmt.Errorf("failed to list type Namespaces: %v", err)
@@ -216,10 +314,24 @@ func (c *Controller) Recompute(context model.GatewayContext) error {
 		namespaces[ns.Name] = ns
 	}
 	input.Namespaces = namespaces
-	output := convertResources(input)
+	input.ConfigMaps, err = c.fetchParameterConfigMaps(input.GatewayClass)
+	if err != nil {
+		return err
+	}
+	c.stateMu.RLock()
+	input.PreviousVirtualServices = c.state.VirtualService
+	c.stateMu.RUnlock()
+	output, err := convertResourcesSafely(input)
+	if err != nil {
+		// Keep the last successfully computed state, rather than dropping all gateway-api config.
+		return err
+	}
 
-	// Handle all status updates
-	c.QueueStatusUpdates(input)
+	// Handle all status updates. While gateways are deferred, routes attached to them would be reported as
+	// referencing a missing parent, so status is written once they are converted.
+	if len(deferred) == 0 {
+		c.QueueStatusUpdates(input)
+	}
 
 	c.stateMu.Lock()
 	defer c.stateMu.Unlock()
@@ -227,12 +339,95 @@ func (c *Controller) Recompute(context model.GatewayContext) error {
 	return nil
 }
 
+// domainSuffix returns the cluster domain to convert with. It is read on each Recompute, so a change of domain
+// regenerates all hosts rather than leaving config built for the previous domain.
+func (c *Controller) domainSuffix(context model.GatewayContext) string {
+	if d := context.DomainSuffix(); d != "" {
+		return d
+	}
+	return c.domain
+}
+
 func (c *Controller) QueueStatusUpdates(r *KubernetesResources) {
-	c.handleStatusUpdates(r.GatewayClass)
+	// GatewayClasses are used by Gateways of all revisions, but status is only written by the owning revision.
+	c.handleStatusUpdates(c.revisionFilter().filter(r.GatewayClass))
 	c.handleStatusUpdates(r.Gateway)
-	c.handleStatusUpdates(r.HTTPRoute)
-	c.handleStatusUpdates(r.TCPRoute)
-	c.handleStatusUpdates(r.TLSRoute)
+	routes := make([]config.Config, 0, len(r.HTTPRoute)+len(r.TCPRoute)+len(r.TLSRoute))
+	routes = append(routes, r.HTTPRoute...)
+	routes = append(routes, r.TCPRoute...)
+	routes = append(routes, r.TLSRoute...)
+	c.handleStatusUpdates(c.prioritizeRouteStatus(routes))
+	if c.status != nil && c.statusEnabled.Load() {
+		c.events.report(r.Gateway)
+		c.events.report(routes)
+	}
+}
+
+// prioritizeRouteStatus orders the routes so the ones whose acceptance changed are written first. The status queue
+// runs in order, so users see these promptly even when a Gateway change updates the status of many routes.
+func (c *Controller) prioritizeRouteStatus(routes []config.Config) []config.Config {
+	if c.status == nil || !c.statusEnabled.Load() {
+		return routes
+	}
+	changed := map[int]bool{}
+	for i, r := range routes {
+		if !r.Status.(*kstatus.WrappedStatus).Dirty {
+			continue
+		}
+		var current config.Status
+		if cfg := c.cache.Get(r.GroupVersionKind, r.Name, r.Namespace); cfg != nil {
+			current = cfg.Status
+		}
+		changed[i] = routeAcceptanceChanged(current, r.Status.(*kstatus.WrappedStatus).Unwrap())
+	}
+	res := make([]config.Config, 0, len(routes))
+	for i, r := range routes {
+		if changed[i] {
+			res = append(res, r)
+		}
+	}
+	for i, r := range routes {
+		if !changed[i] {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// routeAcceptanceChanged returns whether the Accepted condition of any parent of a route differs between the statuses.
+func routeAcceptanceChanged(old, cur config.Status) bool {
+	accepted := func(s config.Status) map[string]metav1.ConditionStatus {
+		res := map[string]metav1.ConditionStatus{}
+		for _, p := range routeParentStatuses(s) {
+			if p.ControllerName != ControllerName {
+				continue
+			}
+			res[parentRefString(p.ParentRef)] = kstatus.GetCondition(p.Conditions, string(k8s.ConditionRouteAccepted)).Status
+		}
+		return res
+	}
+	o, n := accepted(old), accepted(cur)
+	if len(o) != len(n) {
+		return true
+	}
+	for k, v := range n {
+		if ov, f := o[k]; !f || ov != v {
+			return true
+		}
+	}
+	return false
+}
+
+func routeParentStatuses(s config.Status) []k8s.RouteParentStatus {
+	switch st := s.(type) {
+	case *k8s.HTTPRouteStatus:
+		return st.Parents
+	case *k8s.TCPRouteStatus:
+		return st.Parents
+	case *k8s.TLSRouteStatus:
+		return st.Parents
+	}
+	return nil
 }
 
 func (c *Controller) handleStatusUpdates(configs []config.Config) {
@@ -272,20 +467,72 @@ func (c *Controller) RegisterEventHandler(typ config.GroupVersionKind, handler m
 	switch typ {
 	case gvk.Namespace:
 		c.namespaceHandler = handler
+	case gvk.ConfigMap:
+		c.configMapHandler = handler
+	case gvk.MutatingWebhookConfiguration:
+		c.defaultRevisionHandler = handler
 	}
 	// For all other types, do nothing as c.cache has been registered
 }
 
 func (c *Controller) Run(stop <-chan struct{}) {
-	cache.WaitForCacheSync(stop, c.namespaceInformer.HasSynced)
+	if c.status != nil {
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.client.Kube().CoreV1().Events("")})
+		c.events.setRecorder(broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: ControllerName}))
+		go func() {
+			<-stop
+			c.events.setRecorder(nil)
+			broadcaster.Shutdown()
+		}()
+	}
+	if !cache.WaitForCacheSync(stop, c.namespaceInformer.HasSynced, c.configMapInformer.HasSynced) {
+		return
+	}
+	c.stateMu.Lock()
+	pending := c.namespacesPending
+	c.namespacesPending = false
+	c.stateMu.Unlock()
+	if pending && c.namespaceHandler != nil {
+		log.Debugf("namespaces synced, triggering namespace handler for the deferred recompute")
+		c.namespaceHandler(config.Config{}, config.Config{}, model.EventUpdate)
+	}
+}
+
+// deferUntilNamespacesSynced splits out the Gateways to leave unconverted because the namespaces are not synced yet.
+// Listeners selecting route namespaces by label would match no namespace until then, dropping all routes of their
+// Gateways, as happens on every restart. Only these Gateways are deferred, the others are converted as usual. The
+// controller does not report HasSynced until then, so the partial output is not served. Run triggers a Recompute
+// once the namespaces are synced.
+func (c *Controller) deferUntilNamespacesSynced(gateways []config.Config) (converted []config.Config, deferred []config.Config) {
+	for _, obj := range gateways {
+		if selectsRouteNamespaces(obj) {
+			deferred = append(deferred, obj)
+		} else {
+			converted = append(converted, obj)
+		}
+	}
+	if len(deferred) == 0 {
+		return gateways, nil
+	}
+	// The check and the flag are guarded together, so Run either sees the flag or the check sees the sync.
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.namespaceInformer.HasSynced() {
+		return gateways, nil
+	}
+	c.namespacesPending = true
+	return converted, deferred
 }
 
 func (c *Controller) SetWatchErrorHandler(handler func(r *cache.Reflector, err error)) error {
 	return c.cache.SetWatchErrorHandler(handler)
 }
 
+// HasSynced returns whether the config and the namespaces are synced. Until the namespaces are synced, Gateways
+// selecting route namespaces are deferred, so the controller is not ready to serve their config.
 func (c *Controller) HasSynced() bool {
-	return c.cache.HasSynced()
+	return c.cache.HasSynced() && c.namespaceInformer.HasSynced()
 }
 
 func (c *Controller) SecretAllowed(resourceName string, namespace string) bool {
@@ -295,38 +542,144 @@ func (c *Controller) SecretAllowed(resourceName string, namespace string) bool {
 		return false
 	}
 	from := Reference{Kind: gvk.KubernetesGateway, Namespace: k8s.Namespace(namespace)}
-	to := Reference{Kind: gvk.Secret, Namespace: k8s.Namespace(p.Namespace)}
-	_, f := c.state.AllowedReferences[from][to]
-	return f
+	return c.state.AllowedReferences.Allowed(from, gvk.Secret, p.Name, p.Namespace)
 }
 
 // namespaceEvent handles a namespace add/update. Gateway's can select routes by label, so we need to handle
-// when the labels change.
-// Note: we don't handle delete as a delete would also clean up any relevant gateway-api types which will
-// trigger its own event.
+// when the labels change. A namespace starting to terminate is handled as a deletion; see namespaceDeleted.
 func (c *Controller) namespaceEvent(oldObj interface{}, newObj interface{}) {
-	// First, find all the label keys on the old/new namespace. We include NamespaceNameLabel
-	// since we have special logic to always allow this on namespace.
-	touchedNamespaceLabels := sets.NewSet(NamespaceNameLabel)
-	touchedNamespaceLabels.Insert(getLabelKeys(oldObj)...)
-	touchedNamespaceLabels.Insert(getLabelKeys(newObj)...)
+	oldNs, newNs := toNamespace(oldObj), toNamespace(newObj)
+	if newNs == nil {
+		return
+	}
+	if newNs.DeletionTimestamp != nil {
+		c.namespaceDeleted(newNs.Name)
+		return
+	}
 
-	// Next, we find all keys our Gateways actually reference.
+	// Only trigger a push if the namespace selection of any of our Gateways actually changed. Namespace labels
+	// often change without any impact, and recomputing is expensive with many namespaces.
+	c.stateMu.Lock()
+	// The namespace may be created again after being deleted
+	c.deletedNamespaces.Delete(newNs.Name)
+	affected := c.state.ReferencedNamespaceSelectors.NamespaceAffected(oldNs, newNs)
+	c.stateMu.Unlock()
+
+	if affected && c.namespaceHandler != nil {
+		log.Debugf("namespace %s selection changed, triggering namespace handler", newNs.Name)
+		c.namespaceHandler(config.Config{}, config.Config{}, model.EventUpdate)
+	}
+}
+
+// namespaceDeleted handles the deletion of a namespace. The objects of a namespace are only deleted once it starts
+// terminating, and their delete events may trickle in for a long time. Rather than waiting for these, the config
+// generated in the namespace is dropped at once, and a recompute denies the routes in other namespaces attached to
+// its Gateways.
+func (c *Controller) namespaceDeleted(name string) {
+	c.stateMu.Lock()
+	if c.deletedNamespaces.Contains(name) {
+		c.stateMu.Unlock()
+		return
+	}
+	c.deletedNamespaces.Insert(name)
+	generated := len(filterNamespace(c.state.Gateway, name)) + len(filterNamespace(c.state.VirtualService, name)) +
+		len(filterNamespace(c.state.EnvoyFilter, name))
+	c.state.Gateway, _ = splitDeletedNamespaces(c.state.Gateway, sets.NewSet(name))
+	c.state.VirtualService, _ = splitDeletedNamespaces(c.state.VirtualService, sets.NewSet(name))
+	c.state.EnvoyFilter, _ = splitDeletedNamespaces(c.state.EnvoyFilter, sets.NewSet(name))
+	c.stateMu.Unlock()
+
+	if generated > 0 && c.namespaceHandler != nil {
+		log.Debugf("namespace %s deleted, triggering namespace handler", name)
+		c.namespaceHandler(config.Config{}, config.Config{}, model.EventDelete)
+	}
+}
+
+// pruneDeletedNamespaces stops tracking the deleted namespaces none of the objects are in anymore. Must be called
+// with stateMu held.
+func (c *Controller) pruneDeletedNamespaces(lists ...[]config.Config) {
+	remaining := sets.NewSet()
+	for _, cfgs := range lists {
+		for _, cfg := range cfgs {
+			if c.deletedNamespaces.Contains(cfg.Namespace) {
+				remaining.Insert(cfg.Namespace)
+			}
+		}
+	}
+	c.deletedNamespaces = c.deletedNamespaces.Intersection(remaining)
+}
+
+// splitDeletedNamespaces splits the configs in the deleted namespaces from the others.
+func splitDeletedNamespaces(cfgs []config.Config, deleted sets.Set) (kept []config.Config, removed []config.Config) {
+	if deleted.Empty() {
+		return cfgs, nil
+	}
+	kept = make([]config.Config, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if deleted.Contains(cfg.Namespace) {
+			removed = append(removed, cfg)
+		} else {
+			kept = append(kept, cfg)
+		}
+	}
+	return kept, removed
+}
+
+// fetchParameterConfigMaps fetches the ConfigMaps referenced by the parametersRef of GatewayClasses, and tracks them
+// so changes to these ConfigMaps recompute the GatewayClasses. See configMapEvent.
+func (c *Controller) fetchParameterConfigMaps(classes []config.Config) (map[types.NamespacedName]*corev1.ConfigMap, error) {
+	configMaps := map[types.NamespacedName]*corev1.ConfigMap{}
+	referenced := map[types.NamespacedName]struct{}{}
+	for _, obj := range classes {
+		key := parametersConfigMap(obj.Spec.(*k8s.GatewayClassSpec))
+		if key == nil {
+			continue
+		}
+		referenced[*key] = struct{}{}
+		cm, err := c.configMapLister.ConfigMaps(key.Namespace).Get(key.Name)
+		if err := controllers.IgnoreNotFound(err); err != nil {
+			return nil, fmt.Errorf("failed to get ConfigMap %s: %v", key, err)
+		}
+		if cm != nil {
+			configMaps[*key] = cm
+		}
+	}
+	c.stateMu.Lock()
+	c.referencedConfigMaps = referenced
+	c.stateMu.Unlock()
+	return configMaps, nil
+}
+
+// configMapEvent handles a ConfigMap add/update/delete. GatewayClasses read their parameters from ConfigMaps, so
+// we need to recompute when a referenced ConfigMap changes.
+func (c *Controller) configMapEvent(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
 	c.stateMu.RLock()
-	intersection := touchedNamespaceLabels.Intersection(c.state.ReferencedNamespaceKeys)
+	_, referenced := c.referencedConfigMaps[types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}]
 	c.stateMu.RUnlock()
+	if referenced && c.configMapHandler != nil {
+		log.Debugf("gateway class parameters %s/%s changed, triggering config map handler", cm.Namespace, cm.Name)
+		c.configMapHandler(config.Config{}, config.Config{}, model.EventUpdate)
+	}
+}
 
-	// If there was any overlap, then a relevant namespace label may have changed, and we trigger a
-	// push A more exact check could actually determine if the label selection result actually changed.
-	// However, this is a much simpler approach that is likely to scale well enough for now.
-	if !intersection.Empty() && c.namespaceHandler != nil {
-		log.Debugf("namespace labels changed, triggering namespace handler: %v", intersection.UnsortedList())
-		c.namespaceHandler(config.Config{}, config.Config{}, model.EventUpdate)
+// defaultRevisionChanged triggers a recompute when the default revision changes, as this changes the revision
+// handling the objects without a revision label.
+func (c *Controller) defaultRevisionChanged(revision string) {
+	if c.defaultRevisionHandler != nil {
+		log.Debugf("default revision changed to %q, triggering default revision handler", revision)
+		c.defaultRevisionHandler(config.Config{}, config.Config{}, model.EventUpdate)
 	}
 }
 
-// getLabelKeys extracts all label keys from a namespace object.
-func getLabelKeys(obj interface{}) []string {
+// toNamespace extracts the namespace from an informer object.
+func toNamespace(obj interface{}) *corev1.Namespace {
 	if obj == nil {
 		return nil
 	}
@@ -341,11 +694,7 @@ func getLabelKeys(obj interface{}) []string {
 			return nil
 		}
 	}
-	keys := make([]string, 0, len(ns.Labels))
-	for k := range ns.Labels {
-		keys = append(keys, k)
-	}
-	return keys
+	return ns
 }
 
 // deepCopyStatus creates a copy of all configs, with a copy of the status field that we can mutate.
@@ -379,6 +728,19 @@ func filterNamespace(cfgs []config.Config, namespace string) []config.Config {
 	return filtered
 }
 
+// revisionFilter returns the filter selecting the gateway-api objects handled by this control plane.
+func (c *Controller) revisionFilter() revisionFilter {
+	isDefault := false
+	if def := c.defaultWatcher.GetDefault(); def != "" {
+		isDefault = def == c.revision
+	} else {
+		// Without a default revision tag, the default revision is the one installed without a revision name,
+		// as is the case for sidecar injection.
+		isDefault = c.revision == "" || c.revision == "default"
+	}
+	return revisionFilter{revision: c.revision, isDefault: isDefault}
+}
+
 // anyApisUsed determines if there are any gateway-api resources created at all. If not, we can
 // short circuit all processing to avoid excessive work.
 func anyApisUsed(input *KubernetesResources) bool {
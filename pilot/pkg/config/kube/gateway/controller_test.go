@@ -15,16 +15,27 @@
 package gateway
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
+	"istio.io/api/label"
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/memory"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/model/kstatus"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pilot/pkg/status"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/schema/collections"
@@ -74,7 +85,8 @@ var (
 		Gateways: []string{
 			"ns1/gwspec-istio-autogenerated-k8s-gateway-default",
 		},
-		Http: []*networking.HTTPRoute{},
+		Http:     []*networking.HTTPRoute{},
+		ExportTo: []string{"ns1"},
 	}
 )
 
@@ -176,8 +188,697 @@ func TestListVirtualServiceResourceType(t *testing.T) {
 	g.Expect(cfg).To(HaveLen(1))
 	for _, c := range cfg {
 		g.Expect(c.GroupVersionKind).To(Equal(gvk.VirtualService))
-		g.Expect(c.Name).To(Equal("http-route-" + constants.KubernetesGatewayName))
+		g.Expect(c.Name).To(Equal(routeParentName("http-route", "ns1/gwspec-"+constants.KubernetesGatewayName+"-default")))
 		g.Expect(c.Namespace).To(Equal("ns1"))
 		g.Expect(c.Spec).To(Equal(expectedvs))
 	}
 }
+
+func TestReferencePolicyRecompute(t *testing.T) {
+	g := NewWithT(t)
+
+	clientSet := kube.NewFakeClient()
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(clientSet, store, controller.Options{})
+
+	backendNamespace := k8s.Namespace("backend")
+	port := k8s.PortNumber(80)
+	create := func(kind config.GroupVersionKind, name string, spec config.Spec) {
+		t.Helper()
+		if _, err := store.Create(config.Config{
+			Meta: config.Meta{GroupVersionKind: kind, Name: name, Namespace: "ns1"},
+			Spec: spec,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create(gvk.GatewayClass, "gwclass", gatewayClassSpec)
+	create(gvk.KubernetesGateway, "gwspec", gatewaySpec)
+	route := httpRouteSpec.DeepCopy()
+	route.Rules = []k8s.HTTPRouteRule{{
+		BackendRefs: []k8s.HTTPBackendRef{{BackendRef: k8s.BackendRef{BackendObjectReference: k8s.BackendObjectReference{
+			Name:      "svc",
+			Namespace: &backendNamespace,
+			Port:      &port,
+		}}}},
+	}}
+	create(gvk.HTTPRoute, "http-route", route)
+
+	routes := func() []*networking.HTTPRoute {
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		cfg, err := controller.List(gvk.VirtualService, "ns1")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cfg).To(HaveLen(1))
+		return cfg[0].Spec.(*networking.VirtualService).Http
+	}
+	// Without a ReferencePolicy, requests to the backend fail
+	http := routes()
+	g.Expect(http).To(HaveLen(1))
+	g.Expect(http[0].Fault.GetAbort().GetHttpStatus()).To(Equal(int32(500)))
+
+	if _, err := store.Create(config.Config{
+		Meta: config.Meta{GroupVersionKind: gvk.ReferencePolicy, Name: "allow", Namespace: string(backendNamespace)},
+		Spec: &k8s.ReferencePolicySpec{
+			From: []k8s.ReferencePolicyFrom{{Group: k8s.Group(gvk.HTTPRoute.Group), Kind: k8s.Kind(gvk.HTTPRoute.Kind), Namespace: "ns1"}},
+			To:   []k8s.ReferencePolicyTo{{Group: "", Kind: k8s.Kind(gvk.Service.Kind)}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	http = routes()
+	g.Expect(http).To(HaveLen(1))
+	g.Expect(http[0].Fault).To(BeNil())
+	g.Expect(http[0].Route).To(HaveLen(1))
+	g.Expect(http[0].Route[0].Destination.Host).To(HavePrefix("svc.backend.svc."))
+}
+
+func TestRecomputeDefersUntilNamespacesSynced(t *testing.T) {
+	g := NewWithT(t)
+
+	clientSet := kube.NewFakeClient(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns1",
+		Labels: map[string]string{"routes": "allowed"},
+	}})
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(clientSet, store, controller.Options{})
+	queue := &recordingStatusQueue{}
+	controller.status = queue
+	controller.SetStatusWrite(true)
+	handled := make(chan struct{}, 1)
+	controller.RegisterEventHandler(gvk.Namespace, func(config.Config, config.Config, model.Event) {
+		handled <- struct{}{}
+	})
+
+	gw := gatewaySpec.DeepCopy()
+	selector := k8s.NamespacesFromSelector
+	gw.Listeners[0].AllowedRoutes = &k8s.AllowedRoutes{Namespaces: &k8s.RouteNamespaces{
+		From:     &selector,
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"routes": "allowed"}},
+	}}
+	for _, cfg := range []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}, Spec: gatewayClassSpec},
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "gwspec", Namespace: "ns1"}, Spec: gw},
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "other", Namespace: "ns1"}, Spec: gatewaySpec},
+		{
+			Meta:   config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "route", Namespace: "ns1"},
+			Spec:   httpRouteSpec,
+			Status: &k8s.HTTPRouteStatus{},
+		},
+	} {
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// hosts returns the hosts of the generated Istio Gateways, by the name of the Gateway they are generated from
+	hosts := func() map[string][]string {
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		cfg, err := controller.List(gvk.Gateway, "ns1")
+		g.Expect(err).ToNot(HaveOccurred())
+		res := map[string][]string{}
+		for _, c := range cfg {
+			name := strings.SplitN(c.Name, "-", 2)[0]
+			res[name] = c.Spec.(*networking.Gateway).Servers[0].Hosts
+		}
+		return res
+	}
+
+	// Before the namespaces are synced, no match-nothing hosts are generated for the Gateway selecting namespaces,
+	// and the controller is not synced, so none of the output is served. The route is not reported as referencing a
+	// missing parent.
+	g.Expect(hosts()).ToNot(HaveKey("gwspec"))
+	g.Expect(controller.HasSynced()).To(BeFalse())
+	g.Expect(queue.pushed).To(BeEmpty())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	clientSet.RunAndWait(stop)
+	go controller.Run(stop)
+	select {
+	case <-handled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the deferred recompute to be triggered")
+	}
+	// Once synced, the Gateway selecting namespaces is served with the selected namespaces.
+	g.Expect(controller.HasSynced()).To(BeTrue())
+	g.Expect(hosts()).To(Equal(map[string][]string{"other": {"*/*"}, "gwspec": {"ns1/*"}}))
+	g.Expect(queue.pushed).To(HaveLen(1))
+	route := queue.status[0].(*k8s.HTTPRouteStatus)
+	g.Expect(kstatus.GetCondition(route.Parents[0].Conditions, string(k8s.ConditionRouteAccepted)).Status).
+		To(Equal(metav1.ConditionTrue))
+}
+
+// recordingStatusQueue records the status writes pushed by the controller, in order.
+type recordingStatusQueue struct {
+	pushed []status.Resource
+	status []status.ResourceStatus
+}
+
+func (q *recordingStatusQueue) Push(target status.Resource, progress status.ResourceStatus) {
+	q.pushed = append(q.pushed, target)
+	q.status = append(q.status, progress)
+}
+
+func (q *recordingStatusQueue) Run(context.Context) {}
+
+func (q *recordingStatusQueue) Delete(status.Resource) {}
+
+func TestGatewayChangeRouteStatusWrites(t *testing.T) {
+	g := NewWithT(t)
+
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(kube.NewFakeClient(), store, controller.Options{})
+	queue := &recordingStatusQueue{}
+	controller.status = queue
+	controller.SetStatusWrite(true)
+
+	gw := gatewaySpec.DeepCopy()
+	hostname := k8s.Hostname("*.a.example")
+	gw.Listeners[0].Hostname = &hostname
+	cfgs := []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}, Spec: gatewayClassSpec},
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "gwspec", Namespace: "ns1"}, Spec: gw},
+	}
+	for _, name := range []string{"a1", "a2", "b"} {
+		route := httpRouteSpec.DeepCopy()
+		route.Hostnames = []k8s.Hostname{k8s.Hostname(name + ".a.example")}
+		if name == "b" {
+			route.Hostnames = []k8s.Hostname{"b.example"}
+		}
+		cfgs = append(cfgs, config.Config{
+			Meta:   config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: name, Namespace: "ns1"},
+			Spec:   route,
+			Status: &k8s.HTTPRouteStatus{},
+		})
+	}
+	for _, cfg := range cfgs {
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// recompute returns the names of the routes whose status was written, and persists it as the status writer would.
+	recompute := func() []string {
+		queue.pushed, queue.status = nil, nil
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		var routes []string
+		for i, res := range queue.pushed {
+			cfg := store.Get(status.ResourceToModelConfig(res).GroupVersionKind, res.Name, res.Namespace)
+			g.Expect(cfg).ToNot(BeNil())
+			cfg.Status = queue.status[i].(config.Status)
+			if _, err := store.UpdateStatus(*cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.GroupVersionKind == gvk.HTTPRoute {
+				routes = append(routes, res.Name)
+			}
+		}
+		return routes
+	}
+	accepted := func(name string) metav1.ConditionStatus {
+		st := store.Get(gvk.HTTPRoute, name, "ns1").Status.(*k8s.HTTPRouteStatus)
+		return kstatus.GetCondition(st.Parents[0].Conditions, string(k8s.ConditionRouteAccepted)).Status
+	}
+
+	g.Expect(recompute()).To(ConsistOf("a1", "a2", "b"))
+	g.Expect(accepted("b")).To(Equal(metav1.ConditionFalse))
+	// Recomputing without any change writes nothing
+	g.Expect(recompute()).To(BeEmpty())
+
+	// Allowing the hostname of b only writes the status of b; the unchanged routes generate no writes.
+	gwCfg := store.Get(gvk.KubernetesGateway, "gwspec", "ns1")
+	hostname = "*.example"
+	gwCfg.Spec.(*k8s.GatewaySpec).Listeners[0].Hostname = &hostname
+	if _, err := store.Update(*gwCfg); err != nil {
+		t.Fatal(err)
+	}
+	g.Expect(recompute()).To(Equal([]string{"b"}))
+	g.Expect(accepted("b")).To(Equal(metav1.ConditionTrue))
+}
+
+func TestPrioritizeRouteStatus(t *testing.T) {
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(kube.NewFakeClient(), store, controller.Options{})
+	controller.status = &recordingStatusQueue{}
+	controller.SetStatusWrite(true)
+
+	parentStatus := func(accepted metav1.ConditionStatus, message string) *k8s.HTTPRouteStatus {
+		return &k8s.HTTPRouteStatus{RouteStatus: k8s.RouteStatus{Parents: []k8s.RouteParentStatus{{
+			ParentRef:      k8s.ParentRef{Name: "gwspec"},
+			ControllerName: ControllerName,
+			Conditions: []metav1.Condition{{
+				Type:    string(k8s.ConditionRouteAccepted),
+				Status:  accepted,
+				Message: message,
+			}},
+		}}}}
+	}
+	var routes []config.Config
+	for _, r := range []struct {
+		name     string
+		current  *k8s.HTTPRouteStatus
+		computed *k8s.HTTPRouteStatus
+	}{
+		{"unchanged", parentStatus(kstatus.StatusTrue, "valid"), parentStatus(kstatus.StatusTrue, "valid")},
+		{"message", parentStatus(kstatus.StatusTrue, "valid"), parentStatus(kstatus.StatusTrue, "valid, with warnings")},
+		{"flipped", parentStatus(kstatus.StatusTrue, "valid"), parentStatus(kstatus.StatusFalse, "invalid")},
+		{"new", &k8s.HTTPRouteStatus{}, parentStatus(kstatus.StatusTrue, "valid")},
+	} {
+		cfg := config.Config{
+			Meta:   config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: r.name, Namespace: "ns1"},
+			Spec:   httpRouteSpec,
+			Status: r.current,
+		}
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+		computed := r.computed
+		cfg.Status = kstatus.Wrap(cfg.Status)
+		cfg.Status.(*kstatus.WrappedStatus).Mutate(func(config.Status) config.Status { return computed })
+		routes = append(routes, cfg)
+	}
+	var got []string
+	for _, r := range controller.prioritizeRouteStatus(routes) {
+		got = append(got, r.Name)
+	}
+	if diff := cmp.Diff([]string{"flipped", "new", "unchanged", "message"}, got); diff != "" {
+		t.Fatalf("unexpected order:\n%s", diff)
+	}
+}
+
+func TestNamespaceEvent(t *testing.T) {
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels:      map[string]string{"routes": "allowed"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: metav1.LabelSelectorOpExists}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := func(labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: labels}}
+	}
+	cases := []struct {
+		name   string
+		old    *corev1.Namespace
+		new    *corev1.Namespace
+		pushed bool
+	}{
+		{"add selected", nil, ns(map[string]string{"routes": "allowed", "team": "a"}), true},
+		{"add unselected", nil, ns(map[string]string{"routes": "denied", "team": "a"}), false},
+		{"selected value change", ns(map[string]string{"routes": "allowed", "team": "a"}),
+			ns(map[string]string{"routes": "allowed", "team": "b"}), false},
+		{"unselected value change", ns(map[string]string{"routes": "denied", "team": "a"}),
+			ns(map[string]string{"routes": "other", "team": "a"}), false},
+		{"unrelated label", ns(map[string]string{"routes": "allowed", "team": "a"}),
+			ns(map[string]string{"routes": "allowed", "team": "a", "env": "prod"}), false},
+		{"selected", ns(map[string]string{"routes": "denied", "team": "a"}),
+			ns(map[string]string{"routes": "allowed", "team": "a"}), true},
+		{"unselected", ns(map[string]string{"routes": "allowed", "team": "a"}),
+			ns(map[string]string{"routes": "allowed"}), true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewController(kube.NewFakeClient(), memory.NewController(memory.Make(collections.All)), controller.Options{})
+			controller.state.ReferencedNamespaceSelectors = NamespaceSelectors{selector.String(): selector}
+			pushed := false
+			controller.RegisterEventHandler(gvk.Namespace, func(config.Config, config.Config, model.Event) {
+				pushed = true
+			})
+			var old interface{}
+			if tt.old != nil {
+				old = tt.old
+			}
+			controller.namespaceEvent(old, tt.new)
+			if pushed != tt.pushed {
+				t.Fatalf("expected pushed=%v, got %v", tt.pushed, pushed)
+			}
+		})
+	}
+}
+
+func TestNamespaceDeletion(t *testing.T) {
+	g := NewWithT(t)
+
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(kube.NewFakeClient(), store, controller.Options{})
+	queue := &recordingStatusQueue{}
+	controller.status = queue
+	controller.SetStatusWrite(true)
+	pushes := 0
+	controller.RegisterEventHandler(gvk.Namespace, func(config.Config, config.Config, model.Event) {
+		pushes++
+	})
+
+	gwNamespace := k8s.Namespace("ns1")
+	crossNamespaceRoute := httpRouteSpec.DeepCopy()
+	crossNamespaceRoute.ParentRefs[0].Namespace = &gwNamespace
+	for _, cfg := range []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}, Spec: gatewayClassSpec},
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "gwspec", Namespace: "ns1"}, Spec: gatewaySpec},
+		{Meta: config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "local", Namespace: "ns1"}, Spec: httpRouteSpec, Status: &k8s.HTTPRouteStatus{}},
+		{Meta: config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "remote", Namespace: "ns2"}, Spec: crossNamespaceRoute, Status: &k8s.HTTPRouteStatus{}},
+	} {
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recompute := func() {
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		for i, res := range queue.pushed {
+			cfg := store.Get(status.ResourceToModelConfig(res).GroupVersionKind, res.Name, res.Namespace)
+			if cfg == nil {
+				continue
+			}
+			cfg.Status = queue.status[i].(config.Status)
+			if _, err := store.UpdateStatus(*cfg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		queue.pushed, queue.status = nil, nil
+	}
+	generated := func(namespace string) int {
+		gws, err := controller.List(gvk.Gateway, namespace)
+		g.Expect(err).ToNot(HaveOccurred())
+		vss, err := controller.List(gvk.VirtualService, namespace)
+		g.Expect(err).ToNot(HaveOccurred())
+		return len(gws) + len(vss)
+	}
+	accepted := func() metav1.Condition {
+		st := store.Get(gvk.HTTPRoute, "remote", "ns2").Status.(*k8s.HTTPRouteStatus)
+		g.Expect(st.Parents).To(HaveLen(1))
+		return kstatus.GetCondition(st.Parents[0].Conditions, string(k8s.ConditionRouteAccepted))
+	}
+
+	recompute()
+	g.Expect(generated("ns1")).ToNot(BeZero())
+	g.Expect(accepted().Status).To(Equal(metav1.ConditionTrue))
+
+	// Once the namespace terminates, its generated config is dropped without waiting for the delete events of its objects
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}}
+	terminating := ns.DeepCopy()
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+	controller.namespaceEvent(ns, terminating)
+	g.Expect(pushes).To(Equal(1))
+	g.Expect(generated("ns1")).To(BeZero())
+
+	// Routes in other namespaces are no longer accepted by the deleted Gateway
+	recompute()
+	g.Expect(generated("ns1")).To(BeZero())
+	g.Expect(generated("ns2")).To(BeZero())
+	g.Expect(accepted().Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(accepted().Message).To(ContainSubstring("being deleted"))
+
+	// The final delete event of the namespace does not trigger another push
+	controller.namespaceDeleted("ns1")
+	g.Expect(pushes).To(Equal(1))
+
+	// The namespace is no longer tracked once its objects are deleted
+	for _, cfg := range []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "gwspec", Namespace: "ns1"}},
+		{Meta: config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "local", Namespace: "ns1"}},
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}},
+	} {
+		if err := store.Delete(cfg.GroupVersionKind, cfg.Name, cfg.Namespace, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recompute()
+	g.Expect(controller.deletedNamespaces.Empty()).To(BeTrue())
+}
+
+// BenchmarkNamespaceEvent measures namespace label churn which does not change the namespaces selected by Gateways.
+// Such updates used to trigger a reconversion whenever they touched a label key used by a selector.
+func BenchmarkNamespaceEvent(b *testing.B) {
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"routes": "allowed"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	controller := NewController(kube.NewFakeClient(), memory.NewController(memory.Make(collections.All)), controller.Options{})
+	controller.state.ReferencedNamespaceSelectors = NamespaceSelectors{selector.String(): selector}
+	reconversions := 0
+	controller.RegisterEventHandler(gvk.Namespace, func(config.Config, config.Config, model.Event) {
+		reconversions++
+	})
+	namespaces := make([]*corev1.Namespace, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		namespaces = append(namespaces, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("ns-%d", i),
+			Labels: map[string]string{"routes": fmt.Sprintf("value-%d", i)},
+		}})
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ns := namespaces[n%len(namespaces)]
+		updated := ns.DeepCopy()
+		updated.Labels["routes"] = fmt.Sprintf("value-%d", n)
+		controller.namespaceEvent(ns, updated)
+	}
+	b.ReportMetric(float64(reconversions)/float64(b.N), "reconversions/op")
+}
+
+func TestConversionEvents(t *testing.T) {
+	g := NewWithT(t)
+
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(kube.NewFakeClient(), store, controller.Options{})
+	controller.status = &recordingStatusQueue{}
+	controller.SetStatusWrite(true)
+	recorder := record.NewFakeRecorder(10)
+	controller.events.setRecorder(recorder)
+	now := time.Now()
+	controller.events.now = func() time.Time { return now }
+
+	gw := gatewaySpec.DeepCopy()
+	gw.Listeners[0].Protocol = k8s.HTTPSProtocolType
+	for _, cfg := range []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}, Spec: gatewayClassSpec},
+		{
+			Meta:   config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "gwspec", Namespace: "ns1"},
+			Spec:   gw,
+			Status: &k8s.GatewayStatus{},
+		},
+	} {
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recompute := func() []string {
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		var events []string
+		for {
+			select {
+			case ev := <-recorder.Events:
+				events = append(events, ev)
+			default:
+				return events
+			}
+		}
+	}
+
+	// The listener error is reported once, even though it is reported by several of its conditions
+	g.Expect(recompute()).To(Equal([]string{
+		`Warning AddressNotAssigned failed to assign to any requested addresses: hostname "gwspec.ns1.svc." not found`,
+		`Warning UnsupportedProtocol listener "default": protocol HTTPS requires tls`,
+	}))
+	// The status is not written, so it is still updated on the next recompute, but the events are not repeated
+	g.Expect(recompute()).To(BeEmpty())
+	now = now.Add(eventDedupInterval)
+	g.Expect(recompute()).To(HaveLen(2))
+
+	// Events are only emitted by the status writer
+	controller.SetStatusWrite(false)
+	now = now.Add(eventDedupInterval)
+	g.Expect(recompute()).To(BeEmpty())
+}
+
+func TestRevisions(t *testing.T) {
+	store := memory.NewController(memory.Make(collections.All))
+	create := func(kind config.GroupVersionKind, name string, rev string, spec config.Spec) {
+		t.Helper()
+		cfg := config.Config{
+			Meta: config.Meta{
+				GroupVersionKind: kind,
+				Name:             name,
+				Namespace:        "ns1",
+			},
+			Spec: spec,
+		}
+		if rev != "" {
+			cfg.Labels = map[string]string{label.IoIstioRev.Name: rev}
+		}
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	routeTo := func(gw string) *k8s.HTTPRouteSpec {
+		return &k8s.HTTPRouteSpec{
+			CommonRouteSpec: k8s.CommonRouteSpec{ParentRefs: []k8s.ParentRef{{Name: k8s.ObjectName(gw)}}},
+			Hostnames:       []k8s.Hostname{"test.cluster.local"},
+		}
+	}
+	create(gvk.GatewayClass, "gwclass", "", gatewayClassSpec)
+	create(gvk.KubernetesGateway, "unlabeled", "", gatewaySpec)
+	create(gvk.KubernetesGateway, "canary", "canary", gatewaySpec)
+	create(gvk.KubernetesGateway, "other", "other", gatewaySpec)
+	// Unlabeled routes inherit the revision of their Gateway
+	create(gvk.HTTPRoute, "to-unlabeled", "", routeTo("unlabeled"))
+	create(gvk.HTTPRoute, "to-canary", "", routeTo("canary"))
+	create(gvk.HTTPRoute, "to-other", "", routeTo("other"))
+	// Labeled routes are only handled by their revision, even if attached to a Gateway of another revision
+	create(gvk.HTTPRoute, "canary-to-unlabeled", "canary", routeTo("unlabeled"))
+
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	cases := []struct {
+		revision        string
+		gateways        []string
+		virtualServices []string
+	}{
+		{
+			revision:        "",
+			gateways:        []string{"unlabeled"},
+			virtualServices: []string{routeParentName("to-unlabeled", "ns1/unlabeled-"+constants.KubernetesGatewayName+"-default")},
+		},
+		{
+			revision:        "canary",
+			gateways:        []string{"canary"},
+			virtualServices: []string{routeParentName("to-canary", "ns1/canary-"+constants.KubernetesGatewayName+"-default")},
+		},
+	}
+	for _, tt := range cases {
+		t.Run("revision "+tt.revision, func(t *testing.T) {
+			g := NewWithT(t)
+			controller := NewController(kube.NewFakeClient(), store, controller.Options{Revision: tt.revision})
+			g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+
+			gws, err := controller.List(gvk.Gateway, "ns1")
+			g.Expect(err).ToNot(HaveOccurred())
+			gotGateways := []string{}
+			for _, gw := range gws {
+				gotGateways = append(gotGateways, gw.Name)
+			}
+			wantGateways := []string{}
+			for _, gw := range tt.gateways {
+				wantGateways = append(wantGateways, gw+"-"+constants.KubernetesGatewayName+"-default")
+			}
+			g.Expect(gotGateways).To(ConsistOf(wantGateways))
+
+			vss, err := controller.List(gvk.VirtualService, "ns1")
+			g.Expect(err).ToNot(HaveOccurred())
+			gotVirtualServices := []string{}
+			for _, vs := range vss {
+				gotVirtualServices = append(gotVirtualServices, vs.Name)
+			}
+			g.Expect(gotVirtualServices).To(ConsistOf(tt.virtualServices))
+		})
+	}
+}
+
+func TestRevisionsSharedRouteStatus(t *testing.T) {
+	g := NewWithT(t)
+	store := memory.NewController(memory.Make(collections.All))
+	cfgs := []config.Config{
+		{Meta: config.Meta{GroupVersionKind: gvk.GatewayClass, Name: "gwclass", Namespace: "ns1"}, Spec: gatewayClassSpec},
+		{Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: "unlabeled", Namespace: "ns1"}, Spec: gatewaySpec},
+		{
+			Meta: config.Meta{
+				GroupVersionKind: gvk.KubernetesGateway,
+				Name:             "canary",
+				Namespace:        "ns1",
+				Labels:           map[string]string{label.IoIstioRev.Name: "canary"},
+			},
+			Spec: gatewaySpec,
+		},
+		// An unlabeled route attached to Gateways of both revisions is handled by both
+		{
+			Meta: config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "shared", Namespace: "ns1"},
+			Spec: &k8s.HTTPRouteSpec{
+				CommonRouteSpec: k8s.CommonRouteSpec{ParentRefs: []k8s.ParentRef{{Name: "unlabeled"}, {Name: "canary"}}},
+				Hostnames:       []k8s.Hostname{"test.cluster.local"},
+			},
+			Status: &k8s.HTTPRouteStatus{},
+		},
+	}
+	for _, cfg := range cfgs {
+		if _, err := store.Create(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// recompute recomputes a revision, and returns the names of the routes whose status was written, persisting it
+	// as the status writer would.
+	recompute := func(revision string) []string {
+		controller := NewController(kube.NewFakeClient(), store, controller.Options{Revision: revision})
+		queue := &recordingStatusQueue{}
+		controller.status = queue
+		controller.SetStatusWrite(true)
+		cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+		g.Expect(controller.Recompute(model.NewGatewayContext(cg.PushContext()))).ToNot(HaveOccurred())
+		var routes []string
+		for i, res := range queue.pushed {
+			cfg := store.Get(status.ResourceToModelConfig(res).GroupVersionKind, res.Name, res.Namespace)
+			g.Expect(cfg).ToNot(BeNil())
+			cfg.Status = queue.status[i].(config.Status)
+			if _, err := store.UpdateStatus(*cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.GroupVersionKind == gvk.HTTPRoute {
+				routes = append(routes, res.Name)
+			}
+		}
+		return routes
+	}
+	accepted := func() map[string]metav1.ConditionStatus {
+		res := map[string]metav1.ConditionStatus{}
+		for _, p := range store.Get(gvk.HTTPRoute, "shared", "ns1").Status.(*k8s.HTTPRouteStatus).Parents {
+			res[string(p.ParentRef.Name)] = kstatus.GetCondition(p.Conditions, string(k8s.ConditionRouteAccepted)).Status
+		}
+		return res
+	}
+
+	g.Expect(recompute("")).To(Equal([]string{"shared"}))
+	g.Expect(accepted()).To(Equal(map[string]metav1.ConditionStatus{"unlabeled": metav1.ConditionTrue}))
+	// The canary revision adds its parent, keeping the status of the default revision
+	g.Expect(recompute("canary")).To(Equal([]string{"shared"}))
+	want := map[string]metav1.ConditionStatus{"unlabeled": metav1.ConditionTrue, "canary": metav1.ConditionTrue}
+	g.Expect(accepted()).To(Equal(want))
+	// The revisions do not overwrite each other
+	g.Expect(recompute("")).To(BeEmpty())
+	g.Expect(recompute("canary")).To(BeEmpty())
+	g.Expect(accepted()).To(Equal(want))
+}
+
+func TestDefaultRevisionChange(t *testing.T) {
+	store := memory.NewController(memory.Make(collections.All))
+	controller := NewController(kube.NewFakeClient(), store, controller.Options{Revision: "canary"})
+	handled := make(chan struct{}, 1)
+	controller.RegisterEventHandler(gvk.MutatingWebhookConfiguration, func(config.Config, config.Config, model.Event) {
+		handled <- struct{}{}
+	})
+	controller.defaultRevisionChanged("canary")
+	select {
+	case <-handled:
+	default:
+		t.Fatal("expected a default revision change to trigger the handler")
+	}
+}
+
+func TestRevisionFilterGatewayClassStatus(t *testing.T) {
+	classes := []config.Config{
+		{Meta: config.Meta{Name: "unlabeled"}},
+		{Meta: config.Meta{Name: "canary", Labels: map[string]string{label.IoIstioRev.Name: "canary"}}},
+	}
+	names := func(cfgs []config.Config) []string {
+		res := []string{}
+		for _, c := range cfgs {
+			res = append(res, c.Name)
+		}
+		return res
+	}
+	g := NewWithT(t)
+	g.Expect(names(revisionFilter{revision: "", isDefault: true}.filter(classes))).To(Equal([]string{"unlabeled"}))
+	g.Expect(names(revisionFilter{revision: "canary"}.filter(classes))).To(Equal([]string{"canary"}))
+	g.Expect(names(revisionFilter{revision: "canary", isDefault: true}.filter(classes))).To(Equal([]string{"unlabeled", "canary"}))
+}
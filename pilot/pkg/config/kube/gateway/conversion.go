@@ -15,20 +15,28 @@
 package gateway
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"hash/fnv"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	klabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	istio "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/model/credentials"
 	"istio.io/istio/pilot/pkg/model/kstatus"
+	"istio.io/istio/pilot/pkg/secrets"
+	"istio.io/istio/pilot/pkg/util/runtime"
 	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/constants"
@@ -39,6 +47,13 @@ import (
 const (
 	DefaultClassName = "istio"
 	ControllerName   = "istio.io/gateway-controller"
+	// SkipAnnotation, when set to "true" on a Gateway, causes it to be ignored even if its class is ours.
+	// This allows handing a Gateway over to another controller claiming the same class.
+	SkipAnnotation = "gateway.istio.io/skip"
+	// HTTPSRedirectOption, when set to "true" in the TLS options of an HTTPS listener, redirects plain text requests
+	// received by the HTTP listeners of the same Gateway for its hostname to it. HTTP listeners without a hostname,
+	// or with the same hostname, are paired. Routes attached to the HTTP listener take precedence over the redirect.
+	HTTPSRedirectOption = "gateway.istio.io/https-redirect"
 )
 
 // KubernetesResources stores all inputs to our conversion
@@ -49,23 +64,57 @@ type KubernetesResources struct {
 	TCPRoute        []config.Config
 	TLSRoute        []config.Config
 	ReferencePolicy []config.Config
+	// IstioGateway stores the Istio Gateways. Routes can attach to these, but no status is reported for them.
+	IstioGateway []config.Config
+	// DeletedGateways stores the Gateways in namespaces being deleted. No config is generated for them, and the
+	// routes attached to them are denied.
+	DeletedGateways []config.Config
+	// OtherRevisionGateways stores the Gateways handled by other control plane revisions. Routes shared with these
+	// do not report status for them, which is left to the revision owning the Gateway.
+	OtherRevisionGateways []config.Config
 	// Namespaces stores all namespace in the cluster, keyed by name
 	Namespaces map[string]*corev1.Namespace
+	// ConfigMaps stores the ConfigMaps referenced by the parametersRef of GatewayClasses
+	ConfigMaps map[types.NamespacedName]*corev1.ConfigMap
+	// PreviousVirtualServices stores the VirtualServices of the previous conversion. Routes updated with an invalid
+	// regular expression keep their previous VirtualServices.
+	PreviousVirtualServices []config.Config
 
 	// Domain for the cluster. Typically, cluster.local
 	Domain  string
 	Context model.GatewayContext
+	// Credentials reads the certificates referenced by listeners, to report certificate issues. If nil,
+	// certificates are not read.
+	Credentials secrets.Controller
 }
 
 // OutputResources stores all outputs of our conversion
 type OutputResources struct {
 	Gateway        []config.Config
 	VirtualService []config.Config
-	// AllowedReferences stores all allowed references, from Reference -> to Reference(s)
-	AllowedReferences map[Reference]map[Reference]struct{}
-	// ReferencedNamespaceKeys stores the label key of all namespace selections. This allows us to quickly
+	EnvoyFilter    []config.Config
+	// AllowedReferences stores all allowed references, from Reference -> to Reference(s) -> allowed names
+	AllowedReferences AllowedReferences
+	// ReferencedNamespaceSelectors stores the namespace selectors of all Gateway listeners. This allows us to
 	// determine if a namespace update could have impacted any Gateways. See namespaceEvent.
-	ReferencedNamespaceKeys sets.Set
+	ReferencedNamespaceSelectors NamespaceSelectors
+}
+
+// NamespaceSelectors stores compiled namespace selectors, keyed by their string representation.
+type NamespaceSelectors map[string]klabels.Selector
+
+// NamespaceAffected returns whether a namespace update changes the result of any of the selectors. A nil namespace
+// represents a namespace that does not exist, such as the old namespace of an add event.
+func (s NamespaceSelectors) NamespaceAffected(oldNs, newNs *corev1.Namespace) bool {
+	matches := func(ls klabels.Selector, ns *corev1.Namespace) bool {
+		return ns != nil && ls.Matches(toNamespaceSet(ns.Name, ns.Labels))
+	}
+	for _, ls := range s {
+		if matches(ls, oldNs) != matches(ls, newNs) {
+			return true
+		}
+	}
+	return false
 }
 
 // Reference stores a reference to a namespaced GVK, as used by ReferencePolicy
@@ -74,13 +123,40 @@ type Reference struct {
 	Namespace k8s.Namespace
 }
 
+// Grants stores the names of the objects a ReferencePolicy allows references to.
+type Grants struct {
+	// AllowAll is set if a policy did not restrict the name of the referent
+	AllowAll bool
+	// AllowedNames stores the referents explicitly named by policies
+	AllowedNames sets.Set
+}
+
+// AllowedReferences stores all allowed references, from Reference -> to Reference(s) -> allowed names
+type AllowedReferences map[Reference]map[Reference]*Grants
+
+// Allowed determines if an object of kind k, with the given name and namespace, may be referenced from a
+// Reference.
+func (refs AllowedReferences) Allowed(from Reference, k config.GroupVersionKind, name string, namespace string) bool {
+	grants, f := refs[from][Reference{Kind: k, Namespace: k8s.Namespace(namespace)}]
+	if !f {
+		return false
+	}
+	return grants.AllowAll || grants.AllowedNames.Contains(name)
+}
+
 // convertResources is the top level entrypoint to our conversion logic, computing the full state based
 // on KubernetesResources inputs.
 func convertResources(r *KubernetesResources) OutputResources {
+	start := time.Now()
+	stats := newConversionStats()
 	result := OutputResources{}
-	gw, gwMap, nsReferences := convertGateways(r)
+	// References are needed to validate the cross namespace references of Gateways
+	result.AllowedReferences = convertReferencePolicies(r)
+	gw, gwMap, nsReferences, envoyFilters := convertGateways(r, result.AllowedReferences)
 	result.Gateway = gw
-	result.VirtualService = convertVirtualService(r, gwMap)
+	result.EnvoyFilter = envoyFilters
+	result.VirtualService = convertVirtualService(r, gwMap, result.AllowedReferences, stats)
+	result.VirtualService = append(result.VirtualService, buildHTTPSRedirectVirtualServices(gwMap, result.VirtualService, r.Domain)...)
 
 	// Once we have gone through all route computation, we will know how many routes bound to each gateway.
 	// Report this in the status.
@@ -91,43 +167,69 @@ func convertResources(r *KubernetesResources) OutputResources {
 			}
 		}
 	}
-	result.AllowedReferences = convertReferencePolicies(r)
-	result.ReferencedNamespaceKeys = nsReferences
+	result.ReferencedNamespaceSelectors = nsReferences
+	stats.record(r, result, time.Since(start))
 	return result
 }
 
+// referenceFromKinds and referenceToKinds are the kinds ReferencePolicy can allow references from and to.
+var (
+	referenceFromKinds = []config.GroupVersionKind{gvk.KubernetesGateway, gvk.HTTPRoute, gvk.TCPRoute, gvk.TLSRoute}
+	referenceToKinds   = []config.GroupVersionKind{gvk.Secret, gvk.Service}
+)
+
+// referenceKind returns the kind matching the group and kind of a ReferencePolicy, if supported.
+func referenceKind(group k8s.Group, kind k8s.Kind, supported []config.GroupVersionKind) (config.GroupVersionKind, bool) {
+	for _, k := range supported {
+		if string(group) == k.Group && string(kind) == k.Kind {
+			return k, true
+		}
+	}
+	return config.GroupVersionKind{}, false
+}
+
 // convertReferencePolicies extracts all ReferencePolicy into an easily accessibly index.
 // The currently supported references are:
 // * Gateway -> Secret
-func convertReferencePolicies(r *KubernetesResources) map[Reference]map[Reference]struct{} {
-	// TODO support Name in ReferencePolicyTo
-	res := map[Reference]map[Reference]struct{}{}
+// * HTTPRoute, TCPRoute and TLSRoute -> Service
+func convertReferencePolicies(r *KubernetesResources) AllowedReferences {
+	res := AllowedReferences{}
 	for _, obj := range r.ReferencePolicy {
 		rp := obj.Spec.(*k8s.ReferencePolicySpec)
 		for _, from := range rp.From {
-			fromKey := Reference{
-				Namespace: from.Namespace,
-			}
-			if string(from.Group) == gvk.KubernetesGateway.Group && string(from.Kind) == gvk.KubernetesGateway.Kind {
-				fromKey.Kind = gvk.KubernetesGateway
-			} else {
+			fromKind, ok := referenceKind(from.Group, from.Kind, referenceFromKinds)
+			if !ok {
 				// Not supported type. Not an error; may be for another controller
 				continue
 			}
+			fromKey := Reference{
+				Kind:      fromKind,
+				Namespace: from.Namespace,
+			}
 			for _, to := range rp.To {
-				toKey := Reference{
-					Namespace: from.Namespace,
-				}
-				if to.Group == "" && string(to.Kind) == gvk.Secret.Kind {
-					toKey.Kind = gvk.Secret
-				} else {
+				toKind, ok := referenceKind(to.Group, to.Kind, referenceToKinds)
+				if !ok {
 					// Not supported type. Not an error; may be for another controller
 					continue
 				}
+				// The referents are in the namespace of the ReferencePolicy
+				toKey := Reference{
+					Kind:      toKind,
+					Namespace: k8s.Namespace(obj.Namespace),
+				}
 				if _, f := res[fromKey]; !f {
-					res[fromKey] = map[Reference]struct{}{}
+					res[fromKey] = map[Reference]*Grants{}
+				}
+				grants, f := res[fromKey][toKey]
+				if !f {
+					grants = &Grants{AllowedNames: sets.NewSet()}
+					res[fromKey][toKey] = grants
+				}
+				if to.Name == nil || *to.Name == "" {
+					grants.AllowAll = true
+				} else {
+					grants.AllowedNames.Insert(string(*to.Name))
 				}
-				res[fromKey][toKey] = struct{}{}
 			}
 		}
 	}
@@ -135,68 +237,106 @@ func convertReferencePolicies(r *KubernetesResources) map[Reference]map[Referenc
 }
 
 // convertVirtualService takes all xRoute types and generates corresponding VirtualServices.
-func convertVirtualService(r *KubernetesResources, gatewayMap map[parentKey]map[k8s.SectionName]*parentInfo) []config.Config {
+func convertVirtualService(r *KubernetesResources, gatewayMap map[parentKey]map[k8s.SectionName]*parentInfo,
+	references AllowedReferences, stats *conversionStats) []config.Config {
 	result := []config.Config{}
 	for _, obj := range r.TCPRoute {
-		if vsConfig := buildTCPVirtualService(obj, gatewayMap, r.Domain); vsConfig != nil {
-			result = append(result, *vsConfig)
-		}
+		convertSafely(obj, func() {
+			if vsConfig := buildTCPVirtualService(obj, gatewayMap, r.Domain, references, stats); vsConfig != nil {
+				result = append(result, *vsConfig)
+			}
+		})
 	}
 
 	for _, obj := range r.TLSRoute {
-		if vsConfig := buildTLSVirtualService(obj, gatewayMap, r.Domain); vsConfig != nil {
-			result = append(result, *vsConfig)
-		}
+		convertSafely(obj, func() {
+			if vsConfig := buildTLSVirtualService(obj, gatewayMap, r.Domain, references, stats); vsConfig != nil {
+				result = append(result, *vsConfig)
+			}
+		})
 	}
 
+	previous := map[string][]config.Config{}
+	for _, vs := range r.PreviousVirtualServices {
+		parent := vs.Annotations[constants.InternalParentName]
+		previous[parent] = append(previous[parent], vs)
+	}
 	for _, obj := range r.HTTPRoute {
-		if vsConfig := buildHTTPVirtualServices(obj, gatewayMap, r.Domain); vsConfig != nil {
-			result = append(result, *vsConfig)
-		}
+		convertSafely(obj, func() {
+			prev := previous[parentMeta(obj, nil)[constants.InternalParentName]]
+			result = append(result, buildHTTPVirtualServices(obj, gatewayMap, r.Domain, references, prev, stats)...)
+		})
 	}
 	return result
 }
 
-func buildHTTPVirtualServices(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string) *config.Config {
+// convertSafely runs the conversion of a single object. Objects are created by users, so a malformed object
+// that causes a panic is skipped and reported, rather than crashing istiod or blocking the conversion of all other
+// objects.
+func convertSafely(obj config.Config, convert func()) {
+	defer runtime.HandleCrash(runtime.LogPanic, func(interface{}) {
+		conversionPanics.With(kindTag.Value(obj.GroupVersionKind.Kind)).Increment()
+		log.Errorf("conversion of %v %s/%s caused a panic, skipping it", obj.GroupVersionKind.Kind, obj.Namespace, obj.Name)
+	})
+	convert()
+}
+
+// convertResourcesSafely runs convertResources, as a last resort guard against panics that are not attributed to
+// a single object. If it returns an error, the output is incomplete and must not be used.
+func convertResourcesSafely(r *KubernetesResources) (out OutputResources, err error) {
+	defer runtime.HandleCrash(runtime.LogPanic, func(p interface{}) {
+		conversionPanics.With(kindTag.Value("unknown")).Increment()
+		err = fmt.Errorf("conversion caused a panic: %v", p)
+	})
+	return convertResources(r), nil
+}
+
+// buildHTTPVirtualServices generates a VirtualService for each parent the HTTPRoute is bound to. Each VirtualService
+// has its hosts narrowed to the hostnames accepted by that specific parent, so that a restrictive listener on one
+// parent does not impact the others.
+// A route attached to both the mesh and a Gateway therefore programs sidecars through a dedicated VirtualService
+// bound to "mesh" only, with the unnarrowed route hostnames; the Gateway VirtualService never includes "mesh".
+// If a rule has an invalid regular expression, the previous VirtualServices of the route are kept, so an edit does
+// not break a route that was serving traffic.
+func buildHTTPVirtualServices(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string,
+	references AllowedReferences, previous []config.Config, stats *conversionStats) []config.Config {
 	route := obj.Spec.(*k8s.HTTPRouteSpec)
 
-	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, route.Hostnames, gvk.HTTPRoute, obj.Namespace)
+	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, route.Hostnames, gvk.HTTPRoute, obj.Namespace, stats)
+	from := Reference{Kind: gvk.HTTPRoute, Namespace: k8s.Namespace(obj.Namespace)}
 
+	// refErr stores the last backend dropped as the route is not permitted to reference it, or as it is invalid
+	var refErr *ConfigError
+	// warnings are reported in the status of a valid route
+	var warnings []string
 	reportError := func(routeErr *ConfigError) {
 		obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
 			rs := s.(*k8s.HTTPRouteStatus)
-			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr)
+			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr, refErr, warnings)
 			return rs
 		})
 	}
 
-	name := fmt.Sprintf("%s-%s", obj.Name, constants.KubernetesGatewayName)
-
-	httproutes := []*istio.HTTPRoute{}
-	hosts := hostnameToStringList(route.Hostnames)
-	for _, r := range route.Rules {
+	// buildRule converts a single rule. ignored lists the zero weight backends whose filters are not applied.
+	buildRule := func(r k8s.HTTPRouteRule) (vs *istio.HTTPRoute, ignored []string, err *ConfigError) {
 		// TODO: implement rewrite, timeout, mirror, corspolicy, retries
-		vs := &istio.HTTPRoute{}
+		vs = &istio.HTTPRoute{}
 		for _, match := range r.Matches {
 			uri, err := createURIMatch(match)
 			if err != nil {
-				reportError(err)
-				return nil
+				return nil, nil, err
 			}
 			headers, err := createHeadersMatch(match)
 			if err != nil {
-				reportError(err)
-				return nil
+				return nil, nil, err
 			}
 			qp, err := createQueryParamsMatch(match)
 			if err != nil {
-				reportError(err)
-				return nil
+				return nil, nil, err
 			}
 			method, err := createMethodMatch(match)
 			if err != nil {
-				reportError(err)
-				return nil
+				return nil, nil, err
 			}
 			vs.Match = append(vs.Match, &istio.HTTPMatchRequest{
 				Uri:         uri,
@@ -212,23 +352,36 @@ func buildHTTPVirtualServices(obj config.Config, gateways map[parentKey]map[k8s.
 			case k8s.HTTPRouteFilterRequestRedirect:
 				vs.Redirect = createRedirectFilter(filter.RequestRedirect)
 			case k8s.HTTPRouteFilterRequestMirror:
+				if filter.RequestMirror != nil {
+					if err := backendRefAllowed(references, from, filter.RequestMirror.BackendRef); err != nil {
+						// Requests are not mirrored, rather than rejecting the whole route
+						refErr = err
+						continue
+					}
+				}
 				mirror, err := createMirrorFilter(filter.RequestMirror, obj.Namespace, domain)
 				if err != nil {
-					reportError(err)
-					return nil
+					return nil, nil, err
 				}
 				vs.Mirror = mirror
 			default:
-				reportError(&ConfigError{
-					Reason:  InvalidFilter,
-					Message: fmt.Sprintf("unsupported filter type %q", filter.Type),
-				})
-				return nil
+				return nil, nil, unsupportedFilter(filter.Type)
+			}
+		}
+
+		backendRefs, denied := filterHTTPBackendRefs(r.BackendRefs, references, from)
+		allDenied := false
+		if denied != nil {
+			refErr = denied
+			if len(backendRefs) == 0 {
+				// The backends are kept for the route to be valid, but never receive any request
+				backendRefs = r.BackendRefs
+				allDenied = true
 			}
 		}
 
 		zero := true
-		for _, w := range r.BackendRefs {
+		for _, w := range backendRefs {
 			if w.Weight == nil || (w.Weight != nil && int(*w.Weight) != 0) {
 				zero = false
 				break
@@ -246,36 +399,349 @@ func buildHTTPVirtualServices(obj config.Config, gateways map[parentKey]map[k8s.
 			}}
 		}
 
-		route, err := buildHTTPDestination(r.BackendRefs, obj.Namespace, domain, zero)
+		if allDenied && vs.Redirect == nil {
+			// The spec requires us to 500 for requests to backends that are not permitted
+			vs.Fault = &istio.HTTPFaultInjection{Abort: &istio.HTTPFaultInjection_Abort{
+				Percentage: &istio.Percent{
+					Value: 100,
+				},
+				ErrorType: &istio.HTTPFaultInjection_Abort_HttpStatus{
+					HttpStatus: 500,
+				},
+			}}
+		}
+
+		route, ignored, invalid, err := buildHTTPDestination(backendRefs, obj.Namespace, domain, zero)
 		if err != nil {
-			reportError(err)
-			return nil
+			return nil, nil, err
+		}
+		if invalid != nil {
+			refErr = invalid.err
+			if len(route) == 0 {
+				// Envoy requires a cluster to route to; requests never reach it, as they are all aborted
+				route = []*istio.HTTPRouteDestination{{Destination: &istio.Destination{Host: invalidBackendHost(domain)}}}
+			}
+			if vs.Fault == nil && vs.Redirect == nil && invalid.percent > 0 {
+				// The spec requires us to 500 for requests that would have been sent to an invalid backend
+				vs.Fault = &istio.HTTPFaultInjection{Abort: &istio.HTTPFaultInjection_Abort{
+					Percentage: &istio.Percent{
+						Value: invalid.percent,
+					},
+					ErrorType: &istio.HTTPFaultInjection_Abort_HttpStatus{
+						HttpStatus: 500,
+					},
+				}}
+			}
 		}
 		vs.Route = route
+		return vs, ignored, nil
+	}
 
+	// ignoredFilters stores the zero weight backends of all rules whose filters are not applied
+	var ignoredFilters []string
+	// ruleErr stores the error of the first invalid rule. Invalid rules are skipped, so a single invalid rule does
+	// not break the other rules; the route is only rejected if no rule is valid.
+	var ruleErr *ConfigError
+	// regexErr stores the error of the first rule with an invalid regular expression
+	var regexErr *ConfigError
+	httproutes := []*istio.HTTPRoute{}
+	hosts := hostnameToStringList(route.Hostnames)
+	for i, r := range route.Rules {
+		vs, ignored, err := buildRule(r)
+		if err != nil {
+			if ruleErr == nil {
+				ruleErr = err
+			}
+			if err.Reason == UnsupportedValue && regexErr == nil {
+				regexErr = &ConfigError{Reason: err.Reason, Message: fmt.Sprintf("rule %d: %s", i, err.Message)}
+			}
+			warnings = append(warnings, fmt.Sprintf("ignoring invalid rule %d: %s", i, err.Message))
+			continue
+		}
+		ignoredFilters = append(ignoredFilters, ignored...)
 		httproutes = append(httproutes, vs)
 	}
+	if regexErr != nil && len(previous) > 0 {
+		// Keep serving the previous configuration until the expression is fixed
+		reportError(regexErr)
+		return previous
+	}
+	if len(httproutes) == 0 && ruleErr != nil {
+		reportError(ruleErr)
+		return nil
+	}
+	if len(ignoredFilters) > 0 {
+		warnings = append(warnings, fmt.Sprintf("filters of zero weight backends are not applied: [%s]", boundedJoin(ignoredFilters, " ")))
+	}
 	reportError(nil)
 	gatewayNames := referencesToInternalNames(parentRefs)
 	if len(gatewayNames) == 0 {
 		return nil
 	}
-	vsConfig := config.Config{
-		Meta: config.Meta{
-			CreationTimestamp: obj.CreationTimestamp,
-			GroupVersionKind:  gvk.VirtualService,
-			Name:              name,
-			Annotations:       parentMeta(obj, nil),
-			Namespace:         obj.Namespace,
-			Domain:            domain,
-		},
-		Spec: &istio.VirtualService{
-			Hosts:    hosts,
-			Gateways: gatewayNames,
-			Http:     httproutes,
-		},
+	parentHostnames := referencesToHostnames(parentRefs)
+	result := make([]config.Config, 0, len(gatewayNames))
+	for _, gw := range gatewayNames {
+		meta := parentMeta(obj, nil)
+		meta[constants.InternalRouteParent] = gw
+		vsHosts := hosts
+		if gw != constants.IstioMeshGateway {
+			vsHosts = intersectHostnames(hosts, parentHostnames[gw], obj.Namespace)
+		}
+		result = append(result, config.Config{
+			Meta: config.Meta{
+				CreationTimestamp: obj.CreationTimestamp,
+				GroupVersionKind:  gvk.VirtualService,
+				Name:              routeParentName(obj.Name, gw),
+				Annotations:       meta,
+				Namespace:         obj.Namespace,
+				Domain:            domain,
+			},
+			Spec: &istio.VirtualService{
+				Hosts:    vsHosts,
+				Gateways: []string{gw},
+				Http:     copyHTTPRoutes(httproutes),
+				ExportTo: referencesToExportTo(parentRefs, obj.Namespace, gw),
+			},
+		})
 	}
-	return &vsConfig
+	return result
+}
+
+// copyHTTPRoutes deep copies the routes, so the VirtualServices generated for each parent of a route do not share
+// them, and a change to one of them does not leak into the others.
+func copyHTTPRoutes(routes []*istio.HTTPRoute) []*istio.HTTPRoute {
+	res := make([]*istio.HTTPRoute, 0, len(routes))
+	for _, r := range routes {
+		res = append(res, r.DeepCopy())
+	}
+	return res
+}
+
+// maxResourceNameLength is the maximum length of the name of a Kubernetes resource.
+const maxResourceNameLength = 253
+
+// routeParentName builds a deterministic name for a VirtualService generated for a route bound to a specific parent.
+// Gateway parents are hashed, rather than appended directly, to keep the name length bounded.
+func routeParentName(routeName string, parent string) string {
+	if parent == constants.IstioMeshGateway {
+		return boundedName(routeName, fmt.Sprintf("-%s-%s", constants.IstioMeshGateway, constants.KubernetesGatewayName))
+	}
+	return boundedName(routeName, fmt.Sprintf("-%08x-%s", fnvHash(parent), constants.KubernetesGatewayName))
+}
+
+// boundedName builds the name of a generated resource from the name of its source object and a suffix. If the name
+// would exceed the maximum resource name length, the object name is truncated and a hash of the full name appended,
+// keeping it unique. The suffix is kept, unless it is too long itself.
+func boundedName(name string, suffix string) string {
+	full := name + suffix
+	if len(full) <= maxResourceNameLength {
+		return full
+	}
+	hash := fmt.Sprintf("-%08x", fnvHash(full))
+	if len(suffix)+len(hash) >= maxResourceNameLength {
+		return strings.TrimRight(full[:maxResourceNameLength-len(hash)], ".-") + hash
+	}
+	return strings.TrimRight(name[:maxResourceNameLength-len(suffix)-len(hash)], ".-") + hash + suffix
+}
+
+func fnvHash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// parentHostnameIndex indexes parent hostnames for matching against large numbers of route hostnames. Exact
+// hostnames are looked up directly and wildcards by suffix, so matching a non-wildcard route hostname does not scan
+// every parent hostname.
+type parentHostnameIndex struct {
+	hostnames []host.Name
+	exact     map[host.Name]struct{}
+	// wildcardSuffixes holds the suffix, without the leading "*", of the wildcard hostnames.
+	wildcardSuffixes map[string]struct{}
+	// suffixLengths holds the distinct lengths of wildcardSuffixes, so only suffixes of those lengths are looked up.
+	suffixLengths []int
+}
+
+// newParentHostnameIndex indexes the parent hostnames, in the ns/hostname format, allowing the namespace. An empty
+// namespace allows all parent hostnames.
+func newParentHostnameIndex(parentHostnames []string, namespace string) *parentHostnameIndex {
+	idx := &parentHostnameIndex{
+		exact:            map[host.Name]struct{}{},
+		wildcardSuffixes: map[string]struct{}{},
+	}
+	for _, parentHostNamespace := range parentHostnames {
+		spl := strings.SplitN(parentHostNamespace, "/", 2)
+		parentNamespace, parentHostname := spl[0], host.Name(spl[1])
+		if namespace != "" && parentNamespace != "*" && parentNamespace != namespace {
+			continue
+		}
+		idx.insert(parentHostname)
+	}
+	return idx
+}
+
+func (idx *parentHostnameIndex) insert(h host.Name) {
+	idx.hostnames = append(idx.hostnames, h)
+	if !h.IsWildCarded() {
+		idx.exact[h] = struct{}{}
+		return
+	}
+	suffix := string(h[1:])
+	if _, f := idx.wildcardSuffixes[suffix]; f {
+		return
+	}
+	idx.wildcardSuffixes[suffix] = struct{}{}
+	for _, l := range idx.suffixLengths {
+		if l == len(suffix) {
+			return
+		}
+	}
+	idx.suffixLengths = append(idx.suffixLengths, len(suffix))
+}
+
+// covers returns true if the non-wildcard hostname is a subset of one of the parent hostnames.
+func (idx *parentHostnameIndex) covers(h host.Name) bool {
+	if _, f := idx.exact[h]; f {
+		return true
+	}
+	for _, l := range idx.suffixLengths {
+		if l > len(h) {
+			continue
+		}
+		if _, f := idx.wildcardSuffixes[string(h[len(h)-l:])]; f {
+			return true
+		}
+	}
+	return false
+}
+
+// intersect calls fn with the hostnames matching both the route hostname and a parent hostname: the more specific
+// of the two for each matching pair. It stops once fn returns false.
+func (idx *parentHostnameIndex) intersect(routeHostname host.Name, fn func(h host.Name) bool) {
+	if !routeHostname.IsWildCarded() {
+		// A non-wildcard hostname can only be intersected to itself.
+		if idx.covers(routeHostname) {
+			fn(routeHostname)
+		}
+		return
+	}
+	for _, parentHostname := range idx.hostnames {
+		var h host.Name
+		if routeHostname.SubsetOf(parentHostname) {
+			h = routeHostname
+		} else if parentHostname.SubsetOf(routeHostname) {
+			h = parentHostname
+		} else {
+			continue
+		}
+		if !fn(h) {
+			return
+		}
+	}
+}
+
+// matches returns true if the route hostname matches one of the parent hostnames, in either direction.
+func (idx *parentHostnameIndex) matches(routeHostname host.Name) bool {
+	matched := false
+	idx.intersect(routeHostname, func(host.Name) bool {
+		matched = true
+		return false
+	})
+	return matched
+}
+
+// intersectHostnames narrows the route hostnames to the ones accepted by the parent hostnames. Parent hostnames
+// are in the ns/hostname format; only those allowing the route namespace are considered.
+// For each matching pair, the more specific of the two hostnames is kept. Hostnames covered by a wildcard that is
+// kept as well are dropped, as they would not match any additional requests.
+func intersectHostnames(routeHostnames []string, parentHostnames []string, namespace string) []string {
+	if len(parentHostnames) == 0 {
+		return routeHostnames
+	}
+	res := compressHostnames(matchHostnames(routeHostnames, newParentHostnameIndex(parentHostnames, namespace)))
+	if len(res) == 0 {
+		// Should not happen, as the parent would have been denied. Fallback to the route hostnames.
+		return routeHostnames
+	}
+	return res
+}
+
+// intersectParentsHostnames narrows the route hostnames to the ones accepted by any of the valid parent references.
+func intersectParentsHostnames(routeHostnames []string, parents []routeParentReference, namespace string) []string {
+	res := []string{}
+	seen := sets.NewSet()
+	for _, p := range parents {
+		if p.DeniedReason != nil {
+			continue
+		}
+		for _, h := range intersectHostnames(routeHostnames, p.Hostnames, namespace) {
+			if !seen.Contains(h) {
+				seen.Insert(h)
+				res = append(res, h)
+			}
+		}
+	}
+	if len(res) == 0 {
+		// No valid parents; the route is not programmed, so keep the route hostnames for reference
+		return routeHostnames
+	}
+	return compressHostnames(res)
+}
+
+// matchHostnames intersects each of the route hostnames with the parent hostnames, preserving the order of the
+// route hostnames and dropping duplicates.
+func matchHostnames(routeHostnames []string, parents *parentHostnameIndex) []string {
+	res := []string{}
+	seen := sets.NewSet()
+	for _, rh := range routeHostnames {
+		parents.intersect(host.Name(rh), func(h host.Name) bool {
+			if !seen.Contains(string(h)) {
+				seen.Insert(string(h))
+				res = append(res, string(h))
+			}
+			return true
+		})
+	}
+	return res
+}
+
+// compressHostnames drops the hostnames which are a subset of another of the hostnames, such as the subdomains of a
+// wildcard that is itself included. The order of the remaining hostnames is preserved.
+func compressHostnames(hostnames []string) []string {
+	var wildcards []host.Name
+	for _, h := range hostnames {
+		if host.Name(h).IsWildCarded() {
+			wildcards = append(wildcards, host.Name(h))
+		}
+	}
+	if len(wildcards) == 0 {
+		return hostnames
+	}
+	covering := newParentHostnameIndex(nil, "")
+	for _, w := range wildcards {
+		covering.insert(w)
+	}
+	res := make([]string, 0, len(hostnames))
+	for _, h := range hostnames {
+		hn := host.Name(h)
+		if !hn.IsWildCarded() {
+			if !covering.covers(hn) {
+				res = append(res, h)
+			}
+			continue
+		}
+		covered := false
+		for _, w := range wildcards {
+			if w != hn && hn.SubsetOf(w) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			res = append(res, h)
+		}
+	}
+	return res
 }
 
 func parentMeta(obj config.Config, sectionName *k8s.SectionName) map[string]string {
@@ -306,11 +772,14 @@ func toInternalParentReference(p k8s.ParentRef, localNamespace string) (parentKe
 	kind := defaultIfNil((*string)(p.Kind), gvk.KubernetesGateway.Kind)
 	var ik config.GroupVersionKind
 	var ns string
-	// Currently supported types are Gateway and Mesh
+	// Currently supported types are Gateway, Istio Gateway and Mesh
 	if kind == gvk.KubernetesGateway.Kind && grp == gvk.KubernetesGateway.Group {
 		// Unset namespace means "same namespace"
 		ns = defaultIfNil((*string)(p.Namespace), localNamespace)
 		ik = gvk.KubernetesGateway
+	} else if kind == gvk.Gateway.Kind && grp == gvk.Gateway.Group {
+		ns = defaultIfNil((*string)(p.Namespace), localNamespace)
+		ik = gvk.Gateway
 	} else if kind == meshGVK.Kind && grp == meshGVK.Group {
 		ik = meshGVK
 	} else {
@@ -323,7 +792,53 @@ func toInternalParentReference(p k8s.ParentRef, localNamespace string) (parentKe
 	}, nil
 }
 
+// Reasons a route is not allowed to attach to a parent. These are only used to label metrics; the status of the
+// route reports the message of the error.
+const (
+	deniedHostname  = "NoMatchingHostname"
+	deniedNamespace = "NamespaceNotAllowed"
+	deniedKind      = "KindNotAllowed"
+	deniedMesh      = "UnsupportedByMesh"
+	deniedListener  = "ListenerConflicted"
+	deniedSection   = "NoMatchingSection"
+	deniedDeleted   = "ParentDeleted"
+	deniedOther     = "Other"
+)
+
+var deniedReasons = []string{
+	deniedHostname, deniedNamespace, deniedKind, deniedMesh, deniedListener, deniedSection, deniedDeleted, deniedOther,
+}
+
+// parentError is the reason a route is not allowed to attach to a parent.
+type parentError struct {
+	reason  string
+	message string
+}
+
+func (e *parentError) Error() string {
+	return e.message
+}
+
+func parentErrorf(reason string, format string, args ...interface{}) error {
+	return &parentError{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// errOtherRevision is the DeniedReason of references to the Gateways of other control plane revisions. These are not
+// bound, nor reported in the route status, by this revision.
+var errOtherRevision = parentErrorf("OtherRevision", "parent is handled by another control plane revision")
+
+// deniedReason returns the reason of the error preventing a route from attaching to a parent.
+func deniedReason(err error) string {
+	if pe, ok := err.(*parentError); ok {
+		return pe.reason
+	}
+	return deniedOther
+}
+
 func referenceAllowed(p *parentInfo, routeKind config.GroupVersionKind, parentKind config.GroupVersionKind, hostnames []k8s.Hostname, namespace string) error {
+	if p.DeniedReason != nil {
+		return p.DeniedReason
+	}
 	// First check the hostnames are a match. This is a bi-directional wildcard match. Only one route
 	// hostname must match for it to be allowed (but the others will be filtered at runtime)
 	// If either is empty its treated as a wildcard which always matches
@@ -332,48 +847,56 @@ func referenceAllowed(p *parentInfo, routeKind config.GroupVersionKind, parentKi
 		hostnames = []k8s.Hostname{"*"}
 	}
 	if len(p.Hostnames) > 0 {
-		// TODO: the spec actually has a label match, not a string match. That is, *.com does not match *.apple.com
-		// We are doing a string match here
+		// Gateway API wildcards are a whole first label, so the suffix match of host.Name is a label match: *.com
+		// matches foo.apple.com and *.apple.com, but *.example.com does not match example.com.
+		allowed := newParentHostnameIndex(p.Hostnames, namespace)
 		matched := false
-		hostMatched := false
 		for _, routeHostname := range hostnames {
-			for _, parentHostNamespace := range p.Hostnames {
-				spl := strings.Split(parentHostNamespace, "/")
-				parentNamespace, parentHostname := spl[0], spl[1]
-				hostnameMatch := host.Name(parentHostname).Matches(host.Name(routeHostname))
-				namespaceMatch := parentNamespace == "*" || parentNamespace == namespace
-				hostMatched = hostMatched || hostnameMatch
-				if hostnameMatch && namespaceMatch {
-					matched = true
-					break
-				}
+			if allowed.matches(host.Name(routeHostname)) {
+				matched = true
+				break
 			}
 		}
 		if !matched {
+			// Only determine whether the namespace is the reason for the mismatch when reporting the error.
+			all := newParentHostnameIndex(p.Hostnames, "")
+			hostMatched := false
+			for _, routeHostname := range hostnames {
+				if all.matches(host.Name(routeHostname)) {
+					hostMatched = true
+					break
+				}
+			}
 			if hostMatched {
-				return fmt.Errorf("hostnames matched parent hostname %q, but namespace %q is not allowed by the parent", p.OriginalHostname, namespace)
+				return parentErrorf(deniedNamespace, "hostnames matched parent hostname %q, but namespace %q is not allowed by the parent",
+					p.OriginalHostname, namespace)
 			}
-			return fmt.Errorf("no hostnames matched parent hostname %q", p.OriginalHostname)
+			return parentErrorf(deniedHostname, "no hostnames matched parent hostname %q", p.OriginalHostname)
 		}
 	}
-	// Also make sure this route kind is allowed
-	if len(p.AllowedKinds) > 0 {
+	// Also make sure this route kind is allowed. An empty list means the listener does not support any
+	// of the kinds it allows, while nil means the parent does not restrict kinds.
+	if p.AllowedKinds != nil {
 		matched := false
 		for _, ak := range p.AllowedKinds {
-			if string(ak.Kind) == routeKind.Kind && defaultIfNil((*string)(ak.Group), gvk.GatewayClass.Group) == routeKind.Group {
+			if string(ak.Kind) == routeKind.Kind && routeGroup(ak.Group) == routeKind.Group {
 				matched = true
 				break
 			}
 		}
 		if !matched {
-			return fmt.Errorf("kind %v is not allowed", routeKind)
+			return parentErrorf(deniedKind, "kind %v is not allowed", routeKind)
 		}
 	}
 
 	if parentKind == meshGVK {
+		if routeKind != gvk.HTTPRoute {
+			// TCP and TLS routes are only supported by Gateways; the mesh relies on hostnames to select traffic.
+			return parentErrorf(deniedMesh, "kind %v is not supported for mesh", routeKind.Kind)
+		}
 		for _, h := range hostnames {
 			if h == "*" {
-				return fmt.Errorf("mesh requires hostname to be set")
+				return parentErrorf(deniedMesh, "mesh requires hostname to be set")
 			}
 		}
 	}
@@ -381,7 +904,7 @@ func referenceAllowed(p *parentInfo, routeKind config.GroupVersionKind, parentKi
 }
 
 func extractParentReferenceInfo(gateways map[parentKey]map[k8s.SectionName]*parentInfo, routeRefs []k8s.ParentRef,
-	hostnames []k8s.Hostname, kind config.GroupVersionKind, localNamespace string) []routeParentReference {
+	hostnames []k8s.Hostname, kind config.GroupVersionKind, localNamespace string, stats *conversionStats) []routeParentReference {
 	parentRefs := []routeParentReference{}
 	for _, ref := range routeRefs {
 		ir, err := toInternalParentReference(ref, localNamespace)
@@ -392,39 +915,91 @@ func extractParentReferenceInfo(gateways map[parentKey]map[k8s.SectionName]*pare
 		appendParent := func(pr *parentInfo, pk parentKey) {
 			rpi := routeParentReference{
 				InternalName:      pr.InternalName,
+				Hostnames:         pr.Hostnames,
+				Namespaces:        pr.Namespaces,
 				DeniedReason:      referenceAllowed(pr, kind, pk.Kind, hostnames, localNamespace),
 				OriginalReference: ref,
 			}
 			if rpi.DeniedReason == nil {
 				// Record that we were able to bind to the parent
 				pr.AttachedRoutes++
+			} else {
+				stats.denied(kind, rpi.DeniedReason)
 			}
 			parentRefs = append(parentRefs, rpi)
 		}
-		if ref.SectionName != nil {
-			// We are selecting a specific section, so attach just that section
-			if pr, f := gateways[ir][*ref.SectionName]; f {
-				appendParent(pr, ir)
-			}
-		} else {
-			// no section name set, match all sections
-			for _, pr := range gateways[ir] {
-				appendParent(pr, ir)
-			}
+		sections, gatewayFound := gateways[ir]
+		if !gatewayFound {
+			continue
+		}
+		if pr, f := sections[""]; f && pr.DeniedReason == errOtherRevision {
+			parentRefs = append(parentRefs, routeParentReference{
+				DeniedReason:      errOtherRevision,
+				OriginalReference: ref,
+			})
+			continue
+		}
+		selected, err := selectParentSections(sections, ref.SectionName)
+		if err != nil {
+			// The parent exists, but the section does not. Report this rather than dropping the reference
+			// entirely, so that typos in the section name are surfaced in the route status.
+			parentRefs = append(parentRefs, routeParentReference{
+				DeniedReason:      err,
+				OriginalReference: ref,
+			})
+			stats.denied(kind, err)
+			continue
+		}
+		for _, name := range selected {
+			appendParent(sections[name], ir)
 		}
 	}
 	return parentRefs
 }
 
-func buildTCPVirtualService(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string) *config.Config {
+// selectParentSections returns the sections of a parent a reference selects: the section with the name if set, and
+// otherwise all the sections. Sections are returned in a stable order, so the generated config does not change
+// between conversions.
+func selectParentSections(sections map[k8s.SectionName]*parentInfo, sectionName *k8s.SectionName) ([]k8s.SectionName, error) {
+	if sectionName != nil {
+		if _, f := sections[*sectionName]; !f {
+			return nil, parentErrorf(deniedSection, "sectionName %q not found; available sections: [%s]", *sectionName,
+				boundedJoin(sectionNames(sections), " "))
+		}
+		return []k8s.SectionName{*sectionName}, nil
+	}
+	selected := []k8s.SectionName{}
+	for _, name := range sectionNames(sections) {
+		selected = append(selected, k8s.SectionName(name))
+	}
+	return selected, nil
+}
+
+// sectionNames returns the sorted names of all sections of a parent
+func sectionNames(sections map[k8s.SectionName]*parentInfo) []string {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func buildTCPVirtualService(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string,
+	references AllowedReferences, stats *conversionStats) *config.Config {
 	route := obj.Spec.(*k8s.TCPRouteSpec)
 
-	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, nil, gvk.TCPRoute, obj.Namespace)
+	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, nil, gvk.TCPRoute, obj.Namespace, stats)
+	from := Reference{Kind: gvk.TCPRoute, Namespace: k8s.Namespace(obj.Namespace)}
 
+	// refErr stores the last backend dropped as the route is not permitted to reference it
+	var refErr *ConfigError
+	// warnings are reported in the status of a valid route
+	var warnings []string
 	reportError := func(routeErr *ConfigError) {
 		obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
 			rs := s.(*k8s.TCPRouteStatus)
-			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr)
+			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr, refErr, warnings)
 			return rs
 		})
 	}
@@ -434,12 +1009,26 @@ func buildTCPVirtualService(obj config.Config, gateways map[parentKey]map[k8s.Se
 		return nil
 	}
 
+	// ruleErr stores the error of the first invalid rule. Invalid rules are skipped; the route is only rejected if no
+	// rule is valid.
+	var ruleErr *ConfigError
 	routes := []*istio.TCPRoute{}
-	for _, r := range route.Rules {
-		route, err := buildTCPDestination(r.BackendRefs, obj.Namespace, domain)
+	for i, r := range route.Rules {
+		backendRefs, denied := filterBackendRefs(r.BackendRefs, references, from)
+		if denied != nil {
+			refErr = denied
+			if len(backendRefs) == 0 {
+				// All backends are denied, so connections are not routed
+				continue
+			}
+		}
+		route, err := buildTCPDestination(backendRefs, obj.Namespace, domain)
 		if err != nil {
-			reportError(err)
-			return nil
+			if ruleErr == nil {
+				ruleErr = err
+			}
+			warnings = append(warnings, fmt.Sprintf("ignoring invalid rule %d: %s", i, err.Message))
+			continue
 		}
 		ir := &istio.TCPRoute{
 			Route: route,
@@ -447,12 +1036,19 @@ func buildTCPVirtualService(obj config.Config, gateways map[parentKey]map[k8s.Se
 		routes = append(routes, ir)
 	}
 
+	if len(routes) == 0 && ruleErr != nil {
+		reportError(ruleErr)
+		return nil
+	}
 	reportError(nil)
+	if len(routes) == 0 {
+		return nil
+	}
 	vsConfig := config.Config{
 		Meta: config.Meta{
 			CreationTimestamp: obj.CreationTimestamp,
 			GroupVersionKind:  gvk.VirtualService,
-			Name:              fmt.Sprintf("%s-tcp-%s", obj.Name, constants.KubernetesGatewayName),
+			Name:              boundedName(obj.Name, "-tcp-"+constants.KubernetesGatewayName),
 			Annotations:       parentMeta(obj, nil),
 			Namespace:         obj.Namespace,
 			Domain:            domain,
@@ -463,60 +1059,92 @@ func buildTCPVirtualService(obj config.Config, gateways map[parentKey]map[k8s.Se
 			Hosts:    []string{"*"},
 			Gateways: gatewayNames,
 			Tcp:      routes,
+			ExportTo: referencesToExportTo(parentRefs, obj.Namespace, ""),
 		},
 	}
 	return &vsConfig
 }
 
-func buildTLSVirtualService(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string) *config.Config {
+func buildTLSVirtualService(obj config.Config, gateways map[parentKey]map[k8s.SectionName]*parentInfo, domain string,
+	references AllowedReferences, stats *conversionStats) *config.Config {
 	route := obj.Spec.(*k8s.TLSRouteSpec)
 
-	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, nil, gvk.TLSRoute, obj.Namespace)
+	parentRefs := extractParentReferenceInfo(gateways, route.ParentRefs, route.Hostnames, gvk.TLSRoute, obj.Namespace, stats)
+	from := Reference{Kind: gvk.TLSRoute, Namespace: k8s.Namespace(obj.Namespace)}
+	// A single VirtualService is generated for all parents, so it matches the hostnames allowed by any of them
+	hosts := intersectParentsHostnames(hostnamesToStringListWithWildcard(route.Hostnames), parentRefs, obj.Namespace)
 
+	// refErr stores the last backend dropped as the route is not permitted to reference it
+	var refErr *ConfigError
+	// warnings are reported in the status of a valid route
+	var warnings []string
 	reportError := func(routeErr *ConfigError) {
 		obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
 			rs := s.(*k8s.TLSRouteStatus)
-			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr)
+			rs.Parents = createRouteStatus(parentRefs, obj, rs.Parents, routeErr, refErr, warnings)
 			return rs
 		})
 	}
 
+	// ruleErr stores the error of the first invalid rule. Invalid rules are skipped; the route is only rejected if no
+	// rule is valid.
+	var ruleErr *ConfigError
 	routes := []*istio.TLSRoute{}
-	for _, r := range route.Rules {
-		dest, err := buildTCPDestination(r.BackendRefs, obj.Namespace, domain)
+	for i, r := range route.Rules {
+		backendRefs, denied := filterBackendRefs(r.BackendRefs, references, from)
+		if denied != nil {
+			refErr = denied
+			if len(backendRefs) == 0 {
+				// All backends are denied, so connections are not routed
+				continue
+			}
+		}
+		dest, err := buildTCPDestination(backendRefs, obj.Namespace, domain)
 		if err != nil {
-			reportError(err)
-			return nil
+			if ruleErr == nil {
+				ruleErr = err
+			}
+			warnings = append(warnings, fmt.Sprintf("ignoring invalid rule %d: %s", i, err.Message))
+			continue
 		}
 		if len(dest) == 0 {
-			return nil
+			// A rule without backends does not route any connection
+			continue
 		}
 		ir := &istio.TLSRoute{
-			Match: buildTLSMatch(route.Hostnames),
+			Match: buildTLSMatch(hosts),
 			Route: dest,
 		}
 		routes = append(routes, ir)
 	}
 
+	if len(routes) == 0 && ruleErr != nil {
+		reportError(ruleErr)
+		return nil
+	}
 	reportError(nil)
 	gatewayNames := referencesToInternalNames(parentRefs)
 	if len(gatewayNames) == 0 {
 		// TODO we need to properly return not admitted here
 		return nil
 	}
+	if len(routes) == 0 {
+		return nil
+	}
 	vsConfig := config.Config{
 		Meta: config.Meta{
 			CreationTimestamp: obj.CreationTimestamp,
 			GroupVersionKind:  gvk.VirtualService,
-			Name:              fmt.Sprintf("%s-tls-%s", obj.Name, constants.KubernetesGatewayName),
+			Name:              boundedName(obj.Name, "-tls-"+constants.KubernetesGatewayName),
 			Annotations:       parentMeta(obj, nil),
 			Namespace:         obj.Namespace,
 			Domain:            domain,
 		},
 		Spec: &istio.VirtualService{
-			Hosts:    hostnamesToStringListWithWildcard(route.Hostnames),
+			Hosts:    hosts,
 			Gateways: gatewayNames,
 			Tls:      routes,
+			ExportTo: referencesToExportTo(parentRefs, obj.Namespace, ""),
 		},
 	}
 	return &vsConfig
@@ -555,10 +1183,10 @@ func buildTCPDestination(forwardTo []k8s.BackendRef, ns, domain string) ([]*isti
 	return res, nil
 }
 
-func buildTLSMatch(hostnames []k8s.Hostname) []*istio.TLSMatchAttributes {
+func buildTLSMatch(hostnames []string) []*istio.TLSMatchAttributes {
 	// Currently, the spec only supports extensions beyond hostname, which are not currently implemented by Istio.
 	return []*istio.TLSMatchAttributes{{
-		SniHosts: hostnamesToStringListWithWildcard(hostnames),
+		SniHosts: hostnames,
 	}}
 }
 
@@ -581,9 +1209,27 @@ func intSum(n []int) int {
 	return r
 }
 
-func buildHTTPDestination(forwardTo []k8s.HTTPBackendRef, ns string, domain string, totalZero bool) ([]*istio.HTTPRouteDestination, *ConfigError) {
+// invalidBackendHost returns the host routed to by rules without any valid backend.
+func invalidBackendHost(domain string) string {
+	return "invalid-backend." + domain
+}
+
+// invalidBackends describes the backends of a rule that could not be converted.
+type invalidBackends struct {
+	// percent is the share of the requests that would have been sent to the invalid backends
+	percent float64
+	// err reports the last invalid backend
+	err *ConfigError
+}
+
+// buildHTTPDestination converts the backends of a rule. Zero weight backends are not routed to, unless all backends
+// have a zero weight; ignoredFilters lists the zero weight backends left out whose filters are not applied.
+// Invalid backends are left out as well, and reported in invalid; the weights of the remaining backends keep their
+// proportions.
+func buildHTTPDestination(forwardTo []k8s.HTTPBackendRef, ns string, domain string,
+	totalZero bool) (res []*istio.HTTPRouteDestination, ignoredFilters []string, invalid *invalidBackends, err *ConfigError) {
 	if forwardTo == nil {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 
 	weights := []int{}
@@ -596,33 +1242,114 @@ func buildHTTPDestination(forwardTo []k8s.HTTPBackendRef, ns string, domain stri
 		// When total weight is zero, create destination to add falutInjection.
 		// When total weight is not zero, do not create the destination.
 		if wt == 0 && !totalZero {
+			if len(w.Filters) > 0 {
+				// The filters are still validated, so raising the weight later does not make the route invalid
+				if _, err := buildBackendHeaders(w.Filters); err != nil {
+					return nil, nil, nil, err
+				}
+				ignoredFilters = append(ignoredFilters, backendRefString(w.BackendObjectReference))
+			}
 			continue
 		}
 		action = append(action, forwardTo[i])
 		weights = append(weights, wt)
 	}
-	weights = standardizeWeights(weights)
-	res := []*istio.HTTPRouteDestination{}
+	res = []*istio.HTTPRouteDestination{}
+	validWeights := []int{}
+	invalidWeight := 0
 	for i, fwd := range action {
+		headers, err := buildBackendHeaders(fwd.Filters)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		dst, err := buildDestination(fwd.BackendRef, ns, domain)
 		if err != nil {
-			return nil, err
+			invalid = &invalidBackends{err: err}
+			invalidWeight += weights[i]
+			continue
 		}
-		rd := &istio.HTTPRouteDestination{
+		res = append(res, &istio.HTTPRouteDestination{
 			Destination: dst,
-			Weight:      int32(weights[i]),
+			Headers:     headers,
+		})
+		validWeights = append(validWeights, weights[i])
+	}
+	for i, w := range standardizeWeights(validWeights) {
+		res[i].Weight = int32(w)
+	}
+	if invalid != nil && invalidWeight > 0 {
+		invalid.percent = float64(invalidWeight) * 100 / float64(invalidWeight+intSum(validWeights))
+	}
+	return res, ignoredFilters, invalid, nil
+}
+
+// buildBackendHeaders converts the filters of a backend. Only modifying the request headers is supported.
+func buildBackendHeaders(filters []k8s.HTTPRouteFilter) (*istio.Headers, *ConfigError) {
+	var headers *istio.Headers
+	for _, filter := range filters {
+		switch filter.Type {
+		case k8s.HTTPRouteFilterRequestHeaderModifier:
+			headers = createHeadersFilter(filter.RequestHeaderModifier)
+		default:
+			return nil, unsupportedFilter(filter.Type)
 		}
-		for _, filter := range fwd.Filters {
-			switch filter.Type {
-			case k8s.HTTPRouteFilterRequestHeaderModifier:
-				rd.Headers = createHeadersFilter(filter.RequestHeaderModifier)
-			default:
-				return nil, &ConfigError{Reason: InvalidFilter, Message: fmt.Sprintf("unsupported filter type %q", filter.Type)}
-			}
+	}
+	return headers, nil
+}
+
+// filterHTTPBackendRefs drops the backends the route is not permitted to reference. The last backend dropped is
+// reported as an error.
+func filterHTTPBackendRefs(refs []k8s.HTTPBackendRef, references AllowedReferences, from Reference) ([]k8s.HTTPBackendRef, *ConfigError) {
+	if len(refs) == 0 {
+		return refs, nil
+	}
+	var denied *ConfigError
+	res := make([]k8s.HTTPBackendRef, 0, len(refs))
+	for _, ref := range refs {
+		if err := backendRefAllowed(references, from, ref.BackendObjectReference); err != nil {
+			denied = err
+			continue
 		}
-		res = append(res, rd)
+		res = append(res, ref)
+	}
+	return res, denied
+}
+
+// filterBackendRefs drops the backends the route is not permitted to reference. The last backend dropped is reported
+// as an error.
+func filterBackendRefs(refs []k8s.BackendRef, references AllowedReferences, from Reference) ([]k8s.BackendRef, *ConfigError) {
+	if len(refs) == 0 {
+		return refs, nil
+	}
+	var denied *ConfigError
+	res := make([]k8s.BackendRef, 0, len(refs))
+	for _, ref := range refs {
+		if err := backendRefAllowed(references, from, ref.BackendObjectReference); err != nil {
+			denied = err
+			continue
+		}
+		res = append(res, ref)
+	}
+	return res, denied
+}
+
+// backendRefAllowed returns an error if the backend is a Service in another namespace than the route, and no
+// ReferencePolicy allows the route to reference it.
+func backendRefAllowed(references AllowedReferences, from Reference, to k8s.BackendObjectReference) *ConfigError {
+	if to.Namespace == nil || *to.Namespace == from.Namespace {
+		return nil
+	}
+	if !nilOrEqual((*string)(to.Group), "") || !nilOrEqual((*string)(to.Kind), gvk.Service.Kind) {
+		// Other kinds cannot be in another namespace, which is reported when building the destination
+		return nil
+	}
+	if references.Allowed(from, gvk.Service, string(to.Name), string(*to.Namespace)) {
+		return nil
+	}
+	return &ConfigError{
+		Reason:  RefNotPermitted,
+		Message: fmt.Sprintf("backendRef %s/%s is not permitted by any ReferencePolicy", *to.Namespace, to.Name),
 	}
-	return res, nil
 }
 
 func buildDestination(to k8s.BackendRef, ns, domain string) (*istio.Destination, *ConfigError) {
@@ -637,7 +1364,6 @@ func buildDestination(to k8s.BackendRef, ns, domain string) (*istio.Destination,
 			return nil, &ConfigError{Reason: InvalidDestination, Message: "serviceName invalid; the name of the Service must be used, not the hostname."}
 		}
 		return &istio.Destination{
-			// TODO: implement ReferencePolicy for cross namespace
 			Host: fmt.Sprintf("%s.%s.svc.%s", to.Name, namespace, domain),
 			Port: &istio.PortSelector{Number: uint32(*to.Port)},
 		}, nil
@@ -771,6 +1497,22 @@ func createRedirectFilter(filter *k8s.HTTPRequestRedirectFilter) *istio.HTTPRedi
 	return resp
 }
 
+// responseHeaderModifier is the type of the filter modifying response headers. It is defined by later versions of the
+// Gateway API than the one we implement, which cannot carry its configuration; it is reported explicitly, as users
+// may expect it to be supported.
+const responseHeaderModifier k8s.HTTPRouteFilterType = "ResponseHeaderModifier"
+
+// unsupportedFilter returns the error for a filter type that cannot be converted.
+func unsupportedFilter(typ k8s.HTTPRouteFilterType) *ConfigError {
+	if typ == responseHeaderModifier {
+		return &ConfigError{
+			Reason:  InvalidFilter,
+			Message: fmt.Sprintf("filter type %q is not supported by this version of the Gateway API", typ),
+		}
+	}
+	return &ConfigError{Reason: InvalidFilter, Message: fmt.Sprintf("unsupported filter type %q", typ)}
+}
+
 func createHeadersFilter(filter *k8s.HTTPRequestHeaderFilter) *istio.Headers {
 	if filter == nil {
 		return nil
@@ -794,6 +1536,31 @@ func createMethodMatch(match k8s.HTTPRouteMatch) (*istio.StringMatch, *ConfigErr
 	}, nil
 }
 
+// Maximum lengths of the match values of HTTPRoutes, as defined by the Gateway API.
+const (
+	maxPathMatchLength       = 1024
+	maxHeaderMatchLength     = 4096
+	maxQueryParamMatchLength = 1024
+)
+
+// validateRegexMatch validates the regular expression of a match. Envoy uses RE2, as the regexp package does;
+// invalid expressions would otherwise only be rejected by the proxies, without any feedback to the route author.
+func validateRegexMatch(match string, expr string, maxLength int) *ConfigError {
+	if len(expr) > maxLength {
+		return &ConfigError{
+			Reason:  UnsupportedValue,
+			Message: fmt.Sprintf("%s regular expression is longer than %d characters", match, maxLength),
+		}
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return &ConfigError{
+			Reason:  UnsupportedValue,
+			Message: fmt.Sprintf("invalid %s regular expression %q: %v", match, expr, err),
+		}
+	}
+	return nil
+}
+
 func createQueryParamsMatch(match k8s.HTTPRouteMatch) (map[string]*istio.StringMatch, *ConfigError) {
 	res := map[string]*istio.StringMatch{}
 	for _, qp := range match.QueryParams {
@@ -807,6 +1574,9 @@ func createQueryParamsMatch(match k8s.HTTPRouteMatch) (map[string]*istio.StringM
 				MatchType: &istio.StringMatch_Exact{Exact: qp.Value},
 			}
 		case k8s.QueryParamMatchRegularExpression:
+			if err := validateRegexMatch("query parameter "+qp.Name, qp.Value, maxQueryParamMatchLength); err != nil {
+				return nil, err
+			}
 			res[qp.Name] = &istio.StringMatch{
 				MatchType: &istio.StringMatch_Regex{Regex: qp.Value},
 			}
@@ -835,6 +1605,9 @@ func createHeadersMatch(match k8s.HTTPRouteMatch) (map[string]*istio.StringMatch
 				MatchType: &istio.StringMatch_Exact{Exact: header.Value},
 			}
 		case k8s.HeaderMatchRegularExpression:
+			if err := validateRegexMatch("header "+string(header.Name), header.Value, maxHeaderMatchLength); err != nil {
+				return nil, err
+			}
 			res[string(header.Name)] = &istio.StringMatch{
 				MatchType: &istio.StringMatch_Regex{Regex: header.Value},
 			}
@@ -856,16 +1629,19 @@ const prefixMatchRegex = `((\/).*)?`
 
 func createURIMatch(match k8s.HTTPRouteMatch) (*istio.StringMatch, *ConfigError) {
 	tp := k8s.PathMatchPathPrefix
-	if match.Path.Type != nil {
-		tp = *match.Path.Type
-	}
 	dest := "/"
-	if match.Path.Value != nil {
-		dest = *match.Path.Value
+	// The path is defaulted by the API server, but may be unset if the object was not admitted through it.
+	if match.Path != nil {
+		if match.Path.Type != nil {
+			tp = *match.Path.Type
+		}
+		if match.Path.Value != nil {
+			dest = *match.Path.Value
+		}
 	}
 	switch tp {
 	case k8s.PathMatchPathPrefix:
-		path := *match.Path.Value
+		path := dest
 		if path == "/" {
 			// Optimize common case of / to not needed regex
 			return &istio.StringMatch{
@@ -881,6 +1657,9 @@ func createURIMatch(match k8s.HTTPRouteMatch) (*istio.StringMatch, *ConfigError)
 			MatchType: &istio.StringMatch_Exact{Exact: dest},
 		}, nil
 	case k8s.PathMatchRegularExpression:
+		if err := validateRegexMatch("path", dest, maxPathMatchLength); err != nil {
+			return nil, err
+		}
 		return &istio.StringMatch{
 			MatchType: &istio.StringMatch_Regex{Regex: dest},
 		}, nil
@@ -890,9 +1669,10 @@ func createURIMatch(match k8s.HTTPRouteMatch) (*istio.StringMatch, *ConfigError)
 	}
 }
 
-// getGatewayClass finds all gateway class that are owned by Istio
-func getGatewayClasses(r *KubernetesResources) map[string]struct{} {
-	classes := map[string]struct{}{}
+// getGatewayClass finds all gateway class that are owned by Istio, with their parameters. Classes with invalid
+// parameters are not accepted, and are not included.
+func getGatewayClasses(r *KubernetesResources) map[string]gatewayClass {
+	classes := map[string]gatewayClass{}
 	builtinClassExists := false
 	for _, obj := range r.GatewayClass {
 		gwc := obj.Spec.(*k8s.GatewayClassSpec)
@@ -900,20 +1680,26 @@ func getGatewayClasses(r *KubernetesResources) map[string]struct{} {
 			builtinClassExists = true
 		}
 		if gwc.ControllerName == ControllerName {
-			// TODO we can add any settings we need here needed for the controller
-			// For now, we have none, so just add a struct
-			classes[obj.Name] = struct{}{}
+			accepted := metav1.Condition{
+				Type:               string(k8s.GatewayClassConditionStatusAccepted),
+				Status:             kstatus.StatusTrue,
+				ObservedGeneration: obj.Generation,
+				LastTransitionTime: metav1.Now(),
+				Reason:             string(k8s.GatewayClassConditionStatusAccepted),
+				Message:            "Handled by Istio controller",
+			}
+			params, err := buildClassParameters(gwc, r.ConfigMaps)
+			if err != nil {
+				accepted.Status = kstatus.StatusFalse
+				accepted.Reason = string(k8s.GatewayClassReasonInvalidParameters)
+				accepted.Message = truncateMessage(err.Error())
+			} else {
+				classes[obj.Name] = gatewayClass{Parameters: params}
+			}
 
 			obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
 				gcs := s.(*k8s.GatewayClassStatus)
-				gcs.Conditions = kstatus.UpdateConditionIfChanged(gcs.Conditions, metav1.Condition{
-					Type:               string(k8s.GatewayClassConditionStatusAccepted),
-					Status:             kstatus.StatusTrue,
-					ObservedGeneration: obj.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             string(k8s.GatewayClassConditionStatusAccepted),
-					Message:            "Handled by Istio controller",
-				})
+				gcs.Conditions = kstatus.UpdateConditionIfChanged(gcs.Conditions, accepted)
 				return gcs
 			})
 		}
@@ -921,7 +1707,7 @@ func getGatewayClasses(r *KubernetesResources) map[string]struct{} {
 	if !builtinClassExists {
 		// Allow `istio` class without explicit GatewayClass. However, if it already exists then do not
 		// add it here, in case it points to a different controller.
-		classes[DefaultClassName] = struct{}{}
+		classes[DefaultClassName] = gatewayClass{}
 	}
 	return classes
 }
@@ -954,6 +1740,9 @@ type parentInfo struct {
 	Hostnames []string
 	// OriginalHostname is the unprocessed form of Hostnames; how it appeared in users' config
 	OriginalHostname string
+	// Namespaces are the namespaces of the proxies implementing the parent, that is the namespaces of the Gateway and
+	// its Services. Empty for the mesh, which is implemented by proxies in all namespaces.
+	Namespaces []string
 
 	// AttachedRoutes keeps track of how many routes are attached to this parent. This is tracked for status.
 	// Because this is mutate in the route generation, parentInfo must be passed as a pointer
@@ -961,12 +1750,36 @@ type parentInfo struct {
 	// ReportAttachedRoutes is a callback that should be triggered once all AttachedRoutes are computed, to
 	// actually store the attached route count in the status
 	ReportAttachedRoutes func()
+	// HTTPSRedirects are the HTTPS listeners plain text requests to this listener are redirected to. See
+	// HTTPSRedirectOption.
+	HTTPSRedirects []httpsRedirect
+	// DeniedReason is set if the listener conflicts with another listener of the Gateway. No config is generated
+	// for the listener, and routes referencing it are denied with this reason.
+	DeniedReason error
+}
+
+// httpsRedirect describes an HTTPS listener requests to an HTTP listener are redirected to.
+type httpsRedirect struct {
+	// Gateway is the metadata of the Gateway of both listeners
+	Gateway config.Meta
+	// From is the name of the HTTP listener
+	From k8s.SectionName
+	// To is the name of the HTTPS listener
+	To k8s.SectionName
+	// Hostname is the hostname of the HTTPS listener, or "*" if unset
+	Hostname string
+	// Port is the port of the HTTPS listener
+	Port uint32
 }
 
 // routeParentReference holds information about a route's parent reference
 type routeParentReference struct {
 	// InternalName refers to the internal name of the parent we can reference it by. For example, "mesh" or "my-ns/my-gateway"
 	InternalName string
+	// Hostnames is the hostnames of the parent, in ns/hostname format. See parentInfo.Hostnames.
+	Hostnames []string
+	// Namespaces are the namespaces of the proxies implementing the parent. See parentInfo.Namespaces.
+	Namespaces []string
 	// DeniedReason, if present, indicates why the reference was not valid
 	DeniedReason error
 	// OriginalReference contains the original reference
@@ -976,11 +1789,17 @@ type routeParentReference struct {
 // referencesToInternalNames converts valid parent references to names that can be used in VirtualService
 func referencesToInternalNames(parents []routeParentReference) []string {
 	ret := make([]string, 0, len(parents))
+	seen := sets.NewSet()
 	for _, p := range parents {
 		if p.DeniedReason != nil {
 			// We should filter this out
 			continue
 		}
+		if seen.Contains(p.InternalName) {
+			// The same parent may be referenced multiple times
+			continue
+		}
+		seen.Insert(p.InternalName)
 		ret = append(ret, p.InternalName)
 	}
 	// To ensure deterministic order, sort them
@@ -988,140 +1807,266 @@ func referencesToInternalNames(parents []routeParentReference) []string {
 	return ret
 }
 
-func convertGateways(r *KubernetesResources) ([]config.Config, map[parentKey]map[k8s.SectionName]*parentInfo, sets.Set) {
+// referencesToHostnames indexes the hostnames of valid parent references by internal name. A parent may be
+// referenced multiple times, in which case the hostnames are merged.
+func referencesToHostnames(parents []routeParentReference) map[string][]string {
+	ret := map[string][]string{}
+	for _, p := range parents {
+		if p.DeniedReason != nil {
+			continue
+		}
+		ret[p.InternalName] = append(ret[p.InternalName], p.Hostnames...)
+	}
+	return ret
+}
+
+// referencesToExportTo returns the namespaces a VirtualService generated for the valid parent references is exported
+// to: the route namespace, and the namespaces of the proxies implementing the parents. If internalName is set, only
+// the references to that parent are considered. A nil result exports the VirtualService to all namespaces, which
+// is required for the mesh.
+func referencesToExportTo(parents []routeParentReference, routeNamespace string, internalName string) []string {
+	if features.GatewayAPIExportToAllNamespaces {
+		return nil
+	}
+	namespaces := sets.NewSet(routeNamespace)
+	for _, p := range parents {
+		if p.DeniedReason != nil || (internalName != "" && p.InternalName != internalName) {
+			continue
+		}
+		if len(p.Namespaces) == 0 {
+			return nil
+		}
+		namespaces.Insert(p.Namespaces...)
+	}
+	return namespaces.SortedList()
+}
+
+func convertGateways(r *KubernetesResources, references AllowedReferences) ([]config.Config, map[parentKey]map[k8s.SectionName]*parentInfo,
+	NamespaceSelectors, []config.Config) {
 	// result stores our generated Istio Gateways
 	result := []config.Config{}
+	// envoyFilters stores the EnvoyFilters generated for Gateway features not supported by Istio Gateways
+	envoyFilters := []config.Config{}
 	// gwMap stores an index to access parentInfo (which corresponds to a Kubernetes Gateway)
 	gwMap := map[parentKey]map[k8s.SectionName]*parentInfo{}
-	// namespaceLabelReferences keeps track of all namespace label keys referenced by Gateways. This is
-	// used to ensure we handle namespace updates for those keys.
-	namespaceLabelReferences := sets.NewSet()
+	// namespaceSelectors keeps track of all namespace selectors of Gateways. This is used to ensure we handle
+	// namespace updates changing the selected namespaces.
+	namespaceSelectors := NamespaceSelectors{}
 	classes := getGatewayClasses(r)
+	skipped := 0
 	for _, obj := range r.Gateway {
 		obj := obj
 		kgw := obj.Spec.(*k8s.GatewaySpec)
-		if _, f := classes[string(kgw.GatewayClassName)]; !f {
+		class, f := classes[string(kgw.GatewayClassName)]
+		if !f {
 			// No gateway class found, this may be meant for another controller; should be skipped.
 			continue
 		}
-
-		// Setup initial conditions to the success state. If we encounter errors, we will update this.
-		gatewayConditions := map[string]*condition{
-			string(k8s.GatewayConditionReady): {
-				reason:  "ListenersValid",
-				message: "Listeners valid",
-			},
-		}
-		if isManaged(kgw) {
-			gatewayConditions[string(k8s.GatewayConditionScheduled)] = &condition{
-				error: &ConfigError{
-					Reason:  "ResourcesPending",
-					Message: "Resources not yet deployed to the cluster",
-				},
-				setOnce: true,
-			}
-		} else {
-			gatewayConditions[string(k8s.GatewayConditionScheduled)] = &condition{
-				reason:  "ResourcesAvailable",
-				message: "Resources available",
-			}
+		if isSkipped(obj.Annotations) {
+			// Explicitly opted out; we do not generate any config or write any status.
+			skipped++
+			continue
 		}
-		servers := []*istio.Server{}
 
-		// Extract the addresses. A gateway will bind to a specific Service
-		gatewayServices, skippedAddresses := extractGatewayServices(r, kgw, obj)
-		invalidListeners := []k8s.SectionName{}
-		for i, l := range kgw.Listeners {
-			i := i
-			namespaceLabelReferences.Insert(getNamespaceLabelReferences(l.AllowedRoutes)...)
-			server, ok := buildListener(r, obj, l, i)
-			if !ok {
-				invalidListeners = append(invalidListeners, l.Name)
-				continue
-			}
-			meta := parentMeta(obj, &l.Name)
-			meta[model.InternalGatewayServiceAnnotation] = strings.Join(gatewayServices, ",")
-			// Each listener generates an Istio Gateway with a single Server. This allows binding to a specific listener.
-			gatewayConfig := config.Config{
-				Meta: config.Meta{
-					CreationTimestamp: obj.CreationTimestamp,
-					GroupVersionKind:  gvk.Gateway,
-					Name:              fmt.Sprintf("%s-%s-%s", obj.Name, constants.KubernetesGatewayName, l.Name),
-					Annotations:       meta,
-					Namespace:         obj.Namespace,
-					Domain:            r.Domain,
-				},
-				Spec: &istio.Gateway{
-					Servers: []*istio.Server{server},
+		convertSafely(obj, func() {
+			// Setup initial conditions to the success state. If we encounter errors, we will update this.
+			gatewayConditions := map[string]*condition{
+				string(k8s.GatewayConditionReady): {
+					reason:  "ListenersValid",
+					message: "Listeners valid",
 				},
 			}
-			ref := parentKey{
-				Kind:      gvk.KubernetesGateway,
-				Name:      obj.Name,
-				Namespace: obj.Namespace,
+			managed := class.managed(kgw)
+			if managed {
+				gatewayConditions[string(k8s.GatewayConditionScheduled)] = &condition{
+					error: &ConfigError{
+						Reason:  "ResourcesPending",
+						Message: "Resources not yet deployed to the cluster",
+					},
+					setOnce: true,
+				}
+			} else {
+				gatewayConditions[string(k8s.GatewayConditionScheduled)] = &condition{
+					reason:  "ResourcesAvailable",
+					message: "Resources available",
+				}
 			}
-			if _, f := gwMap[ref]; !f {
-				gwMap[ref] = map[k8s.SectionName]*parentInfo{}
+			servers := []*istio.Server{}
+			// The generated Gateways and parents are only published once the whole Gateway is converted.
+			gatewayConfigs := []config.Config{}
+			parents := map[k8s.SectionName]*parentInfo{}
+			rateLimits := map[k8s.PortNumber]*localRateLimit{}
+
+			// Extract the addresses. A gateway will bind to a specific Service
+			gatewayServices, skippedAddresses := extractGatewayServices(r, kgw, obj, managed)
+			namespaces := gatewayNamespaces(obj.Namespace, gatewayServices, r.Domain)
+			invalidListeners := []string{}
+			conflicts := listenerConflicts(kgw.Listeners)
+			for _, i := range sortedListenerIndexes(kgw.Listeners) {
+				i := i
+				l := kgw.Listeners[i]
+				if ls := namespaceSelector(l.AllowedRoutes); ls != nil {
+					namespaceSelectors[ls.String()] = ls
+				}
+				server, creds, ok := buildListener(r, references, obj, l, i, conflicts[i])
+				if !ok {
+					invalidListeners = append(invalidListeners, string(l.Name))
+					// No routes can attach to an invalid listener
+					reportListenerAttachedRoutes(i, obj, 0)
+					if conflicts[i] != nil {
+						// Routes referencing the listener are denied, rather than reported as referencing a section
+						// that does not exist.
+						parents[l.Name] = &parentInfo{
+							DeniedReason: parentErrorf(deniedListener, "listener %q is conflicted: %s", l.Name, conflicts[i].Message),
+						}
+					}
+					continue
+				}
+				meta := parentMeta(obj, &l.Name)
+				meta[model.InternalGatewayServiceAnnotation] = strings.Join(gatewayServices, ",")
+				if len(creds) > 1 {
+					// A server has a single CredentialName, so additional certificates are declared separately
+					meta[model.InternalCredentialNamesAnnotation] = strings.Join(creds, ",")
+				}
+				// Each listener generates an Istio Gateway with a single Server. This allows binding to a specific listener.
+				gatewayConfig := config.Config{
+					Meta: config.Meta{
+						CreationTimestamp: obj.CreationTimestamp,
+						GroupVersionKind:  gvk.Gateway,
+						Name:              boundedName(obj.Name, fmt.Sprintf("-%s-%s", constants.KubernetesGatewayName, l.Name)),
+						Annotations:       meta,
+						Namespace:         obj.Namespace,
+						Domain:            r.Domain,
+					},
+					Spec: &istio.Gateway{
+						Servers: []*istio.Server{server},
+					},
+				}
+				pri := &parentInfo{
+					InternalName:     obj.Namespace + "/" + gatewayConfig.Name,
+					AllowedKinds:     generateSupportedKinds(l),
+					Hostnames:        server.Hosts,
+					OriginalHostname: listenerHostnameString(l.Hostname),
+					Namespaces:       namespaces,
+				}
+				pri.ReportAttachedRoutes = func() {
+					reportListenerAttachedRoutes(i, obj, pri.AttachedRoutes)
+				}
+				parents[l.Name] = pri
+				gatewayConfigs = append(gatewayConfigs, gatewayConfig)
+				servers = append(servers, server)
+				// Already validated by buildListener
+				if rl, _ := listenerLocalRateLimit(obj.Annotations, l.Name); rl != nil {
+					rateLimits[l.Port] = rl
+				}
 			}
 
-			pri := &parentInfo{
-				InternalName:     obj.Namespace + "/" + gatewayConfig.Name,
-				AllowedKinds:     generateSupportedKinds(l),
-				Hostnames:        server.Hosts,
-				OriginalHostname: emptyIfNil((*string)(l.Hostname)),
+			pairHTTPSRedirects(obj, kgw.Listeners, parents)
+
+			internal, external, warnings := r.Context.ResolveGatewayInstances(obj.Namespace, gatewayServices, servers)
+			if len(skippedAddresses) > 0 {
+				warnings = append(warnings, fmt.Sprintf("Only Hostname is supported, ignoring [%s]", boundedJoin(skippedAddresses, " ")))
 			}
-			pri.ReportAttachedRoutes = func() {
-				reportListenerAttachedRoutes(i, obj, pri.AttachedRoutes)
+			if managed {
+				if w := requestedAddressWarning(kgw, external); w != "" {
+					warnings = append(warnings, w)
+				}
 			}
-			gwMap[ref][l.Name] = pri
-			result = append(result, gatewayConfig)
-			servers = append(servers, server)
-		}
-
-		internal, external, warnings := r.Context.ResolveGatewayInstances(obj.Namespace, gatewayServices, servers)
-		if len(skippedAddresses) > 0 {
-			warnings = append(warnings, fmt.Sprintf("Only Hostname is supported, ignoring %v", skippedAddresses))
-		}
-		if len(warnings) > 0 {
-			var msg string
-			if len(internal) > 0 {
-				msg = fmt.Sprintf("Assigned to service(s) %s, but failed to assign to all requested addresses: %s",
-					humanReadableJoin(internal), strings.Join(warnings, "; "))
+			if len(warnings) > 0 {
+				var msg string
+				if len(internal) > 0 {
+					msg = fmt.Sprintf("Assigned to service(s) %s, but failed to assign to all requested addresses: %s",
+						humanReadableJoin(internal), boundedJoin(warnings, "; "))
+				} else {
+					msg = fmt.Sprintf("failed to assign to any requested addresses: %s", boundedJoin(warnings, "; "))
+				}
+				gatewayConditions[string(k8s.GatewayConditionReady)].error = &ConfigError{
+					Reason:  string(k8s.GatewayReasonAddressNotAssigned),
+					Message: msg,
+				}
+			} else if len(invalidListeners) > 0 {
+				gatewayConditions[string(k8s.GatewayConditionReady)].error = &ConfigError{
+					Reason:  string(k8s.GatewayReasonListenersNotValid),
+					Message: fmt.Sprintf("Invalid listeners: [%s]", boundedJoin(invalidListeners, " ")),
+				}
 			} else {
-				msg = fmt.Sprintf("failed to assign to any requested addresses: %s", strings.Join(warnings, "; "))
+				gatewayConditions[string(k8s.GatewayConditionReady)].message = fmt.Sprintf("Gateway valid, assigned to service(s) %s", humanReadableJoin(internal))
 			}
-			gatewayConditions[string(k8s.GatewayConditionReady)].error = &ConfigError{
-				Reason:  string(k8s.GatewayReasonAddressNotAssigned),
-				Message: msg,
+			obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
+				gs := s.(*k8s.GatewayStatus)
+				addressesToReport := external
+				addrType := k8s.IPAddressType
+				if len(addressesToReport) == 0 {
+					// There are no external addresses, so report the internal ones
+					// TODO: should we always report both?
+					addressesToReport = internal
+					addrType = k8s.HostnameAddressType
+				}
+				gs.Addresses = make([]k8s.GatewayAddress, 0, len(addressesToReport))
+				for _, addr := range addressesToReport {
+					gs.Addresses = append(gs.Addresses, k8s.GatewayAddress{
+						Type:  &addrType,
+						Value: addr,
+					})
+				}
+				return gs
+			})
+			reportGatewayCondition(obj, gatewayConditions)
+
+			result = append(result, gatewayConfigs...)
+			if ef := buildLocalRateLimitEnvoyFilter(obj, rateLimits, r.Domain); ef != nil {
+				envoyFilters = append(envoyFilters, *ef)
 			}
-		} else if len(invalidListeners) > 0 {
-			gatewayConditions[string(k8s.GatewayConditionReady)].error = &ConfigError{
-				Reason:  string(k8s.GatewayReasonListenersNotValid),
-				Message: fmt.Sprintf("Invalid listeners: %v", invalidListeners),
+			if len(parents) > 0 {
+				gwMap[parentKey{
+					Kind:      gvk.KubernetesGateway,
+					Name:      obj.Name,
+					Namespace: obj.Namespace,
+				}] = parents
 			}
-		} else {
-			gatewayConditions[string(k8s.GatewayConditionReady)].message = fmt.Sprintf("Gateway valid, assigned to service(s) %s", humanReadableJoin(internal))
+		})
+	}
+	// Routes attached to Gateways being deleted are denied, rather than dropping the parent from their status.
+	for _, obj := range r.DeletedGateways {
+		kgw := obj.Spec.(*k8s.GatewaySpec)
+		if _, f := classes[string(kgw.GatewayClassName)]; !f || isSkipped(obj.Annotations) {
+			continue
 		}
-		obj.Status.(*kstatus.WrappedStatus).Mutate(func(s config.Status) config.Status {
-			gs := s.(*k8s.GatewayStatus)
-			addressesToReport := external
-			addrType := k8s.IPAddressType
-			if len(addressesToReport) == 0 {
-				// There are no external addresses, so report the internal ones
-				// TODO: should we always report both?
-				addressesToReport = internal
-				addrType = k8s.HostnameAddressType
-			}
-			gs.Addresses = make([]k8s.GatewayAddress, 0, len(addressesToReport))
-			for _, addr := range addressesToReport {
-				gs.Addresses = append(gs.Addresses, k8s.GatewayAddress{
-					Type:  &addrType,
-					Value: addr,
-				})
+		parents := map[k8s.SectionName]*parentInfo{}
+		for _, l := range kgw.Listeners {
+			parents[l.Name] = &parentInfo{
+				DeniedReason: parentErrorf(deniedDeleted, "namespace %q of the parent is being deleted", obj.Namespace),
 			}
-			return gs
-		})
-		reportGatewayCondition(obj, gatewayConditions)
+		}
+		gwMap[parentKey{
+			Kind:      gvk.KubernetesGateway,
+			Name:      obj.Name,
+			Namespace: obj.Namespace,
+		}] = parents
+	}
+	// The Gateways of other revisions are tracked, so routes shared with them keep the status reported by that revision.
+	for _, obj := range r.OtherRevisionGateways {
+		kgw := obj.Spec.(*k8s.GatewaySpec)
+		if _, f := classes[string(kgw.GatewayClassName)]; !f || isSkipped(obj.Annotations) {
+			continue
+		}
+		gwMap[parentKey{
+			Kind:      gvk.KubernetesGateway,
+			Name:      obj.Name,
+			Namespace: obj.Namespace,
+		}] = map[k8s.SectionName]*parentInfo{
+			"": {DeniedReason: errOtherRevision},
+		}
+	}
+	// Routes can also attach to Istio Gateways, which eases the migration from these.
+	for _, obj := range r.IstioGateway {
+		gwMap[parentKey{
+			Kind:      gvk.Gateway,
+			Name:      obj.Name,
+			Namespace: obj.Namespace,
+		}] = map[k8s.SectionName]*parentInfo{
+			"": istioGatewayParent(obj),
+		}
 	}
 	// Insert a parent for Mesh references.
 	gwMap[parentKey{
@@ -1132,13 +2077,191 @@ func convertGateways(r *KubernetesResources) ([]config.Config, map[parentKey]map
 			InternalName: "mesh",
 		},
 	}
-	return result, gwMap, namespaceLabelReferences
+	skippedGateways.Record(float64(skipped))
+	return result, gwMap, namespaceSelectors, envoyFilters
+}
+
+// istioGatewayParent returns the parent routes attached to an Istio Gateway bind to. The hostnames of the parent are
+// the hosts of all servers of the Gateway. We do not own the status of Istio Gateways, so ReportAttachedRoutes is
+// not set.
+func istioGatewayParent(obj config.Config) *parentInfo {
+	hostnames := []string{}
+	original := []string{}
+	for _, server := range obj.Spec.(*istio.Gateway).Servers {
+		for _, h := range server.Hosts {
+			original = append(original, h)
+			// Hosts are in the namespace/hostname format, where the namespace is optional and "." is the namespace
+			// of the Gateway.
+			ns, hostname := "*", h
+			if spl := strings.SplitN(h, "/", 2); len(spl) == 2 {
+				ns, hostname = spl[0], spl[1]
+			}
+			if ns == "." {
+				ns = obj.Namespace
+			}
+			hostnames = append(hostnames, ns+"/"+hostname)
+		}
+	}
+	return &parentInfo{
+		InternalName:     obj.Namespace + "/" + obj.Name,
+		Hostnames:        hostnames,
+		OriginalHostname: strings.Join(original, ","),
+		// The Gateway may be implemented by proxies in any namespace, as it selects them by labels.
+		Namespaces: nil,
+	}
+}
+
+// pairHTTPSRedirects records, on the parents of the HTTP listeners, the HTTPS listeners with HTTPSRedirectOption
+// set they are redirected to. Only valid listeners, which have a parent, are paired.
+func pairHTTPSRedirects(obj config.Config, listeners []k8s.Listener, parents map[k8s.SectionName]*parentInfo) {
+	for _, to := range listeners {
+		if to.Protocol != k8s.HTTPSProtocolType || to.TLS == nil || to.TLS.Options[HTTPSRedirectOption] != "true" {
+			continue
+		}
+		if pri, f := parents[to.Name]; !f || pri.DeniedReason != nil {
+			continue
+		}
+		hostname := "*"
+		if to.Hostname != nil {
+			hostname = string(*to.Hostname)
+		}
+		for _, from := range listeners {
+			if from.Protocol != k8s.HTTPProtocolType || (from.Hostname != nil && listenerHostnameString(from.Hostname) != hostname) {
+				continue
+			}
+			pri, f := parents[from.Name]
+			if !f || pri.DeniedReason != nil {
+				continue
+			}
+			pri.HTTPSRedirects = append(pri.HTTPSRedirects, httpsRedirect{
+				Gateway:  obj.Meta,
+				From:     from.Name,
+				To:       to.Name,
+				Hostname: hostname,
+				Port:     uint32(to.Port),
+			})
+		}
+	}
+}
+
+// buildHTTPSRedirectVirtualServices generates a VirtualService redirecting requests to the HTTPS listener for each
+// pair of listeners recorded by pairHTTPSRedirects. Redirects are not generated for hostnames overlapping the hosts
+// of the routes generated for the HTTP listener, so that user routes always take precedence. The redirect is placed
+// in a namespace the HTTP listener admits routes from, as only VirtualServices in these namespaces bind to it.
+func buildHTTPSRedirectVirtualServices(gatewayMap map[parentKey]map[k8s.SectionName]*parentInfo,
+	routes []config.Config, domain string) []config.Config {
+	routeHosts := map[string][]host.Name{}
+	for _, vs := range routes {
+		spec, ok := vs.Spec.(*istio.VirtualService)
+		if !ok {
+			continue
+		}
+		for _, gw := range spec.Gateways {
+			for _, h := range spec.Hosts {
+				routeHosts[gw] = append(routeHosts[gw], host.Name(h))
+			}
+		}
+	}
+
+	result := []config.Config{}
+	for _, sections := range gatewayMap {
+		for _, pri := range sections {
+			for _, redirect := range pri.HTTPSRedirects {
+				if hostOverlaps(host.Name(redirect.Hostname), routeHosts[pri.InternalName]) {
+					continue
+				}
+				namespace, ok := redirectNamespace(redirect.Gateway.Namespace, pri.Hostnames)
+				if !ok {
+					continue
+				}
+				name := redirect.Gateway.Name
+				if namespace != redirect.Gateway.Namespace {
+					// Redirects of Gateways with the same name in different namespaces may share the namespace
+					name = redirect.Gateway.Namespace + "." + name
+				}
+				meta := parentMeta(config.Config{Meta: redirect.Gateway}, &redirect.From)
+				meta[constants.InternalRouteParent] = pri.InternalName
+				result = append(result, config.Config{
+					Meta: config.Meta{
+						CreationTimestamp: redirect.Gateway.CreationTimestamp,
+						GroupVersionKind:  gvk.VirtualService,
+						Name: boundedName(name, fmt.Sprintf("-%s-%s-https-redirect-%s",
+							constants.KubernetesGatewayName, redirect.From, redirect.To)),
+						Annotations: meta,
+						Namespace:   namespace,
+						Domain:      domain,
+					},
+					Spec: &istio.VirtualService{
+						Hosts:    []string{redirect.Hostname},
+						Gateways: []string{pri.InternalName},
+						Http: []*istio.HTTPRoute{{
+							Redirect: &istio.HTTPRedirect{
+								Scheme:       "https",
+								RedirectPort: &istio.HTTPRedirect_Port{Port: redirect.Port},
+								RedirectCode: 301,
+							},
+						}},
+						ExportTo: redirectExportTo(namespace, pri.Namespaces),
+					},
+				})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// redirectNamespace returns the namespace of the redirect generated for a listener, given the listener hostnames in
+// the ns/hostname format: the Gateway namespace if the listener admits it, and otherwise the first namespace it
+// admits. If the listener admits no namespace, no VirtualService binds to it and false is returned.
+func redirectNamespace(gatewayNamespace string, hostnames []string) (string, bool) {
+	admitted := []string{}
+	for _, h := range hostnames {
+		ns := strings.SplitN(h, "/", 2)[0]
+		if ns == "*" || ns == gatewayNamespace {
+			return gatewayNamespace, true
+		}
+		if ns != "~" {
+			admitted = append(admitted, ns)
+		}
+	}
+	if len(admitted) == 0 {
+		return "", false
+	}
+	sort.Strings(admitted)
+	return admitted[0], true
+}
+
+// hostOverlaps returns whether the hostname overlaps any of the hosts.
+func hostOverlaps(hostname host.Name, hosts []host.Name) bool {
+	for _, h := range hosts {
+		if hostname.Matches(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectExportTo returns the namespaces a redirect generated for a Gateway is exported to: the Gateway namespace,
+// and the namespaces of the proxies implementing it.
+func redirectExportTo(namespace string, gatewayNamespaces []string) []string {
+	if features.GatewayAPIExportToAllNamespaces {
+		return nil
+	}
+	return sets.NewSet(namespace).Insert(gatewayNamespaces...).SortedList()
+}
+
+// isSkipped checks if a Gateway has opted out of being handled by us with the SkipAnnotation.
+func isSkipped(annotations map[string]string) bool {
+	return annotations[SkipAnnotation] == "true"
 }
 
 // isManaged checks if a Gateway is managed (ie we create the Deployment and Service) or unmanaged.
 // This is based on the address field of the spec. If address is set with a Hostname type, it should point to an existing
 // Service that handles the gateway traffic. If it is not set, or refers to only a single IP, we will consider it managed and provision the Service.
-// If there is an IP, we will set the `loadBalancerIP` type.
+// If there is an IP, we will set the `loadBalancerIP` type, and report it in the status if another address is assigned.
 // While there is no defined standard for this in the API yet, it is tracked in https://github.com/kubernetes-sigs/gateway-api/issues/892.
 // So far, this mirrors how out of clusters work (address set means to use existing IP, unset means to provision one),
 // and there has been growing consensus on this model for in cluster deployments.
@@ -1155,8 +2278,24 @@ func isManaged(gw *k8s.GatewaySpec) bool {
 	return false
 }
 
-func extractGatewayServices(r *KubernetesResources, kgw *k8s.GatewaySpec, obj config.Config) ([]string, []string) {
-	if isManaged(kgw) {
+// requestedAddressWarning reports when a managed Gateway requests an IP address, which is set as the loadBalancerIP of
+// the provisioned Service, but the Service was assigned other addresses. Nothing is reported while no address is
+// assigned, as the load balancer may still be provisioning.
+func requestedAddressWarning(gw *k8s.GatewaySpec, assigned []string) string {
+	if len(gw.Addresses) != 1 || len(assigned) == 0 {
+		return ""
+	}
+	requested := gw.Addresses[0].Value
+	for _, addr := range assigned {
+		if addr == requested {
+			return ""
+		}
+	}
+	return fmt.Sprintf("requested address %s was not assigned, the service was assigned %s", requested, humanReadableJoin(assigned))
+}
+
+func extractGatewayServices(r *KubernetesResources, kgw *k8s.GatewaySpec, obj config.Config, managed bool) ([]string, []string) {
+	if managed {
 		return []string{fmt.Sprintf("%s.%s.svc.%v", obj.Name, obj.Namespace, r.Domain)}, nil
 	}
 	gatewayServices := []string{}
@@ -1180,22 +2319,41 @@ func extractGatewayServices(r *KubernetesResources, kgw *k8s.GatewaySpec, obj co
 	return gatewayServices, skippedAddresses
 }
 
-// getNamespaceLabelReferences fetches all label keys used in namespace selectors. Return order may not be stable.
-func getNamespaceLabelReferences(routes *k8s.AllowedRoutes) []string {
-	if routes == nil || routes.Namespaces == nil || routes.Namespaces.Selector == nil {
-		return nil
+// gatewayNamespaces returns the namespaces of the proxies implementing a Gateway: the Gateway namespace, and the
+// namespaces of the Gateway Services. Only addresses in the name.namespace.svc.domain format are cluster Services;
+// other hostnames, such as the hostname of an external load balancer, do not add a namespace.
+func gatewayNamespaces(namespace string, gatewayServices []string, domain string) []string {
+	namespaces := sets.NewSet(namespace)
+	suffix := ".svc." + domain
+	for _, svc := range gatewayServices {
+		if !strings.HasSuffix(svc, suffix) {
+			continue
+		}
+		if parts := strings.Split(strings.TrimSuffix(svc, suffix), "."); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			namespaces.Insert(parts[1])
+		}
 	}
-	res := []string{}
-	for k := range routes.Namespaces.Selector.MatchLabels {
-		res = append(res, k)
+	return namespaces.SortedList()
+}
+
+// namespaceSelector compiles the namespace selector of the AllowedRoutes of a listener, if it selects namespaces by
+// label. Invalid selectors select no namespace, so they are ignored.
+func namespaceSelector(routes *k8s.AllowedRoutes) klabels.Selector {
+	if routes == nil || routes.Namespaces == nil || routes.Namespaces.From == nil ||
+		*routes.Namespaces.From != k8s.NamespacesFromSelector || routes.Namespaces.Selector == nil {
+		return nil
 	}
-	for _, me := range routes.Namespaces.Selector.MatchExpressions {
-		res = append(res, me.Key)
+	ls, err := metav1.LabelSelectorAsSelector(routes.Namespaces.Selector)
+	if err != nil {
+		return nil
 	}
-	return res
+	return ls
 }
 
-func buildListener(r *KubernetesResources, obj config.Config, l k8s.Listener, listenerIndex int) (*istio.Server, bool) {
+// buildListener converts a listener to an Istio Server. conflict is the conflict of the listener with other listeners
+// of the Gateway, if any, as computed by listenerConflicts. creds holds all the credentials the server serves.
+func buildListener(r *KubernetesResources, references AllowedReferences, obj config.Config, l k8s.Listener, listenerIndex int,
+	conflict *ConfigError) (*istio.Server, []string, bool) {
 	listenerConditions := map[string]*condition{
 		string(k8s.ListenerConditionReady): {
 			reason:  "ListenerReady",
@@ -1217,17 +2375,79 @@ func buildListener(r *KubernetesResources, obj config.Config, l k8s.Listener, li
 		},
 	}
 	defer reportListenerCondition(listenerIndex, l, obj, listenerConditions)
-	tls, err := buildTLS(l.TLS, obj.Namespace)
+	var listeners []k8s.Listener
+	if kgw, ok := obj.Spec.(*k8s.GatewaySpec); ok {
+		listeners = kgw.Listeners
+	}
+	if msg := validateListenerProtocol(l); msg != "" {
+		listenerConditions[string(k8s.ListenerConditionReady)].error = &ConfigError{
+			Reason:  string(k8s.ListenerReasonInvalid),
+			Message: msg,
+		}
+		listenerConditions[string(k8s.ListenerConditionDetached)].error = &ConfigError{
+			Reason:  string(k8s.ListenerReasonUnsupportedProtocol),
+			Message: msg,
+		}
+		return nil, nil, false
+	}
+	if conflict != nil {
+		listenerConditions[string(k8s.ListenerConditionReady)].error = &ConfigError{
+			Reason:  string(k8s.ListenerReasonInvalid),
+			Message: conflict.Message,
+		}
+		listenerConditions[string(k8s.ListenerConditionConflicted)].error = conflict
+		return nil, nil, false
+	}
+	tls, creds, refErr, err := buildTLS(l.TLS, obj.Namespace, references)
 	if err != nil {
 		listenerConditions[string(k8s.ListenerConditionReady)].error = &ConfigError{
 			Reason:  string(k8s.ListenerReasonInvalid),
 			Message: err.Message,
 		}
+		listenerConditions[string(k8s.ListenerConditionResolvedRefs)].error = certificateRefError(err)
+		return nil, nil, false
+	}
+	if refErr != nil {
+		// The listener is still served with the valid certificates
+		listenerConditions[string(k8s.ListenerConditionResolvedRefs)].error = certificateRefError(refErr)
+	}
+	if l.Hostname != nil && *l.Hostname == "" {
+		// An unset hostname matches all hostnames, but an empty one is invalid. Reject it rather than silently
+		// treating it as a wildcard.
+		listenerConditions[string(k8s.ListenerConditionReady)].error = &ConfigError{
+			Reason:  string(k8s.ListenerReasonInvalid),
+			Message: "hostname must not be empty; omit the hostname to match all hostnames",
+		}
+		return nil, nil, false
+	}
+	if msg := validateLocalRateLimit(obj, l, listeners); msg != "" {
+		listenerConditions[string(k8s.ListenerConditionReady)].error = &ConfigError{
+			Reason:  string(k8s.ListenerReasonInvalid),
+			Message: msg,
+		}
+		return nil, nil, false
+	}
+	if invalid := invalidRouteKinds(l); len(invalid) > 0 {
+		// The listener is still usable for the valid kinds, if any
 		listenerConditions[string(k8s.ListenerConditionResolvedRefs)].error = &ConfigError{
-			Reason:  string(k8s.ListenerReasonInvalidCertificateRef),
-			Message: err.Message,
+			Reason:  string(k8s.ListenerReasonInvalidRouteKinds),
+			Message: fmt.Sprintf("unsupported route kinds: [%s]", boundedJoin(invalid, " ")),
+		}
+	}
+	var warnings []string
+	now := time.Now()
+	for _, cred := range creds {
+		for _, w := range certificateWarnings(r.Credentials, cred, l.Hostname, now) {
+			if len(creds) > 1 {
+				// Name the certificate the warning is about
+				w = cred + ": " + w
+			}
+			warnings = append(warnings, w)
 		}
-		return nil, false
+	}
+	if len(warnings) > 0 {
+		// The certificate may be fixed without changing the Gateway, so the listener is still programmed
+		listenerConditions[string(k8s.ListenerConditionReady)].message = "Certificate warnings: " + boundedJoin(warnings, "; ")
 	}
 	hostnames := buildHostnameMatch(obj.Namespace, r, l)
 	server := &istio.Server{
@@ -1241,22 +2461,152 @@ func buildListener(r *KubernetesResources, obj config.Config, l k8s.Listener, li
 		Tls:   tls,
 	}
 
-	return server, true
+	return server, creds, true
+}
+
+// certificateRefError converts an error resolving certificate references to the ResolvedRefs condition reason.
+func certificateRefError(err *ConfigError) *ConfigError {
+	reason := k8s.ListenerReasonInvalidCertificateRef
+	if err.Reason == string(k8s.ListenerReasonRefNotPermitted) {
+		reason = k8s.ListenerReasonRefNotPermitted
+	}
+	return &ConfigError{
+		Reason:  string(reason),
+		Message: err.Message,
+	}
+}
+
+// sortedListenerIndexes returns the indexes of the listeners, ordered by section name. Generating config in this
+// order ensures reordering the listeners of a Gateway does not change the generated config. The index is still
+// needed to report the listener status.
+func sortedListenerIndexes(listeners []k8s.Listener) []int {
+	idx := make([]int, 0, len(listeners))
+	for i := range listeners {
+		idx = append(idx, i)
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return listeners[idx[a]].Name < listeners[idx[b]].Name
+	})
+	return idx
+}
+
+// validateListenerProtocol checks the listener uses a combination of protocol, TLS mode and port Istio gateways
+// support. It returns a message describing why the listener is not supported, or an empty string if it is.
+func validateListenerProtocol(l k8s.Listener) string {
+	switch l.Protocol {
+	case k8s.HTTPProtocolType:
+		if l.TLS != nil {
+			return "protocol HTTP does not support tls; use protocol HTTPS to terminate TLS"
+		}
+		return ""
+	case k8s.TCPProtocolType:
+		if l.TLS != nil {
+			return "protocol TCP does not support tls; use protocol TLS to terminate or pass through TLS"
+		}
+		return ""
+	case k8s.HTTPSProtocolType, k8s.TLSProtocolType:
+		if l.TLS == nil {
+			return fmt.Sprintf("protocol %v requires tls", l.Protocol)
+		}
+		if l.Protocol == k8s.HTTPSProtocolType && l.TLS.Mode != nil && *l.TLS.Mode != k8s.TLSModeTerminate {
+			return fmt.Sprintf("protocol HTTPS does not support tls mode %v; use protocol TLS to pass through TLS", *l.TLS.Mode)
+		}
+		return ""
+	case k8s.UDPProtocolType:
+		// UDPRoute is not watched or converted: the proxy does not support UDP, and Istio Gateway servers and
+		// VirtualServices cannot express UDP routing.
+		return "protocol UDP is not supported; Istio gateways do not proxy UDP traffic"
+	default:
+		return fmt.Sprintf("protocol %v is not supported", l.Protocol)
+	}
+}
+
+// listenerConflicts returns, indexed like listeners, the conflict of each listener with the listeners sorting before
+// it by name on the same port. Listeners sharing a port must either all be HTTP, or all be HTTPS or TLS, and have
+// distinct hostnames; TCP cannot tell connections apart, so a TCP listener cannot share its port. On a conflict the
+// listener with the lowest name wins, so the outcome does not depend on the order of the listeners in the Gateway.
+// Listeners rejected by validateListenerProtocol, or conflicted themselves, are not served and never conflict with
+// other listeners.
+func listenerConflicts(listeners []k8s.Listener) []*ConfigError {
+	order := make([]int, len(listeners))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return listeners[order[a]].Name < listeners[order[b]].Name
+	})
+	conflicts := make([]*ConfigError, len(listeners))
+	for n, i := range order {
+		l := listeners[i]
+		if validateListenerProtocol(l) != "" {
+			continue
+		}
+		for _, j := range order[:n] {
+			other := listeners[j]
+			if other.Port != l.Port || conflicts[j] != nil || validateListenerProtocol(other) != "" {
+				continue
+			}
+			if l.Protocol == k8s.TCPProtocolType && other.Protocol == k8s.TCPProtocolType {
+				// TCP listeners have no hostname to select them by, rather than a protocol mismatch
+				conflicts[i] = &ConfigError{
+					Reason: string(k8s.ListenerReasonHostnameConflict),
+					Message: fmt.Sprintf("port %d is used by TCP listener %q; TCP listeners cannot be told apart on a shared port",
+						l.Port, other.Name),
+				}
+				break
+			}
+			if !compatibleListenerProtocols(l.Protocol, other.Protocol) {
+				conflicts[i] = &ConfigError{
+					Reason: string(k8s.ListenerReasonProtocolConflict),
+					Message: fmt.Sprintf("port %d is used by %v listener %q; protocol %v cannot share a port with protocol %v",
+						l.Port, other.Protocol, other.Name, l.Protocol, other.Protocol),
+				}
+				break
+			}
+			if listenerHostnameString(l.Hostname) == listenerHostnameString(other.Hostname) {
+				conflicts[i] = &ConfigError{
+					Reason: string(k8s.ListenerReasonHostnameConflict),
+					Message: fmt.Sprintf("hostname %q is used by listener %q on port %d",
+						listenerHostnameString(l.Hostname), other.Name, l.Port),
+				}
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// compatibleListenerProtocols returns whether listeners with the given protocols can share a port. A port serves
+// either plaintext HTTP, selecting the listener by Host header, or TLS, selecting the listener by SNI.
+func compatibleListenerProtocols(a, b k8s.ProtocolType) bool {
+	switch a {
+	case k8s.HTTPProtocolType:
+		return b == k8s.HTTPProtocolType
+	case k8s.HTTPSProtocolType, k8s.TLSProtocolType:
+		return b == k8s.HTTPSProtocolType || b == k8s.TLSProtocolType
+	default:
+		return false
+	}
 }
 
 func listenerProtocolToIstio(protocol k8s.ProtocolType) string {
-	// Currently, all gateway-api protocols are valid Istio protocols.
+	// Unsupported protocols are rejected by validateListenerProtocol, the remaining ones are valid Istio protocols.
 	return string(protocol)
 }
 
-func buildTLS(tls *k8s.GatewayTLSConfig, namespace string) (*istio.ServerTLSSettings, *ConfigError) {
+// buildTLS converts the TLS settings of a listener. Each certificate reference is resolved individually, so a listener
+// is only rejected if none of its references are valid; refErr reports the references that were skipped.
+// creds holds the credentials of all the valid references, which are all served; the CredentialName of the settings is
+// the first one.
+func buildTLS(tls *k8s.GatewayTLSConfig, namespace string,
+	references AllowedReferences) (out *istio.ServerTLSSettings, creds []string, refErr *ConfigError, err *ConfigError) {
 	if tls == nil {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 	// Explicitly not supported: file mounted
 	// Not yet implemented: TLS mode, https redirect, max protocol version, SANs, CipherSuites, VerifyCertificate
 
-	out := &istio.ServerTLSSettings{
+	out = &istio.ServerTLSSettings{
 		HttpsRedirect: false,
 	}
 	mode := k8s.TLSModeTerminate
@@ -1266,26 +2616,112 @@ func buildTLS(tls *k8s.GatewayTLSConfig, namespace string) (*istio.ServerTLSSett
 	switch mode {
 	case k8s.TLSModeTerminate:
 		out.Mode = istio.ServerTLSSettings_SIMPLE
-		if len(tls.CertificateRefs) != 1 {
+		if len(tls.CertificateRefs) == 0 {
 			// This is required in the API, should be rejected in validation
-			return nil, &ConfigError{Reason: InvalidConfiguration, Message: "exactly 1 certificateRefs should be present for TLS termination"}
+			return nil, nil, nil, &ConfigError{Reason: InvalidConfiguration, Message: "certificateRefs must be present for TLS termination"}
 		}
-		cred, err := buildSecretReference(*tls.CertificateRefs[0], namespace)
-		if err != nil {
-			return nil, err
+		var refErrs []*ConfigError
+		for i, ref := range tls.CertificateRefs {
+			if ref == nil {
+				refErrs = append(refErrs, &ConfigError{Reason: InvalidConfiguration, Message: fmt.Sprintf("certificateRefs[%d] must not be empty", i)})
+				continue
+			}
+			cred, err := buildSecretReference(*ref, namespace, references)
+			if err != nil {
+				refErrs = append(refErrs, err)
+				continue
+			}
+			creds = append(creds, cred)
 		}
-		out.CredentialName = cred
+		refErr = joinConfigErrors(refErrs)
+		if len(creds) == 0 {
+			return nil, nil, nil, refErr
+		}
+		out.CredentialName = creds[0]
 	case k8s.TLSModePassthrough:
 		out.Mode = istio.ServerTLSSettings_PASSTHROUGH
 	}
-	return out, nil
+	return out, creds, refErr, nil
+}
+
+// joinConfigErrors merges errors into a single one, with the reason of the first error. It returns nil if there are
+// no errors.
+func joinConfigErrors(errs []*ConfigError) *ConfigError {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Message)
+	}
+	return &ConfigError{Reason: errs[0].Reason, Message: strings.Join(msgs, "; ")}
+}
+
+// certificateWarnings reads the certificate of the credential, and returns the reasons why clients
+// may fail to verify it for the hostname. Certificates that cannot be read are not reported, as the secret may not
+// be readable by istiod, or may only be created later.
+func certificateWarnings(creds secrets.Controller, credentialName string, hostname *k8s.Hostname, now time.Time) []string {
+	if creds == nil || credentialName == "" {
+		return nil
+	}
+	res, err := credentials.ParseResourceName(credentialName, "", "", "")
+	if err != nil {
+		return nil
+	}
+	_, certPEM, err := creds.GetKeyAndCert(res.Name, res.Namespace)
+	if err != nil {
+		return nil
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return []string{"certificate is not PEM encoded"}
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse certificate: %v", err)}
+	}
+	var warnings []string
+	if now.After(cert.NotAfter) {
+		warnings = append(warnings, fmt.Sprintf("certificate expired at %v", cert.NotAfter.UTC().Format(time.RFC3339)))
+	}
+	if now.Before(cert.NotBefore) {
+		warnings = append(warnings, fmt.Sprintf("certificate is not valid before %v", cert.NotBefore.UTC().Format(time.RFC3339)))
+	}
+	if hostname != nil && *hostname != "" && !certificateCoversHostname(cert, string(*hostname)) {
+		warnings = append(warnings, fmt.Sprintf("certificate does not have a subject alternative name matching %v", *hostname))
+	}
+	return warnings
 }
 
-func buildSecretReference(ref k8s.SecretObjectReference, defaultNamespace string) (string, *ConfigError) {
+// certificateCoversHostname returns whether the certificate is valid for the listener hostname. A wildcard hostname
+// is only covered by the same wildcard, as the certificate must be valid for every host it matches.
+func certificateCoversHostname(cert *x509.Certificate, hostname string) bool {
+	if strings.HasPrefix(hostname, "*.") {
+		for _, san := range cert.DNSNames {
+			if strings.EqualFold(san, hostname) {
+				return true
+			}
+		}
+		return false
+	}
+	return cert.VerifyHostname(hostname) == nil
+}
+
+// buildSecretReference returns the credential name of a Secret referenced by a Gateway in gatewayNamespace. Secrets
+// in other namespaces can only be referenced if allowed by a ReferencePolicy.
+func buildSecretReference(ref k8s.SecretObjectReference, gatewayNamespace string, references AllowedReferences) (string, *ConfigError) {
 	if !nilOrEqual((*string)(ref.Group), gvk.Secret.Group) || !nilOrEqual((*string)(ref.Kind), gvk.Secret.Kind) {
 		return "", &ConfigError{Reason: InvalidTLS, Message: fmt.Sprintf("invalid certificate reference %v, only secret is allowed", objectReferenceString(ref))}
 	}
-	return credentials.ToKubernetesGatewayResource(defaultIfNil((*string)(ref.Namespace), defaultNamespace), string(ref.Name)), nil
+	namespace := defaultIfNil((*string)(ref.Namespace), gatewayNamespace)
+	from := Reference{Kind: gvk.KubernetesGateway, Namespace: k8s.Namespace(gatewayNamespace)}
+	if namespace != gatewayNamespace && !references.Allowed(from, gvk.Secret, string(ref.Name), namespace) {
+		return "", &ConfigError{
+			Reason:  string(k8s.ListenerReasonRefNotPermitted),
+			Message: fmt.Sprintf("certificate reference %v is not permitted by any ReferencePolicy", objectReferenceString(ref)),
+		}
+	}
+	return credentials.ToKubernetesGatewayResource(namespace, string(ref.Name)), nil
 }
 
 func objectReferenceString(ref k8s.SecretObjectReference) string {
@@ -1296,6 +2732,19 @@ func objectReferenceString(ref k8s.SecretObjectReference) string {
 		emptyIfNil((*string)(ref.Namespace)))
 }
 
+// backendRefString returns the name, with the namespace and port if set, of a backend as it is reported in status
+// messages.
+func backendRefString(ref k8s.BackendObjectReference) string {
+	name := string(ref.Name)
+	if ref.Namespace != nil {
+		name = string(*ref.Namespace) + "/" + name
+	}
+	if ref.Port != nil {
+		name = fmt.Sprintf("%s:%d", name, *ref.Port)
+	}
+	return name
+}
+
 func parentRefString(ref k8s.ParentRef) string {
 	return fmt.Sprintf("%s/%s/%s/%s.%s",
 		emptyIfNil((*string)(ref.Group)),
@@ -1305,6 +2754,17 @@ func parentRefString(ref k8s.ParentRef) string {
 		emptyIfNil((*string)(ref.Namespace)))
 }
 
+// listenerHostnameString returns the hostname of a listener, as it is reported in status messages.
+func listenerHostnameString(hostname *k8s.Hostname) string {
+	if hostname == nil {
+		return "(*)"
+	}
+	if *hostname == "" {
+		return "(empty/invalid)"
+	}
+	return string(*hostname)
+}
+
 // buildHostnameMatch generates a VirtualService.spec.hosts section from a listener
 func buildHostnameMatch(localNamespace string, r *KubernetesResources, l k8s.Listener) []string {
 	// We may allow all hostnames or a specific one
@@ -1327,6 +2787,17 @@ func buildHostnameMatch(localNamespace string, r *KubernetesResources, l k8s.Lis
 	return resp
 }
 
+// selectsRouteNamespaces returns whether any listener of the Gateway allows routes from namespaces selected by label.
+func selectsRouteNamespaces(obj config.Config) bool {
+	for _, l := range obj.Spec.(*k8s.GatewaySpec).Listeners {
+		if lr := l.AllowedRoutes; lr != nil && lr.Namespaces != nil && lr.Namespaces.From != nil &&
+			*lr.Namespaces.From == k8s.NamespacesFromSelector {
+			return true
+		}
+	}
+	return false
+}
+
 // namespacesFromSelector determines a list of allowed namespaces for a given AllowedRoutes
 func namespacesFromSelector(localNamespace string, r *KubernetesResources, lr *k8s.AllowedRoutes) []string {
 	// Default is to allow only the same namespace
@@ -1379,7 +2850,16 @@ func StrPointer(s string) *string {
 	return &s
 }
 
+// maxStatusItems is the maximum number of items of a list included in a status message. Any remaining items
+// are summarized by their count.
+const maxStatusItems = 10
+
+// humanReadableJoin joins the items as a sentence, for example "a, b, and c". At most maxStatusItems items are
+// included; the rest are summarized as "and N more".
 func humanReadableJoin(ss []string) string {
+	if len(ss) > maxStatusItems {
+		return strings.Join(ss[:maxStatusItems], ", ") + fmt.Sprintf(", and %d more", len(ss)-maxStatusItems)
+	}
 	switch len(ss) {
 	case 0:
 		return ""
@@ -1392,6 +2872,15 @@ func humanReadableJoin(ss []string) string {
 	}
 }
 
+// boundedJoin joins the items with sep. At most maxStatusItems items are included; the rest are summarized
+// as "and N more".
+func boundedJoin(ss []string, sep string) string {
+	if len(ss) > maxStatusItems {
+		return strings.Join(ss[:maxStatusItems], sep) + fmt.Sprintf("%sand %d more", sep, len(ss)-maxStatusItems)
+	}
+	return strings.Join(ss, sep)
+}
+
 // NamespaceNameLabel represents that label added automatically to namespaces is newer Kubernetes clusters
 const NamespaceNameLabel = "kubernetes.io/metadata.name"
 
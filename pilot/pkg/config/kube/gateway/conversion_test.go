@@ -15,20 +15,34 @@
 package gateway
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats/view"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	"sigs.k8s.io/yaml"
 
+	istio "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/model/kstatus"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
@@ -36,8 +50,12 @@ import (
 	"istio.io/istio/pilot/test/util"
 	"istio.io/istio/pkg/cluster"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
 	crdvalidation "istio.io/istio/pkg/config/crd"
+	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/config/validation"
+	"istio.io/istio/pkg/config/xds"
 	"istio.io/istio/pkg/test"
 )
 
@@ -53,12 +71,19 @@ func TestConvertResources(t *testing.T) {
 		{"weighted"},
 		{"zero"},
 		{"mesh"},
+		{"mesh-gateway"},
 		{"invalid"},
 		{"multi-gateway"},
 		{"delegated"},
 		{"route-binding"},
 		{"reference-policy-tls"},
+		{"reference-policy-backend"},
 		{"serviceentry"},
+		{"skip"},
+		{"https-redirect"},
+		{"local-rate-limit"},
+		{"address"},
+		{"istio-gateway"},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -96,25 +121,45 @@ func TestConvertResources(t *testing.T) {
 				Ports:    ports,
 				Hostname: "example.com",
 			}
+			// The Services provisioned for managed Gateways, which were assigned an external address
+			managedSvc := func(name string) *model.Service {
+				return &model.Service{
+					Attributes: model.ServiceAttributes{
+						Name:      name,
+						Namespace: "istio-system",
+						ClusterExternalAddresses: model.AddressMap{
+							Addresses: map[cluster.ID][]string{
+								"Kubernetes": {"1.2.3.4"},
+							},
+						},
+					},
+					Ports:    ports,
+					Hostname: host.Name(name + ".istio-system.svc.domain.suffix"),
+				}
+			}
+			requestedSvc, assignedSvc := managedSvc("requested-address"), managedSvc("assigned-address")
 			cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{
-				Services: []*model.Service{ingressSvc, altIngressSvc},
+				Services: []*model.Service{ingressSvc, altIngressSvc, requestedSvc, assignedSvc},
 				Instances: []*model.ServiceInstance{
 					{Service: ingressSvc, ServicePort: ingressSvc.Ports[0], Endpoint: &model.IstioEndpoint{EndpointPort: 8080}},
 					{Service: ingressSvc, ServicePort: ingressSvc.Ports[1], Endpoint: &model.IstioEndpoint{}},
 					{Service: altIngressSvc, ServicePort: altIngressSvc.Ports[0], Endpoint: &model.IstioEndpoint{}},
 					{Service: altIngressSvc, ServicePort: altIngressSvc.Ports[1], Endpoint: &model.IstioEndpoint{}},
+					{Service: requestedSvc, ServicePort: requestedSvc.Ports[0], Endpoint: &model.IstioEndpoint{}},
+					{Service: assignedSvc, ServicePort: assignedSvc.Ports[0], Endpoint: &model.IstioEndpoint{}},
 				},
 			},
 			)
 			kr := splitInput(input)
 			kr.Context = model.NewGatewayContext(cg.PushContext())
 			output := convertResources(kr)
-			output.AllowedReferences = nil       // Not tested here
-			output.ReferencedNamespaceKeys = nil // Not tested here
+			output.AllowedReferences = nil            // Not tested here
+			output.ReferencedNamespaceSelectors = nil // Not tested here
 
 			goldenFile := fmt.Sprintf("testdata/%s.yaml.golden", tt.name)
 			if util.Refresh() {
 				res := append(output.Gateway, output.VirtualService...)
+				res = append(res, output.EnvoyFilter...)
 				if err := os.WriteFile(goldenFile, marshalYaml(t, res), 0o644); err != nil {
 					t.Fatal(err)
 				}
@@ -142,6 +187,77 @@ func TestConvertResources(t *testing.T) {
 	}
 }
 
+func TestConvertResourcesStatusUnchanged(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	for _, name := range []string{"http", "tcp", "tls", "invalid", "multi-gateway", "route-binding"} {
+		t.Run(name, func(t *testing.T) {
+			input := readConfig(t, fmt.Sprintf("testdata/%s.yaml", name), validator)
+			cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+			kr := splitInput(input)
+			kr.Context = model.NewGatewayContext(cg.PushContext())
+			convertResources(kr)
+
+			// Convert again, starting from the status written by the first conversion, as the controller
+			// does when the status is read back from the cluster.
+			for _, cfgs := range [][]config.Config{kr.GatewayClass, kr.Gateway, kr.HTTPRoute, kr.TLSRoute, kr.TCPRoute} {
+				for i := range cfgs {
+					cfgs[i].Status = kstatus.Wrap(cfgs[i].Status.(*kstatus.WrappedStatus).Unwrap())
+				}
+			}
+			convertResources(kr)
+			for _, cfgs := range [][]config.Config{kr.GatewayClass, kr.Gateway, kr.HTTPRoute, kr.TLSRoute, kr.TCPRoute} {
+				for _, c := range cfgs {
+					if c.Status.(*kstatus.WrappedStatus).Dirty {
+						t.Errorf("status of %s %s/%s was modified by an unchanged conversion", c.GroupVersionKind.Kind, c.Namespace, c.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConvertResourcesZeroWeightFilters(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	input := readConfig(t, "testdata/weighted.yaml", validator)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	kr := splitInput(input)
+	kr.Context = model.NewGatewayContext(cg.PushContext())
+	route := kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec)
+	rule := route.Rules[len(route.Rules)-1]
+	// Raising the weight applies the filters of the backend, and lowering it back ignores them again.
+	for _, weight := range []int32{0, 50, 0} {
+		weight := weight
+		rule.BackendRefs[1].Weight = &weight
+		kr.HTTPRoute[0].Status = kstatus.Wrap(kr.HTTPRoute[0].Status.(*kstatus.WrappedStatus).Unwrap())
+		output := convertResources(kr)
+
+		var destinations []*istio.HTTPRouteDestination
+		for _, vs := range output.VirtualService {
+			for _, r := range vs.Spec.(*istio.VirtualService).Http {
+				if strings.HasPrefix(r.Match[0].Uri.GetRegex(), "/zero-filters") {
+					destinations = r.Route
+				}
+			}
+		}
+		status := kr.HTTPRoute[0].Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.HTTPRouteStatus)
+		accepted := kstatus.GetCondition(status.Parents[0].Conditions, string(k8s.ConditionRouteAccepted))
+		if accepted.Status != metav1.ConditionTrue {
+			t.Fatalf("weight %d: expected route to be accepted, got %v", weight, accepted.Message)
+		}
+		warned := strings.Contains(accepted.Message, "httpbin-canary:80")
+		if weight == 0 {
+			if len(destinations) != 1 || !warned {
+				t.Fatalf("weight %d: expected canary to be ignored with a warning, got %d destinations and message %q",
+					weight, len(destinations), accepted.Message)
+			}
+			continue
+		}
+		if len(destinations) != 2 || destinations[1].Headers == nil || warned {
+			t.Fatalf("weight %d: expected canary filters to be applied, got %v and message %q", weight, destinations, accepted.Message)
+		}
+	}
+}
+
 func getStatus(t test.Failer, acfgs ...[]config.Config) []byte {
 	cfgs := []config.Config{}
 	for _, cl := range acfgs {
@@ -166,6 +282,7 @@ func splitOutput(configs []config.Config) OutputResources {
 	out := OutputResources{
 		Gateway:        []config.Config{},
 		VirtualService: []config.Config{},
+		EnvoyFilter:    []config.Config{},
 	}
 	for _, c := range configs {
 		c.Domain = "domain.suffix"
@@ -174,6 +291,8 @@ func splitOutput(configs []config.Config) OutputResources {
 			out.Gateway = append(out.Gateway, c)
 		case gvk.VirtualService:
 			out.VirtualService = append(out.VirtualService, c)
+		case gvk.EnvoyFilter:
+			out.EnvoyFilter = append(out.EnvoyFilter, c)
 		}
 	}
 	return out
@@ -197,6 +316,8 @@ func splitInput(configs []config.Config) *KubernetesResources {
 			out.TLSRoute = append(out.TLSRoute, c)
 		case gvk.ReferencePolicy:
 			out.ReferencePolicy = append(out.ReferencePolicy, c)
+		case gvk.Gateway:
+			out.IstioGateway = append(out.IstioGateway, c)
 		}
 	}
 	out.Namespaces = map[string]*corev1.Namespace{}
@@ -301,6 +422,97 @@ func TestStandardizeWeight(t *testing.T) {
 	}
 }
 
+func TestBuildHTTPDestinationInvalidBackends(t *testing.T) {
+	weight := func(w int32) *int32 { return &w }
+	port := func(p int) *k8s.PortNumber {
+		pn := k8s.PortNumber(p)
+		return &pn
+	}
+	kind := func(k string) *k8s.Kind {
+		kk := k8s.Kind(k)
+		return &kk
+	}
+	backend := func(name string, p *k8s.PortNumber, k *k8s.Kind, w *int32) k8s.HTTPBackendRef {
+		return k8s.HTTPBackendRef{BackendRef: k8s.BackendRef{
+			BackendObjectReference: k8s.BackendObjectReference{Name: k8s.ObjectName(name), Port: p, Kind: k},
+			Weight:                 w,
+		}}
+	}
+	tests := []struct {
+		name    string
+		refs    []k8s.HTTPBackendRef
+		hosts   []string
+		weights []int32
+		percent float64
+	}{
+		{
+			name:    "all valid",
+			refs:    []k8s.HTTPBackendRef{backend("a", port(80), nil, weight(1)), backend("b", port(80), nil, weight(3))},
+			hosts:   []string{"a.ns.svc.cluster.local", "b.ns.svc.cluster.local"},
+			weights: []int32{25, 75},
+		},
+		{
+			name: "mixed",
+			refs: []k8s.HTTPBackendRef{
+				backend("a", port(80), nil, weight(2)),
+				backend("missing-port", nil, nil, weight(1)),
+				backend("b", port(80), nil, weight(1)),
+			},
+			hosts:   []string{"a.ns.svc.cluster.local", "b.ns.svc.cluster.local"},
+			weights: []int32{67, 33},
+			percent: 25,
+		},
+		{
+			name:    "single valid",
+			refs:    []k8s.HTTPBackendRef{backend("a", port(80), nil, weight(1)), backend("bucket", nil, kind("GcsBucket"), weight(1))},
+			hosts:   []string{"a.ns.svc.cluster.local"},
+			weights: []int32{0},
+			percent: 50,
+		},
+		{
+			name:    "invalid zero weight",
+			refs:    []k8s.HTTPBackendRef{backend("a", port(80), nil, weight(1)), backend("bucket", nil, kind("GcsBucket"), weight(0))},
+			hosts:   []string{"a.ns.svc.cluster.local"},
+			weights: []int32{0},
+		},
+		{
+			name:    "all invalid",
+			refs:    []k8s.HTTPBackendRef{backend("bucket", nil, kind("GcsBucket"), nil)},
+			percent: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, invalid, err := buildHTTPDestination(tt.refs, "ns", "cluster.local", false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			hosts := []string{}
+			weights := []int32{}
+			for _, r := range res {
+				hosts = append(hosts, r.Destination.Host)
+				weights = append(weights, r.Weight)
+			}
+			if len(hosts) != len(tt.hosts) || (len(tt.hosts) > 0 && !reflect.DeepEqual(hosts, tt.hosts)) {
+				t.Errorf("got hosts %v, want %v", hosts, tt.hosts)
+			}
+			if len(tt.weights) > 0 && !reflect.DeepEqual(weights, tt.weights) {
+				t.Errorf("got weights %v, want %v", weights, tt.weights)
+			}
+			percent := 0.0
+			if invalid != nil {
+				percent = invalid.percent
+				if invalid.err == nil || invalid.err.Reason != InvalidDestination {
+					t.Errorf("got invalid backend error %v, want %v", invalid.err, InvalidDestination)
+				}
+			}
+			if percent != tt.percent {
+				t.Errorf("got invalid percent %v, want %v", percent, tt.percent)
+			}
+		})
+	}
+}
+
 func TestHumanReadableJoin(t *testing.T) {
 	tests := []struct {
 		input []string
@@ -309,6 +521,7 @@ func TestHumanReadableJoin(t *testing.T) {
 		{[]string{"a"}, "a"},
 		{[]string{"a", "b"}, "a and b"},
 		{[]string{"a", "b", "c"}, "a, b, and c"},
+		{numberedItems("svc", 22), "svc-0, svc-1, svc-2, svc-3, svc-4, svc-5, svc-6, svc-7, svc-8, svc-9, and 12 more"},
 	}
 	for _, tt := range tests {
 		t.Run(strings.Join(tt.input, "_"), func(t *testing.T) {
@@ -318,3 +531,1983 @@ func TestHumanReadableJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestBoundedJoin(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  string
+	}{
+		{"empty", nil, ""},
+		{"under limit", []string{"a", "b"}, "a; b"},
+		{"at limit", numberedItems("w", 10), "w-0; w-1; w-2; w-3; w-4; w-5; w-6; w-7; w-8; w-9"},
+		{"over limit", numberedItems("w", 22), "w-0; w-1; w-2; w-3; w-4; w-5; w-6; w-7; w-8; w-9; and 12 more"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := boundedJoin(tt.input, "; "); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	short := "Invalid listeners: [default]"
+	if got := truncateMessage(short); got != short {
+		t.Fatalf("short message should not be modified, got %v", got)
+	}
+
+	// A long warning list is summarized, but each warning may itself be long.
+	warnings := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		warnings = append(warnings, fmt.Sprintf("hostname %q not found", strings.Repeat("ü", 100)+fmt.Sprint(i)))
+	}
+	msg := fmt.Sprintf("failed to assign to any requested addresses: %s", boundedJoin(warnings, "; "))
+	got := truncateMessage(msg)
+	if len(got) > maxStatusMessageLength {
+		t.Fatalf("message too long: %d", len(got))
+	}
+	if !strings.HasSuffix(got, truncatedMessageSuffix) {
+		t.Fatalf("expected truncation suffix, got %v", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("truncated message is not valid UTF-8: %v", got)
+	}
+	// Truncation must be deterministic
+	if again := truncateMessage(msg); again != got {
+		t.Fatalf("truncation is not deterministic")
+	}
+}
+
+func numberedItems(prefix string, n int) []string {
+	items := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return items
+}
+
+func TestIntersectHostnames(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  []string
+		parent []string
+		want   []string
+	}{
+		{"no parent hostnames", []string{"foo.example.com"}, nil, []string{"foo.example.com"}},
+		{"wildcard route", []string{"*"}, []string{"*/*.example.com"}, []string{"*.example.com"}},
+		{"wildcard parent", []string{"foo.example.com"}, []string{"*/*"}, []string{"foo.example.com"}},
+		{"narrow route", []string{"foo.example.com", "bar.other.com"}, []string{"*/*.example.com"}, []string{"foo.example.com"}},
+		{"namespace filtered", []string{"*"}, []string{"other/a.example.com", "ns/b.example.com"}, []string{"b.example.com"}},
+		{"deduplicated", []string{"*"}, []string{"*/a.example.com", "ns/a.example.com"}, []string{"a.example.com"}},
+		{
+			"collapsed to wildcard",
+			[]string{"a.example.com", "*.example.com", "b.example.com", "*.sub.example.com", "c.other.com"},
+			[]string{"*/*.example.com"},
+			[]string{"*.example.com"},
+		},
+		{"wildcard parent label match", []string{"foo.bar.example.com", "example.com"}, []string{"*/*.example.com"}, []string{"foo.bar.example.com"}},
+		{"wildcard route narrowed by wildcard parent", []string{"*.com"}, []string{"*/*.apple.com"}, []string{"*.apple.com"}},
+		{"wildcard parent narrowed by wildcard route", []string{"*.apple.com"}, []string{"*/*.com"}, []string{"*.apple.com"}},
+		{
+			"collapsed to listener wildcard",
+			[]string{"*"},
+			[]string{"*/a.example.com", "*/*.example.com", "*/b.other.com"},
+			[]string{"*.example.com", "b.other.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intersectHostnames(tt.route, tt.parent, "ns"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferenceAllowedHostnames(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    []k8s.Hostname
+		parent   string
+		expected bool
+	}{
+		{"exact match", []k8s.Hostname{"foo.example.com"}, "foo.example.com", true},
+		{"exact mismatch", []k8s.Hostname{"foo.example.com"}, "bar.example.com", false},
+		{"exact parent suffix mismatch", []k8s.Hostname{"foo.example.com"}, "example.com", false},
+		{"wildcard parent does not match apex", []k8s.Hostname{"example.com"}, "*.example.com", false},
+		{"wildcard route does not match apex", []k8s.Hostname{"*.example.com"}, "example.com", false},
+		{"wildcard parent matches one label", []k8s.Hostname{"foo.example.com"}, "*.example.com", true},
+		{"wildcard parent matches multiple labels", []k8s.Hostname{"foo.bar.example.com"}, "*.example.com", true},
+		{"wildcard route matches multiple labels", []k8s.Hostname{"*.example.com"}, "foo.bar.example.com", true},
+		{"wildcard parent matches whole labels only", []k8s.Hostname{"fooexample.com"}, "*.example.com", false},
+		{"wildcard subset", []k8s.Hostname{"*.apple.com"}, "*.com", true},
+		{"wildcard superset", []k8s.Hostname{"*.com"}, "*.apple.com", true},
+		{"wildcard mismatch", []k8s.Hostname{"*.example.com"}, "*.example.net", false},
+		{"any route hostname", nil, "foo.example.com", true},
+		{"one of the route hostnames", []k8s.Hostname{"foo.example.net", "foo.example.com"}, "*.example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &parentInfo{
+				Hostnames:        []string{"*/" + tt.parent},
+				OriginalHostname: tt.parent,
+			}
+			err := referenceAllowed(p, gvk.HTTPRoute, gvk.KubernetesGateway, tt.route, "ns")
+			if tt.expected != (err == nil) {
+				t.Fatalf("expected allowed=%v, got error %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// naiveMatchHostnames matches every route hostname against every parent hostname.
+func naiveMatchHostnames(routeHostnames []string, parentHostnames []string, namespace string) []string {
+	res := []string{}
+	seen := sets.NewSet()
+	for _, rh := range routeHostnames {
+		for _, parentHostNamespace := range parentHostnames {
+			spl := strings.Split(parentHostNamespace, "/")
+			parentNamespace, parentHostname := spl[0], spl[1]
+			if parentNamespace != "*" && parentNamespace != namespace {
+				continue
+			}
+			var h string
+			if host.Name(rh).SubsetOf(host.Name(parentHostname)) {
+				h = rh
+			} else if host.Name(parentHostname).SubsetOf(host.Name(rh)) {
+				h = parentHostname
+			} else {
+				continue
+			}
+			if !seen.Contains(h) {
+				seen.Insert(h)
+				res = append(res, h)
+			}
+		}
+	}
+	return res
+}
+
+// manyHostnames returns n hostnames spread across a few domains, with some wildcards.
+func manyHostnames(n int) []string {
+	domains := []string{"domain.example", "sub.domain.example", "other.example", "example"}
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		d := domains[i%len(domains)]
+		if i%50 == 0 {
+			res = append(res, "*."+d)
+		} else {
+			res = append(res, fmt.Sprintf("customer-%d.%s", i, d))
+		}
+	}
+	return res
+}
+
+func TestSelectParentSections(t *testing.T) {
+	sections := map[k8s.SectionName]*parentInfo{
+		"http":      {},
+		"http-alt":  {},
+		"https":     {},
+		"conflicts": {},
+	}
+	section := func(s string) *k8s.SectionName {
+		sn := k8s.SectionName(s)
+		return &sn
+	}
+	cases := []struct {
+		name        string
+		sectionName *k8s.SectionName
+		want        []k8s.SectionName
+		wantErr     string
+	}{
+		{name: "all", want: []k8s.SectionName{"conflicts", "http", "http-alt", "https"}},
+		{name: "section", sectionName: section("https"), want: []k8s.SectionName{"https"}},
+		{name: "missing section", sectionName: section("tls"), wantErr: `sectionName "tls" not found`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectParentSections(sections, tt.sectionName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchHostnamesEquivalence(t *testing.T) {
+	routes := [][]string{
+		manyHostnames(500),
+		{"*"},
+		{"*.example", "a.domain.example", "domain.example", "*.domain.example"},
+	}
+	parents := [][]string{
+		{"*/*"},
+		{"*/*.domain.example"},
+		{"*/*.example", "ns/other.example"},
+		{"ns/customer-1.sub.domain.example", "other/*.other.example", "*/customer-2.other.example"},
+		{"*/*.sub.domain.example", "ns/*.domain.example", "*/nothing.test"},
+	}
+	for _, route := range routes {
+		for _, parent := range parents {
+			want := naiveMatchHostnames(route, parent, "ns")
+			got := matchHostnames(route, newParentHostnameIndex(parent, "ns"))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("matching %d route hostnames to %v: got %v, want %v", len(route), parent, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkRouteHostnames(b *testing.B) {
+	route := manyHostnames(500)
+	routeHostnames := make([]k8s.Hostname, 0, len(route))
+	for _, h := range route {
+		routeHostnames = append(routeHostnames, k8s.Hostname(h))
+	}
+	// Only the last route hostname is accepted, so every hostname is checked.
+	parent := &parentInfo{
+		Hostnames:        []string{"*/a.test", "*/b.test", "*/" + route[len(route)-1]},
+		OriginalHostname: "a.test",
+	}
+	parentHostnames := []string{"*/*.domain.example", "ns/*.other.example", "*/customer-3.example"}
+	b.Run("referenceAllowed", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if err := referenceAllowed(parent, gvk.HTTPRoute, gvk.KubernetesGateway, routeHostnames, "ns"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("intersectHostnames", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			intersectHostnames(route, parentHostnames, "ns")
+		}
+	})
+	b.Run("naive", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			naiveMatchHostnames(route, parentHostnames, "ns")
+		}
+	})
+}
+
+func TestRequestedAddressWarning(t *testing.T) {
+	requested := &k8s.GatewaySpec{Addresses: []k8s.GatewayAddress{{Value: "1.2.3.4"}}}
+	cases := []struct {
+		name     string
+		gw       *k8s.GatewaySpec
+		assigned []string
+		warning  bool
+	}{
+		{"no requested address", &k8s.GatewaySpec{}, []string{"1.2.3.4"}, false},
+		{"not yet assigned", requested, nil, false},
+		{"assigned", requested, []string{"1.2.3.4"}, false},
+		{"assigned among others", requested, []string{"1.2.3.4", "5.6.7.8"}, false},
+		{"other address assigned", requested, []string{"5.6.7.8"}, true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestedAddressWarning(tt.gw, tt.assigned); (got != "") != tt.warning {
+				t.Fatalf("expected warning=%v, got %q", tt.warning, got)
+			}
+		})
+	}
+}
+
+func TestRouteParentName(t *testing.T) {
+	mesh := routeParentName("route", "mesh")
+	if mesh != "route-mesh-istio-autogenerated-k8s-gateway" {
+		t.Fatalf("unexpected mesh name %v", mesh)
+	}
+	a := routeParentName("route", "ns/"+strings.Repeat("a", 200))
+	b := routeParentName("route", "ns/"+strings.Repeat("b", 200))
+	if a == b {
+		t.Fatalf("expected unique names, got %v", a)
+	}
+	if a != routeParentName("route", "ns/"+strings.Repeat("a", 200)) {
+		t.Fatalf("expected deterministic names")
+	}
+	if len(a) != len(routeParentName("route", "ns/gw")) {
+		t.Fatalf("expected bounded name length, got %v", a)
+	}
+	for _, parent := range []string{"mesh", "ns/gw"} {
+		longA := routeParentName(strings.Repeat("r", 252)+"a", parent)
+		longB := routeParentName(strings.Repeat("r", 252)+"b", parent)
+		if len(longA) > maxResourceNameLength || len(longB) > maxResourceNameLength {
+			t.Fatalf("expected names of at most %d characters, got %v", maxResourceNameLength, longA)
+		}
+		if longA == longB {
+			t.Fatalf("expected unique names for long routes, got %v", longA)
+		}
+		if longA != routeParentName(strings.Repeat("r", 252)+"a", parent) {
+			t.Fatalf("expected deterministic names for long routes")
+		}
+		if !strings.HasSuffix(longA, constants.KubernetesGatewayName) {
+			t.Fatalf("expected generated name suffix, got %v", longA)
+		}
+	}
+}
+
+func TestValidateRegexMatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		expr  string
+		valid bool
+	}{
+		{"valid", "/foo/[a-z]+", true},
+		{"unbalanced", "/foo/(bar", false},
+		{"invalid repeat", "*foo", false},
+		{"backreference", `(a)\1`, false},
+		{"too long", strings.Repeat("a", maxPathMatchLength+1), false},
+		{"max length", strings.Repeat("a", maxPathMatchLength), true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegexMatch("path", tt.expr, maxPathMatchLength)
+			if tt.valid && err != nil {
+				t.Fatalf("expected valid expression, got %v", err.Message)
+			}
+			if !tt.valid && (err == nil || err.Reason != UnsupportedValue) {
+				t.Fatalf("expected %v error, got %v", UnsupportedValue, err)
+			}
+		})
+	}
+}
+
+func TestConversionMetrics(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	kr := splitInput(readConfig(t, "testdata/http.yaml", validator))
+	kr.Context = model.NewGatewayContext(cg.PushContext())
+	missing := k8s.SectionName("missing")
+	for i := range kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).ParentRefs {
+		kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).ParentRefs[i].SectionName = &missing
+	}
+	denied := len(kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).ParentRefs)
+	output := convertResources(kr)
+
+	metric := func(name string, tags map[string]string) float64 {
+		t.Helper()
+		data, err := view.RetrieveData(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	rows:
+		for _, row := range data {
+			for _, tag := range row.Tags {
+				if tags[tag.Key.Name()] != tag.Value {
+					continue rows
+				}
+			}
+			return row.Data.(*view.LastValueData).Value
+		}
+		t.Fatalf("no %s metric with tags %v", name, tags)
+		return 0
+	}
+	expect := func(name string, tags map[string]string, want int) {
+		t.Helper()
+		if got := metric(name, tags); got != float64(want) {
+			t.Errorf("expected %s%v to be %d, got %v", name, tags, want, got)
+		}
+	}
+	expect("pilot_k8s_gateway_resources", map[string]string{"kind": gvk.HTTPRoute.Kind}, len(kr.HTTPRoute))
+	expect("pilot_k8s_gateway_resources", map[string]string{"kind": gvk.KubernetesGateway.Kind}, len(kr.Gateway))
+	expect("pilot_k8s_gateway_generated_configs", map[string]string{"kind": gvk.VirtualService.Kind}, len(output.VirtualService))
+	expect("pilot_k8s_gateway_denied_route_parents", map[string]string{"kind": gvk.HTTPRoute.Kind, "reason": deniedSection}, denied)
+
+	// Gauges are reset once the route is fixed
+	for i := range kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).ParentRefs {
+		kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).ParentRefs[i].SectionName = nil
+	}
+	convertResources(kr)
+	expect("pilot_k8s_gateway_denied_route_parents", map[string]string{"kind": gvk.HTTPRoute.Kind, "reason": deniedSection}, 0)
+}
+
+func TestDeniedReason(t *testing.T) {
+	if got := deniedReason(parentErrorf(deniedKind, "kind %v is not allowed", gvk.TCPRoute)); got != deniedKind {
+		t.Errorf("expected %v, got %v", deniedKind, got)
+	}
+	if got := deniedReason(fmt.Errorf("unknown")); got != deniedOther {
+		t.Errorf("expected %v, got %v", deniedOther, got)
+	}
+}
+
+func TestConvertResourcesInvalidRegex(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	kr := splitInput(readConfig(t, "testdata/http.yaml", validator))
+	kr.Context = model.NewGatewayContext(cg.PushContext())
+	convert := func() (OutputResources, metav1.Condition) {
+		kr.HTTPRoute[0].Status = kstatus.Wrap(kr.HTTPRoute[0].Status.(*kstatus.WrappedStatus).Unwrap())
+		output := convertResources(kr)
+		status := kr.HTTPRoute[0].Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.HTTPRouteStatus)
+		return output, kstatus.GetCondition(status.Parents[0].Conditions, string(k8s.ConditionRouteAccepted))
+	}
+	routeVirtualServices := func(output OutputResources) []config.Config {
+		var res []config.Config
+		for _, vs := range output.VirtualService {
+			if vs.Annotations[constants.InternalParentName] == "HTTPRoute/http.default" {
+				res = append(res, vs)
+			}
+		}
+		return res
+	}
+	setRegex := func(expr string) {
+		path := &kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).Rules[0].Matches[0].Path
+		regex := k8s.PathMatchRegularExpression
+		*path = &k8s.HTTPPathMatch{Type: &regex, Value: &expr}
+	}
+
+	setRegex("/get/[a-z]+")
+	good, accepted := convert()
+	if accepted.Status != metav1.ConditionTrue {
+		t.Fatalf("expected route to be accepted, got %v", accepted.Message)
+	}
+	kr.PreviousVirtualServices = good.VirtualService
+
+	setRegex("/get/(bar")
+	got, accepted := convert()
+	if accepted.Status != metav1.ConditionFalse || accepted.Reason != string(UnsupportedValue) {
+		t.Fatalf("expected %v condition, got %v: %v", UnsupportedValue, accepted.Reason, accepted.Message)
+	}
+	if !strings.Contains(accepted.Message, "rule 0") || !strings.Contains(accepted.Message, "/get/(bar") {
+		t.Fatalf("expected message to name the rule and expression, got %v", accepted.Message)
+	}
+	if diff := cmp.Diff(routeVirtualServices(good), routeVirtualServices(got)); diff != "" {
+		t.Fatalf("expected the previous VirtualServices to be kept:\n%s", diff)
+	}
+
+	// Without a previous configuration, the invalid rule is rejected
+	kr.PreviousVirtualServices = nil
+	got, accepted = convert()
+	if accepted.Reason != string(UnsupportedValue) {
+		t.Fatalf("expected %v condition, got %v: %v", UnsupportedValue, accepted.Reason, accepted.Message)
+	}
+	for _, vs := range routeVirtualServices(got) {
+		for _, r := range vs.Spec.(*istio.VirtualService).Http {
+			for _, m := range r.Match {
+				if m.Uri.GetRegex() != "" {
+					t.Fatalf("unexpected regex match %v", m.Uri.GetRegex())
+				}
+			}
+		}
+	}
+}
+
+func TestConvertResourcesResponseHeaderModifier(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	want := `filter type "ResponseHeaderModifier" is not supported by this version of the Gateway API`
+	cases := []struct {
+		name  string
+		setup func(rule *k8s.HTTPRouteRule)
+	}{
+		{
+			name: "rule filter",
+			setup: func(rule *k8s.HTTPRouteRule) {
+				rule.Filters = append(rule.Filters, k8s.HTTPRouteFilter{Type: responseHeaderModifier})
+			},
+		},
+		{
+			name: "backend filter",
+			setup: func(rule *k8s.HTTPRouteRule) {
+				rule.BackendRefs[0].Filters = append(rule.BackendRefs[0].Filters, k8s.HTTPRouteFilter{Type: responseHeaderModifier})
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := splitInput(readConfig(t, "testdata/http.yaml", validator))
+			kr.Context = model.NewGatewayContext(cg.PushContext())
+			spec := kr.HTTPRoute[0].Spec.(*k8s.HTTPRouteSpec).DeepCopy()
+			tt.setup(&spec.Rules[0])
+			kr.HTTPRoute[0].Spec = spec
+			convertResources(kr)
+			status := kr.HTTPRoute[0].Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.HTTPRouteStatus)
+			accepted := kstatus.GetCondition(status.Parents[0].Conditions, string(k8s.ConditionRouteAccepted))
+			if !strings.Contains(accepted.Message, want) {
+				t.Fatalf("expected the unsupported filter to be reported, got %v: %v", accepted.Reason, accepted.Message)
+			}
+		})
+	}
+}
+
+func TestBoundedName(t *testing.T) {
+	if got := boundedName("gw", "-istio-autogenerated-k8s-gateway-http"); got != "gw-istio-autogenerated-k8s-gateway-http" {
+		t.Fatalf("expected short names to be unchanged, got %v", got)
+	}
+	for _, tt := range []struct {
+		name   string
+		suffix string
+	}{
+		{strings.Repeat("a", 250), "-tcp-" + constants.KubernetesGatewayName},
+		{strings.Repeat("a", 240) + "." + strings.Repeat("b", 12), "-tls-" + constants.KubernetesGatewayName},
+		{"gw", "-" + constants.KubernetesGatewayName + "-" + strings.Repeat("l", 253)},
+	} {
+		got := boundedName(tt.name, tt.suffix)
+		if len(got) > maxResourceNameLength {
+			t.Fatalf("expected names of at most %d characters, got %d", maxResourceNameLength, len(got))
+		}
+		if got != boundedName(tt.name, tt.suffix) {
+			t.Fatalf("expected deterministic names")
+		}
+		if got == boundedName(tt.name+"x", tt.suffix) {
+			t.Fatalf("expected unique names, got %v", got)
+		}
+		if len(tt.suffix) < maxResourceNameLength/2 && !strings.HasSuffix(got, tt.suffix) {
+			t.Fatalf("expected suffix %v to be kept, got %v", tt.suffix, got)
+		}
+		if strings.Contains(got, ".-") || strings.Contains(got, "--") {
+			t.Fatalf("expected a valid resource name, got %v", got)
+		}
+	}
+}
+
+func TestConvertResourcesLongGatewayName(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	kr := splitInput(readConfig(t, "testdata/http.yaml", validator))
+	kr.Context = model.NewGatewayContext(cg.PushContext())
+	name := strings.Repeat("g", 253)
+	kr.Gateway[0].Name = name
+	for _, r := range kr.HTTPRoute {
+		spec := r.Spec.(*k8s.HTTPRouteSpec)
+		for i := range spec.ParentRefs {
+			spec.ParentRefs[i].Name = k8s.ObjectName(name)
+		}
+	}
+	output := convertResources(kr)
+	gateways := map[string]bool{}
+	for _, gw := range output.Gateway {
+		if len(gw.Name) > maxResourceNameLength {
+			t.Fatalf("expected Gateway names of at most %d characters, got %v", maxResourceNameLength, gw.Name)
+		}
+		gateways[gw.Namespace+"/"+gw.Name] = true
+	}
+	if len(gateways) == 0 || len(output.VirtualService) == 0 {
+		t.Fatalf("expected Gateways and VirtualServices to be generated")
+	}
+	for _, vs := range output.VirtualService {
+		if len(vs.Name) > maxResourceNameLength {
+			t.Fatalf("expected VirtualService names of at most %d characters, got %v", maxResourceNameLength, vs.Name)
+		}
+		for _, gw := range vs.Spec.(*istio.VirtualService).Gateways {
+			if !gateways[gw] {
+				t.Fatalf("VirtualService %v references unknown gateway %v", vs.Name, gw)
+			}
+		}
+	}
+}
+
+func TestBuildListenerHostname(t *testing.T) {
+	cases := []struct {
+		name     string
+		hostname *k8s.Hostname
+		valid    bool
+		hosts    []string
+		original string
+	}{
+		{"unset", nil, true, []string{"ns/*"}, "(*)"},
+		{"empty", (*k8s.Hostname)(StrPointer("")), false, nil, "(empty/invalid)"},
+		{"set", (*k8s.Hostname)(StrPointer("*.example.com")), true, []string{"ns/*.example.com"}, "*.example.com"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := config.Config{
+				Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+				Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+			}
+			l := k8s.Listener{Name: "default", Hostname: tt.hostname, Port: 80, Protocol: k8s.HTTPProtocolType}
+			server, _, ok := buildListener(&KubernetesResources{}, nil, obj, l, 0, nil)
+			if ok != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, ok)
+			}
+			if ok {
+				if diff := cmp.Diff(tt.hosts, server.Hosts); diff != "" {
+					t.Fatalf("unexpected hosts (-want +got):\n%s", diff)
+				}
+			}
+			status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+			ready := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionReady))
+			wantReason := "ListenerReady"
+			if !tt.valid {
+				wantReason = string(k8s.ListenerReasonInvalid)
+			}
+			if ready.Reason != wantReason {
+				t.Fatalf("expected Ready reason %q, got %q", wantReason, ready.Reason)
+			}
+			if got := listenerHostnameString(tt.hostname); got != tt.original {
+				t.Fatalf("expected original hostname %q, got %q", tt.original, got)
+			}
+		})
+	}
+}
+
+func TestListenerConflicts(t *testing.T) {
+	hostname := func(h string) *k8s.Hostname {
+		return (*k8s.Hostname)(StrPointer(h))
+	}
+	tls := &k8s.GatewayTLSConfig{CertificateRefs: []*k8s.SecretObjectReference{{Name: "cert"}}}
+	http := k8s.Listener{Name: "http", Port: 80, Protocol: k8s.HTTPProtocolType}
+	https := k8s.Listener{Name: "https", Port: 443, Protocol: k8s.HTTPSProtocolType, TLS: tls}
+	with := func(l k8s.Listener, name string, h *k8s.Hostname) k8s.Listener {
+		l.Name = k8s.SectionName(name)
+		l.Hostname = h
+		return l
+	}
+	onPort := func(l k8s.Listener, port k8s.PortNumber) k8s.Listener {
+		l.Port = port
+		return l
+	}
+	cases := []struct {
+		name      string
+		listeners []k8s.Listener
+		// reasons are the expected conflict reasons, indexed like listeners. An empty reason means no conflict.
+		reasons []k8s.ListenerConditionReason
+		// message, if set, is expected in the message of every conflict
+		message string
+	}{
+		{
+			name:      "distinct hostnames",
+			listeners: []k8s.Listener{with(http, "a", hostname("a.example")), with(http, "b", hostname("b.example")), http},
+			reasons:   []k8s.ListenerConditionReason{"", "", ""},
+		},
+		{
+			name:      "same hostname",
+			listeners: []k8s.Listener{with(http, "a", hostname("a.example")), with(http, "b", hostname("a.example"))},
+			reasons:   []k8s.ListenerConditionReason{"", k8s.ListenerReasonHostnameConflict},
+		},
+		{
+			name:      "both unset hostname",
+			listeners: []k8s.Listener{https, with(https, "other", nil)},
+			reasons:   []k8s.ListenerConditionReason{"", k8s.ListenerReasonHostnameConflict},
+		},
+		{
+			name: "HTTPS and TLS passthrough",
+			listeners: []k8s.Listener{
+				with(https, "https", hostname("a.example")),
+				{Name: "tls", Port: 443, Protocol: k8s.TLSProtocolType, Hostname: hostname("b.example"), TLS: tls},
+			},
+			reasons: []k8s.ListenerConditionReason{"", ""},
+		},
+		{
+			name:      "HTTPS on HTTP port",
+			listeners: []k8s.Listener{http, onPort(https, 80)},
+			reasons:   []k8s.ListenerConditionReason{"", k8s.ListenerReasonProtocolConflict},
+		},
+		{
+			name:      "HTTP on HTTPS port",
+			listeners: []k8s.Listener{onPort(https, 80), http},
+			reasons:   []k8s.ListenerConditionReason{k8s.ListenerReasonProtocolConflict, ""},
+		},
+		{
+			name: "TCP",
+			listeners: []k8s.Listener{
+				{Name: "tcp", Port: 9000, Protocol: k8s.TCPProtocolType},
+				{Name: "other", Port: 9000, Protocol: k8s.TCPProtocolType},
+			},
+			reasons: []k8s.ListenerConditionReason{k8s.ListenerReasonHostnameConflict, ""},
+			message: `port 9000 is used by TCP listener "other"; TCP listeners cannot be told apart on a shared port`,
+		},
+		{
+			name: "TCP on HTTP port",
+			listeners: []k8s.Listener{
+				http,
+				{Name: "tcp", Port: 80, Protocol: k8s.TCPProtocolType},
+			},
+			reasons: []k8s.ListenerConditionReason{"", k8s.ListenerReasonProtocolConflict},
+			message: "protocol TCP cannot share a port with protocol HTTP",
+		},
+		{
+			name:      "lowest name wins",
+			listeners: []k8s.Listener{with(http, "b", hostname("a.example")), with(http, "a", hostname("a.example"))},
+			reasons:   []k8s.ListenerConditionReason{k8s.ListenerReasonHostnameConflict, ""},
+		},
+		{
+			name:      "different ports",
+			listeners: []k8s.Listener{http, https, with(onPort(http, 8080), "other", nil)},
+			reasons:   []k8s.ListenerConditionReason{"", "", ""},
+		},
+		{
+			name: "conflicted listener does not conflict",
+			listeners: []k8s.Listener{
+				with(http, "a", hostname("a.example")),
+				{Name: "tcp", Port: 80, Protocol: k8s.TCPProtocolType},
+				with(http, "b", hostname("b.example")),
+			},
+			reasons: []k8s.ListenerConditionReason{"", k8s.ListenerReasonProtocolConflict, ""},
+		},
+		{
+			name:      "unsupported protocol does not conflict",
+			listeners: []k8s.Listener{{Name: "udp", Port: 80, Protocol: k8s.UDPProtocolType}, http},
+			reasons:   []k8s.ListenerConditionReason{"", ""},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := listenerConflicts(tt.listeners)
+			for i, want := range tt.reasons {
+				got := ""
+				if conflicts[i] != nil {
+					got = conflicts[i].Reason
+				}
+				if got != string(want) {
+					t.Errorf("listener %v: expected conflict %q, got %q", tt.listeners[i].Name, want, got)
+				}
+				if conflicts[i] != nil && !strings.Contains(conflicts[i].Message, tt.message) {
+					t.Errorf("listener %v: expected message %q, got %q", tt.listeners[i].Name, tt.message, conflicts[i].Message)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildListenerConflict(t *testing.T) {
+	obj := config.Config{
+		Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+		Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+	}
+	l := k8s.Listener{Name: "default", Port: 80, Protocol: k8s.HTTPProtocolType}
+	conflict := &ConfigError{Reason: string(k8s.ListenerReasonHostnameConflict), Message: "conflict"}
+	if _, _, ok := buildListener(&KubernetesResources{}, nil, obj, l, 0, conflict); ok {
+		t.Fatalf("expected conflicted listener to be invalid")
+	}
+	status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+	conflicted := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionConflicted))
+	if conflicted.Status != metav1.ConditionTrue || conflicted.Reason != string(k8s.ListenerReasonHostnameConflict) {
+		t.Fatalf("expected Conflicted to be True with reason HostnameConflict, got %v: %v", conflicted.Status, conflicted.Reason)
+	}
+	ready := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionReady))
+	if ready.Status != metav1.ConditionFalse || ready.Reason != string(k8s.ListenerReasonInvalid) {
+		t.Fatalf("expected Ready to be False with reason Invalid, got %v: %v", ready.Status, ready.Reason)
+	}
+}
+
+func TestBuildListenerProtocol(t *testing.T) {
+	mode := func(m k8s.TLSModeType) *k8s.TLSModeType {
+		return &m
+	}
+	terminate := &k8s.GatewayTLSConfig{
+		Mode:            mode(k8s.TLSModeTerminate),
+		CertificateRefs: []*k8s.SecretObjectReference{{Name: "cert"}},
+	}
+	passthrough := &k8s.GatewayTLSConfig{Mode: mode(k8s.TLSModePassthrough)}
+	cases := []struct {
+		name     string
+		protocol k8s.ProtocolType
+		tls      *k8s.GatewayTLSConfig
+		port     k8s.PortNumber
+		// other is an additional listener of the Gateway
+		other *k8s.Listener
+		valid bool
+	}{
+		{name: "HTTP", protocol: k8s.HTTPProtocolType, port: 80, valid: true},
+		{name: "HTTP with tls", protocol: k8s.HTTPProtocolType, tls: terminate, port: 80},
+		{name: "HTTPS terminate", protocol: k8s.HTTPSProtocolType, tls: terminate, port: 443, valid: true},
+		{name: "HTTPS default mode", protocol: k8s.HTTPSProtocolType, tls: &k8s.GatewayTLSConfig{
+			CertificateRefs: []*k8s.SecretObjectReference{{Name: "cert"}},
+		}, port: 443, valid: true},
+		{name: "HTTPS without tls", protocol: k8s.HTTPSProtocolType, port: 443},
+		{name: "HTTPS passthrough", protocol: k8s.HTTPSProtocolType, tls: passthrough, port: 443},
+		{name: "TLS passthrough", protocol: k8s.TLSProtocolType, tls: passthrough, port: 443, valid: true},
+		{name: "TLS terminate", protocol: k8s.TLSProtocolType, tls: terminate, port: 443, valid: true},
+		{name: "TLS without tls", protocol: k8s.TLSProtocolType, port: 443},
+		{name: "TCP", protocol: k8s.TCPProtocolType, port: 9000, valid: true},
+		{name: "TCP with tls", protocol: k8s.TCPProtocolType, tls: passthrough, port: 9000},
+		{name: "UDP", protocol: k8s.UDPProtocolType, port: 53},
+		{name: "unknown", protocol: "example.com/custom", port: 80},
+		{
+			name: "HTTPS and TLS passthrough on same port", protocol: k8s.HTTPSProtocolType, tls: terminate, port: 443,
+			other: &k8s.Listener{Name: "passthrough", Port: 443, Protocol: k8s.TLSProtocolType, TLS: passthrough},
+			valid: true,
+		},
+		{
+			name: "HTTPS with HTTP on another port", protocol: k8s.HTTPSProtocolType, tls: terminate, port: 443,
+			other: &k8s.Listener{Name: "http", Port: 80, Protocol: k8s.HTTPProtocolType},
+			valid: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			l := k8s.Listener{Name: "default", Port: tt.port, Protocol: tt.protocol, TLS: tt.tls}
+			spec := &k8s.GatewaySpec{Listeners: []k8s.Listener{l}}
+			if tt.other != nil {
+				spec.Listeners = append(spec.Listeners, *tt.other)
+			}
+			obj := config.Config{
+				Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+				Spec:   spec,
+				Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+			}
+			server, _, ok := buildListener(&KubernetesResources{}, nil, obj, l, 0, nil)
+			if ok != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, ok)
+			}
+			if ok && server.Port.Protocol != string(tt.protocol) {
+				t.Fatalf("expected protocol %v, got %v", tt.protocol, server.Port.Protocol)
+			}
+			status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+			detached := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionDetached))
+			wantReason, wantStatus := "ListenerReady", metav1.ConditionFalse
+			if !tt.valid {
+				wantReason, wantStatus = string(k8s.ListenerReasonUnsupportedProtocol), metav1.ConditionTrue
+			}
+			if detached.Reason != wantReason || detached.Status != wantStatus {
+				t.Fatalf("expected Detached %v with reason %q, got %v with reason %q: %v",
+					wantStatus, wantReason, detached.Status, detached.Reason, detached.Message)
+			}
+		})
+	}
+}
+
+func TestBuildListenerUDP(t *testing.T) {
+	l := k8s.Listener{Name: "dns", Port: 53, Protocol: k8s.UDPProtocolType}
+	obj := config.Config{
+		Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+		Spec:   &k8s.GatewaySpec{Listeners: []k8s.Listener{l}},
+		Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+	}
+	if _, _, ok := buildListener(&KubernetesResources{}, nil, obj, l, 0, nil); ok {
+		t.Fatalf("expected UDP listener to be rejected")
+	}
+	status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+	detached := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionDetached))
+	if detached.Status != metav1.ConditionTrue || detached.Reason != string(k8s.ListenerReasonUnsupportedProtocol) {
+		t.Fatalf("expected Detached with reason UnsupportedProtocol, got %v with reason %q", detached.Status, detached.Reason)
+	}
+	if want := "protocol UDP is not supported; Istio gateways do not proxy UDP traffic"; detached.Message != want {
+		t.Fatalf("expected message %q, got %q", want, detached.Message)
+	}
+	if kinds := status.Listeners[0].SupportedKinds; len(kinds) != 0 {
+		t.Fatalf("expected no supported kinds, got %v", kinds)
+	}
+}
+
+func TestBuildListenerCertificateReferences(t *testing.T) {
+	policies := AllowedReferences{
+		{Kind: gvk.KubernetesGateway, Namespace: "ns"}: {
+			{Kind: gvk.Secret, Namespace: "allowed"}: {AllowAll: true, AllowedNames: sets.NewSet()},
+			{Kind: gvk.Secret, Namespace: "named"}:   {AllowedNames: sets.NewSet("cert")},
+		},
+	}
+	cases := []struct {
+		name       string
+		namespace  string
+		references AllowedReferences
+		credential string
+	}{
+		{name: "same namespace", credential: "kubernetes-gateway://ns/cert"},
+		{name: "same namespace explicitly", namespace: "ns", credential: "kubernetes-gateway://ns/cert"},
+		{name: "same namespace without policies", namespace: "ns", references: nil, credential: "kubernetes-gateway://ns/cert"},
+		{name: "allowed", namespace: "allowed", references: policies, credential: "kubernetes-gateway://allowed/cert"},
+		{name: "allowed by name", namespace: "named", references: policies, credential: "kubernetes-gateway://named/cert"},
+		{name: "denied", namespace: "other", references: policies},
+		{name: "denied without policies", namespace: "allowed"},
+		{
+			name: "denied for other namespaces", namespace: "allowed",
+			references: AllowedReferences{{Kind: gvk.KubernetesGateway, Namespace: "other"}: policies[Reference{
+				Kind: gvk.KubernetesGateway, Namespace: "ns",
+			}]},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := &k8s.SecretObjectReference{Name: "cert"}
+			if tt.namespace != "" {
+				ref.Namespace = (*k8s.Namespace)(StrPointer(tt.namespace))
+			}
+			l := k8s.Listener{
+				Name:     "default",
+				Port:     443,
+				Protocol: k8s.HTTPSProtocolType,
+				TLS:      &k8s.GatewayTLSConfig{CertificateRefs: []*k8s.SecretObjectReference{ref}},
+			}
+			obj := config.Config{
+				Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+				Spec:   &k8s.GatewaySpec{Listeners: []k8s.Listener{l}},
+				Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+			}
+			server, _, ok := buildListener(&KubernetesResources{}, tt.references, obj, l, 0, nil)
+			status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+			resolved := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionResolvedRefs))
+			if tt.credential == "" {
+				if ok {
+					t.Fatalf("expected the reference to be denied, got %v", server.Tls.CredentialName)
+				}
+				if resolved.Status != metav1.ConditionFalse || resolved.Reason != string(k8s.ListenerReasonRefNotPermitted) {
+					t.Fatalf("expected ResolvedRefs false with reason RefNotPermitted, got %v with reason %q", resolved.Status, resolved.Reason)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected the reference to be allowed: %v", resolved.Message)
+			}
+			if server.Tls.CredentialName != tt.credential {
+				t.Fatalf("expected credential %q, got %q", tt.credential, server.Tls.CredentialName)
+			}
+			if resolved.Status != metav1.ConditionTrue {
+				t.Fatalf("expected ResolvedRefs true, got %v with reason %q", resolved.Status, resolved.Reason)
+			}
+		})
+	}
+}
+
+func TestBuildListenerMultipleCertificateReferences(t *testing.T) {
+	policies := AllowedReferences{
+		{Kind: gvk.KubernetesGateway, Namespace: "ns"}: {
+			{Kind: gvk.Secret, Namespace: "allowed"}: {AllowAll: true, AllowedNames: sets.NewSet()},
+		},
+	}
+	ref := func(name, namespace string) *k8s.SecretObjectReference {
+		r := &k8s.SecretObjectReference{Name: k8s.ObjectName(name)}
+		if namespace != "" {
+			r.Namespace = (*k8s.Namespace)(StrPointer(namespace))
+		}
+		return r
+	}
+	cases := []struct {
+		name       string
+		refs       []*k8s.SecretObjectReference
+		credential string
+		// served are all the credentials served, if there are more than the credential
+		served []string
+		// resolvedReason is the reason of a false ResolvedRefs condition, or empty if it is expected to be true
+		resolvedReason k8s.ListenerConditionReason
+		ready          string
+	}{
+		{
+			name:       "all valid",
+			refs:       []*k8s.SecretObjectReference{ref("rsa", ""), ref("ecdsa", "allowed")},
+			credential: "kubernetes-gateway://ns/rsa",
+			served:     []string{"kubernetes-gateway://ns/rsa", "kubernetes-gateway://allowed/ecdsa"},
+			ready:      "No errors found",
+		},
+		{
+			name:           "first denied",
+			refs:           []*k8s.SecretObjectReference{ref("rsa", "other"), ref("ecdsa", "")},
+			credential:     "kubernetes-gateway://ns/ecdsa",
+			resolvedReason: k8s.ListenerReasonRefNotPermitted,
+			ready:          "No errors found",
+		},
+		{
+			name: "first invalid",
+			refs: []*k8s.SecretObjectReference{
+				{Name: "rsa", Kind: (*k8s.Kind)(StrPointer("ConfigMap"))},
+				ref("ecdsa", "allowed"),
+			},
+			credential:     "kubernetes-gateway://allowed/ecdsa",
+			resolvedReason: k8s.ListenerReasonInvalidCertificateRef,
+			ready:          "No errors found",
+		},
+		{
+			name:           "empty reference",
+			refs:           []*k8s.SecretObjectReference{nil, ref("ecdsa", "")},
+			credential:     "kubernetes-gateway://ns/ecdsa",
+			resolvedReason: k8s.ListenerReasonInvalidCertificateRef,
+			ready:          "No errors found",
+		},
+		{
+			name:           "all denied",
+			refs:           []*k8s.SecretObjectReference{ref("rsa", "other"), ref("ecdsa", "other")},
+			resolvedReason: k8s.ListenerReasonRefNotPermitted,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			l := k8s.Listener{
+				Name:     "default",
+				Port:     443,
+				Protocol: k8s.HTTPSProtocolType,
+				TLS:      &k8s.GatewayTLSConfig{CertificateRefs: tt.refs},
+			}
+			obj := config.Config{
+				Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+				Spec:   &k8s.GatewaySpec{Listeners: []k8s.Listener{l}},
+				Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+			}
+			server, creds, ok := buildListener(&KubernetesResources{}, policies, obj, l, 0, nil)
+			status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+			resolved := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionResolvedRefs))
+			ready := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionReady))
+			if tt.resolvedReason == "" {
+				if resolved.Status != metav1.ConditionTrue {
+					t.Fatalf("expected ResolvedRefs true, got %v: %v", resolved.Status, resolved.Message)
+				}
+			} else if resolved.Status != metav1.ConditionFalse || resolved.Reason != string(tt.resolvedReason) {
+				t.Fatalf("expected ResolvedRefs false with reason %v, got %v with reason %q", tt.resolvedReason, resolved.Status, resolved.Reason)
+			}
+			if tt.credential == "" {
+				if ok {
+					t.Fatalf("expected the listener to be rejected, got %v", server.Tls.CredentialName)
+				}
+				if ready.Status != metav1.ConditionFalse {
+					t.Fatalf("expected Ready false, got %v", ready.Status)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected the listener to be accepted: %v", ready.Message)
+			}
+			if server.Tls.CredentialName != tt.credential {
+				t.Fatalf("expected credential %q, got %q", tt.credential, server.Tls.CredentialName)
+			}
+			served := tt.served
+			if served == nil {
+				served = []string{tt.credential}
+			}
+			if diff := cmp.Diff(served, creds); diff != "" {
+				t.Fatalf("unexpected credentials served (-want +got):\n%s", diff)
+			}
+			if ready.Status != metav1.ConditionTrue || ready.Message != tt.ready {
+				t.Fatalf("expected Ready true with message %q, got %v with message %q", tt.ready, ready.Status, ready.Message)
+			}
+		})
+	}
+}
+
+func TestConvertReferencePolicies(t *testing.T) {
+	name := func(n k8s.ObjectName) *k8s.ObjectName {
+		return &n
+	}
+	policy := func(policyName string, to ...k8s.ReferencePolicyTo) config.Config {
+		return config.Config{
+			Meta: config.Meta{GroupVersionKind: gvk.ReferencePolicy, Name: policyName, Namespace: "ns-b"},
+			Spec: &k8s.ReferencePolicySpec{
+				From: []k8s.ReferencePolicyFrom{{
+					Group:     k8s.Group(gvk.KubernetesGateway.Group),
+					Kind:      k8s.Kind(gvk.KubernetesGateway.Kind),
+					Namespace: "ns-a",
+				}},
+				To: to,
+			},
+		}
+	}
+	secret := func(n *k8s.ObjectName) k8s.ReferencePolicyTo {
+		return k8s.ReferencePolicyTo{Group: "", Kind: k8s.Kind(gvk.Secret.Kind), Name: n}
+	}
+	cases := []struct {
+		name     string
+		policies []config.Config
+		// allowed stores the secrets in ns-b the Gateways of ns-a may reference
+		allowed []string
+	}{
+		{name: "none"},
+		{name: "all names", policies: []config.Config{policy("all", secret(nil))}, allowed: []string{"my-cert", "other-cert", "third-cert"}},
+		{name: "empty name", policies: []config.Config{policy("all", secret(name("")))}, allowed: []string{"my-cert", "other-cert", "third-cert"}},
+		{name: "named", policies: []config.Config{policy("named", secret(name("my-cert")))}, allowed: []string{"my-cert"}},
+		{
+			name:     "multiple names",
+			policies: []config.Config{policy("named", secret(name("my-cert")), secret(name("third-cert")))},
+			allowed:  []string{"my-cert", "third-cert"},
+		},
+		{
+			name:     "named and unnamed",
+			policies: []config.Config{policy("mixed", secret(name("my-cert")), secret(nil))},
+			allowed:  []string{"my-cert", "other-cert", "third-cert"},
+		},
+		{
+			name:     "named and unnamed across policies",
+			policies: []config.Config{policy("named", secret(name("my-cert"))), policy("all", secret(nil))},
+			allowed:  []string{"my-cert", "other-cert", "third-cert"},
+		},
+		{
+			name: "other kind",
+			policies: []config.Config{policy("service", k8s.ReferencePolicyTo{
+				Group: "", Kind: k8s.Kind(gvk.Service.Kind), Name: name("my-cert"),
+			})},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			refs := convertReferencePolicies(&KubernetesResources{ReferencePolicy: tt.policies})
+			from := Reference{Kind: gvk.KubernetesGateway, Namespace: "ns-a"}
+			allowed := sets.NewSet(tt.allowed...)
+			for _, n := range []string{"my-cert", "other-cert", "third-cert"} {
+				if got := refs.Allowed(from, gvk.Secret, n, "ns-b"); got != allowed.Contains(n) {
+					t.Errorf("reference to ns-b/%s: expected allowed=%v, got %v", n, allowed.Contains(n), got)
+				}
+				// Policies only apply to the namespace they are in
+				if refs.Allowed(from, gvk.Secret, n, "ns-a") {
+					t.Errorf("reference to ns-a/%s unexpectedly allowed", n)
+				}
+				if refs.Allowed(Reference{Kind: gvk.KubernetesGateway, Namespace: "ns-c"}, gvk.Secret, n, "ns-b") {
+					t.Errorf("reference from ns-c to ns-b/%s unexpectedly allowed", n)
+				}
+			}
+		})
+	}
+}
+
+// fakeCredentials serves certificates keyed by namespace/name.
+type fakeCredentials map[string][]byte
+
+func (f fakeCredentials) GetKeyAndCert(name, namespace string) ([]byte, []byte, error) {
+	cert, ok := f[namespace+"/"+name]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %v/%v not found", namespace, name)
+	}
+	return nil, cert, nil
+}
+
+func (f fakeCredentials) GetCaCert(name, namespace string) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f fakeCredentials) GetDockerCredential(name, namespace string) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f fakeCredentials) GetImagePullSecrets(serviceAccount, namespace string) ([]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f fakeCredentials) Authorize(serviceAccount, namespace string) error {
+	return nil
+}
+
+func (f fakeCredentials) AddEventHandler(func(name, namespace string)) {}
+
+// generateCert returns a PEM encoded self-signed certificate.
+func generateCert(t *testing.T, notBefore, notAfter time.Time, dnsNames ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestBuildListenerCertificateWarnings(t *testing.T) {
+	now := time.Now()
+	valid := generateCert(t, now.Add(-time.Hour), now.Add(time.Hour), "domain.example")
+	cases := []struct {
+		name     string
+		hostname string
+		cert     []byte
+		// noCredentials disables reading certificates
+		noCredentials bool
+		// warnings are substrings expected in the Ready condition message. If empty, no warnings are expected.
+		warnings []string
+	}{
+		{name: "valid", hostname: "domain.example", cert: valid},
+		{name: "no hostname", cert: valid},
+		{
+			name:     "expired",
+			hostname: "domain.example",
+			cert:     generateCert(t, now.Add(-2*time.Hour), now.Add(-time.Hour), "domain.example"),
+			warnings: []string{"certificate expired at"},
+		},
+		{
+			name:     "not yet valid",
+			hostname: "domain.example",
+			cert:     generateCert(t, now.Add(time.Hour), now.Add(2*time.Hour), "domain.example"),
+			warnings: []string{"certificate is not valid before"},
+		},
+		{
+			name:     "hostname mismatch",
+			hostname: "other.example",
+			cert:     valid,
+			warnings: []string{"does not have a subject alternative name matching other.example"},
+		},
+		{
+			name:     "wildcard certificate",
+			hostname: "foo.domain.example",
+			cert:     generateCert(t, now.Add(-time.Hour), now.Add(time.Hour), "*.domain.example"),
+		},
+		{
+			name:     "wildcard hostname",
+			hostname: "*.domain.example",
+			cert:     generateCert(t, now.Add(-time.Hour), now.Add(time.Hour), "*.domain.example"),
+		},
+		{
+			name:     "wildcard hostname with specific certificate",
+			hostname: "*.domain.example",
+			cert:     generateCert(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.domain.example"),
+			warnings: []string{"does not have a subject alternative name matching *.domain.example"},
+		},
+		{
+			name:     "multiple warnings",
+			hostname: "other.example",
+			cert:     generateCert(t, now.Add(-2*time.Hour), now.Add(-time.Hour), "domain.example"),
+			warnings: []string{"certificate expired at", "does not have a subject alternative name matching other.example"},
+		},
+		{
+			name:     "invalid certificate",
+			hostname: "domain.example",
+			cert:     []byte("not a certificate"),
+			warnings: []string{"certificate is not PEM encoded"},
+		},
+		{name: "missing secret", hostname: "domain.example"},
+		{
+			name:          "validation disabled",
+			hostname:      "other.example",
+			cert:          generateCert(t, now.Add(-2*time.Hour), now.Add(-time.Hour), "domain.example"),
+			noCredentials: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := fakeCredentials{}
+			if tt.cert != nil {
+				creds["ns/cert"] = tt.cert
+			}
+			r := &KubernetesResources{Credentials: creds}
+			if tt.noCredentials {
+				r.Credentials = nil
+			}
+			l := k8s.Listener{
+				Name:     "default",
+				Port:     443,
+				Protocol: k8s.HTTPSProtocolType,
+				TLS:      &k8s.GatewayTLSConfig{CertificateRefs: []*k8s.SecretObjectReference{{Name: "cert"}}},
+			}
+			if tt.hostname != "" {
+				l.Hostname = (*k8s.Hostname)(StrPointer(tt.hostname))
+			}
+			obj := config.Config{
+				Meta:   config.Meta{Name: "gateway", Namespace: "ns"},
+				Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+			}
+			// Certificate issues never prevent the listener from being programmed
+			if _, _, ok := buildListener(r, nil, obj, l, 0, nil); !ok {
+				t.Fatalf("expected listener to be valid")
+			}
+			status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayStatus)
+			ready := kstatus.GetCondition(status.Listeners[0].Conditions, string(k8s.ListenerConditionReady))
+			if ready.Status != metav1.ConditionTrue || ready.Reason != "ListenerReady" {
+				t.Fatalf("expected listener to be ready, got %v: %v", ready.Status, ready.Reason)
+			}
+			if len(tt.warnings) == 0 {
+				if ready.Message != "No errors found" {
+					t.Fatalf("expected no warnings, got %q", ready.Message)
+				}
+				return
+			}
+			for _, w := range tt.warnings {
+				if !strings.Contains(ready.Message, w) {
+					t.Fatalf("expected warning %q, got %q", w, ready.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowedRouteKinds(t *testing.T) {
+	group := func(g string) *k8s.Group {
+		return (*k8s.Group)(StrPointer(g))
+	}
+	httpRoute := k8s.RouteGroupKind{Group: group(gvk.HTTPRoute.Group), Kind: k8s.Kind(gvk.HTTPRoute.Kind)}
+	tcpRoute := k8s.RouteGroupKind{Group: group(gvk.TCPRoute.Group), Kind: k8s.Kind(gvk.TCPRoute.Kind)}
+	tlsRoute := k8s.RouteGroupKind{Group: group(gvk.TLSRoute.Group), Kind: k8s.Kind(gvk.TLSRoute.Kind)}
+	terminate := &k8s.GatewayTLSConfig{Mode: func() *k8s.TLSModeType { m := k8s.TLSModeTerminate; return &m }()}
+	passthrough := &k8s.GatewayTLSConfig{Mode: func() *k8s.TLSModeType { m := k8s.TLSModePassthrough; return &m }()}
+	cases := []struct {
+		name     string
+		protocol k8s.ProtocolType
+		tls      *k8s.GatewayTLSConfig
+		kinds    []k8s.RouteGroupKind
+		// routeKind is the kind of route attached to the listener; defaults to HTTPRoute
+		routeKind config.GroupVersionKind
+		supported []k8s.RouteGroupKind
+		invalid   []string
+	}{
+		{
+			name:      "unset",
+			supported: []k8s.RouteGroupKind{httpRoute},
+		},
+		{
+			name:      "empty",
+			kinds:     []k8s.RouteGroupKind{},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "explicit group",
+			kinds:     []k8s.RouteGroupKind{{Group: group(gvk.HTTPRoute.Group), Kind: "HTTPRoute"}},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "nil group",
+			kinds:     []k8s.RouteGroupKind{{Kind: "HTTPRoute"}},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "empty group",
+			kinds:     []k8s.RouteGroupKind{{Group: group(""), Kind: "HTTPRoute"}},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "foreign group",
+			kinds:     []k8s.RouteGroupKind{{Group: group("example.com"), Kind: "HTTPRoute"}},
+			supported: []k8s.RouteGroupKind{},
+			invalid:   []string{"example.com/HTTPRoute"},
+		},
+		{
+			name:      "unsupported kind",
+			kinds:     []k8s.RouteGroupKind{{Kind: "TCPRoute"}},
+			supported: []k8s.RouteGroupKind{},
+			invalid:   []string{"gateway.networking.k8s.io/TCPRoute"},
+		},
+		{
+			name: "mixed",
+			kinds: []k8s.RouteGroupKind{
+				{Group: group("example.com"), Kind: "HTTPRoute"},
+				{Group: group(""), Kind: "HTTPRoute"},
+			},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{"example.com/HTTPRoute"},
+		},
+		{
+			name:      "https narrowed to HTTPRoute",
+			protocol:  k8s.HTTPSProtocolType,
+			tls:       terminate,
+			kinds:     []k8s.RouteGroupKind{{Kind: "HTTPRoute"}},
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "https widened",
+			protocol:  k8s.HTTPSProtocolType,
+			tls:       terminate,
+			kinds:     []k8s.RouteGroupKind{{Kind: "HTTPRoute"}, {Kind: "TLSRoute"}, {Kind: "UDPRoute"}, {Kind: "TLSRoute"}},
+			routeKind: gvk.TLSRoute,
+			supported: []k8s.RouteGroupKind{httpRoute},
+			invalid:   []string{"gateway.networking.k8s.io/TLSRoute", "gateway.networking.k8s.io/UDPRoute"},
+		},
+		{
+			name:      "tls passthrough",
+			protocol:  k8s.TLSProtocolType,
+			tls:       passthrough,
+			kinds:     []k8s.RouteGroupKind{{Kind: "TLSRoute"}},
+			routeKind: gvk.TLSRoute,
+			supported: []k8s.RouteGroupKind{tlsRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "tls passthrough widened",
+			protocol:  k8s.TLSProtocolType,
+			tls:       passthrough,
+			kinds:     []k8s.RouteGroupKind{{Kind: "TCPRoute"}},
+			routeKind: gvk.TCPRoute,
+			supported: []k8s.RouteGroupKind{},
+			invalid:   []string{"gateway.networking.k8s.io/TCPRoute"},
+		},
+		{
+			name:      "tls terminate",
+			protocol:  k8s.TLSProtocolType,
+			tls:       terminate,
+			kinds:     []k8s.RouteGroupKind{},
+			routeKind: gvk.TCPRoute,
+			supported: []k8s.RouteGroupKind{tcpRoute},
+			invalid:   []string{},
+		},
+		{
+			name:      "tcp widened",
+			protocol:  k8s.TCPProtocolType,
+			kinds:     []k8s.RouteGroupKind{{Kind: "TCPRoute"}, {Kind: "HTTPRoute"}},
+			routeKind: gvk.TCPRoute,
+			supported: []k8s.RouteGroupKind{tcpRoute},
+			invalid:   []string{"gateway.networking.k8s.io/HTTPRoute"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			l := k8s.Listener{Name: "default", Port: 80, Protocol: k8s.HTTPProtocolType, TLS: tt.tls}
+			if tt.protocol != "" {
+				l.Protocol = tt.protocol
+			}
+			if tt.kinds != nil {
+				l.AllowedRoutes = &k8s.AllowedRoutes{Kinds: tt.kinds}
+			}
+			if diff := cmp.Diff(tt.supported, generateSupportedKinds(l)); diff != "" {
+				t.Fatalf("unexpected supported kinds (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.invalid, invalidRouteKinds(l)); diff != "" {
+				t.Fatalf("unexpected invalid kinds (-want +got):\n%s", diff)
+			}
+			routeKind := tt.routeKind
+			if routeKind == (config.GroupVersionKind{}) {
+				routeKind = gvk.HTTPRoute
+			}
+			allowed := false
+			for _, s := range tt.supported {
+				if string(s.Kind) == routeKind.Kind {
+					allowed = true
+				}
+			}
+			p := &parentInfo{AllowedKinds: generateSupportedKinds(l)}
+			err := referenceAllowed(p, routeKind, gvk.KubernetesGateway, nil, "default")
+			if allowed != (err == nil) {
+				t.Fatalf("expected allowed=%v, got error %v", allowed, err)
+			}
+		})
+	}
+}
+
+func TestVirtualServiceExportTo(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	convert := func() map[string][]string {
+		kr := splitInput(readConfig(t, "testdata/mesh-gateway.yaml", validator))
+		kr.Context = model.NewGatewayContext(cg.PushContext())
+		res := map[string][]string{}
+		for _, vs := range convertResources(kr).VirtualService {
+			res[vs.Name] = vs.Spec.(*istio.VirtualService).ExportTo
+		}
+		return res
+	}
+	gatewayNamespaces := []string{"default", "istio-system"}
+	cases := []struct {
+		name        string
+		exportToAll bool
+		wantGateway []string
+	}{
+		{
+			name:        "scoped",
+			wantGateway: gatewayNamespaces,
+		},
+		{
+			name:        "export to all namespaces",
+			exportToAll: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(v bool) { features.GatewayAPIExportToAllNamespaces = v }(features.GatewayAPIExportToAllNamespaces)
+			features.GatewayAPIExportToAllNamespaces = tt.exportToAll
+			want := map[string][]string{
+				// Bound to a Gateway.
+				"tcp-tcp-" + constants.KubernetesGatewayName:               tt.wantGateway,
+				"narrowed-3cfb35e7-" + constants.KubernetesGatewayName:     tt.wantGateway,
+				"gateway-only-3cfb35e7-" + constants.KubernetesGatewayName: tt.wantGateway,
+				// Bound to the mesh, which is always visible in all namespaces.
+				"narrowed-mesh-" + constants.KubernetesGatewayName:  nil,
+				"mesh-only-mesh-" + constants.KubernetesGatewayName: nil,
+			}
+			if diff := cmp.Diff(want, convert()); diff != "" {
+				t.Fatalf("exportTo diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVirtualServicePerParentRoutesNotShared(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	kr := splitInput(readConfig(t, "testdata/mesh-gateway.yaml", validator))
+	kr.Context = model.NewGatewayContext(cg.PushContext())
+	var gateway, mesh *istio.VirtualService
+	for _, vs := range convertResources(kr).VirtualService {
+		switch vs.Name {
+		case "narrowed-3cfb35e7-" + constants.KubernetesGatewayName:
+			gateway = vs.Spec.(*istio.VirtualService)
+		case "narrowed-mesh-" + constants.KubernetesGatewayName:
+			mesh = vs.Spec.(*istio.VirtualService)
+		}
+	}
+	if gateway == nil || mesh == nil {
+		t.Fatalf("expected a VirtualService per parent, got gateway=%v mesh=%v", gateway, mesh)
+	}
+	if len(gateway.Http) == 0 || len(mesh.Http) == 0 {
+		t.Fatalf("expected HTTP routes, got gateway=%v mesh=%v", gateway.Http, mesh.Http)
+	}
+	gateway.Http[0].Name = "mutated"
+	gateway.Http = append(gateway.Http[:0], &istio.HTTPRoute{Name: "appended"})
+	if mesh.Http[0].Name == "mutated" || mesh.Http[0].Name == "appended" {
+		t.Fatalf("mutating the gateway VirtualService changed the mesh VirtualService: %v", mesh.Http[0])
+	}
+}
+
+func TestGatewayNamespaces(t *testing.T) {
+	cases := []struct {
+		name     string
+		services []string
+		want     []string
+	}{
+		{
+			name: "no services",
+			want: []string{"default"},
+		},
+		{
+			name:     "cluster services",
+			services: []string{"istio-ingressgateway.istio-system.svc.cluster.local", "gw.default.svc.cluster.local"},
+			want:     []string{"default", "istio-system"},
+		},
+		{
+			name:     "external hostname",
+			services: []string{"lb.example.com", "gw.other.svc.example.com"},
+			want:     []string{"default"},
+		},
+		{
+			name:     "subdomain of a service",
+			services: []string{"a.gw.other.svc.cluster.local"},
+			want:     []string{"default"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gatewayNamespaces("default", tt.services, "cluster.local"); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertResourcesListenerOrder(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	permutations := map[string]func([]k8s.Listener) []k8s.Listener{
+		"reversed": func(l []k8s.Listener) []k8s.Listener {
+			res := make([]k8s.Listener, 0, len(l))
+			for i := len(l) - 1; i >= 0; i-- {
+				res = append(res, l[i])
+			}
+			return res
+		},
+		"rotated": func(l []k8s.Listener) []k8s.Listener {
+			return append(append([]k8s.Listener{}, l[1:]...), l[0])
+		},
+	}
+	convert := func(name string, permute func([]k8s.Listener) []k8s.Listener) []byte {
+		kr := splitInput(readConfig(t, fmt.Sprintf("testdata/%s.yaml", name), validator))
+		kr.Context = model.NewGatewayContext(cg.PushContext())
+		for _, gw := range kr.Gateway {
+			spec := gw.Spec.(*k8s.GatewaySpec)
+			if permute != nil && len(spec.Listeners) > 1 {
+				spec.Listeners = permute(spec.Listeners)
+			}
+		}
+		output := convertResources(kr)
+		return marshalYaml(t, append(output.Gateway, output.VirtualService...))
+	}
+	// invalid covers listeners conflicting on hostname and protocol.
+	for _, name := range []string{"route-binding", "multi-gateway", "http", "invalid"} {
+		want := convert(name, nil)
+		for pname, permute := range permutations {
+			t.Run(name+"/"+pname, func(t *testing.T) {
+				if diff := cmp.Diff(string(want), string(convert(name, permute))); diff != "" {
+					t.Fatalf("listener order changed the output:\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestConvertResourcesDomain(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	convert := func(name, domain string) ([]byte, OutputResources) {
+		kr := splitInput(readConfig(t, fmt.Sprintf("testdata/%s.yaml", name), validator))
+		kr.Context = model.NewGatewayContext(cg.PushContext())
+		kr.Domain = domain
+		output := convertResources(kr)
+		res := append(output.Gateway, output.VirtualService...)
+		res = append(res, output.EnvoyFilter...)
+		return marshalYaml(t, res), output
+	}
+	// Cover the managed and unmanaged Gateway services, as well as HTTP, TCP, TLS, mirror and invalid backend
+	// destinations. Inputs with user provided hostnames in the cluster domain are skipped, as those are not generated
+	// from the domain.
+	for _, name := range []string{"http", "tcp", "tls", "route-binding", "local-rate-limit", "invalid"} {
+		t.Run(name, func(t *testing.T) {
+			first, _ := convert(name, "cluster.local")
+			second, output := convert(name, "example.internal")
+			if !strings.Contains(string(first), ".svc.cluster.local") {
+				t.Fatalf("expected hosts in domain cluster.local:\n%s", first)
+			}
+			if strings.Contains(string(second), "cluster.local") {
+				t.Fatalf("hosts were not switched to domain example.internal:\n%s", second)
+			}
+			want := strings.ReplaceAll(string(first), "cluster.local", "example.internal")
+			if diff := cmp.Diff(want, string(second)); diff != "" {
+				t.Fatalf("unexpected output after changing domain:\n%s", diff)
+			}
+			for _, cfgs := range [][]config.Config{output.Gateway, output.VirtualService, output.EnvoyFilter} {
+				for _, c := range cfgs {
+					if c.Domain != "example.internal" {
+						t.Errorf("%v %s/%s has domain %q, want example.internal", c.GroupVersionKind.Kind, c.Namespace, c.Name, c.Domain)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestControllerDomainSuffix(t *testing.T) {
+	c := &Controller{domain: "cluster.local"}
+	if got := c.domainSuffix(model.NewGatewayContext(model.NewPushContext())); got != "cluster.local" {
+		t.Fatalf("got domain %q, want the controller default cluster.local", got)
+	}
+}
+
+func TestConvertResourcesMalformed(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	convert := func(t *testing.T, mutate func(kr *KubernetesResources)) OutputResources {
+		kr := splitInput(readConfig(t, "testdata/http.yaml", validator))
+		kr.Context = model.NewGatewayContext(cg.PushContext())
+		if mutate != nil {
+			mutate(kr)
+		}
+		output, err := convertResourcesSafely(kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	want := convert(t, nil)
+	gateway := func(name string, listener k8s.Listener) config.Config {
+		return config.Config{
+			Meta: config.Meta{GroupVersionKind: gvk.KubernetesGateway, Name: name, Namespace: "istio-system"},
+			Spec: &k8s.GatewaySpec{
+				GatewayClassName: "istio",
+				Listeners:        []k8s.Listener{listener},
+			},
+			Status: kstatus.Wrap(&k8s.GatewayStatus{}),
+		}
+	}
+
+	t.Run("unset path", func(t *testing.T) {
+		got := convert(t, func(kr *KubernetesResources) {
+			for _, r := range kr.HTTPRoute {
+				for _, rule := range r.Spec.(*k8s.HTTPRouteSpec).Rules {
+					for i := range rule.Matches {
+						rule.Matches[i].Path = nil
+					}
+				}
+			}
+		})
+		if len(got.VirtualService) != len(want.VirtualService) {
+			t.Fatalf("expected %d VirtualServices, got %d", len(want.VirtualService), len(got.VirtualService))
+		}
+	})
+	t.Run("empty certificate reference", func(t *testing.T) {
+		got := convert(t, func(kr *KubernetesResources) {
+			kr.Gateway = append(kr.Gateway, gateway("empty-ref", k8s.Listener{
+				Name:     "https",
+				Port:     443,
+				Protocol: k8s.HTTPSProtocolType,
+				TLS:      &k8s.GatewayTLSConfig{CertificateRefs: []*k8s.SecretObjectReference{nil}},
+			}))
+		})
+		if diff := cmp.Diff(want.Gateway, got.Gateway); diff != "" {
+			t.Fatalf("the invalid listener should not generate a Gateway:\n%s", diff)
+		}
+	})
+	t.Run("quarantined gateway", func(t *testing.T) {
+		got := convert(t, func(kr *KubernetesResources) {
+			gw := gateway("broken", k8s.Listener{Name: "http", Port: 8080, Protocol: k8s.HTTPProtocolType})
+			// Writing the status of the Gateway panics
+			gw.Status = nil
+			kr.Gateway = append(kr.Gateway, gw)
+		})
+		if diff := cmp.Diff(want.Gateway, got.Gateway); diff != "" {
+			t.Fatalf("the quarantined Gateway should be skipped:\n%s", diff)
+		}
+	})
+	t.Run("quarantined route", func(t *testing.T) {
+		got := convert(t, func(kr *KubernetesResources) {
+			kr.HTTPRoute = append(kr.HTTPRoute, config.Config{
+				Meta: config.Meta{GroupVersionKind: gvk.HTTPRoute, Name: "broken", Namespace: "default"},
+				Spec: &k8s.HTTPRouteSpec{
+					CommonRouteSpec: k8s.CommonRouteSpec{ParentRefs: []k8s.ParentRef{{Name: "gateway"}}},
+				},
+				// Writing the status of the route panics
+				Status: nil,
+			})
+		})
+		if diff := cmp.Diff(want.VirtualService, got.VirtualService); diff != "" {
+			t.Fatalf("the quarantined route should be skipped:\n%s", diff)
+		}
+	})
+}
+
+func TestPairHTTPSRedirects(t *testing.T) {
+	hostname := func(h string) *k8s.Hostname {
+		hn := k8s.Hostname(h)
+		return &hn
+	}
+	https := func(name string, h *k8s.Hostname, redirect bool) k8s.Listener {
+		tls := &k8s.GatewayTLSConfig{CertificateRefs: []*k8s.SecretObjectReference{{Name: "cert"}}}
+		if redirect {
+			tls.Options = map[k8s.AnnotationKey]k8s.AnnotationValue{HTTPSRedirectOption: "true"}
+		}
+		return k8s.Listener{Name: k8s.SectionName(name), Hostname: h, Port: 443, Protocol: k8s.HTTPSProtocolType, TLS: tls}
+	}
+	http := func(name string, h *k8s.Hostname) k8s.Listener {
+		return k8s.Listener{Name: k8s.SectionName(name), Hostname: h, Port: 80, Protocol: k8s.HTTPProtocolType}
+	}
+	cases := []struct {
+		name      string
+		listeners []k8s.Listener
+		// invalid listeners do not have a parent
+		invalid []string
+		want    []string
+	}{
+		{
+			name:      "http without hostname",
+			listeners: []k8s.Listener{http("http", nil), https("https", hostname("foo.example"), true)},
+			want:      []string{"http->https foo.example:443"},
+		},
+		{
+			name:      "same hostname",
+			listeners: []k8s.Listener{http("http", hostname("foo.example")), https("https", hostname("foo.example"), true)},
+			want:      []string{"http->https foo.example:443"},
+		},
+		{
+			name:      "different hostname",
+			listeners: []k8s.Listener{http("http", hostname("bar.example")), https("https", hostname("foo.example"), true)},
+		},
+		{
+			name:      "https without hostname",
+			listeners: []k8s.Listener{http("http", nil), https("https", nil, true)},
+			want:      []string{"http->https *:443"},
+		},
+		{
+			name:      "option not set",
+			listeners: []k8s.Listener{http("http", nil), https("https", hostname("foo.example"), false)},
+		},
+		{
+			name:      "invalid https listener",
+			listeners: []k8s.Listener{http("http", nil), https("https", hostname("foo.example"), true)},
+			invalid:   []string{"https"},
+		},
+		{
+			name: "multiple listeners",
+			listeners: []k8s.Listener{
+				http("http", nil), http("http-foo", hostname("foo.example")),
+				https("foo", hostname("foo.example"), true), https("bar", hostname("bar.example"), true),
+			},
+			want: []string{"http->bar bar.example:443", "http->foo foo.example:443", "http-foo->foo foo.example:443"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			parents := map[k8s.SectionName]*parentInfo{}
+			for _, l := range tt.listeners {
+				parents[l.Name] = &parentInfo{}
+			}
+			for _, l := range tt.invalid {
+				delete(parents, k8s.SectionName(l))
+			}
+			obj := config.Config{Meta: config.Meta{Name: "gateway", Namespace: "ns"}}
+			pairHTTPSRedirects(obj, tt.listeners, parents)
+			var got []string
+			for _, pri := range parents {
+				for _, r := range pri.HTTPSRedirects {
+					got = append(got, fmt.Sprintf("%s->%s %s:%d", r.From, r.To, r.Hostname, r.Port))
+				}
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected redirects (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLocalRateLimit(t *testing.T) {
+	validator := crdvalidation.NewIstioValidator(t)
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{})
+	convert := func(rateLimited bool) OutputResources {
+		kr := splitInput(readConfig(t, "testdata/local-rate-limit.yaml", validator))
+		kr.Context = model.NewGatewayContext(cg.PushContext())
+		if !rateLimited {
+			for _, gw := range kr.Gateway {
+				delete(gw.Annotations, LocalRateLimitAnnotation)
+			}
+		}
+		return convertResources(kr)
+	}
+	got := convert(true)
+	want := convert(false)
+
+	if len(want.EnvoyFilter) != 0 {
+		t.Fatalf("expected no EnvoyFilter without rate limits, got %v", want.EnvoyFilter)
+	}
+	if len(got.EnvoyFilter) != 1 {
+		t.Fatalf("expected a single EnvoyFilter, got %v", got.EnvoyFilter)
+	}
+	ef := got.EnvoyFilter[0]
+	if _, err := validation.ValidateEnvoyFilter(ef); err != nil {
+		t.Fatalf("invalid EnvoyFilter: %v", err)
+	}
+	for _, patch := range ef.Spec.(*istio.EnvoyFilter).ConfigPatches {
+		if _, err := xds.BuildXDSObjectFromStruct(patch.ApplyTo, patch.Patch.Value, true); err != nil {
+			t.Fatalf("invalid %v patch: %v", patch.ApplyTo, err)
+		}
+	}
+
+	// Rate limits only drop the invalid listeners; the config of the other listeners is unchanged.
+	wantGateways := map[string]config.Config{}
+	for _, gw := range want.Gateway {
+		wantGateways[gw.Name] = gw
+	}
+	gotNames := []string{}
+	for _, gw := range got.Gateway {
+		gotNames = append(gotNames, gw.Name)
+		if diff := cmp.Diff(wantGateways[gw.Name], gw); diff != "" {
+			t.Errorf("rate limits changed Gateway %v:\n%s", gw.Name, diff)
+		}
+	}
+	sort.Strings(gotNames)
+	prefix := "gateway-" + constants.KubernetesGatewayName + "-"
+	wantNames := []string{prefix + "http", prefix + "https", prefix + "shared-unlimited", prefix + "unlimited"}
+	if diff := cmp.Diff(wantNames, gotNames); diff != "" {
+		t.Fatalf("unexpected Gateways (-want +got):\n%s", diff)
+	}
+	wantRoutes := map[string]config.Config{}
+	for _, vs := range want.VirtualService {
+		wantRoutes[vs.Name] = vs
+	}
+	for _, vs := range got.VirtualService {
+		if diff := cmp.Diff(wantRoutes[vs.Name], vs); diff != "" {
+			t.Errorf("rate limits changed VirtualService %v:\n%s", vs.Name, diff)
+		}
+	}
+}
+
+func TestBuildClassParameters(t *testing.T) {
+	ns := k8s.Namespace("istio-system")
+	ref := &k8s.ParametersReference{Kind: "ConfigMap", Name: "params", Namespace: &ns}
+	key := types.NamespacedName{Name: "params", Namespace: "istio-system"}
+	configMaps := func(data map[string]string) map[types.NamespacedName]*corev1.ConfigMap {
+		return map[types.NamespacedName]*corev1.ConfigMap{key: {
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data:       data,
+		}}
+	}
+	three := int32(3)
+	cases := []struct {
+		name       string
+		ref        *k8s.ParametersReference
+		configMaps map[types.NamespacedName]*corev1.ConfigMap
+		want       classParameters
+		wantErr    string
+	}{
+		{
+			name: "no parameters",
+		},
+		{
+			name: "all parameters",
+			ref:  ref,
+			configMaps: configMaps(map[string]string{
+				classParameterServiceType: "ClusterIP",
+				classParameterReplicas:    "3",
+				classParameterProvision:   "false",
+			}),
+			want: classParameters{ServiceType: corev1.ServiceTypeClusterIP, Replicas: &three, DisableProvisioning: true},
+		},
+		{
+			name:       "empty configmap",
+			ref:        ref,
+			configMaps: configMaps(nil),
+		},
+		{
+			name:    "unsupported kind",
+			ref:     &k8s.ParametersReference{Group: "example.com", Kind: "Params", Name: "params", Namespace: &ns},
+			wantErr: "unsupported parametersRef kind",
+		},
+		{
+			name:    "missing namespace",
+			ref:     &k8s.ParametersReference{Kind: "ConfigMap", Name: "params"},
+			wantErr: "must set a namespace",
+		},
+		{
+			name:    "missing configmap",
+			ref:     ref,
+			wantErr: "not found",
+		},
+		{
+			name:       "invalid service type",
+			ref:        ref,
+			configMaps: configMaps(map[string]string{classParameterServiceType: "ExternalName"}),
+			wantErr:    "invalid serviceType",
+		},
+		{
+			name:       "invalid replicas",
+			ref:        ref,
+			configMaps: configMaps(map[string]string{classParameterReplicas: "-1"}),
+			wantErr:    "invalid replicas",
+		},
+		{
+			name:       "invalid provision",
+			ref:        ref,
+			configMaps: configMaps(map[string]string{classParameterProvision: "maybe"}),
+			wantErr:    "invalid provision",
+		},
+		{
+			name:       "unknown parameter",
+			ref:        ref,
+			configMaps: configMaps(map[string]string{"foo": "bar"}),
+			wantErr:    "unknown parameter \"foo\"",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildClassParameters(&k8s.GatewayClassSpec{ControllerName: ControllerName, ParametersRef: tt.ref}, tt.configMaps)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestGetGatewayClassesInvalidParameters(t *testing.T) {
+	ns := k8s.Namespace("istio-system")
+	obj := config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.GatewayClass,
+			Name:             DefaultClassName,
+		},
+		Spec: &k8s.GatewayClassSpec{
+			ControllerName: ControllerName,
+			ParametersRef:  &k8s.ParametersReference{Kind: "ConfigMap", Name: "missing", Namespace: &ns},
+		},
+		Status: kstatus.Wrap(&k8s.GatewayClassStatus{}),
+	}
+	classes := getGatewayClasses(&KubernetesResources{GatewayClass: []config.Config{obj}})
+	if _, f := classes[DefaultClassName]; f {
+		t.Fatalf("expected class with invalid parameters to be excluded, got %v", classes)
+	}
+	status := obj.Status.(*kstatus.WrappedStatus).Unwrap().(*k8s.GatewayClassStatus)
+	if len(status.Conditions) != 1 {
+		t.Fatalf("expected one condition, got %v", status.Conditions)
+	}
+	cond := status.Conditions[0]
+	if cond.Status != kstatus.StatusFalse || cond.Reason != string(k8s.GatewayClassReasonInvalidParameters) {
+		t.Fatalf("unexpected condition: %+v", cond)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	klabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	appsinformersv1 "k8s.io/client-go/informers/apps/v1"
@@ -104,7 +105,7 @@ func NewDeploymentController(client kube.Client) *DeploymentController {
 	client.GatewayAPIInformer().Gateway().V1alpha2().Gateways().Informer().
 		AddEventHandler(controllers.LatestVersionHandlerFuncs(controllers.EnqueueForSelf(q)))
 
-	return &DeploymentController{
+	d := &DeploymentController{
 		client:    client,
 		queue:     q,
 		templates: processTemplates(),
@@ -118,6 +119,41 @@ func NewDeploymentController(client kube.Client) *DeploymentController {
 			return err
 		},
 	}
+
+	// GatewayClasses and the ConfigMaps holding their parameters configure the generated resources, so changes
+	// re-add all Gateways of the class to the queue.
+	client.GatewayAPIInformer().Gateway().V1alpha2().GatewayClasses().Informer().
+		AddEventHandler(controllers.LatestVersionHandlerFuncs(func(o controllers.Object) {
+			d.enqueueClassGateways(o.GetName())
+		}))
+	// Use the full informer, since we are already fetching all ConfigMaps for other purposes
+	client.KubeInformer().Core().V1().ConfigMaps().Informer().
+		AddEventHandler(controllers.LatestVersionHandlerFuncs(func(o controllers.Object) {
+			classes, err := client.GatewayAPIInformer().Gateway().V1alpha2().GatewayClasses().Lister().List(klabels.Everything())
+			if err != nil {
+				return
+			}
+			for _, gwc := range classes {
+				if key := parametersConfigMap(&gwc.Spec); key != nil && key.Name == o.GetName() && key.Namespace == o.GetNamespace() {
+					d.enqueueClassGateways(gwc.Name)
+				}
+			}
+		}))
+
+	return d
+}
+
+// enqueueClassGateways adds all Gateways of a GatewayClass to the queue.
+func (d *DeploymentController) enqueueClassGateways(className string) {
+	gws, err := d.client.GatewayAPIInformer().Gateway().V1alpha2().Gateways().Lister().List(klabels.Everything())
+	if err != nil {
+		return
+	}
+	for _, gw := range gws {
+		if string(gw.Spec.GatewayClassName) == className {
+			d.queue.Add(types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace})
+		}
+	}
 }
 
 func (d *DeploymentController) Run(stop <-chan struct{}) {
@@ -167,6 +203,11 @@ func (d *DeploymentController) Reconcile(req types.NamespacedName) error {
 		return controllers.IgnoreNotFound(err)
 	}
 
+	if isSkipped(gw.Annotations) {
+		log.Debug("skip gateway with skip annotation")
+		return nil
+	}
+
 	switch gw.Spec.GatewayClassName {
 	case DefaultClassName:
 		return d.configureIstioGateway(log, *gw)
@@ -176,24 +217,40 @@ func (d *DeploymentController) Reconcile(req types.NamespacedName) error {
 }
 
 func (d *DeploymentController) configureIstioGateway(log *istiolog.Scope, gw gateway.Gateway) error {
+	class, err := d.gatewayClass(string(gw.Spec.GatewayClassName))
+	if err != nil {
+		// The GatewayClass status reports invalid parameters; we will be requeued once they are fixed
+		log.Warnf("skip gateway with invalid class parameters: %v", err)
+		return nil
+	}
 	// If user explicitly sets addresses, we are assuming they are pointing to an existing deployment.
 	// We will not manage it in this case
-	if !isManaged(&gw.Spec) {
+	if !class.managed(&gw.Spec) {
 		log.Debug("skip unmanaged gateway")
 		return nil
 	}
 	log.Info("reconciling")
 
-	if err := d.ApplyTemplate("service.yaml", serviceInput{gw, extractServicePorts(gw)}); err != nil {
+	serviceType := class.Parameters.ServiceType
+	if serviceType == "" {
+		serviceType = corev1.ServiceTypeLoadBalancer
+	}
+	if err := d.ApplyTemplate("service.yaml", serviceInput{gw, extractServicePorts(gw), serviceType}); err != nil {
 		return fmt.Errorf("update service: %v", err)
 	}
 	log.Info("service updated")
 
-	if err := d.ApplyTemplate("deployment.yaml", gw); err != nil {
+	if err := d.ApplyTemplate("deployment.yaml", deploymentInput{gw, class.Parameters.Replicas}); err != nil {
 		return fmt.Errorf("update deployment: %v", err)
 	}
 	log.Info("deployment updated")
 
+	// The Deployment is only in the informer once it has been created; until then it is assumed to be progressing
+	dep, err := d.client.KubeInformer().Apps().V1().Deployments().Lister().Deployments(gw.Namespace).Get(gw.Name)
+	if controllers.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("fetch deployment: %v", err)
+	}
+
 	gws := &gateway.Gateway{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       gvk.KubernetesGateway.Kind,
@@ -205,10 +262,7 @@ func (d *DeploymentController) configureIstioGateway(log *istiolog.Scope, gw gat
 		},
 		Status: gateway.GatewayStatus{
 			Conditions: setConditions(gw.Generation, nil, map[string]*condition{
-				string(gateway.GatewayConditionScheduled): {
-					reason:  "ResourcesAvailable",
-					message: "Deployed gateway to the cluster",
-				},
+				string(gateway.GatewayConditionScheduled): scheduledCondition(dep),
 			}),
 		},
 	}
@@ -219,6 +273,69 @@ func (d *DeploymentController) configureIstioGateway(log *istiolog.Scope, gw gat
 	return nil
 }
 
+// gatewayClass returns the settings of a GatewayClass. A class that does not exist has the default settings, as
+// the built-in class is allowed without an explicit GatewayClass.
+func (d *DeploymentController) gatewayClass(name string) (gatewayClass, error) {
+	gwc, err := d.client.GatewayAPIInformer().Gateway().V1alpha2().GatewayClasses().Lister().Get(name)
+	if controllers.IgnoreNotFound(err) != nil {
+		return gatewayClass{}, err
+	}
+	if gwc == nil {
+		return gatewayClass{}, nil
+	}
+	configMaps := map[types.NamespacedName]*corev1.ConfigMap{}
+	if key := parametersConfigMap(&gwc.Spec); key != nil {
+		cm, err := d.client.KubeInformer().Core().V1().ConfigMaps().Lister().ConfigMaps(key.Namespace).Get(key.Name)
+		if controllers.IgnoreNotFound(err) != nil {
+			return gatewayClass{}, err
+		}
+		if cm != nil {
+			configMaps[*key] = cm
+		}
+	}
+	params, err := buildClassParameters(&gwc.Spec, configMaps)
+	if err != nil {
+		return gatewayClass{}, err
+	}
+	return gatewayClass{Parameters: params}, nil
+}
+
+// scheduledCondition builds the Scheduled condition of a Gateway from the conditions of its Deployment. Provisioning
+// failures, such as an exceeded quota or a rollout that cannot make progress, are reported with the reason of the
+// Deployment condition; as Deployment updates requeue the Gateway, the condition follows the state of the Deployment.
+func scheduledCondition(dep *appsv1.Deployment) *condition {
+	if dep != nil {
+		// A replica failure is more specific than the lack of progress it usually causes, so it is reported first
+		for _, failed := range []struct {
+			t      appsv1.DeploymentConditionType
+			status corev1.ConditionStatus
+		}{
+			{appsv1.DeploymentReplicaFailure, corev1.ConditionTrue},
+			{appsv1.DeploymentProgressing, corev1.ConditionFalse},
+		} {
+			for _, c := range dep.Status.Conditions {
+				if c.Type != failed.t || c.Status != failed.status {
+					continue
+				}
+				reason := c.Reason
+				if reason == "" {
+					reason = string(c.Type)
+				}
+				return &condition{
+					error: &ConfigError{
+						Reason:  reason,
+						Message: fmt.Sprintf("Failed to deploy gateway to the cluster: %s", c.Message),
+					},
+				}
+			}
+		}
+	}
+	return &condition{
+		reason:  "ResourcesAvailable",
+		message: "Deployed gateway to the cluster",
+	}
+}
+
 // ApplyTemplate renders a template with the given input and (server-side) applies the results to the cluster.
 func (d *DeploymentController) ApplyTemplate(template string, input interface{}, subresources ...string) error {
 	var buf bytes.Buffer
@@ -277,6 +394,14 @@ func mergeMaps(maps ...map[string]string) map[string]string {
 type serviceInput struct {
 	gateway.Gateway
 	Ports []corev1.ServicePort
+	// ServiceType is the default type of the Service, which can be overridden with an annotation on the Gateway
+	ServiceType corev1.ServiceType
+}
+
+type deploymentInput struct {
+	gateway.Gateway
+	// Replicas is the number of replicas of the Deployment; if nil, it is left unset
+	Replicas *int32
 }
 
 func extractServicePorts(gw gateway.Gateway) []corev1.ServicePort {
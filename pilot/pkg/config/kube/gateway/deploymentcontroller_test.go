@@ -16,9 +16,14 @@ package gateway
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -27,6 +32,7 @@ import (
 
 	"istio.io/istio/pilot/test/util"
 	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/test/util/retry"
 	istiolog "istio.io/pkg/log"
 )
 
@@ -98,3 +104,172 @@ func TestConfigureIstioGateway(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigureIstioGatewayDeploymentStatus(t *testing.T) {
+	gw := v1alpha2.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "default",
+		},
+		Spec: v1alpha2.GatewaySpec{},
+	}
+	tests := []struct {
+		name       string
+		conditions []appsv1.DeploymentCondition
+		status     metav1.ConditionStatus
+		reason     string
+	}{
+		{
+			name:   "available",
+			status: metav1.ConditionTrue,
+			reason: "ResourcesAvailable",
+		},
+		{
+			name: "quota exceeded",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "ReplicaSetUpdated"},
+				{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Reason: "FailedCreate", Message: "exceeded quota"},
+			},
+			status: metav1.ConditionFalse,
+			reason: "FailedCreate",
+		},
+		{
+			name: "progress deadline exceeded",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable"},
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+			},
+			status: metav1.ConditionFalse,
+			reason: "ProgressDeadlineExceeded",
+		},
+		{
+			name: "recovered",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable"},
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable"},
+			},
+			status: metav1.ConditionTrue,
+			reason: "ResourcesAvailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := kube.NewFakeClient(&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      gw.Name,
+					Namespace: gw.Namespace,
+				},
+				Status: appsv1.DeploymentStatus{Conditions: tt.conditions},
+			})
+			// Register the informer before starting the client
+			client.KubeInformer().Apps().V1().Deployments().Lister()
+			stop := make(chan struct{})
+			t.Cleanup(func() {
+				close(stop)
+			})
+			client.RunAndWait(stop)
+
+			var status *v1alpha2.GatewayStatus
+			d := &DeploymentController{
+				client:    client,
+				templates: processTemplates(),
+				patcher: func(gvr schema.GroupVersionResource, name string, namespace string, data []byte, subresources ...string) error {
+					if len(subresources) == 0 || subresources[0] != "status" {
+						return nil
+					}
+					out := &v1alpha2.Gateway{}
+					if err := json.Unmarshal(data, out); err != nil {
+						return err
+					}
+					status = &out.Status
+					return nil
+				},
+			}
+			if err := d.configureIstioGateway(istiolog.FindScope(istiolog.DefaultScopeName), gw); err != nil {
+				t.Fatal(err)
+			}
+			if status == nil || len(status.Conditions) != 1 {
+				t.Fatalf("expected a single status condition, got %+v", status)
+			}
+			cond := status.Conditions[0]
+			if cond.Type != string(v1alpha2.GatewayConditionScheduled) || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("expected Scheduled=%v with reason %v, got %+v", tt.status, tt.reason, cond)
+			}
+		})
+	}
+}
+
+func TestConfigureIstioGatewayClassParameters(t *testing.T) {
+	client := kube.NewFakeClient(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio-params", Namespace: "istio-system"},
+		Data: map[string]string{
+			classParameterServiceType: string(corev1.ServiceTypeClusterIP),
+			classParameterReplicas:    "3",
+		},
+	})
+	ns := v1alpha2.Namespace("istio-system")
+	if _, err := client.GatewayAPI().GatewayV1alpha2().GatewayClasses().Create(context.Background(), &v1alpha2.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultClassName},
+		Spec: v1alpha2.GatewayClassSpec{
+			ControllerName: ControllerName,
+			ParametersRef:  &v1alpha2.ParametersReference{Kind: "ConfigMap", Name: "istio-params", Namespace: &ns},
+		},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Register the informers before starting the client
+	client.GatewayAPIInformer().Gateway().V1alpha2().GatewayClasses().Lister()
+	client.KubeInformer().Core().V1().ConfigMaps().Lister()
+	client.KubeInformer().Apps().V1().Deployments().Lister()
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+
+	buf := &bytes.Buffer{}
+	d := &DeploymentController{
+		client:    client,
+		templates: processTemplates(),
+		patcher: func(gvr schema.GroupVersionResource, name string, namespace string, data []byte, subresources ...string) error {
+			b, err := yaml.JSONToYAML(data)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			buf.Write([]byte("---\n"))
+			return nil
+		},
+	}
+	gw := v1alpha2.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "default",
+		},
+		Spec: v1alpha2.GatewaySpec{GatewayClassName: DefaultClassName},
+	}
+	if err := d.configureIstioGateway(istiolog.FindScope(istiolog.DefaultScopeName), gw); err != nil {
+		t.Fatal(err)
+	}
+	resp := timestampRegex.ReplaceAll(buf.Bytes(), []byte("lastTransitionTime: fake"))
+	util.CompareContent(resp, filepath.Join("testdata", "deployment", "class-parameters.yaml"), t)
+
+	// Provisioning can be disabled by the class
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio-params", Namespace: "istio-system"},
+		Data:       map[string]string{classParameterProvision: "false"},
+	}
+	if _, err := client.Kube().CoreV1().ConfigMaps(cm.Namespace).Update(context.Background(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		buf.Reset()
+		if err := d.configureIstioGateway(istiolog.FindScope(istiolog.DefaultScopeName), gw); err != nil {
+			return err
+		}
+		if buf.Len() != 0 {
+			return fmt.Errorf("expected no resources to be applied, got:\n%s", buf.String())
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
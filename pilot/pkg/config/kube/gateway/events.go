@@ -0,0 +1,152 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"istio.io/istio/pilot/pkg/model/kstatus"
+	"istio.io/istio/pkg/config"
+)
+
+// eventDedupInterval is the interval during which an event is not emitted again for the same object, so a
+// flapping condition does not spam the API server. Kubernetes additionally aggregates similar events.
+const eventDedupInterval = 10 * time.Minute
+
+// conversionEvents emits Kubernetes Warning events for the errors reported in the status of Gateways and routes.
+// Many users never look at status conditions, while events show up in kubectl describe.
+type conversionEvents struct {
+	mu       sync.Mutex
+	recorder record.EventRecorder
+	// emitted stores the time each event was last emitted, keyed by object and message
+	emitted map[string]time.Time
+	now     func() time.Time
+}
+
+func newConversionEvents() *conversionEvents {
+	return &conversionEvents{
+		emitted: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+func (e *conversionEvents) setRecorder(recorder record.EventRecorder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.recorder = recorder
+}
+
+// conversionEvent is an error reported in the status of an object.
+type conversionEvent struct {
+	reason  string
+	message string
+}
+
+// report emits events for the errors in the updated statuses of the configs.
+func (e *conversionEvents) report(configs []config.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.recorder == nil {
+		return
+	}
+	now := e.now()
+	for k, t := range e.emitted {
+		if now.Sub(t) >= eventDedupInterval {
+			delete(e.emitted, k)
+		}
+	}
+	for _, cfg := range configs {
+		ws := cfg.Status.(*kstatus.WrappedStatus)
+		if !ws.Dirty {
+			continue
+		}
+		for _, ev := range statusErrors(ws.Unwrap()) {
+			key := fmt.Sprintf("%s/%s/%s/%s", cfg.GroupVersionKind.Kind, cfg.Namespace, cfg.Name, ev.message)
+			if _, f := e.emitted[key]; f {
+				continue
+			}
+			e.emitted[key] = now
+			e.recorder.Event(objectReference(cfg), corev1.EventTypeWarning, ev.reason, ev.message)
+		}
+	}
+}
+
+func objectReference(cfg config.Config) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      cfg.GroupVersionKind.GroupVersion(),
+		Kind:            cfg.GroupVersionKind.Kind,
+		Name:            cfg.Name,
+		Namespace:       cfg.Namespace,
+		UID:             types.UID(cfg.UID),
+		ResourceVersion: cfg.ResourceVersion,
+	}
+}
+
+// statusErrors returns the errors reported by the conditions of a Gateway or route status. Errors reported by
+// several conditions, such as the Ready and Detached conditions of a listener, are only returned once.
+func statusErrors(s config.Status) []conversionEvent {
+	var res []conversionEvent
+	seen := map[string]struct{}{}
+	add := func(prefix string, conditions []metav1.Condition) {
+		for _, c := range conditions {
+			if !isErrorCondition(c) {
+				continue
+			}
+			msg := prefix + c.Message
+			if _, f := seen[msg]; f {
+				continue
+			}
+			seen[msg] = struct{}{}
+			res = append(res, conversionEvent{reason: c.Reason, message: msg})
+		}
+	}
+	switch st := s.(type) {
+	case *k8s.GatewayStatus:
+		add("", st.Conditions)
+		for _, l := range st.Listeners {
+			add(fmt.Sprintf("listener %q: ", l.Name), l.Conditions)
+		}
+	default:
+		for _, p := range routeParentStatuses(s) {
+			if p.ControllerName != ControllerName {
+				continue
+			}
+			add(fmt.Sprintf("parent %s: ", parentRefString(p.ParentRef)), p.Conditions)
+		}
+	}
+	return res
+}
+
+// isErrorCondition returns whether a condition reports an error. Most conditions have a positive polarity, but some
+// listener conditions, such as Conflicted, report an error when true.
+func isErrorCondition(c metav1.Condition) bool {
+	switch c.Type {
+	case string(k8s.ListenerConditionConflicted), string(k8s.ListenerConditionDetached):
+		return c.Status == metav1.ConditionTrue
+	case string(k8s.GatewayConditionReady), string(k8s.ConditionRouteAccepted),
+		// ResolvedRefs is shared by listeners and routes
+		string(k8s.ListenerConditionResolvedRefs):
+		return c.Status == metav1.ConditionFalse
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+const (
+	// classParameterServiceType sets the type of the Services generated for managed Gateways. It can be overridden
+	// for a Gateway with the networking.istio.io/service-type annotation.
+	classParameterServiceType = "serviceType"
+	// classParameterReplicas sets the number of replicas of the Deployments generated for managed Gateways.
+	classParameterReplicas = "replicas"
+	// classParameterProvision disables the generation of Deployments and Services when set to false.
+	classParameterProvision = "provision"
+)
+
+var classParameterServiceTypes = map[corev1.ServiceType]struct{}{
+	corev1.ServiceTypeClusterIP:    {},
+	corev1.ServiceTypeNodePort:     {},
+	corev1.ServiceTypeLoadBalancer: {},
+}
+
+// gatewayClass holds the settings of a GatewayClass handled by the Istio controller.
+type gatewayClass struct {
+	// Parameters are read from the ConfigMap referenced by the class, if any.
+	Parameters classParameters
+}
+
+// classParameters are the controller settings of a GatewayClass, read from the data of the ConfigMap referenced by
+// spec.parametersRef. Unset settings keep the default behavior.
+type classParameters struct {
+	// ServiceType is the type of the Services generated for managed Gateways. Defaults to LoadBalancer.
+	ServiceType corev1.ServiceType
+	// Replicas is the number of replicas of the Deployments generated for managed Gateways. If unset, the
+	// replicas are left to the Deployment defaults or an autoscaler.
+	Replicas *int32
+	// DisableProvisioning disables the generation of Deployments and Services. Gateways of the class are then
+	// expected to reference an existing Service with a Hostname address.
+	DisableProvisioning bool
+}
+
+// managed returns true if a Deployment and Service are generated for a Gateway of the class. See isManaged.
+func (c gatewayClass) managed(gw *k8s.GatewaySpec) bool {
+	return !c.Parameters.DisableProvisioning && isManaged(gw)
+}
+
+// parametersConfigMap returns the ConfigMap referenced by the parametersRef of a GatewayClass, or nil if the class
+// does not reference one. References to other kinds are reported by buildClassParameters.
+func parametersConfigMap(gwc *k8s.GatewayClassSpec) *types.NamespacedName {
+	ref := gwc.ParametersRef
+	if ref == nil || string(ref.Group) != gvk.ConfigMap.Group || string(ref.Kind) != gvk.ConfigMap.Kind || ref.Namespace == nil {
+		return nil
+	}
+	return &types.NamespacedName{Name: ref.Name, Namespace: string(*ref.Namespace)}
+}
+
+// buildClassParameters reads the parameters of a GatewayClass. configMaps holds the ConfigMaps referenced by
+// GatewayClasses; a missing entry means the ConfigMap does not exist.
+func buildClassParameters(gwc *k8s.GatewayClassSpec, configMaps map[types.NamespacedName]*corev1.ConfigMap) (classParameters, error) {
+	out := classParameters{}
+	ref := gwc.ParametersRef
+	if ref == nil {
+		return out, nil
+	}
+	if string(ref.Group) != gvk.ConfigMap.Group || string(ref.Kind) != gvk.ConfigMap.Kind {
+		return out, fmt.Errorf("unsupported parametersRef kind %s/%s; only ConfigMap is supported", ref.Group, ref.Kind)
+	}
+	key := parametersConfigMap(gwc)
+	if key == nil {
+		return out, fmt.Errorf("parametersRef to ConfigMap %s must set a namespace", ref.Name)
+	}
+	cm, f := configMaps[*key]
+	if !f || cm == nil {
+		return out, fmt.Errorf("parametersRef ConfigMap %s not found", key)
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := cm.Data[k]
+		switch k {
+		case classParameterServiceType:
+			t := corev1.ServiceType(v)
+			if _, f := classParameterServiceTypes[t]; !f {
+				return out, fmt.Errorf("invalid %s %q in ConfigMap %s: must be one of ClusterIP, NodePort or LoadBalancer", k, v, key)
+			}
+			out.ServiceType = t
+		case classParameterReplicas:
+			r, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || r < 0 {
+				return out, fmt.Errorf("invalid %s %q in ConfigMap %s: must be a non-negative integer", k, v, key)
+			}
+			replicas := int32(r)
+			out.Replicas = &replicas
+		case classParameterProvision:
+			p, err := strconv.ParseBool(v)
+			if err != nil {
+				return out, fmt.Errorf("invalid %s %q in ConfigMap %s: must be true or false", k, v, key)
+			}
+			out.DisableProvisioning = !p
+		default:
+			return out, fmt.Errorf("unknown parameter %q in ConfigMap %s", k, key)
+		}
+	}
+	return out, nil
+}
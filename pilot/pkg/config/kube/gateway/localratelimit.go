@@ -0,0 +1,259 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	lrl "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/gogo/protobuf/types"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	istio "istio.io/api/networking/v1alpha3"
+	networkingutil "istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+const (
+	// LocalRateLimitAnnotation configures local rate limiting of the listeners of a Gateway. The value is a JSON
+	// object keyed by listener name, for example {"http": {"requests": 100, "unit": "second", "burst": 200}}.
+	// The limit is enforced by each gateway replica, for each hostname served by the listener. As a port is
+	// served by a single Envoy listener, listeners sharing a port must have the same limit.
+	LocalRateLimitAnnotation = "gateway.istio.io/local-rate-limit"
+
+	// gatewayNameLabel is set on the pods of the deployments generated for Gateways.
+	gatewayNameLabel = "istio.io/gateway-name"
+	// localRateLimitFilter is the name of the Envoy local rate limit HTTP filter.
+	localRateLimitFilter = "envoy.filters.http.local_ratelimit"
+)
+
+// localRateLimit is the local rate limit of a listener, as configured with LocalRateLimitAnnotation.
+type localRateLimit struct {
+	// Requests is the number of requests allowed per Unit.
+	Requests uint32 `json:"requests"`
+	// Unit is the period Requests are allowed over: second, minute or hour.
+	Unit string `json:"unit"`
+	// Burst is the number of requests that may be sent at once. Defaults to Requests.
+	Burst uint32 `json:"burst,omitempty"`
+}
+
+var localRateLimitUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+}
+
+// listenerLocalRateLimit returns the local rate limit configured for a listener with LocalRateLimitAnnotation,
+// or nil if there is none.
+func listenerLocalRateLimit(annotations map[string]string, name k8s.SectionName) (*localRateLimit, error) {
+	value, f := annotations[LocalRateLimitAnnotation]
+	if !f {
+		return nil, nil
+	}
+	listeners := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(value), &listeners); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", LocalRateLimitAnnotation, err)
+	}
+	raw, f := listeners[string(name)]
+	if !f {
+		return nil, nil
+	}
+	rl := &localRateLimit{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rl); err != nil {
+		return nil, fmt.Errorf("invalid local rate limit: %v", err)
+	}
+	if rl.Requests == 0 {
+		return nil, fmt.Errorf("invalid local rate limit: requests must be greater than 0")
+	}
+	if _, f := localRateLimitUnits[rl.Unit]; !f {
+		return nil, fmt.Errorf("invalid local rate limit: unit %q must be one of second, minute or hour", rl.Unit)
+	}
+	if rl.Burst == 0 {
+		rl.Burst = rl.Requests
+	}
+	if rl.Burst < rl.Requests {
+		return nil, fmt.Errorf("invalid local rate limit: burst %d must not be less than requests %d", rl.Burst, rl.Requests)
+	}
+	return rl, nil
+}
+
+// validateLocalRateLimit checks the local rate limit of a listener, if any, can be applied. It returns a message
+// describing why it cannot, or an empty string if it can.
+func validateLocalRateLimit(obj config.Config, l k8s.Listener, listeners []k8s.Listener) string {
+	rl, err := listenerLocalRateLimit(obj.Annotations, l.Name)
+	if err != nil {
+		return err.Error()
+	}
+	if rl == nil {
+		return ""
+	}
+	if l.Protocol != k8s.HTTPProtocolType && l.Protocol != k8s.HTTPSProtocolType {
+		return fmt.Sprintf("local rate limiting is not supported for protocol %v; only HTTP and HTTPS listeners can be rate limited", l.Protocol)
+	}
+	if kgw, ok := obj.Spec.(*k8s.GatewaySpec); !ok || !isManaged(kgw) {
+		// Otherwise the proxies may implement other Gateways, which would be rate limited as well
+		return "local rate limiting is only supported for Gateways with a generated deployment, which do not have Hostname addresses"
+	}
+	for _, other := range listeners {
+		if other.Name == l.Name || other.Port != l.Port {
+			continue
+		}
+		if orl, _ := listenerLocalRateLimit(obj.Annotations, other.Name); orl == nil || *orl != *rl {
+			return fmt.Sprintf("listener %q shares port %d with listener %q, which has a different local rate limit", l.Name, l.Port, other.Name)
+		}
+	}
+	return ""
+}
+
+// buildLocalRateLimitEnvoyFilter generates an EnvoyFilter applying the local rate limit of each port to the
+// deployment generated for the Gateway. It returns nil if no port is rate limited.
+func buildLocalRateLimitEnvoyFilter(obj config.Config, limits map[k8s.PortNumber]*localRateLimit, domain string) *config.Config {
+	if len(limits) == 0 {
+		return nil
+	}
+	// The filter is disabled unless configured for the virtual host, so it is safe to insert it on all listeners
+	filter, err := toStruct(&hcm.HttpFilter{
+		Name: localRateLimitFilter,
+		ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: networkingutil.MessageToAny(&lrl.LocalRateLimit{
+			StatPrefix: "http_local_rate_limiter",
+		})},
+	})
+	if err != nil {
+		log.Errorf("failed to build local rate limit filter for %s/%s: %v", obj.Namespace, obj.Name, err)
+		return nil
+	}
+	patches := []*istio.EnvoyFilter_EnvoyConfigObjectPatch{{
+		ApplyTo: istio.EnvoyFilter_HTTP_FILTER,
+		Match: &istio.EnvoyFilter_EnvoyConfigObjectMatch{
+			Context: istio.EnvoyFilter_GATEWAY,
+			ObjectTypes: &istio.EnvoyFilter_EnvoyConfigObjectMatch_Listener{
+				Listener: &istio.EnvoyFilter_ListenerMatch{
+					FilterChain: &istio.EnvoyFilter_ListenerMatch_FilterChainMatch{
+						Filter: &istio.EnvoyFilter_ListenerMatch_FilterMatch{
+							Name:      wellknown.HTTPConnectionManager,
+							SubFilter: &istio.EnvoyFilter_ListenerMatch_SubFilterMatch{Name: wellknown.Router},
+						},
+					},
+				},
+			},
+		},
+		Patch: &istio.EnvoyFilter_Patch{
+			Operation: istio.EnvoyFilter_Patch_INSERT_BEFORE,
+			Value:     filter,
+		},
+	}}
+
+	ports := make([]k8s.PortNumber, 0, len(limits))
+	for port := range limits {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i] < ports[j]
+	})
+	for _, port := range ports {
+		rl := limits[port]
+		vhost, err := toStruct(&route.VirtualHost{
+			TypedPerFilterConfig: map[string]*anypb.Any{
+				localRateLimitFilter: networkingutil.MessageToAny(&lrl.LocalRateLimit{
+					StatPrefix: "http_local_rate_limiter",
+					TokenBucket: &typev3.TokenBucket{
+						MaxTokens:     rl.Burst,
+						TokensPerFill: wrapperspb.UInt32(rl.Requests),
+						FillInterval:  durationpb.New(localRateLimitUnits[rl.Unit]),
+					},
+					FilterEnabled:  fullRuntimeFraction("local_rate_limit_enabled"),
+					FilterEnforced: fullRuntimeFraction("local_rate_limit_enforced"),
+				}),
+			},
+		})
+		if err != nil {
+			log.Errorf("failed to build local rate limit for %s/%s: %v", obj.Namespace, obj.Name, err)
+			return nil
+		}
+		// Gateway routes are matched by the service port, so the port of the listener can be used directly
+		patches = append(patches, &istio.EnvoyFilter_EnvoyConfigObjectPatch{
+			ApplyTo: istio.EnvoyFilter_VIRTUAL_HOST,
+			Match: &istio.EnvoyFilter_EnvoyConfigObjectMatch{
+				Context: istio.EnvoyFilter_GATEWAY,
+				ObjectTypes: &istio.EnvoyFilter_EnvoyConfigObjectMatch_RouteConfiguration{
+					RouteConfiguration: &istio.EnvoyFilter_RouteConfigurationMatch{PortNumber: uint32(port)},
+				},
+			},
+			Patch: &istio.EnvoyFilter_Patch{
+				Operation: istio.EnvoyFilter_Patch_MERGE,
+				Value:     vhost,
+			},
+		})
+	}
+
+	return &config.Config{
+		Meta: config.Meta{
+			CreationTimestamp: obj.CreationTimestamp,
+			GroupVersionKind:  gvk.EnvoyFilter,
+			Name:              boundedName(obj.Name, fmt.Sprintf("-%s-local-rate-limit", constants.KubernetesGatewayName)),
+			Annotations:       parentMeta(obj, nil),
+			Namespace:         obj.Namespace,
+			Domain:            domain,
+		},
+		Spec: &istio.EnvoyFilter{
+			WorkloadSelector: &istio.WorkloadSelector{
+				Labels: map[string]string{gatewayNameLabel: obj.Name},
+			},
+			ConfigPatches: patches,
+		},
+	}
+}
+
+func fullRuntimeFraction(key string) *core.RuntimeFractionalPercent {
+	return &core.RuntimeFractionalPercent{
+		RuntimeKey: key,
+		DefaultValue: &typev3.FractionalPercent{
+			Numerator:   100,
+			Denominator: typev3.FractionalPercent_HUNDRED,
+		},
+	}
+}
+
+// toStruct converts an Envoy message to the struct used in EnvoyFilter patches.
+func toStruct(msg proto.Message) (*types.Struct, error) {
+	js, err := protomarshal.ToJSON(msg)
+	if err != nil {
+		return nil, err
+	}
+	out := &types.Struct{}
+	if err := gogoprotomarshal.ApplyJSON(js, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"time"
+
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/pkg/monitoring"
+)
+
+var (
+	kindTag   = monitoring.MustCreateLabel("kind")
+	reasonTag = monitoring.MustCreateLabel("reason")
+
+	skippedGateways = monitoring.NewGauge(
+		"pilot_k8s_gateway_skipped",
+		"Number of Kubernetes Gateways ignored due to the "+SkipAnnotation+" annotation.",
+	)
+
+	conversionPanics = monitoring.NewSum(
+		"pilot_k8s_gateway_conversion_panics",
+		"Total number of gateway-api objects skipped because converting them caused a panic.",
+		monitoring.WithLabels(kindTag),
+	)
+
+	// The counters below only ever increase, and are incremented by every conversion. The gauges report the values
+	// of the last conversion, and are recorded for all label values so that values which drop to zero are reset.
+
+	convertedResources = monitoring.NewSum(
+		"pilot_k8s_gateway_converted_resources",
+		"Total number of gateway-api objects processed by conversions, labeled by kind.",
+		monitoring.WithLabels(kindTag),
+	)
+
+	currentResources = monitoring.NewGauge(
+		"pilot_k8s_gateway_resources",
+		"Number of gateway-api objects processed by the last conversion, labeled by kind.",
+		monitoring.WithLabels(kindTag),
+	)
+
+	deniedRouteParents = monitoring.NewGauge(
+		"pilot_k8s_gateway_denied_route_parents",
+		"Number of route parent references not allowed to attach to their parent in the last conversion, "+
+			"labeled by route kind and reason.",
+		monitoring.WithLabels(kindTag, reasonTag),
+	)
+
+	generatedConfigs = monitoring.NewGauge(
+		"pilot_k8s_gateway_generated_configs",
+		"Number of Istio configs generated by the last conversion, labeled by kind.",
+		monitoring.WithLabels(kindTag),
+	)
+
+	conversionTime = monitoring.NewDistribution(
+		"pilot_k8s_gateway_conversion_seconds",
+		"Time in seconds taken to convert all gateway-api objects.",
+		[]float64{.001, .01, .1, .5, 1, 3, 5, 10},
+	)
+)
+
+func init() {
+	monitoring.MustRegister(skippedGateways, conversionPanics, convertedResources, currentResources, deniedRouteParents,
+		generatedConfigs, conversionTime)
+}
+
+// routeKinds are the kinds of the routes converted, used to label metrics.
+var routeKinds = []config.GroupVersionKind{gvk.HTTPRoute, gvk.TCPRoute, gvk.TLSRoute}
+
+type deniedKey struct {
+	kind   string
+	reason string
+}
+
+// conversionStats collects statistics during a conversion. They are recorded once the conversion completes, so
+// that the gauges never report a partial conversion.
+type conversionStats struct {
+	deniedParents map[deniedKey]int
+}
+
+func newConversionStats() *conversionStats {
+	return &conversionStats{deniedParents: map[deniedKey]int{}}
+}
+
+// denied records a route parent reference that is not allowed to attach to its parent.
+func (s *conversionStats) denied(kind config.GroupVersionKind, err error) {
+	s.deniedParents[deniedKey{kind: kind.Kind, reason: deniedReason(err)}]++
+}
+
+// record records the metrics of a conversion of the input into the output.
+func (s *conversionStats) record(input *KubernetesResources, output OutputResources, took time.Duration) {
+	for kind, n := range map[string]int{
+		gvk.KubernetesGateway.Kind: len(input.Gateway),
+		gvk.HTTPRoute.Kind:         len(input.HTTPRoute),
+		gvk.TCPRoute.Kind:          len(input.TCPRoute),
+		gvk.TLSRoute.Kind:          len(input.TLSRoute),
+	} {
+		convertedResources.With(kindTag.Value(kind)).RecordInt(int64(n))
+		currentResources.With(kindTag.Value(kind)).Record(float64(n))
+	}
+	for _, kind := range routeKinds {
+		for _, reason := range deniedReasons {
+			n := s.deniedParents[deniedKey{kind: kind.Kind, reason: reason}]
+			deniedRouteParents.With(kindTag.Value(kind.Kind), reasonTag.Value(reason)).Record(float64(n))
+		}
+	}
+	generatedConfigs.With(kindTag.Value(gvk.Gateway.Kind)).Record(float64(len(output.Gateway)))
+	generatedConfigs.With(kindTag.Value(gvk.VirtualService.Kind)).Record(float64(len(output.VirtualService)))
+	generatedConfigs.With(kindTag.Value(gvk.EnvoyFilter.Kind)).Record(float64(len(output.EnvoyFilter)))
+	conversionTime.Record(took.Seconds())
+}
@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"istio.io/api/label"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+// revisionFilter selects the gateway-api objects handled by a control plane revision, mirroring sidecar
+// injection: objects labeled with istio.io/rev are only handled by that revision, while unlabeled objects
+// are handled by the default revision. Unlabeled routes inherit the revision of the Gateways they attach to.
+type revisionFilter struct {
+	revision string
+	// isDefault is set when this control plane is the default revision.
+	isDefault bool
+}
+
+// owns returns whether the object is handled by this revision, based on its own labels only.
+func (f revisionFilter) owns(obj config.Config) bool {
+	rev, ok := obj.Labels[label.IoIstioRev.Name]
+	if !ok {
+		return f.isDefault
+	}
+	return rev == f.revision
+}
+
+// filter returns the objects owned by this revision.
+func (f revisionFilter) filter(objs []config.Config) []config.Config {
+	res := make([]config.Config, 0, len(objs))
+	for _, obj := range objs {
+		if f.owns(obj) {
+			res = append(res, obj)
+		}
+	}
+	return res
+}
+
+// filterGateways returns the Gateways owned by this revision and the Gateways of other revisions, as well as the
+// revision ownership of all Gateways.
+func (f revisionFilter) filterGateways(gateways []config.Config) ([]config.Config, []config.Config, map[parentKey]bool) {
+	owned := make(map[parentKey]bool, len(gateways))
+	res := make([]config.Config, 0, len(gateways))
+	others := []config.Config{}
+	for _, obj := range gateways {
+		key := parentKey{Kind: gvk.KubernetesGateway, Name: obj.Name, Namespace: obj.Namespace}
+		owned[key] = f.owns(obj)
+		if owned[key] {
+			res = append(res, obj)
+		} else {
+			others = append(others, obj)
+		}
+	}
+	return res, others, owned
+}
+
+// filterRoutes returns the routes owned by this revision. A labeled route is owned based on its label. An
+// unlabeled route is owned if any Gateway it references is owned; if it does not reference any known
+// Gateway, it is owned by the default revision.
+func (f revisionFilter) filterRoutes(routes []config.Config, gateways map[parentKey]bool) []config.Config {
+	res := make([]config.Config, 0, len(routes))
+	for _, obj := range routes {
+		if _, labeled := obj.Labels[label.IoIstioRev.Name]; labeled {
+			if f.owns(obj) {
+				res = append(res, obj)
+			}
+			continue
+		}
+		knownParent, ownedParent := false, false
+		for _, ref := range routeParentRefs(obj) {
+			pk, err := toInternalParentReference(ref, obj.Namespace)
+			if err != nil {
+				continue
+			}
+			if owned, ok := gateways[pk]; ok {
+				knownParent = true
+				ownedParent = ownedParent || owned
+			}
+		}
+		if ownedParent || (!knownParent && f.isDefault) {
+			res = append(res, obj)
+		}
+	}
+	return res
+}
+
+func routeParentRefs(obj config.Config) []k8s.ParentRef {
+	switch spec := obj.Spec.(type) {
+	case *k8s.HTTPRouteSpec:
+		return spec.ParentRefs
+	case *k8s.TCPRouteSpec:
+		return spec.ParentRefs
+	case *k8s.TLSRouteSpec:
+		return spec.ParentRefs
+	default:
+		return nil
+	}
+}
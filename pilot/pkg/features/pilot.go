@@ -15,6 +15,8 @@
 package features
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/protobuf/types/known/durationpb"
@@ -48,6 +50,122 @@ var (
 		return f
 	}()
 
+	traceClientSamplingVar = env.RegisterFloatVar(
+		"PILOT_TRACE_CLIENT_SAMPLING",
+		100.0,
+		"Sets the mesh-wide percentage of requests that are traced when the client sets the x-client-trace-id header. "+
+			"Should be 0.0 - 100.0. Default is 100.0.",
+	)
+
+	TraceClientSampling = func() float64 {
+		f := traceClientSamplingVar.Get()
+		if f < 0.0 || f > 100.0 {
+			log.Warnf("PILOT_TRACE_CLIENT_SAMPLING out of range: %v", f)
+			return 100.0
+		}
+		return f
+	}()
+
+	traceOverallSamplingVar = env.RegisterFloatVar(
+		"PILOT_TRACE_OVERALL_SAMPLING",
+		100.0,
+		"Sets the mesh-wide cap on the percentage of requests that are traced, applied after all other sampling "+
+			"decisions, including client and forced traces. Should be 0.0 - 100.0. Default is 100.0.",
+	)
+
+	TraceOverallSampling = func() float64 {
+		f := traceOverallSamplingVar.Get()
+		if f < 0.0 || f > 100.0 {
+			log.Warnf("PILOT_TRACE_OVERALL_SAMPLING out of range: %v", f)
+			return 100.0
+		}
+		return f
+	}()
+
+	traceNamespaceSamplingVar = env.RegisterStringVar(
+		"PILOT_TRACE_NAMESPACE_SAMPLING",
+		"",
+		"Sets per-namespace default trace sampling percentages, as a comma separated list of namespace=percentage "+
+			"entries, for example \"foo=10,bar=0.5\". These override PILOT_TRACE_SAMPLING and the root namespace "+
+			"Telemetry for the namespace, but are overridden by Telemetry resources in the namespace itself.",
+	)
+
+	TraceNamespaceSampling = func() map[string]float64 {
+		res := map[string]float64{}
+		v := traceNamespaceSamplingVar.Get()
+		if v == "" {
+			return res
+		}
+		for _, entry := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				log.Warnf("PILOT_TRACE_NAMESPACE_SAMPLING has invalid entry: %q", entry)
+				continue
+			}
+			f, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil || f < 0.0 || f > 100.0 {
+				log.Warnf("PILOT_TRACE_NAMESPACE_SAMPLING has invalid percentage for namespace %v: %v", kv[0], kv[1])
+				continue
+			}
+			res[kv[0]] = f
+		}
+		return res
+	}()
+
+	meshMetricDimensionsVar = env.RegisterStringVar(
+		"PILOT_MESH_METRIC_DIMENSIONS",
+		"",
+		"Sets dimensions added to every standard metric of every proxy, as a comma separated list of "+
+			"name=expression entries, for example \"mesh_id='mesh1',environment=node.metadata['ENV']\". Literal "+
+			"values are quoted. Telemetry metric overrides can change or remove these dimensions. Expressions "+
+			"referencing unbounded values, such as request ids or paths, are rejected.",
+	)
+
+	MeshMetricDimensions = func() map[string]string {
+		res := map[string]string{}
+		v := meshMetricDimensionsVar.Get()
+		if v == "" {
+			return res
+		}
+		for _, entry := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+			if len(kv) != 2 || kv[0] == "" || strings.TrimSpace(kv[1]) == "" {
+				log.Warnf("PILOT_MESH_METRIC_DIMENSIONS has invalid entry: %q", entry)
+				continue
+			}
+			res[kv[0]] = strings.TrimSpace(kv[1])
+		}
+		return res
+	}()
+
+	// AccessLogCanonicalIdentity adds the canonical identity of the proxy to the default access log format.
+	AccessLogCanonicalIdentity = env.RegisterBoolVar(
+		"PILOT_ACCESS_LOG_CANONICAL_IDENTITY",
+		false,
+		"If enabled, the canonical revision, canonical service, mesh id and namespace of the proxy are added to "+
+			"the default access log format, with the same values as the istio.* tracing tags. Custom access log "+
+			"formats are not changed.",
+	).Get()
+
+	// MetricsCanonicalIdentity adds the canonical identity of the proxy as dimensions of every standard metric.
+	MetricsCanonicalIdentity = env.RegisterBoolVar(
+		"PILOT_METRICS_CANONICAL_IDENTITY",
+		false,
+		"If enabled, the canonical revision, canonical service, mesh id and namespace of the proxy are added as "+
+			"istio_canonical_revision, istio_canonical_service, istio_mesh_id and istio_namespace dimensions of "+
+			"every standard metric, with the same values as the istio.* tracing tags. This creates time series per "+
+			"canonical revision; the dimensions must also be declared as extra stat tags of the proxies.",
+	).Get()
+
+	// GatewayTelemetryRootNamespaceOnly restricts the telemetry provider selection of gateways to the mesh admin.
+	GatewayTelemetryRootNamespaceOnly = env.RegisterBoolVar(
+		"PILOT_GATEWAY_TELEMETRY_ROOT_NAMESPACE_ONLY",
+		false,
+		"If enabled, the telemetry providers of gateways are only selected, or disabled, by Telemetry resources in "+
+			"the root namespace and the mesh default providers. Provider selection and disablement in other "+
+			"Telemetry resources is ignored for gateways.",
+	).Get()
+
 	// EnableIstioTags controls whether or not to configure Envoy with support for Istio-specific tags
 	// in trace spans. This is a temporary flag for controlling the feature that will be replaced by
 	// Telemetry API (or accepted as an always-on feature).
@@ -57,6 +175,15 @@ var (
 		"Determines whether or not trace spans generated by Envoy will include Istio-specific tags.",
 	).Get()
 
+	// EnableUpstreamTracingTags controls whether trace spans include tags describing the upstream a request was
+	// sent to. This can be overridden per workload or namespace by the Telemetry API.
+	EnableUpstreamTracingTags = env.RegisterBoolVar(
+		"PILOT_ENABLE_UPSTREAM_TRACING_TAGS",
+		false,
+		"If enabled, trace spans generated by Envoy will include tags for the upstream cluster subset and "+
+			"the upstream peer workload, read from cluster and endpoint metadata.",
+	).Get()
+
 	PushThrottle = env.RegisterIntVar(
 		"PILOT_PUSH_THROTTLE",
 		100,
@@ -188,6 +315,12 @@ var (
 		"Protocol detection timeout for inbound listener",
 	).Lookup()
 
+	GRPCServerMaxStreamDuration = env.RegisterDurationVar(
+		"PILOT_GRPC_SERVER_MAX_STREAM_DURATION",
+		0,
+		"The maximum duration of a stream served by a proxyless gRPC server. Streams are not limited if unset.",
+	).Get()
+
 	EnableHeadlessService = env.RegisterBoolVar(
 		"PILOT_ENABLE_HEADLESS_SERVICE_POD_LISTENERS",
 		true,
@@ -339,6 +472,16 @@ var (
 	EnableGatewayAPIDeploymentController = env.RegisterBoolVar("PILOT_ENABLE_GATEWAY_API_DEPLOYMENT_CONTROLLER", true,
 		"If this is set to true, gateway-api resources will automatically provision in cluster deployment, services, etc").Get()
 
+	EnableGatewayAPICertificateValidation = env.RegisterBoolVar("PILOT_ENABLE_GATEWAY_API_CERTIFICATE_VALIDATION", false,
+		"If this is set to true, the certificates referenced by gateway-api listeners are read, and the listener "+
+			"status reports certificates which are expired, not yet valid, or do not cover the listener hostname. "+
+			"This requires istiod to read the referenced Secrets.").Get()
+
+	GatewayAPIExportToAllNamespaces = env.RegisterBoolVar("PILOT_GATEWAY_API_EXPORT_TO_ALL_NAMESPACES", false,
+		"If this is set to true, VirtualServices generated for gateway-api routes bound to a Gateway are visible in "+
+			"all namespaces. By default, they are only exported to the namespaces of the route, the Gateway, and the "+
+			"Gateway Services. Routes bound to the mesh are always visible in all namespaces.").Get()
+
 	EnableVirtualServiceDelegate = env.RegisterBoolVar(
 		"PILOT_ENABLE_VIRTUAL_SERVICE_DELEGATE",
 		true,
@@ -451,6 +594,35 @@ var (
 		"The amount of time an auto-registered workload can remain disconnected from all Pilot instances before the "+
 			"associated WorkloadEntry is cleaned up.").Get()
 
+	ServiceWithoutEndpointSlicesThreshold = env.RegisterDurationVar(
+		"PILOT_SERVICE_WITHOUT_ENDPOINT_SLICES_THRESHOLD",
+		5*time.Minute,
+		"The amount of time a Service with a selector can have no EndpointSlices before it is reported by the "+
+			"pilot_k8s_services_without_endpoint_slices metric.",
+	).Get()
+
+	ServiceNoReadyEndpointsDebounce = env.RegisterDurationVar(
+		"PILOT_SERVICE_NO_READY_ENDPOINTS_DEBOUNCE",
+		30*time.Second,
+		"The amount of time a Service must have no ready endpoints, or have ready endpoints again, before the "+
+			"transition is reported. This avoids reporting Services whose endpoints briefly drop to zero during rollouts.",
+	).Get()
+
+	EnableServiceNoReadyEndpointsEvents = env.RegisterBoolVar(
+		"PILOT_ENABLE_SERVICE_NO_READY_ENDPOINTS_EVENTS",
+		false,
+		"If enabled, a Kubernetes Event is created on a Service when it no longer has any ready endpoints, "+
+			"and when it has ready endpoints again.",
+	).Get()
+
+	PodDeletionCostWeighting = env.RegisterBoolVar(
+		"PILOT_ENABLE_POD_DELETION_COST_WEIGHTING",
+		false,
+		"If enabled, the endpoints of pods with a negative controller.kubernetes.io/pod-deletion-cost annotation, "+
+			"which are the first to be removed when their ReplicaSet is scaled down, get a tenth of the load balancing "+
+			"weight of the other endpoints of Kubernetes Services, so that they receive less traffic before being drained.",
+	).Get()
+
 	WorkloadEntryHealthChecks = env.RegisterBoolVar("PILOT_ENABLE_WORKLOAD_ENTRY_HEALTHCHECKS", true,
 		"Enables automatic health checks of WorkloadEntries based on the config provided in the associated WorkloadGroup").Get()
 
@@ -485,6 +657,33 @@ var (
 		"If enabled, Istio agent will intercept ECDS resource update, downloads Wasm module, "+
 			"and replaces Wasm module remote load with downloaded local module file.").Get()
 
+	WasmPrefetchModules = env.RegisterStringVar("ISTIO_AGENT_WASM_PREFETCH_MODULES", "",
+		"Comma separated list of Wasm modules Istio agent fetches at startup, before they are referenced by any "+
+			"configuration. Each module is the url of a WasmPlugin, optionally followed by | and its sha256, "+
+			"or its image digest for OCI modules. Modules are only reused when the sha256 matches the WasmPlugin.").Get()
+
+	WasmPrefetchParallelism = env.RegisterIntVar("ISTIO_AGENT_WASM_PREFETCH_PARALLELISM", 4,
+		"The maximum number of Wasm modules Istio agent fetches concurrently at startup.").Get()
+
+	WasmPrefetchBudget = env.RegisterDurationVar("ISTIO_AGENT_WASM_PREFETCH_BUDGET", 30*time.Second,
+		"The maximum time Istio agent spends fetching Wasm modules at startup. Modules not fetched by then are "+
+			"fetched when first referenced.").Get()
+
+	WasmChecksumFile = env.RegisterBoolVar("ISTIO_AGENT_WASM_CHECKSUM_FILE", false,
+		"If enabled, when no sha256 checksum is configured for a Wasm module fetched over HTTP(S), Istio agent fetches "+
+			"the checksum from the file published next to the module, at the module URL with the .sha256 suffix, and "+
+			"verifies the module against it.").Get()
+
+	WasmGlobalCredentialsNamespaces = env.RegisterStringVar("ISTIO_AGENT_WASM_GLOBAL_CREDENTIALS_NAMESPACES", "*",
+		"Comma separated list of the namespaces whose WasmPlugin modules Istio agent may fetch with its own registry "+
+			"credentials, read from DOCKER_CONFIG. The modules of other namespaces are only fetched with the image pull "+
+			"secrets istiod sends for their namespace, and are not shared with other namespaces. \"*\" allows all namespaces.").Get()
+
+	WasmServiceAccountPullSecrets = env.RegisterBoolVar("PILOT_WASM_SERVICE_ACCOUNT_PULL_SECRETS", true,
+		"If enabled, when a WasmPlugin does not reference an image pull secret, istiod sends the image pull secrets "+
+			"of the workload's service account to its proxy for fetching the module, as the kubelet does for the "+
+			"workload's images.").Get()
+
 	PilotJwtPubKeyRefreshInterval = env.RegisterDurationVar(
 		"PILOT_JWT_PUB_KEY_REFRESH_INTERVAL",
 		20*time.Minute,
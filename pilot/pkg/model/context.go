@@ -1087,6 +1087,12 @@ func (node *Proxy) IsVM() bool {
 	return node.Metadata != nil && node.Metadata.Labels[constants.TestVMLabel] != ""
 }
 
+// TracingDisabledByAnnotation returns whether tracing is disabled for the workload with the
+// constants.TelemetryTracing annotation.
+func (node *Proxy) TracingDisabledByAnnotation() bool {
+	return node.Metadata != nil && node.Metadata.Annotations[constants.TelemetryTracing] == "disabled"
+}
+
 func (node *Proxy) IsProxylessGrpc() bool {
 	return node.Metadata != nil && node.Metadata.Generator == "grpc"
 }
@@ -33,6 +33,14 @@ import (
 
 const (
 	defaultRuntime = "envoy.wasm.runtime.v8"
+
+	// WasmSecretEnv is the Wasm VM environment variable istiod uses to send the image pull secret of a module to
+	// the agent, which removes it before the configuration reaches Envoy.
+	WasmSecretEnv = "ISTIO_META_WASM_IMAGE_PULL_SECRET"
+
+	// WasmNamespaceEnv is the Wasm VM environment variable istiod uses to send the namespace of the WasmPlugin of an
+	// OCI module to the agent, which selects the credentials to fetch the module with by namespace.
+	WasmNamespaceEnv = "ISTIO_META_WASM_PLUGIN_NAMESPACE"
 )
 
 type WasmPluginWrapper struct {
@@ -63,6 +71,7 @@ func convertToWasmPluginWrapper(plugin *config.Config) *WasmPluginWrapper {
 		})
 	}
 	var datasource *envoy_config_core_v3.AsyncDataSource
+	var envs *envoy_extensions_wasm_v3.EnvironmentVariables
 	u, err := url.Parse(wasmPlugin.Url)
 	if err != nil {
 		log.Warnf("wasmplugin %v/%v discarded due to failure to parse URL: %s", plugin.Namespace, plugin.Name, err)
@@ -98,6 +107,11 @@ func convertToWasmPluginWrapper(plugin *config.Config) *WasmPluginWrapper {
 				},
 			},
 		}
+		if u.Scheme == "oci" {
+			envs = &envoy_extensions_wasm_v3.EnvironmentVariables{
+				KeyValues: map[string]string{WasmNamespaceEnv: plugin.Namespace},
+			}
+		}
 	}
 	typedConfig, err := anypb.New(&envoy_extensions_filters_http_wasm_v3.Wasm{
 		Config: &envoy_extensions_wasm_v3.PluginConfig{
@@ -106,8 +120,9 @@ func convertToWasmPluginWrapper(plugin *config.Config) *WasmPluginWrapper {
 			Configuration: cfg,
 			Vm: &envoy_extensions_wasm_v3.PluginConfig_VmConfig{
 				VmConfig: &envoy_extensions_wasm_v3.VmConfig{
-					Runtime: defaultRuntime,
-					Code:    datasource,
+					Runtime:              defaultRuntime,
+					Code:                 datasource,
+					EnvironmentVariables: envs,
 				},
 			},
 		},
@@ -51,8 +51,16 @@ type MergedServers struct {
 type TLSServerInfo struct {
 	RouteName string
 	SNIHosts  []string
+	// CredentialNames are the credentials served by the server, when it serves more than its CredentialName. See
+	// InternalCredentialNamesAnnotation.
+	CredentialNames []string
 }
 
+// InternalCredentialNamesAnnotation declares the credentials served by the TLS servers of an internally generated
+// Gateway, comma separated, overriding their CredentialName. This allows Gateways generated for the gateway-api to
+// serve multiple certificates for the same hosts, such as an RSA and an ECDSA certificate.
+const InternalCredentialNamesAnnotation = "internal.istio.io/credential-names"
+
 // MergedGateway describes a set of gateways for a workload merged into a single logical gateway.
 type MergedGateway struct {
 	// ServerPorts maintains a list of unique server ports, used for stable ordering.
@@ -171,16 +179,18 @@ func MergeGateways(gateways []gatewayWithInstances, proxy *Proxy, ps *PushContex
 			gatewayNameForServer[s] = gatewayName
 			log.Debugf("MergeGateways: gateway %q processing server %s :%v", gatewayName, s.Name, s.Hosts)
 
-			cn := s.GetTls().GetCredentialName()
-			if cn != "" && proxy.VerifiedIdentity != nil {
-				rn := credentials.ToResourceName(cn)
-				parse, _ := credentials.ParseResourceName(rn, proxy.VerifiedIdentity.Namespace, "", "")
-				if gatewayConfig.Namespace == proxy.VerifiedIdentity.Namespace && parse.Namespace == proxy.VerifiedIdentity.Namespace {
-					// Same namespace is always allowed
-					verifiedCertificateReferences.Insert(rn)
-				} else if ps.ReferenceAllowed(gvk.Secret, rn, proxy.VerifiedIdentity.Namespace) {
-					// Explicitly allowed by some policy
-					verifiedCertificateReferences.Insert(rn)
+			credentialNames := serverCredentialNames(gatewayConfig, s)
+			if proxy.VerifiedIdentity != nil {
+				for _, cn := range credentialNames {
+					rn := credentials.ToResourceName(cn)
+					parse, _ := credentials.ParseResourceName(rn, proxy.VerifiedIdentity.Namespace, "", "")
+					if gatewayConfig.Namespace == proxy.VerifiedIdentity.Namespace && parse.Namespace == proxy.VerifiedIdentity.Namespace {
+						// Same namespace is always allowed
+						verifiedCertificateReferences.Insert(rn)
+					} else if ps.ReferenceAllowed(gvk.Secret, rn, proxy.VerifiedIdentity.Namespace) {
+						// Explicitly allowed by some policy
+						verifiedCertificateReferences.Insert(rn)
+					}
 				}
 			}
 			for _, resolvedPort := range resolvePorts(s.Port.Number, gwAndInstance.instances, gwAndInstance.legacyGatewaySelector) {
@@ -198,6 +208,9 @@ func MergeGateways(gateways []gatewayWithInstances, proxy *Proxy, ps *PushContex
 						continue
 					}
 					tlsServerInfo[s] = &TLSServerInfo{SNIHosts: GetSNIHostsForServer(s), RouteName: routeName}
+					if len(credentialNames) > 1 {
+						tlsServerInfo[s].CredentialNames = credentialNames
+					}
 					if s.Tls.Mode == networking.ServerTLSSettings_AUTO_PASSTHROUGH {
 						autoPassthrough = true
 					}
@@ -335,6 +348,19 @@ func MergeGateways(gateways []gatewayWithInstances, proxy *Proxy, ps *PushContex
 	}
 }
 
+// serverCredentialNames returns the credentials served by a server: the ones declared by the
+// InternalCredentialNamesAnnotation of its Gateway if set, and otherwise its CredentialName.
+func serverCredentialNames(gw config.Config, s *networking.Server) []string {
+	cn := s.GetTls().GetCredentialName()
+	if cn == "" {
+		return nil
+	}
+	if names := gw.Annotations[InternalCredentialNamesAnnotation]; names != "" {
+		return strings.Split(names, ",")
+	}
+	return []string{cn}
+}
+
 func udpSupportedPort(number uint32, instances []*ServiceInstance) bool {
 	for _, w := range instances {
 		if int(number) == w.ServicePort.Port && w.ServicePort.Protocol == protocol.UDP {
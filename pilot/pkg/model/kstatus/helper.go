@@ -15,8 +15,7 @@
 package kstatus
 
 import (
-	"reflect"
-
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"istio.io/istio/pkg/config"
@@ -57,11 +56,15 @@ func (w *WrappedStatus) Mutate(f func(s config.Status) config.Status) {
 	if w.Status == nil {
 		return
 	}
+	if w.Dirty {
+		// Already modified, there is no need to track further changes.
+		w.Status = f(w.Status)
+		return
+	}
 	old := config.DeepCopy(w.Status)
 	w.Status = f(w.Status)
-	// TODO: change this to be more efficient. Likely we allow modifications via WrappedStatus that
-	// modify specific things (ie conditions).
-	if !reflect.DeepEqual(old, w.Status) {
+	// Compare semantically, so nil and empty lists, or the same time in different locations, are not a change.
+	if !equality.Semantic.DeepEqual(old, w.Status) {
 		w.Dirty = true
 	}
 }
@@ -1170,11 +1170,12 @@ func (ps *PushContext) updateContext(
 		case gvk.RequestAuthentication,
 			gvk.PeerAuthentication:
 			authnChanged = true
-		case gvk.HTTPRoute, gvk.TCPRoute, gvk.GatewayClass, gvk.KubernetesGateway, gvk.TLSRoute:
+		case gvk.HTTPRoute, gvk.TCPRoute, gvk.GatewayClass, gvk.KubernetesGateway, gvk.TLSRoute, gvk.ReferencePolicy:
 			gatewayAPIChanged = true
-			// VS and GW are derived from gatewayAPI, so if it changed we need to update those as well
+			// VS, GW and EnvoyFilter are derived from gatewayAPI, so if it changed we need to update those as well
 			virtualServicesChanged = true
 			gatewayChanged = true
+			envoyFiltersChanged = true
 		case gvk.Telemetry:
 			telemetryChanged = true
 		}
@@ -1964,10 +1965,18 @@ func (ps *PushContext) mergeGateways(proxy *Proxy) *MergedGateway {
 // GatewayContext contains a minimal subset of push context functionality to be exposed to GatewayAPIControllers
 type GatewayContext struct {
 	ps *PushContext
+	// domainSuffix is the cluster domain of the Environment the push context was computed for.
+	domainSuffix string
 }
 
 func NewGatewayContext(ps *PushContext) GatewayContext {
-	return GatewayContext{ps}
+	return GatewayContext{ps: ps}
+}
+
+// DomainSuffix returns the cluster domain, typically cluster.local, that gateway-api resources should be converted
+// with. It is empty if unknown, in which case the controller default applies.
+func (gc GatewayContext) DomainSuffix() string {
+	return gc.domainSuffix
 }
 
 // ResolveGatewayInstances attempts to resolve all instances that a gateway will be exposed on.
@@ -2119,7 +2128,7 @@ func (ps *PushContext) ServiceInstancesByPort(svc *Service, port int, labels lab
 func (ps *PushContext) initKubernetesGateways(env *Environment) error {
 	if env.GatewayAPIController != nil {
 		ps.GatewayAPIController = env.GatewayAPIController
-		return env.GatewayAPIController.Recompute(GatewayContext{ps})
+		return env.GatewayAPIController.Recompute(GatewayContext{ps: ps, domainSuffix: env.DomainSuffix})
 	}
 	return nil
 }
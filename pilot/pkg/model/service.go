@@ -298,6 +298,9 @@ func WorkloadInstancesEqual(first, second *WorkloadInstance) bool {
 	if first.Endpoint.GetLoadBalancingWeight() != second.Endpoint.GetLoadBalancingWeight() {
 		return false
 	}
+	if first.Endpoint.HealthStatus != second.Endpoint.HealthStatus {
+		return false
+	}
 	if first.Namespace != second.Namespace {
 		return false
 	}
@@ -430,6 +433,25 @@ type IstioEndpoint struct {
 
 	// Determines the discoverability of this endpoint throughout the mesh.
 	DiscoverabilityPolicy EndpointDiscoverabilityPolicy `json:"-"`
+
+	// HealthStatus indicates whether the endpoint is ready to serve traffic. Registries map their own
+	// health signals (EndpointSlice conditions, WorkloadEntry health checks) onto this field.
+	HealthStatus HealthStatus
+}
+
+// HealthStatus indicates the health of an endpoint.
+type HealthStatus int32
+
+const (
+	// Healthy indicates the endpoint is ready to serve traffic. This is the default.
+	Healthy HealthStatus = iota
+	// UnHealthy indicates the endpoint is not ready to serve traffic, and should not receive any.
+	UnHealthy
+)
+
+// IsHealthy returns true if the endpoint is ready to serve traffic.
+func (ep *IstioEndpoint) IsHealthy() bool {
+	return ep.HealthStatus != UnHealthy
 }
 
 // GetLoadBalancingWeight returns the weight for this endpoint, normalized to always be > 0.
@@ -15,7 +15,10 @@
 package model
 
 import (
+	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -32,21 +35,199 @@ import (
 	"istio.io/api/envoy/extensions/stats"
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	tpb "istio.io/api/telemetry/v1alpha1"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/networking"
 	"istio.io/istio/pilot/pkg/util/sets"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/validation"
 	"istio.io/istio/pkg/util/protomarshal"
 	istiolog "istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
 )
 
 var telemetryLog = istiolog.RegisterScope("telemetry", "Istio Telemetry", 0)
 
+var ignoredGatewayTelemetryOverrides = monitoring.NewGauge(
+	"pilot_telemetry_gateway_overrides_ignored",
+	"Number of Telemetry resources outside the root namespace whose provider selection is ignored for gateways.",
+)
+
+const (
+	// unknownProviderReason is the reason for ignoring a reference to a provider missing from the mesh config.
+	unknownProviderReason = "unknown_provider"
+	// invalidOverrideReason is the reason for ignoring an invalid override annotation.
+	invalidOverrideReason = "invalid_override"
+	// invalidTracingTagReason is the reason for ignoring a custom tracing tag with an invalid name.
+	invalidTracingTagReason = "invalid_tracing_tag"
+)
+
+var (
+	telemetryReasonTag = monitoring.MustCreateLabel("reason")
+
+	ignoredTelemetryConfigs = monitoring.NewSum(
+		"pilot_telemetry_ignored_configs",
+		"Total number of ignored Telemetry configurations, such as references to unknown providers or invalid "+
+			"override annotations, by reason. Each is counted once per resource generation.",
+		monitoring.WithLabels(telemetryReasonTag),
+	)
+)
+
+var (
+	telemetryProviderTag = monitoring.MustCreateLabel("provider")
+
+	telemetryFilterErrors = monitoring.NewSum(
+		"pilot_telemetry_filter_errors",
+		"Total number of telemetry filters skipped because their configuration could not be generated, by provider.",
+		monitoring.WithLabels(telemetryProviderTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(ignoredGatewayTelemetryOverrides, ignoredTelemetryConfigs, telemetryFilterErrors)
+}
+
+// marshalFilterConfig encodes the configuration of a telemetry filter. It is a variable so tests can inject failures.
+var marshalFilterConfig = protomarshal.MarshalProtoNames
+
+// skipTelemetryFilter reports a telemetry filter that is skipped, as its configuration could not be generated.
+// The filters of the other providers are still applied.
+func skipTelemetryFilter(provider *meshconfig.MeshConfig_ExtensionProvider, err error) {
+	telemetryFilterErrors.With(telemetryProviderTag.Value(provider.GetName())).Increment()
+	telemetryLog.Errorf("failed to generate telemetry filter for provider %s, skipping it: %v", provider.GetName(), err)
+}
+
+// telemetryIssue describes configuration of a Telemetry resource that is ignored.
+type telemetryIssue struct {
+	reason  string
+	message string
+}
+
+// telemetryIssues collects the configuration of a Telemetry resource that is ignored.
+type telemetryIssues []telemetryIssue
+
+func (i *telemetryIssues) add(reason string, format string, args ...interface{}) {
+	*i = append(*i, telemetryIssue{reason: reason, message: fmt.Sprintf(format, args...)})
+}
+
+// telemetryIssueKey identifies an issue of a generation of a Telemetry resource.
+type telemetryIssueKey struct {
+	namespace  string
+	name       string
+	generation int64
+	telemetryIssue
+}
+
+// reportedTelemetryIssues holds the issues of the current Telemetry resources which were already reported. Telemetry
+// resources are processed on every push, so this ensures each issue is logged and counted once.
+var reportedTelemetryIssues = struct {
+	sync.Mutex
+	keys map[telemetryIssueKey]struct{}
+}{keys: map[telemetryIssueKey]struct{}{}}
+
+// reportTelemetryIssues logs and counts the issues of the current Telemetry resources which were not reported yet.
+// Issues of resources which were updated or removed are forgotten.
+func reportTelemetryIssues(issues []telemetryIssueKey) {
+	reportedTelemetryIssues.Lock()
+	defer reportedTelemetryIssues.Unlock()
+	current := make(map[telemetryIssueKey]struct{}, len(issues))
+	for _, key := range issues {
+		current[key] = struct{}{}
+		if _, f := reportedTelemetryIssues.keys[key]; f {
+			continue
+		}
+		telemetryLog.Warnf("ignoring configuration of Telemetry %s/%s: %s", key.namespace, key.name, key.message)
+		ignoredTelemetryConfigs.With(telemetryReasonTag.Value(key.reason)).Increment()
+	}
+	reportedTelemetryIssues.keys = current
+}
+
+// unknownProviders reports the providers referenced by the Telemetry which are not defined in the mesh config. The
+// references are ignored.
+func unknownProviders(spec *tpb.Telemetry, mesh *meshconfig.MeshConfig, issues *telemetryIssues) {
+	known := sets.NewSet()
+	for _, p := range mesh.GetExtensionProviders() {
+		known.Insert(strings.ToLower(p.Name))
+	}
+	refs := []*tpb.ProviderRef{}
+	for _, m := range spec.GetMetrics() {
+		refs = append(refs, m.Providers...)
+	}
+	for _, t := range spec.GetTracing() {
+		refs = append(refs, t.Providers...)
+	}
+	for _, l := range spec.GetAccessLogging() {
+		refs = append(refs, l.Providers...)
+	}
+	reported := sets.NewSet()
+	for _, ref := range refs {
+		name := strings.ToLower(ref.GetName())
+		if known.Contains(name) || reported.Contains(name) {
+			continue
+		}
+		reported.Insert(name)
+		issues.add(unknownProviderReason, "provider %q is not defined in the mesh config", ref.GetName())
+	}
+}
+
 // Telemetry holds configuration for Telemetry API resources.
 type Telemetry struct {
 	Name      string         `json:"name"`
 	Namespace string         `json:"namespace"`
 	Spec      *tpb.Telemetry `json:"spec"`
+	// UpstreamTracingTags overrides whether upstream tags are added to trace spans, if set.
+	UpstreamTracingTags *bool `json:"upstreamTracingTags,omitempty"`
+	// TCPMetricsDisabledPorts overrides the set of ports TCP metrics are not reported for, if set.
+	TCPMetricsDisabledPorts []uint32 `json:"tcpMetricsDisabledPorts,omitempty"`
+	// ClientSamplingPercentage overrides the client sampling percentage for tracing, if set.
+	ClientSamplingPercentage *float64 `json:"clientSamplingPercentage,omitempty"`
+	// OverallSamplingPercentage overrides the overall sampling percentage for tracing, if set.
+	OverallSamplingPercentage *float64 `json:"overallSamplingPercentage,omitempty"`
+	// InboundTracing and OutboundTracing override the tracing configuration for a single traffic direction, if set.
+	InboundTracing  TracingDirection `json:"inboundTracing,omitempty"`
+	OutboundTracing TracingDirection `json:"outboundTracing,omitempty"`
+	// TracingLabelTags are span tags set from the labels of the workload, keyed by tag name.
+	TracingLabelTags map[string]TracingLabelTag `json:"tracingLabelTags,omitempty"`
+	// TracingTagMaxLengths are the maximum lengths of the values of span tags, keyed by tag name.
+	TracingTagMaxLengths map[string]uint32 `json:"tracingTagMaxLengths,omitempty"`
+	// AccessLogSampling are the percentages of the traffic logged by access logging providers, keyed by the lower
+	// case provider name.
+	AccessLogSampling map[string]float64 `json:"accessLogSampling,omitempty"`
+	// AccessLogErrors overrides whether failed requests and connections are logged regardless of sampling, if set.
+	AccessLogErrors *bool `json:"accessLogErrors,omitempty"`
+}
+
+// TracingLabelTag is a span tag set to the value of a label of the workload.
+type TracingLabelTag struct {
+	Label string `json:"label"`
+	// DefaultValue is used when the workload does not have the label. If empty, the tag is omitted.
+	DefaultValue string `json:"defaultValue,omitempty"`
+}
+
+// TracingDirection holds tracing settings scoped to a single traffic direction. Unset fields fall back to the
+// settings for both directions.
+type TracingDirection struct {
+	Disabled                 *bool    `json:"disabled,omitempty"`
+	RandomSamplingPercentage *float64 `json:"randomSamplingPercentage,omitempty"`
+}
+
+// merge overrides the settings of d with the settings set in o.
+func (d *TracingDirection) merge(o TracingDirection) {
+	if o.Disabled != nil {
+		d.Disabled = o.Disabled
+	}
+	if o.RandomSamplingPercentage != nil {
+		d.RandomSamplingPercentage = o.RandomSamplingPercentage
+	}
+}
+
+// tracingDirectionOverrides are the direction scoped tracing overrides of a single Telemetry. They apply after the
+// first `after` entries of the merged tracing configuration, that is after the entries of the same Telemetry.
+type tracingDirectionOverrides struct {
+	after    int
+	inbound  TracingDirection
+	outbound TracingDirection
 }
 
 // Telemetries organizes Telemetry configuration by namespace.
@@ -60,6 +241,21 @@ type Telemetries struct {
 	// Computed meshConfig
 	meshConfig *meshconfig.MeshConfig
 
+	// namespaceSampling holds the default trace sampling percentage per namespace, set through
+	// PILOT_TRACE_NAMESPACE_SAMPLING.
+	namespaceSampling map[string]float64
+
+	// metricDimensions are added to every standard metric, set through PILOT_MESH_METRIC_DIMENSIONS.
+	metricDimensions map[string]string
+
+	// metricsCanonicalIdentity adds the canonical identity of the proxy to every standard metric, set through
+	// PILOT_METRICS_CANONICAL_IDENTITY.
+	metricsCanonicalIdentity bool
+
+	// gatewayRootNamespaceOnly restricts the provider selection of gateways to the root namespace Telemetry,
+	// set through PILOT_GATEWAY_TELEMETRY_ROOT_NAMESPACE_ONLY.
+	gatewayRootNamespaceOnly bool
+
 	// computedMetricsFilters contains the set of cached HCM/listener filters for the metrics portion.
 	// These filters are extremely costly, as we insert them into every listener on every proxy, and to
 	// generate them we need to merge many telemetry specs and perform 2 Any marshals.
@@ -82,6 +278,8 @@ type telemetryKey struct {
 	Namespace NamespacedName
 	// Workload stores the Telemetry in the root namespace, if any
 	Workload NamespacedName
+	// RootProvidersOnly is set when providers are only selected by the root namespace Telemetry.
+	RootProvidersOnly bool
 }
 
 // metricsKey defines a key into the computedMetricsFilters cache.
@@ -89,15 +287,60 @@ type metricsKey struct {
 	telemetryKey
 	Class    networking.ListenerClass
 	Protocol networking.ListenerProtocol
+	// MetricsDisabled is set when metrics are disabled for the listener port.
+	MetricsDisabled bool
+	// Format is the telemetry filter format supported by the proxy.
+	Format telemetryFormat
+	// Identity is the canonical identity of the proxy, set only when it is added to the metrics.
+	Identity CanonicalIdentity
+}
+
+// telemetryFormat is the format of the generated telemetry filter configuration. New provider
+// configuration is only generated for proxies that understand it, as older proxies reject it; this allows
+// the same Telemetry resources to be applied to a mesh running multiple proxy versions.
+type telemetryFormat int
+
+const (
+	// telemetryFormatLegacy is supported by all proxies.
+	telemetryFormatLegacy telemetryFormat = iota
+	// telemetryFormatHostHeaderFallback allows disabling the host header fallback in the stats and
+	// stackdriver filters. Supported by 1.12+ proxies.
+	telemetryFormatHostHeaderFallback
+)
+
+// telemetryFormatMinVersions holds the minimum proxy version for each telemetry format newer than legacy.
+// New formats must be added in increasing order.
+var telemetryFormatMinVersions = []struct {
+	format  telemetryFormat
+	version *IstioVersion
+}{
+	{telemetryFormatHostHeaderFallback, &IstioVersion{Major: 1, Minor: 12, Patch: -1}},
+}
+
+// telemetryFormatForProxy returns the newest telemetry format the proxy supports. Proxies with an unknown
+// version are assumed to be current.
+func telemetryFormatForProxy(proxy *Proxy) telemetryFormat {
+	format := telemetryFormatLegacy
+	for _, v := range telemetryFormatMinVersions {
+		if proxy.IstioVersion != nil && proxy.IstioVersion.Compare(v.version) < 0 {
+			break
+		}
+		format = v.format
+	}
+	return format
 }
 
 // getTelemetries returns the Telemetry configurations for the given environment.
 func getTelemetries(env *Environment) (*Telemetries, error) {
 	telemetries := &Telemetries{
-		namespaceToTelemetries: map[string][]Telemetry{},
-		rootNamespace:          env.Mesh().GetRootNamespace(),
-		meshConfig:             env.Mesh(),
-		computedMetricsFilters: map[metricsKey]interface{}{},
+		namespaceToTelemetries:   map[string][]Telemetry{},
+		rootNamespace:            env.Mesh().GetRootNamespace(),
+		meshConfig:               env.Mesh(),
+		namespaceSampling:        features.TraceNamespaceSampling,
+		metricDimensions:         meshMetricDimensions,
+		metricsCanonicalIdentity: features.MetricsCanonicalIdentity,
+		gatewayRootNamespaceOnly: features.GatewayTelemetryRootNamespaceOnly,
+		computedMetricsFilters:   map[metricsKey]interface{}{},
 	}
 
 	fromEnv, err := env.List(collections.IstioTelemetryV1Alpha1Telemetries.Resource().GroupVersionKind(), NamespaceAll)
@@ -105,19 +348,299 @@ func getTelemetries(env *Environment) (*Telemetries, error) {
 		return nil, err
 	}
 	sortConfigByCreationTime(fromEnv)
+	var allIssues []telemetryIssueKey
 	for _, config := range fromEnv {
+		issues := &telemetryIssues{}
 		telemetry := Telemetry{
-			Name:      config.Name,
-			Namespace: config.Namespace,
-			Spec:      config.Spec.(*tpb.Telemetry),
+			Name:                      config.Name,
+			Namespace:                 config.Namespace,
+			Spec:                      config.Spec.(*tpb.Telemetry),
+			UpstreamTracingTags:       upstreamTracingTagsOverride(config.Annotations, issues),
+			TCPMetricsDisabledPorts:   tcpMetricsDisabledPortsOverride(config.Annotations, issues),
+			ClientSamplingPercentage:  samplingPercentageOverride(config.Annotations, constants.TelemetryTracingClientSampling, issues),
+			OverallSamplingPercentage: samplingPercentageOverride(config.Annotations, constants.TelemetryTracingOverallSampling, issues),
+			InboundTracing: TracingDirection{
+				Disabled:                 boolOverride(config.Annotations, constants.TelemetryTracingInboundDisabled, issues),
+				RandomSamplingPercentage: samplingPercentageOverride(config.Annotations, constants.TelemetryTracingInboundSampling, issues),
+			},
+			OutboundTracing: TracingDirection{
+				Disabled:                 boolOverride(config.Annotations, constants.TelemetryTracingOutboundDisabled, issues),
+				RandomSamplingPercentage: samplingPercentageOverride(config.Annotations, constants.TelemetryTracingOutboundSampling, issues),
+			},
+			TracingLabelTags:     tracingLabelTagsOverride(config.Annotations, issues),
+			TracingTagMaxLengths: tracingTagMaxLengthsOverride(config.Annotations, issues),
+			AccessLogSampling:    accessLogSamplingOverride(config.Annotations, issues),
+			AccessLogErrors:      boolOverride(config.Annotations, constants.TelemetryAccessLogErrors, issues),
+		}
+		unknownProviders(telemetry.Spec, telemetries.meshConfig, issues)
+		telemetry.Spec = withValidTracingTags(telemetry.Spec, issues)
+		for _, issue := range *issues {
+			allIssues = append(allIssues, telemetryIssueKey{
+				namespace:      config.Namespace,
+				name:           config.Name,
+				generation:     config.Generation,
+				telemetryIssue: issue,
+			})
 		}
 		telemetries.namespaceToTelemetries[config.Namespace] =
 			append(telemetries.namespaceToTelemetries[config.Namespace], telemetry)
 	}
+	reportTelemetryIssues(allIssues)
+
+	if telemetries.gatewayRootNamespaceOnly {
+		ignored := 0
+		for ns, tels := range telemetries.namespaceToTelemetries {
+			if ns == telemetries.rootNamespace {
+				continue
+			}
+			for _, tel := range tels {
+				if overridesProviders(tel) {
+					ignored++
+				}
+			}
+		}
+		ignoredGatewayTelemetryOverrides.Record(float64(ignored))
+	}
 
 	return telemetries, nil
 }
 
+// withValidTracingTags returns the Telemetry without the custom tracing tags whose names are invalid, reporting them.
+// These are normally rejected by validation. Of the tags differing only by case, the first in sorted order is kept.
+// The spec is only copied if tags are removed.
+func withValidTracingTags(spec *tpb.Telemetry, issues *telemetryIssues) *tpb.Telemetry {
+	res := spec
+	for i, tr := range spec.GetTracing() {
+		invalid := sets.NewSet()
+		for _, name := range sortedTagNames(tr.GetCustomTags()) {
+			if err := validation.ValidateTracingTagName(name); err != nil {
+				issues.add(invalidTracingTagReason, "invalid custom tracing tag: %v", err)
+				invalid.Insert(name)
+			}
+		}
+		for _, name := range validation.DuplicateTracingTagNames(tr.GetCustomTags()) {
+			if !invalid.Contains(name) {
+				issues.add(invalidTracingTagReason, "custom tracing tag %q differs only by case from another tag", name)
+				invalid.Insert(name)
+			}
+		}
+		if invalid.Empty() {
+			continue
+		}
+		if res == spec {
+			res = spec.DeepCopy()
+		}
+		tags := make(map[string]*tpb.Tracing_CustomTag, len(tr.CustomTags))
+		for name, tag := range tr.CustomTags {
+			if !invalid.Contains(name) {
+				tags[name] = tag
+			}
+		}
+		res.Tracing[i].CustomTags = tags
+	}
+	return res
+}
+
+func sortedTagNames(tags map[string]*tpb.Tracing_CustomTag) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overridesProviders returns true if the Telemetry selects or disables providers.
+func overridesProviders(t Telemetry) bool {
+	for _, m := range t.Spec.GetMetrics() {
+		if len(m.Providers) > 0 {
+			return true
+		}
+	}
+	for _, l := range t.Spec.GetAccessLogging() {
+		if len(l.Providers) > 0 || l.Disabled != nil {
+			return true
+		}
+	}
+	for _, tr := range t.Spec.GetTracing() {
+		if len(tr.Providers) > 0 || tr.DisableSpanReporting != nil {
+			return true
+		}
+	}
+	return t.InboundTracing.Disabled != nil || t.OutboundTracing.Disabled != nil
+}
+
+// withoutProviderOverrides returns the configuration of a Telemetry with the provider selection and disablement
+// removed. Entries left without any configuration are dropped.
+func withoutProviderOverrides(t Telemetry) ([]*tpb.Metrics, []*tpb.Tracing, Telemetry) {
+	var ms []*tpb.Metrics
+	for _, m := range t.Spec.GetMetrics() {
+		if len(m.Overrides) == 0 {
+			continue
+		}
+		ms = append(ms, &tpb.Metrics{Overrides: m.Overrides})
+	}
+	var ts []*tpb.Tracing
+	for _, tr := range t.Spec.GetTracing() {
+		if tr.RandomSamplingPercentage == nil && len(tr.CustomTags) == 0 {
+			continue
+		}
+		ts = append(ts, &tpb.Tracing{
+			RandomSamplingPercentage: tr.RandomSamplingPercentage,
+			CustomTags:               tr.CustomTags,
+		})
+	}
+	t.InboundTracing.Disabled = nil
+	t.OutboundTracing.Disabled = nil
+	// Access logging entries only select or disable providers. The access log sampling overrides are kept.
+	return ms, ts, t
+}
+
+// upstreamTracingTagsOverride parses the upstream tracing tags annotation, if present.
+func upstreamTracingTagsOverride(annotations map[string]string, issues *telemetryIssues) *bool {
+	return boolOverride(annotations, constants.TelemetryUpstreamTracingTags, issues)
+}
+
+// boolOverride parses a boolean annotation, if present.
+func boolOverride(annotations map[string]string, annotation string, issues *telemetryIssues) *bool {
+	v, f := annotations[annotation]
+	if !f {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		issues.add(invalidOverrideReason, "invalid value %q for annotation %s: %v", v, annotation, err)
+		return nil
+	}
+	return &b
+}
+
+// samplingPercentageOverride parses a sampling percentage annotation, if present.
+func samplingPercentageOverride(annotations map[string]string, annotation string, issues *telemetryIssues) *float64 {
+	v, f := annotations[annotation]
+	if !f {
+		return nil
+	}
+	percentage, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		issues.add(invalidOverrideReason, "invalid value %q for annotation %s: %v", v, annotation, err)
+		return nil
+	}
+	if percentage < 0.0 || percentage > 100.0 {
+		issues.add(invalidOverrideReason, "invalid value %q for annotation %s: must be between 0.0 and 100.0", v, annotation)
+		return nil
+	}
+	return &percentage
+}
+
+// tracingLabelTagsOverride parses the tracing label tags annotation, if present.
+func tracingLabelTagsOverride(annotations map[string]string, issues *telemetryIssues) map[string]TracingLabelTag {
+	v, f := annotations[constants.TelemetryTracingLabelTags]
+	if !f {
+		return nil
+	}
+	tags := map[string]TracingLabelTag{}
+	for _, t := range strings.Split(v, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			issues.add(invalidOverrideReason, "invalid tag %q in annotation %s: must be tag=label or tag=label:default", t,
+				constants.TelemetryTracingLabelTags)
+			continue
+		}
+		// Label names cannot contain a colon, so the default is everything after the first one
+		tag := TracingLabelTag{Label: kv[1]}
+		if i := strings.Index(kv[1], ":"); i >= 0 {
+			tag = TracingLabelTag{Label: kv[1][:i], DefaultValue: kv[1][i+1:]}
+		}
+		tags[kv[0]] = tag
+	}
+	return tags
+}
+
+// tracingTagMaxLengthsOverride parses the tracing tag max length annotation, if present. A length of 0 leaves the
+// tag unlimited.
+func tracingTagMaxLengthsOverride(annotations map[string]string, issues *telemetryIssues) map[string]uint32 {
+	v, f := annotations[constants.TelemetryTracingTagMaxLength]
+	if !f {
+		return nil
+	}
+	lengths := map[string]uint32{}
+	for _, t := range strings.Split(v, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			issues.add(invalidOverrideReason, "invalid tag %q in annotation %s: must be tag=length", t, constants.TelemetryTracingTagMaxLength)
+			continue
+		}
+		length, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			issues.add(invalidOverrideReason, "invalid length for tag %q in annotation %s: %v", kv[0], constants.TelemetryTracingTagMaxLength, err)
+			continue
+		}
+		lengths[kv[0]] = uint32(length)
+	}
+	return lengths
+}
+
+// accessLogSamplingOverride parses the access log sampling annotation, if present.
+func accessLogSamplingOverride(annotations map[string]string, issues *telemetryIssues) map[string]float64 {
+	v, f := annotations[constants.TelemetryAccessLogSampling]
+	if !f {
+		return nil
+	}
+	sampling := map[string]float64{}
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			issues.add(invalidOverrideReason, "invalid provider %q in annotation %s: must be provider=percentage", p,
+				constants.TelemetryAccessLogSampling)
+			continue
+		}
+		percentage, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || percentage < 0.0 || percentage > 100.0 {
+			issues.add(invalidOverrideReason, "invalid percentage for provider %q in annotation %s: must be between 0.0 and 100.0",
+				kv[0], constants.TelemetryAccessLogSampling)
+			continue
+		}
+		sampling[strings.ToLower(kv[0])] = percentage
+	}
+	return sampling
+}
+
+// tcpMetricsDisabledPortsOverride parses the TCP metrics disabled ports annotation, if present. An empty value
+// explicitly enables TCP metrics on all ports.
+func tcpMetricsDisabledPortsOverride(annotations map[string]string, issues *telemetryIssues) []uint32 {
+	v, f := annotations[constants.TelemetryDisableTCPMetricsPorts]
+	if !f {
+		return nil
+	}
+	ports := []uint32{}
+	for _, p := range strings.Split(v, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			issues.add(invalidOverrideReason, "invalid port %q in annotation %s: %v", p, constants.TelemetryDisableTCPMetricsPorts, err)
+			continue
+		}
+		ports = append(ports, uint32(port))
+	}
+	return ports
+}
+
 type metricsConfig struct {
 	ClientMetrics []metricsOverride
 	ServerMetrics []metricsOverride
@@ -128,6 +651,11 @@ type telemetryFilterConfig struct {
 	Provider      *meshconfig.MeshConfig_ExtensionProvider
 	Metrics       bool
 	AccessLogging bool
+	// DropMetrics is set when metrics are explicitly disabled, for example for a port. Providers that report
+	// metrics regardless of the metrics configuration should drop them.
+	DropMetrics bool
+	// Format is the telemetry filter format supported by the proxy.
+	Format telemetryFormat
 }
 
 func (t telemetryFilterConfig) MetricsForClass(c networking.ListenerClass) []metricsOverride {
@@ -162,17 +690,83 @@ type computedTelemetries struct {
 	Metrics []*tpb.Metrics
 	Logging []*tpb.AccessLogging
 	Tracing []*tpb.Tracing
+	// UpstreamTracingTags is the most specific upstream tracing tags override, if any.
+	UpstreamTracingTags *bool
+	// TCPMetricsDisabledPorts is the most specific set of ports TCP metrics are disabled for, if any.
+	TCPMetricsDisabledPorts []uint32
+	// ClientSamplingPercentage is the most specific client sampling override, if any.
+	ClientSamplingPercentage *float64
+	// OverallSamplingPercentage is the most specific overall sampling override, if any.
+	OverallSamplingPercentage *float64
+	// MetricsDisabled is set when metrics are disabled for the workload by annotation.
+	MetricsDisabled bool
+	// TracingDirections are the direction scoped tracing overrides, from least to most specific.
+	TracingDirections []tracingDirectionOverrides
+	// TracingLabelTags merges the tracing label tags of all levels, more specific levels overriding tags of the
+	// same name.
+	TracingLabelTags map[string]TracingLabelTag
+	// TracingTagMaxLengths merges the tracing tag max lengths of all levels, more specific levels overriding tags of
+	// the same name.
+	TracingTagMaxLengths map[string]uint32
+	// AccessLogSampling merges the access log sampling of all levels, more specific levels overriding the sampling
+	// of the same provider.
+	AccessLogSampling map[string]float64
+	// AccessLogErrors is the most specific access log errors override, if any.
+	AccessLogErrors *bool
 }
 
 type TracingConfig struct {
 	Provider                 *meshconfig.MeshConfig_ExtensionProvider
 	Disabled                 bool
 	RandomSamplingPercentage float64
-	CustomTags               map[string]*tpb.Tracing_CustomTag
+	// ClientSamplingPercentage is the percentage of requests traced when the client forces tracing. If unset,
+	// the mesh-wide default is used.
+	ClientSamplingPercentage *float64
+	// OverallSamplingPercentage caps the percentage of requests traced, after all other sampling decisions. If
+	// unset, the mesh-wide default is used.
+	OverallSamplingPercentage *float64
+	CustomTags                map[string]*tpb.Tracing_CustomTag
+	// UpstreamTags determines whether tags for the upstream cluster and peer are added to spans.
+	UpstreamTags bool
+	// Inbound and Outbound override Disabled and RandomSamplingPercentage for inbound and outbound traffic, if set.
+	Inbound  TracingDirection
+	Outbound TracingDirection
+	// LabelTags are span tags set from the labels of the proxy, keyed by tag name.
+	LabelTags map[string]TracingLabelTag
+	// TagMaxLengths are the maximum lengths of the values of span tags, keyed by tag name.
+	TagMaxLengths map[string]uint32
+}
+
+// ForClass returns whether tracing is disabled, and the random sampling percentage, for listeners of the given
+// class. Gateways are treated as outbound, matching the direction of their listeners.
+func (c *TracingConfig) ForClass(class networking.ListenerClass) (bool, float64) {
+	d := c.Outbound
+	if class == networking.ListenerClassSidecarInbound {
+		d = c.Inbound
+	}
+	disabled, sampling := c.Disabled, c.RandomSamplingPercentage
+	if d.Disabled != nil {
+		disabled = *d.Disabled
+	}
+	if d.RandomSamplingPercentage != nil {
+		sampling = *d.RandomSamplingPercentage
+	}
+	return disabled, sampling
 }
 
 type LoggingConfig struct {
 	Providers []*meshconfig.MeshConfig_ExtensionProvider
+	// Sampling holds the percentage of the traffic logged by providers that do not log everything, keyed by the
+	// lower case provider name.
+	Sampling map[string]float64
+	// AlwaysLogErrors is set when failed requests and connections are logged regardless of Sampling.
+	AlwaysLogErrors bool
+}
+
+// SamplingPercentage returns the percentage of the traffic logged by the provider, and whether it is sampled at all.
+func (c *LoggingConfig) SamplingPercentage(provider string) (float64, bool) {
+	percentage, f := c.Sampling[strings.ToLower(provider)]
+	return percentage, f
 }
 
 // AccessLogging returns the logging configuration for a given proxy. If nil is returned, access logs
@@ -187,9 +781,19 @@ func (t *Telemetries) AccessLogging(proxy *Proxy) *LoggingConfig {
 	providers := mergeLogs(ct.Logging, t.meshConfig)
 	for _, p := range providers.SortedList() {
 		fp := t.fetchProvider(p)
-		if fp != nil {
-			cfg.Providers = append(cfg.Providers, fp)
+		if fp == nil {
+			continue
 		}
+		cfg.Providers = append(cfg.Providers, fp)
+		if percentage, f := ct.AccessLogSampling[strings.ToLower(fp.Name)]; f {
+			if cfg.Sampling == nil {
+				cfg.Sampling = map[string]float64{}
+			}
+			cfg.Sampling[strings.ToLower(fp.Name)] = percentage
+		}
+	}
+	if ct.AccessLogErrors != nil {
+		cfg.AlwaysLogErrors = *ct.AccessLogErrors
 	}
 	return &cfg
 }
@@ -219,13 +823,31 @@ func (t *Telemetries) Tracing(proxy *Proxy) *TracingConfig {
 	supportedProvider := providerNames[0]
 
 	cfg := TracingConfig{
-		Provider: t.fetchProvider(supportedProvider),
+		Provider:                  t.fetchProvider(supportedProvider),
+		ClientSamplingPercentage:  ct.ClientSamplingPercentage,
+		OverallSamplingPercentage: ct.OverallSamplingPercentage,
+		UpstreamTags:              features.EnableUpstreamTracingTags,
+		LabelTags:                 ct.TracingLabelTags,
+		TagMaxLengths:             ct.TracingTagMaxLengths,
+	}
+	if ct.UpstreamTracingTags != nil {
+		cfg.UpstreamTags = *ct.UpstreamTracingTags
 	}
 	if cfg.Provider == nil {
 		cfg.Disabled = true
 		return &cfg
 	}
-	for _, m := range ct.Tracing {
+	// Direction scoped overrides apply in the same order as the Telemetries they are set on.
+	directions := ct.TracingDirections
+	applyDirections := func(applied int) {
+		for len(directions) > 0 && directions[0].after <= applied {
+			cfg.Inbound.merge(directions[0].inbound)
+			cfg.Outbound.merge(directions[0].outbound)
+			directions = directions[1:]
+		}
+	}
+	applyDirections(0)
+	for i, m := range ct.Tracing {
 		names := getProviderNames(m.Providers)
 
 		// We need to figure out if the tracing config at this level is relevant. For example, if we selected
@@ -249,6 +871,7 @@ func (t *Telemetries) Tracing(proxy *Proxy) *TracingConfig {
 		// Now merge in any overrides
 		if m.DisableSpanReporting != nil {
 			cfg.Disabled = m.DisableSpanReporting.GetValue()
+			cfg.Inbound.Disabled, cfg.Outbound.Disabled = nil, nil
 		}
 		// TODO: metrics overrides do a deep merge, but here we do a shallow merge.
 		// We should consider if we want to reconcile the two.
@@ -257,22 +880,109 @@ func (t *Telemetries) Tracing(proxy *Proxy) *TracingConfig {
 		}
 		if m.RandomSamplingPercentage != nil {
 			cfg.RandomSamplingPercentage = m.RandomSamplingPercentage.GetValue()
+			cfg.Inbound.RandomSamplingPercentage, cfg.Outbound.RandomSamplingPercentage = nil, nil
 		}
+		applyDirections(i + 1)
 	}
 	return &cfg
 }
 
+// TelemetrySummary is a compact summary of the telemetry decisions made for a proxy, to help debug missing
+// telemetry. Signals without a summary are not configured via Telemetry, and use fallback mechanisms.
+type TelemetrySummary struct {
+	Tracing       *TracingSummary       `json:"tracing,omitempty"`
+	AccessLogging *AccessLoggingSummary `json:"accessLogging,omitempty"`
+	Metrics       *MetricsSummary       `json:"metrics,omitempty"`
+}
+
+type TracingSummary struct {
+	Provider string          `json:"provider,omitempty"`
+	Inbound  TracingDecision `json:"inbound"`
+	Outbound TracingDecision `json:"outbound"`
+	// DisabledByAnnotation is set when the workload disables tracing by annotation, regardless of Telemetry.
+	DisabledByAnnotation bool `json:"disabledByAnnotation,omitempty"`
+}
+
+// TracingDecision is the tracing configuration of a traffic direction. A sampling percentage of 0 means the
+// sampling of the proxy config applies.
+type TracingDecision struct {
+	Disabled                 bool    `json:"disabled,omitempty"`
+	RandomSamplingPercentage float64 `json:"randomSamplingPercentage"`
+}
+
+type AccessLoggingSummary struct {
+	// Providers is empty if access logging is disabled.
+	Providers []string `json:"providers"`
+	// Sampling is the percentage of the traffic logged by sampled providers, keyed by lower case provider name.
+	Sampling        map[string]float64 `json:"sampling,omitempty"`
+	AlwaysLogErrors bool               `json:"alwaysLogErrors,omitempty"`
+}
+
+type MetricsSummary struct {
+	Providers []string `json:"providers"`
+	// DisabledByAnnotation is set when the workload disables metrics by annotation.
+	DisabledByAnnotation bool     `json:"disabledByAnnotation,omitempty"`
+	TCPDisabledPorts     []uint32 `json:"tcpDisabledPorts,omitempty"`
+}
+
+// Summary returns a summary of the telemetry configuration for a given proxy. It is computed from the same
+// configuration as Tracing and AccessLogging, so it always reflects the current Telemetries.
+func (t *Telemetries) Summary(proxy *Proxy) *TelemetrySummary {
+	summary := &TelemetrySummary{}
+	if tracing := t.Tracing(proxy); tracing != nil {
+		ts := &TracingSummary{}
+		if tracing.Provider != nil {
+			ts.Provider = tracing.Provider.Name
+		}
+		ts.Inbound.Disabled, ts.Inbound.RandomSamplingPercentage = tracing.ForClass(networking.ListenerClassSidecarInbound)
+		ts.Outbound.Disabled, ts.Outbound.RandomSamplingPercentage = tracing.ForClass(networking.ListenerClassSidecarOutbound)
+		summary.Tracing = ts
+	}
+	if proxy.TracingDisabledByAnnotation() {
+		if summary.Tracing == nil {
+			summary.Tracing = &TracingSummary{}
+		}
+		summary.Tracing.DisabledByAnnotation = true
+	}
+	if logging := t.AccessLogging(proxy); logging != nil {
+		ls := &AccessLoggingSummary{Providers: []string{}, Sampling: logging.Sampling}
+		for _, p := range logging.Providers {
+			ls.Providers = append(ls.Providers, p.Name)
+		}
+		if len(logging.Sampling) > 0 {
+			ls.AlwaysLogErrors = logging.AlwaysLogErrors
+		}
+		summary.AccessLogging = ls
+	}
+	ct := t.applicableTelemetries(proxy)
+	providers := sets.NewSet()
+	for p := range mergeMetrics(ct.Metrics, t.meshConfig, t.metricDimensions) {
+		if t.fetchProvider(p) != nil {
+			providers.Insert(p)
+		}
+	}
+	if len(providers) > 0 || ct.MetricsDisabled {
+		summary.Metrics = &MetricsSummary{
+			Providers:            providers.SortedList(),
+			DisabledByAnnotation: ct.MetricsDisabled,
+			TCPDisabledPorts:     ct.TCPMetricsDisabledPorts,
+		}
+	}
+	return summary
+}
+
 // HTTPFilters computes the HttpFilter for a given proxy/class
 func (t *Telemetries) HTTPFilters(proxy *Proxy, class networking.ListenerClass) []*hcm.HttpFilter {
-	if res := t.telemetryFilters(proxy, class, networking.ListenerProtocolHTTP); res != nil {
+	if res := t.telemetryFilters(proxy, class, networking.ListenerProtocolHTTP, 0); res != nil {
 		return res.([]*hcm.HttpFilter)
 	}
 	return nil
 }
 
-// TCPFilters computes the TCPFilters for a given proxy/class
-func (t *Telemetries) TCPFilters(proxy *Proxy, class networking.ListenerClass) []*listener.Filter {
-	if res := t.telemetryFilters(proxy, class, networking.ListenerProtocolTCP); res != nil {
+// TCPFilters computes the TCPFilters for a given proxy/class, for a listener on the given port. Metrics are
+// omitted if they are disabled for the port. A port of 0 is used for listeners that are not specific to a port.
+func (t *Telemetries) TCPFilters(proxy *Proxy, class networking.ListenerClass, port uint32) []*listener.Filter {
+	if res := t.telemetryFilters(proxy, class, networking.ListenerProtocolTCP, port); res != nil {
 		return res.([]*listener.Filter)
 	}
 	return nil
@@ -286,28 +996,102 @@ func (t *Telemetries) applicableTelemetries(proxy *Proxy) computedTelemetries {
 
 	namespace := proxy.ConfigNamespace
 	workload := labels.Collection{proxy.Metadata.Labels}
+	// Only the mesh admin selects the providers of gateways, through the root namespace Telemetry.
+	rootProvidersOnly := t.gatewayRootNamespaceOnly && proxy.Type == Router
 	// Order here matters. The latter elements will override the first elements
 	ms := []*tpb.Metrics{}
 	ls := []*tpb.AccessLogging{}
 	ts := []*tpb.Tracing{}
-	key := telemetryKey{}
+	key := telemetryKey{RootProvidersOnly: rootProvidersOnly}
+	var upstreamTags *bool
+	var tcpMetricsDisabledPorts []uint32
+	var clientSampling, overallSampling *float64
+	var tracingDirections []tracingDirectionOverrides
+	var labelTags map[string]TracingLabelTag
+	var tagMaxLengths map[string]uint32
+	var accessLogSampling map[string]float64
+	var accessLogErrors *bool
+	// applyOverrides applies the overrides set through annotations. More specific Telemetries override
+	// less specific ones. It must be called after the tracing configuration of the Telemetry is appended.
+	applyOverrides := func(telemetry Telemetry) {
+		if telemetry.InboundTracing != (TracingDirection{}) || telemetry.OutboundTracing != (TracingDirection{}) {
+			tracingDirections = append(tracingDirections, tracingDirectionOverrides{
+				after:    len(ts),
+				inbound:  telemetry.InboundTracing,
+				outbound: telemetry.OutboundTracing,
+			})
+		}
+		if telemetry.UpstreamTracingTags != nil {
+			upstreamTags = telemetry.UpstreamTracingTags
+		}
+		if telemetry.TCPMetricsDisabledPorts != nil {
+			tcpMetricsDisabledPorts = telemetry.TCPMetricsDisabledPorts
+		}
+		if telemetry.ClientSamplingPercentage != nil {
+			clientSampling = telemetry.ClientSamplingPercentage
+		}
+		if telemetry.OverallSamplingPercentage != nil {
+			overallSampling = telemetry.OverallSamplingPercentage
+		}
+		for name, tag := range telemetry.TracingLabelTags {
+			if labelTags == nil {
+				labelTags = map[string]TracingLabelTag{}
+			}
+			labelTags[name] = tag
+		}
+		for name, length := range telemetry.TracingTagMaxLengths {
+			if tagMaxLengths == nil {
+				tagMaxLengths = map[string]uint32{}
+			}
+			tagMaxLengths[name] = length
+		}
+		for provider, percentage := range telemetry.AccessLogSampling {
+			if accessLogSampling == nil {
+				accessLogSampling = map[string]float64{}
+			}
+			accessLogSampling[provider] = percentage
+		}
+		if telemetry.AccessLogErrors != nil {
+			accessLogErrors = telemetry.AccessLogErrors
+		}
+	}
+	// appendTelemetry appends the configuration of a Telemetry outside the root namespace.
+	appendTelemetry := func(telemetry Telemetry) {
+		if rootProvidersOnly {
+			var tms []*tpb.Metrics
+			var tts []*tpb.Tracing
+			tms, tts, telemetry = withoutProviderOverrides(telemetry)
+			ms = append(ms, tms...)
+			ts = append(ts, tts...)
+		} else {
+			ms = append(ms, telemetry.Spec.GetMetrics()...)
+			ls = append(ls, telemetry.Spec.GetAccessLogging()...)
+			ts = append(ts, telemetry.Spec.GetTracing()...)
+		}
+		applyOverrides(telemetry)
+	}
+	// The namespace default sampling overrides the root namespace Telemetry, but not the namespace Telemetry. For
+	// proxies in the root namespace, the root namespace Telemetry is the namespace Telemetry.
+	if namespace == t.rootNamespace {
+		ts = t.appendNamespaceSampling(ts, namespace)
+	}
 	if t.rootNamespace != "" {
 		telemetry := t.namespaceWideTelemetryConfig(t.rootNamespace)
-		if telemetry != (Telemetry{}) {
+		if telemetry.Spec != nil {
 			key.Root = NamespacedName{Name: telemetry.Name, Namespace: telemetry.Namespace}
 			ms = append(ms, telemetry.Spec.GetMetrics()...)
 			ls = append(ls, telemetry.Spec.GetAccessLogging()...)
 			ts = append(ts, telemetry.Spec.GetTracing()...)
+			applyOverrides(telemetry)
 		}
 	}
 
 	if namespace != t.rootNamespace {
+		ts = t.appendNamespaceSampling(ts, namespace)
 		telemetry := t.namespaceWideTelemetryConfig(namespace)
-		if telemetry != (Telemetry{}) {
+		if telemetry.Spec != nil {
 			key.Namespace = NamespacedName{Name: telemetry.Name, Namespace: telemetry.Namespace}
-			ms = append(ms, telemetry.Spec.GetMetrics()...)
-			ls = append(ls, telemetry.Spec.GetAccessLogging()...)
-			ts = append(ts, telemetry.Spec.GetTracing()...)
+			appendTelemetry(telemetry)
 		}
 	}
 
@@ -319,36 +1103,73 @@ func (t *Telemetries) applicableTelemetries(proxy *Proxy) computedTelemetries {
 		selector := labels.Instance(spec.GetSelector().GetMatchLabels())
 		if workload.IsSupersetOf(selector) {
 			key.Workload = NamespacedName{Name: telemetry.Name, Namespace: telemetry.Namespace}
-			ms = append(ms, spec.GetMetrics()...)
-			ls = append(ls, spec.GetAccessLogging()...)
-			ts = append(ts, spec.GetTracing()...)
+			appendTelemetry(telemetry)
 			break
 		}
 	}
 
+	// Metrics can be disabled by an annotation on the workload, unless a Telemetry selects the workload.
+	metricsDisabled := key.Workload == NamespacedName{} && proxy.Metadata.Annotations[constants.TelemetryMetrics] == "disabled"
+
 	return computedTelemetries{
-		telemetryKey: key,
-		Metrics:      ms,
-		Logging:      ls,
-		Tracing:      ts,
+		telemetryKey:              key,
+		MetricsDisabled:           metricsDisabled,
+		Metrics:                   ms,
+		Logging:                   ls,
+		Tracing:                   ts,
+		UpstreamTracingTags:       upstreamTags,
+		TCPMetricsDisabledPorts:   tcpMetricsDisabledPorts,
+		ClientSamplingPercentage:  clientSampling,
+		OverallSamplingPercentage: overallSampling,
+		TracingDirections:         tracingDirections,
+		TracingLabelTags:          labelTags,
+		TracingTagMaxLengths:      tagMaxLengths,
+		AccessLogSampling:         accessLogSampling,
+		AccessLogErrors:           accessLogErrors,
+	}
+}
+
+// appendNamespaceSampling appends the default sampling configured for the namespace, if any. The entry does not
+// select a provider, so it applies to whichever provider is selected by the other levels.
+func (t *Telemetries) appendNamespaceSampling(ts []*tpb.Tracing, namespace string) []*tpb.Tracing {
+	pct, f := t.namespaceSampling[namespace]
+	if !f {
+		return ts
 	}
+	return append(ts, &tpb.Tracing{RandomSamplingPercentage: &types.DoubleValue{Value: pct}})
 }
 
 // telemetryFilters computes the filters for the given proxy/class and protocol. This computes the
 // set of applicable Telemetries, merges them, then translates to the appropriate filters based on the
 // extension providers in the mesh config. Where possible, the result is cached.
 // Currently, this includes metrics and access logging, as some providers are implemented in filters.
-func (t *Telemetries) telemetryFilters(proxy *Proxy, class networking.ListenerClass, protocol networking.ListenerProtocol) interface{} {
+func (t *Telemetries) telemetryFilters(proxy *Proxy, class networking.ListenerClass, protocol networking.ListenerProtocol,
+	port uint32) interface{} {
 	if t == nil {
 		return nil
 	}
 
 	c := t.applicableTelemetries(proxy)
 
+	metricsDisabled := c.MetricsDisabled
+	if !metricsDisabled && protocol == networking.ListenerProtocolTCP && port != 0 {
+		for _, p := range c.TCPMetricsDisabledPorts {
+			if p == port {
+				metricsDisabled = true
+				break
+			}
+		}
+	}
+
 	key := metricsKey{
-		telemetryKey: c.telemetryKey,
-		Class:        class,
-		Protocol:     protocol,
+		telemetryKey:    c.telemetryKey,
+		Class:           class,
+		Protocol:        protocol,
+		MetricsDisabled: metricsDisabled,
+		Format:          telemetryFormatForProxy(proxy),
+	}
+	if t.metricsCanonicalIdentity {
+		key.Identity = ProxyCanonicalIdentity(proxy.Metadata)
 	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -358,19 +1179,22 @@ func (t *Telemetries) telemetryFilters(proxy *Proxy, class networking.ListenerCl
 	}
 
 	// First, take all the metrics configs and transform them into a normalized form
-	tmm := mergeMetrics(c.Metrics, t.meshConfig)
+	dimensions := t.metricDimensions
+	if t.metricsCanonicalIdentity {
+		dimensions = withIdentityDimensions(dimensions, key.Identity)
+	}
+	tmm := mergeMetrics(c.Metrics, t.meshConfig, dimensions)
 	// Additionally, fetch relevant access logging configurations
 	tml := mergeLogs(c.Logging, t.meshConfig)
 
 	// The above result is in a nested map to deduplicate responses. This loses ordering, so we convert to
 	// a list to retain stable naming
 	m := []telemetryFilterConfig{}
-	keys := tml.UnsortedList()
+	providers := sets.NewSet(tml.UnsortedList()...)
 	for k := range tmm {
-		keys = append(keys, k)
+		providers.Insert(k)
 	}
-	sort.Strings(keys)
-	for _, k := range keys {
+	for _, k := range providers.SortedList() {
 		p := t.fetchProvider(k)
 		if p == nil {
 			continue
@@ -381,10 +1205,16 @@ func (t *Telemetries) telemetryFilters(proxy *Proxy, class networking.ListenerCl
 			Provider:      p,
 			metricsConfig: tmm[k],
 			AccessLogging: logging,
-			Metrics:       metrics,
+			Metrics:       metrics && !metricsDisabled,
+			DropMetrics:   metricsDisabled,
+			Format:        key.Format,
 		}
 		m = append(m, cfg)
 	}
+	// Order the filters by provider type, so that the filter chain does not change with the provider names.
+	sort.SliceStable(m, func(i, j int) bool {
+		return providerFilterOrder(m[i].Provider) < providerFilterOrder(m[j].Provider)
+	})
 
 	var res interface{}
 	// Finally, compute the actual filters based on the protoc
@@ -456,6 +1286,18 @@ func (t *Telemetries) namespaceWideTelemetryConfig(namespace string) Telemetry {
 	return Telemetry{}
 }
 
+// providerFilterOrder returns the position of the telemetry filters of the provider in the filter chain.
+func providerFilterOrder(p *meshconfig.MeshConfig_ExtensionProvider) int {
+	switch p.GetProvider().(type) {
+	case *meshconfig.MeshConfig_ExtensionProvider_Prometheus:
+		return 0
+	case *meshconfig.MeshConfig_ExtensionProvider_Stackdriver:
+		return 1
+	default:
+		return 2
+	}
+}
+
 // fetchProvider finds the matching ExtensionProviders from the mesh config
 func (t *Telemetries) fetchProvider(m string) *meshconfig.MeshConfig_ExtensionProvider {
 	for _, p := range t.meshConfig.ExtensionProviders {
@@ -466,6 +1308,108 @@ func (t *Telemetries) fetchProvider(m string) *meshconfig.MeshConfig_ExtensionPr
 	return nil
 }
 
+// meshMetricDimensions holds the valid dimensions set through PILOT_MESH_METRIC_DIMENSIONS.
+var meshMetricDimensions = validMetricDimensions(features.MeshMetricDimensions)
+
+// CanonicalIdentity identifies the workload of a proxy in its telemetry. The tracing tags, and optionally the
+// access logs and metrics, of a proxy are generated from the same CanonicalIdentity, so all signals agree.
+type CanonicalIdentity struct {
+	CanonicalRevision string
+	CanonicalService  string
+	MeshID            string
+	Namespace         string
+}
+
+// IdentityAttribute is a named value of a CanonicalIdentity.
+type IdentityAttribute struct {
+	Name  string
+	Value string
+}
+
+// ProxyCanonicalIdentity returns the canonical identity of a proxy from its node metadata. Unknown values have
+// defaults, so the identity is always complete.
+func ProxyCanonicalIdentity(metadata *NodeMetadata) CanonicalIdentity {
+	var id CanonicalIdentity
+	if metadata != nil {
+		id.CanonicalRevision = metadata.Labels[IstioCanonicalServiceRevisionLabelName]
+		id.CanonicalService = metadata.Labels[IstioCanonicalServiceLabelName]
+		id.MeshID = metadata.MeshID
+		id.Namespace = metadata.Namespace
+	}
+	if id.CanonicalRevision == "" {
+		id.CanonicalRevision = "latest"
+	}
+	// TODO: This should have been properly handled with the injector.
+	if id.CanonicalService == "" {
+		id.CanonicalService = "unknown"
+	}
+	if id.MeshID == "" {
+		id.MeshID = "unknown"
+	}
+	if id.Namespace == "" {
+		id.Namespace = "default"
+	}
+	return id
+}
+
+// Attributes returns the values of the identity in a stable order. Each signal prefixes the names as needed.
+func (id CanonicalIdentity) Attributes() []IdentityAttribute {
+	return []IdentityAttribute{
+		{Name: "canonical_revision", Value: id.CanonicalRevision},
+		{Name: "canonical_service", Value: id.CanonicalService},
+		{Name: "mesh_id", Value: id.MeshID},
+		{Name: "namespace", Value: id.Namespace},
+	}
+}
+
+// withIdentityDimensions returns the dimensions with the canonical identity added as literal istio_* dimensions.
+// Mesh dimensions with the same names take precedence.
+func withIdentityDimensions(dimensions map[string]string, identity CanonicalIdentity) map[string]string {
+	res := make(map[string]string, len(dimensions)+4)
+	for _, a := range identity.Attributes() {
+		res["istio_"+a.Name] = strconv.Quote(a.Value)
+	}
+	for name, expression := range dimensions {
+		res[name] = expression
+	}
+	return res
+}
+
+var (
+	metricDimensionNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// unboundedAttributesRegexp matches attributes with a value per request or connection. Dimensions computed
+	// from them would create a time series per request.
+	unboundedAttributesRegexp = regexp.MustCompile(`(^|[^\w.])(request\.(id|time|duration|path|url_path|query|headers)|` +
+		`response\.(headers|trailers)|connection\.id|source\.port)($|[^\w])`)
+)
+
+// validateMetricDimension validates a dimension added to every metric.
+func validateMetricDimension(name, expression string) error {
+	if !metricDimensionNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid dimension name %q", name)
+	}
+	if expression == "" {
+		return fmt.Errorf("dimension %s has no value", name)
+	}
+	if m := unboundedAttributesRegexp.FindStringSubmatch(expression); m != nil {
+		return fmt.Errorf("dimension %s references %s, which has unbounded cardinality", name, m[2])
+	}
+	return nil
+}
+
+// validMetricDimensions returns the valid dimensions, logging the invalid ones.
+func validMetricDimensions(dimensions map[string]string) map[string]string {
+	res := make(map[string]string, len(dimensions))
+	for name, expression := range dimensions {
+		if err := validateMetricDimension(name, expression); err != nil {
+			telemetryLog.Errorf("ignoring mesh metric dimension: %v", err)
+			continue
+		}
+		res[name] = expression
+	}
+	return res
+}
+
 var allMetrics = func() []string {
 	r := []string{}
 	for k := range tpb.MetricSelector_IstioMetric_value {
@@ -477,8 +1421,9 @@ var allMetrics = func() []string {
 	return r
 }()
 
-// mergeMetrics merges many Metrics objects into a normalized configuration
-func mergeMetrics(metrics []*tpb.Metrics, mesh *meshconfig.MeshConfig) map[string]metricsConfig {
+// mergeMetrics merges many Metrics objects into a normalized configuration. The dimensions are added to every
+// metric, before the overrides of the Metrics are applied.
+func mergeMetrics(metrics []*tpb.Metrics, mesh *meshconfig.MeshConfig, dimensions map[string]string) map[string]metricsConfig {
 	type metricOverride struct {
 		Disabled     *types.BoolValue
 		TagOverrides map[string]*tpb.MetricsOverrides_TagOverride
@@ -486,11 +1431,31 @@ func mergeMetrics(metrics []*tpb.Metrics, mesh *meshconfig.MeshConfig) map[strin
 	// provider -> mode -> metric -> overrides
 	providers := map[string]map[tpb.WorkloadMode]map[string]metricOverride{}
 
+	newProvider := func() map[tpb.WorkloadMode]map[string]metricOverride {
+		mp := map[tpb.WorkloadMode]map[string]metricOverride{
+			tpb.WorkloadMode_CLIENT: {},
+			tpb.WorkloadMode_SERVER: {},
+		}
+		if len(dimensions) == 0 {
+			return mp
+		}
+		for mode := range mp {
+			for _, metricName := range allMetrics {
+				tags := make(map[string]*tpb.MetricsOverrides_TagOverride, len(dimensions))
+				for name, value := range dimensions {
+					tags[name] = &tpb.MetricsOverrides_TagOverride{Operation: tpb.MetricsOverrides_TagOverride_UPSERT, Value: value}
+				}
+				mp[mode][metricName] = metricOverride{TagOverrides: tags}
+			}
+		}
+		return mp
+	}
+
 	if len(metrics) == 0 {
 		for _, dp := range mesh.GetDefaultProviders().GetMetrics() {
-			// Insert the default provider. It has no overrides; presence of the key is sufficient to
-			// get the filter created.
-			providers[dp] = map[tpb.WorkloadMode]map[string]metricOverride{}
+			// Insert the default provider. It has no overrides other than the dimensions; presence of the key is
+			// sufficient to get the filter created.
+			providers[dp] = newProvider()
 		}
 	}
 
@@ -520,10 +1485,7 @@ func mergeMetrics(metrics []*tpb.Metrics, mesh *meshconfig.MeshConfig) map[strin
 				continue
 			}
 			if _, f := providers[provider]; !f {
-				providers[provider] = map[tpb.WorkloadMode]map[string]metricOverride{
-					tpb.WorkloadMode_CLIENT: {},
-					tpb.WorkloadMode_SERVER: {},
-				}
+				providers[provider] = newProvider()
 			}
 			mp := providers[provider]
 			// For each override, we normalize the configuration. The metrics list is an ordered list - latter
@@ -664,7 +1626,11 @@ func buildHTTPTelemetryFilter(class networking.ListenerClass, filterConfigs []te
 				// No logging for prometheus
 				continue
 			}
-			cfg := generateStatsConfig(class, cfg)
+			statsCfg, err := generateStatsConfig(class, cfg)
+			if err != nil {
+				skipTelemetryFilter(cfg.Provider, err)
+				continue
+			}
 			vmConfig := ConstructVMConfig("/etc/istio/extensions/stats-filter.compiled.wasm", "envoy.wasm.stats")
 			root := statsRootIDForClass(class)
 			vmConfig.VmConfig.VmId = root
@@ -673,7 +1639,7 @@ func buildHTTPTelemetryFilter(class networking.ListenerClass, filterConfigs []te
 				Config: &wasm.PluginConfig{
 					RootId:        root,
 					Vm:            vmConfig,
-					Configuration: cfg,
+					Configuration: statsCfg,
 				},
 			}
 
@@ -683,7 +1649,14 @@ func buildHTTPTelemetryFilter(class networking.ListenerClass, filterConfigs []te
 			}
 			res = append(res, f)
 		case *meshconfig.MeshConfig_ExtensionProvider_Stackdriver:
-			cfg := generateSDConfig(class, cfg)
+			if cfg.DropMetrics && !cfg.AccessLogging {
+				continue
+			}
+			sdCfg, err := generateSDConfig(class, cfg)
+			if err != nil {
+				skipTelemetryFilter(cfg.Provider, err)
+				continue
+			}
 			vmConfig := ConstructVMConfig("", "envoy.wasm.null.stackdriver")
 			vmConfig.VmConfig.VmId = stackdriverVMID(class)
 
@@ -691,7 +1664,7 @@ func buildHTTPTelemetryFilter(class networking.ListenerClass, filterConfigs []te
 				Config: &wasm.PluginConfig{
 					RootId:        vmConfig.VmConfig.VmId,
 					Vm:            vmConfig,
-					Configuration: cfg,
+					Configuration: sdCfg,
 				},
 			}
 
@@ -713,7 +1686,15 @@ func buildTCPTelemetryFilter(class networking.ListenerClass, telemetryConfigs []
 	for _, telemetryCfg := range telemetryConfigs {
 		switch telemetryCfg.Provider.GetProvider().(type) {
 		case *meshconfig.MeshConfig_ExtensionProvider_Prometheus:
-			cfg := generateStatsConfig(class, telemetryCfg)
+			if telemetryCfg.DropMetrics {
+				// Prometheus only reports metrics, so the filter can be omitted entirely.
+				continue
+			}
+			cfg, err := generateStatsConfig(class, telemetryCfg)
+			if err != nil {
+				skipTelemetryFilter(telemetryCfg.Provider, err)
+				continue
+			}
 			vmConfig := ConstructVMConfig("/etc/istio/extensions/stats-filter.compiled.wasm", "envoy.wasm.stats")
 			root := statsRootIDForClass(class)
 			vmConfig.VmConfig.VmId = "tcp_" + root
@@ -732,7 +1713,14 @@ func buildTCPTelemetryFilter(class networking.ListenerClass, telemetryConfigs []
 			}
 			res = append(res, f)
 		case *meshconfig.MeshConfig_ExtensionProvider_Stackdriver:
-			cfg := generateSDConfig(class, telemetryCfg)
+			if telemetryCfg.DropMetrics && !telemetryCfg.AccessLogging {
+				continue
+			}
+			cfg, err := generateSDConfig(class, telemetryCfg)
+			if err != nil {
+				skipTelemetryFilter(telemetryCfg.Provider, err)
+				continue
+			}
 			vmConfig := ConstructVMConfig("", "envoy.wasm.null.stackdriver")
 			vmConfig.VmConfig.VmId = stackdriverVMID(class)
 
@@ -792,9 +1780,9 @@ var metricToSDClientMetrics = map[string]string{
 	"GRPC_RESPONSE_MESSAGES": "",
 }
 
-func generateSDConfig(class networking.ListenerClass, telemetryConfig telemetryFilterConfig) *anypb.Any {
+func generateSDConfig(class networking.ListenerClass, telemetryConfig telemetryFilterConfig) (*anypb.Any, error) {
 	cfg := sd.PluginConfig{
-		DisableHostHeaderFallback: disableHostHeaderFallback(class),
+		DisableHostHeaderFallback: disableHostHeaderFallback(class, telemetryConfig.Format),
 	}
 	merticNameMap := metricToSDClientMetrics
 	if class == networking.ListenerClassSidecarInbound {
@@ -827,6 +1815,18 @@ func generateSDConfig(class networking.ListenerClass, telemetryConfig telemetryF
 			cfg.MetricsOverrides[metricName].TagOverrides[t.Name] = t.Value
 		}
 	}
+	if telemetryConfig.DropMetrics {
+		// Stackdriver reports metrics unconditionally, so drop every predefined metric.
+		for _, metricName := range merticNameMap {
+			if metricName == "" {
+				continue
+			}
+			if cfg.MetricsOverrides == nil {
+				cfg.MetricsOverrides = map[string]*sd.MetricsOverride{}
+			}
+			cfg.MetricsOverrides[metricName] = &sd.MetricsOverride{Drop: true}
+		}
+	}
 	if telemetryConfig.AccessLogging {
 		// TODO: currently we cannot configure this granularity in the API, so we fallback to common defaults.
 		if class == networking.ListenerClassSidecarInbound {
@@ -836,8 +1836,11 @@ func generateSDConfig(class networking.ListenerClass, telemetryConfig telemetryF
 		}
 	}
 	// In WASM we are not actually processing protobuf at all, so we need to encode this to JSON
-	cfgJSON, _ := protomarshal.MarshalProtoNames(&cfg)
-	return networking.MessageToAny(&wrappers.StringValue{Value: string(cfgJSON)})
+	cfgJSON, err := marshalFilterConfig(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return networking.MessageToAny(&wrappers.StringValue{Value: string(cfgJSON)}), nil
 }
 
 var metricToPrometheusMetric = map[string]string{
@@ -853,9 +1856,9 @@ var metricToPrometheusMetric = map[string]string{
 	"GRPC_RESPONSE_MESSAGES": "response_messages_total",
 }
 
-func generateStatsConfig(class networking.ListenerClass, metricsCfg telemetryFilterConfig) *anypb.Any {
+func generateStatsConfig(class networking.ListenerClass, metricsCfg telemetryFilterConfig) (*anypb.Any, error) {
 	cfg := stats.PluginConfig{
-		DisableHostHeaderFallback: disableHostHeaderFallback(class),
+		DisableHostHeaderFallback: disableHostHeaderFallback(class, metricsCfg.Format),
 	}
 	for _, override := range metricsCfg.MetricsForClass(class) {
 		metricName, f := metricToPrometheusMetric[override.Name]
@@ -878,10 +1881,16 @@ func generateStatsConfig(class networking.ListenerClass, metricsCfg telemetryFil
 		cfg.Metrics = append(cfg.Metrics, mc)
 	}
 	// In WASM we are not actually processing protobuf at all, so we need to encode this to JSON
-	cfgJSON, _ := protomarshal.MarshalProtoNames(&cfg)
-	return networking.MessageToAny(&wrappers.StringValue{Value: string(cfgJSON)})
+	cfgJSON, err := marshalFilterConfig(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return networking.MessageToAny(&wrappers.StringValue{Value: string(cfgJSON)}), nil
 }
 
-func disableHostHeaderFallback(class networking.ListenerClass) bool {
+func disableHostHeaderFallback(class networking.ListenerClass, format telemetryFormat) bool {
+	if format < telemetryFormatHostHeaderFallback {
+		return false
+	}
 	return class == networking.ListenerClassSidecarInbound || class == networking.ListenerClassGateway
 }
@@ -15,7 +15,11 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
@@ -24,15 +28,23 @@ import (
 	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/wasm/v3"
 	"github.com/gogo/protobuf/types"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	sd "istio.io/api/envoy/extensions/stackdriver/config/v1alpha1"
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	tpb "istio.io/api/telemetry/v1alpha1"
+	selectorpb "istio.io/api/type/v1beta1"
 	"istio.io/istio/pilot/pkg/networking"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/util/protomarshal"
 )
 
 func createTestTelemetries(configs []config.Config, t *testing.T) *Telemetries {
@@ -65,6 +77,18 @@ func newTelemetry(ns string, spec config.Spec) config.Config {
 	}
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func withAnnotation(cfg config.Config, key, value string) config.Config {
+	if cfg.Annotations == nil {
+		cfg.Annotations = map[string]string{}
+	}
+	cfg.Annotations[key] = value
+	return cfg
+}
+
 type telemetryStore struct {
 	ConfigStore
 
@@ -243,6 +267,281 @@ func TestAccessLogging(t *testing.T) {
 	}
 }
 
+func getIgnoredTelemetryConfigs(t *testing.T, reason string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("pilot_telemetry_ignored_configs")
+	if err != nil {
+		t.Fatalf("failed to get ignored Telemetry configs: %v", err)
+	}
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key.Name() == "reason" && tag.Value == reason {
+				return row.Data.(*view.SumData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestIgnoredTelemetryConfigs(t *testing.T) {
+	nonExistant := newTelemetry("ignored-configs", &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{{Providers: []*tpb.ProviderRef{{Name: "custom-provider"}}}},
+		Tracing:       []*tpb.Tracing{{Providers: []*tpb.ProviderRef{{Name: "custom-provider"}}}},
+	})
+	invalidOverride := withAnnotation(newTelemetry("ignored-configs-override", &tpb.Telemetry{}),
+		constants.TelemetryTracingClientSampling, "200")
+	expect := func(reason string, before, want float64) {
+		t.Helper()
+		if got := getIgnoredTelemetryConfigs(t, reason) - before; got != want {
+			t.Fatalf("got %v new ignored configs for reason %s, want %v", got, reason, want)
+		}
+	}
+
+	unknown := getIgnoredTelemetryConfigs(t, unknownProviderReason)
+	invalid := getIgnoredTelemetryConfigs(t, invalidOverrideReason)
+	createTestTelemetries([]config.Config{nonExistant, invalidOverride}, t)
+	// The provider is referenced twice, but reported once
+	expect(unknownProviderReason, unknown, 1)
+	expect(invalidOverrideReason, invalid, 1)
+
+	// Recomputing on the next push does not report the issues again
+	createTestTelemetries([]config.Config{nonExistant, invalidOverride}, t)
+	expect(unknownProviderReason, unknown, 1)
+	expect(invalidOverrideReason, invalid, 1)
+
+	// A new generation of the resource is reported again
+	nonExistant.Generation++
+	createTestTelemetries([]config.Config{nonExistant, invalidOverride}, t)
+	expect(unknownProviderReason, unknown, 2)
+	expect(invalidOverrideReason, invalid, 1)
+
+	// Valid providers are not reported
+	valid := newTelemetry("ignored-configs-valid", &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{{Providers: []*tpb.ProviderRef{{Name: "Stackdriver"}}}},
+	})
+	createTestTelemetries([]config.Config{valid}, t)
+	expect(unknownProviderReason, unknown, 2)
+}
+
+func TestInvalidTracingTags(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	literal := &tpb.Tracing_CustomTag{Type: &tpb.Tracing_CustomTag_Literal{Literal: &tpb.Tracing_Literal{Value: "v"}}}
+	spec := &tpb.Telemetry{
+		Tracing: []*tpb.Tracing{{
+			Providers: []*tpb.ProviderRef{{Name: "envoy"}},
+			CustomTags: map[string]*tpb.Tracing_CustomTag{
+				"valid.tag":              literal,
+				"app/version:v1":         literal,
+				"has space":              literal,
+				strings.Repeat("a", 129): literal,
+				"Dup":                    literal,
+				"dup":                    literal,
+			},
+		}},
+	}
+	before := getIgnoredTelemetryConfigs(t, invalidTracingTagReason)
+	telemetry := createTestTelemetries([]config.Config{newTelemetry("istio-system", spec)}, t)
+	if got := getIgnoredTelemetryConfigs(t, invalidTracingTagReason) - before; got != 3 {
+		t.Fatalf("got %v ignored tracing tags, want 3", got)
+	}
+	var got []string
+	for name := range telemetry.Tracing(sidecar).CustomTags {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"Dup", "app/version:v1", "valid.tag"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got tags %v, want %v", got, want)
+	}
+	if len(spec.Tracing[0].CustomTags) != 6 {
+		t.Fatalf("expected the Telemetry resource to be unchanged, got %v", spec.Tracing[0].CustomTags)
+	}
+}
+
+func TestGatewayRootNamespaceOnly(t *testing.T) {
+	sidecar := &Proxy{Type: SidecarProxy, ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	gateway := &Proxy{Type: Router, ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	envoy := &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "envoy"}},
+			},
+		},
+		Tracing: []*tpb.Tracing{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "envoy"}},
+			},
+		},
+	}
+	overrides := &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{
+			{
+				Disabled: &types.BoolValue{Value: true},
+			},
+		},
+		Tracing: []*tpb.Tracing{
+			{
+				Providers:                []*tpb.ProviderRef{{Name: "envoy"}},
+				DisableSpanReporting:     &types.BoolValue{Value: true},
+				RandomSamplingPercentage: &types.DoubleValue{Value: 50},
+			},
+		},
+	}
+	cfgs := []config.Config{newTelemetry("istio-system", envoy), newTelemetry("default", overrides)}
+	tests := []struct {
+		name              string
+		proxy             *Proxy
+		rootNamespaceOnly bool
+		wantLogging       []string
+		wantTracing       *TracingConfig
+	}{
+		{
+			"gateway",
+			gateway,
+			true,
+			[]string{"envoy"},
+			&TracingConfig{
+				Provider:                 &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				RandomSamplingPercentage: 50,
+			},
+		},
+		{
+			"gateway without option",
+			gateway,
+			false,
+			nil,
+			&TracingConfig{
+				Provider:                 &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				Disabled:                 true,
+				RandomSamplingPercentage: 50,
+			},
+		},
+		{
+			"sidecar",
+			sidecar,
+			true,
+			nil,
+			&TracingConfig{
+				Provider:                 &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				Disabled:                 true,
+				RandomSamplingPercentage: 50,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(cfgs, t)
+			telemetry.gatewayRootNamespaceOnly = tt.rootNamespaceOnly
+			var gotLogging []string
+			if al := telemetry.AccessLogging(tt.proxy); al != nil {
+				for _, p := range al.Providers {
+					gotLogging = append(gotLogging, p.Name)
+				}
+			}
+			if !reflect.DeepEqual(gotLogging, tt.wantLogging) {
+				t.Fatalf("got logging %v want %v", gotLogging, tt.wantLogging)
+			}
+			gotTracing := telemetry.Tracing(tt.proxy)
+			if gotTracing != nil && gotTracing.Provider != nil {
+				gotTracing.Provider.Provider = nil
+			}
+			if diff := cmp.Diff(gotTracing, tt.wantTracing); diff != "" {
+				t.Fatalf("got tracing diff %v", diff)
+			}
+		})
+	}
+}
+
+func TestAccessLoggingSampling(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	logging := func(providers ...string) *tpb.Telemetry {
+		al := &tpb.AccessLogging{}
+		for _, p := range providers {
+			al.Providers = append(al.Providers, &tpb.ProviderRef{Name: p})
+		}
+		return &tpb.Telemetry{AccessLogging: []*tpb.AccessLogging{al}}
+	}
+	workload := func(spec *tpb.Telemetry) config.Config {
+		spec.Selector = &selectorpb.WorkloadSelector{MatchLabels: map[string]string{"app": "test"}}
+		cfg := newTelemetry("default", spec)
+		cfg.Name = "workload"
+		return cfg
+	}
+	tests := []struct {
+		name         string
+		cfgs         []config.Config
+		wantSampling map[string]float64
+		wantErrors   bool
+	}{
+		{
+			name: "no sampling",
+			cfgs: []config.Config{newTelemetry("istio-system", logging("envoy"))},
+		},
+		{
+			name: "sampling",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", logging("envoy")), constants.TelemetryAccessLogSampling, "Envoy=10"),
+			},
+			wantSampling: map[string]float64{"envoy": 10},
+		},
+		{
+			name: "sampling with errors",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", logging("envoy")),
+					constants.TelemetryAccessLogSampling, "envoy=10"), constants.TelemetryAccessLogErrors, "true"),
+			},
+			wantSampling: map[string]float64{"envoy": 10},
+			wantErrors:   true,
+		},
+		{
+			name: "sampling of providers not selected",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", logging("envoy")), constants.TelemetryAccessLogSampling, "stackdriver=10"),
+			},
+		},
+		{
+			name: "invalid sampling",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", logging("envoy")), constants.TelemetryAccessLogSampling, "envoy=150,envoy,=5"),
+			},
+		},
+		{
+			name: "namespace overrides root sampling",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", logging("envoy", "stackdriver")),
+					constants.TelemetryAccessLogSampling, "envoy=10,stackdriver=20"), constants.TelemetryAccessLogErrors, "true"),
+				withAnnotation(newTelemetry("default", logging()), constants.TelemetryAccessLogSampling, "envoy=50"),
+			},
+			wantSampling: map[string]float64{"envoy": 50, "stackdriver": 20},
+			wantErrors:   true,
+		},
+		{
+			name: "workload overrides namespace errors",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("default", logging("envoy")),
+					constants.TelemetryAccessLogSampling, "envoy=10"), constants.TelemetryAccessLogErrors, "true"),
+				withAnnotation(workload(&tpb.Telemetry{}), constants.TelemetryAccessLogErrors, "false"),
+			},
+			wantSampling: map[string]float64{"envoy": 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			got := telemetry.AccessLogging(sidecar)
+			if got == nil {
+				t.Fatal("expected access logging configuration")
+			}
+			if diff := cmp.Diff(tt.wantSampling, got.Sampling); diff != "" {
+				t.Errorf("got sampling diff %v", diff)
+			}
+			if got.AlwaysLogErrors != tt.wantErrors {
+				t.Errorf("got always log errors %v, want %v", got.AlwaysLogErrors, tt.wantErrors)
+			}
+		})
+	}
+}
+
 func TestTracing(t *testing.T) {
 	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
 	envoy := &tpb.Telemetry{
@@ -394,6 +693,121 @@ func TestTracing(t *testing.T) {
 				},
 			},
 		},
+		{
+			"upstream tags default",
+			[]config.Config{newTelemetry("istio-system", envoy)},
+			sidecar,
+			nil,
+			&TracingConfig{Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"}},
+		},
+		{
+			"upstream tags enabled",
+			[]config.Config{withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryUpstreamTracingTags, "true")},
+			sidecar,
+			nil,
+			&TracingConfig{Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"}, UpstreamTags: true},
+		},
+		{
+			"upstream tags namespace override",
+			[]config.Config{
+				withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryUpstreamTracingTags, "true"),
+				withAnnotation(newTelemetry("default", empty), constants.TelemetryUpstreamTracingTags, "false"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"}},
+		},
+		{
+			"upstream tags invalid",
+			[]config.Config{withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryUpstreamTracingTags, "yes please")},
+			sidecar,
+			nil,
+			&TracingConfig{Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"}},
+		},
+		{
+			"client and overall sampling",
+			[]config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", envoy),
+					constants.TelemetryTracingClientSampling, "50"), constants.TelemetryTracingOverallSampling, "5"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{
+				Provider:                  &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				ClientSamplingPercentage:  floatPtr(50),
+				OverallSamplingPercentage: floatPtr(5),
+			},
+		},
+		{
+			"overall sampling namespace override",
+			[]config.Config{
+				withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryTracingOverallSampling, "5"),
+				withAnnotation(newTelemetry("default", empty), constants.TelemetryTracingOverallSampling, "10"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{
+				Provider:                  &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				OverallSamplingPercentage: floatPtr(10),
+			},
+		},
+		{
+			"label tags",
+			[]config.Config{
+				withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryTracingLabelTags,
+					"team=team, owner=example.com/owner:unknown,invalid,=team"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{
+				Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				LabelTags: map[string]TracingLabelTag{
+					"team":  {Label: "team"},
+					"owner": {Label: "example.com/owner", DefaultValue: "unknown"},
+				},
+			},
+		},
+		{
+			"label tags namespace override",
+			[]config.Config{
+				withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryTracingLabelTags, "team=team,owner=owner"),
+				withAnnotation(newTelemetry("default", empty), constants.TelemetryTracingLabelTags, "owner=owner:none"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{
+				Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				LabelTags: map[string]TracingLabelTag{
+					"team":  {Label: "team"},
+					"owner": {Label: "owner", DefaultValue: "none"},
+				},
+			},
+		},
+		{
+			"tag max lengths",
+			[]config.Config{
+				withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryTracingTagMaxLength,
+					"user_agent=256, url=512,invalid,url2=-1"),
+				withAnnotation(newTelemetry("default", empty), constants.TelemetryTracingTagMaxLength, "url=128,team=0"),
+			},
+			sidecar,
+			nil,
+			&TracingConfig{
+				Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"},
+				TagMaxLengths: map[string]uint32{
+					"user_agent": 256,
+					"url":        128,
+					"team":       0,
+				},
+			},
+		},
+		{
+			"sampling out of range",
+			[]config.Config{withAnnotation(newTelemetry("istio-system", envoy), constants.TelemetryTracingOverallSampling, "150")},
+			sidecar,
+			nil,
+			&TracingConfig{Provider: &meshconfig.MeshConfig_ExtensionProvider{Name: "envoy"}},
+		},
 		{
 			"multi overrides",
 			[]config.Config{
@@ -428,68 +842,374 @@ func TestTracing(t *testing.T) {
 	}
 }
 
-func TestTelemetryFilters(t *testing.T) {
-	overrides := []*tpb.MetricsOverrides{{
-		Match: &tpb.MetricSelector{
-			MetricMatch: &tpb.MetricSelector_Metric{
-				Metric: tpb.MetricSelector_REQUEST_COUNT,
-			},
+func TestTracingNamespaceSampling(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	rootSidecar := &Proxy{ConfigNamespace: "istio-system", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	sampling := func(pct float64) *tpb.Telemetry {
+		return &tpb.Telemetry{
+			Tracing: []*tpb.Tracing{{RandomSamplingPercentage: &types.DoubleValue{Value: pct}}},
+		}
+	}
+	workload := func(pct float64) config.Config {
+		cfg := newTelemetry("default", &tpb.Telemetry{
+			Selector: &selectorpb.WorkloadSelector{MatchLabels: map[string]string{"app": "test"}},
+			Tracing:  []*tpb.Tracing{{RandomSamplingPercentage: &types.DoubleValue{Value: pct}}},
+		})
+		cfg.Name = "workload"
+		return cfg
+	}
+	stackdriver := &tpb.Telemetry{
+		Tracing: []*tpb.Tracing{{Providers: []*tpb.ProviderRef{{Name: "stackdriver"}}}},
+	}
+	tests := []struct {
+		name              string
+		cfgs              []config.Config
+		proxy             *Proxy
+		namespaceSampling map[string]float64
+		want              float64
+		wantProvider      string
+	}{
+		{
+			name:         "mesh default",
+			proxy:        sidecar,
+			want:         0,
+			wantProvider: "envoy",
 		},
-		TagOverrides: map[string]*tpb.MetricsOverrides_TagOverride{
-			"remove": {
-				Operation: tpb.MetricsOverrides_TagOverride_REMOVE,
-			},
-			"add": {
-				Operation: tpb.MetricsOverrides_TagOverride_UPSERT,
-				Value:     "bar",
-			},
+		{
+			name:         "root telemetry overrides mesh default",
+			cfgs:         []config.Config{newTelemetry("istio-system", sampling(5))},
+			proxy:        sidecar,
+			want:         5,
+			wantProvider: "envoy",
 		},
-	}}
-	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
-	emptyPrometheus := &tpb.Telemetry{
-		Metrics: []*tpb.Metrics{
-			{
-				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
-			},
+		{
+			name:              "namespace default overrides mesh default",
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"default": 20},
+			want:              20,
+			wantProvider:      "envoy",
 		},
-	}
-	overridesPrometheus := &tpb.Telemetry{
-		Metrics: []*tpb.Metrics{
-			{
-				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
-				Overrides: overrides,
-			},
+		{
+			name:              "namespace default overrides root telemetry",
+			cfgs:              []config.Config{newTelemetry("istio-system", sampling(5))},
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"default": 20},
+			want:              20,
+			wantProvider:      "envoy",
 		},
-	}
-	emptyStackdriver := &tpb.Telemetry{
-		Metrics: []*tpb.Metrics{
-			{
-				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
-			},
+		{
+			name:              "namespace default for another namespace",
+			cfgs:              []config.Config{newTelemetry("istio-system", sampling(5))},
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"other": 20},
+			want:              5,
+			wantProvider:      "envoy",
 		},
-	}
-	overridesStackdriver := &tpb.Telemetry{
-		Metrics: []*tpb.Metrics{
-			{
-				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
-				Overrides: overrides,
+		{
+			name: "namespace telemetry overrides namespace default",
+			cfgs: []config.Config{
+				newTelemetry("istio-system", sampling(5)),
+				newTelemetry("default", sampling(50)),
 			},
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"default": 20},
+			want:              50,
+			wantProvider:      "envoy",
 		},
-	}
-	overridesEmptyProvider := &tpb.Telemetry{
-		Metrics: []*tpb.Metrics{
-			{
-				Overrides: overrides,
+		{
+			name: "workload telemetry overrides namespace default",
+			cfgs: []config.Config{
+				newTelemetry("istio-system", sampling(5)),
+				workload(70),
 			},
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"default": 20},
+			want:              70,
+			wantProvider:      "envoy",
 		},
-	}
-	sdLogging := &tpb.Telemetry{
+		{
+			name:              "namespace default applies to provider selected by root telemetry",
+			cfgs:              []config.Config{newTelemetry("istio-system", stackdriver)},
+			proxy:             sidecar,
+			namespaceSampling: map[string]float64{"default": 20},
+			want:              20,
+			wantProvider:      "stackdriver",
+		},
+		{
+			name:              "root namespace telemetry overrides root namespace default",
+			cfgs:              []config.Config{newTelemetry("istio-system", sampling(5))},
+			proxy:             rootSidecar,
+			namespaceSampling: map[string]float64{"istio-system": 20},
+			want:              5,
+			wantProvider:      "envoy",
+		},
+		{
+			name:              "root namespace default",
+			proxy:             rootSidecar,
+			namespaceSampling: map[string]float64{"istio-system": 20},
+			want:              20,
+			wantProvider:      "envoy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			telemetry.meshConfig.DefaultProviders.Tracing = []string{"envoy"}
+			telemetry.namespaceSampling = tt.namespaceSampling
+			got := telemetry.Tracing(tt.proxy)
+			if got == nil || got.Provider == nil {
+				t.Fatalf("expected tracing config with a provider, got %v", got)
+			}
+			if got.Provider.Name != tt.wantProvider {
+				t.Fatalf("got provider %v, want %v", got.Provider.Name, tt.wantProvider)
+			}
+			if got.RandomSamplingPercentage != tt.want {
+				t.Fatalf("got sampling %v, want %v", got.RandomSamplingPercentage, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracingDirections(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	tracing := func(disabled *bool, sampling *float64) *tpb.Telemetry {
+		tr := &tpb.Tracing{}
+		if disabled != nil {
+			tr.DisableSpanReporting = &types.BoolValue{Value: *disabled}
+		}
+		if sampling != nil {
+			tr.RandomSamplingPercentage = &types.DoubleValue{Value: *sampling}
+		}
+		return &tpb.Telemetry{Tracing: []*tpb.Tracing{tr}}
+	}
+	enabled := tracing(nil, nil)
+	boolPtr := func(b bool) *bool {
+		return &b
+	}
+	workload := func(spec *tpb.Telemetry) config.Config {
+		spec.Selector = &selectorpb.WorkloadSelector{MatchLabels: map[string]string{"app": "test"}}
+		cfg := newTelemetry("default", spec)
+		cfg.Name = "workload"
+		return cfg
+	}
+	type direction struct {
+		disabled bool
+		sampling float64
+	}
+	tests := []struct {
+		name     string
+		cfgs     []config.Config
+		inbound  direction
+		outbound direction
+	}{
+		{
+			name:     "no direction overrides",
+			cfgs:     []config.Config{newTelemetry("istio-system", tracing(nil, floatPtr(10)))},
+			inbound:  direction{sampling: 10},
+			outbound: direction{sampling: 10},
+		},
+		{
+			name: "inbound disabled",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingInboundDisabled, "true"),
+			},
+			inbound:  direction{disabled: true},
+			outbound: direction{},
+		},
+		{
+			name: "outbound disabled",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingOutboundDisabled, "true"),
+			},
+			inbound:  direction{},
+			outbound: direction{disabled: true},
+		},
+		{
+			name: "both directions disabled",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", enabled),
+					constants.TelemetryTracingInboundDisabled, "true"), constants.TelemetryTracingOutboundDisabled, "true"),
+			},
+			inbound:  direction{disabled: true},
+			outbound: direction{disabled: true},
+		},
+		{
+			name: "disabled, with inbound enabled",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", tracing(boolPtr(true), nil)), constants.TelemetryTracingInboundDisabled, "false"),
+			},
+			inbound:  direction{},
+			outbound: direction{disabled: true},
+		},
+		{
+			name: "direction sampling",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", tracing(nil, floatPtr(10))),
+					constants.TelemetryTracingInboundSampling, "50"), constants.TelemetryTracingOutboundSampling, "1"),
+			},
+			inbound:  direction{sampling: 50},
+			outbound: direction{sampling: 1},
+		},
+		{
+			name: "invalid direction overrides",
+			cfgs: []config.Config{
+				withAnnotation(withAnnotation(newTelemetry("istio-system", tracing(nil, floatPtr(10))),
+					constants.TelemetryTracingInboundDisabled, "maybe"), constants.TelemetryTracingOutboundSampling, "150"),
+			},
+			inbound:  direction{sampling: 10},
+			outbound: direction{sampling: 10},
+		},
+		{
+			name: "namespace direction override",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingInboundDisabled, "true"),
+				withAnnotation(newTelemetry("default", enabled), constants.TelemetryTracingInboundDisabled, "false"),
+			},
+			inbound:  direction{},
+			outbound: direction{},
+		},
+		{
+			name: "namespace disable overrides root direction",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingOutboundDisabled, "false"),
+				newTelemetry("default", tracing(boolPtr(true), nil)),
+			},
+			inbound:  direction{disabled: true},
+			outbound: direction{disabled: true},
+		},
+		{
+			name: "namespace sampling overrides root direction sampling",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingInboundSampling, "50"),
+				newTelemetry("default", tracing(nil, floatPtr(5))),
+			},
+			inbound:  direction{sampling: 5},
+			outbound: direction{sampling: 5},
+		},
+		{
+			name: "root direction kept by namespace without tracing overrides",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", enabled), constants.TelemetryTracingOutboundDisabled, "true"),
+				newTelemetry("default", tracing(nil, floatPtr(5))),
+			},
+			inbound:  direction{sampling: 5},
+			outbound: direction{disabled: true, sampling: 5},
+		},
+		{
+			name: "workload direction override",
+			cfgs: []config.Config{
+				newTelemetry("istio-system", enabled),
+				newTelemetry("default", tracing(nil, floatPtr(5))),
+				withAnnotation(workload(&tpb.Telemetry{}), constants.TelemetryTracingOutboundDisabled, "true"),
+			},
+			inbound:  direction{sampling: 5},
+			outbound: direction{disabled: true, sampling: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			telemetry.meshConfig.DefaultProviders.Tracing = []string{"envoy"}
+			got := telemetry.Tracing(sidecar)
+			for class, want := range map[networking.ListenerClass]direction{
+				networking.ListenerClassSidecarInbound:  tt.inbound,
+				networking.ListenerClassSidecarOutbound: tt.outbound,
+				networking.ListenerClassGateway:         tt.outbound,
+			} {
+				disabled, sampling := got.ForClass(class)
+				if gotDirection := (direction{disabled: disabled, sampling: sampling}); gotDirection != want {
+					t.Errorf("class %v: got %+v, want %+v", class, gotDirection, want)
+				}
+			}
+		})
+	}
+}
+
+// telemetryFilterResult is the name and configuration of a generated telemetry filter.
+type telemetryFilterResult struct {
+	Name   string
+	Config string
+}
+
+func TestTelemetryFilters(t *testing.T) {
+	overrides := []*tpb.MetricsOverrides{{
+		Match: &tpb.MetricSelector{
+			MetricMatch: &tpb.MetricSelector_Metric{
+				Metric: tpb.MetricSelector_REQUEST_COUNT,
+			},
+		},
+		TagOverrides: map[string]*tpb.MetricsOverrides_TagOverride{
+			"remove": {
+				Operation: tpb.MetricsOverrides_TagOverride_REMOVE,
+			},
+			"add": {
+				Operation: tpb.MetricsOverrides_TagOverride_UPSERT,
+				Value:     "bar",
+			},
+		},
+	}}
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	oldSidecar := &Proxy{
+		ConfigNamespace: "default",
+		Metadata:        &NodeMetadata{Labels: map[string]string{"app": "test"}},
+		IstioVersion:    &IstioVersion{Major: 1, Minor: 11, Patch: 4},
+	}
+	newSidecar := &Proxy{
+		ConfigNamespace: "default",
+		Metadata:        &NodeMetadata{Labels: map[string]string{"app": "test"}},
+		IstioVersion:    &IstioVersion{Major: 1, Minor: 12, Patch: 0},
+	}
+	emptyPrometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	}
+	overridesPrometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+				Overrides: overrides,
+			},
+		},
+	}
+	emptyStackdriver := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
+			},
+		},
+	}
+	overridesStackdriver := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
+				Overrides: overrides,
+			},
+		},
+	}
+	overridesEmptyProvider := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Overrides: overrides,
+			},
+		},
+	}
+	sdLogging := &tpb.Telemetry{
 		AccessLogging: []*tpb.AccessLogging{
 			{
 				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
 			},
 		},
 	}
+	prometheusAndStackdriver := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}, {Name: "prometheus"}},
+			},
+		},
+	}
 	emptyLogging := &tpb.Telemetry{
 		AccessLogging: []*tpb.AccessLogging{
 			{},
@@ -502,7 +1222,7 @@ func TestTelemetryFilters(t *testing.T) {
 		class            networking.ListenerClass
 		protocol         networking.ListenerProtocol
 		defaultProviders []string
-		want             map[string]string
+		want             []telemetryFilterResult
 	}{
 		{
 			"empty",
@@ -511,7 +1231,7 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{},
+			nil,
 		},
 		{
 			"default prometheus",
@@ -520,8 +1240,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stats": "{}",
+			[]telemetryFilterResult{
+				{"istio.stats", "{}"},
 			},
 		},
 		{
@@ -531,8 +1251,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			[]string{"prometheus"},
-			map[string]string{
-				"istio.stats": "{}",
+			[]telemetryFilterResult{
+				{"istio.stats", "{}"},
 			},
 		},
 		{
@@ -542,8 +1262,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stats": `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`,
+			[]telemetryFilterResult{
+				{"istio.stats", `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`},
 			},
 		},
 		{
@@ -553,8 +1273,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolTCP,
 			nil,
-			map[string]string{
-				"istio.stats": `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`,
+			[]telemetryFilterResult{
+				{"istio.stats", `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`},
 			},
 		},
 		{
@@ -564,8 +1284,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stackdriver": `{}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{}`},
 			},
 		},
 		{
@@ -575,8 +1295,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stackdriver": `{"metrics_overrides":{"client/request_count":{"tag_overrides":{"add":"bar"}}}}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"metrics_overrides":{"client/request_count":{"tag_overrides":{"add":"bar"}}}}`},
 			},
 		},
 		{
@@ -589,8 +1309,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stackdriver": `{}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{}`},
 			},
 		},
 		{
@@ -603,8 +1323,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stats": `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`,
+			[]telemetryFilterResult{
+				{"istio.stats", `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`},
 			},
 		},
 		{
@@ -616,8 +1336,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			[]string{"prometheus"},
-			map[string]string{
-				"istio.stats": `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`,
+			[]telemetryFilterResult{
+				{"istio.stats", `{"metrics":[{"dimensions":{"add":"bar"},"name":"requests_total","tags_to_remove":["remove"]}]}`},
 			},
 		},
 		{
@@ -629,8 +1349,8 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			[]string{"prometheus"},
-			map[string]string{
-				"istio.stackdriver": `{}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{}`},
 			},
 		},
 		{
@@ -642,8 +1362,46 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarOutbound,
 			networking.ListenerProtocolHTTP,
 			nil,
-			map[string]string{
-				"istio.stackdriver": `{"access_logging":"ERRORS_ONLY"}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"access_logging":"ERRORS_ONLY"}`},
+			},
+		},
+		{
+			"prometheus and stackdriver",
+			[]config.Config{newTelemetry("istio-system", prometheusAndStackdriver)},
+			sidecar,
+			networking.ListenerClassSidecarOutbound,
+			networking.ListenerProtocolHTTP,
+			nil,
+			[]telemetryFilterResult{
+				{"istio.stats", "{}"},
+				{"istio.stackdriver", "{}"},
+			},
+		},
+		{
+			"prometheus and stackdriver TCP",
+			[]config.Config{newTelemetry("istio-system", prometheusAndStackdriver)},
+			sidecar,
+			networking.ListenerClassSidecarOutbound,
+			networking.ListenerProtocolTCP,
+			nil,
+			[]telemetryFilterResult{
+				{"istio.stats", "{}"},
+				{"istio.stackdriver", "{}"},
+			},
+		},
+		{
+			"stackdriver logging and metrics",
+			[]config.Config{
+				newTelemetry("istio-system", emptyStackdriver),
+				newTelemetry("default", sdLogging),
+			},
+			sidecar,
+			networking.ListenerClassSidecarOutbound,
+			networking.ListenerProtocolHTTP,
+			nil,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"access_logging":"ERRORS_ONLY"}`},
 			},
 		},
 		{
@@ -655,8 +1413,60 @@ func TestTelemetryFilters(t *testing.T) {
 			networking.ListenerClassSidecarInbound,
 			networking.ListenerProtocolHTTP,
 			[]string{"stackdriver"},
-			map[string]string{
-				"istio.stackdriver": `{"disable_host_header_fallback":true,"access_logging":"FULL"}`,
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"disable_host_header_fallback":true,"access_logging":"FULL"}`},
+			},
+		},
+		{
+			"stackdriver defaultProviders old proxy",
+			[]config.Config{
+				newTelemetry("default", emptyLogging),
+			},
+			oldSidecar,
+			networking.ListenerClassSidecarInbound,
+			networking.ListenerProtocolHTTP,
+			[]string{"stackdriver"},
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"access_logging":"FULL"}`},
+			},
+		},
+		{
+			"stackdriver defaultProviders new proxy",
+			[]config.Config{
+				newTelemetry("default", emptyLogging),
+			},
+			newSidecar,
+			networking.ListenerClassSidecarInbound,
+			networking.ListenerProtocolHTTP,
+			[]string{"stackdriver"},
+			[]telemetryFilterResult{
+				{"istio.stackdriver", `{"disable_host_header_fallback":true,"access_logging":"FULL"}`},
+			},
+		},
+		{
+			"prometheus inbound old proxy",
+			[]config.Config{
+				newTelemetry("istio-system", emptyPrometheus),
+			},
+			oldSidecar,
+			networking.ListenerClassSidecarInbound,
+			networking.ListenerProtocolHTTP,
+			nil,
+			[]telemetryFilterResult{
+				{"istio.stats", `{}`},
+			},
+		},
+		{
+			"prometheus inbound new proxy",
+			[]config.Config{
+				newTelemetry("istio-system", emptyPrometheus),
+			},
+			newSidecar,
+			networking.ListenerClassSidecarInbound,
+			networking.ListenerProtocolHTTP,
+			nil,
+			[]telemetryFilterResult{
+				{"istio.stats", `{"disable_host_header_fallback":true}`},
 			},
 		},
 	}
@@ -665,8 +1475,8 @@ func TestTelemetryFilters(t *testing.T) {
 			telemetry := createTestTelemetries(tt.cfgs, t)
 			telemetry.meshConfig.DefaultProviders.Metrics = tt.defaultProviders
 			telemetry.meshConfig.DefaultProviders.AccessLogging = tt.defaultProviders
-			got := telemetry.telemetryFilters(tt.proxy, tt.class, tt.protocol)
-			res := map[string]string{}
+			got := telemetry.telemetryFilters(tt.proxy, tt.class, tt.protocol, 0)
+			var res []telemetryFilterResult
 			http, ok := got.([]*httppb.HttpFilter)
 			if ok {
 				for _, f := range http {
@@ -679,7 +1489,7 @@ func TestTelemetryFilters(t *testing.T) {
 					if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
 						t.Fatal(err)
 					}
-					res[f.GetName()] = cfg.GetValue()
+					res = append(res, telemetryFilterResult{f.GetName(), cfg.GetValue()})
 				}
 			}
 			tcp, ok := got.([]*listener.Filter)
@@ -694,7 +1504,7 @@ func TestTelemetryFilters(t *testing.T) {
 					if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
 						t.Fatal(err)
 					}
-					res[f.GetName()] = cfg.GetValue()
+					res = append(res, telemetryFilterResult{f.GetName(), cfg.GetValue()})
 				}
 			}
 			if diff := cmp.Diff(res, tt.want); diff != "" {
@@ -703,3 +1513,653 @@ func TestTelemetryFilters(t *testing.T) {
 		})
 	}
 }
+
+func TestTelemetryFiltersMetricsDisabledAnnotation(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	disabled := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{
+		Labels:      map[string]string{"app": "test"},
+		Annotations: map[string]string{constants.TelemetryMetrics: "disabled"},
+	}}
+	prometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	}
+	workloadPrometheus := newTelemetry("default", &tpb.Telemetry{
+		Selector: &selectorpb.WorkloadSelector{MatchLabels: map[string]string{"app": "test"}},
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	})
+	workloadPrometheus.Name = "workload"
+	sdLogging := &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		cfgs     []config.Config
+		proxy    *Proxy
+		protocol networking.ListenerProtocol
+		want     []string
+	}{
+		{
+			name:     "annotation absent",
+			cfgs:     []config.Config{newTelemetry("default", prometheus)},
+			proxy:    sidecar,
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{"istio.stats"},
+		},
+		{
+			name:     "annotation present",
+			cfgs:     []config.Config{newTelemetry("default", prometheus)},
+			proxy:    disabled,
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{},
+		},
+		{
+			name:     "annotation present tcp",
+			cfgs:     []config.Config{newTelemetry("default", prometheus)},
+			proxy:    disabled,
+			protocol: networking.ListenerProtocolTCP,
+			want:     []string{},
+		},
+		{
+			name:     "annotation overrides root telemetry",
+			cfgs:     []config.Config{newTelemetry("istio-system", prometheus)},
+			proxy:    disabled,
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{},
+		},
+		{
+			name:     "workload telemetry overrides annotation",
+			cfgs:     []config.Config{newTelemetry("default", prometheus), workloadPrometheus},
+			proxy:    disabled,
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{"istio.stats"},
+		},
+		{
+			name:     "logging kept",
+			cfgs:     []config.Config{newTelemetry("istio-system", sdLogging), newTelemetry("default", prometheus)},
+			proxy:    disabled,
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{"istio.stackdriver"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			got := telemetry.telemetryFilters(tt.proxy, networking.ListenerClassSidecarInbound, tt.protocol, 0)
+			names := []string{}
+			switch filters := got.(type) {
+			case []*httppb.HttpFilter:
+				for _, f := range filters {
+					names = append(names, f.GetName())
+				}
+			case []*listener.Filter:
+				for _, f := range filters {
+					names = append(names, f.GetName())
+				}
+			}
+			if diff := cmp.Diff(names, tt.want); diff != "" {
+				t.Errorf("got diff: %v", diff)
+			}
+		})
+	}
+}
+
+func TestTelemetryFiltersDisabledTCPPorts(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	prometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	}
+	sdLogging := &tpb.Telemetry{
+		AccessLogging: []*tpb.AccessLogging{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "stackdriver"}},
+			},
+		},
+	}
+	sdDropped := `{"access_logging":"ERRORS_ONLY","metrics_overrides":{` +
+		`"client/connection_close_count":{"drop":true},"client/connection_open_count":{"drop":true},` +
+		`"client/received_bytes_count":{"drop":true},"client/request_bytes":{"drop":true},` +
+		`"client/request_count":{"drop":true},"client/response_bytes":{"drop":true},` +
+		`"client/response_latencies":{"drop":true},"client/sent_bytes_count":{"drop":true}}}`
+	tests := []struct {
+		name     string
+		cfgs     []config.Config
+		protocol networking.ListenerProtocol
+		port     uint32
+		want     []string
+	}{
+		{
+			name:     "http port",
+			cfgs:     []config.Config{withAnnotation(newTelemetry("istio-system", prometheus), constants.TelemetryDisableTCPMetricsPorts, "3306")},
+			protocol: networking.ListenerProtocolHTTP,
+			want:     []string{"{}"},
+		},
+		{
+			name:     "tcp port disabled",
+			cfgs:     []config.Config{withAnnotation(newTelemetry("istio-system", prometheus), constants.TelemetryDisableTCPMetricsPorts, "3306")},
+			protocol: networking.ListenerProtocolTCP,
+			port:     3306,
+			want:     nil,
+		},
+		{
+			name:     "tcp port not disabled",
+			cfgs:     []config.Config{withAnnotation(newTelemetry("istio-system", prometheus), constants.TelemetryDisableTCPMetricsPorts, "3306, 5432")},
+			protocol: networking.ListenerProtocolTCP,
+			port:     9000,
+			want:     []string{"{}"},
+		},
+		{
+			name:     "tcp port unspecified",
+			cfgs:     []config.Config{withAnnotation(newTelemetry("istio-system", prometheus), constants.TelemetryDisableTCPMetricsPorts, "3306")},
+			protocol: networking.ListenerProtocolTCP,
+			port:     0,
+			want:     []string{"{}"},
+		},
+		{
+			name: "namespace re-enables",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", prometheus), constants.TelemetryDisableTCPMetricsPorts, "3306"),
+				withAnnotation(newTelemetry("default", &tpb.Telemetry{}), constants.TelemetryDisableTCPMetricsPorts, ""),
+			},
+			protocol: networking.ListenerProtocolTCP,
+			port:     3306,
+			want:     []string{"{}"},
+		},
+		{
+			name:     "stackdriver keeps logging",
+			cfgs:     []config.Config{withAnnotation(newTelemetry("istio-system", sdLogging), constants.TelemetryDisableTCPMetricsPorts, "3306")},
+			protocol: networking.ListenerProtocolTCP,
+			port:     3306,
+			want:     []string{sdDropped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			var got []string
+			switch filters := telemetry.telemetryFilters(sidecar, networking.ListenerClassSidecarOutbound, tt.protocol, tt.port).(type) {
+			case []*httppb.HttpFilter:
+				for _, f := range filters {
+					w := &httpwasm.Wasm{}
+					if err := f.GetTypedConfig().UnmarshalTo(w); err != nil {
+						t.Fatal(err)
+					}
+					cfg := &wrapperspb.StringValue{}
+					if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, cfg.GetValue())
+				}
+			case []*listener.Filter:
+				for _, f := range filters {
+					w := &wasmfilter.Wasm{}
+					if err := f.GetTypedConfig().UnmarshalTo(w); err != nil {
+						t.Fatal(err)
+					}
+					cfg := &wrapperspb.StringValue{}
+					if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, cfg.GetValue())
+				}
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("got diff: %v", diff)
+			}
+		})
+	}
+}
+
+func TestTelemetryFiltersProxyVersionCache(t *testing.T) {
+	prometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	}
+	telemetry := createTestTelemetries([]config.Config{newTelemetry("istio-system", prometheus)}, t)
+	proxy := func(v *IstioVersion) *Proxy {
+		return &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{}, IstioVersion: v}
+	}
+	statsConfig := func(p *Proxy) string {
+		filters := telemetry.telemetryFilters(p, networking.ListenerClassGateway, networking.ListenerProtocolHTTP, 0).([]*httppb.HttpFilter)
+		if len(filters) != 1 {
+			t.Fatalf("expected 1 filter, got %v", len(filters))
+		}
+		w := &httpwasm.Wasm{}
+		if err := filters[0].GetTypedConfig().UnmarshalTo(w); err != nil {
+			t.Fatal(err)
+		}
+		cfg := &wrapperspb.StringValue{}
+		if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
+			t.Fatal(err)
+		}
+		return cfg.GetValue()
+	}
+
+	// Both proxies match the same Telemetry resources, so the cache must not mix up their formats.
+	newFormat := `{"disable_host_header_fallback":true}`
+	if got := statsConfig(proxy(nil)); got != newFormat {
+		t.Fatalf("unknown version proxy got %v, want %v", got, newFormat)
+	}
+	if got := statsConfig(proxy(&IstioVersion{Major: 1, Minor: 11, Patch: 0})); got != "{}" {
+		t.Fatalf("1.11 proxy got %v, want {}", got)
+	}
+	if got := statsConfig(proxy(&IstioVersion{Major: 1, Minor: 13, Patch: 0})); got != newFormat {
+		t.Fatalf("1.13 proxy got %v, want %v", got, newFormat)
+	}
+}
+
+func TestTelemetryFiltersMeshMetricDimensions(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	prometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+			},
+		},
+	}
+	overridePrometheus := &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}},
+				Overrides: []*tpb.MetricsOverrides{{
+					Match: &tpb.MetricSelector{
+						MetricMatch: &tpb.MetricSelector_Metric{Metric: tpb.MetricSelector_REQUEST_COUNT},
+					},
+					TagOverrides: map[string]*tpb.MetricsOverrides_TagOverride{
+						"mesh_id":     {Operation: tpb.MetricsOverrides_TagOverride_UPSERT, Value: "'other'"},
+						"environment": {Operation: tpb.MetricsOverrides_TagOverride_REMOVE},
+					},
+				}},
+			},
+		},
+	}
+	dimensions := map[string]string{"mesh_id": "'mesh1'", "environment": "node.metadata['ENV']"}
+	type metric struct {
+		Dimensions   map[string]string `json:"dimensions"`
+		TagsToRemove []string          `json:"tags_to_remove"`
+	}
+	tests := []struct {
+		name             string
+		cfgs             []config.Config
+		protocol         networking.ListenerProtocol
+		defaultProviders []string
+		// want holds the expected configuration of metrics, keyed by name. Other metrics have the dimensions.
+		want map[string]metric
+	}{
+		{
+			name:     "http",
+			cfgs:     []config.Config{newTelemetry("istio-system", prometheus)},
+			protocol: networking.ListenerProtocolHTTP,
+		},
+		{
+			name:     "tcp",
+			cfgs:     []config.Config{newTelemetry("istio-system", prometheus)},
+			protocol: networking.ListenerProtocolTCP,
+		},
+		{
+			name:             "default provider",
+			protocol:         networking.ListenerProtocolHTTP,
+			defaultProviders: []string{"prometheus"},
+		},
+		{
+			name:     "telemetry overrides",
+			cfgs:     []config.Config{newTelemetry("istio-system", prometheus), newTelemetry("default", overridePrometheus)},
+			protocol: networking.ListenerProtocolHTTP,
+			want: map[string]metric{
+				"requests_total": {
+					Dimensions:   map[string]string{"mesh_id": "'other'"},
+					TagsToRemove: []string{"environment"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			telemetry.meshConfig.DefaultProviders.Metrics = tt.defaultProviders
+			telemetry.metricDimensions = dimensions
+			var cfg string
+			switch filters := telemetry.telemetryFilters(sidecar, networking.ListenerClassSidecarOutbound, tt.protocol, 0).(type) {
+			case []*httppb.HttpFilter:
+				if len(filters) != 1 {
+					t.Fatalf("expected 1 filter, got %d", len(filters))
+				}
+				w := &httpwasm.Wasm{}
+				if err := filters[0].GetTypedConfig().UnmarshalTo(w); err != nil {
+					t.Fatal(err)
+				}
+				cfg = stringConfiguration(t, w.GetConfig().GetConfiguration())
+			case []*listener.Filter:
+				if len(filters) != 1 {
+					t.Fatalf("expected 1 filter, got %d", len(filters))
+				}
+				w := &wasmfilter.Wasm{}
+				if err := filters[0].GetTypedConfig().UnmarshalTo(w); err != nil {
+					t.Fatal(err)
+				}
+				cfg = stringConfiguration(t, w.GetConfig().GetConfiguration())
+			}
+			got := struct {
+				Metrics []struct {
+					Name string `json:"name"`
+					metric
+				} `json:"metrics"`
+			}{}
+			if err := json.Unmarshal([]byte(cfg), &got); err != nil {
+				t.Fatalf("invalid filter configuration %v: %v", cfg, err)
+			}
+			if len(got.Metrics) != len(metricToPrometheusMetric) {
+				t.Fatalf("expected dimensions on all %d metrics, got %v", len(metricToPrometheusMetric), cfg)
+			}
+			for _, m := range got.Metrics {
+				want, f := tt.want[m.Name]
+				if !f {
+					want = metric{Dimensions: dimensions}
+				}
+				if diff := cmp.Diff(m.metric, want); diff != "" {
+					t.Errorf("metric %v got diff: %v", m.Name, diff)
+				}
+			}
+		})
+	}
+}
+
+func getTelemetryFilterErrors(t *testing.T, provider string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData("pilot_telemetry_filter_errors")
+	if err != nil {
+		t.Fatalf("failed to get telemetry filter errors: %v", err)
+	}
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key.Name() == "provider" && tag.Value == provider {
+				return row.Data.(*view.SumData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestTelemetryFiltersProviderFailure(t *testing.T) {
+	// Fail to encode the Stackdriver configuration when it has the broken tag
+	marshalFilterConfig = func(msg proto.Message) ([]byte, error) {
+		if cfg, ok := msg.(*sd.PluginConfig); ok {
+			for _, o := range cfg.MetricsOverrides {
+				if _, f := o.TagOverrides["broken"]; f {
+					return nil, fmt.Errorf("invalid tag override")
+				}
+			}
+		}
+		return protomarshal.MarshalProtoNames(msg)
+	}
+	defer func() {
+		marshalFilterConfig = protomarshal.MarshalProtoNames
+	}()
+
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	telemetry := createTestTelemetries([]config.Config{newTelemetry("istio-system", &tpb.Telemetry{
+		Metrics: []*tpb.Metrics{
+			{
+				Providers: []*tpb.ProviderRef{{Name: "prometheus"}, {Name: "stackdriver"}},
+				Overrides: []*tpb.MetricsOverrides{{
+					Match: &tpb.MetricSelector{
+						MetricMatch: &tpb.MetricSelector_Metric{Metric: tpb.MetricSelector_REQUEST_COUNT},
+					},
+					TagOverrides: map[string]*tpb.MetricsOverrides_TagOverride{
+						"broken": {Operation: tpb.MetricsOverrides_TagOverride_UPSERT, Value: "'value'"},
+					},
+				}},
+			},
+		},
+	})}, t)
+
+	before := getTelemetryFilterErrors(t, "stackdriver")
+	httpFilters := telemetry.telemetryFilters(sidecar, networking.ListenerClassSidecarOutbound, networking.ListenerProtocolHTTP, 0)
+	if f := httpFilters.([]*httppb.HttpFilter); len(f) != 1 || f[0].Name != statsFilterName {
+		t.Fatalf("expected only the %s filter, got %v", statsFilterName, f)
+	}
+	tcpFilters := telemetry.telemetryFilters(sidecar, networking.ListenerClassSidecarOutbound, networking.ListenerProtocolTCP, 0)
+	if f := tcpFilters.([]*listener.Filter); len(f) != 1 || f[0].Name != statsFilterName {
+		t.Fatalf("expected only the %s filter, got %v", statsFilterName, f)
+	}
+	if got := getTelemetryFilterErrors(t, "stackdriver") - before; got != 2 {
+		t.Fatalf("got %v new filter errors, want 2", got)
+	}
+	if got := getTelemetryFilterErrors(t, "prometheus"); got != 0 {
+		t.Fatalf("got %v filter errors for prometheus, want 0", got)
+	}
+}
+
+func stringConfiguration(t *testing.T, a *anypb.Any) string {
+	t.Helper()
+	cfg := &wrapperspb.StringValue{}
+	if err := a.UnmarshalTo(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.GetValue()
+}
+
+func TestProxyCanonicalIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *NodeMetadata
+		want     CanonicalIdentity
+	}{
+		{
+			name: "defaults",
+			want: CanonicalIdentity{CanonicalRevision: "latest", CanonicalService: "unknown", MeshID: "unknown", Namespace: "default"},
+		},
+		{
+			name: "metadata",
+			metadata: &NodeMetadata{
+				Namespace: "bookinfo",
+				MeshID:    "mesh1",
+				Labels: map[string]string{
+					IstioCanonicalServiceLabelName:         "reviews",
+					IstioCanonicalServiceRevisionLabelName: "v2",
+				},
+			},
+			want: CanonicalIdentity{CanonicalRevision: "v2", CanonicalService: "reviews", MeshID: "mesh1", Namespace: "bookinfo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProxyCanonicalIdentity(tt.metadata); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithIdentityDimensions(t *testing.T) {
+	identity := CanonicalIdentity{CanonicalRevision: "v2", CanonicalService: "reviews", MeshID: "mesh1", Namespace: "bookinfo"}
+	got := withIdentityDimensions(map[string]string{"istio_mesh_id": "'other'", "environment": "node.metadata['ENV']"}, identity)
+	want := map[string]string{
+		"istio_canonical_revision": `"v2"`,
+		"istio_canonical_service":  `"reviews"`,
+		"istio_mesh_id":            "'other'",
+		"istio_namespace":          `"bookinfo"`,
+		"environment":              "node.metadata['ENV']",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %v", diff)
+	}
+	for name, expression := range got {
+		if err := validateMetricDimension(name, expression); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestValidateMetricDimension(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		valid      bool
+	}{
+		{"mesh_id", "'mesh1'", true},
+		{"environment", "node.metadata['ENV']", true},
+		{"method", "request.method", true},
+		{"invalid-name", "'value'", false},
+		{"empty", "", false},
+		{"request_id", "request.id", false},
+		{"request_id_header", "request.headers['x-request-id']", false},
+		{"path", "request.url_path", false},
+		{"connection", "string(connection.id)", false},
+		{"source_port", "source.port", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetricDimension(tt.name, tt.expression)
+			if tt.valid && err != nil {
+				t.Fatalf("expected %s=%s to be valid, got %v", tt.name, tt.expression, err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected %s=%s to be rejected", tt.name, tt.expression)
+			}
+		})
+	}
+	got := validMetricDimensions(map[string]string{"mesh_id": "'mesh1'", "request_id": "request.id"})
+	if want := map[string]string{"mesh_id": "'mesh1'"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got dimensions %v, want %v", got, want)
+	}
+}
+
+func TestTelemetrySummary(t *testing.T) {
+	sidecar := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{Labels: map[string]string{"app": "test"}}}
+	tracingDisabled := &Proxy{ConfigNamespace: "default", Metadata: &NodeMetadata{
+		Labels:      map[string]string{"app": "test"},
+		Annotations: map[string]string{constants.TelemetryTracing: "disabled"},
+	}}
+	root := &tpb.Telemetry{
+		Tracing:       []*tpb.Tracing{{Providers: []*tpb.ProviderRef{{Name: "envoy"}}}},
+		AccessLogging: []*tpb.AccessLogging{{Providers: []*tpb.ProviderRef{{Name: "envoy"}}}},
+		Metrics:       []*tpb.Metrics{{Providers: []*tpb.ProviderRef{{Name: "prometheus"}}}},
+	}
+	overrides := &tpb.Telemetry{
+		Tracing:       []*tpb.Tracing{{RandomSamplingPercentage: &types.DoubleValue{Value: 25}}},
+		AccessLogging: []*tpb.AccessLogging{{Disabled: &types.BoolValue{Value: true}}},
+	}
+	tests := []struct {
+		name  string
+		cfgs  []config.Config
+		proxy *Proxy
+		want  *TelemetrySummary
+	}{
+		{
+			name:  "empty",
+			proxy: sidecar,
+			want:  &TelemetrySummary{},
+		},
+		{
+			name:  "root",
+			cfgs:  []config.Config{newTelemetry("istio-system", root)},
+			proxy: sidecar,
+			want: &TelemetrySummary{
+				Tracing:       &TracingSummary{Provider: "envoy"},
+				AccessLogging: &AccessLoggingSummary{Providers: []string{"envoy"}},
+				Metrics:       &MetricsSummary{Providers: []string{"prometheus"}},
+			},
+		},
+		{
+			name:  "namespace overrides",
+			cfgs:  []config.Config{newTelemetry("istio-system", root), newTelemetry("default", overrides)},
+			proxy: sidecar,
+			want: &TelemetrySummary{
+				Tracing: &TracingSummary{
+					Provider: "envoy",
+					Inbound:  TracingDecision{RandomSamplingPercentage: 25},
+					Outbound: TracingDecision{RandomSamplingPercentage: 25},
+				},
+				AccessLogging: &AccessLoggingSummary{Providers: []string{}},
+				Metrics:       &MetricsSummary{Providers: []string{"prometheus"}},
+			},
+		},
+		{
+			name: "direction overrides",
+			cfgs: []config.Config{
+				withAnnotation(newTelemetry("istio-system", root), constants.TelemetryTracingInboundDisabled, "true"),
+			},
+			proxy: sidecar,
+			want: &TelemetrySummary{
+				Tracing: &TracingSummary{
+					Provider: "envoy",
+					Inbound:  TracingDecision{Disabled: true},
+				},
+				AccessLogging: &AccessLoggingSummary{Providers: []string{"envoy"}},
+				Metrics:       &MetricsSummary{Providers: []string{"prometheus"}},
+			},
+		},
+		{
+			name:  "tracing disabled by annotation",
+			cfgs:  []config.Config{newTelemetry("istio-system", root)},
+			proxy: tracingDisabled,
+			want: &TelemetrySummary{
+				Tracing:       &TracingSummary{Provider: "envoy", DisabledByAnnotation: true},
+				AccessLogging: &AccessLoggingSummary{Providers: []string{"envoy"}},
+				Metrics:       &MetricsSummary{Providers: []string{"prometheus"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			telemetry := createTestTelemetries(tt.cfgs, t)
+			got := telemetry.Summary(tt.proxy)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Fatalf("got diff %v", diff)
+			}
+
+			// The summary must agree with the configuration used to generate the proxy config.
+			tracing := telemetry.Tracing(tt.proxy)
+			if tracing == nil && got.Tracing != nil && *got.Tracing != (TracingSummary{DisabledByAnnotation: true}) {
+				t.Fatalf("tracing summary %+v does not match missing tracing config", got.Tracing)
+			}
+			if tracing != nil {
+				if tracing.Provider.GetName() != got.Tracing.Provider {
+					t.Errorf("tracing provider %q does not match %q", got.Tracing.Provider, tracing.Provider.GetName())
+				}
+				for class, decision := range map[networking.ListenerClass]TracingDecision{
+					networking.ListenerClassSidecarInbound:  got.Tracing.Inbound,
+					networking.ListenerClassSidecarOutbound: got.Tracing.Outbound,
+					networking.ListenerClassGateway:         got.Tracing.Outbound,
+				} {
+					disabled, sampling := tracing.ForClass(class)
+					if disabled != decision.Disabled || sampling != decision.RandomSamplingPercentage {
+						t.Errorf("tracing decision %+v does not match config (%v, %v) for class %v", decision, disabled, sampling, class)
+					}
+				}
+			}
+			logging := telemetry.AccessLogging(tt.proxy)
+			if (logging == nil) != (got.AccessLogging == nil) {
+				t.Fatalf("access logging summary %+v does not match logging config %+v", got.AccessLogging, logging)
+			}
+			if logging != nil {
+				var names []string
+				for _, p := range logging.Providers {
+					names = append(names, p.Name)
+				}
+				if diff := cmp.Diff(names, got.AccessLogging.Providers, cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("access logging providers do not match: %v", diff)
+				}
+			}
+		})
+	}
+}
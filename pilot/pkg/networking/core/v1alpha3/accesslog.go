@@ -15,6 +15,7 @@
 package v1alpha3
 
 import (
+	"strings"
 	"sync"
 
 	accesslog "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
@@ -24,10 +25,13 @@ import (
 	grpcaccesslog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"google.golang.org/protobuf/proto"
 	structpb "google.golang.org/protobuf/types/known/structpb"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/util/protomarshal"
@@ -59,6 +63,13 @@ const (
 	// EnvoyAccessLogCluster is the cluster name that has details for server implementing Envoy ALS.
 	// This cluster is created in bootstrap.
 	EnvoyAccessLogCluster = "envoy_accesslog_service"
+
+	// accessLogSamplingRuntimeKeyPrefix prefixes the runtime keys that can override the access log sampling
+	// percentage of a provider in the proxy.
+	accessLogSamplingRuntimeKeyPrefix = "access_log.sampling."
+	// accessLogErrorStatusRuntimeKey can override the minimum response code of requests that are logged regardless
+	// of the access log sampling.
+	accessLogErrorStatusRuntimeKey = "access_log.error_status_code"
 )
 
 var (
@@ -126,9 +137,9 @@ func newAccessLogBuilder() *AccessLogBuilder {
 	}
 }
 
-func (b *AccessLogBuilder) setTCPAccessLog(mesh *meshconfig.MeshConfig, config *tcp.TcpProxy) {
+func (b *AccessLogBuilder) setTCPAccessLog(mesh *meshconfig.MeshConfig, proxy *model.Proxy, config *tcp.TcpProxy) {
 	if mesh.AccessLogFile != "" {
-		config.AccessLog = append(config.AccessLog, b.buildFileAccessLog(mesh))
+		config.AccessLog = append(config.AccessLog, b.buildFileAccessLog(mesh, proxy))
 	}
 
 	if mesh.EnableEnvoyAccessLogService {
@@ -136,14 +147,16 @@ func (b *AccessLogBuilder) setTCPAccessLog(mesh *meshconfig.MeshConfig, config *
 	}
 }
 
-func buildAccessLogFromTelemetry(mesh *meshconfig.MeshConfig, spec *model.LoggingConfig, forListener bool) *accesslog.AccessLog {
+func buildAccessLogFromTelemetry(mesh *meshconfig.MeshConfig, proxy *model.Proxy, spec *model.LoggingConfig,
+	forListener bool) *accesslog.AccessLog {
 	for _, p := range spec.Providers {
 		switch prov := p.Provider.(type) {
 		case *meshconfig.MeshConfig_ExtensionProvider_EnvoyFileAccessLog:
-			al := buildFileAccessLogHelper(prov.EnvoyFileAccessLog.Path, mesh)
+			al := buildFileAccessLogHelper(prov.EnvoyFileAccessLog.Path, mesh, proxy)
 			if forListener {
 				al.Filter = addAccessLogFilter()
 			}
+			al.Filter = buildAccessLogSamplingFilter(spec, p.Name, al.Filter)
 			// TODO support multiple
 			return al
 		}
@@ -159,7 +172,7 @@ func (b *AccessLogBuilder) setHTTPAccessLog(opts buildListenerOpts, connectionMa
 	if cfg == nil {
 		// No Telemetry API configured, fall back to legacy mesh config setting
 		if mesh.AccessLogFile != "" {
-			connectionManager.AccessLog = append(connectionManager.AccessLog, b.buildFileAccessLog(mesh))
+			connectionManager.AccessLog = append(connectionManager.AccessLog, b.buildFileAccessLog(mesh, opts.proxy))
 		}
 
 		if mesh.EnableEnvoyAccessLogService {
@@ -168,7 +181,7 @@ func (b *AccessLogBuilder) setHTTPAccessLog(opts buildListenerOpts, connectionMa
 		return
 	}
 
-	if al := buildAccessLogFromTelemetry(mesh, cfg, false); al != nil {
+	if al := buildAccessLogFromTelemetry(mesh, opts.proxy, cfg, false); al != nil {
 		connectionManager.AccessLog = append(connectionManager.AccessLog, al)
 	}
 }
@@ -183,7 +196,7 @@ func (b *AccessLogBuilder) setListenerAccessLog(push *model.PushContext, proxy *
 	if cfg == nil {
 		// No Telemetry API configured, fall back to legacy mesh config setting
 		if mesh.AccessLogFile != "" {
-			listener.AccessLog = append(listener.AccessLog, b.buildListenerFileAccessLog(mesh))
+			listener.AccessLog = append(listener.AccessLog, b.buildListenerFileAccessLog(mesh, proxy))
 		}
 
 		if mesh.EnableEnvoyAccessLogService {
@@ -193,16 +206,31 @@ func (b *AccessLogBuilder) setListenerAccessLog(push *model.PushContext, proxy *
 		return
 	}
 
-	if al := buildAccessLogFromTelemetry(mesh, cfg, true); al != nil {
+	if al := buildAccessLogFromTelemetry(mesh, proxy, cfg, true); al != nil {
 		listener.AccessLog = append(listener.AccessLog, al)
 	}
 }
 
-func buildFileAccessLogHelper(path string, mesh *meshconfig.MeshConfig) *accesslog.AccessLog {
+// accessLogIdentity returns the canonical identity of the proxy added to its access logs, if any. It is only added
+// to the default formats, set through PILOT_ACCESS_LOG_CANONICAL_IDENTITY.
+func accessLogIdentity(mesh *meshconfig.MeshConfig, proxy *model.Proxy) []model.IdentityAttribute {
+	if !features.AccessLogCanonicalIdentity || mesh.AccessLogFormat != "" || proxy == nil {
+		return nil
+	}
+	return model.ProxyCanonicalIdentity(proxy.Metadata).Attributes()
+}
+
+// escapeLogFormat escapes a literal value of an access log format.
+func escapeLogFormat(v string) string {
+	return strings.ReplaceAll(v, "%", "%%")
+}
+
+func buildFileAccessLogHelper(path string, mesh *meshconfig.MeshConfig, proxy *model.Proxy) *accesslog.AccessLog {
 	// We need to build access log. This is needed either on first access or when mesh config changes.
 	fl := &fileaccesslog.FileAccessLog{
 		Path: path,
 	}
+	identity := accessLogIdentity(mesh, proxy)
 
 	switch mesh.AccessLogEncoding {
 	case meshconfig.MeshConfig_TEXT:
@@ -210,6 +238,15 @@ func buildFileAccessLogHelper(path string, mesh *meshconfig.MeshConfig) *accessl
 		if mesh.AccessLogFormat != "" {
 			formatString = mesh.AccessLogFormat
 		}
+		if len(identity) > 0 {
+			var sb strings.Builder
+			sb.WriteString(strings.TrimSuffix(formatString, "\n"))
+			for _, a := range identity {
+				sb.WriteString(" " + a.Name + "=" + escapeLogFormat(a.Value))
+			}
+			sb.WriteString("\n")
+			formatString = sb.String()
+		}
 		fl.AccessLogFormat = &fileaccesslog.FileAccessLog_LogFormat{
 			LogFormat: &core.SubstitutionFormatString{
 				Format: &core.SubstitutionFormatString_TextFormatSource{
@@ -231,6 +268,12 @@ func buildFileAccessLogHelper(path string, mesh *meshconfig.MeshConfig) *accessl
 				jsonLogStruct = &parsedJSONLogStruct
 			}
 		}
+		if len(identity) > 0 {
+			jsonLogStruct = proto.Clone(jsonLogStruct).(*structpb.Struct)
+			for _, a := range identity {
+				jsonLogStruct.Fields[a.Name] = structpb.NewStringValue(escapeLogFormat(a.Value))
+			}
+		}
 		fl.AccessLogFormat = &fileaccesslog.FileAccessLog_LogFormat{
 			LogFormat: &core.SubstitutionFormatString{
 				Format: &core.SubstitutionFormatString_JsonFormat{
@@ -250,13 +293,17 @@ func buildFileAccessLogHelper(path string, mesh *meshconfig.MeshConfig) *accessl
 	return al
 }
 
-func (b *AccessLogBuilder) buildFileAccessLog(mesh *meshconfig.MeshConfig) *accesslog.AccessLog {
+func (b *AccessLogBuilder) buildFileAccessLog(mesh *meshconfig.MeshConfig, proxy *model.Proxy) *accesslog.AccessLog {
+	if accessLogIdentity(mesh, proxy) != nil {
+		// The access log is specific to the proxy, so it is not cached.
+		return buildFileAccessLogHelper(mesh.AccessLogFile, mesh, proxy)
+	}
 	if cal := b.cachedFileAccessLog(); cal != nil {
 		return cal
 	}
 
 	// We need to build access log. This is needed either on first access or when mesh config changes.
-	al := buildFileAccessLogHelper(mesh.AccessLogFile, mesh)
+	al := buildFileAccessLogHelper(mesh.AccessLogFile, mesh, nil)
 
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
@@ -273,13 +320,80 @@ func addAccessLogFilter() *accesslog.AccessLogFilter {
 	}
 }
 
-func (b *AccessLogBuilder) buildListenerFileAccessLog(mesh *meshconfig.MeshConfig) *accesslog.AccessLog {
+// buildAccessLogSamplingFilter returns the filter logging only the sampled share of the traffic for the provider,
+// combined with the existing filter of the access log, if any. If errors are always logged, requests with a 5xx
+// response code and requests or connections with any response flag are logged regardless of the sampling.
+func buildAccessLogSamplingFilter(spec *model.LoggingConfig, provider string, filter *accesslog.AccessLogFilter) *accesslog.AccessLogFilter {
+	percentage, sampled := spec.SamplingPercentage(provider)
+	if !sampled {
+		return filter
+	}
+	// The sampling decision is based on the x-request-id header when present, so a request is either logged
+	// by all proxies on its path or by none of them.
+	sampling := &accesslog.AccessLogFilter{
+		FilterSpecifier: &accesslog.AccessLogFilter_RuntimeFilter{
+			RuntimeFilter: &accesslog.RuntimeFilter{
+				RuntimeKey: accessLogSamplingRuntimeKeyPrefix + strings.ToLower(provider),
+				PercentSampled: &xdstype.FractionalPercent{
+					Numerator:   uint32(percentage * 10000),
+					Denominator: xdstype.FractionalPercent_MILLION,
+				},
+			},
+		},
+	}
+	if spec.AlwaysLogErrors {
+		sampling = &accesslog.AccessLogFilter{
+			FilterSpecifier: &accesslog.AccessLogFilter_OrFilter{
+				OrFilter: &accesslog.OrFilter{
+					Filters: []*accesslog.AccessLogFilter{
+						sampling,
+						{
+							FilterSpecifier: &accesslog.AccessLogFilter_StatusCodeFilter{
+								StatusCodeFilter: &accesslog.StatusCodeFilter{
+									Comparison: &accesslog.ComparisonFilter{
+										Op: accesslog.ComparisonFilter_GE,
+										Value: &core.RuntimeUInt32{
+											DefaultValue: 500,
+											RuntimeKey:   accessLogErrorStatusRuntimeKey,
+										},
+									},
+								},
+							},
+						},
+						{
+							// Without flags, the filter matches any response flag.
+							FilterSpecifier: &accesslog.AccessLogFilter_ResponseFlagFilter{
+								ResponseFlagFilter: &accesslog.ResponseFlagFilter{},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	if filter == nil {
+		return sampling
+	}
+	return &accesslog.AccessLogFilter{
+		FilterSpecifier: &accesslog.AccessLogFilter_AndFilter{
+			AndFilter: &accesslog.AndFilter{Filters: []*accesslog.AccessLogFilter{filter, sampling}},
+		},
+	}
+}
+
+func (b *AccessLogBuilder) buildListenerFileAccessLog(mesh *meshconfig.MeshConfig, proxy *model.Proxy) *accesslog.AccessLog {
+	if accessLogIdentity(mesh, proxy) != nil {
+		// The access log is specific to the proxy, so it is not cached.
+		lal := buildFileAccessLogHelper(mesh.AccessLogFile, mesh, proxy)
+		lal.Filter = addAccessLogFilter()
+		return lal
+	}
 	if cal := b.cachedListenerFileAccessLog(); cal != nil {
 		return cal
 	}
 
 	// We need to build access log. This is needed either on first access or when mesh config changes.
-	lal := buildFileAccessLogHelper(mesh.AccessLogFile, mesh)
+	lal := buildFileAccessLogHelper(mesh.AccessLogFile, mesh, nil)
 	// We add ResponseFlagFilter here, as we want to get listener access logs only on scenarios where we might
 	// not get filter Access Logs like in cases like NR to upstream.
 	lal.Filter = addAccessLogFilter()
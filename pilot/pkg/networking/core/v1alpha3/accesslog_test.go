@@ -15,16 +15,30 @@
 package v1alpha3
 
 import (
+	"encoding/json"
+	"strconv"
+	"strings"
 	"testing"
 
 	accesslog "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	fileaccesslog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	httpwasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	httppb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	tcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/util/protomarshal"
 )
 
@@ -149,3 +163,209 @@ func verify(t *testing.T, encoding meshconfig.MeshConfig_AccessLogEncoding, got
 		}
 	}
 }
+
+func TestAccessLogSampling(t *testing.T) {
+	fileProvider := &meshconfig.MeshConfig_ExtensionProvider{
+		Name: "Envoy",
+		Provider: &meshconfig.MeshConfig_ExtensionProvider_EnvoyFileAccessLog{
+			EnvoyFileAccessLog: &meshconfig.MeshConfig_ExtensionProvider_EnvoyFileAccessLogProvider{Path: "/dev/stdout"},
+		},
+	}
+	sampled := &accesslog.AccessLogFilter{
+		FilterSpecifier: &accesslog.AccessLogFilter_RuntimeFilter{
+			RuntimeFilter: &accesslog.RuntimeFilter{
+				RuntimeKey: "access_log.sampling.envoy",
+				PercentSampled: &xdstype.FractionalPercent{
+					Numerator:   125000,
+					Denominator: xdstype.FractionalPercent_MILLION,
+				},
+			},
+		},
+	}
+	sampledOrErrors := &accesslog.AccessLogFilter{
+		FilterSpecifier: &accesslog.AccessLogFilter_OrFilter{
+			OrFilter: &accesslog.OrFilter{
+				Filters: []*accesslog.AccessLogFilter{
+					sampled,
+					{
+						FilterSpecifier: &accesslog.AccessLogFilter_StatusCodeFilter{
+							StatusCodeFilter: &accesslog.StatusCodeFilter{
+								Comparison: &accesslog.ComparisonFilter{
+									Op:    accesslog.ComparisonFilter_GE,
+									Value: &core.RuntimeUInt32{DefaultValue: 500, RuntimeKey: "access_log.error_status_code"},
+								},
+							},
+						},
+					},
+					{
+						FilterSpecifier: &accesslog.AccessLogFilter_ResponseFlagFilter{
+							ResponseFlagFilter: &accesslog.ResponseFlagFilter{},
+						},
+					},
+				},
+			},
+		},
+	}
+	and := func(filters ...*accesslog.AccessLogFilter) *accesslog.AccessLogFilter {
+		return &accesslog.AccessLogFilter{
+			FilterSpecifier: &accesslog.AccessLogFilter_AndFilter{AndFilter: &accesslog.AndFilter{Filters: filters}},
+		}
+	}
+	for _, tc := range []struct {
+		name        string
+		cfg         *model.LoggingConfig
+		forListener bool
+		want        *accesslog.AccessLogFilter
+	}{
+		{
+			name: "not sampled",
+			cfg:  &model.LoggingConfig{Providers: []*meshconfig.MeshConfig_ExtensionProvider{fileProvider}},
+		},
+		{
+			name: "errors without sampling",
+			cfg: &model.LoggingConfig{
+				Providers:       []*meshconfig.MeshConfig_ExtensionProvider{fileProvider},
+				AlwaysLogErrors: true,
+			},
+		},
+		{
+			name: "sampled",
+			cfg: &model.LoggingConfig{
+				Providers: []*meshconfig.MeshConfig_ExtensionProvider{fileProvider},
+				Sampling:  map[string]float64{"envoy": 12.5},
+			},
+			want: sampled,
+		},
+		{
+			name: "sampled with errors",
+			cfg: &model.LoggingConfig{
+				Providers:       []*meshconfig.MeshConfig_ExtensionProvider{fileProvider},
+				Sampling:        map[string]float64{"envoy": 12.5},
+				AlwaysLogErrors: true,
+			},
+			want: sampledOrErrors,
+		},
+		{
+			name: "listener not sampled",
+			cfg: &model.LoggingConfig{
+				Providers: []*meshconfig.MeshConfig_ExtensionProvider{fileProvider},
+			},
+			forListener: true,
+			want:        addAccessLogFilter(),
+		},
+		{
+			name: "listener sampled with errors",
+			cfg: &model.LoggingConfig{
+				Providers:       []*meshconfig.MeshConfig_ExtensionProvider{fileProvider},
+				Sampling:        map[string]float64{"envoy": 12.5},
+				AlwaysLogErrors: true,
+			},
+			forListener: true,
+			want:        and(addAccessLogFilter(), sampledOrErrors),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mesh.DefaultMeshConfig()
+			al := buildAccessLogFromTelemetry(&m, nil, tc.cfg, tc.forListener)
+			if al == nil {
+				t.Fatal("expected file access log")
+			}
+			if diff := cmp.Diff(tc.want, al.Filter, protocmp.Transform()); diff != "" {
+				t.Fatalf("unexpected filter (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCanonicalIdentityConsistency(t *testing.T) {
+	defer func(accessLog, metrics bool) {
+		features.AccessLogCanonicalIdentity = accessLog
+		features.MetricsCanonicalIdentity = metrics
+	}(features.AccessLogCanonicalIdentity, features.MetricsCanonicalIdentity)
+	features.AccessLogCanonicalIdentity = true
+	features.MetricsCanonicalIdentity = true
+
+	env := buildListenerEnv(nil)
+	env.Mesh().AccessLogFile = "/dev/stdout"
+	env.Mesh().AccessLogEncoding = meshconfig.MeshConfig_JSON
+	env.Mesh().DefaultProviders = &meshconfig.MeshConfig_DefaultProviders{Metrics: []string{"prometheus"}}
+	if err := env.PushContext.InitContext(env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	proxy := &model.Proxy{
+		ConfigNamespace: "bookinfo",
+		Metadata: &model.NodeMetadata{
+			Namespace: "bookinfo",
+			MeshID:    "mesh1",
+			Labels: map[string]string{
+				model.IstioCanonicalServiceLabelName:         "reviews",
+				model.IstioCanonicalServiceRevisionLabelName: "v2",
+			},
+		},
+	}
+	want := map[string]string{
+		"canonical_revision": "v2",
+		"canonical_service":  "reviews",
+		"mesh_id":            "mesh1",
+		"namespace":          "bookinfo",
+	}
+
+	tags := map[string]string{}
+	for _, tag := range buildServiceTags(proxy.Metadata) {
+		tags[strings.TrimPrefix(tag.Tag, "istio.")] = tag.GetLiteral().GetValue()
+	}
+	if diff := cmp.Diff(want, tags); diff != "" {
+		t.Errorf("tracing tags got diff: %v", diff)
+	}
+
+	fl := &fileaccesslog.FileAccessLog{}
+	if err := accessLogBuilder.buildFileAccessLog(env.Mesh(), proxy).GetTypedConfig().UnmarshalTo(fl); err != nil {
+		t.Fatal(err)
+	}
+	fields := fl.GetLogFormat().GetJsonFormat().GetFields()
+	logged := map[string]string{}
+	for name := range want {
+		logged[name] = fields[name].GetStringValue()
+	}
+	if diff := cmp.Diff(want, logged); diff != "" {
+		t.Errorf("access log fields got diff: %v", diff)
+	}
+
+	filters := env.PushContext.Telemetry.HTTPFilters(proxy, networking.ListenerClassSidecarOutbound)
+	if len(filters) != 1 {
+		t.Fatalf("expected 1 filter, got %d", len(filters))
+	}
+	w := &httpwasm.Wasm{}
+	if err := filters[0].GetTypedConfig().UnmarshalTo(w); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &wrapperspb.StringValue{}
+	if err := w.GetConfig().GetConfiguration().UnmarshalTo(cfg); err != nil {
+		t.Fatal(err)
+	}
+	got := struct {
+		Metrics []struct {
+			Name       string            `json:"name"`
+			Dimensions map[string]string `json:"dimensions"`
+		} `json:"metrics"`
+	}{}
+	if err := json.Unmarshal([]byte(cfg.GetValue()), &got); err != nil {
+		t.Fatalf("invalid filter configuration %v: %v", cfg.GetValue(), err)
+	}
+	if len(got.Metrics) == 0 {
+		t.Fatalf("expected metric dimensions, got %v", cfg.GetValue())
+	}
+	for _, m := range got.Metrics {
+		dimensions := map[string]string{}
+		for name := range want {
+			v, err := strconv.Unquote(m.Dimensions["istio_"+name])
+			if err != nil {
+				t.Fatalf("metric %v has invalid dimension %v: %v", m.Name, name, err)
+			}
+			dimensions[name] = v
+		}
+		if diff := cmp.Diff(want, dimensions); diff != "" {
+			t.Errorf("metric %v dimensions got diff: %v", m.Name, diff)
+		}
+	}
+}
@@ -15,9 +15,14 @@
 package extension
 
 import (
+	"fmt"
+
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasm_filter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	hcm_filter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wasm_extension "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	extensions "istio.io/api/extensions/v1alpha1"
@@ -25,6 +30,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking"
 	authzmodel "istio.io/istio/pilot/pkg/security/authz/model"
 	securitymodel "istio.io/istio/pilot/pkg/security/model"
+	"istio.io/pkg/log"
 )
 
 const (
@@ -136,9 +142,11 @@ func toEnvoyHTTPFilter(wasmPlugin *model.WasmPluginWrapper) *hcm_filter.HttpFilt
 }
 
 // InsertedExtensionConfigurations returns pre-generated extension configurations added via WasmPlugin.
+// pullSecrets holds the image pull secret to fetch the module of a WasmPlugin with, keyed by the extension
+// configuration name.
 func InsertedExtensionConfigurations(
 	wasmPlugins map[extensions.PluginPhase][]*model.WasmPluginWrapper,
-	names []string) []*envoy_config_core_v3.TypedExtensionConfig {
+	names []string, pullSecrets map[string][]byte) []*envoy_config_core_v3.TypedExtensionConfig {
 	result := make([]*envoy_config_core_v3.TypedExtensionConfig, 0)
 	if len(wasmPlugins) == 0 {
 		return result
@@ -149,11 +157,43 @@ func InsertedExtensionConfigurations(
 	}
 	for _, list := range wasmPlugins {
 		for _, p := range list {
-			if _, ok := hasName[p.Namespace+"."+p.Name]; !ok {
+			name := p.Namespace + "." + p.Name
+			if _, ok := hasName[name]; !ok {
 				continue
 			}
-			result = append(result, proto.Clone(p.ExtensionConfiguration).(*envoy_config_core_v3.TypedExtensionConfig))
+			ec := proto.Clone(p.ExtensionConfiguration).(*envoy_config_core_v3.TypedExtensionConfig)
+			if secret := pullSecrets[name]; len(secret) > 0 {
+				if err := setPullSecret(ec, secret); err != nil {
+					log.Warnf("failed to set image pull secret of wasmplugin %s/%s: %v", p.Namespace, p.Name, err)
+				}
+			}
+			result = append(result, ec)
 		}
 	}
 	return result
 }
+
+// setPullSecret passes the image pull secret to the agent fetching the module, as a VM environment variable.
+func setPullSecret(ec *envoy_config_core_v3.TypedExtensionConfig, secret []byte) error {
+	filter := &wasm_filter.Wasm{}
+	if err := ec.GetTypedConfig().UnmarshalTo(filter); err != nil {
+		return err
+	}
+	vm := filter.GetConfig().GetVmConfig()
+	if vm == nil {
+		return fmt.Errorf("no vm config found")
+	}
+	if vm.EnvironmentVariables == nil {
+		vm.EnvironmentVariables = &wasm_extension.EnvironmentVariables{}
+	}
+	if vm.EnvironmentVariables.KeyValues == nil {
+		vm.EnvironmentVariables.KeyValues = map[string]string{}
+	}
+	vm.EnvironmentVariables.KeyValues[model.WasmSecretEnv] = string(secret)
+	typedConfig, err := anypb.New(filter)
+	if err != nil {
+		return err
+	}
+	ec.TypedConfig = typedConfig
+	return nil
+}
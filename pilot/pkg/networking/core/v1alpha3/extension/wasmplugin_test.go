@@ -18,7 +18,9 @@ import (
 	"testing"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasm_filter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wasm_extension "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
 	"github.com/gogo/protobuf/types"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/protobuf/testing/protocmp"
@@ -185,6 +187,7 @@ func TestInsertedExtensionConfigurations(t *testing.T) {
 		name        string
 		wasmPlugins map[extensions.PluginPhase][]*model.WasmPluginWrapper
 		names       []string
+		pullSecrets map[string][]byte
 		expectedECs []*envoy_config_core_v3.TypedExtensionConfig
 	}{
 		{
@@ -206,13 +209,66 @@ func TestInsertedExtensionConfigurations(t *testing.T) {
 				someAuthNFilter.ExtensionConfiguration,
 			},
 		},
+		{
+			name: "pull secret",
+			wasmPlugins: map[extensions.PluginPhase][]*model.WasmPluginWrapper{
+				extensions.PluginPhase_AUTHN: {
+					remoteFilter(nil),
+				},
+			},
+			names:       []string{"default.remote"},
+			pullSecrets: map[string][]byte{"default.remote": []byte(`{"auths":{}}`)},
+			expectedECs: []*envoy_config_core_v3.TypedExtensionConfig{
+				remoteFilter(map[string]string{model.WasmSecretEnv: `{"auths":{}}`}).ExtensionConfiguration,
+			},
+		},
+		{
+			name: "pull secret of other plugin",
+			wasmPlugins: map[extensions.PluginPhase][]*model.WasmPluginWrapper{
+				extensions.PluginPhase_AUTHN: {
+					remoteFilter(nil),
+				},
+			},
+			names:       []string{"default.remote"},
+			pullSecrets: map[string][]byte{"default.other": []byte(`{"auths":{}}`)},
+			expectedECs: []*envoy_config_core_v3.TypedExtensionConfig{
+				remoteFilter(nil).ExtensionConfiguration,
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			ecs := InsertedExtensionConfigurations(tc.wasmPlugins, tc.names)
+			ecs := InsertedExtensionConfigurations(tc.wasmPlugins, tc.names, tc.pullSecrets)
 			if diff := cmp.Diff(tc.expectedECs, ecs, protocmp.Transform()); diff != "" {
 				t.Fatal(diff)
 			}
 		})
 	}
 }
+
+func remoteFilter(envs map[string]string) *model.WasmPluginWrapper {
+	vm := &wasm_extension.VmConfig{
+		Code: &envoy_config_core_v3.AsyncDataSource{
+			Specifier: &envoy_config_core_v3.AsyncDataSource_Remote{
+				Remote: &envoy_config_core_v3.RemoteDataSource{
+					HttpUri: &envoy_config_core_v3.HttpUri{Uri: "oci://registry.example.com/filter:latest"},
+				},
+			},
+		},
+	}
+	if envs != nil {
+		vm.EnvironmentVariables = &wasm_extension.EnvironmentVariables{KeyValues: envs}
+	}
+	return &model.WasmPluginWrapper{
+		Name:      "remote",
+		Namespace: "default",
+		ExtensionConfiguration: &envoy_config_core_v3.TypedExtensionConfig{
+			Name: "default.remote",
+			TypedConfig: networking.MessageToAny(&wasm_filter.Wasm{
+				Config: &wasm_extension.PluginConfig{
+					Vm: &wasm_extension.PluginConfig_VmConfig{VmConfig: vm},
+				},
+			}),
+		},
+	}
+}
@@ -683,6 +683,16 @@ func buildGatewayListenerTLSContext(
 	// SDS config for gateway to fetch key/cert at gateway agent.
 	case server.Tls.CredentialName != "":
 		authn_model.ApplyCredentialSDSToServerCommonTLSContext(ctx.CommonTlsContext, server.Tls)
+		if proxy.MergedGateway != nil && proxy.MergedGateway.TLSServerInfo[server] != nil {
+			// The server may serve multiple certificates, such as RSA and ECDSA certificates, selected by the client
+			if names := proxy.MergedGateway.TLSServerInfo[server].CredentialNames; len(names) > 0 {
+				ctx.CommonTlsContext.TlsCertificateSdsSecretConfigs = make([]*tls.SdsSecretConfig, 0, len(names))
+				for _, name := range names {
+					ctx.CommonTlsContext.TlsCertificateSdsSecretConfigs = append(ctx.CommonTlsContext.TlsCertificateSdsSecretConfigs,
+						authn_model.ConstructSdsSecretConfigForCredential(name))
+				}
+			}
+		}
 	case server.Tls.Mode == networking.ServerTLSSettings_ISTIO_MUTUAL:
 		authn_model.ApplyToCommonTLSContext(ctx.CommonTlsContext, proxy, server.Tls.SubjectAltNames, []string{}, ctx.RequireClientCertificate.Value)
 	default:
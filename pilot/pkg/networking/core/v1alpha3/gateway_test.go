@@ -536,6 +536,33 @@ func TestBuildGatewayListenerTlsContext(t *testing.T) {
 	}
 }
 
+func TestBuildGatewayListenerTLSContextMultipleCredentials(t *testing.T) {
+	server := &networking.Server{
+		Hosts: []string{"httpbin.example.com"},
+		Tls: &networking.ServerTLSSettings{
+			Mode:           networking.ServerTLSSettings_SIMPLE,
+			CredentialName: "httpbin-rsa",
+		},
+	}
+	proxy := &pilot_model.Proxy{
+		Metadata: &pilot_model.NodeMetadata{},
+		MergedGateway: &pilot_model.MergedGateway{
+			TLSServerInfo: map[*networking.Server]*pilot_model.TLSServerInfo{
+				server: {CredentialNames: []string{"httpbin-rsa", "httpbin-ecdsa"}},
+			},
+		},
+	}
+	ret := buildGatewayListenerTLSContext(server, proxy, istionetworking.TransportProtocolTCP)
+	var got []string
+	for _, sds := range ret.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs() {
+		got = append(got, sds.Name)
+	}
+	want := []string{"kubernetes://httpbin-rsa", "kubernetes://httpbin-ecdsa"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("got diff: %v", diff)
+	}
+}
+
 func TestCreateGatewayHTTPFilterChainOpts(t *testing.T) {
 	var stripPortMode *hcm.HttpConnectionManager_StripAnyHostPort
 	testCases := []struct {
@@ -514,7 +514,7 @@ func buildInboundCatchAllFilterChains(configgen *ConfigGeneratorImpl,
 
 	var filters []*listener.Filter
 	filters = append(filters, buildMetadataExchangeNetworkFilters(istionetworking.ListenerClassSidecarInbound)...)
-	filters = append(filters, buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarInbound)...)
+	filters = append(filters, buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarInbound, 0)...)
 	filters = append(filters, &listener.Filter{
 		Name: wellknown.TCPProxy,
 		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(&tcp.TcpProxy{
@@ -557,6 +557,7 @@ func buildInboundCatchAllFilterChains(configgen *ConfigGeneratorImpl,
 				Protocol: protocol.HTTP,
 			},
 			protocol: istionetworking.ListenerProtocolAuto,
+			class:    istionetworking.ListenerClassSidecarInbound,
 		}
 		// Call plugins to get mtls policies.
 		fcOpts := configgen.buildInboundFilterchains(in, listenerOpts, matchingIP, clusterName, true)
@@ -686,8 +687,8 @@ func buildOutboundCatchAllNetworkFiltersOnly(push *model.PushContext, node *mode
 		StatPrefix:       egressCluster,
 		ClusterSpecifier: &tcp.TcpProxy_Cluster{Cluster: egressCluster},
 	}
-	filterStack := buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarOutbound)
-	accessLogBuilder.setTCPAccessLog(push.Mesh, tcpProxy)
+	filterStack := buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarOutbound, 0)
+	accessLogBuilder.setTCPAccessLog(push.Mesh, node, tcpProxy)
 	filterStack = append(filterStack, &listener.Filter{
 		Name:       wellknown.TCPProxy,
 		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(tcpProxy)},
@@ -721,7 +722,7 @@ func blackholeFilterChain(push *model.PushContext, node *model.Proxy) *listener.
 			DestinationPort: &wrappers.UInt32Value{Value: uint32(push.Mesh.ProxyListenPort)},
 		},
 		Filters: append(
-			buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarOutbound),
+			buildMetricsNetworkFilters(push, node, istionetworking.ListenerClassSidecarOutbound, 0),
 			blackholeFilters...,
 		),
 	}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	opb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -34,9 +36,11 @@ import (
 	"istio.io/istio/pilot/pkg/extensionproviders"
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
 	authz_model "istio.io/istio/pilot/pkg/security/authz/model"
 	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
 	"istio.io/istio/pkg/bootstrap/platform"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/pkg/log"
 )
 
@@ -49,6 +53,11 @@ func configureTracing(opts buildListenerOpts, hcm *hpb.HttpConnectionManager) *x
 }
 
 func configureTracingFromSpec(tracing *model.TracingConfig, opts buildListenerOpts, hcm *hpb.HttpConnectionManager) *xdsfilters.RouterFilterContext {
+	if opts.proxy.TracingDisabledByAnnotation() {
+		// Escape hatch for the workload, which overrides both Telemetry and mesh config
+		return nil
+	}
+
 	meshCfg := opts.push.Mesh
 	proxyCfg := opts.proxy.Metadata.ProxyConfigOrDefault(opts.push.Mesh.DefaultConfig)
 
@@ -60,15 +69,17 @@ func configureTracingFromSpec(tracing *model.TracingConfig, opts buildListenerOp
 		}
 		// use the prior configuration bits of sampling and custom tags
 		hcm.Tracing = &hpb.HttpConnectionManager_Tracing{}
-		configureSampling(hcm.Tracing, 0.0, proxyCfg)
-		configureCustomTags(hcm.Tracing, map[string]*telemetrypb.Tracing_CustomTag{}, proxyCfg, opts.proxy.Metadata)
+		configureSampling(hcm.Tracing, 0.0, nil, nil, proxyCfg)
+		configureCustomTags(hcm.Tracing, map[string]*telemetrypb.Tracing_CustomTag{}, nil, proxyCfg, opts.proxy.Metadata,
+			features.EnableUpstreamTracingTags)
 		if proxyCfg.GetTracing().GetMaxPathTagLength() != 0 {
 			hcm.Tracing.MaxPathTagLength = wrapperspb.UInt32(proxyCfg.GetTracing().MaxPathTagLength)
 		}
 		return nil
 	}
 
-	if tracing.Disabled {
+	disabled, sampling := tracing.ForClass(opts.class)
+	if disabled {
 		return nil
 	}
 
@@ -89,8 +100,10 @@ func configureTracingFromSpec(tracing *model.TracingConfig, opts buildListenerOp
 
 	// gracefully fallback to MeshConfig configuration. It will act as an implicit
 	// parent configuration during transition period.
-	configureSampling(hcm.Tracing, tracing.RandomSamplingPercentage, proxyCfg)
-	configureCustomTags(hcm.Tracing, tracing.CustomTags, proxyCfg, opts.proxy.Metadata)
+	configureSampling(hcm.Tracing, sampling, tracing.ClientSamplingPercentage,
+		tracing.OverallSamplingPercentage, proxyCfg)
+	configureCustomTags(hcm.Tracing, tracing.CustomTags, tracing.LabelTags, proxyCfg, opts.proxy.Metadata, tracing.UpstreamTags)
+	truncateCustomTags(hcm.Tracing.CustomTags, tracing.TagMaxLengths)
 
 	// if there is configured max tag length somewhere, fallback to it.
 	if hcm.GetTracing().GetMaxPathTagLength() == nil && proxyCfg.GetTracing().GetMaxPathTagLength() != 0 {
@@ -110,11 +123,14 @@ func configureFromProviderConfig(pushCtx *model.PushContext, meta *model.NodeMet
 
 	switch provider := providerCfg.Provider.(type) {
 	case *meshconfig.MeshConfig_ExtensionProvider_Zipkin:
-		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, provider.Zipkin.Service, provider.Zipkin.Port, provider.Zipkin.MaxTagLength, zipkinConfigGen)
+		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, providerService(provider.Zipkin.Service, meta), provider.Zipkin.Port,
+			provider.Zipkin.MaxTagLength, zipkinConfigGen)
 	case *meshconfig.MeshConfig_ExtensionProvider_Datadog:
-		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, provider.Datadog.Service, provider.Datadog.Port, provider.Datadog.MaxTagLength, datadogConfigGen)
+		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, providerService(provider.Datadog.Service, meta), provider.Datadog.Port,
+			provider.Datadog.MaxTagLength, datadogConfigGen)
 	case *meshconfig.MeshConfig_ExtensionProvider_Lightstep:
-		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, provider.Lightstep.Service, provider.Lightstep.Port, provider.Lightstep.MaxTagLength,
+		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, providerService(provider.Lightstep.Service, meta), provider.Lightstep.Port,
+			provider.Lightstep.MaxTagLength,
 			func(clusterName string) (*anypb.Any, error) {
 				lc := &tracingcfg.LightstepConfig{
 					CollectorCluster: clusterName,
@@ -126,7 +142,7 @@ func configureFromProviderConfig(pushCtx *model.PushContext, meta *model.NodeMet
 	case *meshconfig.MeshConfig_ExtensionProvider_Opencensus:
 		tracing, err = buildHCMTracingOpenCensus(providerCfg.Name, provider.Opencensus.MaxTagLength, func() (*anypb.Any, error) {
 			oc := &tracingcfg.OpenCensusConfig{
-				OcagentAddress:         fmt.Sprintf("%s:%d", provider.Opencensus.Service, provider.Opencensus.Port),
+				OcagentAddress:         fmt.Sprintf("%s:%d", providerService(provider.Opencensus.Service, meta), provider.Opencensus.Port),
 				OcagentExporterEnabled: true,
 				IncomingTraceContext:   convert(provider.Opencensus.Context),
 				OutgoingTraceContext:   convert(provider.Opencensus.Context),
@@ -136,7 +152,7 @@ func configureFromProviderConfig(pushCtx *model.PushContext, meta *model.NodeMet
 		})
 
 	case *meshconfig.MeshConfig_ExtensionProvider_Skywalking:
-		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, provider.Skywalking.Service,
+		tracing, err = buildHCMTracing(pushCtx, providerCfg.Name, providerService(provider.Skywalking.Service, meta),
 			provider.Skywalking.Port, 0, func(clusterName string) (*anypb.Any, error) {
 				s := &tracingcfg.SkyWalkingConfig{
 					GrpcService: &envoy_config_core_v3.GrpcService{
@@ -232,6 +248,13 @@ func configureFromProviderConfig(pushCtx *model.PushContext, meta *model.NodeMet
 	return tracing, rfCtx, err
 }
 
+// providerService returns the service of a tracing provider for a proxy. Multi-cluster meshes often run a collector
+// per cluster, while the providers are shared by all clusters, so the cluster ID placeholder is replaced with the
+// cluster of the proxy.
+func providerService(svc string, meta *model.NodeMetadata) string {
+	return strings.ReplaceAll(svc, constants.TracingProviderClusterIDPlaceholder, meta.ClusterID.String())
+}
+
 type typedConfigGenFromClusterFn func(clusterName string) (*anypb.Any, error)
 
 func zipkinConfigGen(cluster string) (*anypb.Any, error) {
@@ -360,69 +383,78 @@ func buildOptionalPolicyTags() []*tracing.CustomTag {
 	}
 }
 
-func buildServiceTags(metadata *model.NodeMetadata) []*tracing.CustomTag {
-	var revision, service string
-	if metadata.Labels != nil {
-		revision = metadata.Labels["service.istio.io/canonical-revision"]
-		service = metadata.Labels["service.istio.io/canonical-name"]
-	}
-	if revision == "" {
-		revision = "latest"
-	}
-	// TODO: This should have been properly handled with the injector.
-	if service == "" {
-		service = "unknown"
-	}
-	meshID := metadata.MeshID
-	if meshID == "" {
-		meshID = "unknown"
-	}
-	namespace := metadata.Namespace
-	if namespace == "" {
-		namespace = "default"
-	}
-	return []*tracing.CustomTag{
-		{
-			Tag: "istio.canonical_revision",
-			Type: &tracing.CustomTag_Literal_{
-				Literal: &tracing.CustomTag_Literal{
-					Value: revision,
+func upstreamMetadataTag(name string, kind *envoy_type_metadata_v3.MetadataKind, key string) *tracing.CustomTag {
+	// Like the dry-run tags, these will not be populated when the metadata is not present.
+	return &tracing.CustomTag{
+		Tag: name,
+		Type: &tracing.CustomTag_Metadata_{
+			Metadata: &tracing.CustomTag_Metadata{
+				Kind: kind,
+				MetadataKey: &envoy_type_metadata_v3.MetadataKey{
+					Key: util.IstioMetadataKey,
+					Path: []*envoy_type_metadata_v3.MetadataKey_PathSegment{
+						{
+							Segment: &envoy_type_metadata_v3.MetadataKey_PathSegment_Key{
+								Key: key,
+							},
+						},
+					},
 				},
 			},
 		},
-		{
-			Tag: "istio.canonical_service",
-			Type: &tracing.CustomTag_Literal_{
-				Literal: &tracing.CustomTag_Literal{
-					Value: service,
-				},
+	}
+}
+
+// buildUpstreamTags returns tags identifying the upstream of a request: the subset of the selected cluster, from
+// the cluster metadata, and the compressed peer workload metadata (which includes the canonical service), from the
+// selected host.
+func buildUpstreamTags() []*tracing.CustomTag {
+	return []*tracing.CustomTag{
+		upstreamMetadataTag("istio.upstream_cluster.subset", &envoy_type_metadata_v3.MetadataKind{
+			Kind: &envoy_type_metadata_v3.MetadataKind_Cluster_{
+				Cluster: &envoy_type_metadata_v3.MetadataKind_Cluster{},
 			},
-		},
-		{
-			Tag: "istio.mesh_id",
-			Type: &tracing.CustomTag_Literal_{
-				Literal: &tracing.CustomTag_Literal{
-					Value: meshID,
-				},
+		}, "subset"),
+		upstreamMetadataTag("istio.upstream_peer.workload", &envoy_type_metadata_v3.MetadataKind{
+			Kind: &envoy_type_metadata_v3.MetadataKind_Host_{
+				Host: &envoy_type_metadata_v3.MetadataKind_Host{},
 			},
-		},
-		{
-			Tag: "istio.namespace",
+		}, "workload"),
+	}
+}
+
+// buildServiceTags returns the istio.* tags identifying the proxy, from its canonical identity.
+func buildServiceTags(metadata *model.NodeMetadata) []*tracing.CustomTag {
+	attributes := model.ProxyCanonicalIdentity(metadata).Attributes()
+	tags := make([]*tracing.CustomTag, 0, len(attributes))
+	for _, a := range attributes {
+		tags = append(tags, &tracing.CustomTag{
+			Tag: "istio." + a.Name,
 			Type: &tracing.CustomTag_Literal_{
 				Literal: &tracing.CustomTag_Literal{
-					Value: namespace,
+					Value: a.Value,
 				},
 			},
-		},
+		})
 	}
+	return tags
 }
 
-func configureSampling(hcmTracing *hpb.HttpConnectionManager_Tracing, providerPercentage float64, proxyCfg *meshconfig.ProxyConfig) {
+// configureSampling sets the sampling percentages on the tracing config. Client and overall sampling fall back to
+// the mesh-wide defaults if unset.
+func configureSampling(hcmTracing *hpb.HttpConnectionManager_Tracing, providerPercentage float64,
+	clientPercentage, overallPercentage *float64, proxyCfg *meshconfig.ProxyConfig) {
 	hcmTracing.ClientSampling = &xdstype.Percent{
-		Value: 100.0,
+		Value: features.TraceClientSampling,
+	}
+	if clientPercentage != nil {
+		hcmTracing.ClientSampling.Value = *clientPercentage
 	}
 	hcmTracing.OverallSampling = &xdstype.Percent{
-		Value: 100.0,
+		Value: features.TraceOverallSampling,
+	}
+	if overallPercentage != nil {
+		hcmTracing.OverallSampling.Value = *overallPercentage
 	}
 	if providerPercentage != 0.0 {
 		// note: this does prevent a situation in which someone may want to set
@@ -453,7 +485,8 @@ func fallbackSamplingValue(config *meshconfig.ProxyConfig) float64 {
 }
 
 func configureCustomTags(hcmTracing *hpb.HttpConnectionManager_Tracing,
-	providerTags map[string]*telemetrypb.Tracing_CustomTag, proxyCfg *meshconfig.ProxyConfig, metadata *model.NodeMetadata) {
+	providerTags map[string]*telemetrypb.Tracing_CustomTag, labelTags map[string]model.TracingLabelTag,
+	proxyCfg *meshconfig.ProxyConfig, metadata *model.NodeMetadata, upstreamTags bool) {
 	var tags []*tracing.CustomTag
 
 	// TODO(dougreid): remove support for this feature. We don't want this to be
@@ -465,12 +498,27 @@ func configureCustomTags(hcmTracing *hpb.HttpConnectionManager_Tracing,
 		tags = append(tags, buildServiceTags(metadata)...)
 	}
 
+	if upstreamTags {
+		tags = append(tags, buildUpstreamTags()...)
+	}
+
 	if len(providerTags) == 0 {
 		tags = append(tags, buildCustomTagsFromProxyConfig(proxyCfg.GetTracing().GetCustomTags())...)
 	} else {
 		tags = append(tags, buildCustomTagsFromProvider(providerTags)...)
 	}
 
+	if len(labelTags) > 0 {
+		// Label tags take precedence over other tags with the same name
+		filtered := tags[:0]
+		for _, tag := range tags {
+			if _, f := labelTags[tag.Tag]; !f {
+				filtered = append(filtered, tag)
+			}
+		}
+		tags = append(filtered, buildCustomTagsFromLabels(labelTags, metadata)...)
+	}
+
 	// looping over customTags, a map, results in the returned value
 	// being non-deterministic when multiple tags were defined; sort by the tag name
 	// to rectify this
@@ -481,6 +529,61 @@ func configureCustomTags(hcmTracing *hpb.HttpConnectionManager_Tracing,
 	hcmTracing.CustomTags = tags
 }
 
+// truncateCustomTags truncates the values of the tags with a max length. Envoy cannot truncate tag values, so only
+// literal tags, whose value is known here, are truncated.
+func truncateCustomTags(tags []*tracing.CustomTag, maxLengths map[string]uint32) {
+	if len(maxLengths) == 0 {
+		return
+	}
+	for _, tag := range tags {
+		maxLength := maxLengths[tag.Tag]
+		if maxLength == 0 {
+			continue
+		}
+		literal := tag.GetLiteral()
+		if literal == nil {
+			log.Debugf("cannot truncate tracing tag %q: only literal tags can be truncated", tag.Tag)
+			continue
+		}
+		literal.Value = truncateString(literal.Value, int(maxLength))
+	}
+}
+
+// truncateString truncates s to at most maxLength bytes, without splitting a UTF-8 character.
+func truncateString(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	for maxLength > 0 && !utf8.RuneStart(s[maxLength]) {
+		maxLength--
+	}
+	return s[:maxLength]
+}
+
+// buildCustomTagsFromLabels resolves the label tags against the labels of the proxy. As labels are only known per
+// proxy, they are sent as literals.
+func buildCustomTagsFromLabels(labelTags map[string]model.TracingLabelTag, metadata *model.NodeMetadata) []*tracing.CustomTag {
+	var tags []*tracing.CustomTag
+	for tagName, labelTag := range labelTags {
+		value := metadata.Labels[labelTag.Label]
+		if value == "" {
+			value = labelTag.DefaultValue
+		}
+		if value == "" {
+			continue
+		}
+		tags = append(tags, &tracing.CustomTag{
+			Tag: tagName,
+			Type: &tracing.CustomTag_Literal_{
+				Literal: &tracing.CustomTag_Literal{
+					Value: value,
+				},
+			},
+		})
+	}
+	return tags
+}
+
 func buildCustomTagsFromProvider(providerTags map[string]*telemetrypb.Tracing_CustomTag) []*tracing.CustomTag {
 	var tags []*tracing.CustomTag
 	for tagName, tagInfo := range providerTags {
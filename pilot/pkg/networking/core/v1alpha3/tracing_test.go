@@ -15,11 +15,13 @@
 package v1alpha3
 
 import (
+	"fmt"
 	"testing"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	tracingcfg "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
 	hpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_type_metadata_v3 "github.com/envoyproxy/go-control-plane/envoy/type/metadata/v3"
 	tracing "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
 	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/google/go-cmp/cmp"
@@ -31,7 +33,10 @@ import (
 	tpb "istio.io/api/telemetry/v1alpha1"
 	"istio.io/istio/pilot/pkg/extensionproviders"
 	"istio.io/istio/pilot/pkg/model"
+	istionetworking "istio.io/istio/pilot/pkg/networking"
 	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/config/constants"
 )
 
 func TestConfigureTracing(t *testing.T) {
@@ -107,6 +112,109 @@ func TestConfigureTracing(t *testing.T) {
 			want:      fakeTracingConfig(fakeSkywalkingProvider(clusterName, providerName), 99.999, 0, append(defaultTracingTags(), fakeEnvTag)),
 			wantRfCtx: &xdsfilters.RouterFilterContext{StartChildSpan: true},
 		},
+		{
+			name:      "upstream tags enabled",
+			inSpec:    fakeTracingSpecUpstreamTags(fakeZipkin(), true),
+			opts:      fakeOptsOnlyZipkinTelemetryAPI(),
+			want:      fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256, append(append(defaultTracingTags(), upstreamTracingTags()...), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:      "upstream tags disabled",
+			inSpec:    fakeTracingSpecUpstreamTags(fakeZipkin(), false),
+			opts:      fakeOptsOnlyZipkinTelemetryAPI(),
+			want:      fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256, append(defaultTracingTags(), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:   "client and overall sampling",
+			inSpec: fakeTracingSpecSampling(fakeZipkin(), 50.0, 5.0),
+			opts:   fakeOptsOnlyZipkinTelemetryAPI(),
+			want: fakeTracingConfigSampling(fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256,
+				append(defaultTracingTags(), fakeEnvTag)), 50.0, 5.0),
+			wantRfCtx: nil,
+		},
+		{
+			name:   "overall sampling disables tracing",
+			inSpec: fakeTracingSpecSampling(nil, 100.0, 0.0),
+			opts:   fakeOptsOnlyZipkinTelemetryAPI(),
+			want: fakeTracingConfigSampling(fakeTracingConfigNoProvider(99.999, 0, append(defaultTracingTags(), fakeEnvTag)),
+				100.0, 0.0),
+			wantRfCtx: nil,
+		},
+		{
+			name:      "inbound disabled (inbound listener)",
+			inSpec:    fakeTracingSpecInboundDisabled(fakeZipkin()),
+			opts:      withListenerClass(fakeOptsOnlyZipkinTelemetryAPI(), istionetworking.ListenerClassSidecarInbound),
+			want:      nil,
+			wantRfCtx: nil,
+		},
+		{
+			name:      "inbound disabled (outbound listener)",
+			inSpec:    fakeTracingSpecInboundDisabled(fakeZipkin()),
+			opts:      withListenerClass(fakeOptsOnlyZipkinTelemetryAPI(), istionetworking.ListenerClassSidecarOutbound),
+			want:      fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256, append(defaultTracingTags(), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:      "outbound sampling (gateway listener)",
+			inSpec:    fakeTracingSpecOutboundSampling(fakeZipkin(), 10.0),
+			opts:      withListenerClass(fakeOptsOnlyZipkinTelemetryAPI(), istionetworking.ListenerClassGateway),
+			want:      fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 10.0, 256, append(defaultTracingTags(), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:      "outbound sampling (inbound listener)",
+			inSpec:    fakeTracingSpecOutboundSampling(fakeZipkin(), 10.0),
+			opts:      withListenerClass(fakeOptsOnlyZipkinTelemetryAPI(), istionetworking.ListenerClassSidecarInbound),
+			want:      fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256, append(defaultTracingTags(), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:   "label tags (proxy with labels)",
+			inSpec: fakeTracingSpecLabelTags(fakeZipkin()),
+			opts:   withProxyLabels(fakeOptsOnlyZipkinTelemetryAPI(), map[string]string{"team": "payments", "owner": "alice"}),
+			want: fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256,
+				append(defaultTracingTags(), fakeLiteralTag("owner", "alice"), fakeLiteralTag("team", "payments"), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:   "label tags (proxy without labels)",
+			inSpec: fakeTracingSpecLabelTags(fakeZipkin()),
+			opts:   fakeOptsOnlyZipkinTelemetryAPI(),
+			want: fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256,
+				append(defaultTracingTags(), fakeLiteralTag("team", "unknown"), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			// Only literal tags can be truncated; the environment tag is left as is.
+			name:   "tag max lengths",
+			inSpec: withTagMaxLengths(fakeTracingSpecLabelTags(fakeZipkin()), map[string]uint32{"owner": 3, "team": 0, "test": 1}),
+			opts:   withProxyLabels(fakeOptsOnlyZipkinTelemetryAPI(), map[string]string{"team": "payments", "owner": "alice"}),
+			want: fakeTracingConfig(fakeZipkinProvider(clusterName, providerName), 99.999, 256,
+				append(defaultTracingTags(), fakeLiteralTag("owner", "ali"), fakeLiteralTag("team", "payments"), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
+		{
+			name:      "disabled by annotation (no telemetry api)",
+			opts:      withProxyAnnotations(fakeOptsNoTelemetryAPI(), map[string]string{constants.TelemetryTracing: "disabled"}),
+			want:      nil,
+			wantRfCtx: nil,
+		},
+		{
+			name:      "disabled by annotation (telemetry api)",
+			inSpec:    fakeTracingSpec(fakeZipkin(), 99.999, false),
+			opts:      withProxyAnnotations(fakeOptsMeshAndTelemetryAPI(true), map[string]string{constants.TelemetryTracing: "disabled"}),
+			want:      nil,
+			wantRfCtx: nil,
+		},
+		{
+			name:      "annotation set to another value",
+			inSpec:    fakeTracingSpecNoProvider(99.999, false),
+			opts:      withProxyAnnotations(fakeOptsOnlyZipkinTelemetryAPI(), map[string]string{constants.TelemetryTracing: "enabled"}),
+			want:      fakeTracingConfigNoProvider(99.999, 0, append(defaultTracingTags(), fakeEnvTag)),
+			wantRfCtx: nil,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -331,6 +439,113 @@ func fakeTracingSpec(provider *meshconfig.MeshConfig_ExtensionProvider, sampling
 	return t
 }
 
+func fakeTracingSpecUpstreamTags(provider *meshconfig.MeshConfig_ExtensionProvider, upstreamTags bool) *model.TracingConfig {
+	t := fakeTracingSpec(provider, 99.999, false)
+	t.UpstreamTags = upstreamTags
+	return t
+}
+
+func fakeTracingSpecSampling(provider *meshconfig.MeshConfig_ExtensionProvider, client, overall float64) *model.TracingConfig {
+	t := fakeTracingSpec(provider, 99.999, false)
+	t.ClientSamplingPercentage = &client
+	t.OverallSamplingPercentage = &overall
+	return t
+}
+
+func fakeTracingSpecInboundDisabled(provider *meshconfig.MeshConfig_ExtensionProvider) *model.TracingConfig {
+	t := fakeTracingSpec(provider, 99.999, false)
+	disabled := true
+	t.Inbound.Disabled = &disabled
+	return t
+}
+
+func fakeTracingSpecOutboundSampling(provider *meshconfig.MeshConfig_ExtensionProvider, sampling float64) *model.TracingConfig {
+	t := fakeTracingSpec(provider, 99.999, false)
+	t.Outbound.RandomSamplingPercentage = &sampling
+	return t
+}
+
+func withListenerClass(opts buildListenerOpts, class istionetworking.ListenerClass) buildListenerOpts {
+	opts.class = class
+	return opts
+}
+
+func fakeTracingSpecLabelTags(provider *meshconfig.MeshConfig_ExtensionProvider) *model.TracingConfig {
+	t := fakeTracingSpec(provider, 99.999, false)
+	t.LabelTags = map[string]model.TracingLabelTag{
+		"team":  {Label: "team", DefaultValue: "unknown"},
+		"owner": {Label: "owner"},
+	}
+	return t
+}
+
+func withTagMaxLengths(t *model.TracingConfig, maxLengths map[string]uint32) *model.TracingConfig {
+	t.TagMaxLengths = maxLengths
+	return t
+}
+
+func withProxyLabels(opts buildListenerOpts, labels map[string]string) buildListenerOpts {
+	opts.proxy.Metadata.Labels = labels
+	return opts
+}
+
+func withProxyAnnotations(opts buildListenerOpts, annotations map[string]string) buildListenerOpts {
+	opts.proxy.Metadata.Annotations = annotations
+	return opts
+}
+
+func fakeLiteralTag(tag, value string) *tracing.CustomTag {
+	return &tracing.CustomTag{
+		Tag: tag,
+		Type: &tracing.CustomTag_Literal_{
+			Literal: &tracing.CustomTag_Literal{
+				Value: value,
+			},
+		},
+	}
+}
+
+func upstreamTracingTags() []*tracing.CustomTag {
+	return []*tracing.CustomTag{
+		{
+			Tag: "istio.upstream_cluster.subset",
+			Type: &tracing.CustomTag_Metadata_{
+				Metadata: &tracing.CustomTag_Metadata{
+					Kind: &envoy_type_metadata_v3.MetadataKind{
+						Kind: &envoy_type_metadata_v3.MetadataKind_Cluster_{
+							Cluster: &envoy_type_metadata_v3.MetadataKind_Cluster{},
+						},
+					},
+					MetadataKey: &envoy_type_metadata_v3.MetadataKey{
+						Key: "istio",
+						Path: []*envoy_type_metadata_v3.MetadataKey_PathSegment{
+							{Segment: &envoy_type_metadata_v3.MetadataKey_PathSegment_Key{Key: "subset"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			Tag: "istio.upstream_peer.workload",
+			Type: &tracing.CustomTag_Metadata_{
+				Metadata: &tracing.CustomTag_Metadata{
+					Kind: &envoy_type_metadata_v3.MetadataKind{
+						Kind: &envoy_type_metadata_v3.MetadataKind_Host_{
+							Host: &envoy_type_metadata_v3.MetadataKind_Host{},
+						},
+					},
+					MetadataKey: &envoy_type_metadata_v3.MetadataKey{
+						Key: "istio",
+						Path: []*envoy_type_metadata_v3.MetadataKey_PathSegment{
+							{Segment: &envoy_type_metadata_v3.MetadataKey_PathSegment_Key{Key: "workload"}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func fakeTracingConfigNoProvider(randomSampling float64, maxLen uint32, tags []*tracing.CustomTag) *hpb.HttpConnectionManager_Tracing {
 	return fakeTracingConfig(nil, randomSampling, maxLen, tags)
 }
@@ -357,6 +572,12 @@ func fakeTracingConfig(provider *tracingcfg.Tracing_Http, randomSampling float64
 	return t
 }
 
+func fakeTracingConfigSampling(t *hpb.HttpConnectionManager_Tracing, client, overall float64) *hpb.HttpConnectionManager_Tracing {
+	t.ClientSampling = &xdstype.Percent{Value: client}
+	t.OverallSampling = &xdstype.Percent{Value: overall}
+	return t
+}
+
 var fakeEnvTag = &tracing.CustomTag{
 	Tag: "test",
 	Type: &tracing.CustomTag_Environment_{
@@ -397,3 +618,49 @@ func fakeSkywalkingProvider(expectClusterName, expectProviderName string) *traci
 		ConfigType: &tracingcfg.Tracing_Http_TypedConfig{TypedConfig: fakeSkywalkingAny},
 	}
 }
+
+func TestConfigureTracingProviderCluster(t *testing.T) {
+	clusterLookupFn = func(push *model.PushContext, service string, port int) (hostname string, cluster string, err error) {
+		return service, fmt.Sprintf("outbound|%d||%s", port, service), nil
+	}
+	defer func() {
+		clusterLookupFn = extensionproviders.LookupCluster
+	}()
+
+	provider := fakeZipkin()
+	provider.GetZipkin().Service = "zipkin.$(CLUSTER_ID).example.com"
+	for _, clusterID := range []cluster.ID{"cluster-1", "cluster-2"} {
+		t.Run(clusterID.String(), func(t *testing.T) {
+			opts := fakeOptsOnlyZipkinTelemetryAPI()
+			opts.proxy.Metadata.ClusterID = clusterID
+			hcm := &hpb.HttpConnectionManager{}
+			configureTracingFromSpec(fakeTracingSpec(provider, 99.999, false), opts, hcm)
+
+			want := fakeZipkinProvider(fmt.Sprintf("outbound|9411||zipkin.%s.example.com", clusterID), "foo")
+			if diff := cmp.Diff(want, hcm.Tracing.Provider, protocmp.Transform()); diff != "" {
+				t.Fatalf("unexpected provider (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	cases := []struct {
+		in        string
+		maxLength int
+		want      string
+	}{
+		{"", 3, ""},
+		{"abc", 3, "abc"},
+		{"abcdef", 3, "abc"},
+		{"abcdef", 0, ""},
+		// "é" is two bytes, and is not split
+		{"aébc", 2, "a"},
+		{"aébc", 3, "aé"},
+	}
+	for _, tt := range cases {
+		if got := truncateString(tt.in, tt.maxLength); got != tt.want {
+			t.Errorf("truncateString(%q, %d) got %q want %q", tt.in, tt.maxLength, got, tt.want)
+		}
+	}
+}
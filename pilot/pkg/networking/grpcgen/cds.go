@@ -235,7 +235,13 @@ func (b *clusterBuilder) applyTLS(c *cluster.Cluster, policy *networking.Traffic
 	case networking.ClientTLSSettings_MUTUAL:
 		// TODO support this
 	case networking.ClientTLSSettings_ISTIO_MUTUAL:
-		tlsCtx := buildUpstreamTLSContext(b.push.ServiceAccounts[b.hostname][b.portNum])
+		// As for sidecars, verify the server identity against the subject alt names of the DestinationRule if set,
+		// and otherwise against the service accounts of the service.
+		sans := policy.GetTls().GetSubjectAltNames()
+		if len(sans) == 0 {
+			sans = b.push.ServiceAccounts[b.hostname][b.portNum]
+		}
+		tlsCtx := buildUpstreamTLSContext(sans)
 		c.TransportSocket = &core.TransportSocket{
 			Name:       transportSocketName,
 			ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: util.MessageToAny(tlsCtx)},
@@ -27,6 +27,8 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	//  To install the xds resolvers and balancers.
 	_ "google.golang.org/grpc/xds"
@@ -48,6 +50,8 @@ const grpcEchoPort = 14058
 type echoCfg struct {
 	version   string
 	namespace string
+	weight    uint32
+	locality  string
 }
 
 type configGenTest struct {
@@ -141,8 +145,10 @@ func makeWE(s echoCfg, host string, port int) config.Config {
 			},
 		},
 		Spec: &networking.WorkloadEntry{
-			Address: host,
-			Ports:   map[string]uint32{"grpc": uint32(port)},
+			Address:  host,
+			Ports:    map[string]uint32{"grpc": uint32(port)},
+			Weight:   s.weight,
+			Locality: s.locality,
 		},
 	}
 }
@@ -234,6 +240,127 @@ spec:
 	}, retry.Timeout(5*time.Second), retry.Delay(0))
 }
 
+func TestWorkloadEntryWeights(t *testing.T) {
+	// gRPC round robins across endpoints within a locality, so each WorkloadEntry is placed in its own locality.
+	tt := newConfigGenTest(t, xds.FakeOptions{
+		KubernetesObjectString: `
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app
+  name: echo-app
+  namespace: default
+spec:
+  clusterIP: 1.2.3.4
+  selector:
+    app: echo
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+`,
+	}, echoCfg{version: "v1", weight: 1, locality: "region/zone1"}, echoCfg{version: "v2", weight: 4, locality: "region/zone2"})
+
+	retry.UntilSuccessOrFail(tt.T, func() error {
+		cw := tt.dialEcho("xds:///echo-app.default.svc.cluster.local:7070")
+		distribution := map[string]int{}
+		for i := 0; i < 100; i++ {
+			res, err := cw.Echo(context.Background(), &proto.EchoRequest{Message: "needle"})
+			if err != nil {
+				return err
+			}
+			distribution[res.Version]++
+		}
+
+		if err := expectAlmost(distribution["v1"], 20); err != nil {
+			return err
+		}
+		if err := expectAlmost(distribution["v2"], 80); err != nil {
+			return err
+		}
+		return nil
+	}, retry.Timeout(5*time.Second), retry.Delay(0))
+}
+
+func TestTrafficShiftingAcrossServices(t *testing.T) {
+	tt := newConfigGenTest(t, xds.FakeOptions{
+		KubernetesObjectString: `
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app
+  name: echo-app
+  namespace: default
+spec:
+  clusterIP: 1.2.3.4
+  selector:
+    app: echo
+    version: v1
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+---
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app-v2
+  name: echo-app-v2
+  namespace: default
+spec:
+  clusterIP: 1.2.3.5
+  selector:
+    app: echo
+    version: v2
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+`,
+		ConfigString: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: echo-vs
+  namespace: default
+spec:
+  hosts:
+  - echo-app.default.svc.cluster.local
+  http:
+  - route:
+    - destination:
+        host: echo-app.default.svc.cluster.local
+      weight: 50
+    - destination:
+        host: echo-app-v2.default.svc.cluster.local
+      weight: 50
+`,
+	}, echoCfg{version: "v1"}, echoCfg{version: "v2"})
+
+	retry.UntilSuccessOrFail(tt.T, func() error {
+		cw := tt.dialEcho("xds:///echo-app.default.svc.cluster.local:7070")
+		distribution := map[string]int{}
+		for i := 0; i < 100; i++ {
+			res, err := cw.Echo(context.Background(), &proto.EchoRequest{Message: "needle"})
+			if err != nil {
+				return err
+			}
+			distribution[res.Version]++
+		}
+
+		if err := expectAlmost(distribution["v1"], 50); err != nil {
+			return err
+		}
+		if err := expectAlmost(distribution["v2"], 50); err != nil {
+			return err
+		}
+		return nil
+	}, retry.Timeout(5*time.Second), retry.Delay(0))
+}
+
 func TestMtls(t *testing.T) {
 	// TODO this is eagerly resolved in gRPC making it difficult to force with os.Setenv
 	if !strings.EqualFold(os.Getenv("GRPC_XDS_EXPERIMENTAL_SECURITY_SUPPORT"), "true") {
@@ -293,6 +420,134 @@ spec:
 	}, retry.Timeout(5*time.Second), retry.Delay(0))
 }
 
+func TestMtlsSubjectAltNameMismatch(t *testing.T) {
+	// TODO this is eagerly resolved in gRPC making it difficult to force with os.Setenv
+	if !strings.EqualFold(os.Getenv("GRPC_XDS_EXPERIMENTAL_SECURITY_SUPPORT"), "true") {
+		t.Skip("Must set GRPC_XDS_EXPERIMENTAL_SECURITY_SUPPORT outside the test")
+	}
+	// The server presents the default service account, while the client expects another identity.
+	tt := newConfigGenTest(t, xds.FakeOptions{
+		KubernetesObjectString: `
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app
+  name: echo-app
+  namespace: default
+spec:
+  clusterIP: 1.2.3.4
+  selector:
+    app: echo
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+`,
+		ConfigString: `
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: echo-dr
+  namespace: default
+spec:
+  host: echo-app.default.svc.cluster.local
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+      subjectAltNames:
+      - spiffe://cluster.local/ns/default/sa/other
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: default
+spec:
+  mtls:
+    mode: STRICT
+`,
+	}, echoCfg{version: "v1"})
+
+	cw := tt.dialEcho("xds:///echo-app.default.svc.cluster.local:7070")
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := cw.Echo(ctx, &proto.EchoRequest{Message: "needle"})
+		cancel()
+		if err == nil {
+			t.Fatalf("expected request to a server with an unexpected identity to fail")
+		}
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	// TODO this is eagerly resolved in gRPC making it difficult to force with os.Setenv
+	if !strings.EqualFold(os.Getenv("GRPC_XDS_EXPERIMENTAL_RBAC"), "true") {
+		t.Skip("Must set GRPC_XDS_EXPERIMENTAL_RBAC outside the test")
+	}
+	denyPolicy := func(dryRun bool) string {
+		return fmt.Sprintf(`
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-all
+  namespace: default
+  annotations:
+    istio.io/dry-run: "%t"
+spec:
+  action: DENY
+  rules:
+  - {}
+`, dryRun)
+	}
+	cases := []struct {
+		name    string
+		dryRun  bool
+		allowed bool
+	}{
+		{"dry-run", true, true},
+		{"enforced", false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newConfigGenTest(t, xds.FakeOptions{
+				KubernetesObjectString: `
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app
+  name: echo-app
+  namespace: default
+spec:
+  clusterIP: 1.2.3.4
+  selector:
+    app: echo
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+`,
+				ConfigString: denyPolicy(tc.dryRun),
+			}, echoCfg{version: "v1"})
+
+			retry.UntilSuccessOrFail(tt.T, func() error {
+				cw := tt.dialEcho("xds:///echo-app.default.svc.cluster.local:7070")
+				for i := 0; i < 10; i++ {
+					_, err := cw.Echo(context.Background(), &proto.EchoRequest{Message: "needle"})
+					if tc.allowed && err != nil {
+						return err
+					}
+					if !tc.allowed && status.Code(err) != codes.PermissionDenied {
+						return fmt.Errorf("expected request to be denied, got %v", err)
+					}
+				}
+				return nil
+			}, retry.Timeout(5*time.Second), retry.Delay(0))
+		})
+	}
+}
+
 func TestFault(t *testing.T) {
 	tt := newConfigGenTest(t, xds.FakeOptions{
 		KubernetesObjectString: `
@@ -346,6 +601,61 @@ spec:
 	// TODO test timeouts, aborts
 }
 
+func TestAuthorityRewrite(t *testing.T) {
+	tt := newConfigGenTest(t, xds.FakeOptions{
+		KubernetesObjectString: `
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: echo-app
+  name: echo-app
+  namespace: default
+spec:
+  clusterIP: 1.2.3.4
+  selector:
+    app: echo
+  ports:
+  - name: grpc
+    targetPort: grpc
+    port: 7070
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: logical-host
+  namespace: default
+spec:
+  clusterIP: 1.2.3.5
+  ports:
+  - name: grpc
+    port: 7070
+`,
+		ConfigString: `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: logical-host
+  namespace: default
+spec:
+  hosts:
+  - logical-host.default.svc.cluster.local
+  http:
+  - rewrite:
+      authority: echo-app.default.svc.cluster.local:7070
+    route:
+    - destination:
+        host: echo-app.default.svc.cluster.local
+`,
+	}, echoCfg{version: "v1"})
+
+	retry.UntilSuccessOrFail(tt.T, func() error {
+		cw := tt.dialEcho("xds:///logical-host:7070")
+		_, err := cw.Echo(context.Background(), &proto.EchoRequest{Message: "needle"})
+		return err
+	}, retry.Timeout(5*time.Second), retry.Delay(0))
+}
+
 func expectAlmost(got, want int) error {
 	if math.Abs(float64(want-got)) > 10 {
 		return fmt.Errorf("expected within %d of %d but got %d", 10, want, got)
@@ -18,23 +18,38 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"path"
+	"reflect"
 	"testing"
 	"time"
 
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 
 	// To install the xds resolvers and balancers.
 	grpcxdsresolver "google.golang.org/grpc/xds"
 
+	meshconfig "istio.io/api/mesh/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/istio-agent/grpcxds"
 	"istio.io/istio/pkg/test"
@@ -211,6 +226,511 @@ func TestGRPC(t *testing.T) {
 	})
 }
 
+func TestClusterSubjectAltNames(t *testing.T) {
+	const (
+		defaultCluster = "outbound|7070||echo.default.svc.cluster.local"
+		subsetCluster  = "outbound|7070|v1|echo.default.svc.cluster.local"
+	)
+	serviceEntry := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 1.2.3.4
+    serviceAccount: echo-sa
+    labels:
+      version: v1
+`
+	cases := []struct {
+		name string
+		tls  string
+		want []string
+	}{
+		{
+			name: "service accounts",
+			tls:  "mode: ISTIO_MUTUAL",
+			want: []string{"spiffe://cluster.local/ns/default/sa/echo-sa"},
+		},
+		{
+			name: "destination rule subject alt names",
+			tls: `mode: ISTIO_MUTUAL
+      subjectAltNames:
+      - spiffe://cluster.local/ns/default/sa/other`,
+			want: []string{"spiffe://cluster.local/ns/default/sa/other"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: serviceEntry + fmt.Sprintf(`
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: echo
+  namespace: default
+spec:
+  host: echo.default.svc.cluster.local
+  trafficPolicy:
+    tls:
+      %s
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+`, tt.tls)})
+			ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+			resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+				TypeUrl:       v3.ClusterType,
+				ResourceNames: []string{defaultCluster, subsetCluster},
+			})
+			if len(resp.Resources) != 2 {
+				t.Fatalf("expected 2 clusters, got %d", len(resp.Resources))
+			}
+			for _, r := range resp.Resources {
+				c := &cluster.Cluster{}
+				if err := r.UnmarshalTo(c); err != nil {
+					t.Fatal(err)
+				}
+				tlsCtx := &tls.UpstreamTlsContext{}
+				if err := c.GetTransportSocket().GetTypedConfig().UnmarshalTo(tlsCtx); err != nil {
+					t.Fatalf("%s: expected a TLS transport socket: %v", c.Name, err)
+				}
+				var got []string
+				validation := tlsCtx.GetCommonTlsContext().GetCombinedValidationContext().GetDefaultValidationContext()
+				for _, m := range validation.GetMatchSubjectAltNames() {
+					got = append(got, m.GetExact())
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: got subject alt names %v, want %v", c.Name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInboundListenerTimeouts(t *testing.T) {
+	listenerName := fmt.Sprintf(grpcxds.ServerListenerNameTemplate, "0.0.0.0:7070")
+	serviceEntry := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 1.2.3.4
+`
+	destinationRule := `
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: echo
+  namespace: default
+spec:
+  host: echo.default.svc.cluster.local
+  trafficPolicy:
+    connectionPool:
+      http:
+        idleTimeout: 30s
+`
+	cases := []struct {
+		name              string
+		config            string
+		proxyIdleTimeout  string
+		maxStreamDuration time.Duration
+		wantIdle          time.Duration
+		wantMaxStream     time.Duration
+	}{
+		{name: "unset", config: serviceEntry},
+		{name: "proxy idle timeout", config: serviceEntry, proxyIdleTimeout: "1m", wantIdle: time.Minute},
+		{name: "destination rule idle timeout", config: serviceEntry + destinationRule, proxyIdleTimeout: "1m", wantIdle: 30 * time.Second},
+		{name: "max stream duration", config: serviceEntry, maxStreamDuration: time.Hour, wantMaxStream: time.Hour},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(d time.Duration) { features.GRPCServerMaxStreamDuration = d }(features.GRPCServerMaxStreamDuration)
+			features.GRPCServerMaxStreamDuration = tt.maxStreamDuration
+
+			s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: tt.config})
+			ads := s.ConnectADS().
+				WithID("sidecar~1.2.3.4~echo.default~default.svc.cluster.local").
+				WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default", IdleTimeout: tt.proxyIdleTimeout})
+			resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+				TypeUrl:       v3.ListenerType,
+				ResourceNames: []string{listenerName},
+			})
+			if len(resp.Resources) != 1 {
+				t.Fatalf("expected a listener for %s, got %d listeners", listenerName, len(resp.Resources))
+			}
+			l := &listener.Listener{}
+			if err := resp.Resources[0].UnmarshalTo(l); err != nil {
+				t.Fatal(err)
+			}
+			if len(l.FilterChains) == 0 {
+				t.Fatalf("expected filter chains for %s", listenerName)
+			}
+			for _, fc := range l.FilterChains {
+				h := &hcm.HttpConnectionManager{}
+				if err := fc.Filters[0].GetTypedConfig().UnmarshalTo(h); err != nil {
+					t.Fatal(err)
+				}
+				opts := h.GetCommonHttpProtocolOptions()
+				if tt.wantIdle == 0 && tt.wantMaxStream == 0 {
+					if opts != nil {
+						t.Fatalf("%s: expected no protocol options, got %v", fc.Name, opts)
+					}
+					continue
+				}
+				if got := opts.GetIdleTimeout().AsDuration(); got != tt.wantIdle {
+					t.Errorf("%s: got idle timeout %v, want %v", fc.Name, got, tt.wantIdle)
+				}
+				if got := opts.GetMaxStreamDuration().AsDuration(); got != tt.wantMaxStream {
+					t.Errorf("%s: got max stream duration %v, want %v", fc.Name, got, tt.wantMaxStream)
+				}
+			}
+		})
+	}
+}
+
+func TestInboundListenerSidecarIngressPort(t *testing.T) {
+	configs := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  endpoints:
+  - address: 1.2.3.4
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: Sidecar
+metadata:
+  name: echo
+  namespace: default
+spec:
+  ingress:
+  - port:
+      number: 7070
+      name: grpc
+      protocol: GRPC
+    defaultEndpoint: 127.0.0.1:8080
+`
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: configs})
+	ads := s.ConnectADS().
+		WithID("sidecar~1.2.3.4~echo.default~default.svc.cluster.local").
+		WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+	// Connections to the service port are forwarded to the port the server binds, which it requests a listener for
+	for _, port := range []uint32{7070, 8080} {
+		listenerName := fmt.Sprintf(grpcxds.ServerListenerNameTemplate, fmt.Sprintf("0.0.0.0:%d", port))
+		resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+			TypeUrl:       v3.ListenerType,
+			ResourceNames: []string{listenerName},
+		})
+		if len(resp.Resources) != 1 {
+			t.Fatalf("expected a listener for %s, got %d listeners", listenerName, len(resp.Resources))
+		}
+		l := &listener.Listener{}
+		if err := resp.Resources[0].UnmarshalTo(l); err != nil {
+			t.Fatal(err)
+		}
+		if got := l.GetAddress().GetSocketAddress().GetPortValue(); got != port {
+			t.Fatalf("expected listener %s to listen on port %d, got %d", listenerName, port, got)
+		}
+		if len(l.FilterChains) == 0 {
+			t.Fatalf("expected filter chains for %s", listenerName)
+		}
+	}
+}
+
+func TestWorkloadEntryWeights(t *testing.T) {
+	const echoCluster = "outbound|7070||echo.default.svc.cluster.local"
+	configs := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  workloadSelector:
+    labels:
+      app: echo
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: WorkloadEntry
+metadata:
+  name: echo-v1
+  namespace: default
+spec:
+  address: 1.1.1.1
+  weight: 1
+  locality: region/zone1
+  labels:
+    app: echo
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: WorkloadEntry
+metadata:
+  name: echo-v2
+  namespace: default
+spec:
+  address: 2.2.2.2
+  weight: 4
+  locality: region/zone2
+  labels:
+    app: echo
+`
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: configs})
+	ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+	resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+		TypeUrl:       v3.EndpointType,
+		ResourceNames: []string{echoCluster},
+	})
+	if len(resp.Resources) != 1 {
+		t.Fatalf("expected 1 cluster load assignment, got %d", len(resp.Resources))
+	}
+	cla := &endpoint.ClusterLoadAssignment{}
+	if err := resp.Resources[0].UnmarshalTo(cla); err != nil {
+		t.Fatal(err)
+	}
+	// gRPC round robins across endpoints within a locality, so the locality weights must carry the endpoint weights.
+	got := map[string][2]uint32{}
+	for _, llb := range cla.Endpoints {
+		for _, lb := range llb.LbEndpoints {
+			addr := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress()
+			got[addr] = [2]uint32{lb.GetLoadBalancingWeight().GetValue(), llb.GetLoadBalancingWeight().GetValue()}
+		}
+	}
+	want := map[string][2]uint32{
+		"1.1.1.1": {1, 1},
+		"2.2.2.2": {4, 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got endpoint and locality weights %v, want %v", got, want)
+	}
+}
+
+func TestServicePrefixRoutes(t *testing.T) {
+	const echoRoute = "outbound|7070||echo.default.svc.cluster.local"
+	configs := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  location: MESH_INTERNAL
+  resolution: STATIC
+  workloadSelector:
+    labels:
+      app: echo
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: DestinationRule
+metadata:
+  name: echo
+  namespace: default
+spec:
+  host: echo.default.svc.cluster.local
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+  - name: v2
+    labels:
+      version: v2
+---
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  http:
+  - name: service-a
+    match:
+    - uri:
+        prefix: /pkg.ServiceA/
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v1
+  - name: service-b
+    match:
+    - uri:
+        regex: /pkg\.ServiceB((\/).*)?
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v2
+  - name: query
+    match:
+    - queryParams:
+        debug:
+          exact: "true"
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v2
+  - name: default
+    route:
+    - destination:
+        host: echo.default.svc.cluster.local
+        subset: v1
+`
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: configs})
+	ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+	resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+		TypeUrl:       v3.RouteType,
+		ResourceNames: []string{echoRoute},
+	})
+	if len(resp.Resources) != 1 {
+		t.Fatalf("expected 1 route configuration, got %d", len(resp.Resources))
+	}
+	rc := &route.RouteConfiguration{}
+	if err := resp.Resources[0].UnmarshalTo(rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.VirtualHosts) != 1 {
+		t.Fatalf("expected 1 virtual host, got %d", len(rc.VirtualHosts))
+	}
+	got := map[string][2]string{}
+	var names []string
+	for _, r := range rc.VirtualHosts[0].Routes {
+		if _, ok := r.Match.PathSpecifier.(*route.RouteMatch_Prefix); !ok {
+			t.Fatalf("route %s: expected a prefix match, got %v", r.Name, r.Match)
+		}
+		names = append(names, r.Name)
+		got[r.Name] = [2]string{r.Match.GetPrefix(), r.GetRoute().GetCluster()}
+	}
+	// The query parameter match is not supported by gRPC, so the route is dropped
+	if want := []string{"service-a", "service-b", "default"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got routes %v, want %v", names, want)
+	}
+	want := map[string][2]string{
+		"service-a": {"/pkg.ServiceA/", "outbound|7070|v1|echo.default.svc.cluster.local"},
+		"service-b": {"/pkg.ServiceB/", "outbound|7070|v2|echo.default.svc.cluster.local"},
+		"default":   {"/", "outbound|7070|v1|echo.default.svc.cluster.local"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got routes %v, want %v", got, want)
+	}
+}
+
+func TestOutboundTrafficPolicy(t *testing.T) {
+	const unknownHost = "unknown.example.com:7070"
+	cases := []struct {
+		name          string
+		mode          meshconfig.MeshConfig_OutboundTrafficPolicy_Mode
+		wantBlackHole bool
+		wantCode      codes.Code
+	}{
+		{
+			name:          "registry only",
+			mode:          meshconfig.MeshConfig_OutboundTrafficPolicy_REGISTRY_ONLY,
+			wantBlackHole: true,
+			// Fails immediately, as no route matches.
+			wantCode: codes.Unavailable,
+		},
+		{
+			name: "allow any",
+			mode: meshconfig.MeshConfig_OutboundTrafficPolicy_ALLOW_ANY,
+			// No listener is served, so the call waits for one until its deadline.
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mesh.DefaultMeshConfig()
+			m.OutboundTrafficPolicy = &meshconfig.MeshConfig_OutboundTrafficPolicy{Mode: tt.mode}
+			xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+				MeshConfig: &m,
+				ListenerBuilder: func() (net.Listener, error) {
+					return net.Listen("tcp", grpcXdsAddr)
+				},
+			})
+			if tt.wantBlackHole {
+				adsConn, err := grpc.Dial(grpcXdsAddr, grpc.WithInsecure(), grpc.WithBlock())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer adsConn.Close()
+				ads := xds.NewAdsTest(t, adsConn).WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+				resp := ads.RequestResponseAck(t, &discovery.DiscoveryRequest{
+					TypeUrl:       v3.ListenerType,
+					ResourceNames: []string{unknownHost},
+				})
+				if len(resp.Resources) != 1 {
+					t.Fatalf("expected a listener for %s, got %d listeners", unknownHost, len(resp.Resources))
+				}
+				l := &listener.Listener{}
+				if err := resp.Resources[0].UnmarshalTo(l); err != nil {
+					t.Fatal(err)
+				}
+				if l.Name != unknownHost {
+					t.Fatalf("expected a listener for %s, got %s", unknownHost, l.Name)
+				}
+			}
+
+			conn, err := grpc.Dial("xds:///"+unknownHost, grpc.WithInsecure(), grpc.WithResolvers(resolverForTest(t, "default")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = conn.Invoke(ctx, "/test.Echo/Echo", &emptypb.Empty{}, &emptypb.Empty{})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("expected %v, got %v", tt.wantCode, err)
+			}
+		})
+	}
+}
+
 type testLBClientConn struct {
 	balancer.ClientConn
 }
@@ -19,23 +19,33 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/protobuf/types/known/durationpb"
 	wrappers "google.golang.org/protobuf/types/known/wrapperspb"
 
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	corexds "istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/plugin"
 	authnplugin "istio.io/istio/pilot/pkg/networking/plugin/authn"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/security/authn"
 	"istio.io/istio/pilot/pkg/security/authn/factory"
+	"istio.io/istio/pilot/pkg/security/authz/builder"
+	"istio.io/istio/pilot/pkg/security/trustdomain"
 	"istio.io/istio/pilot/pkg/util/sets"
 	xdsfilters "istio.io/istio/pilot/pkg/xds/filters"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/istio-agent/grpcxds"
+	"istio.io/istio/pkg/util/gogo"
 )
 
 var supportedFilters = []*hcm.HttpFilter{
@@ -52,7 +62,11 @@ func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.Push
 	log.Debugf("building lds for %s with filter:\n%v", node.ID, filter)
 
 	resp := make(model.Resources, 0, len(filter))
-	resp = append(resp, buildOutboundListeners(node, push, filter)...)
+	outbound := buildOutboundListeners(node, push, filter)
+	resp = append(resp, outbound...)
+	if isRegistryOnly(node) {
+		resp = append(resp, buildBlackHoleListeners(names, outbound)...)
+	}
 	resp = append(resp, buildInboundListeners(node, push, filter.inboundNames())...)
 
 	return resp
@@ -68,6 +82,8 @@ func buildInboundListeners(node *model.Proxy, push *model.PushContext, names []s
 	for _, si := range node.ServiceInstances {
 		serviceInstancesByPort[si.Endpoint.EndpointPort] = si
 	}
+	addSidecarIngressPorts(node, serviceInstancesByPort)
+	httpFilters := buildInboundHTTPFilters(node, push)
 
 	for _, name := range names {
 		listenAddress := strings.TrimPrefix(name, grpcxds.ServerListenerNamePrefix)
@@ -97,7 +113,7 @@ func buildInboundListeners(node *model.Proxy, push *model.PushContext, names []s
 					},
 				},
 			}},
-			FilterChains: buildFilterChains(node, push, si, policyApplier),
+			FilterChains: buildFilterChains(node, push, si, policyApplier, httpFilters, buildInboundHTTPProtocolOptions(node, push, si)),
 			// the following must not be set or the client will NACK
 			ListenerFilters: nil,
 			UseOriginalDst:  nil,
@@ -110,7 +126,90 @@ func buildInboundListeners(node *model.Proxy, push *model.PushContext, names []s
 	return out
 }
 
-func buildFilterChains(node *model.Proxy, push *model.PushContext, si *model.ServiceInstance, applier authn.PolicyApplier) []*listener.FilterChain {
+// addSidecarIngressPorts indexes the service instances by the port a Sidecar ingress listener forwards their traffic
+// to, set by its defaultEndpoint. Proxyless servers bind that port rather than the endpoint port, so they request a
+// listener for it. Ports that are already endpoint ports of the workload are not remapped.
+func addSidecarIngressPorts(node *model.Proxy, serviceInstancesByPort map[uint32]*model.ServiceInstance) {
+	if !node.SidecarScope.HasIngressListener() {
+		return
+	}
+	for _, il := range node.SidecarScope.Sidecar.Ingress {
+		si, ok := serviceInstancesByPort[il.GetPort().GetNumber()]
+		if !ok {
+			continue
+		}
+		port, ok := defaultEndpointPort(il.DefaultEndpoint)
+		if !ok {
+			continue
+		}
+		if _, f := serviceInstancesByPort[port]; !f {
+			serviceInstancesByPort[port] = si
+		}
+	}
+}
+
+// defaultEndpointPort returns the port of the defaultEndpoint of a Sidecar ingress listener. Unix domain sockets have
+// no port.
+func defaultEndpointPort(defaultEndpoint string) (uint32, bool) {
+	if defaultEndpoint == "" || strings.HasPrefix(defaultEndpoint, model.UnixAddressPrefix) {
+		return 0, false
+	}
+	_, portStr, err := net.SplitHostPort(defaultEndpoint)
+	if err != nil {
+		return 0, false
+	}
+	port, err := strconv.ParseUint(portStr, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(port), true
+}
+
+// buildInboundHTTPFilters builds the HTTP filters for inbound listeners: RBAC filters for any applicable
+// AuthorizationPolicy, followed by the router.
+// Dry-run policies are only added as shadow rules. gRPC does not currently evaluate shadow rules, so they are
+// never enforced and produce no metrics; they are only visible in the generated config.
+func buildInboundHTTPFilters(node *model.Proxy, push *model.PushContext) []*hcm.HttpFilter {
+	var filters []*hcm.HttpFilter
+	if push.AuthzPolicies != nil {
+		tdBundle := trustdomain.NewBundle(push.Mesh.TrustDomain, push.Mesh.TrustDomainAliases)
+		in := &plugin.InputParams{Node: node, Push: push}
+		option := builder.Option{Logger: &builder.AuthzLogger{}}
+		if b := builder.New(tdBundle, in, option); b != nil {
+			filters = append(filters, b.BuildHTTP()...)
+		}
+		option.Logger.Report(in)
+	}
+	return append(filters, xdsfilters.Router)
+}
+
+// buildInboundHTTPProtocolOptions builds the HTTP protocol options of a server listener, so idle connections and
+// long-lived streams do not hold server resources forever. As for sidecar inbound listeners, the idle timeout is
+// the one of the proxy; the connection pool of the DestinationRule for the service takes precedence. Streams are
+// limited to PILOT_GRPC_SERVER_MAX_STREAM_DURATION. It returns nil if neither is set.
+func buildInboundHTTPProtocolOptions(node *model.Proxy, push *model.PushContext, si *model.ServiceInstance) *core.HttpProtocolOptions {
+	var idleTimeout *durationpb.Duration
+	if d, err := time.ParseDuration(node.Metadata.IdleTimeout); err == nil {
+		idleTimeout = durationpb.New(d)
+	}
+	destinationRule := corexds.CastDestinationRule(push.DestinationRule(node, si.Service))
+	trafficPolicy := corexds.MergeTrafficPolicy(nil, destinationRule.GetTrafficPolicy(), si.ServicePort)
+	if d := trafficPolicy.GetConnectionPool().GetHttp().GetIdleTimeout(); d != nil {
+		idleTimeout = gogo.DurationToProtoDuration(d)
+	}
+
+	if idleTimeout == nil && features.GRPCServerMaxStreamDuration == 0 {
+		return nil
+	}
+	out := &core.HttpProtocolOptions{IdleTimeout: idleTimeout}
+	if features.GRPCServerMaxStreamDuration > 0 {
+		out.MaxStreamDuration = durationpb.New(features.GRPCServerMaxStreamDuration)
+	}
+	return out
+}
+
+func buildFilterChains(node *model.Proxy, push *model.PushContext, si *model.ServiceInstance, applier authn.PolicyApplier,
+	httpFilters []*hcm.HttpFilter, protocolOptions *core.HttpProtocolOptions) []*listener.FilterChain {
 	mode := applier.GetMutualTLSModeForPort(si.Endpoint.EndpointPort)
 
 	var tlsContext *tls.DownstreamTlsContext
@@ -136,16 +235,17 @@ func buildFilterChains(node *model.Proxy, push *model.PushContext, si *model.Ser
 	var out []*listener.FilterChain
 	switch mode {
 	case model.MTLSDisable:
-		out = append(out, buildFilterChain("plaintext", nil))
+		out = append(out, buildFilterChain("plaintext", nil, httpFilters, protocolOptions))
 	case model.MTLSStrict:
-		out = append(out, buildFilterChain("mtls", tlsContext))
+		out = append(out, buildFilterChain("mtls", tlsContext, httpFilters, protocolOptions))
 		// TODO permissive builts both plaintext and mtls; when tlsContext is present add a match for protocol
 	}
 
 	return out
 }
 
-func buildFilterChain(nameSuffix string, tlsContext *tls.DownstreamTlsContext) *listener.FilterChain {
+func buildFilterChain(nameSuffix string, tlsContext *tls.DownstreamTlsContext, httpFilters []*hcm.HttpFilter,
+	protocolOptions *core.HttpProtocolOptions) *listener.FilterChain {
 	out := &listener.FilterChain{
 		Name:             "inbound-" + nameSuffix,
 		FilterChainMatch: nil,
@@ -153,7 +253,8 @@ func buildFilterChain(nameSuffix string, tlsContext *tls.DownstreamTlsContext) *
 			Name: "inbound-hcm" + nameSuffix,
 			ConfigType: &listener.Filter_TypedConfig{
 				TypedConfig: util.MessageToAny(&hcm.HttpConnectionManager{
-					HttpFilters: []*hcm.HttpFilter{xdsfilters.Router},
+					HttpFilters:               httpFilters,
+					CommonHttpProtocolOptions: protocolOptions,
 				}),
 			},
 		}},
@@ -221,6 +322,57 @@ func buildOutboundListeners(node *model.Proxy, push *model.PushContext, filter l
 	return out
 }
 
+// isRegistryOnly returns true if the outbound traffic policy of the proxy only allows services in the registry.
+func isRegistryOnly(node *model.Proxy) bool {
+	return node.SidecarScope != nil && node.SidecarScope.OutboundTrafficPolicy != nil &&
+		node.SidecarScope.OutboundTrafficPolicy.Mode == networking.OutboundTrafficPolicy_REGISTRY_ONLY
+}
+
+// buildBlackHoleListeners builds listeners for the requested outbound names which do not match any service, so that
+// with a REGISTRY_ONLY outbound traffic policy calls to unknown hosts fail immediately with "no matched route was
+// found", like they are blackholed by sidecars, rather than waiting for the listener to never be served.
+// With ALLOW_ANY, no listener is returned for unknown hosts, as gRPC cannot pass traffic through to the original
+// destination.
+func buildBlackHoleListeners(names []string, outbound model.Resources) model.Resources {
+	served := sets.NewSet()
+	for _, r := range outbound {
+		served.Insert(r.Name)
+		if host, _, err := net.SplitHostPort(r.Name); err == nil {
+			served.Insert(host)
+		}
+	}
+	var out model.Resources
+	for _, name := range names {
+		if strings.HasPrefix(name, grpcxds.ServerListenerNamePrefix) || served.Contains(name) {
+			continue
+		}
+		served.Insert(name)
+		ll := &listener.Listener{
+			Name: name,
+			ApiListener: &listener.ApiListener{
+				ApiListener: util.MessageToAny(&hcm.HttpConnectionManager{
+					HttpFilters: supportedFilters,
+					RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{
+						// A virtual host without routes: gRPC fails the calls as no route matches.
+						RouteConfig: &route.RouteConfiguration{
+							Name: util.BlackHole,
+							VirtualHosts: []*route.VirtualHost{{
+								Name:    util.BlackHole,
+								Domains: []string{"*"},
+							}},
+						},
+					},
+				}),
+			},
+		}
+		out = append(out, &discovery.Resource{
+			Name:     ll.Name,
+			Resource: util.MessageToAny(ll),
+		})
+	}
+	return out
+}
+
 //
 //func filterableHostnames(node *model.Proxy, hostname host.Name) []string {
 //	shost := string(hostname)
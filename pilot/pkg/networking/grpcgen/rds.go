@@ -15,12 +15,17 @@
 package grpcgen
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/util/sets"
 )
 
 // BuildHTTPRoutes supports per-VIP routes, as used by GRPC.
@@ -48,6 +53,9 @@ func buildHTTPRoute(node *model.Proxy, push *model.PushContext, routeName string
 	}
 
 	virtualHosts, _, _ := v1alpha3.BuildSidecarOutboundVirtualHosts(node, push, routeName, port, nil, &model.DisabledCache{})
+	for _, vh := range virtualHosts {
+		vh.Routes = grpcRoutes(routeName, vh.Routes)
+	}
 
 	// Only generate the required route for grpc. Will need to generate more
 	// as GRPC adds more features.
@@ -56,3 +64,116 @@ func buildHTTPRoute(node *model.Proxy, push *model.PushContext, routeName string
 		VirtualHosts: virtualHosts,
 	}
 }
+
+// prefixMatchRegex is the regex suffix used to express path prefix matches of the Gateway API in VirtualServices.
+const prefixMatchRegex = `((\/).*)?`
+
+// grpcRoutes adapts the routes to the matchers supported by gRPC xDS clients. Regular expressions matching a literal
+// prefix are translated to prefix matchers, which are cheaper for gRPC to evaluate. Routes that gRPC would reject,
+// which would NACK the whole route configuration, or would silently match more broadly than intended, are dropped.
+func grpcRoutes(routeName string, routes []*route.Route) []*route.Route {
+	out := make([]*route.Route, 0, len(routes))
+	for _, r := range routes {
+		if err := adaptGRPCRouteMatch(r.GetMatch()); err != nil {
+			log.Warnf("dropping route %q from %s, it is not supported by gRPC: %v", r.GetName(), routeName, err)
+			continue
+		}
+		if err := adaptGRPCHostRewrite(r.GetRoute()); err != nil {
+			log.Warnf("ignoring authority rewrite of route %q from %s: %v", r.GetName(), routeName, err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// adaptGRPCRouteMatch translates the path matcher to a prefix matcher if possible, and returns an error if the match
+// cannot be expressed for gRPC.
+func adaptGRPCRouteMatch(match *route.RouteMatch) error {
+	if match == nil {
+		return fmt.Errorf("no match")
+	}
+	if len(match.QueryParameters) > 0 {
+		return fmt.Errorf("query parameter matches are not supported")
+	}
+	if len(match.DynamicMetadata) > 0 {
+		return fmt.Errorf("metadata matches are not supported")
+	}
+	switch pt := match.PathSpecifier.(type) {
+	case *route.RouteMatch_Prefix, *route.RouteMatch_Path:
+	case *route.RouteMatch_SafeRegex:
+		regex := pt.SafeRegex.GetRegex()
+		if _, err := regexp.Compile(regex); err != nil {
+			return fmt.Errorf("invalid path regex %q: %v", regex, err)
+		}
+		if prefix, ok := regexToPrefix(regex); ok {
+			match.PathSpecifier = &route.RouteMatch_Prefix{Prefix: prefix}
+		}
+	default:
+		return fmt.Errorf("unsupported path match %T", pt)
+	}
+	for _, h := range match.Headers {
+		switch ht := h.HeaderMatchSpecifier.(type) {
+		case *route.HeaderMatcher_ExactMatch, *route.HeaderMatcher_RangeMatch, *route.HeaderMatcher_PresentMatch,
+			*route.HeaderMatcher_PrefixMatch, *route.HeaderMatcher_SuffixMatch:
+		case *route.HeaderMatcher_SafeRegexMatch:
+			if _, err := regexp.Compile(ht.SafeRegexMatch.GetRegex()); err != nil {
+				return fmt.Errorf("invalid regex %q for header %q: %v", ht.SafeRegexMatch.GetRegex(), h.Name, err)
+			}
+		default:
+			return fmt.Errorf("unsupported match %T for header %q", ht, h.Name)
+		}
+	}
+	return nil
+}
+
+// adaptGRPCHostRewrite moves the authority rewrites of weighted clusters to the route action. gRPC clients implementing
+// authority rewriting (gRFC A81) only read host_rewrite_literal of the route action; older clients ignore it and send
+// the original authority. As with Envoy, an authority rewrite of the route takes precedence over the destinations.
+// An error is returned if the destinations do not all rewrite to the same authority, as this cannot be expressed for
+// gRPC; their rewrites are dropped.
+func adaptGRPCHostRewrite(action *route.RouteAction) error {
+	wc := action.GetWeightedClusters()
+	if wc == nil {
+		return nil
+	}
+	authorities := sets.NewSet()
+	for _, c := range wc.Clusters {
+		authorities.Insert(c.GetHostRewriteLiteral())
+		c.HostRewriteSpecifier = nil
+	}
+	if len(authorities) == 1 {
+		authority := authorities.UnsortedList()[0]
+		if authority != "" && action.HostRewriteSpecifier == nil {
+			action.HostRewriteSpecifier = &route.RouteAction_HostRewriteLiteral{HostRewriteLiteral: authority}
+		}
+		return nil
+	}
+	if action.HostRewriteSpecifier != nil {
+		return nil
+	}
+	return fmt.Errorf("destinations do not all rewrite the authority to the same value, but gRPC only supports a single authority per route")
+}
+
+// regexToPrefix returns the prefix matched by a path regex consisting of a literal followed by either `.*`, or the
+// suffix used for Gateway API prefix matches. gRPC paths are always in the /package.Service/Method form, so the
+// latter is equivalent to a prefix ending with a slash.
+func regexToPrefix(regex string) (string, bool) {
+	var literal, suffix string
+	switch {
+	case strings.HasSuffix(regex, prefixMatchRegex):
+		literal, suffix = strings.TrimSuffix(regex, prefixMatchRegex), "/"
+	case strings.HasSuffix(regex, ".*") && !strings.HasSuffix(regex, `\.*`):
+		literal = strings.TrimSuffix(regex, ".*")
+	default:
+		return "", false
+	}
+	re, err := regexp.Compile(literal)
+	if err != nil {
+		return "", false
+	}
+	prefix, complete := re.LiteralPrefix()
+	if !complete || !strings.HasPrefix(prefix, "/") {
+		return "", false
+	}
+	return prefix + suffix, true
+}
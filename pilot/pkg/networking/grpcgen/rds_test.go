@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"fmt"
+	"testing"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+func TestRegexToPrefix(t *testing.T) {
+	cases := []struct {
+		regex  string
+		prefix string
+		ok     bool
+	}{
+		{regex: `/pkg\.Service((\/).*)?`, prefix: "/pkg.Service/", ok: true},
+		{regex: `/pkg\.Service/.*`, prefix: "/pkg.Service/", ok: true},
+		{regex: `/pkg.Service/.*`},
+		{regex: `/pkg\.Service/Get.*`, prefix: "/pkg.Service/Get", ok: true},
+		{regex: `/pkg\.Service\.*`},
+		{regex: `^/pkg\.Service/.*`},
+		{regex: `(?i)/pkg\.Service/.*`},
+		{regex: `/pkg\.Service/Method`},
+		{regex: `.*`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.regex, func(t *testing.T) {
+			prefix, ok := regexToPrefix(tt.regex)
+			if prefix != tt.prefix || ok != tt.ok {
+				t.Fatalf("got (%q, %v), want (%q, %v)", prefix, ok, tt.prefix, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAdaptGRPCHostRewrite(t *testing.T) {
+	weighted := func(authorities ...string) *route.RouteAction {
+		wc := &route.WeightedCluster{}
+		for i, a := range authorities {
+			c := &route.WeightedCluster_ClusterWeight{Name: fmt.Sprintf("cluster-%d", i)}
+			if a != "" {
+				c.HostRewriteSpecifier = &route.WeightedCluster_ClusterWeight_HostRewriteLiteral{HostRewriteLiteral: a}
+			}
+			wc.Clusters = append(wc.Clusters, c)
+		}
+		return &route.RouteAction{ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: wc}}
+	}
+	withRewrite := func(action *route.RouteAction, authority string) *route.RouteAction {
+		action.HostRewriteSpecifier = &route.RouteAction_HostRewriteLiteral{HostRewriteLiteral: authority}
+		return action
+	}
+	cases := []struct {
+		name      string
+		action    *route.RouteAction
+		authority string
+		err       bool
+	}{
+		{name: "no rewrite", action: weighted("", "")},
+		{name: "single cluster", action: withRewrite(&route.RouteAction{}, "a"), authority: "a"},
+		{name: "same authority", action: weighted("a", "a"), authority: "a"},
+		{name: "route takes precedence", action: withRewrite(weighted("a", "a"), "b"), authority: "b"},
+		{name: "different authorities", action: weighted("a", "b"), err: true},
+		{name: "partial rewrite", action: weighted("a", ""), err: true},
+		{name: "different authorities with route rewrite", action: withRewrite(weighted("a", "b"), "c"), authority: "c"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adaptGRPCHostRewrite(tt.action)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if got := tt.action.GetHostRewriteLiteral(); got != tt.authority {
+				t.Fatalf("got authority %q, want %q", got, tt.authority)
+			}
+			for _, c := range tt.action.GetWeightedClusters().GetClusters() {
+				if c.HostRewriteSpecifier != nil {
+					t.Fatalf("cluster %s still rewrites the authority", c.Name)
+				}
+			}
+		})
+	}
+}
@@ -176,6 +176,27 @@ func (a *AggregateController) GetCaCert(name, namespace string) (cert []byte, er
 	return nil, firstError
 }
 
+func (a *AggregateController) GetDockerCredential(name, namespace string) (cred []byte, err error) {
+	// Search through all clusters, find first non-empty result
+	var firstError error
+	for _, c := range a.controllers {
+		k, err := c.GetDockerCredential(name, namespace)
+		if err != nil {
+			if firstError == nil {
+				firstError = err
+			}
+		} else {
+			return k, nil
+		}
+	}
+	return nil, firstError
+}
+
+func (a *AggregateController) GetImagePullSecrets(serviceAccount, namespace string) (names []string, err error) {
+	// Service accounts are looked up in the proxy cluster, as with authorization.
+	return a.authController.GetImagePullSecrets(serviceAccount, namespace)
+}
+
 func (a *AggregateController) Authorize(serviceAccount, namespace string) error {
 	return a.authController.Authorize(serviceAccount, namespace)
 }
@@ -16,6 +16,7 @@ package kube
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -62,8 +63,9 @@ const (
 )
 
 type SecretsController struct {
-	secrets informersv1.SecretInformer
-	sar     authorizationv1client.SubjectAccessReviewInterface
+	secrets         informersv1.SecretInformer
+	serviceAccounts listersv1.ServiceAccountLister
+	sar             authorizationv1client.SubjectAccessReviewInterface
 
 	clusterID cluster.ID
 
@@ -100,7 +102,8 @@ func NewSecretsController(client kube.Client, clusterID cluster.ID) *SecretsCont
 	})
 
 	return &SecretsController{
-		secrets: informerAdapter{listersv1.NewSecretLister(informer.GetIndexer()), informer},
+		secrets:         informerAdapter{listersv1.NewSecretLister(informer.GetIndexer()), informer},
+		serviceAccounts: client.KubeInformer().Core().V1().ServiceAccounts().Lister(),
 
 		sar:                client.AuthorizationV1().SubjectAccessReviews(),
 		clusterID:          clusterID,
@@ -218,6 +221,25 @@ func (s *SecretsController) GetCaCert(name, namespace string) (cert []byte, err
 	return extractRoot(k8sSecret)
 }
 
+func (s *SecretsController) GetDockerCredential(name, namespace string) (cred []byte, err error) {
+	k8sSecret, err := s.secrets.Lister().Secrets(namespace).Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("secret %v/%v not found", namespace, name)
+	}
+	return extractDockerCredential(k8sSecret)
+}
+
+func (s *SecretsController) GetImagePullSecrets(serviceAccount, namespace string) (names []string, err error) {
+	sa, err := s.serviceAccounts.ServiceAccounts(namespace).Get(serviceAccount)
+	if err != nil {
+		return nil, fmt.Errorf("service account %v/%v not found", namespace, serviceAccount)
+	}
+	for _, ref := range sa.ImagePullSecrets {
+		names = append(names, ref.Name)
+	}
+	return names, nil
+}
+
 func hasKeys(d map[string][]byte, keys ...string) bool {
 	for _, k := range keys {
 		_, f := d[k]
@@ -290,6 +312,24 @@ func extractRoot(scrt *v1.Secret) (cert []byte, err error) {
 		GenericScrtCaCert, TLSSecretCaCert, found)
 }
 
+// extractDockerCredential extracts the docker config JSON of an image pull secret. Secrets in the legacy
+// .dockercfg format are converted to the .dockerconfigjson format.
+func extractDockerCredential(scrt *v1.Secret) (cred []byte, err error) {
+	if hasValue(scrt.Data, v1.DockerConfigJsonKey) {
+		return scrt.Data[v1.DockerConfigJsonKey], nil
+	}
+	if hasValue(scrt.Data, v1.DockerConfigKey) {
+		auths := map[string]json.RawMessage{}
+		if err := json.Unmarshal(scrt.Data[v1.DockerConfigKey], &auths); err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %v", v1.DockerConfigKey, err)
+		}
+		return json.Marshal(map[string]interface{}{"auths": auths})
+	}
+	found := truncatedKeysMessage(scrt.Data)
+	return nil, fmt.Errorf("found secret, but didn't have expected keys %s or %s; found: %s",
+		v1.DockerConfigJsonKey, v1.DockerConfigKey, found)
+}
+
 func (s *SecretsController) AddEventHandler(f func(name string, namespace string)) {
 	handler := func(obj interface{}) {
 		scrt, ok := obj.(*v1.Secret)
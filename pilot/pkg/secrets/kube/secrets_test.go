@@ -217,6 +217,74 @@ func TestSecretsController(t *testing.T) {
 	}
 }
 
+func TestDockerCredentials(t *testing.T) {
+	dockerConfigJSON := makeSecret("docker-config-json", map[string]string{
+		corev1.DockerConfigJsonKey: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+	})
+	dockerConfig := makeSecret("docker-config", map[string]string{
+		corev1.DockerConfigKey: `{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}`,
+	})
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sa",
+			Namespace: "default",
+		},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "docker-config-json"}, {Name: "docker-config"}},
+	}
+	client := kube.NewFakeClient(dockerConfigJSON, dockerConfig, genericCert, sa)
+	sc := NewSecretsController(client, "")
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+	})
+	client.RunAndWait(stop)
+
+	cases := []struct {
+		name          string
+		cred          string
+		expectedError string
+	}{
+		{
+			name: "docker-config-json",
+			cred: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+		},
+		{
+			name: "docker-config",
+			cred: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+		},
+		{
+			name:          "generic",
+			expectedError: "found secret, but didn't have expected keys .dockerconfigjson or .dockercfg; found: cert, key",
+		},
+		{
+			name:          "missing",
+			expectedError: "secret default/missing not found",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := sc.GetDockerCredential(tt.name, "default")
+			if tt.cred != string(cred) {
+				t.Errorf("got cred %q, wanted %q", string(cred), tt.cred)
+			}
+			if tt.expectedError != errString(err) {
+				t.Errorf("got err %q, wanted %q", errString(err), tt.expectedError)
+			}
+		})
+	}
+
+	names, err := sc.GetImagePullSecrets("sa", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[docker-config-json docker-config]" {
+		t.Errorf("got image pull secrets %v", names)
+	}
+	if _, err := sc.GetImagePullSecrets("missing", "default"); err == nil {
+		t.Errorf("expected error for missing service account")
+	}
+}
+
 func errString(e error) string {
 	if e == nil {
 		return ""
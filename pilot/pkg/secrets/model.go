@@ -19,10 +19,15 @@ import "istio.io/istio/pkg/cluster"
 type Controller interface {
 	GetKeyAndCert(name, namespace string) (key []byte, cert []byte, err error)
 	GetCaCert(name, namespace string) (cert []byte, err error)
+	// GetDockerCredential returns the docker config JSON of an image pull secret.
+	GetDockerCredential(name, namespace string) (cred []byte, err error)
+	// GetImagePullSecrets returns the names of the image pull secrets attached to a service account.
+	GetImagePullSecrets(serviceAccount, namespace string) (names []string, err error)
 	Authorize(serviceAccount, namespace string) error
 	AddEventHandler(func(name, namespace string))
 }
 
 type MulticlusterController interface {
 	ForCluster(cluster cluster.ID) (Controller, error)
+	AddEventHandler(func(name, namespace string))
 }
@@ -94,12 +94,24 @@ var (
 		"pilot_k8s_endpoints_pending_pod",
 		"Number of endpoints that do not currently have any corresponding pods.",
 	)
+
+	excludedEndpointSlices = monitoring.NewSum(
+		"pilot_k8s_endpoint_slices_excluded",
+		"Total number of EndpointSlice events skipped because the Service is excluded from endpoint processing.",
+	)
+
+	invalidEndpointAddresses = monitoring.NewSum(
+		"pilot_k8s_endpoint_addresses_invalid",
+		"Total number of link-local, unspecified or multicast EndpointSlice addresses ignored.",
+	)
 )
 
 func init() {
 	monitoring.MustRegister(k8sEvents)
 	monitoring.MustRegister(endpointsWithNoPods)
 	monitoring.MustRegister(endpointsPendingPodUpdate)
+	monitoring.MustRegister(excludedEndpointSlices)
+	monitoring.MustRegister(invalidEndpointAddresses)
 }
 
 func incrementEvent(kind, event string) {
@@ -116,6 +128,9 @@ type Options struct {
 	ResyncPeriod time.Duration
 	DomainSuffix string
 
+	// Revision is the revision of the control plane, the value of the istio.io/rev label.
+	Revision string
+
 	// ClusterID identifies the remote cluster in a multicluster env.
 	ClusterID cluster.ID
 
@@ -253,6 +268,11 @@ type Controller struct {
 	// nodeSelectorsForServices stores hostname => label selectors that can be used to
 	// refine the set of node port IPs for a service.
 	nodeSelectorsForServices map[host.Name]labels.Instance
+	// readinessGatesIgnored stores the hostnames of services annotated with kube.IgnoreReadinessGatesAnnotation.
+	readinessGatesIgnored map[host.Name]struct{}
+	// endpointExclusions stores the namespaces and Services set with kube.EndpointExclusionsAnnotation on the system
+	// namespace, whose EndpointSlices are not processed.
+	endpointExclusions endpointExclusions
 	// map of node name and its address+labels - this is the only thing we need from nodes
 	// for vm to k8s or cross cluster. When node port services select specific nodes by labels,
 	// we run through the label selectors here to pick only ones that we need.
@@ -295,6 +315,7 @@ func NewController(kubeClient kubelib.Client, options Options) *Controller {
 		queue:                       queue.NewQueue(1 * time.Second),
 		servicesMap:                 make(map[host.Name]*model.Service),
 		nodeSelectorsForServices:    make(map[host.Name]labels.Instance),
+		readinessGatesIgnored:       make(map[host.Name]struct{}),
 		nodeInfoMap:                 make(map[string]kubernetesNode),
 		externalNameSvcInstanceMap:  make(map[host.Name][]*model.ServiceInstance),
 		workloadInstancesByIP:       make(map[string]*model.WorkloadInstance),
@@ -538,6 +559,7 @@ func (c *Controller) deleteService(svc *model.Service) {
 	c.Lock()
 	delete(c.servicesMap, svc.Hostname)
 	delete(c.nodeSelectorsForServices, svc.Hostname)
+	delete(c.readinessGatesIgnored, svc.Hostname)
 	delete(c.externalNameSvcInstanceMap, svc.Hostname)
 	_, isNetworkGateway := c.networkGateways[svc.Hostname]
 	delete(c.networkGateways, svc.Hostname)
@@ -579,6 +601,13 @@ func (c *Controller) addOrUpdateService(svc *v1.Service, svcConv *model.Service,
 	if len(instances) > 0 {
 		c.externalNameSvcInstanceMap[svcConv.Hostname] = instances
 	}
+	_, ignoredBefore := c.readinessGatesIgnored[svcConv.Hostname]
+	ignoreReadinessGates := svc != nil && svc.Annotations[kube.IgnoreReadinessGatesAnnotation] == "true"
+	if ignoreReadinessGates {
+		c.readinessGatesIgnored[svcConv.Hostname] = struct{}{}
+	} else {
+		delete(c.readinessGatesIgnored, svcConv.Hostname)
+	}
 	c.Unlock()
 
 	if needsFullPush {
@@ -590,7 +619,8 @@ func (c *Controller) addOrUpdateService(svc *v1.Service, svcConv *model.Service,
 	// We also need to update when the Service changes. For Kubernetes, a service change will result in Endpoint updates,
 	// but workload entries will also need to be updated.
 	// TODO(nmittler): Build different sets of endpoints for cluster.local and clusterset.local.
-	endpoints := c.buildEndpointsForService(svcConv, false)
+	// Which endpoints are included depends on the readiness gates annotation, so rebuild them when it changes.
+	endpoints := c.buildEndpointsForService(svcConv, ignoredBefore != ignoreReadinessGates)
 	ns := svcConv.Attributes.Namespace
 	if len(endpoints) > 0 {
 		c.opts.XDSUpdater.EDSCacheUpdate(shard, string(svcConv.Hostname), ns, endpoints)
@@ -610,6 +640,25 @@ func (c *Controller) buildEndpointsForService(svc *model.Service, updateCache bo
 	return endpoints
 }
 
+// updateEDSForPod rebuilds and pushes the endpoints of the Services selecting the pod.
+func (c *Controller) updateEDSForPod(pod *v1.Pod) {
+	services, err := getPodServices(c.serviceLister, pod)
+	if err != nil {
+		log.Debugf("failed to get services of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return
+	}
+	shard := model.ShardKeyFromRegistry(c)
+	for _, svc := range services {
+		for _, hostName := range c.hostNamesForNamespacedName(kube.NamespacedNameForK8sObject(svc)) {
+			modelSvc := c.GetService(hostName)
+			if modelSvc == nil {
+				continue
+			}
+			c.opts.XDSUpdater.EDSUpdate(shard, string(hostName), svc.Namespace, c.buildEndpointsForService(modelSvc, true))
+		}
+	}
+}
+
 func (c *Controller) onNodeEvent(obj interface{}, event model.Event) error {
 	node, ok := obj.(*v1.Node)
 	if !ok {
@@ -838,6 +887,9 @@ func (c *Controller) Run(stop <-chan struct{}) {
 		log.Errorf("one or more errors force-syncing resources: %v", err)
 	}
 	c.initialSync.Store(true)
+	if esc, ok := c.endpoints.(*endpointSliceController); ok {
+		go esc.tracker.run(stop)
+	}
 	// after the in-order sync we can start processing the queue
 	c.queue.Run(stop)
 	log.Infof("Controller terminated")
@@ -879,18 +931,27 @@ func (c *Controller) getPodLocality(pod *v1.Pod) string {
 
 	// NodeName is set by the scheduler after the pod is created
 	// https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#late-initialization
-	raw, err := c.nodeLister.Get(pod.Spec.NodeName)
+	locality, err := c.getNodeLocality(pod.Spec.NodeName)
 	if err != nil {
 		if pod.Spec.NodeName != "" {
 			log.Warnf("unable to get node %q for pod %q/%q: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
 		}
 		return ""
 	}
+	return locality
+}
+
+// getNodeLocality retrieves the locality for a node, from its topology labels.
+func (c *Controller) getNodeLocality(nodeName string) (string, error) {
+	raw, err := c.nodeLister.Get(nodeName)
+	if err != nil {
+		return "", err
+	}
 
 	nodeMeta, err := meta.Accessor(raw)
 	if err != nil {
 		log.Warnf("unable to get node meta: %v", nodeMeta)
-		return ""
+		return "", nil
 	}
 
 	region := getLabelValue(nodeMeta, NodeRegionLabel, NodeRegionLabelGA)
@@ -898,10 +959,10 @@ func (c *Controller) getPodLocality(pod *v1.Pod) string {
 	subzone := getLabelValue(nodeMeta, label.TopologySubzone.Name, "")
 
 	if region == "" && zone == "" && subzone == "" {
-		return ""
+		return "", nil
 	}
 
-	return region + "/" + zone + "/" + subzone // Format: "%s/%s/%s"
+	return region + "/" + zone + "/" + subzone, nil // Format: "%s/%s/%s"
 }
 
 // InstancesByPort implements a service catalog operation
@@ -983,6 +1044,10 @@ func (c *Controller) serviceInstancesFromWorkloadInstances(svc *model.Service, r
 		if wi.Namespace != svc.Attributes.Namespace {
 			continue
 		}
+		if !wi.Endpoint.IsHealthy() {
+			// Unhealthy workload entries are tracked, but treated the same as not ready pods
+			continue
+		}
 		if selector.SubsetOf(wi.Endpoint.Labels) {
 			// create an instance with endpoint whose service port name matches
 			istioEndpoint := *wi.Endpoint
@@ -1196,15 +1261,21 @@ func (c *Controller) onSystemNamespaceEvent(obj interface{}, ev model.Event) err
 		return nil
 	}
 	nw := ns.Labels[label.TopologyNetwork.Name]
+	exclusions := parseEndpointExclusions(ns.Annotations[kube.EndpointExclusionsAnnotation])
 	c.Lock()
 	oldDefaultNetwork := c.network
 	c.network = network.ID(nw)
+	oldExclusions := c.endpointExclusions
+	c.endpointExclusions = exclusions
 	c.Unlock()
 	// network changed, rarely happen
 	if oldDefaultNetwork != c.network {
 		// refresh pods/endpoints/services
 		c.onNetworkChanged()
 	}
+	if !oldExclusions.equals(exclusions) {
+		c.onEndpointExclusionsChanged(oldExclusions, exclusions)
+	}
 	return nil
 }
 
@@ -2101,6 +2101,102 @@ func TestWorkloadInstanceHandlerMultipleEndpoints(t *testing.T) {
 	}
 }
 
+func TestWorkloadInstanceHandlerHealthStatus(t *testing.T) {
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+
+	pod := generatePod("172.0.1.1", "pod1", "nsA", "", "node1", map[string]string{"app": "prod-app"}, map[string]string{})
+	addPods(t, controller, fx, pod)
+	createService(controller, "svc1", "nsA", nil,
+		[]int32{8080}, map[string]string{"app": "prod-app"}, t)
+	if ev := fx.Wait("service"); ev == nil {
+		t.Fatal("Timeout creating service")
+	}
+
+	setPodReady := func(ready bool) {
+		t.Helper()
+		portName, portNum := "tcp-port", int32(1001)
+		slice := &discovery.EndpointSlice{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      "svc1",
+				Namespace: "nsA",
+				Labels:    map[string]string{discovery.LabelServiceName: "svc1"},
+			},
+			Endpoints: []discovery.Endpoint{{
+				Addresses:  []string{"172.0.1.1"},
+				Conditions: discovery.EndpointConditions{Ready: &ready},
+			}},
+			Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+		}
+		slices := controller.client.DiscoveryV1().EndpointSlices("nsA")
+		if _, err := slices.Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+			if errors.IsAlreadyExists(err) {
+				_, err = slices.Update(context.TODO(), slice, metaV1.UpdateOptions{})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	setWorkloadEntryHealth := func(health model.HealthStatus) {
+		controller.WorkloadInstanceHandler(&model.WorkloadInstance{
+			Name:      "workload",
+			Namespace: "nsA",
+			Endpoint: &model.IstioEndpoint{
+				Labels:         labels.Instance{"app": "prod-app"},
+				ServiceAccount: "account",
+				Address:        "2.2.2.2",
+				EndpointPort:   8080,
+				HealthStatus:   health,
+			},
+		}, model.EventUpdate)
+	}
+	expectEndpoints := func(want ...string) {
+		t.Helper()
+		ev := fx.Wait("eds")
+		if ev == nil {
+			t.Fatal("Timeout incremental eds")
+		}
+		var got []string
+		for _, ep := range ev.Endpoints {
+			got = append(got, ep.Address)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("eds update did not match expected list. got %v, want %v", got, want)
+		}
+	}
+
+	setPodReady(true)
+	expectEndpoints("172.0.1.1")
+	setWorkloadEntryHealth(model.Healthy)
+	expectEndpoints("172.0.1.1", "2.2.2.2")
+
+	// Each side toggles health independently; only healthy endpoints from either source should be sent,
+	// regardless of which side triggered the update.
+	setWorkloadEntryHealth(model.UnHealthy)
+	expectEndpoints("172.0.1.1")
+	setWorkloadEntryHealth(model.Healthy)
+	expectEndpoints("172.0.1.1", "2.2.2.2")
+	setPodReady(false)
+	expectEndpoints("2.2.2.2")
+	setWorkloadEntryHealth(model.Healthy)
+	expectEndpoints("2.2.2.2")
+	setPodReady(true)
+	expectEndpoints("172.0.1.1", "2.2.2.2")
+
+	// Both sources should report health the same way through InstancesByPort
+	setPodReady(false)
+	expectEndpoints("2.2.2.2")
+	setWorkloadEntryHealth(model.UnHealthy)
+	converted, err := controller.Services()
+	if err != nil || len(converted) != 1 {
+		t.Fatalf("failed to get services (%v): %v", converted, err)
+	}
+	if instances := controller.InstancesByPort(converted[0], 8080, labels.Collection{}); len(instances) != 0 {
+		t.Fatalf("expected unhealthy endpoints to be excluded, got %v", instances)
+	}
+}
+
 func TestKubeEndpointsControllerOnEvent(t *testing.T) {
 	testCases := []struct {
 		mode      EndpointMode
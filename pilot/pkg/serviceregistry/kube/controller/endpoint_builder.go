@@ -15,9 +15,12 @@
 package controller
 
 import (
+	"strconv"
+
 	v1 "k8s.io/api/core/v1"
 
 	"istio.io/api/label"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
@@ -27,6 +30,15 @@ import (
 	"istio.io/istio/pkg/network"
 )
 
+const (
+	// podDeletionCostAnnotation ranks the pods of a ReplicaSet for removal on scale down, lowest cost first.
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+	// podEndpointWeight is the load balancing weight of Kubernetes endpoints when PodDeletionCostWeighting is enabled.
+	podEndpointWeight = 10
+	// drainingPodEndpointWeight is the load balancing weight of the endpoints of pods with a negative deletion cost.
+	drainingPodEndpointWeight = 1
+)
+
 // EndpointBuilder is a stateful IstioEndpoint builder with metadata used to build IstioEndpoint
 type EndpointBuilder struct {
 	controller controllerInterface
@@ -38,6 +50,7 @@ type EndpointBuilder struct {
 	tlsMode        string
 	workloadName   string
 	namespace      string
+	lbWeight       uint32
 
 	// Values used to build dns name tables per pod.
 	// The the hostname of the Pod, by default equals to pod name.
@@ -76,6 +89,7 @@ func NewEndpointBuilder(c controllerInterface, pod *v1.Pod) *EndpointBuilder {
 		namespace:    namespace,
 		hostname:     hostname,
 		subDomain:    subdomain,
+		lbWeight:     podLoadBalancingWeight(pod),
 	}
 	networkID := out.endpointNetwork(ip)
 	out.labels = labelutil.AugmentLabels(podLabels, c.Cluster(), locality, networkID)
@@ -132,7 +146,32 @@ func (b *EndpointBuilder) buildIstioEndpoint(
 		HostName:              b.hostname,
 		SubDomain:             b.subDomain,
 		DiscoverabilityPolicy: discoverabilityPolicy,
+		LbWeight:              b.lbWeight,
+	}
+}
+
+// podLoadBalancingWeight returns the load balancing weight of the endpoints of the pod, which may be nil for endpoints
+// without a pod. Unless PodDeletionCostWeighting is enabled, this is 0, the default weight.
+func podLoadBalancingWeight(pod *v1.Pod) uint32 {
+	if !features.PodDeletionCostWeighting {
+		return 0
+	}
+	if pod == nil {
+		return podEndpointWeight
+	}
+	value, f := pod.Annotations[podDeletionCostAnnotation]
+	if !f {
+		return podEndpointWeight
+	}
+	cost, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		log.Debugf("invalid %s annotation on pod %s/%s: %v", podDeletionCostAnnotation, pod.Namespace, pod.Name, err)
+		return podEndpointWeight
+	}
+	if cost < 0 {
+		return drainingPodEndpointWeight
 	}
+	return podEndpointWeight
 }
 
 // return the mesh network for the endpoint IP. Empty string if not found.
@@ -15,11 +15,17 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/discovery/v1"
 	"k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	klabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,6 +37,7 @@ import (
 	mcs "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"istio.io/api/label"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller/filter"
@@ -42,6 +49,7 @@ import (
 type endpointSliceController struct {
 	kubeEndpoints
 	endpointCache *endpointSliceCache
+	tracker       *endpointSliceTracker
 	useV1Resource bool
 }
 
@@ -69,8 +77,12 @@ func newEndpointSliceController(c *Controller) *endpointSliceController {
 		},
 		useV1Resource: useV1Resource,
 		endpointCache: newEndpointSliceCache(),
+		tracker: newEndpointSliceTracker(features.ServiceWithoutEndpointSlicesThreshold,
+			features.ServiceNoReadyEndpointsDebounce),
 	}
+	out.tracker.onReadinessChange = out.onReadinessChange
 	c.registerHandlers(informer, "EndpointSlice", out.onEvent, nil)
+	c.AppendServiceHandler(out.onServiceEvent)
 	return out
 }
 
@@ -119,11 +131,195 @@ func (esc *endpointSliceController) onEvent(curr interface{}, event model.Event)
 
 	esLabels := ep.GetLabels()
 	if endpointSliceSelector.Matches(klabels.Set(esLabels)) {
-		return processEndpointEvent(esc.c, esc, serviceNameForEndpointSlice(esLabels), ep.GetNamespace(), event, ep)
+		if esc.c.endpointsExcluded(esc.getServiceNamespacedName(ep)) {
+			return esc.onExcludedEvent(ep, event)
+		}
+		if !esc.checkConsistency(ep, event) {
+			return nil
+		}
+		svcName := esc.getServiceNamespacedName(ep)
+		before := esc.readyEndpointAddresses(svcName)
+		err := processEndpointEvent(esc.c, esc, serviceNameForEndpointSlice(esLabels), ep.GetNamespace(), event, ep)
+		esc.tracker.recordChurn(svcName, endpointChurn(before, esc.readyEndpointAddresses(svcName)))
+		esc.updateServiceReadiness(svcName)
+		return err
 	}
 	return nil
 }
 
+// onExcludedEvent handles an event for a slice of a Service excluded from endpoint processing. The endpoints of the
+// Service are only rebuilt, which drops them, if some are left from before the Service was excluded.
+func (esc *endpointSliceController) onExcludedEvent(ep metav1.Object, event model.Event) error {
+	excludedEndpointSlices.Increment()
+	svcName := esc.getServiceNamespacedName(ep)
+	for _, hostName := range esc.c.hostNamesForNamespacedName(svcName) {
+		if esc.endpointCache.Has(hostName) {
+			return processEndpointEvent(esc.c, esc, svcName.Name, svcName.Namespace, event, ep)
+		}
+	}
+	return nil
+}
+
+// onEndpointExclusionsChanged reprocesses the slices of the Services whose exclusion from endpoint processing changed,
+// so that their endpoints are dropped or rebuilt without a restart.
+func (c *Controller) onEndpointExclusionsChanged(old, cur endpointExclusions) {
+	esc, ok := c.endpoints.(*endpointSliceController)
+	if !ok {
+		return
+	}
+	for _, slice := range esc.informer.GetIndexer().List() {
+		svcName := esc.getServiceNamespacedName(slice)
+		if old.excludes(svcName) == cur.excludes(svcName) {
+			continue
+		}
+		if err := esc.onEvent(slice, model.EventUpdate); err != nil {
+			log.Errorf("failed to reprocess endpoint slice of %s: %v", svcName, err)
+		}
+	}
+}
+
+// updateServiceReadiness records whether the Service has any ready endpoints left.
+func (esc *endpointSliceController) updateServiceReadiness(svcName types.NamespacedName) {
+	ready := false
+	for _, hostName := range esc.c.hostNamesForNamespacedName(svcName) {
+		if len(esc.endpointCache.Get(hostName)) > 0 {
+			ready = true
+			break
+		}
+	}
+	esc.tracker.updateReadiness(svcName, ready)
+}
+
+// readyEndpointAddresses returns the addresses of the ready endpoints of the Service.
+func (esc *endpointSliceController) readyEndpointAddresses(svcName types.NamespacedName) map[string]struct{} {
+	addresses := map[string]struct{}{}
+	for _, hostName := range esc.c.hostNamesForNamespacedName(svcName) {
+		for _, ep := range esc.endpointCache.Get(hostName) {
+			if ep.IsHealthy() {
+				addresses[ep.Address] = struct{}{}
+			}
+		}
+	}
+	return addresses
+}
+
+// endpointChurn returns the number of addresses added and removed between before and after.
+func endpointChurn(before, after map[string]struct{}) int {
+	changes := 0
+	for a := range after {
+		if _, f := before[a]; !f {
+			changes++
+		}
+	}
+	for b := range before {
+		if _, f := after[b]; !f {
+			changes++
+		}
+	}
+	return changes
+}
+
+// onReadinessChange creates an Event on the Service when it transitions to or from having no ready endpoints.
+func (esc *endpointSliceController) onReadinessChange(svcName types.NamespacedName, ready bool) {
+	if !features.EnableServiceNoReadyEndpointsEvents {
+		return
+	}
+	esc.c.queue.Push(func() error {
+		svc, err := esc.c.serviceLister.Services(svcName.Namespace).Get(svcName.Name)
+		if err != nil {
+			// The Service was deleted in the meantime
+			return nil
+		}
+		eventType, reason, message := corev1.EventTypeWarning, "NoReadyEndpoints", "Service has no ready endpoints"
+		if ready {
+			eventType, reason, message = corev1.EventTypeNormal, "ReadyEndpointsRestored", "Service has ready endpoints again"
+		}
+		now := metav1.Now()
+		event := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				// Named the same way as events created by client-go
+				Name:      fmt.Sprintf("%v.%x", svc.Name, now.UnixNano()),
+				Namespace: svc.Namespace,
+			},
+			InvolvedObject: corev1.ObjectReference{
+				APIVersion:      "v1",
+				Kind:            "Service",
+				Name:            svc.Name,
+				Namespace:       svc.Namespace,
+				UID:             svc.UID,
+				ResourceVersion: svc.ResourceVersion,
+			},
+			Reason:         reason,
+			Message:        fmt.Sprintf("%s for more than %v", message, esc.tracker.readinessDebounce),
+			Type:           eventType,
+			Source:         corev1.EventSource{Component: "istiod"},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if _, err := esc.c.client.CoreV1().Events(svc.Namespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+			log.Warnf("failed to create %v event for Service %v: %v", reason, svcName, err)
+		}
+		return nil
+	})
+}
+
+// checkConsistency records whether the slice references an existing Service, and returns whether the slice
+// should be processed. Slices referencing a Service that does not exist are only reprocessed with a backoff.
+func (esc *endpointSliceController) checkConsistency(ep metav1.Object, event model.Event) bool {
+	slice := types.NamespacedName{Namespace: ep.GetNamespace(), Name: ep.GetName()}
+	svcName := esc.getServiceNamespacedName(ep)
+	if event == model.EventDelete {
+		esc.tracker.sliceResolved(slice)
+		esc.updateServiceSlices(svcName)
+		return true
+	}
+	if !esc.c.opts.DiscoveryNamespacesFilter.Filter(ep) {
+		// Services outside of the discovery namespaces are not known to us, so we cannot tell if the slice is orphaned
+		return true
+	}
+	if _, err := esc.c.serviceLister.Services(svcName.Namespace).Get(svcName.Name); errors.IsNotFound(err) {
+		return esc.tracker.shouldProcessOrphan(slice, svcName)
+	}
+	esc.tracker.sliceResolved(slice)
+	esc.tracker.updateService(svcName, true)
+	return true
+}
+
+// updateServiceSlices records whether the Service has any EndpointSlices left.
+func (esc *endpointSliceController) updateServiceSlices(svcName types.NamespacedName) {
+	svc, err := esc.c.serviceLister.Services(svcName.Namespace).Get(svcName.Name)
+	if err != nil || len(svc.Spec.Selector) == 0 {
+		// Services without a selector have their EndpointSlices managed externally, so having none is expected
+		return
+	}
+	slices, err := esc.listSlices(svcName.Namespace, endpointSliceSelectorForService(svcName.Name))
+	if err != nil {
+		return
+	}
+	esc.tracker.updateService(svcName, len(slices) > 0)
+}
+
+// onServiceEvent tracks the EndpointSlices of the Service, and reprocesses slices that were orphaned before the
+// Service was created.
+func (esc *endpointSliceController) onServiceEvent(svc *model.Service, event model.Event) {
+	svcName := types.NamespacedName{Namespace: svc.Attributes.Namespace, Name: svc.Attributes.Name}
+	if event == model.EventDelete {
+		esc.tracker.serviceDeleted(svcName)
+		return
+	}
+	esc.updateServiceSlices(svcName)
+	for _, slice := range esc.tracker.serviceAdded(svcName) {
+		item, exists, err := esc.informer.GetIndexer().GetByKey(slice.String())
+		if err != nil || !exists {
+			continue
+		}
+		esc.c.queue.Push(func() error {
+			return esc.onEvent(item, model.EventUpdate)
+		})
+	}
+}
+
 // GetProxyServiceInstances returns service instances co-located with a given proxy
 // TODO: this code does not return k8s service instances when the proxy's IP is a workload entry
 // To tackle this, we need a ip2instance map like what we have in service entry.
@@ -135,6 +331,9 @@ func (esc *endpointSliceController) GetProxyServiceInstances(c *Controller, prox
 	}
 	var out []*model.ServiceInstance
 	for _, ep := range eps {
+		if c.endpointsExcluded(esc.getServiceNamespacedName(ep)) {
+			continue
+		}
 		instances := esc.sliceServiceInstances(c, ep, proxy)
 		out = append(out, instances...)
 	}
@@ -167,8 +366,9 @@ func (esc *endpointSliceController) sliceServiceInstances(c *Controller, slice i
 			for _, ip := range proxy.IPAddresses {
 				for _, ep := range ep.Endpoints() {
 					for _, a := range ep.Addresses {
-						if a == ip {
+						if a, valid := endpointAddress(a); valid && a == ip {
 							istioEndpoint := builder.buildIstioEndpoint(ip, *port.Port, svcPort.Name, discoverabilityPolicy)
+							istioEndpoint.HealthStatus = endpointHealthStatus(ep)
 							out = append(out, &model.ServiceInstance{
 								Endpoint:    istioEndpoint,
 								ServicePort: svcPort,
@@ -193,42 +393,76 @@ func (esc *endpointSliceController) forgetEndpoint(endpoint interface{}) map[hos
 	key := kube.KeyFunc(slice.Name, slice.Namespace)
 	for _, e := range slice.Endpoints() {
 		for _, a := range e.Addresses {
-			esc.c.pods.endpointDeleted(key, a)
+			if a, valid := endpointAddress(a); valid {
+				esc.c.pods.endpointDeleted(key, a)
+			}
 		}
 	}
 
 	out := make(map[host.Name][]*model.IstioEndpoint)
-	for _, svc := range esc.c.servicesForNamespacedName(esc.getServiceNamespacedName(slice)) {
-		// endpointSlice cache update
-		hostName := svc.Hostname
-		esc.endpointCache.Delete(hostName, slice.Name)
-		out[hostName] = esc.endpointCache.Get(hostName)
+	svcName := esc.getServiceNamespacedName(slice)
+	for _, svc := range esc.c.servicesForNamespacedName(svcName) {
+		// The deleted slice is no longer in the informer, so rebuilding drops its endpoints.
+		out[svc.Hostname] = esc.updateEndpointCacheForService(svcName, svc.Hostname)
 	}
 	return out
 }
 
 func (esc *endpointSliceController) buildIstioEndpoints(es interface{}, hostName host.Name) []*model.IstioEndpoint {
-	esc.updateEndpointCacheForSlice(hostName, es)
+	return esc.updateEndpointCacheForService(esc.getServiceNamespacedName(es), hostName)
+}
+
+// updateEndpointCacheForService rebuilds the endpoints of the host from all EndpointSlices of the Service currently
+// in the informer, and returns them. Services with many endpoints are split across many slices, which are updated
+// independently; rebuilding from a single snapshot of the slices, rather than merging each slice into the previous
+// state, ensures the endpoints are consistent with the slices regardless of the order of the updates and resyncs.
+func (esc *endpointSliceController) updateEndpointCacheForService(svcName types.NamespacedName, hostName host.Name) []*model.IstioEndpoint {
+	if esc.c.endpointsExcluded(svcName) {
+		esc.endpointCache.Replace(hostName, nil)
+		return nil
+	}
+	slices, err := esc.listSlices(svcName.Namespace, endpointSliceSelectorForService(svcName.Name))
+	if err != nil {
+		log.Errorf("failed to list endpoint slices of %s: %v", svcName, err)
+		return esc.endpointCache.Get(hostName)
+	}
+	endpointsBySlice := make(map[string][]*model.IstioEndpoint, len(slices))
+	for _, slice := range slices {
+		endpointsBySlice[slice.(metav1.Object).GetName()] = esc.endpointsForSlice(hostName, slice)
+	}
+	esc.endpointCache.Replace(hostName, endpointsBySlice)
 	return esc.endpointCache.Get(hostName)
 }
 
-func (esc *endpointSliceController) updateEndpointCacheForSlice(hostName host.Name, ep interface{}) {
+// endpointsForSlice builds the endpoints of the host from a single EndpointSlice.
+func (esc *endpointSliceController) endpointsForSlice(hostName host.Name, ep interface{}) []*model.IstioEndpoint {
 	var endpoints []*model.IstioEndpoint
 	slice := wrapEndpointSlice(ep)
 
 	discoverabilityPolicy := esc.c.exports.EndpointDiscoverabilityPolicy(esc.c.GetService(hostName))
+	ignoreReadinessGates := esc.c.ignoreReadinessGates(hostName)
 
 	for _, e := range slice.Endpoints() {
-		if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+		ready := endpointHealthStatus(e) == model.Healthy
+		if !ready && !ignoreReadinessGates {
 			// Ignore not ready endpoints
 			continue
 		}
-		for _, a := range e.Addresses {
+		for _, address := range e.Addresses {
+			a, valid := endpointAddress(address)
+			if !valid {
+				log.Debugf("ignoring invalid address %s of endpoint slice %s/%s", address, slice.Namespace, slice.Name)
+				invalidEndpointAddresses.Increment()
+				continue
+			}
 			pod, expectedPod := getPod(esc.c, a, &metav1.ObjectMeta{Name: slice.Name, Namespace: slice.Namespace}, e.TargetRef, hostName)
 			if pod == nil && expectedPod {
 				continue
 			}
-			builder := esc.newEndpointBuilder(pod)
+			if !ready && !failingOnlyReadinessGates(pod) {
+				continue
+			}
+			builder := esc.newEndpointBuilder(pod, e)
 			// EDS and ServiceEntry use name for service port - ADS will need to map to numbers.
 			for _, port := range slice.Ports() {
 				var portNum int32
@@ -245,24 +479,14 @@ func (esc *endpointSliceController) updateEndpointCacheForSlice(hostName host.Na
 			}
 		}
 	}
-	esc.endpointCache.Update(hostName, slice.Name, endpoints)
+	return endpoints
 }
 
 func (esc *endpointSliceController) buildIstioEndpointsWithService(name, namespace string, hostName host.Name, updateCache bool) []*model.IstioEndpoint {
-	esLabelSelector := endpointSliceSelectorForService(name)
-	slices, err := esc.listSlices(namespace, esLabelSelector)
-	if err != nil || len(slices) == 0 {
-		log.Debugf("endpoint slices of (%s, %s) not found => error %v", name, namespace, err)
-		return nil
-	}
-
 	if updateCache {
-		// A cache update was requested. Rebuild the endpoints for these slices.
-		for _, slice := range slices {
-			esc.updateEndpointCacheForSlice(hostName, slice)
-		}
+		// A cache update was requested. Rebuild the endpoints from the current slices.
+		return esc.updateEndpointCacheForService(types.NamespacedName{Namespace: namespace, Name: name}, hostName)
 	}
-
 	return esc.endpointCache.Get(hostName)
 }
 
@@ -275,6 +499,9 @@ func (esc *endpointSliceController) getServiceNamespacedName(es interface{}) typ
 }
 
 func (esc *endpointSliceController) InstancesByPort(c *Controller, svc *model.Service, reqSvcPort int, labelsList labels.Collection) []*model.ServiceInstance {
+	if c.endpointsExcluded(types.NamespacedName{Namespace: svc.Attributes.Namespace, Name: svc.Attributes.Name}) {
+		return nil
+	}
 	esLabelSelector := endpointSliceSelectorForService(svc.Attributes.Name)
 	slices, err := esc.listSlices(svc.Attributes.Namespace, esLabelSelector)
 	if err != nil {
@@ -292,17 +519,30 @@ func (esc *endpointSliceController) InstancesByPort(c *Controller, svc *model.Se
 	}
 
 	discoverabilityPolicy := c.exports.EndpointDiscoverabilityPolicy(svc)
+	ignoreReadinessGates := c.ignoreReadinessGates(svc.Hostname)
 
 	var out []*model.ServiceInstance
 	for _, es := range slices {
 		slice := wrapEndpointSlice(es)
 		for _, e := range slice.Endpoints() {
+			ready := endpointHealthStatus(e) == model.Healthy
+			if !ready && !ignoreReadinessGates {
+				// Ignore not ready endpoints, consistent with the endpoints sent over EDS
+				continue
+			}
 			for _, a := range e.Addresses {
+				a, valid := endpointAddress(a)
+				if !valid {
+					continue
+				}
 				var podLabels labels.Instance
 				pod, expectedPod := getPod(c, a, &metav1.ObjectMeta{Name: slice.Name, Namespace: slice.Namespace}, e.TargetRef, svc.Hostname)
 				if pod == nil && expectedPod {
 					continue
 				}
+				if !ready && !failingOnlyReadinessGates(pod) {
+					continue
+				}
 				if pod != nil {
 					podLabels = pod.Labels
 				}
@@ -311,7 +551,7 @@ func (esc *endpointSliceController) InstancesByPort(c *Controller, svc *model.Se
 					continue
 				}
 
-				builder := esc.newEndpointBuilder(pod)
+				builder := esc.newEndpointBuilder(pod, e)
 				// identify the port by name. K8S EndpointPort uses the service port name
 				for _, port := range slice.Ports() {
 					var portNum int32
@@ -335,19 +575,154 @@ func (esc *endpointSliceController) InstancesByPort(c *Controller, svc *model.Se
 	return out
 }
 
-func (esc *endpointSliceController) newEndpointBuilder(pod *corev1.Pod) *EndpointBuilder {
+// endpointAddress validates an address of an EndpointSlice endpoint, returning the address to use for it.
+// IPv4-mapped IPv6 addresses are normalized to IPv4. Link-local, unspecified and multicast addresses, typically set
+// by misconfigured CNIs, cannot be connected to from other pods, so they are invalid.
+func endpointAddress(address string) (string, bool) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		// Not an IP address, such as the hostname of an FQDN slice.
+		return address, true
+	}
+	if ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return "", false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String(), true
+	}
+	return address, true
+}
+
+func (esc *endpointSliceController) newEndpointBuilder(pod *corev1.Pod, e v1.Endpoint) *EndpointBuilder {
 	if pod != nil {
 		// Respect pod "istio-locality" label
 		if pod.Labels[model.LocalityLabel] == "" {
 			pod = pod.DeepCopy()
 			// mutate the labels, only need `istio-locality`
-			pod.Labels[model.LocalityLabel] = esc.c.getPodLocality(pod)
+			pod.Labels[model.LocalityLabel] = esc.endpointLocality(pod, e)
 		}
 	}
 
 	return NewEndpointBuilder(esc.c, pod)
 }
 
+// endpointLocality returns the locality of the node of the endpoint. When a pod is recreated on another node with
+// the same name or IP, the slice is updated with the new node while the pod cache may still hold the previous pod, so
+// the node of the endpoint takes precedence over the node of the pod. As endpoints are rebuilt on every update of
+// their slice, a change of node or zone is reflected immediately.
+func (esc *endpointSliceController) endpointLocality(pod *corev1.Pod, e v1.Endpoint) string {
+	if e.NodeName == nil || *e.NodeName == "" || *e.NodeName == pod.Spec.NodeName {
+		return esc.c.getPodLocality(pod)
+	}
+	locality, err := esc.c.getNodeLocality(*e.NodeName)
+	if err != nil {
+		log.Debugf("unable to get node %q of endpoint for pod %s/%s, using the node of the pod: %v", *e.NodeName, pod.Namespace, pod.Name, err)
+		return esc.c.getPodLocality(pod)
+	}
+	return locality
+}
+
+// endpointHealthStatus maps the EndpointSlice conditions onto the IstioEndpoint health status. This follows the
+// same semantics as WorkloadEntry health checks: an endpoint explicitly reported as not ready is unhealthy.
+func endpointHealthStatus(e v1.Endpoint) model.HealthStatus {
+	if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+		return model.UnHealthy
+	}
+	return model.Healthy
+}
+
+// ignoreReadinessGates returns whether the service opted in to treating endpoints failing only custom readiness
+// gates as ready. See kube.IgnoreReadinessGatesAnnotation.
+func (c *Controller) ignoreReadinessGates(hostname host.Name) bool {
+	c.RLock()
+	defer c.RUnlock()
+	_, f := c.readinessGatesIgnored[hostname]
+	return f
+}
+
+// endpointsExcluded returns whether the EndpointSlices of the Service are excluded from processing.
+// See kube.EndpointExclusionsAnnotation.
+func (c *Controller) endpointsExcluded(svcName types.NamespacedName) bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.endpointExclusions.excludes(svcName)
+}
+
+// endpointExclusions holds the namespaces and Services excluded from endpoint processing.
+type endpointExclusions struct {
+	namespaces map[string]struct{}
+	services   map[types.NamespacedName]struct{}
+}
+
+// parseEndpointExclusions parses a comma separated list of namespaces and namespace/name Services.
+func parseEndpointExclusions(value string) endpointExclusions {
+	out := endpointExclusions{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if parts := strings.SplitN(entry, "/", 2); len(parts) == 2 {
+			if out.services == nil {
+				out.services = map[types.NamespacedName]struct{}{}
+			}
+			out.services[types.NamespacedName{Namespace: parts[0], Name: parts[1]}] = struct{}{}
+			continue
+		}
+		if out.namespaces == nil {
+			out.namespaces = map[string]struct{}{}
+		}
+		out.namespaces[entry] = struct{}{}
+	}
+	return out
+}
+
+func (e endpointExclusions) excludes(svcName types.NamespacedName) bool {
+	if _, f := e.namespaces[svcName.Namespace]; f {
+		return true
+	}
+	_, f := e.services[svcName]
+	return f
+}
+
+func (e endpointExclusions) equals(other endpointExclusions) bool {
+	if len(e.namespaces) != len(other.namespaces) || len(e.services) != len(other.services) {
+		return false
+	}
+	for ns := range e.namespaces {
+		if _, f := other.namespaces[ns]; !f {
+			return false
+		}
+	}
+	for svc := range e.services {
+		if _, f := other.services[svc]; !f {
+			return false
+		}
+	}
+	return true
+}
+
+// failingOnlyReadinessGates returns whether the pod is running with all containers ready, and is not ready only
+// because at least one of its custom readiness gates is not satisfied.
+func failingOnlyReadinessGates(pod *corev1.Pod) bool {
+	if pod == nil || pod.Status.Phase != corev1.PodRunning || len(pod.Spec.ReadinessGates) == 0 {
+		return false
+	}
+	conditions := make(map[corev1.PodConditionType]corev1.ConditionStatus, len(pod.Status.Conditions))
+	for _, c := range pod.Status.Conditions {
+		conditions[c.Type] = c.Status
+	}
+	if conditions[corev1.ContainersReady] != corev1.ConditionTrue {
+		return false
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if conditions[gate.ConditionType] != corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
 // TODO this isn't used now, but we may still want to extract locality from the v1 EnspointSlice instead of node
 func getLocalityFromTopology(topology map[string]string) string {
 	locality := topology[NodeRegionLabelGA]
@@ -367,71 +742,63 @@ type endpointKey struct {
 	port string
 }
 
+// endpointSliceCache holds the endpoints of each host, by EndpointSlice name. The endpoints of a host are always
+// replaced as a whole, so readers never observe a partially updated host.
 type endpointSliceCache struct {
-	mu                            sync.RWMutex
-	endpointKeysByServiceAndSlice map[host.Name]map[string][]endpointKey
-	endpointByKey                 map[endpointKey]*model.IstioEndpoint
+	mu                         sync.RWMutex
+	endpointsByServiceAndSlice map[host.Name]map[string][]*model.IstioEndpoint
 }
 
 func newEndpointSliceCache() *endpointSliceCache {
 	out := &endpointSliceCache{
-		endpointKeysByServiceAndSlice: make(map[host.Name]map[string][]endpointKey),
-		endpointByKey:                 make(map[endpointKey]*model.IstioEndpoint),
+		endpointsByServiceAndSlice: make(map[host.Name]map[string][]*model.IstioEndpoint),
 	}
 	return out
 }
 
-func (e *endpointSliceCache) Update(hostname host.Name, slice string, endpoints []*model.IstioEndpoint) {
+// Replace sets the endpoints of the host, by slice name. Hosts without any slices are removed.
+func (e *endpointSliceCache) Replace(hostname host.Name, endpointsBySlice map[string][]*model.IstioEndpoint) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	if len(endpoints) == 0 {
-		for _, ip := range e.endpointKeysByServiceAndSlice[hostname][slice] {
-			delete(e.endpointByKey, ip)
-		}
-		delete(e.endpointKeysByServiceAndSlice[hostname], slice)
+	if len(endpointsBySlice) == 0 {
+		delete(e.endpointsByServiceAndSlice, hostname)
+		return
 	}
-	if _, f := e.endpointKeysByServiceAndSlice[hostname]; !f {
-		e.endpointKeysByServiceAndSlice[hostname] = make(map[string][]endpointKey)
-	}
-	keys := make([]endpointKey, 0, len(endpoints))
-	for _, ep := range endpoints {
-		key := endpointKey{ep.Address, ep.ServicePortName}
-		keys = append(keys, key)
-		// We will always overwrite. A conflict here means an endpoint is transitioning
-		// from one slice to another See
-		// https://github.com/kubernetes/website/blob/master/content/en/docs/concepts/services-networking/endpoint-slices.md#duplicate-endpoints
-		// In this case, we can always assume and update is fresh, although older slices
-		// we have not gotten updates may be stale; therefor we always take the new
-		// update.
-		e.endpointByKey[key] = ep
-	}
-	e.endpointKeysByServiceAndSlice[hostname][slice] = keys
+	e.endpointsByServiceAndSlice[hostname] = endpointsBySlice
 }
 
-func (e *endpointSliceCache) Delete(hostname host.Name, slice string) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	delete(e.endpointKeysByServiceAndSlice[hostname], slice)
-	if len(e.endpointKeysByServiceAndSlice[hostname]) == 0 {
-		delete(e.endpointKeysByServiceAndSlice, hostname)
-	}
+// Has returns whether the cache holds any slices for the host.
+func (e *endpointSliceCache) Has(hostname host.Name) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, f := e.endpointsByServiceAndSlice[hostname]
+	return f
 }
 
 func (e *endpointSliceCache) Get(hostname host.Name) []*model.IstioEndpoint {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
+	slices := e.endpointsByServiceAndSlice[hostname]
+	// Iterate the slices in a stable order, so that the endpoints, and the copy kept for endpoints present in
+	// multiple slices, do not change between calls.
+	names := make([]string, 0, len(slices))
+	for name := range slices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 	var endpoints []*model.IstioEndpoint
 	found := map[endpointKey]struct{}{}
-	for _, keys := range e.endpointKeysByServiceAndSlice[hostname] {
-		for _, key := range keys {
+	for _, name := range names {
+		for _, ep := range slices[name] {
+			key := endpointKey{ep.Address, ep.ServicePortName}
 			if _, f := found[key]; f {
-				// This a duplicate. Update() already handles conflict resolution, so we don't
-				// need to pick the "right" one here.
+				// An endpoint may briefly be in multiple slices while transitioning from one slice to another. See
+				// https://github.com/kubernetes/website/blob/master/content/en/docs/concepts/services-networking/endpoint-slices.md#duplicate-endpoints
+				// Both copies are built from the current state, so either can be used.
 				continue
 			}
 			found[key] = struct{}{}
-			endpoints = append(endpoints, e.endpointByKey[key])
+			endpoints = append(endpoints, ep)
 		}
 	}
 	return endpoints
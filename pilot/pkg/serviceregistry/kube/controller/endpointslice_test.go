@@ -15,16 +15,29 @@
 package controller
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"go.opencensus.io/stats/view"
 	coreV1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	mcs "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"istio.io/api/label"
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/test/util/retry"
 )
 
 func TestGetLocalityFromTopology(t *testing.T) {
@@ -119,3 +132,969 @@ func TestEndpointSliceFromMCSShouldBeIgnored(t *testing.T) {
 		t.Fatalf("should be 0 instances: len(instances) = %v", len(instances))
 	}
 }
+
+func TestOrphanedEndpointSlice(t *testing.T) {
+	const ns = "nsa"
+
+	controller, _ := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+	esc := controller.endpoints.(*endpointSliceController)
+
+	var mu sync.Mutex
+	current := time.Now()
+	esc.tracker.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		current = current.Add(d)
+	}
+
+	// Create a slice for a Service that does not exist
+	createEndpoints(t, controller, "orphan", ns, []string{"tcp-port"}, []string{"128.0.0.1"}, nil, nil)
+	orphan := types.NamespacedName{Namespace: ns, Name: "orphan"}
+	retry.UntilSuccessOrFail(t, func() error {
+		esc.tracker.mu.Lock()
+		defer esc.tracker.mu.Unlock()
+		if _, f := esc.tracker.orphans[orphan]; !f {
+			return fmt.Errorf("orphaned slice not tracked")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+	expectGauge(t, "pilot_k8s_endpoint_slices_orphaned", 1)
+
+	item, exists, err := esc.informer.GetIndexer().GetByKey(orphan.String())
+	if err != nil || !exists {
+		t.Fatalf("failed to get endpoint slice: %v", err)
+	}
+	slice := wrapEndpointSlice(item)
+	processed := func() int {
+		count := 0
+		for i := 0; i < 10; i++ {
+			if esc.checkConsistency(slice, model.EventUpdate) {
+				count++
+			}
+		}
+		return count
+	}
+	// The slice was already processed when it was added, so repeated resyncs are backed off
+	if got := processed(); got != 0 {
+		t.Fatalf("expected orphaned slice to be backed off, processed %d times", got)
+	}
+	advance(orphanedSliceInitialBackoff)
+	if got := processed(); got != 1 {
+		t.Fatalf("expected orphaned slice to be processed once after backoff, processed %d times", got)
+	}
+	// The backoff doubles each time
+	advance(orphanedSliceInitialBackoff)
+	if got := processed(); got != 0 {
+		t.Fatalf("expected orphaned slice to be backed off, processed %d times", got)
+	}
+
+	// Once the Service is created, the slice is no longer orphaned
+	createService(controller, "orphan", ns, nil, []int32{8080}, map[string]string{"app": "orphan"}, t)
+	expectGauge(t, "pilot_k8s_endpoint_slices_orphaned", 0)
+	if got := processed(); got != 10 {
+		t.Fatalf("expected slice to be processed on every event, processed %d times", got)
+	}
+
+	// A Service with a selector but without any slices is reported once it exceeds the threshold
+	createService(controller, "empty", ns, nil, []int32{8080}, map[string]string{"app": "empty"}, t)
+	retry.UntilSuccessOrFail(t, func() error {
+		esc.tracker.mu.Lock()
+		defer esc.tracker.mu.Unlock()
+		if _, f := esc.tracker.emptySince[types.NamespacedName{Namespace: ns, Name: "empty"}]; !f {
+			return fmt.Errorf("service without slices not tracked")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+	expectGauge(t, "pilot_k8s_services_without_endpoint_slices", 0)
+	advance(features.ServiceWithoutEndpointSlicesThreshold)
+	esc.tracker.updateService(types.NamespacedName{Namespace: ns, Name: "empty"}, false)
+	expectGauge(t, "pilot_k8s_services_without_endpoint_slices", 1)
+
+	createEndpoints(t, controller, "empty", ns, []string{"tcp-port"}, []string{"128.0.0.2"}, nil, nil)
+	expectGauge(t, "pilot_k8s_services_without_endpoint_slices", 0)
+}
+
+func TestServiceReadyEndpointsTransitions(t *testing.T) {
+	const ns = "nsa"
+	svcName := types.NamespacedName{Namespace: ns, Name: "svc"}
+
+	defer func(enabled bool, debounce time.Duration) {
+		features.EnableServiceNoReadyEndpointsEvents = enabled
+		features.ServiceNoReadyEndpointsDebounce = debounce
+	}(features.EnableServiceNoReadyEndpointsEvents, features.ServiceNoReadyEndpointsDebounce)
+	features.EnableServiceNoReadyEndpointsEvents = true
+	features.ServiceNoReadyEndpointsDebounce = time.Minute
+	controller, _ := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+	esc := controller.endpoints.(*endpointSliceController)
+
+	var mu sync.Mutex
+	current := time.Now()
+	esc.tracker.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		current = current.Add(d)
+	}
+	// expectReadiness waits for the slice update to be processed by the tracker
+	expectReadiness := func(ready, changed bool) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			esc.tracker.mu.Lock()
+			defer esc.tracker.mu.Unlock()
+			r, f := esc.tracker.readiness[svcName]
+			if !f {
+				return fmt.Errorf("service readiness not tracked")
+			}
+			if r.ready != ready || r.changedSince.IsZero() == changed {
+				return fmt.Errorf("expected ready=%v changed=%v, got %+v", ready, changed, r)
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+	expectEvents := func(reasons ...string) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			events, err := controller.client.CoreV1().Events(ns).List(context.TODO(), metaV1.ListOptions{})
+			if err != nil {
+				return err
+			}
+			got := []string{}
+			for _, e := range events.Items {
+				if e.InvolvedObject.Name != svcName.Name || e.InvolvedObject.Kind != "Service" {
+					return fmt.Errorf("unexpected event for %v", e.InvolvedObject)
+				}
+				got = append(got, e.Reason)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, reasons) {
+				return fmt.Errorf("expected events %v, got %v", reasons, got)
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+	noReady := transitionCount(t, noReadyEndpoints)
+
+	createService(controller, svcName.Name, ns, nil, []int32{8080}, map[string]string{"app": "svc"}, t)
+	createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, []string{"128.0.0.1"}, nil, nil)
+	expectReadiness(true, false)
+
+	// Endpoints briefly dropping to zero are not reported
+	createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, nil, nil, nil)
+	expectReadiness(true, true)
+	createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, []string{"128.0.0.2"}, nil, nil)
+	expectReadiness(true, false)
+	advance(time.Minute)
+	esc.updateServiceReadiness(svcName)
+	expectReadiness(true, false)
+
+	// Endpoints staying at zero for the debounce period are reported once
+	createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, nil, nil, nil)
+	expectReadiness(true, true)
+	advance(time.Minute)
+	esc.updateServiceReadiness(svcName)
+	esc.updateServiceReadiness(svcName)
+	expectReadiness(false, false)
+	expectGauge(t, "pilot_k8s_services_without_ready_endpoints", 1)
+	if got := transitionCount(t, noReadyEndpoints) - noReady; got != 1 {
+		t.Fatalf("expected a single transition to no ready endpoints, got %v", got)
+	}
+	expectEvents("NoReadyEndpoints")
+
+	// And so is the recovery
+	createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, []string{"128.0.0.3"}, nil, nil)
+	expectReadiness(false, true)
+	advance(time.Minute)
+	esc.updateServiceReadiness(svcName)
+	expectReadiness(true, false)
+	expectGauge(t, "pilot_k8s_services_without_ready_endpoints", 0)
+	expectEvents("NoReadyEndpoints", "ReadyEndpointsRestored")
+}
+
+func TestServiceEndpointChurn(t *testing.T) {
+	const ns = "nsa"
+	svcName := types.NamespacedName{Namespace: ns, Name: "churn"}
+	controller, _ := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+	esc := controller.endpoints.(*endpointSliceController)
+
+	var mu sync.Mutex
+	current := time.Now()
+	esc.tracker.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+	expectChurn := func(expected float64) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			if got := churnEvents(t); got != expected {
+				return fmt.Errorf("expected %v churn events, got %v", expected, got)
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+	// setEndpoints updates the endpoints of the Service, and waits for the update to be processed, so that
+	// successive updates are not coalesced by the informer
+	setEndpoints := func(ips ...string) {
+		t.Helper()
+		createEndpoints(t, controller, svcName.Name, ns, []string{"tcp-port"}, ips, nil, nil)
+		retry.UntilSuccessOrFail(t, func() error {
+			if got := esc.readyEndpointAddresses(svcName); len(got) != len(ips) {
+				return fmt.Errorf("expected %d endpoints, got %v", len(ips), got)
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+	initial := churnEvents(t)
+
+	createService(controller, svcName.Name, ns, nil, []int32{8080}, map[string]string{"app": "churn"}, t)
+	// A crashlooping backend repeatedly leaves and rejoins the ready endpoints
+	for i := 0; i < 3; i++ {
+		setEndpoints("128.0.0.1", "128.0.0.2")
+		setEndpoints("128.0.0.1")
+	}
+	// The first update adds both endpoints, then each update adds or removes one
+	expectChurn(initial + 7)
+
+	// The churn of the Service is reported once the window elapsed
+	mu.Lock()
+	current = current.Add(endpointChurnWindow)
+	mu.Unlock()
+	esc.tracker.mu.Lock()
+	esc.tracker.reportChurnLocked()
+	esc.tracker.mu.Unlock()
+	if got := serviceChurn(t, svcName.String()); got != 7 {
+		t.Fatalf("expected service churn of 7, got %v", got)
+	}
+
+	// And reset once it stopped
+	mu.Lock()
+	current = current.Add(endpointChurnWindow)
+	mu.Unlock()
+	esc.tracker.mu.Lock()
+	esc.tracker.reportChurnLocked()
+	esc.tracker.mu.Unlock()
+	if got := serviceChurn(t, svcName.String()); got != 0 {
+		t.Fatalf("expected service churn to be reset, got %v", got)
+	}
+}
+
+func TestEndpointChurnTopK(t *testing.T) {
+	tracker := newEndpointSliceTracker(time.Minute, time.Minute)
+	current := time.Now()
+	tracker.now = func() time.Time {
+		return current
+	}
+	for i := 0; i < endpointChurnTopK+5; i++ {
+		tracker.recordChurn(types.NamespacedName{Namespace: "topk", Name: fmt.Sprintf("svc-%02d", i)}, i+1)
+	}
+	current = current.Add(endpointChurnWindow)
+	tracker.mu.Lock()
+	tracker.reportChurnLocked()
+	tracker.mu.Unlock()
+	if len(tracker.churnReported) != endpointChurnTopK {
+		t.Fatalf("expected %d reported services, got %d", endpointChurnTopK, len(tracker.churnReported))
+	}
+	// The Services with the least churn are not reported
+	for i := 0; i < 5; i++ {
+		if _, f := tracker.churnReported[types.NamespacedName{Namespace: "topk", Name: fmt.Sprintf("svc-%02d", i)}]; f {
+			t.Fatalf("expected svc-%02d not to be reported", i)
+		}
+	}
+	if got := serviceChurn(t, "topk/svc-14"); got != 15 {
+		t.Fatalf("expected churn of 15, got %v", got)
+	}
+}
+
+// churnEvents returns the number of endpoint churn events reported so far.
+func churnEvents(t *testing.T) float64 {
+	t.Helper()
+	data, err := view.RetrieveData("pilot_k8s_endpoint_churn_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		return 0
+	}
+	return data[0].Data.(*view.SumData).Value
+}
+
+// serviceChurn returns the endpoint churn reported for the given Service.
+func serviceChurn(t *testing.T, svc string) float64 {
+	t.Helper()
+	data, err := view.RetrieveData("pilot_k8s_service_endpoint_churn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range data {
+		for _, tag := range row.Tags {
+			if tag.Value == svc {
+				return row.Data.(*view.LastValueData).Value
+			}
+		}
+	}
+	t.Fatalf("no churn reported for %s", svc)
+	return 0
+}
+
+// transitionCount returns the number of ready endpoints transitions of the given type reported so far.
+func transitionCount(t *testing.T, transition string) float64 {
+	t.Helper()
+	data, err := view.RetrieveData("pilot_k8s_service_ready_endpoints_transitions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range data {
+		for _, tag := range row.Tags {
+			if tag.Value == transition {
+				return row.Data.(*view.SumData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func expectGauge(t *testing.T, name string, expected float64) {
+	t.Helper()
+	retry.UntilSuccessOrFail(t, func() error {
+		data, err := view.RetrieveData(name)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("no data for %s", name)
+		}
+		if got := data[0].Data.(*view.LastValueData).Value; got != expected {
+			return fmt.Errorf("expected %s to be %v, got %v", name, expected, got)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
+
+func TestEndpointSliceIgnoreReadinessGates(t *testing.T) {
+	const ns = "nsa"
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+
+	gate := coreV1.PodConditionType("example.com/cutover-complete")
+	// gated is running with all containers ready, but failing a custom readiness gate
+	gated := generatePod("128.0.0.1", "gated", ns, "sa", "node1", map[string]string{"app": "test"}, nil)
+	// unready is failing its containers readiness
+	unready := generatePod("128.0.0.2", "unready", ns, "sa", "node1", map[string]string{"app": "test"}, nil)
+	for _, pod := range []*coreV1.Pod{gated, unready} {
+		pod.Spec.ReadinessGates = []coreV1.PodReadinessGate{{ConditionType: gate}}
+	}
+	addPods(t, controller, fx, gated, unready)
+	setStatus := func(pod *coreV1.Pod, containersReady coreV1.ConditionStatus) {
+		p, err := controller.client.CoreV1().Pods(ns).Get(context.TODO(), pod.Name, metaV1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Status.Conditions = []coreV1.PodCondition{
+			{Type: coreV1.PodReady, Status: coreV1.ConditionFalse},
+			{Type: coreV1.ContainersReady, Status: containersReady},
+			{Type: gate, Status: coreV1.ConditionFalse},
+		}
+		if _, err := controller.client.CoreV1().Pods(ns).UpdateStatus(context.TODO(), p, metaV1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setStatus(gated, coreV1.ConditionTrue)
+	setStatus(unready, coreV1.ConditionFalse)
+
+	notReady := false
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+	}{
+		{"annotated", map[string]string{kube.IgnoreReadinessGatesAnnotation: "true"}, []string{"128.0.0.1"}},
+		{"not-annotated", nil, nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			createService(controller, tt.name, ns, tt.annotations, []int32{8080}, map[string]string{"app": "test"}, t)
+			hostname := kube.ServiceHostname(tt.name, ns, controller.opts.DomainSuffix)
+			retry.UntilSuccessOrFail(t, func() error {
+				if controller.GetService(hostname) == nil {
+					return fmt.Errorf("service not found")
+				}
+				return nil
+			}, retry.Timeout(time.Second*5))
+
+			portName, portNum := "tcp-port", int32(8080)
+			slice := &discovery.EndpointSlice{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      tt.name,
+					Namespace: ns,
+					Labels:    map[string]string{discovery.LabelServiceName: tt.name},
+				},
+				Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+			}
+			for _, pod := range []*coreV1.Pod{gated, unready} {
+				slice.Endpoints = append(slice.Endpoints, discovery.Endpoint{
+					Addresses:  []string{pod.Status.PodIP},
+					Conditions: discovery.EndpointConditions{Ready: &notReady},
+					TargetRef:  &coreV1.ObjectReference{Kind: "Pod", Namespace: ns, Name: pod.Name},
+				})
+			}
+			if _, err := controller.client.DiscoveryV1().EndpointSlices(ns).Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			esc := controller.endpoints.(*endpointSliceController)
+			retry.UntilSuccessOrFail(t, func() error {
+				var got []string
+				for _, ep := range esc.buildIstioEndpointsWithService(tt.name, ns, hostname, true) {
+					got = append(got, ep.Address)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					return fmt.Errorf("got endpoints %v, want %v", got, tt.want)
+				}
+				svc := controller.GetService(hostname)
+				var gotInstances []string
+				for _, si := range controller.InstancesByPort(svc, 8080, labels.Collection{}) {
+					gotInstances = append(gotInstances, si.Endpoint.Address)
+				}
+				if !reflect.DeepEqual(gotInstances, tt.want) {
+					return fmt.Errorf("got instances %v, want %v", gotInstances, tt.want)
+				}
+				return nil
+			}, retry.Timeout(time.Second*5))
+		})
+	}
+}
+
+func TestEndpointSliceExclusions(t *testing.T) {
+	const ns = "nsa"
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly, SystemNamespace: "istio-system"})
+	defer controller.Stop()
+
+	systemNamespace := &coreV1.Namespace{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        "istio-system",
+			Annotations: map[string]string{kube.EndpointExclusionsAnnotation: "kube-system, nsa/excluded"},
+		},
+	}
+	if _, err := controller.client.CoreV1().Namespaces().Create(context.TODO(), systemNamespace, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if !controller.endpointsExcluded(types.NamespacedName{Namespace: ns, Name: "excluded"}) {
+			return fmt.Errorf("exclusions not applied")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	pod := generatePod("128.0.0.1", "pod1", ns, "sa", "node1", map[string]string{"app": "test"}, nil)
+	addPods(t, controller, fx, pod)
+	portName, portNum := "tcp-port", int32(8080)
+	for _, name := range []string{"excluded", "included"} {
+		createService(controller, name, ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+		slice := &discovery.EndpointSlice{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    map[string]string{discovery.LabelServiceName: name},
+			},
+			Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+			Endpoints: []discovery.Endpoint{{
+				Addresses: []string{pod.Status.PodIP},
+				TargetRef: &coreV1.ObjectReference{Kind: "Pod", Namespace: ns, Name: pod.Name},
+			}},
+		}
+		if _, err := controller.client.DiscoveryV1().EndpointSlices(ns).Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	esc := controller.endpoints.(*endpointSliceController)
+	expectInstances := func(name string, want []string) {
+		t.Helper()
+		hostname := kube.ServiceHostname(name, ns, controller.opts.DomainSuffix)
+		retry.UntilSuccessOrFail(t, func() error {
+			svc := controller.GetService(hostname)
+			if svc == nil {
+				return fmt.Errorf("service not found")
+			}
+			var gotEndpoints []string
+			for _, ep := range esc.endpointCache.Get(hostname) {
+				gotEndpoints = append(gotEndpoints, ep.Address)
+			}
+			if !reflect.DeepEqual(gotEndpoints, want) {
+				return fmt.Errorf("got endpoints %v, want %v", gotEndpoints, want)
+			}
+			var gotInstances []string
+			for _, si := range controller.InstancesByPort(svc, 8080, labels.Collection{}) {
+				gotInstances = append(gotInstances, si.Endpoint.Address)
+			}
+			if !reflect.DeepEqual(gotInstances, want) {
+				return fmt.Errorf("got instances %v, want %v", gotInstances, want)
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+	expectInstances("included", []string{"128.0.0.1"})
+	expectInstances("excluded", nil)
+
+	// Removing the exclusion picks up the endpoints without a restart
+	systemNamespace.Annotations = nil
+	if _, err := controller.client.CoreV1().Namespaces().Update(context.TODO(), systemNamespace, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectInstances("excluded", []string{"128.0.0.1"})
+	expectInstances("included", []string{"128.0.0.1"})
+
+	// Excluding the Service again drops its endpoints
+	systemNamespace.Annotations = map[string]string{kube.EndpointExclusionsAnnotation: ns}
+	if _, err := controller.client.CoreV1().Namespaces().Update(context.TODO(), systemNamespace, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectInstances("excluded", nil)
+	expectInstances("included", nil)
+}
+
+func TestEndpointSliceClusterAttribution(t *testing.T) {
+	const ns = "nsa"
+	const clusterID = "cluster-a"
+	networksWatcher := mesh.NewFixedNetworksWatcher(&meshconfig.MeshNetworks{
+		Networks: map[string]*meshconfig.Network{
+			"network-a": {
+				Endpoints: []*meshconfig.Network_NetworkEndpoints{
+					{Ne: &meshconfig.Network_NetworkEndpoints_FromCidr{FromCidr: "128.0.0.0/16"}},
+				},
+			},
+		},
+	})
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{
+		Mode:            EndpointSliceOnly,
+		ClusterID:       clusterID,
+		NetworksWatcher: networksWatcher,
+	})
+	defer controller.Stop()
+
+	// The pod label must not override the cluster of the controller the endpoint is discovered from.
+	pod := generatePod("128.0.0.1", "pod", ns, "sa", "node1",
+		map[string]string{"app": "test", label.TopologyCluster.Name: "other"}, nil)
+	addPods(t, controller, fx, pod)
+	createService(controller, "svc", ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+	hostname := kube.ServiceHostname("svc", ns, controller.opts.DomainSuffix)
+	retry.UntilSuccessOrFail(t, func() error {
+		if controller.GetService(hostname) == nil {
+			return fmt.Errorf("service not found")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	portName, portNum := "tcp-port", int32(8080)
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "svc",
+			Namespace: ns,
+			Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+		},
+		Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+		Endpoints: []discovery.Endpoint{
+			{
+				Addresses: []string{pod.Status.PodIP},
+				TargetRef: &coreV1.ObjectReference{Kind: "Pod", Namespace: ns, Name: pod.Name},
+			},
+			// An endpoint that is not backed by a pod, for example a manually managed slice
+			{Addresses: []string{"128.0.0.2"}},
+		},
+	}
+	if _, err := controller.client.DiscoveryV1().EndpointSlices(ns).Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertAttributed := func(ep *model.IstioEndpoint) error {
+		if ep.Locality.ClusterID != clusterID {
+			return fmt.Errorf("endpoint %v has cluster %q, want %q", ep.Address, ep.Locality.ClusterID, clusterID)
+		}
+		if got := ep.Labels[label.TopologyCluster.Name]; got != clusterID {
+			return fmt.Errorf("endpoint %v has cluster label %q, want %q", ep.Address, got, clusterID)
+		}
+		if ep.Network != "network-a" || ep.Labels[label.TopologyNetwork.Name] != "network-a" {
+			return fmt.Errorf("endpoint %v has network %q and label %q, want network-a", ep.Address, ep.Network,
+				ep.Labels[label.TopologyNetwork.Name])
+		}
+		return nil
+	}
+	esc := controller.endpoints.(*endpointSliceController)
+	retry.UntilSuccessOrFail(t, func() error {
+		eps := esc.buildIstioEndpointsWithService("svc", ns, hostname, true)
+		if len(eps) != 2 {
+			return fmt.Errorf("expected 2 endpoints, got %v", len(eps))
+		}
+		for _, ep := range eps {
+			if err := assertAttributed(ep); err != nil {
+				return err
+			}
+		}
+		instances := controller.InstancesByPort(controller.GetService(hostname), 8080, labels.Collection{})
+		if len(instances) != 2 {
+			return fmt.Errorf("expected 2 instances, got %v", len(instances))
+		}
+		for _, si := range instances {
+			if err := assertAttributed(si.Endpoint); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
+
+func TestEndpointSliceManySlices(t *testing.T) {
+	const (
+		ns                = "nsa"
+		slices            = 50
+		endpointsPerSlice = 100
+	)
+	controller, _ := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+	createService(controller, "svc", ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+	hostname := kube.ServiceHostname("svc", ns, controller.opts.DomainSuffix)
+	retry.UntilSuccessOrFail(t, func() error {
+		if controller.GetService(hostname) == nil {
+			return fmt.Errorf("service not found")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	portName, portNum := "tcp-port", int32(8080)
+	makeSlice := func(name string, group int) *discovery.EndpointSlice {
+		slice := &discovery.EndpointSlice{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+			},
+			Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+		}
+		if group >= 0 {
+			for i := 0; i < endpointsPerSlice; i++ {
+				// Endpoints not backed by pods, so that they are included without creating pods.
+				slice.Endpoints = append(slice.Endpoints, discovery.Endpoint{
+					Addresses: []string{fmt.Sprintf("10.0.%d.%d", group, i)},
+				})
+			}
+		}
+		return slice
+	}
+	slicesClient := controller.client.DiscoveryV1().EndpointSlices(ns)
+	for i := 0; i < slices; i++ {
+		if _, err := slicesClient.Create(context.TODO(), makeSlice(fmt.Sprintf("svc-%d", i), i), metaV1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	esc := controller.endpoints.(*endpointSliceController)
+	assertEndpoints := func() error {
+		eps := esc.endpointCache.Get(hostname)
+		for _, ep := range eps {
+			if ep == nil {
+				return fmt.Errorf("got a missing endpoint")
+			}
+		}
+		if len(eps) != slices*endpointsPerSlice {
+			return fmt.Errorf("expected %d endpoints, got %d", slices*endpointsPerSlice, len(eps))
+		}
+		instances := controller.InstancesByPort(controller.GetService(hostname), 8080, labels.Collection{})
+		if len(instances) != slices*endpointsPerSlice {
+			return fmt.Errorf("expected %d instances, got %d", slices*endpointsPerSlice, len(instances))
+		}
+		return nil
+	}
+	retry.UntilSuccessOrFail(t, assertEndpoints, retry.Timeout(time.Second*10))
+
+	// Move the endpoints of every slice to a new slice, emptying the old slice before deleting it, as the
+	// EndpointSlice controller does when rebalancing slices. Endpoints are briefly in two slices, and every
+	// intermediate state must still include each endpoint exactly once.
+	for i := 0; i < slices; i++ {
+		if _, err := slicesClient.Create(context.TODO(), makeSlice(fmt.Sprintf("svc-moved-%d", i), i), metaV1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := slicesClient.Update(context.TODO(), makeSlice(fmt.Sprintf("svc-%d", i), -1), metaV1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := slicesClient.Delete(context.TODO(), fmt.Sprintf("svc-%d", i), metaV1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		retry.UntilSuccessOrFail(t, func() error {
+			if _, exists, _ := esc.informer.GetIndexer().GetByKey(ns + "/" + fmt.Sprintf("svc-%d", i)); exists {
+				return fmt.Errorf("slice svc-%d not deleted", i)
+			}
+			return assertEndpoints()
+		}, retry.Timeout(time.Second*10))
+	}
+	retry.UntilSuccessOrFail(t, assertEndpoints, retry.Timeout(time.Second*10))
+}
+
+func TestEndpointSliceNodeChange(t *testing.T) {
+	const ns = "nsa"
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+
+	addNodes(t, controller,
+		generateNode("node1", map[string]string{NodeRegionLabelGA: "region1", NodeZoneLabelGA: "zone1"}),
+		generateNode("node2", map[string]string{NodeRegionLabelGA: "region1", NodeZoneLabelGA: "zone2"}))
+	// The pod is not updated when the endpoint moves, as when the pod cache has not yet seen the recreated pod.
+	pod := generatePod("128.0.0.1", "pod", ns, "sa", "node1", map[string]string{"app": "test"}, nil)
+	addPods(t, controller, fx, pod)
+	createService(controller, "svc", ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+	hostname := kube.ServiceHostname("svc", ns, controller.opts.DomainSuffix)
+	retry.UntilSuccessOrFail(t, func() error {
+		if controller.GetService(hostname) == nil {
+			return fmt.Errorf("service not found")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	portName, portNum := "tcp-port", int32(8080)
+	node := "node1"
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "svc",
+			Namespace: ns,
+			Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+		},
+		Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+		Endpoints: []discovery.Endpoint{{
+			Addresses: []string{pod.Status.PodIP},
+			TargetRef: &coreV1.ObjectReference{Kind: "Pod", Namespace: ns, Name: pod.Name},
+			NodeName:  &node,
+		}},
+	}
+	slicesClient := controller.client.DiscoveryV1().EndpointSlices(ns)
+	if _, err := slicesClient.Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectLocality := func(want string) {
+		t.Helper()
+		for {
+			ev := fx.Wait("eds")
+			if ev == nil {
+				t.Fatalf("timed out waiting for an EDS update with locality %q", want)
+			}
+			if ev.ID == string(hostname) && len(ev.Endpoints) == 1 && ev.Endpoints[0].Locality.Label == want {
+				break
+			}
+		}
+		instances := controller.InstancesByPort(controller.GetService(hostname), 8080, labels.Collection{})
+		if len(instances) != 1 || instances[0].Endpoint.Locality.Label != want {
+			t.Fatalf("expected a single instance with locality %q, got %v", want, instances)
+		}
+	}
+	expectLocality("region1/zone1/")
+
+	// The pod is recreated on another node, in another zone, with the same name and IP.
+	node = "node2"
+	if _, err := slicesClient.Update(context.TODO(), slice, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectLocality("region1/zone2/")
+
+	// The locality follows the endpoint back.
+	node = "node1"
+	if _, err := slicesClient.Update(context.TODO(), slice, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectLocality("region1/zone1/")
+}
+
+func TestEndpointSlicePodDeletionCost(t *testing.T) {
+	const ns = "nsa"
+	defer func(enabled bool) {
+		features.PodDeletionCostWeighting = enabled
+	}(features.PodDeletionCostWeighting)
+	features.PodDeletionCostWeighting = true
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+
+	pods := []*coreV1.Pod{
+		generatePod("128.0.0.1", "pod1", ns, "sa", "node1", map[string]string{"app": "test"}, nil),
+		generatePod("128.0.0.2", "pod2", ns, "sa", "node1", map[string]string{"app": "test"}, nil),
+	}
+	addPods(t, controller, fx, pods...)
+	createService(controller, "svc", ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+	hostname := kube.ServiceHostname("svc", ns, controller.opts.DomainSuffix)
+	retry.UntilSuccessOrFail(t, func() error {
+		if controller.GetService(hostname) == nil {
+			return fmt.Errorf("service not found")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	portName, portNum := "tcp-port", int32(8080)
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "svc",
+			Namespace: ns,
+			Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+		},
+		Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+	}
+	for _, pod := range pods {
+		slice.Endpoints = append(slice.Endpoints, discovery.Endpoint{
+			Addresses: []string{pod.Status.PodIP},
+			TargetRef: &coreV1.ObjectReference{Kind: "Pod", Namespace: ns, Name: pod.Name},
+		})
+	}
+	if _, err := controller.client.DiscoveryV1().EndpointSlices(ns).Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// expectWeights waits for the endpoints of the pods to have the given weights, keyed by address.
+	expectWeights := func(want map[string]uint32) {
+		t.Helper()
+		weights := func(endpoints []*model.IstioEndpoint) map[string]uint32 {
+			out := map[string]uint32{}
+			for _, ep := range endpoints {
+				out[ep.Address] = ep.GetLoadBalancingWeight()
+			}
+			return out
+		}
+		for {
+			ev := fx.Wait("eds")
+			if ev == nil {
+				t.Fatalf("timed out waiting for an EDS update with weights %v", want)
+			}
+			if ev.ID == string(hostname) && reflect.DeepEqual(weights(ev.Endpoints), want) {
+				break
+			}
+		}
+		var endpoints []*model.IstioEndpoint
+		for _, instance := range controller.InstancesByPort(controller.GetService(hostname), 8080, labels.Collection{}) {
+			endpoints = append(endpoints, instance.Endpoint)
+		}
+		if got := weights(endpoints); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected instances with weights %v, got %v", want, got)
+		}
+	}
+	expectWeights(map[string]uint32{"128.0.0.1": podEndpointWeight, "128.0.0.2": podEndpointWeight})
+
+	setDeletionCost := func(cost string) {
+		t.Helper()
+		pod, err := controller.client.CoreV1().Pods(ns).Get(context.TODO(), "pod2", metaV1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pod.Annotations = map[string]string{}
+		if cost != "" {
+			pod.Annotations[podDeletionCostAnnotation] = cost
+		}
+		if _, err := controller.client.CoreV1().Pods(ns).Update(context.TODO(), pod, metaV1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pod is about to be removed, so it is deprioritized.
+	setDeletionCost("-100")
+	expectWeights(map[string]uint32{"128.0.0.1": podEndpointWeight, "128.0.0.2": drainingPodEndpointWeight})
+
+	// The weight is restored once the annotation is removed.
+	setDeletionCost("")
+	expectWeights(map[string]uint32{"128.0.0.1": podEndpointWeight, "128.0.0.2": podEndpointWeight})
+
+	// Pods with a positive deletion cost are removed last, so they keep their weight.
+	setDeletionCost("100")
+	setDeletionCost("-1")
+	expectWeights(map[string]uint32{"128.0.0.1": podEndpointWeight, "128.0.0.2": drainingPodEndpointWeight})
+}
+
+func TestEndpointAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		valid   bool
+	}{
+		{"ipv4", "10.0.0.1", "10.0.0.1", true},
+		{"ipv6", "2001:db8::1", "2001:db8::1", true},
+		{"ipv4-mapped ipv6", "::ffff:10.0.0.1", "10.0.0.1", true},
+		{"hostname", "foo.example.com", "foo.example.com", true},
+		{"ipv4 link-local", "169.254.1.1", "", false},
+		{"ipv4-mapped link-local", "::ffff:169.254.1.1", "", false},
+		{"ipv6 link-local", "fe80::1", "", false},
+		{"ipv4 unspecified", "0.0.0.0", "", false},
+		{"ipv6 unspecified", "::", "", false},
+		{"ipv4 multicast", "224.0.0.1", "", false},
+		{"ipv6 multicast", "ff02::1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, valid := endpointAddress(tt.address)
+			if got != tt.want || valid != tt.valid {
+				t.Errorf("got %q, %v, want %q, %v", got, valid, tt.want, tt.valid)
+			}
+		})
+	}
+}
+
+func TestEndpointSliceInvalidAddresses(t *testing.T) {
+	const ns = "nsa"
+	controller, _ := NewFakeControllerWithOptions(FakeControllerOptions{Mode: EndpointSliceOnly})
+	defer controller.Stop()
+	createService(controller, "svc", ns, nil, []int32{8080}, map[string]string{"app": "test"}, t)
+	hostname := kube.ServiceHostname("svc", ns, controller.opts.DomainSuffix)
+	retry.UntilSuccessOrFail(t, func() error {
+		if controller.GetService(hostname) == nil {
+			return fmt.Errorf("service not found")
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	portName, portNum := "tcp-port", int32(8080)
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "svc",
+			Namespace: ns,
+			Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+		},
+		Ports: []discovery.EndpointPort{{Name: &portName, Port: &portNum}},
+		Endpoints: []discovery.Endpoint{
+			{Addresses: []string{"10.0.0.1"}},
+			{Addresses: []string{"::ffff:10.0.0.2"}},
+			{Addresses: []string{"169.254.0.1"}},
+			{Addresses: []string{"0.0.0.0"}},
+			{Addresses: []string{"224.0.0.1"}},
+		},
+	}
+	if _, err := controller.client.DiscoveryV1().EndpointSlices(ns).Create(context.TODO(), slice, metaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	esc := controller.endpoints.(*endpointSliceController)
+	want := []string{"10.0.0.1", "10.0.0.2"}
+	retry.UntilSuccessOrFail(t, func() error {
+		var got []string
+		for _, ep := range esc.endpointCache.Get(hostname) {
+			got = append(got, ep.Address)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("got endpoints %v, want %v", got, want)
+		}
+		var instances []string
+		for _, i := range controller.InstancesByPort(controller.GetService(hostname), 8080, labels.Collection{}) {
+			instances = append(instances, i.Endpoint.Address)
+		}
+		sort.Strings(instances)
+		if !reflect.DeepEqual(instances, want) {
+			return fmt.Errorf("got instances %v, want %v", instances, want)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
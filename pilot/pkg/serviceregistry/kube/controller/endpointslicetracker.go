@@ -0,0 +1,389 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"istio.io/pkg/monitoring"
+)
+
+const (
+	// orphanedSliceInitialBackoff is the delay before an orphaned EndpointSlice is processed again
+	orphanedSliceInitialBackoff = time.Second
+	// orphanedSliceMaxBackoff caps the delay between processing of an orphaned EndpointSlice
+	orphanedSliceMaxBackoff = 10 * time.Minute
+	// endpointChurnWindow is the period over which the endpoint churn of Services is measured
+	endpointChurnWindow = time.Minute
+	// endpointChurnTopK bounds the number of Services reported by pilot_k8s_service_endpoint_churn
+	endpointChurnTopK = 10
+)
+
+var (
+	orphanedEndpointSlices = monitoring.NewGauge(
+		"pilot_k8s_endpoint_slices_orphaned",
+		"Number of EndpointSlices referencing a Service that does not exist.",
+	)
+
+	servicesWithoutEndpointSlices = monitoring.NewGauge(
+		"pilot_k8s_services_without_endpoint_slices",
+		"Number of Services with a selector that have had no EndpointSlices for longer than "+
+			"PILOT_SERVICE_WITHOUT_ENDPOINT_SLICES_THRESHOLD.",
+	)
+
+	servicesWithoutReadyEndpoints = monitoring.NewGauge(
+		"pilot_k8s_services_without_ready_endpoints",
+		"Number of Services that had ready endpoints, and have had none for longer than "+
+			"PILOT_SERVICE_NO_READY_ENDPOINTS_DEBOUNCE.",
+	)
+
+	transitionTag = monitoring.MustCreateLabel("transition")
+
+	serviceReadyEndpointsTransitions = monitoring.NewSum(
+		"pilot_k8s_service_ready_endpoints_transitions",
+		"Number of times a Service transitioned to no ready endpoints, or back to having ready endpoints.",
+		monitoring.WithLabels(transitionTag),
+	)
+
+	serviceTag = monitoring.MustCreateLabel("service")
+
+	endpointChurnEvents = monitoring.NewSum(
+		"pilot_k8s_endpoint_churn_events",
+		"Total number of ready endpoints added to or removed from Services.",
+	)
+
+	// serviceEndpointChurn is only reported for the Services with the most churn, to bound the number of series.
+	// A Service with a sustained high value usually has crashlooping backends, and is worth alerting on.
+	serviceEndpointChurn = monitoring.NewGauge(
+		"pilot_k8s_service_endpoint_churn",
+		"Number of ready endpoints added to or removed from a Service during the last minute, for the 10 Services with "+
+			"the most churn. A sustained high value usually indicates crashlooping backends.",
+		monitoring.WithLabels(serviceTag),
+	)
+)
+
+const (
+	// noReadyEndpoints is the transition of a Service to having no ready endpoints
+	noReadyEndpoints = "no_ready_endpoints"
+	// readyEndpointsRestored is the transition of a Service back to having ready endpoints
+	readyEndpointsRestored = "ready_endpoints_restored"
+)
+
+func init() {
+	monitoring.MustRegister(orphanedEndpointSlices)
+	monitoring.MustRegister(servicesWithoutEndpointSlices)
+	monitoring.MustRegister(servicesWithoutReadyEndpoints)
+	monitoring.MustRegister(serviceReadyEndpointsTransitions)
+	monitoring.MustRegister(endpointChurnEvents)
+	monitoring.MustRegister(serviceEndpointChurn)
+}
+
+// orphanedSlice tracks an EndpointSlice whose kubernetes.io/service-name label points at a Service that does not exist.
+type orphanedSlice struct {
+	service     types.NamespacedName
+	attempts    int
+	nextAttempt time.Time
+}
+
+// serviceReadiness is the ready endpoints state of a Service.
+type serviceReadiness struct {
+	// ready is the last reported state
+	ready bool
+	// changedSince records when the Service was first seen in the opposite state of the reported one. It is
+	// zero if the Service is in the reported state.
+	changedSince time.Time
+}
+
+// endpointSliceTracker keeps track of inconsistencies between EndpointSlices and Services. Orphaned slices are
+// reprocessed with an exponential backoff rather than on every resync, and Services that have had no slices
+// for longer than a threshold are reported. It also reports Services transitioning to and from having no
+// ready endpoints, and the Services whose ready endpoints churn the most.
+type endpointSliceTracker struct {
+	mu sync.Mutex
+	// orphans is keyed by the EndpointSlice name
+	orphans map[types.NamespacedName]*orphanedSlice
+	// emptySince records when a Service was first seen without any EndpointSlices
+	emptySince map[types.NamespacedName]time.Time
+	// emptyThreshold is how long a Service may have no EndpointSlices before being reported
+	emptyThreshold time.Duration
+	// readiness is keyed by the Service name. Services are only tracked once they have had ready endpoints.
+	readiness map[types.NamespacedName]*serviceReadiness
+	// readinessDebounce is how long a Service must stay in a new ready endpoints state before it is reported
+	readinessDebounce time.Duration
+	// onReadinessChange is called, without holding the lock, for each reported ready endpoints transition
+	onReadinessChange func(svc types.NamespacedName, ready bool)
+	// churn counts the ready endpoints added and removed for each Service since churnWindowStart
+	churn            map[types.NamespacedName]int
+	churnWindowStart time.Time
+	// churnReported holds the Services currently reported by the churn gauge
+	churnReported map[types.NamespacedName]struct{}
+	// now returns the current time; overridden in tests
+	now func() time.Time
+}
+
+func newEndpointSliceTracker(emptyThreshold, readinessDebounce time.Duration) *endpointSliceTracker {
+	return &endpointSliceTracker{
+		orphans:           map[types.NamespacedName]*orphanedSlice{},
+		emptySince:        map[types.NamespacedName]time.Time{},
+		emptyThreshold:    emptyThreshold,
+		readiness:         map[types.NamespacedName]*serviceReadiness{},
+		readinessDebounce: readinessDebounce,
+		churn:             map[types.NamespacedName]int{},
+		churnWindowStart:  time.Now(),
+		churnReported:     map[types.NamespacedName]struct{}{},
+		now:               time.Now,
+	}
+}
+
+// shouldProcessOrphan records that the slice references a Service that does not exist, and returns whether
+// the slice should be processed now. The first occurrence is always processed; after that, processing is
+// delayed with an exponential backoff.
+func (t *endpointSliceTracker) shouldProcessOrphan(slice, svc types.NamespacedName) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	o, f := t.orphans[slice]
+	if !f {
+		log.Warnf("EndpointSlice %v references Service %v, which does not exist", slice, svc)
+		o = &orphanedSlice{}
+		t.orphans[slice] = o
+		orphanedEndpointSlices.Record(float64(len(t.orphans)))
+	} else if now.Before(o.nextAttempt) {
+		return false
+	}
+	o.service = svc
+	backoff := orphanedSliceInitialBackoff << o.attempts
+	if o.attempts >= 20 || backoff > orphanedSliceMaxBackoff {
+		backoff = orphanedSliceMaxBackoff
+	}
+	o.attempts++
+	o.nextAttempt = now.Add(backoff)
+	return true
+}
+
+// sliceResolved forgets a slice, either because it was deleted or because its Service now exists.
+func (t *endpointSliceTracker) sliceResolved(slice types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, f := t.orphans[slice]; !f {
+		return
+	}
+	delete(t.orphans, slice)
+	orphanedEndpointSlices.Record(float64(len(t.orphans)))
+}
+
+// serviceAdded forgets all slices orphaned by the Service, and returns them so they can be reprocessed.
+func (t *endpointSliceTracker) serviceAdded(svc types.NamespacedName) []types.NamespacedName {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var slices []types.NamespacedName
+	for slice, o := range t.orphans {
+		if o.service == svc {
+			slices = append(slices, slice)
+			delete(t.orphans, slice)
+		}
+	}
+	if len(slices) > 0 {
+		orphanedEndpointSlices.Record(float64(len(t.orphans)))
+	}
+	return slices
+}
+
+// updateService records whether the Service currently has any EndpointSlices.
+func (t *endpointSliceTracker) updateService(svc types.NamespacedName, hasSlices bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if hasSlices {
+		delete(t.emptySince, svc)
+	} else if _, f := t.emptySince[svc]; !f {
+		t.emptySince[svc] = t.now()
+	}
+	t.recordServicesWithoutSlicesLocked()
+}
+
+// serviceDeleted stops tracking the Service.
+func (t *endpointSliceTracker) serviceDeleted(svc types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.emptySince, svc)
+	t.recordServicesWithoutSlicesLocked()
+	delete(t.readiness, svc)
+	t.recordServicesWithoutReadyEndpointsLocked()
+	// A reported Service is reset at the end of the window
+	delete(t.churn, svc)
+}
+
+// updateReadiness records whether the Service currently has ready endpoints. A transition is only reported once
+// the Service has stayed in the new state for the debounce period, so endpoints briefly dropping to zero during
+// a rollout are not reported.
+func (t *endpointSliceTracker) updateReadiness(svc types.NamespacedName, ready bool) {
+	t.mu.Lock()
+	r, f := t.readiness[svc]
+	switch {
+	case !f:
+		// Services which never had ready endpoints, such as newly created ones, are not reported
+		if ready {
+			t.readiness[svc] = &serviceReadiness{ready: true}
+		}
+	case r.ready == ready:
+		// Back to the reported state before the debounce period elapsed
+		r.changedSince = time.Time{}
+	case r.changedSince.IsZero():
+		r.changedSince = t.now()
+	}
+	changed := t.evaluateReadinessLocked()
+	t.mu.Unlock()
+	t.reportReadiness(changed)
+}
+
+// evaluateReadinessLocked commits the transitions of the Services which have been in a new state for the debounce
+// period, and returns the Services which transitioned.
+func (t *endpointSliceTracker) evaluateReadinessLocked() map[types.NamespacedName]bool {
+	now := t.now()
+	var changed map[types.NamespacedName]bool
+	for svc, r := range t.readiness {
+		if r.changedSince.IsZero() || now.Sub(r.changedSince) < t.readinessDebounce {
+			continue
+		}
+		r.ready = !r.ready
+		r.changedSince = time.Time{}
+		if changed == nil {
+			changed = map[types.NamespacedName]bool{}
+		}
+		changed[svc] = r.ready
+	}
+	if len(changed) > 0 {
+		t.recordServicesWithoutReadyEndpointsLocked()
+	}
+	return changed
+}
+
+func (t *endpointSliceTracker) recordServicesWithoutReadyEndpointsLocked() {
+	count := 0
+	for _, r := range t.readiness {
+		if !r.ready {
+			count++
+		}
+	}
+	servicesWithoutReadyEndpoints.Record(float64(count))
+}
+
+func (t *endpointSliceTracker) reportReadiness(changed map[types.NamespacedName]bool) {
+	for svc, ready := range changed {
+		if ready {
+			log.Infof("Service %v has ready endpoints again", svc)
+			serviceReadyEndpointsTransitions.With(transitionTag.Value(readyEndpointsRestored)).Increment()
+		} else {
+			log.Warnf("Service %v has no ready endpoints", svc)
+			serviceReadyEndpointsTransitions.With(transitionTag.Value(noReadyEndpoints)).Increment()
+		}
+		if t.onReadinessChange != nil {
+			t.onReadinessChange(svc, ready)
+		}
+	}
+}
+
+// recordChurn records the number of ready endpoints added to and removed from the Service.
+func (t *endpointSliceTracker) recordChurn(svc types.NamespacedName, changes int) {
+	if changes == 0 {
+		return
+	}
+	endpointChurnEvents.Record(float64(changes))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reportChurnLocked()
+	t.churn[svc] += changes
+}
+
+// reportChurnLocked reports the churn of the Services with the most churn once the window has elapsed, and starts
+// a new window. Services which are no longer among them are reset to 0.
+func (t *endpointSliceTracker) reportChurnLocked() {
+	now := t.now()
+	if now.Sub(t.churnWindowStart) < endpointChurnWindow {
+		return
+	}
+	services := make([]types.NamespacedName, 0, len(t.churn))
+	for svc := range t.churn {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if t.churn[services[i]] != t.churn[services[j]] {
+			return t.churn[services[i]] > t.churn[services[j]]
+		}
+		return services[i].String() < services[j].String()
+	})
+	if len(services) > endpointChurnTopK {
+		services = services[:endpointChurnTopK]
+	}
+	reported := make(map[types.NamespacedName]struct{}, len(services))
+	for _, svc := range services {
+		reported[svc] = struct{}{}
+		serviceEndpointChurn.With(serviceTag.Value(svc.String())).Record(float64(t.churn[svc]))
+	}
+	for svc := range t.churnReported {
+		if _, f := reported[svc]; !f {
+			serviceEndpointChurn.With(serviceTag.Value(svc.String())).Record(0)
+		}
+	}
+	t.churnReported = reported
+	t.churn = map[types.NamespacedName]int{}
+	t.churnWindowStart = now
+}
+
+func (t *endpointSliceTracker) recordServicesWithoutSlicesLocked() {
+	now := t.now()
+	count := 0
+	for _, since := range t.emptySince {
+		if now.Sub(since) >= t.emptyThreshold {
+			count++
+		}
+	}
+	servicesWithoutEndpointSlices.Record(float64(count))
+}
+
+// run periodically re-evaluates the Services without EndpointSlices, the ready endpoints transitions and the
+// endpoint churn, as a Service crossing the threshold, the debounce period or the churn window does not generate
+// any event.
+func (t *endpointSliceTracker) run(stop <-chan struct{}) {
+	interval := t.emptyThreshold / 2
+	if t.readinessDebounce > 0 && t.readinessDebounce/2 < interval {
+		interval = t.readinessDebounce / 2
+	}
+	if endpointChurnWindow/2 < interval {
+		interval = endpointChurnWindow / 2
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			t.recordServicesWithoutSlicesLocked()
+			t.reportChurnLocked()
+			changed := t.evaluateReadinessLocked()
+			t.mu.Unlock()
+			t.reportReadiness(changed)
+		}
+	}
+}
@@ -147,6 +147,7 @@ type FakeControllerOptions struct {
 	ClusterID                 cluster.ID
 	WatchedNamespaces         string
 	DomainSuffix              string
+	SystemNamespace           string
 	XDSUpdater                model.XDSUpdater
 	DiscoveryNamespacesFilter filter.DiscoveryNamespacesFilter
 
@@ -180,6 +181,7 @@ func NewFakeControllerWithOptions(opts FakeControllerOptions) (*FakeController,
 
 	options := Options{
 		DomainSuffix:              domainSuffix,
+		SystemNamespace:           opts.SystemNamespace,
 		XDSUpdater:                xdsUpdater,
 		Metrics:                   &model.Environment{},
 		NetworksWatcher:           opts.NetworksWatcher,
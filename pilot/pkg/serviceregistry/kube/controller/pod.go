@@ -21,6 +21,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller/filter"
@@ -46,6 +47,10 @@ type PodCache struct {
 	needResync         map[string]sets.Set
 	queueEndpointEvent func(string)
 
+	// weights stores the load balancing weight of the endpoints of each pod in the cache, keyed by pod key, to
+	// detect changes of the deletion cost of pods. Only used if PodDeletionCostWeighting is enabled.
+	weights map[string]uint32
+
 	c *Controller
 }
 
@@ -57,6 +62,7 @@ func newPodCache(c *Controller, informer filter.FilteredSharedIndexInformer, que
 		IPByPods:           make(map[string]string),
 		needResync:         make(map[string]sets.Set),
 		queueEndpointEvent: queueEndpointEvent,
+		weights:            make(map[string]uint32),
 	}
 
 	return out
@@ -144,6 +150,7 @@ func (pc *PodCache) onEvent(curr interface{}, ev model.Event) error {
 				if key != pc.podsByIP[ip] {
 					pc.update(ip, key)
 				}
+				pc.updateWeight(key, pod)
 			} else {
 				return nil
 			}
@@ -158,6 +165,7 @@ func (pc *PodCache) onEvent(curr interface{}, ev model.Event) error {
 				if key != pc.podsByIP[ip] {
 					pc.update(ip, key)
 				}
+				pc.updateWeight(key, pod)
 			} else {
 				return nil
 			}
@@ -203,6 +211,7 @@ func (pc *PodCache) deleteIP(ip string) {
 	pod := pc.podsByIP[ip]
 	delete(pc.podsByIP, ip)
 	delete(pc.IPByPods, pod)
+	delete(pc.weights, pod)
 }
 
 func (pc *PodCache) update(ip, key string) {
@@ -224,6 +233,23 @@ func (pc *PodCache) update(ip, key string) {
 	pc.proxyUpdates(ip)
 }
 
+// updateWeight records the load balancing weight of the endpoints of the pod, and rebuilds the endpoints of its
+// Services if it changed, as the endpoints are otherwise only rebuilt on changes of the Services and their endpoints.
+func (pc *PodCache) updateWeight(key string, pod *v1.Pod) {
+	if !features.PodDeletionCostWeighting {
+		return
+	}
+	weight := podLoadBalancingWeight(pod)
+	previous, f := pc.weights[key]
+	pc.weights[key] = weight
+	if f && previous != weight && pc.c != nil {
+		pc.c.queue.Push(func() error {
+			pc.c.updateEDSForPod(pod)
+			return nil
+		})
+	}
+}
+
 // queueEndpointEventOnPodArrival registers this endpoint and queues endpoint event
 // when the corresponding pod arrives.
 func (pc *PodCache) queueEndpointEventOnPodArrival(key, ip string) {
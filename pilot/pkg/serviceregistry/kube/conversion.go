@@ -43,6 +43,19 @@ const (
 	// It is used for multi-cluster scenario, and with nodePort type gateway service.
 	// TODO: move to API
 	NodeSelectorAnnotation = "traffic.istio.io/nodeSelector"
+
+	// IgnoreReadinessGatesAnnotation can be set to "true" on a Service to treat its endpoints as ready when
+	// the backing pod's containers are ready and it is only failing custom readiness gates (spec.readinessGates).
+	// This is intended for migrations, such as a VM-to-pod cutover, where a readiness gate is controlled
+	// externally but mesh traffic should already be sent to the pod. Use with care: the pod receives mesh
+	// traffic while Kubernetes considers it not ready, and the readiness gate no longer protects it.
+	IgnoreReadinessGatesAnnotation = "traffic.istio.io/ignoreReadinessGates"
+
+	// EndpointExclusionsAnnotation can be set on the system namespace to a comma separated list of namespaces, and
+	// of Services in the namespace/name format, whose EndpointSlices are not processed. This saves the memory used
+	// to track the endpoints of workloads that never take part in the mesh, such as kube-system components. Unlike
+	// discovery selectors, the Services are still discovered; only their endpoints are skipped.
+	EndpointExclusionsAnnotation = "traffic.istio.io/endpointExclusions"
 )
 
 func convertPort(port coreV1.ServicePort) *model.Port {
@@ -159,22 +159,28 @@ func (s *ServiceEntryStore) workloadEntryHandler(old, curr config.Config, event
 		namespace: curr.Namespace,
 	}
 
-	// If an entry is unhealthy, we will mark this as a delete instead
-	// This ensures we do not track unhealthy endpoints
-	if features.WorkloadEntryHealthChecks && !isHealthy(curr) {
-		event = model.EventDelete
-	}
+	healthy := !features.WorkloadEntryHealthChecks || isHealthy(curr)
 
-	// fire off the k8s handlers
+	// fire off the k8s handlers. These receive unhealthy entries as well, with the health reported in
+	// the endpoint, so that they can be treated the same as not ready endpoints from EndpointSlices.
 	if len(s.workloadHandlers) > 0 {
 		wi := s.convertWorkloadEntryToWorkloadInstance(curr, s.Cluster())
 		if wi != nil {
+			if !healthy {
+				wi.Endpoint.HealthStatus = model.UnHealthy
+			}
 			for _, h := range s.workloadHandlers {
 				h(wi, event)
 			}
 		}
 	}
 
+	// If an entry is unhealthy, we will mark this as a delete instead
+	// This ensures we do not track unhealthy endpoints
+	if !healthy {
+		event = model.EventDelete
+	}
+
 	s.storeMutex.RLock()
 	// We will only select entries in the same namespace
 	entries := s.seWithSelectorByNamespace[curr.Namespace]
@@ -711,6 +717,10 @@ func (s *ServiceEntryStore) maybeRefreshIndexes() {
 	}
 
 	for _, wcfg := range wles {
+		if features.WorkloadEntryHealthChecks && !isHealthy(wcfg) {
+			// Unhealthy entries are not tracked, consistent with workloadEntryHandler
+			continue
+		}
 		wle := wcfg.Spec.(*networking.WorkloadEntry)
 		key := configKey{
 			kind:      workloadEntryConfigType,
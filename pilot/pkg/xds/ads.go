@@ -352,6 +352,9 @@ func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.Disc
 		errCode := codes.Code(request.ErrorDetail.Code)
 		log.Warnf("ADS:%s: ACK ERROR %s %s:%s", stype, con.ConID, errCode.String(), request.ErrorDetail.GetMessage())
 		incrementXDSRejects(request.TypeUrl, con.proxy.ID, errCode.String())
+		if con.proxy.IsProxylessGrpc() {
+			recordGrpcXDSNack(request.TypeUrl, con.proxy, request.ErrorDetail.GetMessage())
+		}
 		if s.StatusGen != nil {
 			s.StatusGen.OnNack(con.proxy, request)
 		}
@@ -419,6 +422,9 @@ func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.Disc
 	con.proxy.WatchedResources[request.TypeUrl].ResourceNames = request.ResourceNames
 	con.proxy.WatchedResources[request.TypeUrl].LastRequest = request
 	con.proxy.Unlock()
+	if con.proxy.IsProxylessGrpc() {
+		recordGrpcXDSAck(request.TypeUrl, con.proxy)
+	}
 
 	// Envoy can send two DiscoveryRequests with same version and nonce
 	// when it detects a new resource. We should respond if they change.
@@ -665,7 +671,7 @@ func (s *DiscoveryServer) computeProxyState(proxy *model.Proxy, request *model.P
 				sidecar = true
 			case gvk.Gateway, gvk.KubernetesGateway, gvk.GatewayClass:
 				gateway = true
-			case gvk.Ingress:
+			case gvk.Ingress, gvk.ReferencePolicy:
 				sidecar = true
 				gateway = true
 			}
@@ -906,6 +912,9 @@ func (s *DiscoveryServer) addCon(conID string, con *Connection) {
 	defer s.adsClientsMutex.Unlock()
 	s.adsClients[conID] = con
 	recordXDSClients(con.proxy.Metadata.IstioVersion, 1)
+	if con.proxy.TracingDisabledByAnnotation() {
+		recordTracingDisabledClients(1)
+	}
 }
 
 func (s *DiscoveryServer) removeCon(conID string) {
@@ -918,6 +927,9 @@ func (s *DiscoveryServer) removeCon(conID string) {
 	} else {
 		delete(s.adsClients, conID)
 		recordXDSClients(con.proxy.Metadata.IstioVersion, -1)
+		if con.proxy.TracingDisabledByAnnotation() {
+			recordTracingDisabledClients(-1)
+		}
 	}
 }
 
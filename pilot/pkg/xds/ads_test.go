@@ -21,6 +21,7 @@ import (
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"go.opencensus.io/stats/view"
 	"google.golang.org/genproto/googleapis/rpc/status"
 
 	networking "istio.io/api/networking/v1alpha3"
@@ -1020,3 +1021,77 @@ func TestEdsCache(t *testing.T) {
 	assertEndpoints(ads)
 	t.Logf("endpoints: %+v", ads.GetEndpoints())
 }
+
+func TestProxylessGrpcNack(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		ConfigString: `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  resolution: STATIC
+  endpoints:
+  - address: 1.2.3.4
+`,
+	})
+	const cluster = "outbound|7070||echo.default.svc.cluster.local"
+	const id = "grpc-nack.default"
+	meta := model.NodeMetadata{Generator: "grpc", Namespace: "default"}
+	nodeID := "sidecar~1.1.1.1~" + id + "~default.svc.cluster.local"
+	ads := s.ConnectADS().WithID(nodeID).WithMetadata(meta).WithType(v3.ClusterType)
+	node := &core.Node{
+		Id:                   nodeID,
+		Metadata:             meta.ToStruct(),
+		UserAgentName:        "gRPC Go",
+		UserAgentVersionType: &core.Node_UserAgentVersion{UserAgentVersion: "1.44.0"},
+	}
+	ads.RequestResponseAck(t, &discovery.DiscoveryRequest{Node: node, ResourceNames: []string{cluster}})
+	expectGrpcResponses(t, id, "ack", 1)
+
+	// The client rejects the next push
+	xds.AdsPushAll(s.Discovery)
+	res := ads.ExpectResponse(t)
+	ads.Request(t, &discovery.DiscoveryRequest{
+		Node:          node,
+		ResourceNames: []string{cluster},
+		ResponseNonce: res.Nonce,
+		ErrorDetail:   &status.Status{Message: "invalid route configuration"},
+	})
+	expectGrpcResponses(t, id, "nack", 1)
+}
+
+// expectGrpcResponses waits for the responses of the gRPC client with the given result to be counted.
+func expectGrpcResponses(t *testing.T, node string, result string, expected float64) {
+	t.Helper()
+	retry.UntilSuccessOrFail(t, func() error {
+		data, err := view.RetrieveData("pilot_xds_grpc_responses")
+		if err != nil {
+			return err
+		}
+		for _, row := range data {
+			tags := map[string]string{}
+			for _, tag := range row.Tags {
+				tags[tag.Key.Name()] = tag.Value
+			}
+			if tags["node"] != node || tags["result"] != result {
+				continue
+			}
+			if tags["client_version"] != "gRPC Go/1.44.0" {
+				return fmt.Errorf("unexpected client version %q", tags["client_version"])
+			}
+			if got := row.Data.(*view.SumData).Value; got != expected {
+				return fmt.Errorf("expected %v %s responses, got %v", expected, result, got)
+			}
+			return nil
+		}
+		return fmt.Errorf("no %s responses recorded for %s", result, node)
+	}, retry.Timeout(time.Second*5))
+}
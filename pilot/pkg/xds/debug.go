@@ -190,8 +190,9 @@ func (s *DiscoveryServer) AddDebugHandlers(mux, internalMux *http.ServeMux, enab
 	s.addDebugHandler(mux, internalMux, "/debug/instancesz", "Debug support for service instances", s.instancesz)
 
 	s.addDebugHandler(mux, internalMux, "/debug/authorizationz", "Internal authorization policies", s.authorizationz)
-	s.addDebugHandler(mux, internalMux, "/debug/telemetryz", "Debug Telemetry configuration", s.telemetryz)
+	s.addDebugHandler(mux, internalMux, "/debug/telemetryz", "Debug Telemetry configuration, or its summary for the passed in proxyID", s.telemetryz)
 	s.addDebugHandler(mux, internalMux, "/debug/config_dump", "ConfigDump in the form of the Envoy admin config dump API for passed in proxyID", s.ConfigDump)
+	s.addDebugHandler(mux, internalMux, "/debug/grpcxdsz", "xDS resources generated for the passed in proxyless gRPC proxyID", s.GrpcXdsz)
 	s.addDebugHandler(mux, internalMux, "/debug/push_status", "Last PushContext Details", s.pushStatusHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/pushcontext", "Debug support for current push context", s.pushContextHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/connections", "Info about the connected XDS clients", s.connectionsHandler)
@@ -500,8 +501,24 @@ func (s *DiscoveryServer) authorizationz(w http.ResponseWriter, req *http.Reques
 	writeJSON(w, info)
 }
 
+// telemetryz dumps the Telemetry configuration. If a proxyID is passed, the summary of the telemetry
+// configuration of the proxy is returned instead.
 func (s *DiscoveryServer) telemetryz(w http.ResponseWriter, req *http.Request) {
-	writeJSON(w, s.globalPushContext().Telemetry)
+	proxyID, con := s.getDebugConnection(req)
+	if proxyID == "" {
+		writeJSON(w, s.globalPushContext().Telemetry)
+		return
+	}
+	if con == nil {
+		s.errorHandler(w, proxyID, con)
+		return
+	}
+	push := s.globalPushContext()
+	if push.Telemetry == nil {
+		writeJSON(w, &model.TelemetrySummary{})
+		return
+	}
+	writeJSON(w, push.Telemetry.Summary(con.proxy))
 }
 
 // connectionsHandler implements interface for displaying current connections.
@@ -587,6 +604,51 @@ func (s *DiscoveryServer) ConfigDump(w http.ResponseWriter, req *http.Request) {
 	writeJSON(w, dump)
 }
 
+// GrpcXdsz returns the xDS resources generated for the specified proxyless gRPC client, keyed by type and resource
+// name. Only the resources the client is currently watching are generated, so the result matches what the client
+// receives. This is the equivalent of ConfigDump for clients that do not expose their own xDS state.
+func (s *DiscoveryServer) GrpcXdsz(w http.ResponseWriter, req *http.Request) {
+	proxyID, con := s.getDebugConnection(req)
+	if con == nil {
+		s.errorHandler(w, proxyID, con)
+		return
+	}
+	if con.proxy.Metadata.Generator != "grpc" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Proxy %s is not a proxyless gRPC client\n", con.proxy.ID)
+		return
+	}
+	dump, err := s.grpcXdsDump(con)
+	if err != nil {
+		handleHTTPError(w, err)
+		return
+	}
+	writeJSON(w, dump)
+}
+
+// grpcXdsDump generates the resources watched by a proxyless gRPC client, outside of its ADS stream.
+func (s *DiscoveryServer) grpcXdsDump(conn *Connection) (map[string]map[string]jsonMarshalProto, error) {
+	push := s.globalPushContext()
+	req := &model.PushRequest{Full: true, Push: push, Start: time.Now()}
+	dump := map[string]map[string]jsonMarshalProto{}
+	for _, typeURL := range []string{v3.ListenerType, v3.RouteType, v3.ClusterType, v3.EndpointType} {
+		w := conn.Watched(typeURL)
+		if w == nil {
+			continue
+		}
+		res, _, err := s.findGenerator(typeURL, conn).Generate(conn.proxy, push, w, req)
+		if err != nil {
+			return nil, err
+		}
+		resources := make(map[string]jsonMarshalProto, len(res))
+		for _, r := range res {
+			resources[r.Name] = jsonMarshalProto{r.Resource}
+		}
+		dump[v3.GetShortType(typeURL)] = resources
+	}
+	return dump, nil
+}
+
 // configDump converts the connection internal state into an Envoy Admin API config dump proto
 // It is used in debugging to create a consistent object for comparison between Envoy and Pilot outputs
 func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, error) {
@@ -22,11 +22,13 @@ import (
 	"testing"
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/google/go-cmp/cmp"
 
 	"istio.io/istio/istioctl/pkg/util/configdump"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/util/protomarshal"
 )
 
 func TestSyncz(t *testing.T) {
@@ -200,6 +202,102 @@ func getConfigDump(t *testing.T, s *xds.DiscoveryServer, proxyID string, wantCod
 	return got
 }
 
+func TestGrpcXdsz(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		ConfigString: `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: echo
+  namespace: default
+spec:
+  hosts:
+  - echo.default.svc.cluster.local
+  ports:
+  - number: 7070
+    name: grpc
+    protocol: GRPC
+  resolution: STATIC
+  endpoints:
+  - address: 1.2.3.4
+`,
+	})
+	const (
+		listener = "echo.default.svc.cluster.local:7070"
+		cluster  = "outbound|7070||echo.default.svc.cluster.local"
+	)
+	ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "grpc", Namespace: "default"})
+	// Record the resources the client receives, so we can compare them with the debug output
+	want := map[string][]string{}
+	for _, r := range []*discovery.DiscoveryRequest{
+		{TypeUrl: v3.ListenerType, ResourceNames: []string{listener}},
+		{TypeUrl: v3.RouteType, ResourceNames: []string{cluster}},
+		{TypeUrl: v3.ClusterType, ResourceNames: []string{cluster}},
+		{TypeUrl: v3.EndpointType, ResourceNames: []string{cluster}},
+	} {
+		resp := ads.RequestResponseAck(t, r)
+		for _, res := range resp.Resources {
+			b, err := protomarshal.Marshal(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[v3.GetShortType(r.TypeUrl)] = append(want[v3.GetShortType(r.TypeUrl)], normalizeJSON(t, b))
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/grpcxdsz?proxyID=test.default", nil)
+	http.HandlerFunc(s.Discovery.GrpcXdsz).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wanted response code 200, got %v: %s", rr.Code, rr.Body.String())
+	}
+	dump := map[string]map[string]json.RawMessage{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for typ, resources := range dump {
+		for _, res := range resources {
+			got[typ] = append(got[typ], normalizeJSON(t, res))
+		}
+	}
+	for _, typ := range []string{"LDS", "RDS", "CDS", "EDS"} {
+		if len(want[typ]) == 0 {
+			t.Fatalf("client did not receive any %s resources", typ)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("debug resources do not match resources sent to the client (-want +got):\n%s", diff)
+	}
+	if _, f := dump["LDS"][listener]; !f {
+		t.Fatalf("expected listener %s keyed by name, got %v", listener, dump["LDS"])
+	}
+
+	// Envoy proxies are rejected
+	s.ConnectADS().WithID("sidecar~1.1.1.2~envoy.default~default.svc.cluster.local").
+		RequestResponseAck(t, &discovery.DiscoveryRequest{TypeUrl: v3.ClusterType})
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/debug/grpcxdsz?proxyID=envoy.default", nil)
+	http.HandlerFunc(s.Discovery.GrpcXdsz).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("wanted response code 400 for a non-gRPC proxy, got %v", rr.Code)
+	}
+}
+
+// normalizeJSON returns a canonical form of a JSON document, so documents can be compared regardless of formatting
+func normalizeJSON(t *testing.T, b []byte) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
 func TestDebugHandlers(t *testing.T) {
 	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
 	req, err := http.NewRequest("GET", "/debug", nil)
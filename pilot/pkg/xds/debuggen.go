@@ -37,6 +37,7 @@ var activeNamespaceDebuggers = map[string]struct{}{
 	"config_dump": {},
 	"ndsz":        {},
 	"edsz":        {},
+	"telemetryz":  {},
 }
 
 // DebugGen is a Generator for istio debug info
@@ -107,16 +108,29 @@ func (dg *DebugGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 			return res, model.DefaultXdsLogDetails, fmt.Errorf("the debug info is not available for current identity: %q", identity)
 		}
 	}
-	debugURL := "/debug/" + resourceName
-	req, _ := http.NewRequest(http.MethodGet, debugURL, nil)
-	handler, _ := dg.DebugMux.Handler(req)
-	response := NewResponseCapture()
-	handler.ServeHTTP(response, req)
-	if response.wroteHeader && len(response.header) >= 1 {
-		header, _ := json.Marshal(response.header)
-		buffer.Write(header)
+	if debugType == "telemetryz" && identity.Namespace != dg.SystemNamespace {
+		// Proxies outside the system namespace only get the telemetry summary of their own configuration.
+		summary := &model.TelemetrySummary{}
+		if push.Telemetry != nil {
+			summary = push.Telemetry.Summary(proxy)
+		}
+		b, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return res, model.DefaultXdsLogDetails, err
+		}
+		buffer.Write(b)
+	} else {
+		debugURL := "/debug/" + resourceName
+		req, _ := http.NewRequest(http.MethodGet, debugURL, nil)
+		handler, _ := dg.DebugMux.Handler(req)
+		response := NewResponseCapture()
+		handler.ServeHTTP(response, req)
+		if response.wroteHeader && len(response.header) >= 1 {
+			header, _ := json.Marshal(response.header)
+			buffer.Write(header)
+		}
+		buffer.Write(response.body.Bytes())
 	}
-	buffer.Write(response.body.Bytes())
 	res = append(res, &discovery.Resource{
 		Name: resourceName,
 		Resource: &any.Any{
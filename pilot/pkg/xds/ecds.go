@@ -15,20 +15,42 @@
 package xds
 
 import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/secrets"
+	"istio.io/istio/pkg/cluster"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
 
 // EcdsGenerator generates ECDS configuration.
 type EcdsGenerator struct {
 	Server *DiscoveryServer
+
+	secretController secrets.MulticlusterController
+	// serviceAccountPullSecrets caches the image pull secrets of service accounts, merged into a single docker config.
+	serviceAccountPullSecrets *pullSecretCache
 }
 
 var _ model.XdsResourceGenerator = &EcdsGenerator{}
 
+// SetCredController sets the controller used to look up the image pull secrets of Wasm modules.
+func (e *EcdsGenerator) SetCredController(creds secrets.MulticlusterController) {
+	cache := newPullSecretCache()
+	creds.AddEventHandler(func(_, namespace string) {
+		cache.invalidate(namespace)
+	})
+	e.serviceAccountPullSecrets = cache
+	e.secretController = creds
+}
+
 func ecdsNeedsPush(req *model.PushRequest) bool {
 	if req == nil {
 		return true
@@ -56,10 +78,11 @@ func ecdsNeedsPush(req *model.PushRequest) bool {
 // Generate returns ECDS resources for a given proxy.
 func (e *EcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
 	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
-	if !ecdsNeedsPush(req) {
+	if !ecdsNeedsPush(req) && !e.pullSecretsUpdated(proxy, push, req) {
 		return nil, model.DefaultXdsLogDetails, nil
 	}
-	ec := e.Server.ConfigGenerator.BuildExtensionConfiguration(proxy, push, w.ResourceNames)
+	pullSecrets := e.wasmPullSecrets(proxy, push, w.ResourceNames)
+	ec := e.Server.ConfigGenerator.BuildExtensionConfiguration(proxy, push, w.ResourceNames, pullSecrets)
 	if ec == nil {
 		return nil, model.DefaultXdsLogDetails, nil
 	}
@@ -73,3 +96,181 @@ func (e *EcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 	}
 	return resources, model.DefaultXdsLogDetails, nil
 }
+
+// pullSecretsUpdated returns true if an incremental push updated Secrets the WasmPlugins of the proxy may be fetched
+// with: those in the namespace of a WasmPlugin applied to the proxy, or in the namespace of the proxy itself.
+func (e *EcdsGenerator) pullSecretsUpdated(proxy *model.Proxy, push *model.PushContext, req *model.PushRequest) bool {
+	if req == nil || req.Full || e.secretController == nil || proxy.VerifiedIdentity == nil {
+		return false
+	}
+	plugins := push.WasmPlugins(proxy)
+	if len(plugins) == 0 {
+		return false
+	}
+	for config := range req.ConfigsUpdated {
+		if config.Kind != gvk.Secret {
+			continue
+		}
+		if config.Namespace == proxy.VerifiedIdentity.Namespace {
+			return true
+		}
+		for _, list := range plugins {
+			for _, p := range list {
+				if p.Namespace == config.Namespace {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// wasmPullSecrets returns the image pull secrets to fetch the OCI modules of the requested WasmPlugins with, keyed by
+// extension configuration name. The image pull secret referenced by a WasmPlugin is used exclusively. Otherwise, the
+// image pull secrets of the service account of the proxy are used, as the kubelet does for the images of the workload.
+// In both cases the agent falls back to its default keychain for registries the pull secrets have no entry for.
+func (e *EcdsGenerator) wasmPullSecrets(proxy *model.Proxy, push *model.PushContext, names []string) map[string][]byte {
+	if e.secretController == nil || proxy.VerifiedIdentity == nil {
+		return nil
+	}
+	requested := make(map[string]bool, len(names))
+	for _, n := range names {
+		requested[n] = true
+	}
+	var creds secrets.Controller
+	pullSecrets := map[string][]byte{}
+	for _, list := range push.WasmPlugins(proxy) {
+		for _, p := range list {
+			name := p.Namespace + "." + p.Name
+			if !requested[name] || !isOCIModule(p.Url) {
+				continue
+			}
+			if creds == nil {
+				var err error
+				creds, err = e.secretController.ForCluster(proxy.Metadata.ClusterID)
+				if err != nil {
+					log.Warnf("failed to get credential controller for cluster %v: %v", proxy.Metadata.ClusterID, err)
+					return nil
+				}
+			}
+			if p.ImagePullSecret != "" {
+				secret, err := creds.GetDockerCredential(p.ImagePullSecret, p.Namespace)
+				if err != nil {
+					log.Warnf("failed to get image pull secret of wasmplugin %s/%s: %v", p.Namespace, p.Name, err)
+					continue
+				}
+				pullSecrets[name] = secret
+				continue
+			}
+			if !features.WasmServiceAccountPullSecrets {
+				continue
+			}
+			if secret := e.serviceAccountPullSecret(creds, proxy); len(secret) > 0 {
+				pullSecrets[name] = secret
+			}
+		}
+	}
+	return pullSecrets
+}
+
+// serviceAccountPullSecret returns the image pull secrets of the service account of the proxy, merged into a single
+// docker config. The first secret holding credentials for a registry wins, as with the kubelet.
+func (e *EcdsGenerator) serviceAccountPullSecret(creds secrets.Controller, proxy *model.Proxy) []byte {
+	serviceAccount := proxy.VerifiedIdentity.ServiceAccount
+	namespace := proxy.VerifiedIdentity.Namespace
+	names, err := creds.GetImagePullSecrets(serviceAccount, namespace)
+	if err != nil {
+		log.Debugf("failed to get image pull secrets of service account %s/%s: %v", namespace, serviceAccount, err)
+		return nil
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// The secret names are part of the key, so that changes to the service account are picked up without
+	// invalidating the cache.
+	key := pullSecretKey{
+		cluster:        proxy.Metadata.ClusterID,
+		namespace:      namespace,
+		serviceAccount: serviceAccount,
+		secrets:        strings.Join(names, ","),
+	}
+	if secret, f := e.serviceAccountPullSecrets.get(key); f {
+		return secret
+	}
+	auths := map[string]json.RawMessage{}
+	for _, n := range names {
+		secret, err := creds.GetDockerCredential(n, namespace)
+		if err != nil {
+			log.Debugf("failed to get image pull secret %s/%s: %v", namespace, n, err)
+			continue
+		}
+		cfg := struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}{}
+		if err := json.Unmarshal(secret, &cfg); err != nil {
+			log.Debugf("failed to parse image pull secret %s/%s: %v", namespace, n, err)
+			continue
+		}
+		for registry, auth := range cfg.Auths {
+			if _, f := auths[registry]; !f {
+				auths[registry] = auth
+			}
+		}
+	}
+	var merged []byte
+	if len(auths) > 0 {
+		merged, _ = json.Marshal(map[string]interface{}{"auths": auths})
+	}
+	e.serviceAccountPullSecrets.add(key, merged)
+	return merged
+}
+
+// isOCIModule returns true if the WasmPlugin module is fetched from an OCI registry. URLs without a scheme
+// default to oci://.
+func isOCIModule(moduleURL string) bool {
+	u, err := url.Parse(moduleURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || u.Scheme == "oci"
+}
+
+type pullSecretKey struct {
+	cluster        cluster.ID
+	namespace      string
+	serviceAccount string
+	secrets        string
+}
+
+// pullSecretCache caches merged image pull secrets. Entries are invalidated when a Secret in their namespace changes.
+type pullSecretCache struct {
+	mu      sync.RWMutex
+	entries map[pullSecretKey][]byte
+}
+
+func newPullSecretCache() *pullSecretCache {
+	return &pullSecretCache{entries: map[pullSecretKey][]byte{}}
+}
+
+func (c *pullSecretCache) get(key pullSecretKey) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	secret, f := c.entries[key]
+	return secret, f
+}
+
+func (c *pullSecretCache) add(key pullSecretKey, secret []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = secret
+}
+
+func (c *pullSecretCache) invalidate(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k.namespace == namespace {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -14,13 +14,24 @@
 package xds_test
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/pkg/test/util/retry"
 )
 
 func TestECDS(t *testing.T) {
@@ -47,3 +58,140 @@ func TestECDS(t *testing.T) {
 		t.Errorf("extension config name got %v want %v", ec.Name, wantExtensionConfigName)
 	}
 }
+
+const pullSecretWasmPlugins = `
+apiVersion: extensions.istio.io/v1alpha1
+kind: WasmPlugin
+metadata:
+  name: explicit
+  namespace: default
+spec:
+  url: oci://registry.example.com/explicit:latest
+  imagePullSecret: plugin-secret
+---
+apiVersion: extensions.istio.io/v1alpha1
+kind: WasmPlugin
+metadata:
+  name: implicit
+  namespace: default
+spec:
+  url: registry.example.com/implicit:latest
+---
+apiVersion: extensions.istio.io/v1alpha1
+kind: WasmPlugin
+metadata:
+  name: http
+  namespace: default
+spec:
+  url: https://example.com/filter.wasm
+  sha256: 0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f
+`
+
+func dockerConfigSecret(name, config string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(config)},
+	}
+}
+
+// pullSecrets returns the image pull secret sent along with each extension configuration.
+func pullSecrets(t *testing.T, resources model.Resources) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	for _, r := range resources {
+		ec := &corev3.TypedExtensionConfig{}
+		if err := r.Resource.UnmarshalTo(ec); err != nil {
+			t.Fatal(err)
+		}
+		filter := &wasm.Wasm{}
+		if err := ec.TypedConfig.UnmarshalTo(filter); err != nil {
+			t.Fatal(err)
+		}
+		got[ec.Name] = filter.GetConfig().GetVmConfig().GetEnvironmentVariables().GetKeyValues()[model.WasmSecretEnv]
+	}
+	return got
+}
+
+func TestECDSPullSecrets(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "sa", Namespace: "default"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-secret-1"}, {Name: "sa-secret-2"}},
+	}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		ConfigString: pullSecretWasmPlugins,
+		KubernetesObjects: []runtime.Object{
+			sa,
+			dockerConfigSecret("plugin-secret", `{"auths":{"registry.example.com":{"auth":"plugin"}}}`),
+			dockerConfigSecret("sa-secret-1", `{"auths":{"registry.example.com":{"auth":"first"}}}`),
+			dockerConfigSecret("sa-secret-2", `{"auths":{"registry.example.com":{"auth":"second"},"other.example.com":{"auth":"other"}}}`),
+		},
+	})
+	gen := s.Discovery.Generators[v3.ExtensionConfigurationType]
+	names := []string{"default.explicit", "default.implicit", "default.http"}
+	newProxy := func(identity *spiffe.Identity) *model.Proxy {
+		return s.SetupProxy(&model.Proxy{
+			Metadata:         &model.NodeMetadata{ClusterID: "Kubernetes", Namespace: "default"},
+			VerifiedIdentity: identity,
+			ConfigNamespace:  "default",
+		})
+	}
+	generate := func(proxy *model.Proxy, req *model.PushRequest) (map[string]string, bool) {
+		t.Helper()
+		req.Start = time.Now()
+		res, _, err := gen.Generate(proxy, s.PushContext(), &model.WatchedResource{ResourceNames: names}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pullSecrets(t, res), res != nil
+	}
+	secretUpdate := func(namespace string) *model.PushRequest {
+		return &model.PushRequest{
+			ConfigsUpdated: map[model.ConfigKey]struct{}{
+				{Kind: gvk.Secret, Name: "sa-secret-1", Namespace: namespace}: {},
+			},
+		}
+	}
+	proxy := newProxy(&spiffe.Identity{Namespace: "default", ServiceAccount: "sa"})
+
+	// The secret of the WasmPlugin is used exclusively. Otherwise the service account secrets are merged, the first
+	// secret holding credentials for a registry winning. Modules not fetched from a registry get no secret.
+	got, _ := generate(proxy, &model.PushRequest{Full: true})
+	want := map[string]string{
+		"explicit": `{"auths":{"registry.example.com":{"auth":"plugin"}}}`,
+		"implicit": `{"auths":{"other.example.com":{"auth":"other"},"registry.example.com":{"auth":"first"}}}`,
+		"http":     "",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got pull secrets %v, want %v", got, want)
+	}
+
+	// Proxies without a verified identity never get secrets.
+	got, _ = generate(newProxy(nil), &model.PushRequest{Full: true})
+	for name, secret := range got {
+		if secret != "" {
+			t.Fatalf("unexpected pull secret for unverified proxy in %v: %v", name, secret)
+		}
+	}
+
+	// Secret changes in other namespaces do not trigger a push.
+	if _, pushed := generate(proxy, secretUpdate("other")); pushed {
+		t.Fatalf("unexpected push for secret in other namespace")
+	}
+
+	// Updating a secret invalidates the cached service account secrets, and pushes the new ones.
+	updated := dockerConfigSecret("sa-secret-1", `{"auths":{"registry.example.com":{"auth":"updated"}}}`)
+	if _, err := s.KubeClient().Kube().CoreV1().Secrets("default").Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		got, pushed := generate(proxy, secretUpdate("default"))
+		if !pushed {
+			return fmt.Errorf("expected push for secret update")
+		}
+		if want := `{"auths":{"other.example.com":{"auth":"other"},"registry.example.com":{"auth":"updated"}}}`; got["implicit"] != want {
+			return fmt.Errorf("got pull secret %v, want %v", got["implicit"], want)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
@@ -31,6 +31,9 @@ var (
 	typeTag    = monitoring.MustCreateLabel("type")
 	versionTag = monitoring.MustCreateLabel("version")
 
+	resultTag        = monitoring.MustCreateLabel("result")
+	clientVersionTag = monitoring.MustCreateLabel("client_version")
+
 	// pilot_total_xds_rejects should be used instead. This is for backwards compatibility
 	cdsReject = monitoring.NewGauge(
 		"pilot_xds_cds_reject",
@@ -65,6 +68,20 @@ var (
 		monitoring.WithLabels(typeTag),
 	)
 
+	// Proxyless gRPC clients do not expose any metric about rejected configuration, unlike Envoy, so we track
+	// their responses on the server side.
+	grpcXDSResponses = monitoring.NewSum(
+		"pilot_xds_grpc_responses",
+		"Total number of XDS responses ACKed or NACKed by proxyless gRPC clients.",
+		monitoring.WithLabels(typeTag, nodeTag, resultTag, clientVersionTag),
+	)
+
+	grpcXDSLastNack = monitoring.NewGauge(
+		"pilot_xds_grpc_last_nack_timestamp_seconds",
+		"Unix time of the last XDS response NACKed by a proxyless gRPC client.",
+		monitoring.WithLabels(typeTag, nodeTag, clientVersionTag),
+	)
+
 	// Number of delayed pushes. Currently this happens only when the last push has not been ACKed
 	totalDelayedPushes = monitoring.NewSum(
 		"pilot_xds_delayed_pushes_total",
@@ -101,6 +118,12 @@ var (
 	xdsClientTrackerMutex = &sync.Mutex{}
 	xdsClientTracker      = make(map[string]float64)
 
+	tracingDisabledClients = monitoring.NewGauge(
+		"pilot_xds_tracing_disabled",
+		"Number of endpoints connected to this pilot using XDS with tracing disabled by annotation.",
+	)
+	tracingDisabledClientTracker float64
+
 	xdsResponseWriteTimeouts = monitoring.NewSum(
 		"pilot_xds_write_timeout",
 		"Pilot XDS response write timeouts.",
@@ -202,6 +225,13 @@ func recordXDSClients(version string, delta float64) {
 	xdsClients.With(versionTag.Value(version)).Record(xdsClientTracker[version])
 }
 
+func recordTracingDisabledClients(delta float64) {
+	xdsClientTrackerMutex.Lock()
+	defer xdsClientTrackerMutex.Unlock()
+	tracingDisabledClientTracker += delta
+	tracingDisabledClients.Record(tracingDisabledClientTracker)
+}
+
 // triggerMetric is a precomputed monitoring.Metric for each trigger type. This saves on a lot of allocations
 var triggerMetric = map[model.TriggerReason]monitoring.Metric{
 	model.EndpointUpdate:  pushTriggers.With(typeTag.Value(string(model.EndpointUpdate))),
@@ -270,6 +300,31 @@ func incrementXDSRejects(xdsType string, node, errCode string) {
 	}
 }
 
+// grpcClientVersion returns the xDS library version of a proxyless gRPC client, as reported in its node.
+func grpcClientVersion(proxy *model.Proxy) string {
+	if proxy.XdsNode == nil || proxy.XdsNode.GetUserAgentVersion() == "" {
+		return "unknown"
+	}
+	if proxy.XdsNode.UserAgentName == "" {
+		return proxy.XdsNode.GetUserAgentVersion()
+	}
+	return proxy.XdsNode.UserAgentName + "/" + proxy.XdsNode.GetUserAgentVersion()
+}
+
+func recordGrpcXDSAck(xdsType string, proxy *model.Proxy) {
+	grpcXDSResponses.With(typeTag.Value(v3.GetMetricType(xdsType)), nodeTag.Value(proxy.ID),
+		resultTag.Value("ack"), clientVersionTag.Value(grpcClientVersion(proxy))).Increment()
+}
+
+func recordGrpcXDSNack(xdsType string, proxy *model.Proxy, message string) {
+	version := grpcClientVersion(proxy)
+	log.Warnf("ADS:%s: gRPC client %s (%s) rejected config: %s", v3.GetShortType(xdsType), proxy.ID, version, message)
+	grpcXDSResponses.With(typeTag.Value(v3.GetMetricType(xdsType)), nodeTag.Value(proxy.ID),
+		resultTag.Value("nack"), clientVersionTag.Value(version)).Increment()
+	grpcXDSLastNack.With(typeTag.Value(v3.GetMetricType(xdsType)), nodeTag.Value(proxy.ID),
+		clientVersionTag.Value(version)).Record(float64(time.Now().Unix()))
+}
+
 func recordSendTime(duration time.Duration) {
 	sendTime.Record(duration.Seconds())
 }
@@ -287,8 +342,11 @@ func init() {
 		rdsReject,
 		xdsExpiredNonce,
 		totalXDSRejects,
+		grpcXDSResponses,
+		grpcXDSLastNack,
 		monServices,
 		xdsClients,
+		tracingDisabledClients,
 		xdsResponseWriteTimeouts,
 		pushes,
 		pushTime,
@@ -125,6 +125,70 @@ const (
 	// InternalParentName declares the original resource of an internally-generate config. This is used by the gateway-api.
 	InternalParentName = "internal.istio.io/parent"
 
+	// InternalRouteParent declares the specific parent (Gateway or mesh) an internally-generated VirtualService was
+	// generated for. This is used by the gateway-api, which generates a VirtualService per route parent.
+	InternalRouteParent = "internal.istio.io/route-parent"
+
+	// TelemetryUpstreamTracingTags can be set to "true" or "false" on a Telemetry resource to override whether trace
+	// spans include upstream cluster and peer tags for the workloads it applies to.
+	TelemetryUpstreamTracingTags = "telemetry.istio.io/upstream-tracing-tags"
+
+	// TelemetryDisableTCPMetricsPorts can be set to a comma separated list of ports on a Telemetry resource to
+	// disable TCP metrics for listeners on those ports, while keeping metrics for other ports and HTTP traffic.
+	TelemetryDisableTCPMetricsPorts = "telemetry.istio.io/disable-tcp-metrics-ports"
+
+	// TelemetryTracingClientSampling can be set to a percentage (0.0 - 100.0) on a Telemetry resource to override
+	// the percentage of requests that are traced when the client sets the x-client-trace-id header.
+	TelemetryTracingClientSampling = "telemetry.istio.io/tracing-client-sampling"
+
+	// TelemetryTracingOverallSampling can be set to a percentage (0.0 - 100.0) on a Telemetry resource to override
+	// the cap on the percentage of requests that are traced, applied after all other sampling decisions.
+	TelemetryTracingOverallSampling = "telemetry.istio.io/tracing-overall-sampling"
+
+	// TelemetryTracingInboundDisabled and TelemetryTracingOutboundDisabled can be set to "true" or "false" on a
+	// Telemetry resource to override whether spans are reported for inbound (server side) or outbound (client side)
+	// traffic only. Gateways are treated as outbound.
+	TelemetryTracingInboundDisabled  = "telemetry.istio.io/tracing-inbound-disabled"
+	TelemetryTracingOutboundDisabled = "telemetry.istio.io/tracing-outbound-disabled"
+
+	// TelemetryTracingInboundSampling and TelemetryTracingOutboundSampling can be set to a percentage (0.0 - 100.0)
+	// on a Telemetry resource to override the random sampling percentage for inbound or outbound traffic only.
+	TelemetryTracingInboundSampling  = "telemetry.istio.io/tracing-inbound-sampling"
+	TelemetryTracingOutboundSampling = "telemetry.istio.io/tracing-outbound-sampling"
+
+	// TelemetryTracingLabelTags can be set to a comma separated list of tag=label or tag=label:default on a Telemetry
+	// resource to add span tags set to the value of a label of the workload. If the workload does not have the
+	// label, the tag is set to the default, or omitted if there is no default.
+	TelemetryTracingLabelTags = "telemetry.istio.io/tracing-label-tags"
+
+	// TelemetryTracingTagMaxLength can be set to a comma separated list of tag=length on a Telemetry resource to
+	// truncate the value of custom tags to at most length bytes. Envoy cannot truncate tags read from request headers
+	// or environment variables, so only tags with a value known to istiod, such as literal and label tags, are
+	// truncated. Tags are not truncated by default.
+	TelemetryTracingTagMaxLength = "telemetry.istio.io/tracing-tag-max-length"
+
+	// TelemetryAccessLogSampling can be set to a comma separated list of provider=percentage on a Telemetry resource
+	// to only log a random percentage (0.0 - 100.0) of the requests and connections for the access logging provider.
+	TelemetryAccessLogSampling = "telemetry.istio.io/access-log-sampling"
+
+	// TelemetryAccessLogErrors can be set to "true" or "false" on a Telemetry resource to override whether requests
+	// and connections that failed, with a 5xx response code or an Envoy response flag, are logged regardless of the
+	// access log sampling.
+	TelemetryAccessLogErrors = "telemetry.istio.io/access-log-errors"
+
+	// TelemetryMetrics can be set to "disabled" on a pod to disable metrics for the workload. This takes precedence
+	// over root and namespace Telemetry resources, but not over a Telemetry resource selecting the workload.
+	TelemetryMetrics = "telemetry.istio.io/metrics"
+
+	// TelemetryTracing can be set to "disabled" on a pod to disable tracing for the workload. Unlike
+	// TelemetryMetrics, this takes precedence over all Telemetry resources and mesh config.
+	TelemetryTracing = "telemetry.istio.io/tracing"
+
+	// TracingProviderClusterIDPlaceholder can be used in the service of a tracing extension provider, for example
+	// "zipkin.$(CLUSTER_ID).example.com". It is replaced with the ID of the cluster of each proxy, so that proxies
+	// report spans to the collector of their own cluster.
+	TracingProviderClusterIDPlaceholder = "$(CLUSTER_ID)"
+
 	// TrustworthyJWTPath is the default 3P token to authenticate with third party services
 	TrustworthyJWTPath = "./var/run/secrets/tokens/istio-token"
 
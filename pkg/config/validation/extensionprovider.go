@@ -24,6 +24,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pkg/config/constants"
 )
 
 func validateExtensionProviderService(service string) error {
@@ -45,6 +46,12 @@ func validateExtensionProviderService(service string) error {
 	return nil
 }
 
+// validateTracingProviderService validates the service of a tracing provider, which may contain the cluster ID
+// placeholder replaced with the cluster of each proxy.
+func validateTracingProviderService(service string) error {
+	return validateExtensionProviderService(strings.ReplaceAll(service, constants.TracingProviderClusterIDPlaceholder, "cluster"))
+}
+
 func validateExtensionProviderEnvoyExtAuthzStatusOnError(status string) error {
 	if status == "" {
 		return nil
@@ -103,7 +110,7 @@ func validateExtensionProviderTracingZipkin(config *meshconfig.MeshConfig_Extens
 	if config == nil {
 		return fmt.Errorf("nil TracingZipkinProvider")
 	}
-	if err := validateExtensionProviderService(config.Service); err != nil {
+	if err := validateTracingProviderService(config.Service); err != nil {
 		errs = appendErrors(errs, err)
 	}
 	if err := ValidatePort(int(config.Port)); err != nil {
@@ -116,7 +123,7 @@ func validateExtensionProviderTracingLightStep(config *meshconfig.MeshConfig_Ext
 	if config == nil {
 		return fmt.Errorf("nil TracingLightStepProvider")
 	}
-	if err := validateExtensionProviderService(config.Service); err != nil {
+	if err := validateTracingProviderService(config.Service); err != nil {
 		errs = appendErrors(errs, err)
 	}
 	if err := ValidatePort(int(config.Port)); err != nil {
@@ -132,7 +139,7 @@ func validateExtensionProviderTracingDatadog(config *meshconfig.MeshConfig_Exten
 	if config == nil {
 		return fmt.Errorf("nil TracingDatadogProvider")
 	}
-	if err := validateExtensionProviderService(config.Service); err != nil {
+	if err := validateTracingProviderService(config.Service); err != nil {
 		errs = appendErrors(errs, err)
 	}
 	if err := ValidatePort(int(config.Port)); err != nil {
@@ -145,7 +152,7 @@ func validateExtensionProviderTracingOpenCensusAgent(config *meshconfig.MeshConf
 	if config == nil {
 		return fmt.Errorf("nil OpenCensusAgent")
 	}
-	if err := validateExtensionProviderService(config.Service); err != nil {
+	if err := validateTracingProviderService(config.Service); err != nil {
 		errs = appendErrors(errs, err)
 	}
 	if err := ValidatePort(int(config.Port)); err != nil {
@@ -158,7 +165,7 @@ func validateExtensionProviderTracingSkyWalking(config *meshconfig.MeshConfig_Ex
 	if config == nil {
 		return fmt.Errorf("nil TracingSkyWalkingProvider")
 	}
-	if err := validateExtensionProviderService(config.Service); err != nil {
+	if err := validateTracingProviderService(config.Service); err != nil {
 		errs = appendErrors(errs, err)
 	}
 	if err := ValidatePort(int(config.Port)); err != nil {
@@ -112,6 +112,22 @@ func TestValidateExtensionProviderTracingZipkin(t *testing.T) {
 			},
 			valid: false,
 		},
+		{
+			name: "zipkin service with cluster ID",
+			config: &meshconfig.MeshConfig_ExtensionProvider_ZipkinTracingProvider{
+				Service: "zipkin.$(CLUSTER_ID).example.com",
+				Port:    9411,
+			},
+			valid: true,
+		},
+		{
+			name: "zipkin service with invalid placeholder",
+			config: &meshconfig.MeshConfig_ExtensionProvider_ZipkinTracingProvider{
+				Service: "zipkin.$(NAMESPACE).example.com",
+				Port:    9411,
+			},
+			valid: false,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -3422,9 +3423,12 @@ func validateTelemetryTracing(tracing []*telemetry.Tracing) (v Validation) {
 		if l.RandomSamplingPercentage.GetValue() < 0 || l.RandomSamplingPercentage.GetValue() > 100 {
 			v = appendErrorf(v, "randomSamplingPercentage must be in range [0.0, 100.0]")
 		}
+		for _, name := range DuplicateTracingTagNames(l.CustomTags) {
+			v = appendErrorf(v, "tag name %q differs only by case from another tag", name)
+		}
 		for name, tag := range l.CustomTags {
-			if name == "" {
-				v = appendErrorf(v, "tag name may not be empty")
+			if err := ValidateTracingTagName(name); err != nil {
+				v = appendValidation(v, err)
 			}
 			switch t := tag.Type.(type) {
 			case *telemetry.Tracing_CustomTag_Literal:
@@ -3445,6 +3449,48 @@ func validateTelemetryTracing(tracing []*telemetry.Tracing) (v Validation) {
 	return
 }
 
+// maxTracingTagNameLength is the maximum length of the name of a custom tracing tag. Some tracing backends silently
+// drop tags with longer names.
+const maxTracingTagNameLength = 128
+
+// tracingTagNameRegexp matches the characters of custom tracing tag names accepted by tracing backends.
+var tracingTagNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]+$`)
+
+// ValidateTracingTagName validates the name of a custom tracing tag.
+func ValidateTracingTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("tag name may not be empty")
+	}
+	if len(name) > maxTracingTagNameLength {
+		return fmt.Errorf("tag name %q is longer than %d characters", name, maxTracingTagNameLength)
+	}
+	if !tracingTagNameRegexp.MatchString(name) {
+		return fmt.Errorf("tag name %q may only contain letters, digits, '_', '.', ':', '/' and '-'", name)
+	}
+	return nil
+}
+
+// DuplicateTracingTagNames returns the names of the custom tracing tags which differ only by case from another tag,
+// which some tracing backends treat as the same tag. The first of the names in sorted order is not included.
+func DuplicateTracingTagNames(tags map[string]*telemetry.Tracing_CustomTag) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := make(map[string]struct{}, len(names))
+	var duplicates []string
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if _, f := seen[lower]; f {
+			duplicates = append(duplicates, name)
+			continue
+		}
+		seen[lower] = struct{}{}
+	}
+	return duplicates
+}
+
 func validateTelemetryMetrics(metrics []*telemetry.Metrics) (v Validation) {
 	for _, l := range metrics {
 		if l == nil {
@@ -3534,6 +3580,9 @@ func validateWasmPluginURL(pluginURL string) error {
 
 func validateWasmPluginSHA(plugin *extensions.WasmPlugin) error {
 	if plugin.Sha256 == "" {
+		if strings.HasPrefix(plugin.Url, "https://") {
+			return fmt.Errorf("sha256 field must be set for https urls")
+		}
 		return nil
 	}
 	if len(plugin.Sha256) != 64 {
@@ -6662,6 +6662,63 @@ func TestValidateTelemetry(t *testing.T) {
 			},
 			"randomSamplingPercentage", "",
 		},
+		{
+			"valid custom tags",
+			&telemetry.Telemetry{
+				Tracing: []*telemetry.Tracing{{
+					CustomTags: map[string]*telemetry.Tracing_CustomTag{
+						"app/version:v1": {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "v1"}}},
+						"my_tag.name-2":  {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "v"}}},
+					},
+				}},
+			},
+			"", "",
+		},
+		{
+			"custom tag name with space",
+			&telemetry.Telemetry{
+				Tracing: []*telemetry.Tracing{{
+					CustomTags: map[string]*telemetry.Tracing_CustomTag{
+						"my tag": {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "v"}}},
+					},
+				}},
+			},
+			"may only contain", "",
+		},
+		{
+			"custom tag name too long",
+			&telemetry.Telemetry{
+				Tracing: []*telemetry.Tracing{{
+					CustomTags: map[string]*telemetry.Tracing_CustomTag{
+						strings.Repeat("a", 129): {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "v"}}},
+					},
+				}},
+			},
+			"longer than 128 characters", "",
+		},
+		{
+			"empty custom tag name",
+			&telemetry.Telemetry{
+				Tracing: []*telemetry.Tracing{{
+					CustomTags: map[string]*telemetry.Tracing_CustomTag{
+						"": {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "v"}}},
+					},
+				}},
+			},
+			"tag name may not be empty", "",
+		},
+		{
+			"custom tag names differing by case",
+			&telemetry.Telemetry{
+				Tracing: []*telemetry.Tracing{{
+					CustomTags: map[string]*telemetry.Tracing_CustomTag{
+						"Env": {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "a"}}},
+						"env": {Type: &telemetry.Tracing_CustomTag_Literal{Literal: &telemetry.Tracing_Literal{Value: "b"}}},
+					},
+				}},
+			},
+			`tag name "env" differs only by case`, "",
+		},
 		{
 			"bad metrics operation",
 			&telemetry.Telemetry{
@@ -6770,6 +6827,21 @@ func TestValidateWasmPlugin(t *testing.T) {
 			},
 			"", "",
 		},
+		{
+			"https w/o sha",
+			&extensions.WasmPlugin{
+				Url: "https://test.com/test",
+			},
+			"sha256 field must be set for https urls", "",
+		},
+		{
+			"valid https w/ sha",
+			&extensions.WasmPlugin{
+				Url:    "https://test.com/test",
+				Sha256: "01ba4719c80b6fe911b091a7c05124b64eeece964e09c058ef8f9805daca546b",
+			},
+			"", "",
+		},
 		{
 			"short sha",
 			&extensions.WasmPlugin{
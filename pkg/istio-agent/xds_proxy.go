@@ -139,6 +139,13 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 			LocalHostAddr: localHostAddr,
 		}
 	}
+	wasmCache := wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInterval, wasm.DefaultWasmModuleExpiry)
+	if features.WasmChecksumFile {
+		wasmCache.UseChecksumFiles()
+	}
+	if namespaces := wasm.ParseGlobalCredentialsNamespaces(features.WasmGlobalCredentialsNamespaces); namespaces != nil {
+		wasmCache.RestrictGlobalCredentials(namespaces)
+	}
 	proxy := &XdsProxy{
 		istiodAddress:         ia.proxyConfig.DiscoveryAddress,
 		istiodSAN:             ia.cfg.IstiodSAN,
@@ -148,11 +155,18 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		healthChecker:         health.NewWorkloadHealthChecker(ia.proxyConfig.ReadinessProbe, envoyProbe, ia.cfg.ProxyIPAddresses, ia.cfg.IsIPv6),
 		xdsHeaders:            ia.cfg.XDSHeaders,
 		xdsUdsPath:            ia.cfg.XdsUdsPath,
-		wasmCache:             wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInterval, wasm.DefaultWasmModuleExpiry),
+		wasmCache:             wasmCache,
 		proxyAddresses:        ia.cfg.ProxyIPAddresses,
 		downstreamGrpcOptions: ia.cfg.DownstreamGrpcOptions,
 	}
 
+	if modules := wasm.ParsePrefetchModules(features.WasmPrefetchModules); len(modules) > 0 && features.WasmRemoteLoadConversion {
+		go wasm.Prefetch(proxy.wasmCache, modules, wasm.PrefetchOptions{
+			Parallelism: features.WasmPrefetchParallelism,
+			Budget:      features.WasmPrefetchBudget,
+		})
+	}
+
 	if ia.localDNSServer != nil {
 		proxy.handlers[v3.NameTableType] = func(resp *any.Any) error {
 			var nt dnsProto.NameTable
@@ -825,6 +839,25 @@ func (p *XdsProxy) makeTapHandler() func(w http.ResponseWriter, req *http.Reques
 	}
 }
 
+// handleWasmStatus serves the status of in-flight and recent Wasm module fetches, to debug WasmPlugins
+// that never become ready.
+func (p *XdsProxy) handleWasmStatus(w http.ResponseWriter, _ *http.Request) {
+	reporter, ok := p.wasmCache.(wasm.FetchStatusReporter)
+	if !ok {
+		http.Error(w, "Wasm fetch status is not available", http.StatusNotFound)
+		return
+	}
+	b, err := json.MarshalIndent(reporter.FetchStatus(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Infof("fail to write debug response: %v", err)
+	}
+}
+
 // initDebugInterface() listens on localhost:${PORT} for path /debug/...
 // forwards the paths to Istiod as xDS requests
 // waits for response from Istiod, sends it as JSON
@@ -833,6 +866,7 @@ func (p *XdsProxy) initDebugInterface(port int) error {
 
 	httpMux := http.NewServeMux()
 	handler := p.makeTapHandler()
+	httpMux.HandleFunc("/debug/wasmz", p.handleWasmStatus)
 	httpMux.HandleFunc("/debug/", handler)
 	httpMux.HandleFunc("/debug", handler) // For 1.10 Istiod which uses istio.io/debug
 
@@ -16,9 +16,12 @@ package istioagent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
@@ -51,6 +54,7 @@ import (
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/pkg/test/util/retry"
+	wasmcache "istio.io/istio/pkg/wasm"
 )
 
 func init() {
@@ -428,14 +432,14 @@ func TestXdsProxyReconnects(t *testing.T) {
 
 type fakeAckCache struct{}
 
-func (f *fakeAckCache) Get(string, string, time.Duration) (string, error) {
+func (f *fakeAckCache) Get(string, string, time.Duration, string, []byte) (string, error) {
 	return "test", nil
 }
 func (f *fakeAckCache) Cleanup() {}
 
 type fakeNackCache struct{}
 
-func (f *fakeNackCache) Get(string, string, time.Duration) (string, error) {
+func (f *fakeNackCache) Get(string, string, time.Duration, string, []byte) (string, error) {
 	return "", errors.New("errror")
 }
 func (f *fakeNackCache) Cleanup() {}
@@ -616,3 +620,34 @@ func setupDownstreamConnectionUDS(t test.Failer, path string) *grpc.ClientConn {
 func setupDownstreamConnection(t *testing.T, proxy *XdsProxy) *grpc.ClientConn {
 	return setupDownstreamConnectionUDS(t, proxy.xdsUdsPath)
 }
+
+func TestWasmStatusHandler(t *testing.T) {
+	cache := wasmcache.NewLocalFileCache(t.TempDir(), wasmcache.DefaultWasmModulePurgeInterval, wasmcache.DefaultWasmModuleExpiry)
+	defer cache.Cleanup()
+	proxy := &XdsProxy{wasmCache: cache}
+	// Fetches without a checksum over https are rejected before downloading, but are still reported.
+	if _, err := cache.Get("https://example.com/plugin.wasm", "", time.Second, "", nil); err == nil {
+		t.Fatal("expected fetch to fail")
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.handleWasmStatus(rec, httptest.NewRequest(http.MethodGet, "/debug/wasmz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %v: %v", rec.Code, rec.Body.String())
+	}
+	var got []wasmcache.FetchStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Reference != "https://example.com/plugin.wasm" || got[0].State != wasmcache.FetchStateFailed {
+		t.Fatalf("unexpected fetch status: %+v", got)
+	}
+
+	// Caches which do not report their status are not supported.
+	proxy.wasmCache = &fakeAckCache{}
+	rec = httptest.NewRecorder()
+	proxy.handleWasmStatus(rec, httptest.NewRequest(http.MethodGet, "/debug/wasmz", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status code %v", rec.Code)
+	}
+}
@@ -43,24 +43,47 @@ const (
 
 // Cache models a Wasm module cache.
 type Cache interface {
-	Get(url, checksum string, timeout time.Duration) (string, error)
+	// Get returns the path of the local file holding the Wasm module. namespace is the namespace of the WasmPlugin
+	// the module is fetched for, empty if not fetched for a WasmPlugin. pullSecret, if set, is a docker config JSON
+	// used to authenticate OCI image fetches for that namespace.
+	Get(url, checksum string, timeout time.Duration, namespace string, pullSecret []byte) (string, error)
 	Cleanup()
 }
 
 // LocalFileCache for downloaded Wasm modules. Currently it stores the Wasm module as local file.
+// Modules are stored by content, so identical modules referenced by different URLs, such as different tags of the
+// same image, share a single file.
 type LocalFileCache struct {
 	// Map from Wasm module checksum to cache entry.
-	modules map[cacheKey]cacheEntry
+	modules map[string]*cacheEntry
+
+	// Map from the requested module to the module it resolved to.
+	keys map[cacheKey]*keyEntry
+
+	// Map from OCI image manifest digest to the checksum of the Wasm module in the image.
+	imageDigests map[imageDigestKey]string
+
+	// credentials selects the registry credentials of OCI image fetches by namespace.
+	credentials *credentialResolver
 
 	// http fetcher fetches Wasm module with HTTP get.
 	httpFetcher *HTTPFetcher
 
+	// fetchLimiter limits fetches per registry host.
+	fetchLimiter *hostLimiter
+
+	// fetchStatus keeps track of in-flight and recent fetches for debugging.
+	fetchStatus *fetchStatusRegistry
+
 	// directory path used to store Wasm module.
 	dir string
 
 	// mux is needed because stale Wasm module files will be purged periodically.
 	mux sync.Mutex
 
+	// checksumFiles enables verifying modules fetched over HTTP(S) without a checksum against their checksum file.
+	checksumFiles bool
+
 	// Duration for stale Wasm module purging.
 	purgeInterval    time.Duration
 	wasmModuleExpiry time.Duration
@@ -69,11 +92,22 @@ type LocalFileCache struct {
 	stopChan chan struct{}
 }
 
-var _ Cache = &LocalFileCache{}
+var (
+	_ Cache               = &LocalFileCache{}
+	_ FetchStatusReporter = &LocalFileCache{}
+)
 
 type cacheKey struct {
 	downloadURL string
 	checksum    string
+	// namespace the module is cached for, when it was fetched with credentials other namespaces may not use.
+	namespace string
+}
+
+type imageDigestKey struct {
+	digest string
+	// namespace the image was fetched for, as for cacheKey.
+	namespace string
 }
 
 // cacheEntry contains information about a Wasm module cache entry.
@@ -81,15 +115,34 @@ type cacheEntry struct {
 	// File path to the downloaded wasm modules.
 	modulePath string
 
-	// Last time that this local Wasm module is referenced.
+	// Number of cache keys referencing the module. The module is removed once no key references it.
+	referencingKeys int
+}
+
+// keyEntry references the Wasm module a cache key resolved to.
+type keyEntry struct {
+	// Checksum of the referenced Wasm module.
+	checksum string
+
+	// Last time that this cache key is referenced.
 	last time.Time
 }
 
 // NewLocalFileCache create a new Wasm module cache which downloads and stores Wasm module files locally.
 func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *LocalFileCache {
+	return NewLocalFileCacheWithLimits(dir, purgeInterval, moduleExpiry, DefaultFetchLimits())
+}
+
+// NewLocalFileCacheWithLimits is like NewLocalFileCache, but with custom per registry host fetch limits.
+func NewLocalFileCacheWithLimits(dir string, purgeInterval, moduleExpiry time.Duration, limits FetchLimits) *LocalFileCache {
 	cache := &LocalFileCache{
 		httpFetcher:      NewHTTPFetcher(),
-		modules:          make(map[cacheKey]cacheEntry),
+		fetchLimiter:     newHostLimiter(limits),
+		fetchStatus:      newFetchStatusRegistry(),
+		modules:          make(map[string]*cacheEntry),
+		keys:             make(map[cacheKey]*keyEntry),
+		imageDigests:     make(map[imageDigestKey]string),
+		credentials:      newCredentialResolver(nil),
 		dir:              dir,
 		purgeInterval:    purgeInterval,
 		wasmModuleExpiry: moduleExpiry,
@@ -101,13 +154,40 @@ func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *L
 	return cache
 }
 
+// UseChecksumFiles makes the cache verify modules fetched over HTTP(S) without a configured checksum against the
+// sha256 checksum file published next to the module, at the module URL with the .sha256 suffix. If there is no
+// checksum file, modules fetched over HTTPS still require a checksum to be configured.
+// It must be called before the cache is used.
+func (c *LocalFileCache) UseChecksumFiles() {
+	c.checksumFiles = true
+}
+
+// RestrictGlobalCredentials only allows the modules of WasmPlugins in the namespaces to be fetched with the default
+// keychain of the agent. The modules of other namespaces are fetched with the image pull secrets of their namespace
+// only, and are not shared with other namespaces.
+// It must be called before the cache is used.
+func (c *LocalFileCache) RestrictGlobalCredentials(namespaces []string) {
+	if namespaces == nil {
+		namespaces = []string{}
+	}
+	c.credentials = newCredentialResolver(namespaces)
+}
+
 // Get returns path the local Wasm module file.
-func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration) (string, error) {
-	// Construct Wasm cache key with downloading URL and provided checksum of the module.
+func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration, namespace string, pullSecret []byte) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", fmt.Errorf("fail to parse Wasm module fetch url: %s", downloadURL)
+	}
+	// Construct Wasm cache key with downloading URL and provided checksum of the module. OCI modules fetched with
+	// credentials restricted to the namespace are only shared within the namespace.
 	key := cacheKey{
 		downloadURL: downloadURL,
 		checksum:    checksum,
 	}
+	if u.Scheme == "oci" {
+		key.namespace = c.credentials.scope(namespace, pullSecret)
+	}
 
 	// First check if the cache entry is already downloaded.
 	if modulePath := c.getEntry(key); modulePath != "" {
@@ -115,112 +195,240 @@ func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration
 	}
 
 	// If not, fetch images.
-	u, err := url.Parse(downloadURL)
-	if err != nil {
-		return "", fmt.Errorf("fail to parse Wasm module fetch url: %s", downloadURL)
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci" && u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported Wasm module downloading URL scheme: %v", u.Scheme)
+	}
+	tracker := c.fetchStatus.start(downloadURL)
+	fail := func(class string, err error) (string, error) {
+		wasmRemoteFetchCount.With(resultTag.Value(class)).Increment()
+		tracker.fail(class, err)
+		return "", err
+	}
+
+	// Modules fetched over HTTPS are typically served by an in-mesh server rather than a registry which
+	// verifies content by digest, so require the checksum to verify the module against. It may be read from the
+	// checksum file of the module instead.
+	if u.Scheme == "https" && checksum == "" && !c.checksumFiles {
+		return fail(checksumMissing, fmt.Errorf("sha256 checksum is required to fetch Wasm module from %v", downloadURL))
 	}
 
+	// Limit concurrent fetches per registry host, and reject fetches from hosts that keep failing.
+	release := func(bool) {}
+	if u.Scheme != "file" {
+		release, err = c.fetchLimiter.acquire(u.Host, timeout)
+		if err != nil {
+			if errors.Is(err, errCircuitOpen) {
+				return fail(circuitOpen, err)
+			}
+			return fail(downloadFailure, err)
+		}
+	}
+	// Whether the host responded successfully, regardless of the content.
+	hostResponded := false
+	defer func() {
+		release(hostResponded)
+	}()
+
+	// Expected hex-Encoded sha256 checksum of binary, which is the configured checksum, or the one from the
+	// checksum file of the module.
+	expectedChecksum := checksum
 	// Byte array of Wasm binary.
 	var b []byte
+	// Hex-Encoded digest of the OCI image manifest.
+	var imageDigest string
 	// Hex-Encoded sha256 checksum of binary.
 	var dChecksum string
 	switch u.Scheme {
-	case "http", "https":
-		// Download the Wasm module with http fetcher.
-		b, err = c.httpFetcher.Fetch(downloadURL, timeout)
+	case "http", "https", "file":
+		if u.Scheme == "file" {
+			// Read the Wasm module from the local file system, such as a mounted ConfigMap.
+			tracker.attempt()
+			b, err = readWasmFile(u.Path, c.httpFetcher.maxSize)
+			if err == nil {
+				tracker.addBytes(int64(len(b)))
+			}
+		} else {
+			if expectedChecksum == "" && c.checksumFiles {
+				expectedChecksum, err = c.httpFetcher.fetchChecksum(downloadURL, timeout)
+				if err != nil {
+					return fail(downloadFailure, err)
+				}
+				if expectedChecksum == "" && u.Scheme == "https" {
+					hostResponded = true
+					return fail(checksumMissing, fmt.Errorf("sha256 checksum is required to fetch Wasm module from %v, "+
+						"which has no checksum file", downloadURL))
+				}
+			}
+			// Download the Wasm module with http fetcher.
+			b, err = c.httpFetcher.fetch(downloadURL, timeout, tracker)
+		}
 		if err != nil {
-			wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
-			return "", err
+			return fail(downloadFailure, err)
 		}
+		hostResponded = true
+		tracker.setState(FetchStateVerifying)
 
 		// Get sha256 checksum and check if it is the same as provided one.
 		sha := sha256.Sum256(b)
 		dChecksum = hex.EncodeToString(sha[:])
-		if checksum != "" && dChecksum != checksum {
-			wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
-			return "", fmt.Errorf("module downloaded from %v has checksum %v, which does not match: %v", downloadURL, dChecksum, checksum)
+		tracker.setDigest("sha256:" + dChecksum)
+		if expectedChecksum != "" && dChecksum != expectedChecksum {
+			return fail(checksumMismatch,
+				fmt.Errorf("module downloaded from %v has checksum %v, which does not match: %v", downloadURL, dChecksum, expectedChecksum))
 		}
 	case "oci":
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
-		// TODO: support imagePullSecret and pass it to ImageFetcherOption.
-		fetcher := NewImageFetcher(ctx, ImageFetcherOption{})
-		b, err = fetcher.Fetch(u.Host+u.Path, checksum)
+		fetcher := NewImageFetcher(ctx, ImageFetcherOption{
+			PullSecret:  pullSecret,
+			Namespace:   namespace,
+			credentials: c.credentials,
+			tracker:     tracker,
+		})
+		tracker.attempt()
+		// Resolve tags to the image digest, so that a module already fetched through another tag, or another
+		// repository, is shared rather than fetched again.
+		imageDigest = checksum
+		if imageDigest == "" {
+			imageDigest, err = fetcher.ResolveDigest(u.Host + u.Path)
+			if err != nil {
+				return fail(downloadFailure, fmt.Errorf("could not fetch Wasm OCI image: %v", err))
+			}
+		}
+		if modulePath := c.getEntryByImageDigest(key, imageDigest); modulePath != "" {
+			hostResponded = true
+			tracker.setDigest("sha256:" + imageDigest)
+			tracker.setState(FetchStateCached)
+			return modulePath, nil
+		}
+		b, err = fetcher.Fetch(u.Host+u.Path, imageDigest)
 		if err != nil {
+			class := downloadFailure
 			if errors.Is(err, errWasmOCIImageDigestMismatch) {
-				wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
-			} else {
-				wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+				hostResponded = true
+				class = checksumMismatch
 			}
-			return "", fmt.Errorf("could not fetch Wasm OCI image: %v", err)
+			return fail(class, fmt.Errorf("could not fetch Wasm OCI image: %v", err))
 		}
+		hostResponded = true
+		tracker.setState(FetchStateVerifying)
 		sha := sha256.Sum256(b)
 		dChecksum = hex.EncodeToString(sha[:])
-	default:
-		return "", fmt.Errorf("unsupported Wasm module downloading URL scheme: %v", u.Scheme)
 	}
 
 	if !isValidWasmBinary(b) {
-		wasmRemoteFetchCount.With(resultTag.Value(fetchFailure)).Increment()
-		return "", fmt.Errorf("fetched Wasm binary from %s is invalid", downloadURL)
+		return fail(fetchFailure, fmt.Errorf("fetched Wasm binary from %s is invalid", downloadURL))
 	}
 
 	wasmRemoteFetchCount.With(resultTag.Value(fetchSuccess)).Increment()
 
-	key.checksum = dChecksum
+	// Index the module by its checksum, as well as by the requested checksum, or the resolved image digest for OCI
+	// modules, so that later requests for the same digest are served from the cache.
+	keys := []cacheKey{{downloadURL: downloadURL, checksum: dChecksum, namespace: key.namespace}}
+	if checksum != "" && checksum != dChecksum {
+		keys = append(keys, key)
+	}
+	if imageDigest != "" && imageDigest != checksum {
+		keys = append(keys, cacheKey{downloadURL: downloadURL, checksum: imageDigest, namespace: key.namespace})
+	}
 	f := filepath.Join(c.dir, fmt.Sprintf("%s.wasm", dChecksum))
 
-	if err := c.addEntry(key, b, f); err != nil {
+	if err := c.addEntry(keys, dChecksum, imageDigestKey{digest: imageDigest, namespace: key.namespace}, b, f); err != nil {
+		tracker.fail(fetchFailure, err)
 		return "", err
 	}
+	tracker.setState(FetchStateCached)
 	return f, nil
 }
 
+// FetchStatus returns the in-flight and recent Wasm module fetches, most recent first.
+func (c *LocalFileCache) FetchStatus() []FetchStatus {
+	return c.fetchStatus.list()
+}
+
 // Cleanup closes background Wasm module purge routine.
 func (c *LocalFileCache) Cleanup() {
 	close(c.stopChan)
 }
 
-func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) error {
+func (c *LocalFileCache) addEntry(keys []cacheKey, checksum string, imageDigest imageDigestKey, wasmModule []byte, f string) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
 	// Check if the module has already been added. If so, avoid writing the file again.
-	if ce, ok := c.modules[key]; ok {
-		// Update last touched time.
-		ce.last = time.Now()
-		return nil
+	if _, ok := c.modules[checksum]; !ok {
+		// Materialize the Wasm module into a local file. Use checksum as name of the module.
+		if err := os.WriteFile(f, wasmModule, 0o644); err != nil {
+			return err
+		}
+		c.modules[checksum] = &cacheEntry{modulePath: f}
 	}
-
-	// Materialize the Wasm module into a local file. Use checksum as name of the module.
-	if err := os.WriteFile(f, wasmModule, 0o644); err != nil {
-		return err
+	if imageDigest.digest != "" {
+		c.imageDigests[imageDigest] = checksum
 	}
-
-	ce := cacheEntry{
-		modulePath: f,
-		last:       time.Now(),
+	for _, key := range keys {
+		c.referenceModule(key, checksum)
 	}
-	c.modules[key] = ce
 	wasmCacheEntries.Record(float64(len(c.modules)))
 	return nil
 }
 
+// referenceModule points the cache key to the module with the checksum. Must be called with the lock held.
+func (c *LocalFileCache) referenceModule(key cacheKey, checksum string) {
+	if ke, ok := c.keys[key]; ok {
+		ke.last = time.Now()
+		if ke.checksum == checksum {
+			return
+		}
+		c.releaseModule(ke.checksum)
+		ke.checksum = checksum
+	} else {
+		c.keys[key] = &keyEntry{checksum: checksum, last: time.Now()}
+	}
+	c.modules[checksum].referencingKeys++
+}
+
+// releaseModule drops a reference to the module with the checksum. Must be called with the lock held.
+func (c *LocalFileCache) releaseModule(checksum string) {
+	if m, ok := c.modules[checksum]; ok {
+		m.referencingKeys--
+	}
+}
+
 func (c *LocalFileCache) getEntry(key cacheKey) string {
 	modulePath := ""
 	cacheHit := false
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	if ce, ok := c.modules[key]; ok {
-		// Update last touched time.
-		ce.last = time.Now()
-		modulePath = ce.modulePath
-		cacheHit = true
+	if ke, ok := c.keys[key]; ok {
+		if m, ok := c.modules[ke.checksum]; ok {
+			// Update last touched time.
+			ke.last = time.Now()
+			modulePath = m.modulePath
+			cacheHit = true
+		}
 	}
 	wasmCacheLookupCount.With(hitTag.Value(strconv.FormatBool(cacheHit))).Increment()
 	return modulePath
 }
 
+// getEntryByImageDigest returns the path of the module already fetched from an image with the digest, possibly
+// through another URL, for the namespace of the cache key, and references it with the cache key.
+func (c *LocalFileCache) getEntryByImageDigest(key cacheKey, imageDigest string) string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	checksum, ok := c.imageDigests[imageDigestKey{digest: imageDigest, namespace: key.namespace}]
+	if !ok {
+		return ""
+	}
+	m, ok := c.modules[checksum]
+	if !ok {
+		return ""
+	}
+	c.referenceModule(cacheKey{downloadURL: key.downloadURL, checksum: imageDigest, namespace: key.namespace}, checksum)
+	return m.modulePath
+}
+
 // Purge periodically clean up the stale Wasm modules local file and the cache map.
 func (c *LocalFileCache) purge() {
 	ticker := time.NewTicker(c.purgeInterval)
@@ -228,20 +436,7 @@ func (c *LocalFileCache) purge() {
 	for {
 		select {
 		case <-ticker.C:
-			c.mux.Lock()
-			for k, m := range c.modules {
-				if m.expired(c.wasmModuleExpiry) {
-					// The module has not be touched for expiry duration, delete it from the map as well as the local dir.
-					if err := os.Remove(m.modulePath); err != nil {
-						wasmLog.Errorf("failed to purge Wasm module %v: %v", m.modulePath, err)
-					} else {
-						delete(c.modules, k)
-						wasmLog.Debugf("successfully removed stale Wasm module %v", m.modulePath)
-					}
-				}
-			}
-			wasmCacheEntries.Record(float64(len(c.modules)))
-			c.mux.Unlock()
+			c.purgeStale()
 		case <-c.stopChan:
 			// Currently this will only happen in test.
 			return
@@ -249,10 +444,41 @@ func (c *LocalFileCache) purge() {
 	}
 }
 
-// Expired returns true if the module has not been touched for Wasm module Expiry.
-func (ce *cacheEntry) expired(expiry time.Duration) bool {
+// purgeStale removes the cache keys which have not been referenced for the expiry duration, and the Wasm modules
+// no longer referenced by any key.
+func (c *LocalFileCache) purgeStale() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for k, ke := range c.keys {
+		if ke.expired(c.wasmModuleExpiry) {
+			delete(c.keys, k)
+			c.releaseModule(ke.checksum)
+		}
+	}
+	for checksum, m := range c.modules {
+		if m.referencingKeys > 0 {
+			continue
+		}
+		// The module is not used anymore, delete it from the map as well as the local dir.
+		if err := os.Remove(m.modulePath); err != nil && !os.IsNotExist(err) {
+			wasmLog.Errorf("failed to purge Wasm module %v: %v", m.modulePath, err)
+			continue
+		}
+		delete(c.modules, checksum)
+		for d, dChecksum := range c.imageDigests {
+			if dChecksum == checksum {
+				delete(c.imageDigests, d)
+			}
+		}
+		wasmLog.Debugf("successfully removed stale Wasm module %v", m.modulePath)
+	}
+	wasmCacheEntries.Record(float64(len(c.modules)))
+}
+
+// Expired returns true if the cache key has not been touched for Wasm module Expiry.
+func (ke *keyEntry) expired(expiry time.Duration) bool {
 	now := time.Now()
-	return now.Sub(ce.last) > expiry
+	return now.Sub(ke.last) > expiry
 }
 
 var wasmMagicNumber = []byte{0x00, 0x61, 0x73, 0x6d}
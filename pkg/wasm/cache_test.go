@@ -17,6 +17,7 @@ package wasm
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -24,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -32,6 +34,8 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"istio.io/istio/pkg/test/util/retry"
 )
 
 // Wasm header = magic number (4 bytes) + Wasm spec version (4 bytes).
@@ -123,6 +127,7 @@ func TestWasmCache(t *testing.T) {
 			fetchURL:             "https://dummyurl",
 			purgeInterval:        DefaultWasmModulePurgeInterval,
 			wasmModuleExpiry:     DefaultWasmModuleExpiry,
+			checksum:             httpDataCheckSum,
 			wantErrorMsgPrefix:   "wasm module download failed, last error: Get \"https://dummyurl\"",
 			wantServerReqNum:     0,
 		},
@@ -224,7 +229,7 @@ func TestWasmCache(t *testing.T) {
 			checksum:             invalidOCIImageDigest,
 			requestTimeout:       time.Second * 10,
 			wantErrorMsgPrefix: `could not fetch Wasm OCI image: the given image is in invalid format as an OCI image: 2 errors occurred:
-	* could not parse as compat variant: invalid media type application/vnd.oci.image.layer.v1.tar (expect application/vnd.oci.image.layer.v1.tar+gzip)
+	* could not parse as compat variant: could not extract wasm binary: plugin.wasm not found in the archive
 	* could not parse as oci variant: number of layers must be 2 but got 1`,
 		},
 	}
@@ -243,8 +248,8 @@ func TestWasmCache(t *testing.T) {
 				if err != nil {
 					t.Fatalf("failed to write initial wasm module file %v", err)
 				}
-				cache.modules[cacheKey{downloadURL: k.downloadURL, checksum: k.checksum}] =
-					cacheEntry{modulePath: filePath, last: time.Now()}
+				cache.modules[k.checksum] = &cacheEntry{modulePath: filePath, referencingKeys: 1}
+				cache.keys[k] = &keyEntry{checksum: k.checksum, last: time.Now()}
 			}
 			cache.mux.Unlock()
 
@@ -262,7 +267,7 @@ func TestWasmCache(t *testing.T) {
 				}
 			}
 
-			gotFilePath, gotErr := cache.Get(c.fetchURL, c.checksum, c.requestTimeout)
+			gotFilePath, gotErr := cache.Get(c.fetchURL, c.checksum, c.requestTimeout, "", nil)
 			wantFilePath := filepath.Join(tmpDir, c.wantFileName)
 			if c.wantErrorMsgPrefix != "" {
 				if gotErr == nil {
@@ -283,6 +288,131 @@ func TestWasmCache(t *testing.T) {
 	}
 }
 
+func TestWasmCacheSharedImage(t *testing.T) {
+	var blobFetches int32
+	reg := registry.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			atomic.AddInt32(&blobFetches, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two plugins reference the same image through different tags.
+	image := pushWasmImages(t, u.Host, "v1")[0]
+	if err := crane.Tag(strings.TrimPrefix(image.URL, "oci://"), "shared"); err != nil {
+		t.Fatal(err)
+	}
+	first, second := image.URL, strings.TrimSuffix(image.URL, ":v1")+":shared"
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	firstPath, err := cache.Get(first, "", time.Minute, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := atomic.LoadInt32(&blobFetches)
+	secondPath, err := cache.Get(second, "", time.Minute, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstPath != secondPath {
+		t.Fatalf("expected the module to be shared, got %v and %v", firstPath, secondPath)
+	}
+	if got := atomic.LoadInt32(&blobFetches); got != fetches {
+		t.Fatalf("expected the shared module to be fetched once, got %d blob fetches for the second tag", got-fetches)
+	}
+	if len(cache.modules) != 1 {
+		t.Fatalf("expected a single cached module, got %d", len(cache.modules))
+	}
+
+	expire := func(downloadURL string) {
+		cache.mux.Lock()
+		for k, ke := range cache.keys {
+			if k.downloadURL == downloadURL {
+				ke.last = time.Now().Add(-2 * DefaultWasmModuleExpiry)
+			}
+		}
+		cache.mux.Unlock()
+		cache.purgeStale()
+	}
+	// The module is still used through the second tag.
+	expire(first)
+	if _, err := os.Stat(firstPath); err != nil {
+		t.Fatalf("expected the module still referenced by %v to be kept: %v", second, err)
+	}
+	if path, err := cache.Get(second, "", time.Minute, "", nil); err != nil || path != secondPath {
+		t.Fatalf("expected the module to be served from the cache, got %v, %v", path, err)
+	}
+	if got := atomic.LoadInt32(&blobFetches); got != fetches {
+		t.Fatalf("expected the module to be served from the cache, got %d blob fetches", got-fetches)
+	}
+
+	// Once no plugin references the module, it is removed.
+	expire(second)
+	if _, err := os.Stat(secondPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the unreferenced module to be removed, got %v", err)
+	}
+	if len(cache.modules) != 0 || len(cache.imageDigests) != 0 {
+		t.Fatalf("expected no cached modules, got %d modules and %d image digests", len(cache.modules), len(cache.imageDigests))
+	}
+}
+
+func TestWasmCacheNamespacedCredentials(t *testing.T) {
+	var requireAuth, blobFetches int32
+	reg := registry.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&requireAuth) == 1 && r.Header.Get("Authorization") != "Basic "+dockerAuth("tenant", "secret") {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			atomic.AddInt32(&blobFetches, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := pushWasmImages(t, u.Host, "v1")[0]
+	atomic.StoreInt32(&requireAuth, 1)
+	pullSecret := []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, u.Host, dockerAuth("tenant", "secret")))
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	cache.RestrictGlobalCredentials([]string{"istio-system"})
+	defer close(cache.stopChan)
+
+	for _, checksum := range []string{"", image.Checksum} {
+		if _, err := cache.Get(image.URL, checksum, time.Minute, "tenant-a", pullSecret); err != nil {
+			t.Fatalf("expected the module to be fetched with the pull secret of the namespace: %v", err)
+		}
+	}
+	fetches := atomic.LoadInt32(&blobFetches)
+	if _, err := cache.Get(image.URL, image.Checksum, time.Minute, "tenant-a", pullSecret); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&blobFetches); got != fetches {
+		t.Fatalf("expected the module to be served from the cache, got %d blob fetches", got-fetches)
+	}
+
+	// The module fetched with the credentials of tenant-a is not available to other namespaces.
+	for _, ns := range []string{"tenant-b", "istio-system", ""} {
+		for _, checksum := range []string{"", image.Checksum} {
+			if _, err := cache.Get(image.URL, checksum, time.Minute, ns, nil); err == nil {
+				t.Fatalf("expected the module of tenant-a not to be available to namespace %q", ns)
+			}
+		}
+	}
+}
+
 func setupOCIRegistry(t *testing.T, host string) (wantBinaryCheckSum, dockerImageDigest, invalidOCIImageDigest string) {
 	// Push *compat* variant docker image (others are well tested in imagefetcher's test and the behavior is consistent).
 	ref := fmt.Sprintf("%s/test/valid/docker:v0.1.0", host)
@@ -320,7 +450,7 @@ func setupOCIRegistry(t *testing.T, host string) (wantBinaryCheckSum, dockerImag
 
 	// Finally push the invalid image.
 	ref = fmt.Sprintf("%s/test/invalid", host)
-	l, err = newMockLayer(types.OCIUncompressedLayer, map[string][]byte{"not-wasm.txt": []byte("a")})
+	l, err = newUncompressedLayer(types.OCIUncompressedLayer, map[string][]byte{"not-wasm.txt": []byte("a")})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -370,7 +500,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 
 	// Get wasm module three times, since checksum is not specified, it will be fetched from module server every time.
 	// 1st time
-	gotFilePath, err := cache.Get(ts.URL, "", 0)
+	gotFilePath, err := cache.Get(ts.URL, "", 0, "", nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -379,7 +509,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 2nd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, "", nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -388,7 +518,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 3rd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, "", nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -401,3 +531,305 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 		t.Errorf("wasm download call got %v want %v", gotNumRequest, wantNumRequest)
 	}
 }
+
+func TestWasmCacheCircuitBreaking(t *testing.T) {
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCacheWithLimits(tmpDir, DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry, FetchLimits{
+		MaxConcurrentFetchesPerHost: 1,
+		CircuitBreakerThreshold:     2,
+		CircuitBreakerCooldown:      time.Minute,
+	})
+	defer close(cache.stopChan)
+
+	failingNumRequest := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingNumRequest++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+	binary := append(wasmHeader, 1)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer healthy.Close()
+
+	// Fail until the circuit opens.
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(failing.URL, "", 0, "", nil); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("expected download failure, got %v", err)
+		}
+	}
+	if _, err := cache.Get(failing.URL, "", 0, "", nil); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected circuit to be open, got %v", err)
+	}
+	if failingNumRequest != 2 {
+		t.Errorf("failing server got %v requests, want 2", failingNumRequest)
+	}
+
+	// The healthy host is not impacted.
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(healthy.URL, "", 0, "", nil); err != nil {
+			t.Fatalf("failed to download Wasm module: %v", err)
+		}
+	}
+
+	// Once the cooldown expires, the failing host is attempted again.
+	cache.fetchLimiter.now = func() time.Time {
+		return time.Now().Add(2 * time.Minute)
+	}
+	if _, err := cache.Get(failing.URL, "", 0, "", nil); err == nil || errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected download failure, got %v", err)
+	}
+	if failingNumRequest != 3 {
+		t.Errorf("failing server got %v requests, want 3", failingNumRequest)
+	}
+}
+
+func TestWasmCacheHTTPS(t *testing.T) {
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	gotNumRequest := 0
+	binary := append(wasmHeader, []byte("served over https")...)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotNumRequest++
+		w.Write(binary)
+	}))
+	defer ts.Close()
+	cache.httpFetcher.defaultClient = ts.Client()
+	checksum := fmt.Sprintf("%x", sha256.Sum256(binary))
+	wrongChecksum := fmt.Sprintf("%x", sha256.Sum256([]byte("other")))
+
+	if _, err := cache.Get(ts.URL, "", 0, "", nil); err == nil || !strings.Contains(err.Error(), "sha256 checksum is required") {
+		t.Fatalf("expected checksum to be required, got %v", err)
+	}
+	if gotNumRequest != 0 {
+		t.Fatalf("module without checksum should not be downloaded, got %v requests", gotNumRequest)
+	}
+
+	if _, err := cache.Get(ts.URL, wrongChecksum, 0, "", nil); err == nil || !strings.Contains(err.Error(), "which does not match") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	wantFilePath := filepath.Join(tmpDir, fmt.Sprintf("%s.wasm", checksum))
+	for i := 0; i < 2; i++ {
+		gotFilePath, err := cache.Get(ts.URL, checksum, time.Second, "", nil)
+		if err != nil {
+			t.Fatalf("failed to download Wasm module: %v", err)
+		}
+		if gotFilePath != wantFilePath {
+			t.Errorf("wasm download path got %v want %v", gotFilePath, wantFilePath)
+		}
+	}
+	// The second Get is served from the cache.
+	if gotNumRequest != 2 {
+		t.Errorf("wasm download call got %v want %v", gotNumRequest, 2)
+	}
+}
+
+func TestWasmCacheFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	binary := append(wasmHeader, []byte("served from a file")...)
+	src := filepath.Join(t.TempDir(), "plugin.wasm")
+	if err := os.WriteFile(src, binary, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(binary))
+
+	gotFilePath, err := cache.Get("file://"+src, checksum, 0, "", nil)
+	if err != nil {
+		t.Fatalf("failed to read Wasm module: %v", err)
+	}
+	if want := filepath.Join(tmpDir, fmt.Sprintf("%s.wasm", checksum)); gotFilePath != want {
+		t.Errorf("wasm path got %v want %v", gotFilePath, want)
+	}
+
+	if _, err := cache.Get("file://"+src, fmt.Sprintf("%x", sha256.Sum256([]byte("other"))), 0, "", nil); err == nil {
+		t.Fatalf("expected checksum mismatch")
+	}
+	if _, err := cache.Get("file://"+filepath.Join(tmpDir, "missing.wasm"), "", 0, "", nil); err == nil {
+		t.Fatalf("expected missing file to fail")
+	}
+
+	cache.httpFetcher.maxSize = int64(len(binary) - 1)
+	if _, err := cache.Get("file://"+src, "", 0, "", nil); err == nil || !strings.Contains(err.Error(), "size limit") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+}
+
+func TestWasmCacheFetchStatus(t *testing.T) {
+	// Set up a fake registry for OCI images, which blocks blob downloads until released. Pushing images only
+	// checks for existing blobs, so it is not blocked.
+	release := make(chan struct{})
+	reg := registry.New()
+	tos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			<-release
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer tos.Close()
+	ou, err := url.Parse(tos.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dockerImageDigest, _ := setupOCIRegistry(t, ou.Host)
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+	ref := fmt.Sprintf("oci://%s/test/valid/docker:v0.1.0", ou.Host)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(ref, dockerImageDigest, time.Minute, "", nil)
+		errCh <- err
+	}()
+
+	// The fetch is reported while it is blocked on downloading the module.
+	retry.UntilSuccessOrFail(t, func() error {
+		status := cache.FetchStatus()
+		if len(status) != 1 {
+			return fmt.Errorf("expected 1 fetch, got %v", status)
+		}
+		if status[0].Reference != ref || status[0].State != FetchStateDownloading || status[0].Attempts != 1 {
+			return fmt.Errorf("unexpected fetch status: %+v", status[0])
+		}
+		if status[0].Digest != "sha256:"+dockerImageDigest {
+			return fmt.Errorf("expected resolved digest, got %+v", status[0])
+		}
+		return nil
+	}, retry.Timeout(10*time.Second), retry.Delay(10*time.Millisecond))
+
+	close(release)
+	if err := <-errCh; err != nil {
+		t.Fatalf("failed to fetch Wasm module: %v", err)
+	}
+	status := cache.FetchStatus()
+	if len(status) != 1 || status[0].State != FetchStateCached || status[0].BytesTransferred == 0 {
+		t.Fatalf("unexpected fetch status: %+v", status)
+	}
+	if status[0].LastErrorClass != "" {
+		t.Fatalf("unexpected error for successful fetch: %+v", status[0])
+	}
+
+	// A failed fetch records the class of the error.
+	if _, err := cache.Get(ref, "0000", time.Minute, "", nil); err == nil {
+		t.Fatal("expected digest mismatch")
+	}
+	status = cache.FetchStatus()
+	if len(status) != 2 || status[0].State != FetchStateFailed || status[0].LastErrorClass != checksumMismatch {
+		t.Fatalf("unexpected fetch status: %+v", status)
+	}
+}
+
+func TestWasmCacheChecksumFile(t *testing.T) {
+	binary := append(wasmHeader, []byte("checksum file")...)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(binary))
+	wrongChecksum := fmt.Sprintf("%x", sha256.Sum256([]byte("other")))
+	cases := []struct {
+		name string
+		// checksumFile is the content of the checksum file, or empty if there is none.
+		checksumFile string
+		https        bool
+		// checksum is the configured checksum.
+		checksum      string
+		wantErr       string
+		wantErrClass  string
+		wantModuleReq int
+	}{
+		{
+			name:          "matching",
+			checksumFile:  checksum + "  plugin.wasm\n",
+			https:         true,
+			wantModuleReq: 1,
+		},
+		{
+			name:          "mismatching",
+			checksumFile:  wrongChecksum + "\n",
+			https:         true,
+			wantErr:       "which does not match",
+			wantErrClass:  checksumMismatch,
+			wantModuleReq: 1,
+		},
+		{
+			name:         "invalid",
+			checksumFile: "not a checksum\n",
+			https:        true,
+			wantErr:      "invalid wasm module checksum file",
+			wantErrClass: downloadFailure,
+		},
+		{
+			name:         "missing over https",
+			https:        true,
+			wantErr:      "which has no checksum file",
+			wantErrClass: checksumMissing,
+		},
+		{
+			name:          "missing over http",
+			wantModuleReq: 1,
+		},
+		{
+			name:          "configured checksum takes precedence",
+			checksumFile:  wrongChecksum + "\n",
+			https:         true,
+			checksum:      checksum,
+			wantModuleReq: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+			defer close(cache.stopChan)
+			cache.UseChecksumFiles()
+
+			moduleReq := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/plugin.wasm":
+					moduleReq++
+					w.Write(binary)
+				case "/plugin.wasm.sha256":
+					if c.checksumFile == "" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Write([]byte(c.checksumFile))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			var ts *httptest.Server
+			if c.https {
+				ts = httptest.NewTLSServer(handler)
+				cache.httpFetcher.defaultClient = ts.Client()
+			} else {
+				ts = httptest.NewServer(handler)
+			}
+			defer ts.Close()
+
+			gotFilePath, err := cache.Get(ts.URL+"/plugin.wasm", c.checksum, time.Second, "", nil)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("expected error %q, got %v", c.wantErr, err)
+				}
+				if status := cache.FetchStatus(); len(status) != 1 || status[0].LastErrorClass != c.wantErrClass {
+					t.Errorf("expected error class %v, got %+v", c.wantErrClass, status)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("failed to download Wasm module: %v", err)
+				}
+				if want := filepath.Join(tmpDir, fmt.Sprintf("%s.wasm", checksum)); gotFilePath != want {
+					t.Errorf("wasm download path got %v want %v", gotFilePath, want)
+				}
+			}
+			if moduleReq != c.wantModuleReq {
+				t.Errorf("module download call got %v want %v", moduleReq, c.wantModuleReq)
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
 	"go.uber.org/atomic"
 	any "google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pilot/pkg/model"
 )
 
 const (
@@ -164,7 +166,18 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	if remote.GetHttpUri().Timeout != nil {
 		timeout = remote.GetHttpUri().Timeout.AsDuration()
 	}
-	f, err := cache.Get(httpURI.GetUri(), remote.Sha256, timeout)
+	var pullSecret []byte
+	var namespace string
+	if envs := vm.GetEnvironmentVariables(); envs != nil {
+		if secret, f := envs.KeyValues[model.WasmSecretEnv]; f {
+			pullSecret = []byte(secret)
+			// The pull secret is only meant for the agent, never expose it to the Wasm VM.
+			delete(envs.KeyValues, model.WasmSecretEnv)
+		}
+		namespace = envs.KeyValues[model.WasmNamespaceEnv]
+		delete(envs.KeyValues, model.WasmNamespaceEnv)
+	}
+	f, err := cache.Get(httpURI.GetUri(), remote.Sha256, timeout, namespace, pullSecret)
 	if err != nil {
 		status = fetchFailure
 		wasmLog.Errorf("cannot fetch Wasm module %v: %v", remote.GetHttpUri().GetUri(), err)
@@ -15,17 +15,36 @@
 package wasm
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 )
 
+// DefaultMaxWasmModuleSize is the default maximum size of a Wasm module fetched over HTTP or read from a file.
+const DefaultMaxWasmModuleSize int64 = 256 * 1024 * 1024
+
+const (
+	// checksumFileSuffix is appended to the URL of a module to fetch its detached sha256 checksum file.
+	checksumFileSuffix = ".sha256"
+	// maxChecksumFileSize is the maximum size of a checksum file, which holds a digest and optionally a file name.
+	maxChecksumFileSize = 4096
+)
+
 // HTTPFetcher fetches remote wasm module with HTTP get.
 type HTTPFetcher struct {
 	defaultClient *http.Client
+	// maxSize is the maximum size of a module; larger modules are rejected.
+	maxSize int64
 }
 
 // NewHTTPFetcher create a new HTTP remote wasm module fetcher.
@@ -34,16 +53,30 @@ func NewHTTPFetcher() *HTTPFetcher {
 		defaultClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		maxSize: DefaultMaxWasmModuleSize,
 	}
 }
 
 // Fetch downloads a wasm module with HTTP get.
 func (f *HTTPFetcher) Fetch(url string, timeout time.Duration) ([]byte, error) {
+	return f.fetch(url, timeout, nil)
+}
+
+// fetch downloads a wasm module with HTTP get, recording the progress with the tracker.
+func (f *HTTPFetcher) fetch(url string, timeout time.Duration, tracker *fetchTracker) ([]byte, error) {
 	c := f.defaultClient
 	if timeout != 0 {
-		c = &http.Client{
-			Timeout: timeout,
-		}
+		// Copy the client to keep its transport, which may be configured with custom CAs.
+		cc := *f.defaultClient
+		cc.Timeout = timeout
+		c = &cc
+	}
+	// The delays requested by rate limiting servers are bounded by the fetch timeout.
+	ctx := context.Background()
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 	attempts := 0
 
@@ -51,19 +84,42 @@ func (f *HTTPFetcher) Fetch(url string, timeout time.Duration) ([]byte, error) {
 	var lastError error
 	for attempts < 5 {
 		attempts++
+		tracker.attempt()
 		resp, err := c.Get(url)
 		if err != nil {
 			lastError = err
+			tracker.recordError(downloadFailure, err)
 			wasmLog.Debugf("wasm module download request failed: %v", err)
 			time.Sleep(b.NextBackOff())
 			continue
 		}
 		if resp.StatusCode == http.StatusOK {
-			body, err := io.ReadAll(resp.Body)
+			if resp.ContentLength > f.maxSize {
+				resp.Body.Close()
+				return nil, fmt.Errorf("wasm module download failed: size %d exceeds the limit of %d bytes", resp.ContentLength, f.maxSize)
+			}
+			body, err := readLimited(tracker.reader(resp.Body), f.maxSize)
 			resp.Body.Close()
 			return body, err
 		}
 		lastError = fmt.Errorf("wasm module download request failed: status code %v", resp.StatusCode)
+		tracker.recordError(downloadFailure, lastError)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			host := resp.Request.URL.Host
+			recordRateLimited(host)
+			delay, ok := rateLimitDelay(resp, time.Now())
+			if !ok {
+				delay = b.NextBackOff()
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			wasmLog.Debugf("wasm module download rate limited by %s, retrying after %v", host, delay)
+			if err := waitRateLimit(ctx, host, delay); err != nil {
+				lastError = err
+				break
+			}
+			continue
+		}
 		if retryable(resp.StatusCode) {
 			body, _ := io.ReadAll(resp.Body)
 			wasmLog.Debugf("wasm module download failed: status code %v, body %v", resp.StatusCode, string(body))
@@ -77,9 +133,103 @@ func (f *HTTPFetcher) Fetch(url string, timeout time.Duration) ([]byte, error) {
 	return nil, fmt.Errorf("wasm module download failed, last error: %v", lastError)
 }
 
+// fetchChecksum fetches the sha256 checksum file published next to the module at moduleURL, in the format written by
+// sha256sum. It returns an empty checksum, and no error, if the server has no checksum file.
+func (f *HTTPFetcher) fetchChecksum(moduleURL string, timeout time.Duration) (string, error) {
+	u, err := url.Parse(moduleURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		// There is no module file name to add the suffix to.
+		return "", nil
+	}
+	u.Path += checksumFileSuffix
+	u.RawPath = ""
+	checksumURL := u.String()
+	c := f.defaultClient
+	if timeout != 0 {
+		cc := *f.defaultClient
+		cc.Timeout = timeout
+		c = &cc
+	}
+	resp, err := c.Get(checksumURL)
+	if err != nil {
+		return "", fmt.Errorf("wasm module checksum download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("wasm module checksum download from %v failed: status code %v", checksumURL, resp.StatusCode)
+	}
+	b, err := readLimited(resp.Body, maxChecksumFileSize)
+	if err != nil {
+		return "", fmt.Errorf("wasm module checksum download from %v failed: %v", checksumURL, err)
+	}
+	checksum, err := parseChecksumFile(b, path.Base(resp.Request.URL.Path))
+	if err != nil {
+		return "", fmt.Errorf("invalid wasm module checksum file %v: %v", checksumURL, err)
+	}
+	return checksum, nil
+}
+
+// parseChecksumFile parses a checksum file holding a single line with the hex encoded sha256 checksum of the module,
+// optionally followed by the file name of the module as written by sha256sum. checksumFile is the name of the
+// checksum file, which is the file name of the module with the checksum file suffix.
+func parseChecksumFile(b []byte, checksumFile string) (string, error) {
+	content := strings.TrimSuffix(string(b), "\n")
+	if strings.ContainsAny(content, "\r\n") {
+		return "", fmt.Errorf("expected a single line")
+	}
+	checksum, name := content, ""
+	if i := strings.IndexByte(content, ' '); i >= 0 {
+		checksum, name = content[:i], content[i+1:]
+		// sha256sum separates the file name with a space, followed by '*' in binary mode or a space in text mode.
+		if !strings.HasPrefix(name, " ") && !strings.HasPrefix(name, "*") {
+			return "", fmt.Errorf("expected the checksum to be separated from the file name by two spaces or \" *\"")
+		}
+		name = name[1:]
+		if want := strings.TrimSuffix(checksumFile, checksumFileSuffix); name != want {
+			return "", fmt.Errorf("checksum is for file %q, expected %q", name, want)
+		}
+	}
+	if len(checksum) != hex.EncodedLen(sha256.Size) {
+		return "", fmt.Errorf("expected a hex encoded sha256 checksum, got %q", checksum)
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return "", fmt.Errorf("expected a hex encoded sha256 checksum, got %q", checksum)
+	}
+	return strings.ToLower(checksum), nil
+}
+
 func retryable(code int) bool {
 	return code >= 500 &&
 		!(code == http.StatusNotImplemented ||
 			code == http.StatusHTTPVersionNotSupported ||
 			code == http.StatusNetworkAuthenticationRequired)
 }
+
+// readLimited reads r until EOF, failing if more than maxSize bytes are read.
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxSize {
+		return nil, fmt.Errorf("wasm module exceeds the size limit of %d bytes", maxSize)
+	}
+	return b, nil
+}
+
+// readWasmFile reads a wasm module from the local file system.
+func readWasmFile(path string, maxSize int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("wasm module read failed: %v", err)
+	}
+	defer f.Close()
+	return readLimited(f, maxSize)
+}
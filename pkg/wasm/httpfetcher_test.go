@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWasmHTTPFetch(t *testing.T) {
@@ -84,3 +86,132 @@ func TestWasmHTTPFetch(t *testing.T) {
 		})
 	}
 }
+
+func TestWasmHTTPFetchSizeLimit(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "content length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "too large")
+			},
+		},
+		{
+			name: "chunked",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "too ")
+				w.(http.Flusher).Flush()
+				fmt.Fprint(w, "large")
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := httptest.NewServer(c.handler)
+			defer ts.Close()
+			fetcher := NewHTTPFetcher()
+			fetcher.maxSize = 4
+			if _, err := fetcher.Fetch(ts.URL, 0); err == nil {
+				t.Fatalf("expected size limit error")
+			}
+		})
+	}
+}
+
+func TestWasmHTTPFetchRateLimited(t *testing.T) {
+	cases := []struct {
+		name           string
+		retryAfter     string
+		timeout        time.Duration
+		wantNumRequest int
+		wantError      bool
+	}{
+		{
+			name:           "retry after delay",
+			retryAfter:     "1",
+			wantNumRequest: 2,
+		},
+		{
+			name:           "delay exceeds timeout",
+			retryAfter:     "60",
+			timeout:        5 * time.Second,
+			wantNumRequest: 1,
+			wantError:      true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gotNumRequest := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotNumRequest++
+				if gotNumRequest == 1 {
+					w.Header().Set("Retry-After", c.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				fmt.Fprintln(w, "wasm")
+			}))
+			defer ts.Close()
+			fetcher := NewHTTPFetcher()
+			start := time.Now()
+			b, err := fetcher.Fetch(ts.URL, c.timeout)
+			elapsed := time.Since(start)
+			if gotNumRequest != c.wantNumRequest {
+				t.Errorf("Wasm download request got %v, want %v", gotNumRequest, c.wantNumRequest)
+			}
+			if c.wantError {
+				if err == nil {
+					t.Fatal("Wasm download got no error, want rate limit error")
+				}
+				if elapsed > c.timeout {
+					t.Fatalf("expected the fetch to fail without waiting, took %v", elapsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wasm download got error %v", err)
+			}
+			if string(b) != "wasm\n" {
+				t.Errorf("downloaded wasm module got %v, want wasm", string(b))
+			}
+			if elapsed < time.Second {
+				t.Errorf("expected the retry to wait for the Retry-After delay, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	checksum := strings.Repeat("ab", 32)
+	cases := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "checksum", content: checksum, want: checksum},
+		{name: "trailing newline", content: checksum + "\n", want: checksum},
+		{name: "uppercase", content: strings.ToUpper(checksum), want: checksum},
+		{name: "text mode file name", content: checksum + "  plugin.wasm\n", want: checksum},
+		{name: "binary mode file name", content: checksum + " *plugin.wasm\n", want: checksum},
+		{name: "other file name", content: checksum + "  other.wasm\n", wantErr: true},
+		{name: "single space", content: checksum + " plugin.wasm\n", wantErr: true},
+		{name: "multiple lines", content: checksum + "\n" + checksum + "\n", wantErr: true},
+		{name: "short", content: checksum[2:], wantErr: true},
+		{name: "not hex", content: strings.Repeat("zz", 32), wantErr: true},
+		{name: "empty", content: "", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseChecksumFile([]byte(c.content), "plugin.wasm.sha256")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if got != c.want {
+				t.Fatalf("got checksum %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path/filepath"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -40,30 +41,77 @@ var errWasmOCIImageDigestMismatch = errors.New("fetched image's digest does not
 type ImageFetcherOption struct {
 	Username string
 	Password string
+	// PullSecret is a docker config JSON holding the image pull secrets resolved by istiod for the module, either
+	// the secret referenced by the WasmPlugin or those of the workload's service account.
+	PullSecret []byte
+	// Namespace is the namespace of the WasmPlugin the module is fetched for. It is empty for modules fetched by the
+	// agent itself.
+	Namespace string
 	// TODO(mathetake) Add signature verification stuff.
+
+	// credentials, if set, restricts the credentials available to the namespace.
+	credentials *credentialResolver
+	// tracker, if set, records the progress of the fetch.
+	tracker *fetchTracker
 }
 
 func (o *ImageFetcherOption) useDefaultKeyChain() bool {
 	return o.Username == "" || o.Password == ""
 }
 
+// keychain returns the keychain used when no explicit credentials are set.
+func (o *ImageFetcherOption) keychain() authn.Keychain {
+	credentials := o.credentials
+	if credentials == nil {
+		credentials = newCredentialResolver(nil)
+	}
+	return credentials.keychain(o.Namespace, o.PullSecret)
+}
+
 type ImageFetcher struct {
 	fetchOpts []remote.Option
+	tracker   *fetchTracker
 }
 
 func NewImageFetcher(ctx context.Context, opt ImageFetcherOption) *ImageFetcher {
-	fetchOpts := make([]remote.Option, 0, 2)
+	fetchOpts := make([]remote.Option, 0, 3)
 	// TODO(mathetake): have "Anonymous" option?
 	if opt.useDefaultKeyChain() {
-		// Note that default key chain reads the docker config from DOCKER_CONFIG
-		// so must set the envvar when reaching this branch is expected.
-		fetchOpts = append(fetchOpts, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		fetchOpts = append(fetchOpts, remote.WithAuthFromKeychain(opt.keychain()))
 	} else {
-		fetchOpts = append(fetchOpts, remote.WithAuth(&authn.Basic{Username: opt.Username}))
+		fetchOpts = append(fetchOpts, remote.WithAuth(&authn.Basic{Username: opt.Username, Password: opt.Password}))
 	}
+	// Honor the delay requested by registries rate limiting pulls, rather than failing the fetch.
+	var transport http.RoundTripper = &rateLimitTransport{base: http.DefaultTransport}
+	if opt.tracker != nil {
+		transport = &countingTransport{base: transport, tracker: opt.tracker}
+	}
+	fetchOpts = append(fetchOpts, remote.WithTransport(transport))
 	return &ImageFetcher{
 		fetchOpts: append(fetchOpts, remote.WithContext(ctx)),
+		tracker:   opt.tracker,
+	}
+}
+
+// ResolveDigest returns the hex encoded digest of the image manifest the url refers to. Tags are resolved with a
+// HEAD request to the registry, without fetching the image.
+func (o *ImageFetcher) ResolveDigest(url string) (string, error) {
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return "", fmt.Errorf("could not parse url in image reference: %v", err)
+	}
+	if d, ok := ref.(name.Digest); ok {
+		h, err := v1.NewHash(d.DigestStr())
+		if err != nil {
+			return "", fmt.Errorf("could not parse digest in image reference: %v", err)
+		}
+		return h.Hex, nil
+	}
+	desc, err := remote.Head(ref, o.fetchOpts...)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch image: %v", err)
 	}
+	return desc.Digest.Hex, nil
 }
 
 // Fetch is the entrypoint for fetching Wasm binary from Wasm Image Specification compatible images.
@@ -81,6 +129,7 @@ func (o *ImageFetcher) Fetch(url, expManifestDigest string) ([]byte, error) {
 
 	// Check Manifest's digest if expManifestDigest is not empty.
 	d, _ := img.Digest()
+	o.tracker.setDigest(d.String())
 	if expManifestDigest != "" && d.Hex != expManifestDigest {
 		return nil, fmt.Errorf("%w: got %s, but want %s", errWasmOCIImageDigestMismatch, d.Hex, expManifestDigest)
 	}
@@ -101,7 +150,8 @@ func (o *ImageFetcher) Fetch(url, expManifestDigest string) ([]byte, error) {
 		return ret, nil
 	}
 
-	// We try to parse it as the "compat" variant image with a single "application/vnd.oci.image.layer.v1.tar+gzip" layer.
+	// We try to parse it as the "compat" variant image with a single "application/vnd.oci.image.layer.v1.tar+gzip" layer,
+	// or its uncompressed equivalent.
 	ret, errCompat := extractOCIStandardImage(img)
 	if errCompat == nil {
 		return ret, nil
@@ -123,7 +173,8 @@ func (o *ImageFetcher) Fetch(url, expManifestDigest string) ([]byte, error) {
 }
 
 // extractDockerImage extracts the Wasm binary from the
-// *compat* variant Wasm image with the standard Docker media type: application/vnd.docker.image.rootfs.diff.tar.gzip.
+// *compat* variant Wasm image with the standard Docker media type: application/vnd.docker.image.rootfs.diff.tar.gzip,
+// or its uncompressed equivalent application/vnd.docker.image.rootfs.diff.tar.
 // https://github.com/solo-io/wasm/blob/master/spec/spec-compat.md#specification
 func extractDockerImage(img v1.Image) ([]byte, error) {
 	layers, err := img.Layers()
@@ -142,26 +193,17 @@ func extractDockerImage(img v1.Image) ([]byte, error) {
 		return nil, fmt.Errorf("could not get media type: %v", err)
 	}
 
-	// Media type must be application/vnd.docker.image.rootfs.diff.tar.gzip.
-	if mt != types.DockerLayer {
-		return nil, fmt.Errorf("invalid media type %s (expect %s)", mt, types.DockerLayer)
+	// Media type must be application/vnd.docker.image.rootfs.diff.tar.gzip or application/vnd.docker.image.rootfs.diff.tar.
+	if mt != types.DockerLayer && mt != types.DockerUncompressedLayer {
+		return nil, fmt.Errorf("invalid media type %s (expect %s or %s)", mt, types.DockerLayer, types.DockerUncompressedLayer)
 	}
 
-	r, err := layer.Compressed()
-	if err != nil {
-		return nil, fmt.Errorf("could not get layer content: %v", err)
-	}
-	defer r.Close()
-
-	ret, err := extractWasmPluginBinary(r)
-	if err != nil {
-		return nil, fmt.Errorf("could not extract wasm binary: %v", err)
-	}
-	return ret, nil
+	return extractCompatLayer(layer, mt == types.DockerLayer)
 }
 
 // extractOCIStandardImage extracts the Wasm binary from the
-// *compat* variant Wasm image with the standard OCI media type: application/vnd.oci.image.layer.v1.tar+gzip.
+// *compat* variant Wasm image with the standard OCI media type: application/vnd.oci.image.layer.v1.tar+gzip,
+// or its uncompressed equivalent application/vnd.oci.image.layer.v1.tar.
 // https://github.com/solo-io/wasm/blob/master/spec/spec-compat.md#specification
 func extractOCIStandardImage(img v1.Image) ([]byte, error) {
 	layers, err := img.Layers()
@@ -180,18 +222,29 @@ func extractOCIStandardImage(img v1.Image) ([]byte, error) {
 		return nil, fmt.Errorf("could not get media type: %v", err)
 	}
 
-	// Check if the layer is "application/vnd.oci.image.layer.v1.tar+gzip".
-	if types.OCILayer != mt {
-		return nil, fmt.Errorf("invalid media type %s (expect %s)", mt, types.OCILayer)
+	// Check if the layer is "application/vnd.oci.image.layer.v1.tar+gzip" or "application/vnd.oci.image.layer.v1.tar".
+	if mt != types.OCILayer && mt != types.OCIUncompressedLayer {
+		return nil, fmt.Errorf("invalid media type %s (expect %s or %s)", mt, types.OCILayer, types.OCIUncompressedLayer)
 	}
 
+	return extractCompatLayer(layer, mt == types.OCILayer)
+}
+
+// extractCompatLayer extracts the Wasm binary from the single layer of a *compat* variant image. The content of
+// the layer is read as stored in the registry, which is a tar.gz archive if compressed, or a tar archive otherwise.
+func extractCompatLayer(layer v1.Layer, compressed bool) ([]byte, error) {
 	r, err := layer.Compressed()
 	if err != nil {
 		return nil, fmt.Errorf("could not get layer content: %v", err)
 	}
 	defer r.Close()
 
-	ret, err := extractWasmPluginBinary(r)
+	var ret []byte
+	if compressed {
+		ret, err = extractWasmPluginBinary(r)
+	} else {
+		ret, err = extractWasmPluginBinaryFromTar(r)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not extract wasm binary: %v", err)
 	}
@@ -205,13 +258,18 @@ func extractWasmPluginBinary(r io.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse layer as tar.gz: %v", err)
 	}
+	return extractWasmPluginBinaryFromTar(gr)
+}
 
+// Extracts the Wasm plugin binary named "plugin.wasm" in a given reader for tar.
+// This is only used for *compat* variant.
+func extractWasmPluginBinaryFromTar(r io.Reader) ([]byte, error) {
 	// The target file name for Wasm binary.
 	// https://github.com/solo-io/wasm/blob/master/spec/spec-compat.md#specification
 	const wasmPluginFileName = "plugin.wasm"
 
 	// Search for the file walking through the archive.
-	tr := tar.NewReader(gr)
+	tr := tar.NewReader(r)
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
@@ -36,6 +36,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -190,6 +191,41 @@ func TestImageFetcher_Fetch(t *testing.T) {
 		}
 	})
 
+	t.Run("OCI standard uncompressed", func(t *testing.T) {
+		ref := fmt.Sprintf("%s/test/valid/oci_standard_uncompressed", u.Host)
+		exp := "this is wasm plugin"
+
+		// Create OCI uncompressed layer.
+		l, err := newUncompressedLayer(types.OCIUncompressedLayer, map[string][]byte{"plugin.wasm": []byte(exp)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.MediaType = "no-docker"
+
+		// Push image to the registry.
+		err = crane.Push(img, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Fetch OCI image.
+		actual, err := fetcher.Fetch(ref, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != exp {
+			t.Errorf("ImageFetcher.Fetch got %s, but want '%s'", string(actual), exp)
+		}
+	})
+
 	t.Run("OCI artifact", func(t *testing.T) {
 		ref := fmt.Sprintf("%s/test/valid/oci_artifact", u.Host)
 
@@ -269,7 +305,7 @@ func TestImageFetcher_Fetch(t *testing.T) {
 	t.Run("invalid image", func(t *testing.T) {
 		ref := fmt.Sprintf("%s/test/invalid", u.Host)
 
-		l, err := newMockLayer(types.OCIUncompressedLayer, map[string][]byte{"not-wasm.txt": []byte("a")})
+		l, err := newUncompressedLayer(types.OCIUncompressedLayer, map[string][]byte{"not-wasm.txt": []byte("a")})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -298,7 +334,7 @@ func TestImageFetcher_Fetch(t *testing.T) {
 		}
 
 		expErr := `the given image is in invalid format as an OCI image: 2 errors occurred:
-	* could not parse as compat variant: invalid media type application/vnd.oci.image.layer.v1.tar (expect application/vnd.oci.image.layer.v1.tar+gzip)
+	* could not parse as compat variant: could not extract wasm binary: plugin.wasm not found in the archive
 	* could not parse as oci variant: number of layers must be 2 but got 1`
 		if actual := strings.TrimSpace(err.Error()); actual != expErr {
 			t.Errorf("ImageFetcher.Fetch get unexpected error '%v', but want '%v'", actual, expErr)
@@ -329,6 +365,28 @@ func TestExtractDockerImage(t *testing.T) {
 		}
 	})
 
+	t.Run("valid uncompressed", func(t *testing.T) {
+		exp := "this is wasm binary"
+		l, err := newUncompressedLayer(types.DockerUncompressedLayer, map[string][]byte{
+			"plugin.wasm": []byte(exp),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := extractDockerImage(img)
+		if err != nil {
+			t.Fatalf("extractDockerImage failed: %v", err)
+		}
+
+		if string(actual) != exp {
+			t.Fatalf("got %s, but want %s", string(actual), exp)
+		}
+	})
+
 	t.Run("multiple layers", func(t *testing.T) {
 		l, err := newMockLayer(types.DockerLayer, nil)
 		if err != nil {
@@ -386,6 +444,28 @@ func TestExtractOCIStandardImage(t *testing.T) {
 		}
 	})
 
+	t.Run("valid uncompressed", func(t *testing.T) {
+		exp := "this is wasm binary"
+		l, err := newUncompressedLayer(types.OCIUncompressedLayer, map[string][]byte{
+			"plugin.wasm": []byte(exp),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := extractOCIStandardImage(img)
+		if err != nil {
+			t.Fatalf("extractOCIStandardImage failed: %v", err)
+		}
+
+		if string(actual) != exp {
+			t.Fatalf("got %s, but want %s", string(actual), exp)
+		}
+	})
+
 	t.Run("multiple layers", func(t *testing.T) {
 		l, err := newMockLayer(types.OCILayer, nil)
 		if err != nil {
@@ -451,6 +531,28 @@ func newMockLayer(mediaType types.MediaType, contents map[string][]byte) (v1.Lay
 	)
 }
 
+// newUncompressedLayer creates a layer stored as an uncompressed tar archive, as produced by some build pipelines.
+func newUncompressedLayer(mediaType types.MediaType, contents map[string][]byte) (v1.Layer, error) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for filename, content := range contents {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     filename,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeRegA,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return static.NewLayer(b.Bytes(), mediaType), nil
+}
+
 type mockLayer struct {
 	raw       []byte
 	diffID    v1.Hash
@@ -0,0 +1,179 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// dockerConfig is the content of a kubernetes.io/dockerconfigjson Secret.
+type dockerConfig struct {
+	Auths map[string]authn.AuthConfig `json:"auths"`
+}
+
+// pullSecretKeychain resolves registry credentials from image pull secrets, keyed by registry host.
+type pullSecretKeychain map[string]authn.AuthConfig
+
+var _ authn.Keychain = pullSecretKeychain{}
+
+// newPullSecretKeychain parses a docker config JSON, as sent by istiod for image pull secrets, into a keychain.
+func newPullSecretKeychain(pullSecret []byte) (pullSecretKeychain, error) {
+	cfg := dockerConfig{}
+	if err := json.Unmarshal(pullSecret, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse image pull secret: %v", err)
+	}
+	kc := pullSecretKeychain{}
+	for registry, auth := range cfg.Auths {
+		host := registryHost(registry)
+		// As with the kubelet, the first entry for a registry wins.
+		if _, f := kc[host]; !f {
+			kc[host] = auth
+		}
+	}
+	return kc, nil
+}
+
+// Resolve implements authn.Keychain.
+func (k pullSecretKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	auth, f := k[registryHost(target.RegistryStr())]
+	if !f {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(auth), nil
+}
+
+// ParseGlobalCredentialsNamespaces parses a comma separated list of the namespaces allowed to use the default
+// keychain of the agent. "*" allows all namespaces, and returns nil.
+func ParseGlobalCredentialsNamespaces(s string) []string {
+	namespaces := []string{}
+	for _, ns := range strings.Split(s, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "*" {
+			return nil
+		}
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// credentialResolver selects the registry credentials of a fetch by the namespace of the WasmPlugin it is for, so
+// that the image pull secrets of a namespace are never used to fetch the modules of another. The default keychain
+// of the agent, read from DOCKER_CONFIG, is shared by all namespaces, so it is only used for the namespaces allowed
+// to.
+type credentialResolver struct {
+	// globalNamespaces are the namespaces allowed to use the default keychain. nil allows all namespaces.
+	globalNamespaces map[string]bool
+
+	mu sync.Mutex
+	// namespaces holds the keychain of the latest image pull secret received for each namespace.
+	namespaces map[string]*namespaceKeychain
+}
+
+type namespaceKeychain struct {
+	pullSecret string
+	keychain   pullSecretKeychain
+}
+
+// newCredentialResolver creates a credential resolver. globalNamespaces are the namespaces allowed to use the
+// default keychain; nil allows all namespaces.
+func newCredentialResolver(globalNamespaces []string) *credentialResolver {
+	r := &credentialResolver{namespaces: map[string]*namespaceKeychain{}}
+	if globalNamespaces != nil {
+		r.globalNamespaces = make(map[string]bool, len(globalNamespaces))
+		for _, ns := range globalNamespaces {
+			r.globalNamespaces[ns] = true
+		}
+	}
+	return r
+}
+
+// globalAllowed returns true if fetches for the namespace may use the default keychain. Fetches without a namespace
+// are requested by the agent itself, such as prefetched modules, and are always allowed to.
+func (r *credentialResolver) globalAllowed(namespace string) bool {
+	return r.globalNamespaces == nil || namespace == "" || r.globalNamespaces[namespace]
+}
+
+// keychain returns the keychain to fetch modules for the namespace with. Credentials from the pull secret take
+// precedence over the default keychain, which is only consulted for registries the pull secret has no entry for.
+func (r *credentialResolver) keychain(namespace string, pullSecret []byte) authn.Keychain {
+	var keychains []authn.Keychain
+	if len(pullSecret) > 0 {
+		if kc := r.namespaceKeychain(namespace, pullSecret); kc != nil {
+			keychains = append(keychains, kc)
+		}
+	}
+	if r.globalAllowed(namespace) {
+		// Note that default key chain reads the docker config from DOCKER_CONFIG
+		// so must set the envvar when reaching this branch is expected.
+		keychains = append(keychains, authn.DefaultKeychain)
+	}
+	switch len(keychains) {
+	case 0:
+		// Only anonymous fetches are allowed.
+		return pullSecretKeychain{}
+	case 1:
+		return keychains[0]
+	default:
+		return authn.NewMultiKeychain(keychains...)
+	}
+}
+
+// namespaceKeychain returns the keychain of the pull secret for the namespace, parsing it only if it changed.
+func (r *credentialResolver) namespaceKeychain(namespace string, pullSecret []byte) pullSecretKeychain {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, f := r.namespaces[namespace]; f && e.pullSecret == string(pullSecret) {
+		return e.keychain
+	}
+	kc, err := newPullSecretKeychain(pullSecret)
+	if err != nil {
+		wasmLog.Warnf("ignoring image pull secret for namespace %q: %v", namespace, err)
+		return nil
+	}
+	r.namespaces[namespace] = &namespaceKeychain{pullSecret: string(pullSecret), keychain: kc}
+	return kc
+}
+
+// scope returns the namespace the modules fetched for the namespace are cached for. Modules fetched with credentials
+// only the namespace may use are not shared with other namespaces; the others are cached for all namespaces allowed
+// to use the default keychain, with an empty scope.
+func (r *credentialResolver) scope(namespace string, pullSecret []byte) string {
+	if len(pullSecret) == 0 && r.globalAllowed(namespace) {
+		return ""
+	}
+	return namespace
+}
+
+// registryHost normalizes the registry keys found in docker configs, such as "https://index.docker.io/v1/",
+// to the registry host used by image references.
+func registryHost(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+	if registry == "docker.io" {
+		return name.DefaultRegistry
+	}
+	return registry
+}
@@ -0,0 +1,219 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func dockerAuth(user, pass string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+}
+
+func TestRegistryHost(t *testing.T) {
+	cases := map[string]string{
+		"registry.example.com":         "registry.example.com",
+		"registry.example.com:5000":    "registry.example.com:5000",
+		"https://registry.example.com": "registry.example.com",
+		"registry.example.com/team":    "registry.example.com",
+		"https://index.docker.io/v1/":  name.DefaultRegistry,
+		"docker.io":                    name.DefaultRegistry,
+	}
+	for in, want := range cases {
+		if got := registryHost(in); got != want {
+			t.Errorf("registryHost(%q) got %q want %q", in, got, want)
+		}
+	}
+}
+
+func TestImageFetcherOptionKeychain(t *testing.T) {
+	// The default keychain has credentials for both registries.
+	dir := t.TempDir()
+	defaultConfig := fmt.Sprintf(`{"auths":{"private.example.com":{"auth":%q},"other.example.com":{"auth":%q}}}`,
+		dockerAuth("default", "default"), dockerAuth("default", "default"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(defaultConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old, set := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer func() {
+		if set {
+			os.Setenv("DOCKER_CONFIG", old)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+	}()
+
+	pullSecret := []byte(fmt.Sprintf(`{"auths":{"https://private.example.com":{"auth":%q},"private.example.com":{"auth":%q}}}`,
+		dockerAuth("secret", "secret"), dockerAuth("second", "second")))
+
+	cases := []struct {
+		name     string
+		opt      ImageFetcherOption
+		registry string
+		want     string
+	}{
+		{
+			name:     "default keychain",
+			registry: "private.example.com",
+			want:     dockerAuth("default", "default"),
+		},
+		{
+			name:     "pull secret before default keychain",
+			opt:      ImageFetcherOption{PullSecret: pullSecret},
+			registry: "private.example.com",
+			want:     dockerAuth("secret", "secret"),
+		},
+		{
+			name:     "default keychain for registries missing from pull secret",
+			opt:      ImageFetcherOption{PullSecret: pullSecret},
+			registry: "other.example.com",
+			want:     dockerAuth("default", "default"),
+		},
+		{
+			name:     "invalid pull secret",
+			opt:      ImageFetcherOption{PullSecret: []byte("not json")},
+			registry: "private.example.com",
+			want:     dockerAuth("default", "default"),
+		},
+		{
+			name:     "anonymous",
+			opt:      ImageFetcherOption{PullSecret: pullSecret},
+			registry: "public.example.com",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			registry, err := name.NewRegistry(c.registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth, err := c.opt.keychain().Resolve(registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want == "" {
+				if auth != authn.Anonymous {
+					t.Fatalf("got %v want anonymous", auth)
+				}
+				return
+			}
+			cfg, err := auth.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cfg.Auth
+			if got == "" {
+				// The default keychain decodes the auth into the username and password.
+				got = dockerAuth(cfg.Username, cfg.Password)
+			}
+			if got != c.want {
+				t.Errorf("got auth %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseGlobalCredentialsNamespaces(t *testing.T) {
+	if got := ParseGlobalCredentialsNamespaces("*"); got != nil {
+		t.Fatalf("expected all namespaces to be allowed, got %v", got)
+	}
+	if got := ParseGlobalCredentialsNamespaces("istio-system, *"); got != nil {
+		t.Fatalf("expected all namespaces to be allowed, got %v", got)
+	}
+	got := ParseGlobalCredentialsNamespaces(" istio-system ,,team-a")
+	if want := []string{"istio-system", "team-a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	if got := ParseGlobalCredentialsNamespaces(""); got == nil || len(got) != 0 {
+		t.Fatalf("expected no namespace to be allowed, got %v", got)
+	}
+}
+
+func TestCredentialResolverNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	defaultConfig := fmt.Sprintf(`{"auths":{"private.example.com":{"auth":%q}}}`, dockerAuth("default", "default"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(defaultConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old, set := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer func() {
+		if set {
+			os.Setenv("DOCKER_CONFIG", old)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+	}()
+	secretA := []byte(fmt.Sprintf(`{"auths":{"private.example.com":{"auth":%q}}}`, dockerAuth("a", "a")))
+	secretB := []byte(fmt.Sprintf(`{"auths":{"private.example.com":{"auth":%q}}}`, dockerAuth("b", "b")))
+
+	r := newCredentialResolver([]string{"istio-system"})
+	cases := []struct {
+		name       string
+		namespace  string
+		pullSecret []byte
+		want       string
+		scope      string
+	}{
+		{name: "namespace pull secret", namespace: "team-a", pullSecret: secretA, want: dockerAuth("a", "a"), scope: "team-a"},
+		{name: "other namespace pull secret", namespace: "team-b", pullSecret: secretB, want: dockerAuth("b", "b"), scope: "team-b"},
+		{name: "updated pull secret", namespace: "team-a", pullSecret: secretB, want: dockerAuth("b", "b"), scope: "team-a"},
+		{name: "no global credentials", namespace: "team-a", scope: "team-a"},
+		{name: "global credentials allowed", namespace: "istio-system", want: dockerAuth("default", "default")},
+		{name: "agent fetch", want: dockerAuth("default", "default")},
+	}
+	registry, err := name.NewRegistry("private.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			auth, err := r.keychain(c.namespace, c.pullSecret).Resolve(registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scope := r.scope(c.namespace, c.pullSecret); scope != c.scope {
+				t.Errorf("got scope %q want %q", scope, c.scope)
+			}
+			if c.want == "" {
+				if auth != authn.Anonymous {
+					t.Fatalf("got %v want anonymous", auth)
+				}
+				return
+			}
+			cfg, err := auth.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cfg.Auth
+			if got == "" {
+				got = dockerAuth(cfg.Username, cfg.Password)
+			}
+			if got != c.want {
+				t.Errorf("got auth %q want %q", got, c.want)
+			}
+		})
+	}
+}
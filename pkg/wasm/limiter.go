@@ -0,0 +1,167 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxConcurrentFetchesPerHost is the default maximum number of concurrent Wasm module fetches from a
+	// single registry host.
+	DefaultMaxConcurrentFetchesPerHost = 5
+
+	// DefaultCircuitBreakerThreshold is the default number of consecutive fetch failures from a registry host
+	// after which fetches from the host are rejected.
+	DefaultCircuitBreakerThreshold = 5
+
+	// DefaultCircuitBreakerCooldown is the default duration fetches from a failing registry host are rejected for.
+	DefaultCircuitBreakerCooldown = time.Minute
+)
+
+// errCircuitOpen is returned when fetches from a registry host are rejected due to previous failures.
+var errCircuitOpen = errors.New("circuit open due to consecutive fetch failures")
+
+// FetchLimits configures how Wasm module fetches are limited per registry host.
+type FetchLimits struct {
+	// MaxConcurrentFetchesPerHost is the maximum number of concurrent fetches from a single host. Further
+	// fetches are queued until a fetch completes.
+	MaxConcurrentFetchesPerHost int
+	// CircuitBreakerThreshold is the number of consecutive failures from a host after which fetches from
+	// the host are rejected for CircuitBreakerCooldown.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+}
+
+// DefaultFetchLimits returns the default per registry host fetch limits.
+func DefaultFetchLimits() FetchLimits {
+	return FetchLimits{
+		MaxConcurrentFetchesPerHost: DefaultMaxConcurrentFetchesPerHost,
+		CircuitBreakerThreshold:     DefaultCircuitBreakerThreshold,
+		CircuitBreakerCooldown:      DefaultCircuitBreakerCooldown,
+	}
+}
+
+// hostLimiter limits concurrent fetches per registry host, and stops fetching from a host for a cooldown period
+// after consecutive failures, so that a misbehaving registry cannot starve fetches from healthy ones.
+type hostLimiter struct {
+	limits FetchLimits
+
+	mu     sync.Mutex
+	hosts  map[string]*hostState
+	queued int
+
+	// now is used for testing.
+	now func() time.Time
+}
+
+type hostState struct {
+	// slots holds a token for each in-progress fetch.
+	slots chan struct{}
+
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+func newHostLimiter(limits FetchLimits) *hostLimiter {
+	if limits.MaxConcurrentFetchesPerHost <= 0 {
+		limits.MaxConcurrentFetchesPerHost = DefaultMaxConcurrentFetchesPerHost
+	}
+	return &hostLimiter{
+		limits: limits,
+		hosts:  map[string]*hostState{},
+		now:    time.Now,
+	}
+}
+
+// acquire waits for a fetch slot for the host. If timeout is non-zero, it gives up waiting after the timeout.
+// On success, the returned function must be called once the fetch completes, with whether the host responded
+// successfully.
+func (l *hostLimiter) acquire(host string, timeout time.Duration) (func(success bool), error) {
+	l.mu.Lock()
+	hs, f := l.hosts[host]
+	if !f {
+		hs = &hostState{slots: make(chan struct{}, l.limits.MaxConcurrentFetchesPerHost)}
+		l.hosts[host] = hs
+	}
+	wasmFetchOpenCircuits.Record(float64(l.openCircuits()))
+	if l.isOpen(hs) {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("fetch from %s rejected: %w", host, errCircuitOpen)
+	}
+	l.mu.Unlock()
+
+	select {
+	case hs.slots <- struct{}{}:
+	default:
+		// All slots are in use, wait for one.
+		l.updateQueued(1)
+		var timeoutCh <-chan time.Time
+		if timeout != 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			timeoutCh = timer.C
+		}
+		select {
+		case hs.slots <- struct{}{}:
+			l.updateQueued(-1)
+		case <-timeoutCh:
+			l.updateQueued(-1)
+			return nil, fmt.Errorf("timed out waiting to fetch from %s", host)
+		}
+	}
+
+	return func(success bool) {
+		<-hs.slots
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if success {
+			hs.consecutiveFailures = 0
+			hs.openUntil = time.Time{}
+		} else {
+			hs.consecutiveFailures++
+			if l.limits.CircuitBreakerThreshold > 0 && hs.consecutiveFailures >= l.limits.CircuitBreakerThreshold {
+				hs.openUntil = l.now().Add(l.limits.CircuitBreakerCooldown)
+			}
+		}
+		wasmFetchOpenCircuits.Record(float64(l.openCircuits()))
+	}, nil
+}
+
+// isOpen returns whether fetches from the host should be rejected. Must be called with mu held.
+func (l *hostLimiter) isOpen(hs *hostState) bool {
+	return l.now().Before(hs.openUntil)
+}
+
+// openCircuits returns the number of hosts fetches are currently rejected for. Must be called with mu held.
+func (l *hostLimiter) openCircuits() int {
+	open := 0
+	for _, hs := range l.hosts {
+		if l.isOpen(hs) {
+			open++
+		}
+	}
+	return open
+}
+
+func (l *hostLimiter) updateQueued(delta int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queued += delta
+	wasmFetchQueued.Record(float64(l.queued))
+}
@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostLimiterConcurrency(t *testing.T) {
+	l := newHostLimiter(FetchLimits{MaxConcurrentFetchesPerHost: 1})
+
+	release, err := l.acquire("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another host has its own limit.
+	releaseB, err := l.acquire("b", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected fetch from another host to proceed, got %v", err)
+	}
+	releaseB(true)
+
+	if _, err := l.acquire("a", 10*time.Millisecond); err == nil {
+		t.Fatal("expected fetch to time out waiting for the host limit")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		r, err := l.acquire("a", 0)
+		if err != nil {
+			t.Error(err)
+		} else {
+			r(true)
+		}
+		close(acquired)
+	}()
+	release(true)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued fetch was not started once a slot was released")
+	}
+}
@@ -22,6 +22,11 @@ const (
 	fetchSuccess     = "success"
 	downloadFailure  = "download_failure"
 	checksumMismatch = "checksum_mismatched"
+	checksumMissing  = "checksum_missing"
+	circuitOpen      = "circuit_open"
+
+	// For Wasm pre-fetch metric, in addition to success and fetch failure.
+	budgetExceeded = "budget_exceeded"
 
 	// For Wasm conversion metric.
 	conversionSuccess   = "success"
@@ -34,6 +39,8 @@ const (
 var (
 	hitTag    = monitoring.MustCreateLabel("hit")
 	resultTag = monitoring.MustCreateLabel("result")
+	// registryTag is the host of the registry or server a Wasm module is fetched from.
+	registryTag = monitoring.MustCreateLabel("registry")
 
 	wasmCacheEntries = monitoring.NewGauge(
 		"wasm_cache_entries",
@@ -48,16 +55,43 @@ var (
 
 	wasmRemoteFetchCount = monitoring.NewSum(
 		"wasm_remote_fetch_count",
-		"number of Wasm remote fetches and results, including success, download failure, and checksum mismatch.",
+		"number of Wasm remote fetches and results, including success, download failure, checksum mismatch, checksum missing, and circuit open.",
 		monitoring.WithLabels(resultTag),
 	)
 
+	wasmFetchOpenCircuits = monitoring.NewGauge(
+		"wasm_fetch_open_circuits",
+		"number of Wasm registry hosts fetches are rejected for due to consecutive failures.",
+	)
+
+	wasmFetchRateLimitedCount = monitoring.NewSum(
+		"wasm_fetch_rate_limited_count",
+		"number of Wasm remote fetch requests rate limited by the registry.",
+		monitoring.WithLabels(registryTag),
+	)
+
+	wasmFetchQueued = monitoring.NewGauge(
+		"wasm_fetch_queued",
+		"number of Wasm remote fetches waiting for the per host concurrency limit.",
+	)
+
 	wasmConfigConversionCount = monitoring.NewSum(
 		"wasm_config_conversion_count",
 		"number of Wasm config conversion count and results, including success, no remote load, marshal failure, remote fetch failure, miss remote fetch hint.",
 		monitoring.WithLabels(resultTag),
 	)
 
+	wasmPrefetchCount = monitoring.NewSum(
+		"wasm_prefetch_count",
+		"number of Wasm modules pre-fetched at startup and results, including success, fetch failure, and budget exceeded.",
+		monitoring.WithLabels(resultTag),
+	)
+
+	wasmPrefetchComplete = monitoring.NewGauge(
+		"wasm_prefetch_complete",
+		"whether the pre-fetch of Wasm modules at startup has completed (1) or is in progress (0).",
+	)
+
 	wasmConfigConversionDuration = monitoring.NewDistribution(
 		"wasm_config_conversion_duration",
 		"Total time in milliseconds istio-agent spends on converting remote load in Wasm config.",
@@ -70,7 +104,12 @@ func init() {
 		wasmCacheEntries,
 		wasmCacheLookupCount,
 		wasmRemoteFetchCount,
+		wasmFetchOpenCircuits,
+		wasmFetchQueued,
+		wasmFetchRateLimitedCount,
 		wasmConfigConversionCount,
 		wasmConfigConversionDuration,
+		wasmPrefetchCount,
+		wasmPrefetchComplete,
 	)
 }
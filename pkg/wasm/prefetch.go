@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrefetchModule is a Wasm module fetched ahead of the first configuration referencing it.
+type PrefetchModule struct {
+	URL string
+	// Checksum is the sha256 checksum of the module, or the image digest for OCI modules. Modules are cached by
+	// URL and checksum, so this must match the sha256 of the WasmPlugin for the pre-fetched module to be used.
+	Checksum string
+}
+
+// PrefetchOptions bounds a pre-fetch pass.
+type PrefetchOptions struct {
+	// Parallelism is the maximum number of concurrent fetches.
+	Parallelism int
+	// Budget is the maximum duration of the pass, and the timeout of each fetch. Modules not fetched yet when
+	// the budget elapses are skipped.
+	Budget time.Duration
+}
+
+// ParsePrefetchModules parses a comma separated list of modules, each in the form url or url|sha256.
+func ParsePrefetchModules(s string) []PrefetchModule {
+	var modules []PrefetchModule
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		u, checksum := m, ""
+		if i := strings.LastIndex(m, "|"); i >= 0 {
+			u, checksum = m[:i], m[i+1:]
+		}
+		modules = append(modules, PrefetchModule{URL: u, Checksum: checksum})
+	}
+	return modules
+}
+
+// Prefetch fetches the modules into the cache, so that the first configuration referencing them does not wait
+// for the download. Failures are logged, and do not prevent the other modules from being fetched. Prefetch
+// returns the number of modules fetched, once all modules are fetched or the budget has elapsed.
+func Prefetch(cache Cache, modules []PrefetchModule, opts PrefetchOptions) int {
+	wasmPrefetchComplete.Record(0)
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	start := time.Now()
+	deadline := start.Add(opts.Budget)
+
+	queue := make(chan PrefetchModule, len(modules))
+	for _, m := range modules {
+		queue <- m
+	}
+	close(queue)
+
+	var mu sync.Mutex
+	fetched := 0
+	// Fetches in progress when the budget elapses are not waited for, so workers report on a buffered channel.
+	done := make(chan struct{}, parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for m := range queue {
+				if !time.Now().Before(deadline) {
+					wasmPrefetchCount.With(resultTag.Value(budgetExceeded)).Increment()
+					wasmLog.Warnf("skipping pre-fetch of Wasm module %v: budget of %v exceeded", m.URL, opts.Budget)
+					continue
+				}
+				if _, err := cache.Get(m.URL, m.Checksum, opts.Budget, "", nil); err != nil {
+					wasmPrefetchCount.With(resultTag.Value(fetchFailure)).Increment()
+					wasmLog.Warnf("failed to pre-fetch Wasm module %v: %v", m.URL, err)
+					continue
+				}
+				wasmPrefetchCount.With(resultTag.Value(fetchSuccess)).Increment()
+				mu.Lock()
+				fetched++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	timer := time.NewTimer(opts.Budget)
+	defer timer.Stop()
+	for remaining := parallelism; remaining > 0; remaining-- {
+		select {
+		case <-done:
+		case <-timer.C:
+			wasmLog.Warnf("Wasm module pre-fetch did not complete within %v", opts.Budget)
+			remaining = 0
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	wasmLog.Infof("pre-fetched %d of %d Wasm modules in %v", fetched, len(modules), time.Since(start))
+	wasmPrefetchComplete.Record(1)
+	return fetched
+}
@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestParsePrefetchModules(t *testing.T) {
+	got := ParsePrefetchModules(" oci://registry/plugin:v1 , https://host/plugin.wasm|0123,,oci://registry/plugin@sha256:abcd")
+	want := []PrefetchModule{
+		{URL: "oci://registry/plugin:v1"},
+		{URL: "https://host/plugin.wasm", Checksum: "0123"},
+		{URL: "oci://registry/plugin@sha256:abcd"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := ParsePrefetchModules(""); len(got) != 0 {
+		t.Fatalf("expected no modules, got %+v", got)
+	}
+}
+
+// pushWasmImages pushes an image with a Wasm module for each tag, and returns the modules for the images.
+func pushWasmImages(t *testing.T, host string, tags ...string) []PrefetchModule {
+	t.Helper()
+	modules := make([]PrefetchModule, 0, len(tags))
+	for _, tag := range tags {
+		binary := append(wasmHeader, []byte("wasm plugin "+tag)...)
+		l, err := newMockLayer(types.DockerLayer, map[string][]byte{"plugin.wasm": binary})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: l})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := fmt.Sprintf("%s/test/prefetch:%s", host, tag)
+		if err := crane.Push(img, ref); err != nil {
+			t.Fatal(err)
+		}
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, PrefetchModule{URL: "oci://" + ref, Checksum: d.Hex})
+	}
+	return modules
+}
+
+func TestPrefetch(t *testing.T) {
+	var blobFetches int32
+	reg := registry.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			atomic.AddInt32(&blobFetches, 1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := pushWasmImages(t, u.Host, "v1", "v2", "v3")
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	// A module which cannot be fetched does not prevent the others from being fetched.
+	modules := append([]PrefetchModule{{URL: fmt.Sprintf("oci://%s/test/missing:v1", u.Host)}}, images...)
+
+	if got := Prefetch(cache, modules, PrefetchOptions{Parallelism: 2, Budget: time.Minute}); got != len(images) {
+		t.Fatalf("expected %d modules to be fetched, got %d", len(images), got)
+	}
+	fetches := atomic.LoadInt32(&blobFetches)
+	if fetches == 0 {
+		t.Fatal("expected modules to be fetched from the registry")
+	}
+
+	// Subsequent fetches are served from the cache.
+	for _, m := range images {
+		if _, err := cache.Get(m.URL, m.Checksum, time.Minute, "", nil); err != nil {
+			t.Fatalf("failed to get pre-fetched module %v: %v", m.URL, err)
+		}
+	}
+	if got := atomic.LoadInt32(&blobFetches); got != fetches {
+		t.Fatalf("expected pre-fetched modules to be served from the cache, got %d registry fetches after pre-fetch", got-fetches)
+	}
+}
+
+func TestPrefetchBudget(t *testing.T) {
+	// The registry never serves blobs, so fetches only complete once they time out.
+	release := make(chan struct{})
+	reg := registry.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			<-release
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	// Unblock the pending fetches before the server is closed.
+	defer close(release)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := pushWasmImages(t, u.Host, "v1", "v2")
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	start := time.Now()
+	got := Prefetch(cache, images, PrefetchOptions{Parallelism: 1, Budget: 200 * time.Millisecond})
+	if got != 0 {
+		t.Fatalf("expected no modules to be fetched, got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected pre-fetch to complete within its budget, took %v", elapsed)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateLimitRetries is the maximum number of times a rate limited registry request is retried.
+const maxRateLimitRetries = 3
+
+// rateLimitDelay returns how long to wait before retrying a request the registry rate limited, as advertised
+// by the Retry-After header, either in seconds or as an HTTP date, or by the RateLimit-Reset header, in seconds.
+// It returns false if the response is not rate limited or does not advertise a delay.
+func rateLimitDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if v := strings.TrimSpace(resp.Header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := t.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+	if v := strings.TrimSpace(resp.Header.Get("RateLimit-Reset")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// recordRateLimited records a rate limited request to the registry host.
+func recordRateLimited(host string) {
+	wasmFetchRateLimitedCount.With(registryTag.Value(host)).Increment()
+}
+
+// waitRateLimit waits for the delay requested by a rate limiting registry. It fails immediately, rather than
+// waiting, if the context expires before the delay elapses.
+func waitRateLimit(ctx context.Context, host string, delay time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return fmt.Errorf("rate limited by %s: retry after %v exceeds the fetch deadline", host, delay)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("rate limited by %s: %v", host, ctx.Err())
+	}
+}
+
+// rateLimitTransport retries requests rate limited by the registry after the advertised delay, bounded by the
+// context of the request.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (r *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retries := 0; ; retries++ {
+		resp, err := r.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		recordRateLimited(req.URL.Host)
+		delay, ok := rateLimitDelay(resp, time.Now())
+		// Only requests without a body can be replayed.
+		if !ok || retries >= maxRateLimitRetries || (req.Body != nil && req.Body != http.NoBody) {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		wasmLog.Debugf("rate limited by %s, retrying after %v", req.URL.Host, delay)
+		if err := waitRateLimit(req.Context(), req.URL.Host, delay); err != nil {
+			return nil, err
+		}
+	}
+}
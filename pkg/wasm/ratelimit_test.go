@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestRateLimitDelay(t *testing.T) {
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		wantDelay time.Duration
+		wantOk    bool
+	}{
+		{
+			name:   "not rate limited",
+			status: http.StatusServiceUnavailable,
+			header: map[string]string{"Retry-After": "5"},
+		},
+		{
+			name:   "no delay advertised",
+			status: http.StatusTooManyRequests,
+		},
+		{
+			name:      "retry after seconds",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "5"},
+			wantDelay: 5 * time.Second,
+			wantOk:    true,
+		},
+		{
+			name:      "retry after date",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": now.Add(time.Minute).Format(http.TimeFormat)},
+			wantDelay: time.Minute,
+			wantOk:    true,
+		},
+		{
+			name:   "retry after date in the past",
+			status: http.StatusTooManyRequests,
+			header: map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)},
+			wantOk: true,
+		},
+		{
+			name:      "ratelimit reset",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"RateLimit-Reset": "10"},
+			wantDelay: 10 * time.Second,
+			wantOk:    true,
+		},
+		{
+			name:   "invalid header",
+			status: http.StatusTooManyRequests,
+			header: map[string]string{"Retry-After": "soon"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: c.status, Header: http.Header{}}
+			for k, v := range c.header {
+				resp.Header.Set(k, v)
+			}
+			delay, ok := rateLimitDelay(resp, now)
+			if delay != c.wantDelay || ok != c.wantOk {
+				t.Errorf("got delay %v (%v), want %v (%v)", delay, ok, c.wantDelay, c.wantOk)
+			}
+		})
+	}
+}
+
+func TestFetchRateLimitedImage(t *testing.T) {
+	var manifestRequests int32
+	reg := registry.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Rate limit the first manifest request.
+		if strings.Contains(r.URL.Path, "/manifests/") && r.Method == http.MethodGet &&
+			atomic.AddInt32(&manifestRequests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := pushWasmImages(t, u.Host, "v1")
+	atomic.StoreInt32(&manifestRequests, 0)
+
+	cache := NewLocalFileCache(t.TempDir(), DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+
+	start := time.Now()
+	if _, err := cache.Get(images[0].URL, images[0].Checksum, time.Minute, "", nil); err != nil {
+		t.Fatalf("expected the rate limited fetch to succeed after retrying: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the retry to wait for the Retry-After delay, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&manifestRequests); got < 2 {
+		t.Errorf("expected the manifest request to be retried, got %d requests", got)
+	}
+}
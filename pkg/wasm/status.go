@@ -0,0 +1,217 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FetchState is the state of a Wasm module fetch.
+type FetchState string
+
+const (
+	FetchStateDownloading FetchState = "downloading"
+	FetchStateVerifying   FetchState = "verifying"
+	FetchStateCached      FetchState = "cached"
+	FetchStateFailed      FetchState = "failed"
+)
+
+// maxRecentFetches bounds the number of completed fetches kept for debugging. In-flight fetches are always kept.
+const maxRecentFetches = 32
+
+// FetchStatus describes a recent or in-flight Wasm module fetch.
+type FetchStatus struct {
+	// Reference is the URL the module is fetched from.
+	Reference string `json:"reference"`
+	// Digest is the resolved digest of the module, or of the image for OCI modules, once known.
+	Digest           string     `json:"digest,omitempty"`
+	State            FetchState `json:"state"`
+	BytesTransferred int64      `json:"bytesTransferred"`
+	Attempts         int        `json:"attempts"`
+	// LastErrorClass is the class of the last error, matching the result label of the wasm_remote_fetch_count metric.
+	LastErrorClass string    `json:"lastErrorClass,omitempty"`
+	LastError      string    `json:"lastError,omitempty"`
+	Started        time.Time `json:"started"`
+	Updated        time.Time `json:"updated"`
+}
+
+// FetchStatusReporter is implemented by Wasm module caches that report the status of their fetches.
+type FetchStatusReporter interface {
+	// FetchStatus returns the in-flight and recent fetches, most recent first.
+	FetchStatus() []FetchStatus
+}
+
+// fetchStatusRegistry keeps track of in-flight and recent fetches.
+type fetchStatusRegistry struct {
+	mu sync.Mutex
+	// fetches is ordered by the start of the fetch.
+	fetches []*FetchStatus
+
+	// now is used for testing.
+	now func() time.Time
+}
+
+func newFetchStatusRegistry() *fetchStatusRegistry {
+	return &fetchStatusRegistry{now: time.Now}
+}
+
+// start records a new fetch, evicting the oldest completed fetches if needed.
+func (r *fetchStatusRegistry) start(reference string) *fetchTracker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	s := &FetchStatus{
+		Reference: reference,
+		State:     FetchStateDownloading,
+		Started:   now,
+		Updated:   now,
+	}
+	r.fetches = append(r.fetches, s)
+
+	completed := 0
+	for _, f := range r.fetches {
+		if f.completed() {
+			completed++
+		}
+	}
+	if completed > maxRecentFetches {
+		kept := r.fetches[:0]
+		for _, f := range r.fetches {
+			if completed > maxRecentFetches && f.completed() {
+				completed--
+				continue
+			}
+			kept = append(kept, f)
+		}
+		r.fetches = kept
+	}
+	return &fetchTracker{registry: r, status: s}
+}
+
+func (r *fetchStatusRegistry) list() []FetchStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]FetchStatus, 0, len(r.fetches))
+	for i := len(r.fetches) - 1; i >= 0; i-- {
+		res = append(res, *r.fetches[i])
+	}
+	return res
+}
+
+func (s *FetchStatus) completed() bool {
+	return s.State == FetchStateCached || s.State == FetchStateFailed
+}
+
+// fetchTracker updates the status of a single fetch. A nil tracker ignores all updates.
+type fetchTracker struct {
+	registry *fetchStatusRegistry
+	status   *FetchStatus
+}
+
+func (t *fetchTracker) update(fn func(s *FetchStatus)) {
+	if t == nil {
+		return
+	}
+	t.registry.mu.Lock()
+	defer t.registry.mu.Unlock()
+	fn(t.status)
+	t.status.Updated = t.registry.now()
+}
+
+// attempt records a new attempt to download the module.
+func (t *fetchTracker) attempt() {
+	t.update(func(s *FetchStatus) {
+		s.Attempts++
+		s.State = FetchStateDownloading
+	})
+}
+
+func (t *fetchTracker) addBytes(n int64) {
+	t.update(func(s *FetchStatus) {
+		s.BytesTransferred += n
+	})
+}
+
+func (t *fetchTracker) setState(state FetchState) {
+	t.update(func(s *FetchStatus) {
+		s.State = state
+	})
+}
+
+func (t *fetchTracker) setDigest(digest string) {
+	t.update(func(s *FetchStatus) {
+		s.Digest = digest
+	})
+}
+
+// recordError records an error of an attempt, without failing the fetch as it may be retried.
+func (t *fetchTracker) recordError(class string, err error) {
+	t.update(func(s *FetchStatus) {
+		s.LastErrorClass = class
+		s.LastError = err.Error()
+	})
+}
+
+func (t *fetchTracker) fail(class string, err error) {
+	t.update(func(s *FetchStatus) {
+		s.State = FetchStateFailed
+		s.LastErrorClass = class
+		s.LastError = err.Error()
+	})
+}
+
+// reader wraps r so that bytes read from it are recorded as transferred.
+func (t *fetchTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &countingReader{r: r, t: t}
+}
+
+type countingReader struct {
+	r io.Reader
+	t *fetchTracker
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.t.addBytes(int64(n))
+	}
+	return n, err
+}
+
+// countingTransport records the bytes of response bodies as transferred.
+type countingTransport struct {
+	base    http.RoundTripper
+	tracker *fetchTracker
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &countingReadCloser{Reader: c.tracker.reader(resp.Body), Closer: resp.Body}
+	return resp, nil
+}
+
+type countingReadCloser struct {
+	io.Reader
+	io.Closer
+}
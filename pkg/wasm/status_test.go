@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFetchStatusRegistryBounded(t *testing.T) {
+	r := newFetchStatusRegistry()
+	inFlight := r.start("oci://in-flight")
+	for i := 0; i < maxRecentFetches*2; i++ {
+		tr := r.start(fmt.Sprintf("oci://completed-%d", i))
+		if i%2 == 0 {
+			tr.setState(FetchStateCached)
+		} else {
+			tr.fail(downloadFailure, errors.New("boom"))
+		}
+	}
+	current := r.start("oci://current")
+
+	status := r.list()
+	if len(status) != maxRecentFetches+2 {
+		t.Fatalf("expected %d fetches, got %d", maxRecentFetches+2, len(status))
+	}
+	// Most recent first, and in-flight fetches are never evicted.
+	if status[0].Reference != "oci://current" || status[len(status)-1].Reference != "oci://in-flight" {
+		t.Fatalf("unexpected order: first %v, last %v", status[0].Reference, status[len(status)-1].Reference)
+	}
+	if status[1].Reference != fmt.Sprintf("oci://completed-%d", maxRecentFetches*2-1) {
+		t.Fatalf("expected most recent completed fetch to be kept, got %v", status[1].Reference)
+	}
+	if status[1].LastErrorClass != downloadFailure || status[1].LastError != "boom" {
+		t.Fatalf("unexpected error: %+v", status[1])
+	}
+
+	inFlight.attempt()
+	inFlight.addBytes(10)
+	current.setState(FetchStateVerifying)
+	status = r.list()
+	if got := status[len(status)-1]; got.Attempts != 1 || got.BytesTransferred != 10 {
+		t.Fatalf("unexpected progress: %+v", got)
+	}
+	if status[0].State != FetchStateVerifying {
+		t.Fatalf("unexpected state: %+v", status[0])
+	}
+
+	// Updates on a nil tracker are ignored.
+	var nilTracker *fetchTracker
+	nilTracker.attempt()
+	nilTracker.fail(downloadFailure, errors.New("ignored"))
+}
@@ -0,0 +1,86 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// nolint: golint
+package fuzz
+
+import (
+	"go.opencensus.io/stats/view"
+	k8s "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/config/kube/gateway"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/kube"
+)
+
+// gatewayAPIStatus returns the empty status of a gateway-api object, as it is set when reading from the cluster.
+func gatewayAPIStatus(kind config.GroupVersionKind) config.Status {
+	switch kind {
+	case gvk.GatewayClass:
+		return &k8s.GatewayClassStatus{}
+	case gvk.KubernetesGateway:
+		return &k8s.GatewayStatus{}
+	case gvk.HTTPRoute:
+		return &k8s.HTTPRouteStatus{}
+	case gvk.TCPRoute:
+		return &k8s.TCPRouteStatus{}
+	case gvk.TLSRoute:
+		return &k8s.TLSRouteStatus{}
+	}
+	return nil
+}
+
+// gatewayConversionPanics returns the number of objects the gateway-api conversion skipped due to a panic.
+func gatewayConversionPanics() float64 {
+	rows, err := view.RetrieveData("pilot_k8s_gateway_conversion_panics")
+	if err != nil {
+		return 0
+	}
+	total := 0.0
+	for _, row := range rows {
+		total += row.Data.(*view.SumData).Value
+	}
+	return total
+}
+
+// FuzzGatewayConversion converts the gateway-api objects parsed from the input. The conversion recovers from
+// panics so they do not crash istiod, so any skipped object is reported as a failure here.
+func FuzzGatewayConversion(data []byte) int {
+	configs, _, err := crd.ParseInputs(string(data))
+	if err != nil || len(configs) == 0 {
+		return 0
+	}
+	store := memory.NewController(memory.Make(collections.All))
+	for _, cfg := range configs {
+		cfg.Status = gatewayAPIStatus(cfg.GroupVersionKind)
+		if _, err := store.Create(cfg); err != nil {
+			return 0
+		}
+	}
+	c := gateway.NewController(kube.NewFakeClient(), store, controller.Options{DomainSuffix: "cluster.local"})
+	before := gatewayConversionPanics()
+	if err := c.Recompute(model.NewGatewayContext(model.NewPushContext())); err != nil {
+		panic(err)
+	}
+	if gatewayConversionPanics() != before {
+		panic("gateway-api conversion panicked")
+	}
+	return 1
+}
@@ -146,6 +146,7 @@ func TestFuzzers(t *testing.T) {
 		{"FuzzInmemoryKube", FuzzInmemoryKube},
 		{"FuzzGenCSR", FuzzGenCSR},
 		{"FuzzCreateCertE2EUsingClientCertAuthenticator", FuzzCreateCertE2EUsingClientCertAuthenticator},
+		{"FuzzGatewayConversion", FuzzGatewayConversion},
 	}
 	for _, tt := range cases {
 		if testedFuzzers.Contains(tt.name) {